@@ -8,8 +8,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,16 +21,28 @@ import (
 
 	"github.com/freitascorp/devopsclaw/pkg/agent"
 	"github.com/freitascorp/devopsclaw/pkg/bus"
+	"github.com/freitascorp/devopsclaw/pkg/config"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
 	"github.com/freitascorp/devopsclaw/pkg/logger"
 	"github.com/freitascorp/devopsclaw/pkg/providers"
 	"github.com/freitascorp/devopsclaw/pkg/tui"
 )
 
 func agentCmd() {
+	agentCmdWithConfig(nil)
+}
+
+// agentCmdWithConfig runs the agent command against cfg, or against the
+// loaded config when cfg is nil. Commands that adjust the config for a
+// single run, such as browse, pass it here rather than through the
+// environment.
+func agentCmdWithConfig(cfg *config.Config) {
 	message := ""
 	sessionKey := "cli:default"
 	modelOverride := ""
 	debugMode := false
+	maxOutputLines := tui.DefaultMaxOutputLines
+	stripANSI := false
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
@@ -51,6 +65,18 @@ func agentCmd() {
 				modelOverride = args[i+1]
 				i++
 			}
+		case "--max-output-lines":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 0 {
+					fmt.Fprintf(os.Stderr, "invalid --max-output-lines %q: want a number >= 0\n", args[i+1])
+					os.Exit(1)
+				}
+				maxOutputLines = n
+				i++
+			}
+		case "--strip-ansi":
+			stripANSI = true
 		}
 	}
 
@@ -64,10 +90,13 @@ func agentCmd() {
 	// Initialize renderer
 	chat := tui.NewChatRenderer()
 
-	cfg, err := loadConfig()
-	if err != nil {
-		fmt.Println(chat.RenderError(fmt.Sprintf("Config error: %v", err)))
-		os.Exit(1)
+	if cfg == nil {
+		var err error
+		cfg, err = loadConfig()
+		if err != nil {
+			fmt.Println(chat.RenderError(fmt.Sprintf("Config error: %v", err)))
+			os.Exit(1)
+		}
 	}
 
 	if modelOverride != "" {
@@ -85,6 +114,7 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop.SetCostTracker(newCostTracker(cfg))
 
 	// Set up real-time event rendering — this is what makes it feel like Claude Code.
 	// Every tool call, result, and iteration is visible to the user as it happens.
@@ -174,13 +204,38 @@ func agentCmd() {
 		fmt.Print(chat.RenderAgentResponse(response))
 	} else {
 		// Interactive mode — full-screen Bubble Tea TUI (claudechic replica)
-		interactiveModeTUI(agentLoop, sessionKey, cfg.Agents.Defaults.Model)
+		opts := []tui.ChatOption{
+			tui.WithMaxOutputLines(maxOutputLines),
+			tui.WithStripANSI(stripANSI),
+		}
+		if poll, closeStore := agentFleetStatus(cfg); poll != nil {
+			defer closeStore()
+			opts = append(opts, tui.WithFleetStatus(poll, tui.DefaultFleetStatusInterval))
+		}
+		interactiveModeTUI(agentLoop, sessionKey, cfg.Agents.Defaults.Model, opts...)
+	}
+}
+
+// agentFleetStatus returns the footer's fleet status source and a func that
+// releases it. Node status lives with the relay, so it reads the shared
+// fleet store; with fleet disabled or an in-memory store, which would only
+// ever show an empty fleet, poll is nil and the footer leaves fleet out.
+func agentFleetStatus(cfg *config.Config) (poll tui.FleetStatusFunc, closeStore func()) {
+	if !cfg.Fleet.Enabled || cfg.Fleet.Store == "" || cfg.Fleet.Store == "memory" {
+		return nil, func() {}
 	}
+	// Discard fleet logs; anything on stderr bleeds into the alt-screen.
+	slogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := openFleetStore(cfg, slogger)
+	if err != nil {
+		return func(context.Context) (*fleet.FleetSummary, error) { return nil, err }, func() {}
+	}
+	return fleet.NewNodeManager(store, slogger).Summary, func() { closeFleetStore(store) }
 }
 
 // interactiveModeTUI launches the full-screen Bubble Tea chat, replicating claudechic.
-func interactiveModeTUI(agentLoop *agent.AgentLoop, sessionKey, modelName string) {
-	p, promptCh := tui.RunChatApp(modelName)
+func interactiveModeTUI(agentLoop *agent.AgentLoop, sessionKey, modelName string, opts ...tui.ChatOption) {
+	p, promptCh := tui.RunChatApp(modelName, opts...)
 
 	// Wire agent events → Bubble Tea messages
 	agentLoop.SetEventCallback(func(event agent.AgentEvent) {
@@ -216,6 +271,8 @@ func interactiveModeTUI(agentLoop *agent.AgentLoop, sessionKey, modelName string
 				Content: fmt.Sprintf("✗ %s – %s", event.ToolName, event.DenyReason),
 				Time:    time.Now(),
 			}})
+		case agent.EventResponseDelta:
+			p.Send(tui.AppendChatDeltaMsg{Delta: event.Content})
 		case agent.EventResponse:
 			if event.TotalTokens > 0 {
 				p.Send(tui.UsageMsg{
@@ -286,6 +343,7 @@ func interactiveModeTUI(agentLoop *agent.AgentLoop, sessionKey, modelName string
 			p.Send(tui.ThinkingMsg{Active: false})
 
 			if err != nil {
+				p.Send(tui.StreamDoneMsg{}) // keep any partial reply as streamed
 				p.Send(tui.AppendChatMsg{Msg: tui.ChatMsg{
 					Role:    "error",
 					Content: err.Error(),
@@ -294,11 +352,9 @@ func interactiveModeTUI(agentLoop *agent.AgentLoop, sessionKey, modelName string
 				continue
 			}
 
-			p.Send(tui.AppendChatMsg{Msg: tui.ChatMsg{
-				Role:    "assistant",
-				Content: response,
-				Time:    time.Now(),
-			}})
+			// Replaces the streamed text with the final response, or adds
+			// it when the provider does not stream.
+			p.Send(tui.StreamDoneMsg{Content: response})
 		}
 	}()
 
@@ -119,7 +119,7 @@ func authLoginOpenAI(useDeviceCode bool) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := loadAuthConfig()
 	if err == nil {
 		// Update Providers (legacy format)
 		appCfg.Providers.OpenAI.AuthMethod = "oauth"
@@ -193,7 +193,7 @@ func authLoginGoogleAntigravity() {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := loadAuthConfig()
 	if err == nil {
 		// Update Providers (legacy format, for backward compatibility)
 		appCfg.Providers.Antigravity.AuthMethod = "oauth"
@@ -270,7 +270,7 @@ func authLoginPasteToken(provider string) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := loadAuthConfig()
 	if err == nil {
 		switch provider {
 		case "anthropic":
@@ -343,35 +343,9 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
-		if err == nil {
-			// Clear AuthMethod in ModelList
-			for i := range appCfg.ModelList {
-				switch provider {
-				case "openai":
-					if isOpenAIModel(appCfg.ModelList[i].Model) {
-						appCfg.ModelList[i].AuthMethod = ""
-					}
-				case "anthropic":
-					if isAnthropicModel(appCfg.ModelList[i].Model) {
-						appCfg.ModelList[i].AuthMethod = ""
-					}
-				case "google-antigravity", "antigravity":
-					if isAntigravityModel(appCfg.ModelList[i].Model) {
-						appCfg.ModelList[i].AuthMethod = ""
-					}
-				}
-			}
-			// Clear AuthMethod in Providers (legacy)
-			switch provider {
-			case "openai":
-				appCfg.Providers.OpenAI.AuthMethod = ""
-			case "anthropic":
-				appCfg.Providers.Anthropic.AuthMethod = ""
-			case "google-antigravity", "antigravity":
-				appCfg.Providers.Antigravity.AuthMethod = ""
-			}
-			config.SaveConfig(getConfigPath(), appCfg)
+		if err := clearAuthMethods(provider); err != nil {
+			fmt.Printf("Failed to update config: %v\n", err)
+			os.Exit(1)
 		}
 
 		fmt.Printf("Logged out from %s\n", provider)
@@ -381,23 +355,65 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
-		if err == nil {
-			// Clear all AuthMethods in ModelList
-			for i := range appCfg.ModelList {
-				appCfg.ModelList[i].AuthMethod = ""
-			}
-			// Clear all AuthMethods in Providers (legacy)
-			appCfg.Providers.OpenAI.AuthMethod = ""
-			appCfg.Providers.Anthropic.AuthMethod = ""
-			appCfg.Providers.Antigravity.AuthMethod = ""
-			config.SaveConfig(getConfigPath(), appCfg)
+		if err := clearAuthMethods(""); err != nil {
+			fmt.Printf("Failed to update config: %v\n", err)
+			os.Exit(1)
 		}
 
 		fmt.Println("Logged out from all providers")
 	}
 }
 
+// loadAuthConfig loads the base config.json without the active profile.
+// Auth commands save the config back, and saving a profile-merged config
+// would copy the profile's values, tokens included, into the base file.
+func loadAuthConfig() (*config.Config, error) {
+	return config.LoadConfig(getConfigPath())
+}
+
+// clearAuthMethods clears the auth method of provider's models and legacy
+// provider entry in the base config, or of every provider if provider is
+// empty, and saves it.
+func clearAuthMethods(provider string) error {
+	appCfg, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+	for i := range appCfg.ModelList {
+		model := appCfg.ModelList[i].Model
+		switch provider {
+		case "":
+			appCfg.ModelList[i].AuthMethod = ""
+		case "openai":
+			if isOpenAIModel(model) {
+				appCfg.ModelList[i].AuthMethod = ""
+			}
+		case "anthropic":
+			if isAnthropicModel(model) {
+				appCfg.ModelList[i].AuthMethod = ""
+			}
+		case "google-antigravity", "antigravity":
+			if isAntigravityModel(model) {
+				appCfg.ModelList[i].AuthMethod = ""
+			}
+		}
+	}
+	// Legacy providers config
+	switch provider {
+	case "":
+		appCfg.Providers.OpenAI.AuthMethod = ""
+		appCfg.Providers.Anthropic.AuthMethod = ""
+		appCfg.Providers.Antigravity.AuthMethod = ""
+	case "openai":
+		appCfg.Providers.OpenAI.AuthMethod = ""
+	case "anthropic":
+		appCfg.Providers.Anthropic.AuthMethod = ""
+	case "google-antigravity", "antigravity":
+		appCfg.Providers.Antigravity.AuthMethod = ""
+	}
+	return config.SaveConfig(getConfigPath(), appCfg)
+}
+
 func authStatusCmd() {
 	store, err := auth.LoadStore()
 	if err != nil {
@@ -6,6 +6,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,8 +18,10 @@ import (
 	"github.com/freitascorp/devopsclaw/pkg/bus"
 	"github.com/freitascorp/devopsclaw/pkg/channels"
 	"github.com/freitascorp/devopsclaw/pkg/config"
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
 	"github.com/freitascorp/devopsclaw/pkg/cron"
 	"github.com/freitascorp/devopsclaw/pkg/devices"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
 	"github.com/freitascorp/devopsclaw/pkg/health"
 	"github.com/freitascorp/devopsclaw/pkg/heartbeat"
 	"github.com/freitascorp/devopsclaw/pkg/logger"
@@ -200,13 +203,51 @@ func gatewayCmd() {
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
 
 	// Mount observability metrics endpoint
-	metricsRegistry := observability.NewMetricsRegistry()
-	healthServer.MountFunc("/metrics", observability.MetricsHandler(metricsRegistry))
+	metrics := observability.NewDevOpsClawMetrics()
+	agentLoop.SetMetrics(metrics)
+	costs := newCostTracker(cfg)
+	costs.SetMetrics(metrics)
+	agentLoop.SetCostTracker(costs)
+	metricsRegistry := metrics.Registry
+	healthServer.MountFunc("/metrics", observability.MetricsHandler(metricsRegistry,
+		observability.WithMetricsGzip(),
+		observability.WithMetricsCache(observability.DefaultMetricsCacheTTL)))
+	healthServer.MountFunc("/metrics/summary", observability.MetricsSummaryHandler(metricsRegistry))
 	// Pre-register standard metrics
 	metricsRegistry.GetCounter("devopsclaw_requests_total", "Total requests processed")
 	metricsRegistry.GetCounter("devopsclaw_tool_calls_total", "Total tool calls executed")
 	metricsRegistry.GetCounter("devopsclaw_errors_total", "Total errors")
 
+	tracer := newTracer(cfg)
+	if endpoint := cfg.Observability.OTLP.Endpoint; endpoint != "" {
+		fmt.Printf("✓ Exporting traces to %s\n", endpoint)
+	}
+	agentLoop.SetTracer(tracer)
+
+	taskHistory, err := newTaskHistory(cfg)
+	if err != nil {
+		fmt.Printf("⚠ Warning: task history disabled: %v\n", err)
+	} else {
+		agentLoop.SetTaskHistory(taskHistory)
+		defer taskHistory.Close()
+	}
+
+	stopFleet := func() {}
+	if cfg.Fleet.Enabled {
+		executor, stop, err := startGatewayFleet(ctx, cfg, newLogger())
+		if err != nil {
+			fmt.Printf("⚠ Warning: fleet_exec disabled: %v\n", err)
+		} else {
+			stopFleet = stop
+			executor.SetDispatchWaitObserver(metrics.ObserveDispatchWait)
+			executor.SetTracer(tracer)
+			typed := contracts.NewRegistry()
+			fleet.RegisterExecContract(typed, executor)
+			agentLoop.RegisterTool(tools.NewContractTool(typed, "fleet_exec"))
+			fmt.Println("✓ Fleet relay accepting agents (fleet_exec tool enabled)")
+		}
+	}
+
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]any{"error": err.Error()})
@@ -221,8 +262,14 @@ func gatewayCmd() {
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
+	stopFleet()
 	cancel()
 	healthServer.Stop(context.Background())
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Error flushing traces: %v\n", err)
+	}
+	shutdownCancel()
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
@@ -256,3 +303,30 @@ func setupCronTool(
 
 	return cronService
 }
+
+// startGatewayFleet serves the relay from the gateway over the configured
+// fleet store, so node agents can connect to it, and returns the executor
+// behind the fleet_exec tool. stop drains the relay and closes the store.
+func startGatewayFleet(ctx context.Context, cfg *config.Config, slogger *slog.Logger) (executor *fleet.Executor, stop func(), err error) {
+	store, err := openFleetStore(cfg, slogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, _, executor, wsServer := newFleetStackWithStore(cfg, store, slogger)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := wsServer.Start(ctx); err != nil {
+			fmt.Printf("⚠ Warning: fleet relay stopped: %v\n", err)
+		}
+	}()
+	stop = func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		wsServer.Shutdown(shutdownCtx)
+		<-done
+		closeFleetStore(store)
+	}
+	return executor, stop, nil
+}
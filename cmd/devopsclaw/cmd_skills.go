@@ -20,15 +20,18 @@ func skillsHelp() {
 	fmt.Println("\nSkills commands:")
 	fmt.Println("  list                    List installed skills")
 	fmt.Println("  install <repo>          Install skill from GitHub")
+	fmt.Println("  install <name>          Install skill listed in the skills index")
 	fmt.Println("  install-builtin         Install all builtin skills to workspace")
 	fmt.Println("  list-builtin            List available builtin skills")
 	fmt.Println("  remove <name>           Remove installed skill")
-	fmt.Println("  search                  Search available skills")
+	fmt.Println("  search [query]          Search the skills index")
 	fmt.Println("  show <name>             Show skill details")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  devopsclaw skills list")
 	fmt.Println("  devopsclaw skills install freitascorp/devopsclaw-skills/weather")
+	fmt.Println("  devopsclaw skills search terraform")
+	fmt.Println("  devopsclaw skills install vault")
 	fmt.Println("  devopsclaw skills install-builtin")
 	fmt.Println("  devopsclaw skills list-builtin")
 	fmt.Println("  devopsclaw skills remove weather")
@@ -53,9 +56,20 @@ func skillsListCmd(loader *skills.SkillsLoader) {
 	}
 }
 
-func skillsInstallCmd(installer *skills.SkillInstaller, cfg *config.Config) {
+// newSkillIndex returns the configured skill index, cached next to the
+// config file.
+func newSkillIndex(cfg *config.Config) *skills.SkillIndex {
+	return skills.NewSkillIndex(
+		cfg.Tools.Skills.Index.URL,
+		filepath.Join(filepath.Dir(getConfigPath()), "skills-index.json"),
+		time.Duration(cfg.Tools.Skills.Index.TTLSeconds)*time.Second,
+	)
+}
+
+func skillsInstallCmd(installer *skills.SkillInstaller, index *skills.SkillIndex, cfg *config.Config) {
 	if len(os.Args) < 4 {
 		fmt.Println("Usage: devopsclaw skills install <github-repo>")
+		fmt.Println("       devopsclaw skills install <name>")
 		fmt.Println("       devopsclaw skills install --registry <name> <slug>")
 		return
 	}
@@ -75,17 +89,45 @@ func skillsInstallCmd(installer *skills.SkillInstaller, cfg *config.Config) {
 
 	// Default: install from GitHub (backward compatible).
 	repo := os.Args[3]
-	fmt.Printf("Installing skill from %s...\n", repo)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := installer.InstallFromGitHub(ctx, repo); err != nil {
+	// A bare name is looked up in the skills index.
+	source, err := skillInstallSource(ctx, index, repo)
+	if err != nil {
+		fmt.Printf("\u2717 %v\n", err)
+		os.Exit(1)
+	}
+	if source != repo {
+		fmt.Printf("Resolved '%s' to %s from the skills index\n", repo, source)
+	}
+	repo = source
+	fmt.Printf("Installing skill from %s...\n", repo)
+
+	installed, err := installer.Install(ctx, repo)
+	if err != nil {
+		if len(installed) > 0 {
+			fmt.Printf("  Installed before the failure: %s\n", strings.Join(installed, ", "))
+		}
 		fmt.Printf("\u2717 Failed to install skill: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Printf("\u2713 Skill '%s' installed successfully!\n", filepath.Base(repo))
+	if deps := installed[:len(installed)-1]; len(deps) > 0 {
+		fmt.Printf("  Dependencies installed: %s\n", strings.Join(deps, ", "))
+	}
+}
+
+// skillInstallSource returns what `skills install arg` installs from: arg
+// itself when it is an owner/repo/skill path or a URL, otherwise the source
+// the skills index lists for the skill named arg.
+func skillInstallSource(ctx context.Context, index *skills.SkillIndex, arg string) (string, error) {
+	if strings.Contains(arg, "/") {
+		return arg, nil
+	}
+	return index.Resolve(ctx, arg)
 }
 
 // skillsInstallFromRegistry installs a skill from a named registry (e.g. clawhub).
@@ -259,29 +301,43 @@ func skillsListBuiltinCmd() {
 	}
 }
 
-func skillsSearchCmd(installer *skills.SkillInstaller) {
-	fmt.Println("Searching for available skills...")
-
+func skillsSearchCmd(index *skills.SkillIndex, query string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	availableSkills, err := installer.ListAvailableSkills(ctx)
+	catalog, age, stale, err := index.Load(ctx)
 	if err != nil {
-		fmt.Printf("✗ Failed to fetch skills list: %v\n", err)
+		fmt.Printf("✗ Failed to fetch skills index: %v\n", err)
 		return
 	}
+	if stale {
+		fmt.Printf("⚠ %s is unreachable; using the cached index from %s ago.\n", index.URL(), age.Round(time.Minute))
+	}
 
-	if len(availableSkills) == 0 {
-		fmt.Println("No skills available.")
+	matches := skills.SearchIndex(catalog, query)
+	if len(matches) == 0 {
+		if query != "" {
+			fmt.Printf("No skills match %q.\n", query)
+		} else {
+			fmt.Println("No skills available.")
+		}
 		return
 	}
 
-	fmt.Printf("\nAvailable Skills (%d):\n", len(availableSkills))
+	fmt.Printf("\nAvailable Skills (%d):\n", len(matches))
 	fmt.Println("--------------------")
-	for _, skill := range availableSkills {
-		fmt.Printf("  📦 %s\n", skill.Name)
+	for _, skill := range matches {
+		if skill.Version != "" {
+			fmt.Printf("  📦 %s (v%s)\n", skill.Name, skill.Version)
+		} else {
+			fmt.Printf("  📦 %s\n", skill.Name)
+		}
 		fmt.Printf("     %s\n", skill.Description)
-		fmt.Printf("     Repo: %s\n", skill.Repository)
+		if source := skill.Source; source != "" {
+			fmt.Printf("     Source: %s\n", source)
+		} else {
+			fmt.Printf("     Repo: %s\n", skill.Repository)
+		}
 		if skill.Author != "" {
 			fmt.Printf("     Author: %s\n", skill.Author)
 		}
@@ -290,6 +346,7 @@ func skillsSearchCmd(installer *skills.SkillInstaller) {
 		}
 		fmt.Println()
 	}
+	fmt.Println("Install one with: devopsclaw skills install <name>")
 }
 
 func skillsShowCmd(loader *skills.SkillsLoader, skillName string) {
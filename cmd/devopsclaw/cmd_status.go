@@ -4,10 +4,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/freitascorp/devopsclaw/pkg/auth"
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 )
 
 func statusCmd() {
@@ -100,3 +105,47 @@ func statusCmd() {
 		}
 	}
 }
+
+// costStatusCmd prints today's LLM spend, as recorded in the cost ledger
+// by agent and gateway processes.
+func costStatusCmd(w io.Writer) error {
+	ledger, err := observability.ReadCostLedger(costLedgerPath())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return writeCostReport(w, now, ledger.Day(now), flagJSON)
+}
+
+// writeCostReport renders one day's spend by model, most expensive first.
+func writeCostReport(w io.Writer, date time.Time, day *observability.DailyCost, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(map[string]any{
+			"date":      date.Format(time.DateOnly),
+			"total_usd": day.TotalUSD(),
+			"models":    day.Models,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	if len(day.Models) == 0 {
+		fmt.Fprintf(w, "No LLM usage recorded today (%s)\n", date.Format(time.DateOnly))
+		return nil
+	}
+	fmt.Fprintf(w, "LLM spend today (%s): $%.4f\n\n", date.Format(time.DateOnly), day.TotalUSD())
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tCALLS\tPROMPT\tCOMPLETION\tCOST")
+	for _, model := range day.ModelNames() {
+		u := day.Models[model]
+		cost := fmt.Sprintf("$%.4f", u.CostUSD)
+		if u.Unpriced {
+			cost = "unpriced"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", model, u.Calls, u.PromptTokens, u.CompletionTokens, cost)
+	}
+	return tw.Flush()
+}
@@ -7,24 +7,43 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 
 	"github.com/freitascorp/devopsclaw/pkg/audit"
+	"github.com/freitascorp/devopsclaw/pkg/browser"
 	"github.com/freitascorp/devopsclaw/pkg/config"
 	"github.com/freitascorp/devopsclaw/pkg/deploy"
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
 	"github.com/freitascorp/devopsclaw/pkg/logger"
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/redact"
 	"github.com/freitascorp/devopsclaw/pkg/relay"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 	"github.com/freitascorp/devopsclaw/pkg/runbook"
 	"github.com/freitascorp/devopsclaw/pkg/skills"
 	"github.com/freitascorp/devopsclaw/pkg/tui"
@@ -35,8 +54,11 @@ import (
 // ------------------------------------------------------------------
 
 var (
-	flagDebug  bool
-	flagJSON   bool
+	flagDebug   bool
+	flagJSON    bool
+	flagQuiet   bool
+	flagProfile string
+	flagLogFmt  string
 )
 
 func getConfigDir() string {
@@ -48,24 +70,156 @@ func newAuditStore() *audit.FileStore {
 	return audit.NewFileStore(filepath.Join(getConfigDir(), "audit"))
 }
 
+// newAuditLogger returns the CLI's audit logger, masking secrets as the
+// config's redact section says.
+func newAuditLogger() *audit.Logger {
+	l := audit.NewLogger(newAuditStore(), "cli")
+	cfg, err := loadConfig()
+	if err != nil {
+		return l
+	}
+	r, err := newRedactor(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using the default redaction patterns\n", err)
+		return l
+	}
+	l.SetRedactor(r)
+	return l
+}
+
+// newTracer returns a tracer that exports to the configured OTLP collector,
+// if any. Shut it down before exiting so queued spans are flushed.
+func newTracer(cfg *config.Config) *observability.Tracer {
+	tracer := observability.NewTracer(0, newLogger())
+	if endpoint := cfg.Observability.OTLP.Endpoint; endpoint != "" {
+		tracer.WithOTLPExporter(endpoint, cfg.Observability.OTLP.Headers)
+	}
+	return tracer
+}
+
+// traceCommand runs an audited CLI command inside a span named name, so the
+// audit event it records carries the same trace ID as its exported spans.
+// The returned func ends the span with the command's error and flushes the
+// tracer.
+func traceCommand(ctx context.Context, cfg *config.Config, name string, attrs map[string]string) (context.Context, *observability.Tracer, func(error)) {
+	tracer := newTracer(cfg)
+	ctx, span := tracer.StartSpan(ctx, name, attrs)
+	return ctx, tracer, func(err error) {
+		tracer.EndSpan(span, err)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Shutdown(shutdownCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to flush traces: %v\n", err)
+		}
+	}
+}
+
+// newRedactor builds the redactor described by cfg, or nil when
+// redaction is disabled.
+func newRedactor(cfg config.RedactConfig) (*redact.Redactor, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	var patterns []redact.Pattern
+	if !cfg.ReplaceDefaults {
+		patterns = redact.DefaultPatterns()
+	}
+	extra, err := redact.CompilePatterns(cfg.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	r := redact.New(append(patterns, extra...))
+	r.SkipFields(cfg.SkipFields...)
+	return r, nil
+}
+
+// costLedgerPath is where agent processes record their daily LLM spend
+// for `status --cost`.
+func costLedgerPath() string {
+	return filepath.Join(getConfigDir(), "usage", "llm_costs.json")
+}
+
+// newCostTracker returns a tracker pricing calls with the built-in table
+// plus cfg's llm_prices, recording to the cost ledger.
+func newCostTracker(cfg *config.Config) *observability.CostTracker {
+	prices := observability.DefaultPriceTable()
+	for model, p := range cfg.Observability.LLMPrices {
+		prices[model] = observability.ModelPrice{Prompt: p.Prompt, Completion: p.Completion}
+	}
+	t := observability.NewCostTracker(prices)
+	t.SetLedger(costLedgerPath())
+	return t
+}
+
+// newTaskHistory opens the SQLite task history at cfg's path, or
+// ~/.devopsclaw/task_history.db, with cfg's retention, masking secrets as
+// the config's redact section says.
+func newTaskHistory(cfg *config.Config) (*observability.SQLiteTaskHistory, error) {
+	th := cfg.Observability.TaskHistory
+	path := th.Path
+	if path == "" {
+		path = filepath.Join(getConfigDir(), "task_history.db")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	h, err := observability.NewSQLiteTaskHistory(path, observability.TaskRetention{
+		MaxAge:   time.Duration(th.MaxAgeDays) * 24 * time.Hour,
+		MaxCount: th.MaxRecords,
+	}, newLogger())
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRedactor(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using the default redaction patterns\n", err)
+		return h, nil
+	}
+	h.SetRedactor(r)
+	return h, nil
+}
+
 func newRunbookEngine() *runbook.Engine {
 	return runbook.NewEngine(filepath.Join(getConfigDir(), "runbooks"))
 }
 
+// newLogger builds the structured logger shared by the relay, agent-daemon
+// and fleet stack. Format and level come from pkg/logger, so --log-format,
+// DEVOPSCLAW_LOG_FORMAT and --debug apply to every caller alike.
 func newLogger() *slog.Logger {
-	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	return slog.New(logger.NewHandler(os.Stderr))
 }
 
 // newFleetStack creates the full fleet management stack (store, relay, node manager, executor).
 func newFleetStack(cfg *config.Config, slogger *slog.Logger) (fleet.Store, *fleet.NodeManager, *fleet.Executor, *relay.WSServer) {
-	store := fleet.NewMemoryStore()
+	return newFleetStackWithStore(cfg, fleet.NewMemoryStore(), slogger)
+}
+
+// newFleetStackWithStore creates the fleet stack like newFleetStack, over
+// store.
+func newFleetStackWithStore(cfg *config.Config, store fleet.Store, slogger *slog.Logger) (fleet.Store, *fleet.NodeManager, *fleet.Executor, *relay.WSServer) {
 	nodeMgr := fleet.NewNodeManager(store, slogger)
 
 	relayConfig := relay.ServerConfig{
-		ListenAddr:   cfg.Relay.ListenAddr,
-		AuthToken:    cfg.Relay.AuthToken,
-		MaxNodes:     cfg.Relay.MaxNodes,
-		PingInterval: 15 * time.Second,
+		ListenAddr:      cfg.Relay.ListenAddr,
+		AuthToken:       cfg.Relay.AuthToken,
+		MaxNodes:        cfg.Relay.MaxNodes,
+		PingInterval:    15 * time.Second,
+		AuditCommands:   cfg.Relay.AuditCommands,
+		MaxMessageBytes: cfg.Relay.MaxMessageBytes,
+		Compression:     cfg.Relay.Compression,
+		ExecAPI:         cfg.Relay.ExecAPI,
+		ExecToken:       cfg.Relay.ExecToken,
+		ExecClients:     cfg.Relay.ExecClients,
+		DrainTimeout:    time.Duration(cfg.Relay.DrainTimeoutSec) * time.Second,
+	}
+	for _, acl := range cfg.Relay.ACLs {
+		relayConfig.ACLs = append(relayConfig.ACLs, relay.AgentACL{
+			Token:        acl.Token,
+			CertCN:       acl.CertCN,
+			NodePrefixes: acl.NodePrefixes,
+			CommandTypes: acl.CommandTypes,
+		})
 	}
 	if relayConfig.ListenAddr == "" {
 		relayConfig.ListenAddr = ":9443"
@@ -77,14 +231,69 @@ func newFleetStack(cfg *config.Config, slogger *slog.Logger) (fleet.Store, *flee
 	wsServer := relay.NewWSServer(relayConfig, store, slogger)
 	relayClient := relay.NewWSRelayClient(wsServer, slogger)
 	executor := fleet.NewExecutor(store, relayClient, slogger)
+	if cfg.Fleet.GroupDispatchRate > 0 {
+		executor.SetGroupRateLimits(resilience.NewRateLimiterRegistry(cfg.Fleet.GroupDispatchRate, 1))
+	}
 
 	return store, nodeMgr, executor, wsServer
 }
 
+// openFleetStore opens the configured fleet store backend, which keeps
+// node status, deploy history and deploy locks. Unlike newFleetStack it
+// honors fleet.store; "" and "memory" still give a fresh in-memory store,
+// which shares nothing with other processes, so rollbacks find no history
+// and deploy locks only guard this process. Callers release it with
+// closeFleetStore.
+func openFleetStore(cfg *config.Config, slogger *slog.Logger) (fleet.Store, error) {
+	if cfg.Fleet.Store == "" || cfg.Fleet.Store == "memory" {
+		return fleet.NewMemoryStore(), nil
+	}
+	pg := cfg.Fleet.Postgres
+	store, err := fleet.NewStore(fleet.StoreConfig{
+		Backend:    cfg.Fleet.Store,
+		DataDir:    cfg.Fleet.DataDir,
+		SQLitePath: cfg.Fleet.SQLitePath,
+		Postgres: &fleet.PostgresConfig{
+			Host:     pg.Host,
+			Port:     pg.Port,
+			User:     pg.User,
+			Password: pg.Password,
+			Database: pg.Database,
+			SSLMode:  pg.SSLMode,
+		},
+	}, slogger)
+	if err != nil {
+		return nil, fmt.Errorf("open %s fleet store: %w", cfg.Fleet.Store, err)
+	}
+	return store, nil
+}
+
+// closeFleetStore closes store if its backend holds a connection, as the
+// SQLite and PostgreSQL stores do.
+func closeFleetStore(store fleet.Store) {
+	if c, ok := store.(io.Closer); ok {
+		c.Close()
+	}
+}
+
 // ------------------------------------------------------------------
 // Root command
 // ------------------------------------------------------------------
 
+// setLogFormat applies --log-format, falling back to DEVOPSCLAW_LOG_FORMAT.
+func setLogFormat(cmd *cobra.Command) error {
+	value := os.Getenv(logger.FormatEnvVar)
+	if cmd.Flags().Changed("log-format") {
+		value = flagLogFmt
+	}
+	format, err := logger.ParseFormat(value)
+	if err != nil {
+		return err
+	}
+	logger.SetFormat(format)
+	return nil
+}
+
 func newRootCmd() *cobra.Command {
 	root := &cobra.Command{
 		Use:   "devopsclaw",
@@ -93,10 +302,11 @@ func newRootCmd() *cobra.Command {
 
 It provides multi-machine orchestration, NAT-safe relay connectivity,
 deployment strategies, browser automation, runbooks, and a full audit trail.`,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if flagDebug {
 				logger.SetLevel(logger.DEBUG)
 			}
+			return setLogFormat(cmd)
 		},
 		SilenceUsage:  true,
 		SilenceErrors: true,
@@ -104,6 +314,9 @@ deployment strategies, browser automation, runbooks, and a full audit trail.`,
 
 	root.PersistentFlags().BoolVarP(&flagDebug, "debug", "d", false, "Enable debug logging")
 	root.PersistentFlags().BoolVar(&flagJSON, "json", false, "Output in JSON format")
+	root.PersistentFlags().BoolVarP(&flagQuiet, "quiet", "q", false, "Suppress informational output on stderr")
+	root.PersistentFlags().StringVar(&flagProfile, "profile", "", "Config profile to merge over config.json (env: "+config.ProfileEnvVar+")")
+	root.PersistentFlags().StringVar(&flagLogFmt, "log-format", "", "Log format: text or json (env: "+logger.FormatEnvVar+", default text)")
 
 	// Register all command groups
 	root.AddCommand(
@@ -128,11 +341,49 @@ deployment strategies, browser automation, runbooks, and a full audit trail.`,
 		newAuditCmd(),
 		newRelayCmd(),
 		newAgentDaemonCmd(),
+		newConfigCmd(),
 	)
 
 	return root
 }
 
+// Exit codes for fleet errors, so scripts can tell a bad target from a
+// failed command. Any other error exits 1.
+const (
+	exitNoTargets    = 3 // the target selector matched no online node
+	exitNodeNotFound = 4 // a named node is not registered
+	exitNoTunnel     = 5 // a targeted node is not connected to the relay
+)
+
+// reportError prints err to w, with a hint for the fleet errors a user
+// can act on, and returns the exit code for it.
+func reportError(w io.Writer, err error) int {
+	fmt.Fprintf(w, "Error: %v\n", err)
+	code, hint := 1, ""
+	switch {
+	case errors.Is(err, fleet.ErrNoTargetsMatched):
+		code = exitNoTargets
+		switch {
+		case errors.Is(err, fleet.ErrNodeNotFound):
+			hint = "run 'devopsclaw node list' to see the registered node IDs"
+		case errors.Is(err, fleet.ErrNodeDraining):
+			hint = "draining nodes take no new commands; target other nodes"
+		default:
+			hint = "only online nodes are targeted; check --node, --tag and --env against 'devopsclaw fleet status'"
+		}
+	case errors.Is(err, fleet.ErrNodeNotFound):
+		code = exitNodeNotFound
+		hint = "run 'devopsclaw node list' to see the registered node IDs"
+	case errors.Is(err, fleet.ErrNoTunnel):
+		code = exitNoTunnel
+		hint = "the node agent is not connected to the relay; check it with 'devopsclaw fleet status'"
+	}
+	if hint != "" {
+		fmt.Fprintf(w, "Hint: %s\n", hint)
+	}
+	return code
+}
+
 // ------------------------------------------------------------------
 // Wrapper commands for existing functionality
 // ------------------------------------------------------------------
@@ -171,13 +422,20 @@ func newGatewayCobraCmd() *cobra.Command {
 }
 
 func newStatusCobraCmd() *cobra.Command {
-	return &cobra.Command{
+	var flagCost bool
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show DevOpsClaw system status",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagCost {
+				return costStatusCmd(os.Stdout)
+			}
 			statusCmd()
+			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&flagCost, "cost", false, "Show today's LLM token usage and spend by model")
+	return cmd
 }
 
 func newMigrateCobraCmd() *cobra.Command {
@@ -240,10 +498,20 @@ func newVersionCmd() *cobra.Command {
 
 func newRunCmd() *cobra.Command {
 	var (
-		flagNode   string
-		flagTag    string
-		flagEnv    string
-		flagDryRun bool
+		flagNode    string
+		flagTag     string
+		flagEnv     string
+		flagDryRun  bool
+		flagLabel   bool
+		flagNoLabel bool
+		flagOutput  string
+		flagIdemKey string
+		flagOnce    bool
+		flagSudo    bool
+		flagSudoAs  string
+		flagSort    string
+		flagFailed  bool
+		flagMaxOut  int64
 	)
 
 	cmd := &cobra.Command{
@@ -254,9 +522,22 @@ func newRunCmd() *cobra.Command {
 Examples:
   devopsclaw run "df -h" --node prod-web-1
   devopsclaw run "uptime" --tag role=web --env prod
-  devopsclaw run "nginx -t" --tag role=web --dry-run`,
+  devopsclaw run "nginx -t" --tag role=web --dry-run
+  devopsclaw run "uptime" --tag role=web -o table
+  devopsclaw run "uptime" --tag role=web --failed-only --sort duration
+  devopsclaw run "systemctl restart db" --tag role=db --once
+  devopsclaw run "systemctl restart nginx" --tag role=web --sudo`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := resolveOutputFormat(flagOutput)
+			if err != nil {
+				return err
+			}
+			sortBy, err := parseExecSort(flagSort)
+			if err != nil {
+				return err
+			}
+
 			cfg, err := loadConfig()
 			if err != nil {
 				return err
@@ -266,22 +547,37 @@ Examples:
 			store, _, executor, _ := newFleetStack(cfg, slogger)
 
 			// Build target
-			target := buildTarget(flagNode, flagTag, flagEnv)
+			target, err := buildTarget(flagNode, flagTag, targetEnv(cfg, flagEnv, flagNode), "")
+			if err != nil {
+				return err
+			}
+			announceTarget(context.Background(), store, target)
 
 			// Build request
-			cmdData, _ := json.Marshal(fleet.ShellCommand{Command: strings.Join(args, " ")})
+			command, err := shellExecCommand(args, flagSudo, flagSudoAs)
+			if err != nil {
+				return err
+			}
 			req := &fleet.ExecRequest{
-				ID:        fmt.Sprintf("run_%d", time.Now().UnixNano()),
-				Target:    target,
-				Command:   fleet.TypedCommand{Type: "shell", Data: cmdData},
-				Timeout:   30 * time.Second,
-				DryRun:    flagDryRun,
-				Requester: "cli",
-				CreatedAt: time.Now(),
+				ID:             fmt.Sprintf("run_%d", time.Now().UnixNano()),
+				Target:         target,
+				Command:        command,
+				Timeout:        30 * time.Second,
+				DryRun:         flagDryRun,
+				Requester:      "cli",
+				CreatedAt:      time.Now(),
+				IdempotencyKey: execIdempotencyKey(flagIdemKey, flagOnce, command),
+				MaxOutputBytes: flagMaxOut,
 			}
 
-			result, err := executor.Execute(context.Background(), req)
+			// Ctrl+C cancels the command on every node it is running on.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ctx, tracer, endSpan := traceCommand(ctx, cfg, "cli.run", map[string]string{"request_id": req.ID})
+			executor.SetTracer(tracer)
+			result, err := executor.Execute(ctx, req)
 			if err != nil {
+				endSpan(err)
 				// If no fleet nodes, fallback to listing from store
 				nodes, _ := store.ListNodes(context.Background())
 				if len(nodes) == 0 {
@@ -291,12 +587,11 @@ Examples:
 			}
 
 			// Audit
-			auditStore := newAuditStore()
 			status := "success"
 			if result.Summary.Failed > 0 {
 				status = "partial"
 			}
-			audit.NewLogger(auditStore, "cli").LogFleetExec(context.Background(),
+			newAuditLogger().LogFleetExec(context.WithoutCancel(ctx),
 				strings.Join(args, " "),
 				&audit.EventTarget{Command: strings.Join(args, " ")},
 				&audit.EventResult{
@@ -307,15 +602,27 @@ Examples:
 					Duration:     result.Duration,
 				},
 			)
+			endSpan(nil)
 
-			return printExecResult(result)
+			return writeExecResult(os.Stdout, result, execRenderOptions{
+				Format:     format,
+				Label:      flagLabel && !flagNoLabel,
+				Sort:       sortBy,
+				FailedOnly: flagFailed,
+			})
 		},
 	}
 
 	cmd.Flags().StringVar(&flagNode, "node", "", "Target node(s), comma-separated")
-	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags (e.g., role=web,env=prod)")
+	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags (e.g., role=web,env=prod or 'region in (a,b)')")
 	cmd.Flags().StringVar(&flagEnv, "env", "", "Target by environment shorthand")
 	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Preview without executing")
+	addLabelOutputFlags(cmd, &flagLabel, &flagNoLabel)
+	addOutputFlag(cmd, &flagOutput)
+	addResultFilterFlags(cmd, &flagSort, &flagFailed)
+	addMaxOutputFlag(cmd, &flagMaxOut)
+	addIdempotencyFlags(cmd, &flagIdemKey, &flagOnce)
+	addSudoFlags(cmd, &flagSudo, &flagSudoAs)
 
 	return cmd
 }
@@ -333,6 +640,8 @@ func newFleetCmd() *cobra.Command {
 	cmd.AddCommand(
 		newFleetExecCmd(),
 		newFleetStatusCmd(),
+		newFleetImportCmd(),
+		newFleetMaintainCmd(),
 	)
 
 	return cmd
@@ -350,6 +659,25 @@ func newFleetExecCmd() *cobra.Command {
 		flagDelay      time.Duration
 		flagDryRun     bool
 		flagTimeout    time.Duration
+		flagLabel      bool
+		flagNoLabel    bool
+		flagJSONSchema bool
+		flagDiff       bool
+		flagIdemKey    string
+		flagOnce       bool
+		flagOutput     string
+		flagFile       string
+		flagInterp     string
+		flagSudo       bool
+		flagSudoAs     string
+		flagBatchSize  int
+		flagBatchPct   int
+		flagHalt       bool
+		flagSort       string
+		flagFailed     bool
+		flagMaxOut     int64
+		flagRate       float64
+		flagNodeTO     time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -361,19 +689,81 @@ Examples:
   devopsclaw fleet exec "uptime" --tag role=web
   devopsclaw fleet exec "docker ps" --tag role=api,env=prod
   devopsclaw fleet exec "systemctl restart nginx" --env staging
+  devopsclaw fleet exec "uptime" --tag 'region in (eu-west-1,eu-central-1)' --exclude env=prod
+  devopsclaw fleet exec "df -h" --tag 'region=~eu-.*'
   devopsclaw fleet exec "apt upgrade -y" --serial --delay 5s
-  devopsclaw fleet exec "docker pull myapp:latest" --parallel --max 10`,
-		Args: cobra.MinimumNArgs(1),
+  devopsclaw fleet exec "docker pull myapp:latest" --parallel --max 10
+  devopsclaw fleet exec "apt-get upgrade -y" --tag role=web --batch-percent 10 --halt-on-error
+  devopsclaw fleet exec "apt-get update" --rate 5
+  devopsclaw fleet exec "yum check-update" --node-timeout 30s --timeout 5m
+  devopsclaw fleet exec "tail -n 100 /var/log/app.log" --label-output | grep ERROR
+  devopsclaw fleet exec "uptime" --tag role=web -o wide
+  devopsclaw fleet exec "apt-get update" --failed-only --output table
+  devopsclaw fleet exec "uptime" --sort duration
+  devopsclaw fleet exec "uptime" --output yaml
+  devopsclaw fleet exec --file ./setup.sh --tag role=web
+  devopsclaw fleet exec --file ./migrate.sh --interpreter bash --env staging
+  devopsclaw fleet exec "cat /etc/nginx/nginx.conf" --tag role=web --diff
+  devopsclaw fleet exec --json-schema > exec-result.schema.json
+
+--batch-size and --batch-percent run the matched nodes in batches, in node
+ID order, each batch finishing before the next starts. With
+--halt-on-error, a batch with any node that did not succeed stops the
+run and the remaining nodes are reported as skipped.
+
+--rate starts the command on at most that many nodes per second (default
+fleet.dispatch_rate), so a fleet-wide update does not hit a package
+mirror or database all at once. It paces starts, not completions.
+fleet.group_dispatch_rate further caps starts per node group.
+
+--timeout is the budget for the whole run; nodes not started when it
+expires are reported as timed out without running. --node-timeout stops
+a single slow node after that long, as "timeout", while the others carry
+on.
+
+--file sends a local script to each node, which runs it from a temporary
+file with --interpreter (default /bin/sh) and deletes it afterwards. The
+relay's deny patterns apply to the whole script.
+
+--sort and --failed-only shape the text, table and wide views; the
+summary line still counts every node. json and yaml always list all nodes.
+
+The --json output carries a schema_version (major.minor). Within a major
+version fields are only added; breaking changes bump the major version.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flagJSONSchema || flagFile != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagJSONSchema {
+				_, err := os.Stdout.Write(fleet.ExecResultSchema())
+				return err
+			}
+
+			format, err := resolveOutputFormat(flagOutput)
+			if err != nil {
+				return err
+			}
+			sortBy, err := parseExecSort(flagSort)
+			if err != nil {
+				return err
+			}
+
 			cfg, err := loadConfig()
 			if err != nil {
 				return err
 			}
 
 			slogger := newLogger()
-			_, _, executor, _ := newFleetStack(cfg, slogger)
+			store, _, executor, _ := newFleetStack(cfg, slogger)
 
-			target := buildTarget(flagNode, flagTag, flagEnv)
+			target, err := buildTarget(flagNode, flagTag, targetEnv(cfg, flagEnv, flagNode), flagExclude)
+			if err != nil {
+				return err
+			}
+			announceTarget(context.Background(), store, target)
 			if flagMaxConc > 0 {
 				target.MaxConcurrency = flagMaxConc
 			}
@@ -385,46 +775,186 @@ Examples:
 				flagTimeout = 30 * time.Second
 			}
 
-			cmdData, _ := json.Marshal(fleet.ShellCommand{Command: strings.Join(args, " ")})
+			command, err := fleetExecCommand(args, flagFile, flagInterp, flagSudo, flagSudoAs)
+			if err != nil {
+				return err
+			}
+			batch, err := execBatchPolicy(flagBatchSize, flagBatchPct, flagHalt)
+			if err != nil {
+				return err
+			}
+			rate, err := execDispatchRate(cmd, flagRate, cfg)
+			if err != nil {
+				return err
+			}
 			req := &fleet.ExecRequest{
-				ID:        fmt.Sprintf("fleet_%d", time.Now().UnixNano()),
-				Target:    target,
-				Command:   fleet.TypedCommand{Type: "shell", Data: cmdData},
-				Timeout:   flagTimeout,
-				DryRun:    flagDryRun,
-				Requester: "cli",
-				CreatedAt: time.Now(),
+				ID:             fmt.Sprintf("fleet_%d", time.Now().UnixNano()),
+				Target:         target,
+				Command:        command,
+				Timeout:        flagTimeout,
+				DryRun:         flagDryRun,
+				Requester:      "cli",
+				CreatedAt:      time.Now(),
+				IdempotencyKey: execIdempotencyKey(flagIdemKey, flagOnce, command),
+				Batch:          batch,
+				MaxOutputBytes: flagMaxOut,
+				DispatchRate:   rate,
+				NodeTimeout:    flagNodeTO,
 			}
 
-			result, err := executor.Execute(context.Background(), req)
+			// Ctrl+C cancels the command on every node it is running on;
+			// the nodes that did not finish are reported as cancelled.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			var result *fleet.ExecResult
+			if !format.structured() && term.IsTerminal(int(os.Stdout.Fd())) {
+				result, err = streamExecResult(ctx, executor, req, os.Stdout)
+			} else {
+				result, err = executor.Execute(ctx, req)
+			}
 			if err != nil {
 				return err
 			}
 
-			return printExecResult(result)
+			if flagDiff {
+				return writeOutputDiff(os.Stdout, result, format == OutputJSON)
+			}
+			return writeExecResult(os.Stdout, result, execRenderOptions{
+				Format:     format,
+				Label:      flagLabel && !flagNoLabel,
+				Sort:       sortBy,
+				FailedOnly: flagFailed,
+			})
 		},
 	}
 
 	cmd.Flags().StringVar(&flagNode, "node", "", "Target node(s), comma-separated")
-	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags")
+	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags (key=value, key!=value, key=~regex, 'key in (a,b)')")
 	cmd.Flags().StringVar(&flagEnv, "env", "", "Target by environment")
-	cmd.Flags().StringVar(&flagExclude, "exclude", "", "Exclude nodes matching these tags")
+	cmd.Flags().StringVar(&flagExclude, "exclude", "", "Exclude nodes matching these tags (e.g., env=prod)")
 	cmd.Flags().BoolVar(&flagSerial, "serial", false, "Execute one at a time")
 	cmd.Flags().BoolVar(&flagParallel, "parallel", false, "Execute in parallel (default)")
 	cmd.Flags().IntVar(&flagMaxConc, "max", 0, "Max concurrent executions")
 	cmd.Flags().DurationVar(&flagDelay, "delay", 0, "Delay between serial executions")
 	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Preview without executing")
-	cmd.Flags().DurationVar(&flagTimeout, "timeout", 30*time.Second, "Execution timeout")
+	cmd.Flags().DurationVar(&flagTimeout, "timeout", 30*time.Second, "Timeout for the whole run, across all batches")
+	cmd.Flags().DurationVar(&flagNodeTO, "node-timeout", 0, "Stop a node still running after this long (default: --timeout)")
+	addLabelOutputFlags(cmd, &flagLabel, &flagNoLabel)
+	addOutputFlag(cmd, &flagOutput)
+	addResultFilterFlags(cmd, &flagSort, &flagFailed)
+	addMaxOutputFlag(cmd, &flagMaxOut)
+	cmd.Flags().StringVar(&flagFile, "file", "", "Run this local script on each node instead of a command")
+	cmd.Flags().StringVar(&flagInterp, "interpreter", "", "Interpreter for --file, e.g. bash or /usr/bin/python3 (default /bin/sh)")
+	cmd.Flags().BoolVar(&flagJSONSchema, "json-schema", false, "Print the JSON Schema for --json output and exit")
+	cmd.Flags().BoolVar(&flagDiff, "diff", false, "Group nodes by identical output and diff each variant against the most common one")
+	addIdempotencyFlags(cmd, &flagIdemKey, &flagOnce)
+	addSudoFlags(cmd, &flagSudo, &flagSudoAs)
+	cmd.Flags().IntVar(&flagBatchSize, "batch-size", 0, "Run this many nodes at a time, batch after batch")
+	cmd.Flags().IntVar(&flagBatchPct, "batch-percent", 0, "Run this percentage of the matched nodes at a time (1-100)")
+	cmd.Flags().BoolVar(&flagHalt, "halt-on-error", false, "Stop after a batch in which any node did not succeed")
+	cmd.Flags().Float64Var(&flagRate, "rate", 0, "Start the command on at most this many nodes per second (default: fleet.dispatch_rate, unpaced)")
 
 	return cmd
 }
 
+// execDispatchRate returns the dispatch rate for --rate, or
+// fleet.dispatch_rate when the flag is not given.
+func execDispatchRate(cmd *cobra.Command, rate float64, cfg *config.Config) (float64, error) {
+	if !cmd.Flags().Changed("rate") {
+		rate = cfg.Fleet.DispatchRate
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("--rate must not be negative, got %g", rate)
+	}
+	return rate, nil
+}
+
+// execBatchPolicy builds the batch policy for --batch-size,
+// --batch-percent, and --halt-on-error; nil when not batching.
+func execBatchPolicy(size, percent int, halt bool) (*fleet.BatchPolicy, error) {
+	if size == 0 && percent == 0 {
+		if halt {
+			return nil, fmt.Errorf("--halt-on-error requires --batch-size or --batch-percent")
+		}
+		return nil, nil
+	}
+	policy := &fleet.BatchPolicy{Size: size, Percent: percent, HaltOnError: halt}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid batching: %w", err)
+	}
+	return policy, nil
+}
+
+// addIdempotencyFlags registers --idempotency-key and --once.
+func addIdempotencyFlags(cmd *cobra.Command, key *string, once *bool) {
+	cmd.Flags().StringVar(key, "idempotency-key", "", fmt.Sprintf("Nodes that already ran a request with this key in the last %s return that result instead of running again", fleet.DefaultIdempotencyTTL))
+	cmd.Flags().BoolVar(once, "once", false, "Derive --idempotency-key from the command, so re-running it (e.g. after a timeout) does not run it twice")
+}
+
+// execIdempotencyKey returns the request's idempotency key: the explicit
+// one if given, otherwise one derived from a hash of the command when
+// once is set, otherwise none.
+func execIdempotencyKey(key string, once bool, command fleet.TypedCommand) string {
+	if key != "" || !once {
+		return key
+	}
+	h := sha256.New()
+	h.Write([]byte(command.Type))
+	h.Write([]byte{0})
+	h.Write(command.Data)
+	return "once-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// addSudoFlags registers --sudo and --sudo-user.
+func addSudoFlags(cmd *cobra.Command, sudo *bool, user *string) {
+	cmd.Flags().BoolVar(sudo, "sudo", false, "Run the command with non-interactive sudo on each node (needs passwordless sudo and relay.allow_sudo on the agent)")
+	cmd.Flags().StringVar(user, "sudo-user", "", "User to run the command as with --sudo (default root)")
+}
+
+// shellExecCommand builds a shell command from args, run through sudo as
+// sudoUser when sudo is set.
+func shellExecCommand(args []string, sudo bool, sudoUser string) (fleet.TypedCommand, error) {
+	if sudoUser != "" && !sudo {
+		return fleet.TypedCommand{}, fmt.Errorf("--sudo-user requires --sudo")
+	}
+	data, _ := json.Marshal(fleet.ShellCommand{Command: strings.Join(args, " "), Sudo: sudo, SudoUser: sudoUser})
+	return fleet.TypedCommand{Type: "shell", Data: data}, nil
+}
+
+// fleetExecCommand builds the command fleet exec sends: a shell command
+// from args, or a script read from file.
+func fleetExecCommand(args []string, file, interpreter string, sudo bool, sudoUser string) (fleet.TypedCommand, error) {
+	if file == "" {
+		if interpreter != "" {
+			return fleet.TypedCommand{}, fmt.Errorf("--interpreter requires --file")
+		}
+		return shellExecCommand(args, sudo, sudoUser)
+	}
+	if sudo {
+		return fleet.TypedCommand{}, fmt.Errorf("--sudo cannot be used with --file")
+	}
+
+	script, err := os.ReadFile(file)
+	if err != nil {
+		return fleet.TypedCommand{}, fmt.Errorf("read script: %w", err)
+	}
+	if len(script) == 0 {
+		return fleet.TypedCommand{}, fmt.Errorf("script %s is empty", file)
+	}
+	return fleet.NewScriptCommand(script, interpreter)
+}
+
 func newFleetStatusCmd() *cobra.Command {
-	var flagLive bool
+	var (
+		flagLive    bool
+		flagGroupBy string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show fleet status dashboard",
+		Example: `  devopsclaw fleet status
+  devopsclaw fleet status --group-by env`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
 			if err != nil {
@@ -439,6 +969,21 @@ func newFleetStatusCmd() *cobra.Command {
 				return tui.RunFleetDashboard(store, nodeMgr)
 			}
 
+			if flagGroupBy != "" {
+				groups, err := nodeMgr.SummaryBy(context.Background(), flagGroupBy)
+				if err != nil {
+					return err
+				}
+				if flagJSON {
+					data, _ := json.MarshalIndent(groups, "", "  ")
+					fmt.Println(string(data))
+					return nil
+				}
+				nodes, _ := store.ListNodes(context.Background())
+				writeFleetStatusGrouped(os.Stdout, flagGroupBy, groups, nodes)
+				return nil
+			}
+
 			summary, err := nodeMgr.Summary(context.Background())
 			if err != nil {
 				return err
@@ -458,10 +1003,189 @@ func newFleetStatusCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&flagLive, "live", false, "Live TUI dashboard with auto-refresh")
+	cmd.Flags().StringVar(&flagGroupBy, "group-by", "", "Break the status down by the value of this label, e.g. env")
+
+	return cmd
+}
+
+func newFleetImportCmd() *cobra.Command {
+	var flagAbortOnError bool
+
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Bulk-register nodes from a YAML or JSON file",
+		Long: `Register many nodes at once from a YAML or JSON file — a list of nodes,
+or an object with a "nodes" list. Each entry takes id, hostname, address,
+labels, groups, and capabilities.
+
+Transient store errors are retried with backoff. A node that still fails is
+reported and the import carries on; nodes already registered are skipped, so
+re-running the same file after a partial failure picks up where it left off.
+The command exits non-zero if any node failed.
+
+Examples:
+  devopsclaw fleet import nodes.yaml
+  devopsclaw fleet import nodes.json --abort-on-error
+  devopsclaw fleet import nodes.yaml --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			records, err := fleet.ParseImportFile(data)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			slogger := newLogger()
+			_, nodeMgr, _, _ := newFleetStack(cfg, slogger)
+
+			report, err := nodeMgr.Import(context.Background(), records, fleet.ImportOptions{
+				AbortOnError: flagAbortOnError,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := writeImportReport(os.Stdout, report, flagJSON); err != nil {
+				return err
+			}
+			if n := len(report.Failed); n > 0 {
+				return fmt.Errorf("%d node(s) failed to import", n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&flagAbortOnError, "abort-on-error", false, "Stop at the first node that fails to import")
+
+	return cmd
+}
+
+func newFleetMaintainCmd() *cobra.Command {
+	var flagRetain string
+
+	cmd := &cobra.Command{
+		Use:   "maintain",
+		Short: "Prune old execution history and compact the SQLite fleet store",
+		Long: `Delete executions older than the retention window, VACUUM the database,
+and checkpoint its WAL, so a long-running single-node deployment's
+fleet.db stops growing. Only applies to the sqlite fleet store.
+
+--retain takes days (30d) or a duration (72h); 0 keeps all executions and
+only compacts. The default is fleet.execution_retention_days, or 30 days.
+
+Examples:
+  devopsclaw fleet maintain
+  devopsclaw fleet maintain --retain 7d
+  devopsclaw fleet maintain --retain 90d --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			retain, err := maintainRetention(flagRetain, cfg)
+			if err != nil {
+				return err
+			}
+			if cfg.Fleet.Store != "sqlite" {
+				return fmt.Errorf("fleet maintain only applies to the sqlite store (fleet.store is %q)", cfg.Fleet.Store)
+			}
+
+			store, err := fleet.NewStore(fleet.StoreConfig{
+				Backend:    cfg.Fleet.Store,
+				DataDir:    cfg.Fleet.DataDir,
+				SQLitePath: cfg.Fleet.SQLitePath,
+			}, newLogger())
+			if err != nil {
+				return err
+			}
+			sqlite := store.(*fleet.SQLiteStore)
+			defer sqlite.Close()
+
+			sqlite.SetRetention(retain)
+			report, err := sqlite.Maintain(context.Background())
+			if err != nil {
+				return err
+			}
+			return writeMaintenanceReport(os.Stdout, report, flagJSON)
+		},
+	}
+
+	cmd.Flags().StringVar(&flagRetain, "retain", "", "Keep executions from this far back, e.g. 30d or 72h; 0 keeps all (default: fleet.execution_retention_days, 30d)")
 
 	return cmd
 }
 
+// maintainRetention returns the execution retention for fleet maintain:
+// --retain if given, otherwise fleet.execution_retention_days, otherwise
+// fleet.DefaultExecutionRetention.
+func maintainRetention(flag string, cfg *config.Config) (time.Duration, error) {
+	if flag == "" {
+		if days := cfg.Fleet.ExecutionRetentionDays; days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+		return fleet.DefaultExecutionRetention, nil
+	}
+	if days, ok := strings.CutSuffix(flag, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --retain %q: want days like 30d or a duration like 72h", flag)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if flag == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(flag)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --retain %q: want days like 30d or a duration like 72h", flag)
+	}
+	return d, nil
+}
+
+// writeMaintenanceReport prints what fleet maintain did.
+func writeMaintenanceReport(w io.Writer, report *fleet.MaintenanceReport, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	if report.Cutoff.IsZero() {
+		fmt.Fprintln(w, "Kept all executions (no retention)")
+	} else {
+		fmt.Fprintf(w, "Deleted %d execution(s) recorded before %s\n",
+			report.DeletedExecutions, report.Cutoff.Local().Format("2006-01-02 15:04"))
+	}
+	_, err := fmt.Fprintf(w, "Database: %s → %s\n", formatBytes(report.SizeBefore), formatBytes(report.SizeAfter))
+	return err
+}
+
+// formatBytes renders n bytes in binary units, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // ------------------------------------------------------------------
 // `devopsclaw deploy` — Deployment management
 // ------------------------------------------------------------------
@@ -473,10 +1197,20 @@ func newDeployCmd() *cobra.Command {
 		flagEnv            string
 		flagNode           string
 		flagHealthURL      string
+		flagHealthMode     string
 		flagRollbackOnFail bool
 		flagMaxUnavailable int
 		flagDryRun         bool
 		flagRollbackCmd    string
+		flagPreCheckCmd    string
+		flagMaxNodes       int
+		flagForce          bool
+		flagNotifyURL      string
+		flagCanarySamples  int
+		flagCanaryInterval time.Duration
+		flagCanaryMinOK    float64
+		flagSwitchCmd      string
+		flagSwitchTarget   string
 	)
 
 	cmd := &cobra.Command{
@@ -487,7 +1221,13 @@ func newDeployCmd() *cobra.Command {
 Examples:
   devopsclaw deploy myapp:v2.1.3 "docker pull && docker restart" --strategy rolling --env prod
   devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --strategy canary --rollback-on-fail
-  devopsclaw deploy myapp:v2.1.3 "helm upgrade" --strategy blue-green --health-check /health`,
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --strategy canary --health-check http://localhost:8080/health --canary-samples 12 --canary-interval 10s --rollback-on-fail --rollback-cmd ./rollback.sh
+  devopsclaw deploy myapp:v2.1.3 "helm upgrade" --strategy blue-green --health-check /health
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --strategy blue-green --health-check /health --switch-cmd ./switch-lb.sh --switch-target role=lb --rollback-on-fail --rollback-cmd ./rollback.sh
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --health-check 'http://{node.host}:8080/health' --health-mode control-plane
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --precheck-cmd 'docker manifest inspect myapp:$DEPLOY_VERSION'
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --env prod --max-nodes 50 --force
+  devopsclaw deploy myapp:v2.1.3 "./deploy.sh" --rollback-on-fail --notify-url https://hooks.slack.com/services/...`,
 		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
@@ -496,7 +1236,12 @@ Examples:
 			}
 
 			slogger := newLogger()
-			store, _, executor, _ := newFleetStack(cfg, slogger)
+			store, err := openFleetStore(cfg, slogger)
+			if err != nil {
+				return err
+			}
+			defer closeFleetStore(store)
+			_, _, executor, _ := newFleetStackWithStore(cfg, store, slogger)
 
 			// Parse service:version
 			parts := strings.SplitN(args[0], ":", 2)
@@ -507,7 +1252,15 @@ Examples:
 			}
 
 			deployCommand := strings.Join(args[1:], " ")
-			target := buildTarget(flagNode, flagTag, flagEnv)
+			target, err := buildTarget(flagNode, flagTag, targetEnv(cfg, flagEnv, flagNode), "")
+			if err != nil {
+				return err
+			}
+			announceTarget(context.Background(), store, target)
+			switchTarget, err := deploySwitchTarget(flagSwitchTarget)
+			if err != nil {
+				return err
+			}
 
 			spec := deploy.Spec{
 				Service:        service,
@@ -515,32 +1268,79 @@ Examples:
 				Strategy:       deploy.Strategy(flagStrategy),
 				Target:         target,
 				HealthCheckURL: flagHealthURL,
+				HealthCheckMode: deploy.HealthMode(flagHealthMode),
 				RollbackOnFail: flagRollbackOnFail,
 				MaxUnavailable: flagMaxUnavailable,
 				DeployCommand:  deployCommand,
 				RollbackCommand: flagRollbackCmd,
+				PreCheckCommand: flagPreCheckCmd,
 				Requester:      "cli",
+				MaxNodesPerDeploy: cfg.Fleet.MaxNodesPerDeploy,
+				ForceOverCap:      flagForce,
+				CanaryAnalysis: deploy.CanaryAnalysis{
+					Samples:         flagCanarySamples,
+					Interval:        flagCanaryInterval,
+					MinSuccessRatio: flagCanaryMinOK,
+				},
+				SwitchCommand: flagSwitchCmd,
+				SwitchTarget:  switchTarget,
+			}
+			if cmd.Flags().Changed("max-nodes") {
+				spec.MaxNodesPerDeploy = flagMaxNodes
 			}
 
 			deployer := deploy.NewDeployer(executor, store, slogger)
-			result, err := deployer.Deploy(context.Background(), spec)
-
-			if flagJSON {
-				data, _ := json.MarshalIndent(result, "", "  ")
-				fmt.Println(string(data))
-				if err != nil {
-					return err
+			deployer.SetAuditLogger(newAuditLogger())
+			notifyURL := cfg.Deploy.WebhookURL
+			if cmd.Flags().Changed("notify-url") {
+				notifyURL = flagNotifyURL
+			}
+			if notifyURL != "" {
+				deployer.SetNotifier(deploy.NewWebhookNotifier(notifyURL, slogger))
+			}
+			if flagDryRun {
+				plan, err := deployer.Plan(context.Background(), spec)
+				if err != nil {
+					return err
 				}
-				return nil
+				return printDeployPlan(plan)
+			}
+			ctx, tracer, endSpan := traceCommand(context.Background(), cfg, "cli.deploy", map[string]string{
+				"service": service,
+				"version": version,
+			})
+			executor.SetTracer(tracer)
+			result, err := deployer.Deploy(ctx, spec)
+			endSpan(err)
+
+			if flagJSON {
+				// A deploy rejected up front, e.g. with another one in
+				// progress, has no result; report only the error.
+				if result != nil {
+					data, _ := json.MarshalIndent(result, "", "  ")
+					fmt.Println(string(data))
+				}
+				return err
 			}
 
 			if result != nil {
 				fmt.Printf("Deploy %s:%s — %s (%s)\n", service, version, result.State, result.Duration.Round(time.Millisecond))
+				fmt.Printf("  ID:        %s\n", result.ID)
 				fmt.Printf("  Strategy:  %s\n", flagStrategy)
 				fmt.Printf("  Batches:   %d\n", len(result.Batches))
+				if sw := result.Switch; sw != nil {
+					status := "ok"
+					if !sw.OK {
+						status = "FAILED"
+					}
+					fmt.Printf("  Switch:    %s on %d node(s)\n", status, len(sw.Nodes))
+				}
 				if result.RolledBack {
 					fmt.Println("  ⚠ ROLLED BACK")
 				}
+				if result.CapOverride {
+					fmt.Printf("  ⚠ Node cap of %d overridden with --force\n", spec.MaxNodesPerDeploy)
+				}
 			}
 
 			return err
@@ -548,27 +1348,320 @@ Examples:
 	}
 
 	cmd.Flags().StringVar(&flagStrategy, "strategy", "rolling", "Deployment strategy: rolling, canary, blue-green, all-at-once, serial")
-	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags")
+	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags (key=value, key!=value, key=~regex, 'key in (a,b)')")
 	cmd.Flags().StringVar(&flagEnv, "env", "", "Target by environment")
 	cmd.Flags().StringVar(&flagNode, "node", "", "Target specific nodes")
 	cmd.Flags().StringVar(&flagHealthURL, "health-check", "", "Health check URL (e.g., /health)")
+	cmd.Flags().StringVar(&flagHealthMode, "health-mode", "node", "Where --health-check runs: node (curl on each node) or control-plane (GET from here; the URL may use {node.address}, {node.host}, {node.hostname}, {node.id})")
 	cmd.Flags().BoolVar(&flagRollbackOnFail, "rollback-on-fail", false, "Automatically rollback on failure")
 	cmd.Flags().IntVar(&flagMaxUnavailable, "max-unavailable", 1, "Max nodes unavailable during rolling deploy")
-	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Preview without executing")
+	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Print the deploy plan without executing (see 'deploy plan')")
 	cmd.Flags().StringVar(&flagRollbackCmd, "rollback-cmd", "", "Command to run for rollback")
+	cmd.Flags().StringVar(&flagPreCheckCmd, "precheck-cmd", "", "Command run once on one node before rollout (e.g., docker manifest inspect myapp:$DEPLOY_VERSION)")
+	cmd.Flags().IntVar(&flagMaxNodes, "max-nodes", 0, "Refuse to deploy to more than this many nodes (0 = no cap; default from fleet.max_nodes_per_deploy)")
+	cmd.Flags().BoolVar(&flagForce, "force", false, "Deploy even if the target exceeds the node cap (the override is audited)")
+	cmd.Flags().StringVar(&flagNotifyURL, "notify-url", "", "Webhook to POST a JSON summary to on rollback or failure (default from deploy.webhook_url)")
+	cmd.Flags().IntVar(&flagCanarySamples, "canary-samples", 0, "Probe --health-check this many times after each canary batch and abort below --canary-min-success (0 = single check)")
+	cmd.Flags().DurationVar(&flagCanaryInterval, "canary-interval", deploy.DefaultCanaryInterval, "Wait between canary analysis samples")
+	cmd.Flags().Float64Var(&flagCanaryMinOK, "canary-min-success", deploy.DefaultCanaryMinSuccess, "Fraction of canary probes that must succeed (0-1)")
+	cmd.Flags().StringVar(&flagSwitchCmd, "switch-cmd", "", "Blue-green: command that moves traffic to the new version once every node is healthy (a failed switch fails the deploy)")
+	cmd.Flags().StringVar(&flagSwitchTarget, "switch-target", "", "Nodes to run --switch-cmd on: node IDs (lb-1,lb-2) or a label selector (role=lb); default the deployed nodes")
+
+	cmd.AddCommand(newDeployPlanCmd(), newDeployRollbackCmd(), newDeployRollbackAllCmd())
+
+	return cmd
+}
+
+func newDeployPlanCmd() *cobra.Command {
+	var (
+		flagStrategy       string
+		flagTag            string
+		flagEnv            string
+		flagNode           string
+		flagMaxUnavailable int
+		flagCanaryPercent  []int
+		flagMaxNodes       int
+		flagForce          bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "plan <service:version>",
+		Short: "Preview a deployment's batches without executing it",
+		Long: `Resolve the target nodes and print the batches the chosen strategy would
+deploy them in. Nothing runs on any node and nothing is recorded.
+
+Examples:
+  devopsclaw deploy plan myapp:v2.1.3 --strategy rolling --max-unavailable 2 --env prod
+  devopsclaw deploy plan myapp:v2.1.3 --strategy canary --canary-percent 5,25,100 --tag role=web`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			slogger := newLogger()
+			store, _, executor, _ := newFleetStack(cfg, slogger)
+
+			service, version, _ := strings.Cut(args[0], ":")
+			if version == "" {
+				version = "latest"
+			}
+			target, err := buildTarget(flagNode, flagTag, targetEnv(cfg, flagEnv, flagNode), "")
+			if err != nil {
+				return err
+			}
+
+			spec := deploy.Spec{
+				Service:           service,
+				Version:           version,
+				Strategy:          deploy.Strategy(flagStrategy),
+				Target:            target,
+				MaxUnavailable:    flagMaxUnavailable,
+				CanaryPercent:     flagCanaryPercent,
+				MaxNodesPerDeploy: cfg.Fleet.MaxNodesPerDeploy,
+				ForceOverCap:      flagForce,
+			}
+			if cmd.Flags().Changed("max-nodes") {
+				spec.MaxNodesPerDeploy = flagMaxNodes
+			}
+
+			plan, err := deploy.NewDeployer(executor, store, slogger).Plan(context.Background(), spec)
+			if err != nil {
+				return err
+			}
+			return printDeployPlan(plan)
+		},
+	}
+
+	cmd.Flags().StringVar(&flagStrategy, "strategy", "rolling", "Deployment strategy: rolling, canary, blue-green, all-at-once, serial")
+	cmd.Flags().StringVar(&flagTag, "tag", "", "Target by label tags (key=value, key!=value, key=~regex, 'key in (a,b)')")
+	cmd.Flags().StringVar(&flagEnv, "env", "", "Target by environment")
+	cmd.Flags().StringVar(&flagNode, "node", "", "Target specific nodes")
+	cmd.Flags().IntVar(&flagMaxUnavailable, "max-unavailable", 1, "Max nodes unavailable during rolling deploy")
+	cmd.Flags().IntSliceVar(&flagCanaryPercent, "canary-percent", nil, "Cumulative canary percentages (default 5,25,100)")
+	cmd.Flags().IntVar(&flagMaxNodes, "max-nodes", 0, "Node cap to check the target against (0 = no cap; default from fleet.max_nodes_per_deploy)")
+	cmd.Flags().BoolVar(&flagForce, "force", false, "Plan even if the target exceeds the node cap")
+
+	return cmd
+}
+
+// printDeployPlan writes a deploy plan as JSON or as one line per batch.
+func printDeployPlan(plan *deploy.DeployPlan) error {
+	if flagJSON {
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	writeDeployPlan(os.Stdout, plan)
+	return nil
+}
+
+func writeDeployPlan(w io.Writer, plan *deploy.DeployPlan) {
+	fmt.Fprintf(w, "Plan %s:%s — %s across %d node(s)\n", plan.Service, plan.Version, plan.Summary(), plan.Nodes)
+	if plan.CapOverride {
+		fmt.Fprintln(w, "  ⚠ Target exceeds the node cap (overridden with --force)")
+	}
+	for _, b := range plan.Batches {
+		ids := make([]string, len(b.Nodes))
+		for i, id := range b.Nodes {
+			ids[i] = string(id)
+		}
+		step := fmt.Sprintf("Batch %d", b.Index+1)
+		if b.Percent > 0 {
+			step += fmt.Sprintf(" (%d%%)", b.Percent)
+		}
+		fmt.Fprintf(w, "  %-16s %d node(s): %s\n", step+":", len(b.Nodes), strings.Join(ids, ", "))
+	}
+}
+
+func newDeployRollbackCmd() *cobra.Command {
+	var flagYes bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback <deploy-id>",
+		Short: "Run a recorded deployment's rollback command",
+		Long: `Replay the --rollback-cmd of a finished deployment. The deploy is loaded
+from the fleet store's execution history, its target selector is resolved
+again against the current roster, and the rollback is recorded as a new
+execution that points back at the original deploy.
+
+Examples:
+  devopsclaw deploy rollback deploy_1718031234567890123
+  devopsclaw deploy rollback deploy_1718031234567890123 --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			slogger := newLogger()
+			store, err := openFleetStore(cfg, slogger)
+			if err != nil {
+				return err
+			}
+			defer closeFleetStore(store)
+			_, _, executor, _ := newFleetStackWithStore(cfg, store, slogger)
+			deployer := deploy.NewDeployer(executor, store, slogger)
+			deployer.SetAuditLogger(newAuditLogger())
+
+			if !flagYes && !confirm(os.Stdin, os.Stderr, fmt.Sprintf("Roll back %s?", args[0])) {
+				return fmt.Errorf("rollback cancelled")
+			}
+
+			ctx, tracer, endSpan := traceCommand(context.Background(), cfg, "cli.deploy.rollback", map[string]string{"deploy_id": args[0]})
+			executor.SetTracer(tracer)
+			result, err := deployer.RollbackByID(ctx, args[0])
+			endSpan(err)
+			if flagJSON {
+				if result != nil {
+					data, _ := json.MarshalIndent(result, "", "  ")
+					fmt.Println(string(data))
+				}
+				return err
+			}
+			if result != nil {
+				fmt.Printf("Rollback %s:%s (%s) — %s (%s)\n", result.Spec.Service, result.Spec.Version,
+					result.RollbackOf, result.State, result.Duration.Round(time.Millisecond))
+				fmt.Printf("  Recorded as %s\n", result.ID)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "Skip the confirmation prompt")
+
+	return cmd
+}
+
+func newDeployRollbackAllCmd() *cobra.Command {
+	var (
+		flagEnvs     string
+		flagParallel bool
+		flagYes      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rollback-all <service>",
+		Short: "Roll back a service in every environment it was recently deployed to",
+		Long: `Emergency rollback across environments. For each environment the service
+was deployed to, the most recent successful deploy is found in the deploy
+history and its --rollback-cmd is run against the same target. Environments
+are rolled back one at a time unless --parallel is given. Every rollback is
+recorded in the audit log.
+
+Deploy history is kept in the fleet store; configure a durable backend
+(fleet.store = sqlite or postgres) for it to survive between runs.
+
+Examples:
+  devopsclaw deploy rollback-all myapp
+  devopsclaw deploy rollback-all myapp --env prod,staging
+  devopsclaw deploy rollback-all myapp --yes --parallel`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			slogger := newLogger()
+			store, err := openFleetStore(cfg, slogger)
+			if err != nil {
+				return err
+			}
+			defer closeFleetStore(store)
+			_, _, executor, _ := newFleetStackWithStore(cfg, store, slogger)
+			deployer := deploy.NewDeployer(executor, store, slogger)
+			deployer.SetAuditLogger(newAuditLogger())
+
+			var envs []string
+			for _, env := range strings.Split(flagEnvs, ",") {
+				if env = strings.TrimSpace(env); env != "" {
+					envs = append(envs, env)
+				}
+			}
+
+			ctx := context.Background()
+			plan, err := deployer.RollbackTargets(ctx, args[0], envs)
+			if err != nil {
+				return err
+			}
+			if len(plan) == 0 {
+				return fmt.Errorf("no successful deploys of %s found in history", args[0])
+			}
+
+			writeRollbackPlan(os.Stderr, plan)
+			if !flagYes && !confirm(os.Stdin, os.Stderr, fmt.Sprintf("Roll back %s in %d environment(s)?", args[0], len(plan))) {
+				return fmt.Errorf("rollback cancelled")
+			}
+
+			traceCtx, tracer, endSpan := traceCommand(ctx, cfg, "cli.deploy.rollback_all", map[string]string{"service": args[0]})
+			executor.SetTracer(tracer)
+			results, err := deployer.RollbackAll(traceCtx, plan, flagParallel)
+			endSpan(err)
+			if flagJSON {
+				data, _ := json.MarshalIndent(results, "", "  ")
+				fmt.Println(string(data))
+				return err
+			}
+			for i, r := range results {
+				env := deploy.EnvName(plan[i].Spec.Environment())
+				if r == nil {
+					fmt.Printf("  ✗ %-12s skipped\n", env)
+					continue
+				}
+				icon := "✓"
+				if r.State != deploy.StateComplete {
+					icon = "✗"
+				}
+				fmt.Printf("  %s %-12s %s — %s (%s)\n", icon, env, plan[i].Spec.Version, r.State, r.Duration.Round(time.Millisecond))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&flagEnvs, "env", "", "Only roll back these environments, comma-separated (default: all)")
+	cmd.Flags().BoolVar(&flagParallel, "parallel", false, "Roll back all environments at once instead of one at a time")
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "Skip the confirmation prompt")
 
 	return cmd
 }
 
+// writeRollbackPlan lists the deploy each environment will be rolled back
+// from, so the operator can check it before confirming.
+func writeRollbackPlan(w io.Writer, plan []*deploy.Result) {
+	fmt.Fprintln(w, "Rolling back:")
+	for _, r := range plan {
+		fmt.Fprintf(w, "  %-12s %s:%s  deployed %s  (%s)\n",
+			deploy.EnvName(r.Spec.Environment()), r.Spec.Service, r.Spec.Version,
+			r.StartedAt.Format(time.RFC3339), r.ID)
+		if r.Spec.RollbackCommand == "" {
+			fmt.Fprintln(w, "               ⚠ no rollback command recorded; this environment will fail")
+		}
+	}
+}
+
+// confirm asks a yes/no question and reports whether the answer was yes.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s (y/n): ", question)
+	var response string
+	fmt.Fscanln(in, &response)
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
 // ------------------------------------------------------------------
 // `devopsclaw browse` — Browser automation
 // ------------------------------------------------------------------
 
 func newBrowseCmd() *cobra.Command {
 	var (
-		flagURL     string
-		flagTask    string
-		flagSession string
+		flagURL         string
+		flagTask        string
+		flagSession     string
+		flagCookiesFrom string
+		flagProxy       string
 	)
 
 	cmd := &cobra.Command{
@@ -579,7 +1672,13 @@ func newBrowseCmd() *cobra.Command {
 Examples:
   devopsclaw browse --url https://console.aws.amazon.com --task "check RDS storage"
   devopsclaw browse --url https://app.datadoghq.com --task "get P95 latency for last 1h"
-  devopsclaw browse --session datadog-prod --task "get alert count"`,
+  devopsclaw browse --session datadog-prod --task "get alert count"
+  devopsclaw browse --url https://grafana.internal --cookies-from curl.txt --task "read error rate"
+  devopsclaw browse --url https://grafana.internal --proxy http://proxy.corp:3128 --task "read error rate"
+
+--cookies-from accepts a "Copy as cURL" command, a Cookie header, a Netscape
+cookies.txt, or a HAR export, so an already-authenticated session can be
+reused instead of scripting a login.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if flagURL == "" && flagSession == "" {
 				return fmt.Errorf("either --url or --session is required")
@@ -600,6 +1699,19 @@ Examples:
 				return err
 			}
 
+			if flagCookiesFrom != "" {
+				n, err := setBrowseCookies(cfg, flagCookiesFrom, flagURL)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("  Cookies: %d from %s\n", n, flagCookiesFrom)
+			}
+
+			if flagProxy != "" {
+				fmt.Printf("  Proxy: %s\n", flagProxy)
+				cfg.Browser.ProxyServer = flagProxy
+			}
+
 			prompt := fmt.Sprintf("Use the browser tool to go to %s and %s", flagURL, flagTask)
 			if flagSession != "" {
 				prompt = fmt.Sprintf("Use browser session %s to %s", flagSession, flagTask)
@@ -612,6 +1724,8 @@ Examples:
 	cmd.Flags().StringVar(&flagURL, "url", "", "URL to navigate to")
 	cmd.Flags().StringVar(&flagTask, "task", "", "Natural language task to perform")
 	cmd.Flags().StringVar(&flagSession, "session", "", "Saved browser session name")
+	cmd.Flags().StringVar(&flagCookiesFrom, "cookies-from", "", "Seed the session with cookies from a curl command, Cookie header, cookies.txt, or HAR file")
+	cmd.Flags().StringVar(&flagProxy, "proxy", "", "Route browser traffic through this proxy, e.g. http://proxy.corp:3128 (default from browser.proxy_server)")
 
 	return cmd
 }
@@ -631,6 +1745,8 @@ func newNodeCmd() *cobra.Command {
 		newNodeListCmd(),
 		newNodeRemoveCmd(),
 		newNodeDrainCmd(),
+		newNodeExportCmd(),
+		newNodeImportCmd(),
 	)
 
 	return cmd
@@ -638,10 +1754,13 @@ func newNodeCmd() *cobra.Command {
 
 func newNodeRegisterCmd() *cobra.Command {
 	var (
-		flagName    string
-		flagAddress string
-		flagTags    string
-		flagGroups  string
+		flagName      string
+		flagAddress   string
+		flagTags      string
+		flagGroups    string
+		flagFromRelay string
+		flagRelay     string
+		flagToken     string
 	)
 
 	cmd := &cobra.Command{
@@ -650,10 +1769,26 @@ func newNodeRegisterCmd() *cobra.Command {
 		Long: `Register a node with the fleet. Provide --address for direct SSH/IP connectivity,
 or use the relay agent (devopsclaw agent-daemon) for NAT-safe auto-registration.
 
+With --from-relay, the address, hostname, OS/arch, and capabilities are taken
+from the agent's live tunnel on a running relay; --name, --address, --tags and
+--groups are merged on top.
+
 Examples:
   devopsclaw node register --name prod-web-1 --address 10.0.1.50 --tags env=prod,role=web,region=eu-west-1
   devopsclaw node register --name prod-web-2 --address prod-web-2.internal:22 --tags env=prod,role=web
-  devopsclaw node register --name staging-api --address 192.168.1.100 --tags env=staging,role=api --groups staging`,
+  devopsclaw node register --name staging-api --address 192.168.1.100 --tags env=staging,role=api --groups staging
+  devopsclaw node register --from-relay prod-web-3 --tags env=prod,role=web`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flagName == "" && flagFromRelay == "" {
+				return fmt.Errorf("--name is required (or use --from-relay <node-id>)")
+			}
+			// The relay routes commands by node ID, so a relay-backed node
+			// can't be registered under a different name.
+			if flagName != "" && flagFromRelay != "" && flagName != flagFromRelay {
+				return fmt.Errorf("--name %q must match the --from-relay node ID %q", flagName, flagFromRelay)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
 			if err != nil {
@@ -663,19 +1798,41 @@ Examples:
 			slogger := newLogger()
 			_, nodeMgr, _, _ := newFleetStack(cfg, slogger)
 
-			node := &fleet.Node{
-				ID:           fleet.NodeID(flagName),
-				Hostname:     flagName,
-				Address:      flagAddress,
-				Status:       fleet.NodeStatusOnline,
-				Labels:       parseTags(flagTags),
-				RegisteredAt: time.Now(),
-				LastSeen:     time.Now(),
-			}
-
+			var groups []fleet.GroupName
 			if flagGroups != "" {
 				for _, g := range strings.Split(flagGroups, ",") {
-					node.Groups = append(node.Groups, fleet.GroupName(strings.TrimSpace(g)))
+					groups = append(groups, fleet.GroupName(strings.TrimSpace(g)))
+				}
+			}
+
+			var node *fleet.Node
+			if flagFromRelay != "" {
+				baseURL := flagRelay
+				if baseURL == "" {
+					baseURL = relayHTTPURL(cfg.Relay.ListenAddr)
+				}
+				token := flagToken
+				if token == "" {
+					token = cfg.Relay.AuthToken
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				info, err := fetchRelayTunnel(ctx, baseURL, token, flagFromRelay)
+				if err != nil {
+					return fmt.Errorf("look up %s on relay: %w", flagFromRelay, err)
+				}
+				node = nodeFromTunnel(*info, flagAddress, parseTags(flagTags), groups)
+			} else {
+				node = &fleet.Node{
+					ID:           fleet.NodeID(flagName),
+					Hostname:     flagName,
+					Address:      flagAddress,
+					Status:       fleet.NodeStatusOnline,
+					Labels:       parseTags(flagTags),
+					Groups:       groups,
+					RegisteredAt: time.Now(),
+					LastSeen:     time.Now(),
 				}
 			}
 
@@ -683,24 +1840,69 @@ Examples:
 				return err
 			}
 
-			if flagAddress != "" {
-				fmt.Printf("✓ Node %s registered (%s)\n", flagName, flagAddress)
-			} else {
-				fmt.Printf("✓ Node %s registered (no address — will connect via relay)\n", flagName)
+			switch {
+			case flagFromRelay != "":
+				fmt.Printf("✓ Node %s registered from relay (%s, %s/%s)\n", node.ID, node.Address, node.Resources.OS, node.Resources.Arch)
+			case node.Address != "":
+				fmt.Printf("✓ Node %s registered (%s)\n", node.ID, node.Address)
+			default:
+				fmt.Printf("✓ Node %s registered (no address — will connect via relay)\n", node.ID)
 			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&flagName, "name", "", "Node name/ID (required)")
+	cmd.Flags().StringVar(&flagName, "name", "", "Node name/ID (required unless --from-relay is set)")
 	cmd.Flags().StringVar(&flagAddress, "address", "", "Node IP or hostname (e.g., 10.0.1.50, web1.internal:22)")
 	cmd.Flags().StringVar(&flagTags, "tags", "", "Labels in key=value,key=value format")
 	cmd.Flags().StringVar(&flagGroups, "groups", "", "Groups, comma-separated")
-	cmd.MarkFlagRequired("name")
+	cmd.Flags().StringVar(&flagFromRelay, "from-relay", "", "Populate the node from this agent's live relay tunnel")
+	cmd.Flags().StringVar(&flagRelay, "relay", "", "Relay base URL for --from-relay (default: derived from relay.listen_addr)")
+	cmd.Flags().StringVar(&flagToken, "token", "", "Relay auth token for --from-relay (default: relay.auth_token)")
 
 	return cmd
 }
 
+// nodeFromTunnel composes a node registration from a connected agent's
+// tunnel info. Explicit CLI values win: a non-empty address replaces the
+// tunnel's remote address, and tags are merged over the agent's own labels.
+func nodeFromTunnel(info relay.TunnelInfo, address string, tags map[string]string, groups []fleet.GroupName) *fleet.Node {
+	hostname := info.Hostname
+	if hostname == "" {
+		hostname = string(info.NodeID)
+	}
+	if address == "" {
+		address = info.RemoteAddr
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+	}
+
+	labels := make(map[string]string, len(info.Labels)+len(tags))
+	for k, v := range info.Labels {
+		labels[k] = v
+	}
+	for k, v := range tags {
+		labels[k] = v
+	}
+
+	now := time.Now()
+	return &fleet.Node{
+		ID:           info.NodeID,
+		Hostname:     hostname,
+		Address:      address,
+		Labels:       labels,
+		Groups:       groups,
+		Status:       fleet.NodeStatusOnline,
+		Capabilities: info.Capabilities,
+		Resources:    info.Resources,
+		Version:      info.Version,
+		TunnelID:     string(info.NodeID),
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+}
+
 func newNodeListCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
@@ -731,8 +1933,8 @@ func newNodeListCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("%-20s %-22s %-12s %-24s %s\n", "NODE", "ADDRESS", "STATUS", "LABELS", "LAST SEEN")
-			fmt.Println(strings.Repeat("─", 100))
+			fmt.Printf("%-20s %-22s %-12s %-24s %-34s %s\n", "NODE", "ADDRESS", "STATUS", "LABELS", "USAGE", "LAST SEEN")
+			fmt.Println(strings.Repeat("─", 135))
 			for _, n := range nodes {
 				labels := formatLabels(n.Labels)
 				lastSeen := "never"
@@ -748,7 +1950,7 @@ func newNodeListCmd() *cobra.Command {
 						addr = "—"
 					}
 				}
-				fmt.Printf("%-20s %-22s %-12s %-24s %s\n", n.ID, addr, status, labels, lastSeen)
+				fmt.Printf("%-20s %-22s %-12s %-24s %-34s %s\n", n.ID, addr, status, labels, n.Resources.UtilizationSummary(), lastSeen)
 			}
 			return nil
 		},
@@ -779,11 +1981,20 @@ func newNodeRemoveCmd() *cobra.Command {
 	}
 }
 
-func newNodeDrainCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "drain [node-id]",
-		Short: "Drain a node (stop receiving new commands)",
-		Args: cobra.ExactArgs(1),
+func newNodeExportCmd() *cobra.Command {
+	var flagOutput string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the fleet roster as JSON",
+		Long: `Write every node's ID, hostname, address, labels, groups and capabilities
+as JSON, for backup or to move the roster to another control plane with
+"node import". Status and resource usage are not exported.
+
+Examples:
+  devopsclaw node export > roster.json
+  devopsclaw node export -o roster.json`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
 			if err != nil {
@@ -793,74 +2004,271 @@ func newNodeDrainCmd() *cobra.Command {
 			slogger := newLogger()
 			_, nodeMgr, _, _ := newFleetStack(cfg, slogger)
 
-			if err := nodeMgr.Drain(context.Background(), fleet.NodeID(args[0])); err != nil {
+			roster, err := nodeMgr.Export(context.Background())
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(roster, "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+
+			if flagOutput == "" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(flagOutput, data, 0o600); err != nil {
 				return err
 			}
-			fmt.Printf("✓ Node %s draining\n", args[0])
+			fmt.Fprintf(os.Stderr, "✓ Exported %d node(s) to %s\n", len(roster.Nodes), flagOutput)
 			return nil
 		},
 	}
-}
-
-// ------------------------------------------------------------------
-// `devopsclaw runbook` — Runbook management
-// ------------------------------------------------------------------
-
-func newRunbookCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "runbook",
-		Short: "Define, store, and run reusable workflows",
-	}
 
-	cmd.AddCommand(
-		newRunbookRunCmd(),
-		newRunbookListCmd(),
-		newRunbookShowCmd(),
-	)
+	cmd.Flags().StringVarP(&flagOutput, "output", "o", "", "Write to this file instead of stdout")
 
 	return cmd
 }
 
-func newRunbookRunCmd() *cobra.Command {
-	var flagDryRun bool
+func newNodeImportCmd() *cobra.Command {
+	var (
+		flagMerge        bool
+		flagReplace      bool
+		flagAbortOnError bool
+	)
 
 	cmd := &cobra.Command{
-		Use:   "run [name]",
-		Short: "Execute a runbook",
-		Long: `Execute a YAML-defined runbook workflow.
+		Use:   "import [file]",
+		Short: "Restore a roster written by node export",
+		Long: `Register the nodes in a roster file written by "node export" (or any file
+"fleet import" accepts). Each node is validated and registered on its own;
+failures are reported per node without stopping the rest.
+
+Nodes that are already registered are skipped unless --merge or --replace
+is given:
+
+  --merge    update them: labels are merged, groups added, and the file's
+             hostname, address and capabilities win where set
+  --replace  make the file the whole roster: registered nodes take the
+             file's definition and nodes missing from the file are removed
 
 Examples:
-  devopsclaw runbook run incident-db-high-connections
-  devopsclaw runbook run incident-db-high-connections --dry-run`,
+  devopsclaw node import roster.json
+  devopsclaw node import roster.json --merge
+  devopsclaw node import roster.json --replace --json`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			engine := newRunbookEngine()
-			rb, err := engine.Get(args[0])
+			mode := fleet.ImportSkipExisting
+			switch {
+			case flagMerge:
+				mode = fleet.ImportMerge
+			case flagReplace:
+				mode = fleet.ImportReplace
+			}
+
+			data, err := os.ReadFile(args[0])
 			if err != nil {
 				return err
 			}
-
-			fmt.Printf("📋 Running runbook: %s\n", rb.Name)
-			if rb.Description != "" {
-				fmt.Printf("   %s\n", rb.Description)
+			records, err := fleet.ParseImportFile(data)
+			if err != nil {
+				return err
 			}
-			if flagDryRun {
-				fmt.Println("   Mode: DRY RUN")
+			if mode == fleet.ImportReplace && len(records) == 0 {
+				return fmt.Errorf("%s lists no nodes; refusing to --replace the roster with an empty one", args[0])
 			}
-			fmt.Println()
 
-			result, err := engine.Run(context.Background(), rb, flagDryRun)
-
-			// Audit
-			auditStore := newAuditStore()
-			status := "success"
+			cfg, err := loadConfig()
 			if err != nil {
-				status = "failure"
+				return err
 			}
-			audit.NewLogger(auditStore, "cli").LogRunbook(context.Background(), args[0], flagDryRun, &audit.EventResult{
+
+			slogger := newLogger()
+			_, nodeMgr, _, _ := newFleetStack(cfg, slogger)
+
+			report, err := nodeMgr.Import(context.Background(), records, fleet.ImportOptions{
+				Mode:         mode,
+				AbortOnError: flagAbortOnError,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err := writeImportReport(os.Stdout, report, flagJSON); err != nil {
+				return err
+			}
+			if n := len(report.Failed); n > 0 {
+				return fmt.Errorf("%d node(s) failed to import", n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&flagMerge, "merge", false, "Update nodes that are already registered")
+	cmd.Flags().BoolVar(&flagReplace, "replace", false, "Replace the roster: update registered nodes and remove those not in the file")
+	cmd.Flags().BoolVar(&flagAbortOnError, "abort-on-error", false, "Stop at the first node that fails to import")
+	cmd.MarkFlagsMutuallyExclusive("merge", "replace")
+
+	return cmd
+}
+
+func newNodeDrainCmd() *cobra.Command {
+	var (
+		flagWait    bool
+		flagTimeout time.Duration
+		flagRelay   string
+		flagToken   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "drain [node-id]",
+		Short: "Drain a node (stop receiving new commands)",
+		Long: `Mark a node as draining so it stops receiving new commands.
+
+With --wait the command polls the relay until it has no commands
+outstanding on the node, and exits non-zero listing the request IDs still
+running if --timeout passes first.
+
+Examples:
+  devopsclaw node drain web-1
+  devopsclaw node drain web-1 --wait --timeout 5m`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			slogger := newLogger()
+			_, nodeMgr, _, _ := newFleetStack(cfg, slogger)
+			id := fleet.NodeID(args[0])
+
+			if !flagWait {
+				if err := nodeMgr.Drain(context.Background(), id); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Node %s draining\n", args[0])
+				return nil
+			}
+
+			baseURL := flagRelay
+			if baseURL == "" {
+				baseURL = relayHTTPURL(cfg.Relay.ListenAddr)
+			}
+			token := flagToken
+			if token == "" {
+				token = cfg.Relay.AuthToken
+			}
+			nodeMgr.SetInFlight(relayInFlight(baseURL, token))
+			err = nodeMgr.DrainAndWait(context.Background(), id, flagTimeout)
+			var timeoutErr *fleet.DrainTimeoutError
+			if errors.As(err, &timeoutErr) {
+				fmt.Printf("⚠ Node %s draining, but %d execution(s) still running after %s:\n",
+					args[0], len(timeoutErr.Pending), flagTimeout)
+				for _, reqID := range timeoutErr.Pending {
+					fmt.Printf("  %s\n", reqID)
+				}
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ Node %s drained\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&flagWait, "wait", false, "Wait for in-flight executions on the node to finish")
+	cmd.Flags().DurationVar(&flagTimeout, "timeout", 5*time.Minute, "With --wait, give up after this long (0 = wait forever)")
+	cmd.Flags().StringVar(&flagRelay, "relay", "", "Relay base URL for --wait (default: derived from relay.listen_addr)")
+	cmd.Flags().StringVar(&flagToken, "token", "", "Relay auth token for --wait (default: relay.auth_token)")
+
+	return cmd
+}
+
+// ------------------------------------------------------------------
+// `devopsclaw runbook` — Runbook management
+// ------------------------------------------------------------------
+
+func newRunbookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runbook",
+		Short: "Define, store, and run reusable workflows",
+	}
+
+	cmd.AddCommand(
+		newRunbookRunCmd(),
+		newRunbookListCmd(),
+		newRunbookShowCmd(),
+	)
+
+	return cmd
+}
+
+func newRunbookRunCmd() *cobra.Command {
+	var (
+		flagDryRun bool
+		flagParams []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run [name]",
+		Short: "Execute a runbook",
+		Long: `Execute a YAML-defined runbook workflow.
+
+Examples:
+  devopsclaw runbook run incident-db-high-connections
+  devopsclaw runbook run incident-db-high-connections --dry-run
+  devopsclaw runbook run restart --param service=nginx --param env=prod
+  devopsclaw runbook run incident-db --param host=db-3 --param threshold=80`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := parseRunbookParams(flagParams)
+			if err != nil {
+				return err
+			}
+
+			engine := newRunbookEngine()
+			rb, err := engine.Get(args[0])
+			if err != nil {
+				return err
+			}
+			if _, err := rb.ResolveParams(params); err != nil {
+				return err
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx, tracer, endSpan := traceCommand(context.Background(), cfg, "cli.runbook", map[string]string{"runbook": rb.Name})
+			if rb.HasFleetSteps() && !flagDryRun {
+				_, _, executor, _ := newFleetStack(cfg, newLogger())
+				executor.SetTracer(tracer)
+				engine.SetExecutor(executor)
+			}
+
+			fmt.Printf("📋 Running runbook: %s\n", rb.Name)
+			if rb.Description != "" {
+				fmt.Printf("   %s\n", rb.Description)
+			}
+			if flagDryRun {
+				fmt.Println("   Mode: DRY RUN")
+			}
+			fmt.Println()
+
+			result, err := engine.RunWithParams(ctx, rb, params, flagDryRun)
+
+			// Audit
+			status := "success"
+			if err != nil {
+				status = "failure"
+			}
+			newAuditLogger().LogRunbook(ctx, args[0], flagDryRun, &audit.EventResult{
 				Status:   status,
 				Duration: result.Duration,
 			})
+			endSpan(err)
 
 			if flagJSON {
 				out, _ := runbook.FormatResultJSON(result)
@@ -874,10 +2282,24 @@ Examples:
 	}
 
 	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Preview actions without executing")
+	cmd.Flags().StringArrayVar(&flagParams, "param", nil, "Runbook parameter as key=value (repeatable)")
 
 	return cmd
 }
 
+// parseRunbookParams turns repeated --param key=value flags into a map.
+func parseRunbookParams(pairs []string) (map[string]string, error) {
+	params := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, fmt.Errorf("invalid --param %q: expected key=value", pair)
+		}
+		params[k] = v
+	}
+	return params, nil
+}
+
 func newRunbookListCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
@@ -916,6 +2338,28 @@ func newRunbookListCmd() *cobra.Command {
 	}
 }
 
+// runbookParamLine describes a declared param for `runbook show`, e.g.
+// "  threshold (int, default "80") — alert level".
+func runbookParamLine(p runbook.Param) string {
+	var attrs []string
+	if p.Type != "" && p.Type != runbook.ParamString {
+		attrs = append(attrs, p.Type)
+	}
+	if p.Required {
+		attrs = append(attrs, "required")
+	} else if p.Default != "" {
+		attrs = append(attrs, fmt.Sprintf("default %q", p.Default))
+	}
+	line := "  " + p.Name
+	if len(attrs) > 0 {
+		line += " (" + strings.Join(attrs, ", ") + ")"
+	}
+	if p.Description != "" {
+		line += " — " + p.Description
+	}
+	return line
+}
+
 func newRunbookShowCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "show [name]",
@@ -939,12 +2383,24 @@ func newRunbookShowCmd() *cobra.Command {
 			if len(rb.Tags) > 0 {
 				fmt.Printf("Tags:        %s\n", strings.Join(rb.Tags, ", "))
 			}
+			if len(rb.Params) > 0 {
+				fmt.Println("Params:")
+				for _, p := range rb.Params {
+					fmt.Println(runbookParamLine(p))
+				}
+			}
 			fmt.Printf("Steps:       %d\n\n", len(rb.Steps))
 			for i, step := range rb.Steps {
 				fmt.Printf("  %d. %s\n", i+1, step.Name)
+				if step.When != "" {
+					fmt.Printf("     when: %s\n", step.When)
+				}
 				if step.Run != "" {
 					fmt.Printf("     run: %s\n", step.Run)
 				}
+				if step.Fleet != nil {
+					fmt.Printf("     fleet [%s]: %s\n", step.Fleet.Target, step.Fleet.Command)
+				}
 				if step.Browse != nil {
 					fmt.Printf("     browse: %s\n", step.Browse.Task)
 				}
@@ -970,6 +2426,7 @@ func newAuditCmd() *cobra.Command {
 	cmd.AddCommand(
 		newAuditListCmd(),
 		newAuditExportCmd(),
+		newAuditVerifyCmd(),
 	)
 
 	return cmd
@@ -1017,14 +2474,15 @@ func newAuditListCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("%-24s %-15s %-15s %s\n", "TIMESTAMP", "USER", "TYPE", "ACTION")
-			fmt.Println(strings.Repeat("─", 80))
+			fmt.Printf("%-24s %-15s %-15s %-20s %s\n", "TIMESTAMP", "USER", "TYPE", "ACTION", "TRACE")
+			fmt.Println(strings.Repeat("─", 110))
 			for _, e := range events {
-				fmt.Printf("%-24s %-15s %-15s %s\n",
+				fmt.Printf("%-24s %-15s %-15s %-20s %s\n",
 					e.Timestamp.Format("2006-01-02 15:04:05"),
 					e.User,
 					e.Type,
 					e.Action,
+					e.TraceID,
 				)
 			}
 			return nil
@@ -1039,11 +2497,18 @@ func newAuditListCmd() *cobra.Command {
 }
 
 func newAuditExportCmd() *cobra.Command {
-	var flagSince string
+	var (
+		flagSince  string
+		flagFormat string
+		flagFields []string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "export",
-		Short: "Export audit events as JSON",
+		Short: "Export audit events as JSON, NDJSON, or CSV",
+		Example: `  devopsclaw audit export --since 720h > audit-30d.json
+  devopsclaw audit export --format ndjson | jq -c 'select(.user == "alice")'
+  devopsclaw audit export --format csv --fields timestamp,user,action,result.status`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			store := newAuditStore()
 
@@ -1056,22 +2521,239 @@ func newAuditExportCmd() *cobra.Command {
 				since = time.Now().Add(-dur)
 			}
 
-			events, err := store.Export(context.Background(), since)
+			_, err := audit.Export(context.Background(), store, os.Stdout, audit.ExportOptions{
+				Since:  since,
+				Format: audit.ExportFormat(flagFormat),
+				Fields: flagFields,
+			})
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&flagSince, "since", "24h", "Export since duration")
+	cmd.Flags().StringVar(&flagFormat, "format", "json", "Output format: json, ndjson (one event per line), or csv")
+	cmd.Flags().StringSliceVar(&flagFields, "fields", nil, "CSV columns, as JSON paths like result.status (default timestamp,user,type,action,status)")
+
+	return cmd
+}
+
+func newAuditVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check the audit log's hash chain for tampering",
+		Long: `Recomputes the SHA-256 hash chain over every audit event and reports
+events that were modified, removed, inserted, or reordered since they were
+written. Exits non-zero if any event fails verification.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := newAuditStore().Verify(context.Background())
 			if err != nil {
 				return err
 			}
 
-			data, _ := json.MarshalIndent(events, "", "  ")
-			fmt.Println(string(data))
+			if flagJSON {
+				data, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(data))
+			} else {
+				fmt.Printf("Checked %d audit event(s)", report.Events)
+				if report.Unchained > 0 {
+					fmt.Printf(", %d written before hash chaining (not verifiable)", report.Unchained)
+				}
+				fmt.Println()
+				for _, b := range report.Broken {
+					ts := "-"
+					if !b.Timestamp.IsZero() {
+						ts = b.Timestamp.Format("2006-01-02 15:04:05")
+					}
+					fmt.Printf("  ✗ #%d %s %s: %s\n", b.Index, ts, b.ID, b.Reason)
+				}
+			}
+
+			if first := report.FirstBroken(); first != nil {
+				return fmt.Errorf("audit log integrity check failed: %d event(s) broken, first at #%d", len(report.Broken), first.Index)
+			}
+			if !flagJSON {
+				fmt.Println("✓ Audit log intact")
+			}
 			return nil
 		},
 	}
+}
 
-	cmd.Flags().StringVar(&flagSince, "since", "24h", "Export since duration")
+// ------------------------------------------------------------------
+// `devopsclaw config` — Configuration profiles
+// ------------------------------------------------------------------
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration",
+	}
+
+	cmd.AddCommand(newConfigProfileCmd(), newConfigProfilesCmd(), newConfigValidateCmd())
+	return cmd
+}
+
+func newConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check config.json (and the active profile) for mistakes",
+		Long: `Loads the config the same way every command does and checks it for
+settings that would only fail later: malformed relay addresses, out-of-range
+limits, missing mTLS files, and settings that cannot be combined. Each
+problem names its field path. Exits non-zero if any are found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			problems := config.Validate(cfg)
+
+			if flagJSON {
+				data, _ := json.MarshalIndent(map[string]any{
+					"path":   getConfigPath(),
+					"valid":  len(problems) == 0,
+					"errors": problems,
+				}, "", "  ")
+				fmt.Println(string(data))
+			} else {
+				for _, p := range problems {
+					fmt.Printf("  ✗ %s: %s\n", p.Field, p.Reason)
+				}
+			}
+
+			if len(problems) > 0 {
+				return fmt.Errorf("%s has %d problem(s)", getConfigPath(), len(problems))
+			}
+			if !flagJSON {
+				fmt.Printf("✓ %s is valid\n", getConfigPath())
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named config profiles",
+		Long: `Profiles are partial configs merged over config.json, so relay
+endpoints, tokens, fleet backends, and the default target env
+(fleet.default_env) can be switched per environment. A profile is an entry
+of the "profiles" object in config.json, a ~/.devopsclaw/profiles/<name>.json
+file, or both, in which case the file is merged last.
+
+The profile is chosen by --profile, then $` + config.ProfileEnvVar + `, then the
+profile saved with 'devopsclaw config profile use'.`,
+	}
+
+	cmd.AddCommand(
+		newConfigProfileListCmd(),
+		newConfigProfileUseCmd(),
+	)
+	return cmd
+}
+
+// newConfigProfilesCmd is `config profiles`, a shorthand for
+// `config profile list`.
+func newConfigProfilesCmd() *cobra.Command {
+	cmd := newConfigProfileListCmd()
+	cmd.Use = "profiles"
+	cmd.Aliases = nil
+	cmd.Short = "List profiles and show the active one"
+	return cmd
+}
+
+func newConfigProfileListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Short:   "List available profiles",
+		Aliases: []string{"ls"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := config.ListProfiles(getConfigDir())
+			if err != nil {
+				return err
+			}
+			active, err := resolveProfile()
+			if err != nil {
+				return err
+			}
+
+			if flagJSON {
+				data, _ := json.MarshalIndent(map[string]any{
+					"profiles": names,
+					"active":   active,
+				}, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+
+			if len(names) == 0 {
+				fmt.Printf("No profiles in %s or %s\n", getConfigPath(), filepath.Join(getConfigDir(), "profiles"))
+				return nil
+			}
+			for _, name := range names {
+				marker := " "
+				if name == active {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\n", marker, name)
+			}
+			if active == "" {
+				fmt.Println("No active profile; using config.json only")
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigProfileUseCmd() *cobra.Command {
+	var flagClear bool
+
+	cmd := &cobra.Command{
+		Use:   "use <name>",
+		Short: "Set the default profile",
+		Example: `  devopsclaw config profile use prod
+  devopsclaw config profile use --clear`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flagClear {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if !flagClear {
+				name = args[0]
+			}
+			if err := config.SetActiveProfile(getConfigDir(), name); err != nil {
+				return err
+			}
+			if name == "" {
+				fmt.Println("Cleared default profile; using config.json only")
+			} else {
+				fmt.Printf("Default profile set to %s\n", name)
+			}
+			return nil
+		},
+	}
 
+	cmd.Flags().BoolVar(&flagClear, "clear", false, "Clear the default profile")
 	return cmd
 }
 
+// resolveProfile returns the profile selected by --profile, $DEVOPSCLAW_PROFILE,
+// or the saved default, in that order. An empty result means no profile.
+func resolveProfile() (string, error) {
+	if flagProfile != "" {
+		return flagProfile, nil
+	}
+	if name := os.Getenv(config.ProfileEnvVar); name != "" {
+		return name, nil
+	}
+	return config.ActiveProfile(getConfigDir())
+}
+
 // ------------------------------------------------------------------
 // `devopsclaw relay` — Relay server management
 // ------------------------------------------------------------------
@@ -1082,7 +2764,11 @@ func newRelayCmd() *cobra.Command {
 		Short: "Manage the relay server for NAT-safe fleet connectivity",
 	}
 
-	cmd.AddCommand(newRelayStartCmd())
+	cmd.AddCommand(
+		newRelayStartCmd(),
+		newRelayStatusCmd(),
+		newRelayEventsCmd(),
+	)
 	return cmd
 }
 
@@ -1091,6 +2777,7 @@ func newRelayStartCmd() *cobra.Command {
 		flagAddr  string
 		flagToken string
 		flagMax   int
+		flagDrain time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -1100,10 +2787,15 @@ func newRelayStartCmd() *cobra.Command {
 
 Nodes connect outbound to this server — no inbound ports required on nodes.
 
+On Ctrl+C or SIGTERM the relay stops accepting agents and waits up to
+--drain-timeout for in-flight commands (e.g. a deploy batch) to finish
+before closing tunnels.
+
 Examples:
   devopsclaw relay start
   devopsclaw relay start --addr :9443 --token my-secret-token
-  devopsclaw relay start --max 500`,
+  devopsclaw relay start --max 500
+  devopsclaw relay start --drain-timeout 2m`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
 			if err != nil {
@@ -1121,6 +2813,9 @@ Examples:
 			}
 
 			slogger := newLogger()
+			if flagDrain > 0 {
+				cfg.Relay.DrainTimeoutSec = int(math.Ceil(flagDrain.Seconds()))
+			}
 			_, _, _, wsServer := newFleetStack(cfg, slogger)
 
 			fmt.Printf("🔗 Relay server starting on %s\n", cfg.Relay.ListenAddr)
@@ -1128,49 +2823,377 @@ Examples:
 				fmt.Println("  Auth: token-based")
 			}
 			fmt.Printf("  Max nodes: %d\n", cfg.Relay.MaxNodes)
+			if cfg.Relay.ExecAPI {
+				fmt.Println("  Exec API: POST /relay/exec enabled")
+			}
 			fmt.Println("  Press Ctrl+C to stop")
 
-			ctx := context.Background()
-			return wsServer.Start(ctx)
-		},
-	}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			errCh := make(chan error, 1)
+			go func() { errCh <- wsServer.Start(ctx) }()
+
+			select {
+			case err := <-errCh:
+				return err
+			case <-ctx.Done():
+			}
+			stop() // a second Ctrl+C exits immediately
+			fmt.Println("\nDraining in-flight commands before stopping relay...")
+			if err := wsServer.Shutdown(context.Background()); err != nil {
+				return err
+			}
+			fmt.Println("✓ Relay stopped")
+			return <-errCh
+		},
+	}
 
 	cmd.Flags().StringVar(&flagAddr, "addr", ":9443", "Listen address")
 	cmd.Flags().StringVar(&flagToken, "token", "", "Auth token for node registration")
 	cmd.Flags().IntVar(&flagMax, "max", 1000, "Maximum connected nodes")
+	cmd.Flags().DurationVar(&flagDrain, "drain-timeout", 0, "How long shutdown waits for in-flight commands (default 30s, or relay.drain_timeout_sec)")
 
 	return cmd
 }
 
+func newRelayStatusCmd() *cobra.Command {
+	var (
+		flagAddr  string
+		flagRelay string
+		flagToken string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "List the agents connected to a running relay",
+		Long: `Query a running relay server for its connected node agents: when each
+connected, from which address, and when it last answered a ping.
+
+Examples:
+  devopsclaw relay status
+  devopsclaw relay status --addr :9443 --token my-secret-token
+  devopsclaw relay status --relay https://relay.internal:9443 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			baseURL := flagRelay
+			if baseURL == "" {
+				addr := flagAddr
+				if addr == "" {
+					addr = cfg.Relay.ListenAddr
+				}
+				baseURL = relayHTTPURL(addr)
+			}
+			token := flagToken
+			if token == "" {
+				token = cfg.Relay.AuthToken
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			tunnels, err := fetchRelayTunnels(ctx, baseURL, token)
+			if err != nil {
+				return err
+			}
+
+			if flagJSON {
+				data, _ := json.MarshalIndent(tunnels, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			writeRelayTunnels(os.Stdout, tunnels, time.Now())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&flagAddr, "addr", "", "Relay listen address, as given to relay start (default: relay.listen_addr)")
+	cmd.Flags().StringVar(&flagRelay, "relay", "", "Relay base URL, e.g. https://relay.internal:9443")
+	cmd.Flags().StringVar(&flagToken, "token", "", "Relay auth token (default: relay.auth_token)")
+	cmd.MarkFlagsMutuallyExclusive("addr", "relay")
+
+	return cmd
+}
+
+func newRelayEventsCmd() *cobra.Command {
+	var (
+		flagRelay string
+		flagToken string
+		flagNode  string
+		flagSince string
+		flagType  string
+		flagLimit int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show agent connect/disconnect history from a running relay",
+		Long: `Query a running relay server for node agent connect and disconnect events,
+to diagnose flapping agents. The relay keeps a bounded in-memory history.
+
+Examples:
+  devopsclaw relay events --since 1h
+  devopsclaw relay events --node prod-web-1 --since 24h
+  devopsclaw relay events --type disconnect --relay https://relay.internal:9443 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			baseURL := flagRelay
+			if baseURL == "" {
+				baseURL = relayHTTPURL(cfg.Relay.ListenAddr)
+			}
+			token := flagToken
+			if token == "" {
+				token = cfg.Relay.AuthToken
+			}
+
+			query := url.Values{}
+			for key, value := range map[string]string{"node": flagNode, "since": flagSince, "type": flagType} {
+				if value != "" {
+					query.Set(key, value)
+				}
+			}
+			if flagLimit > 0 {
+				query.Set("limit", strconv.Itoa(flagLimit))
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			events, err := fetchRelayEvents(ctx, baseURL, token, query)
+			if err != nil {
+				return err
+			}
+
+			if flagJSON {
+				data, _ := json.MarshalIndent(events, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			writeRelayEvents(os.Stdout, events)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&flagRelay, "relay", "", "Relay base URL (default: derived from relay.listen_addr)")
+	cmd.Flags().StringVar(&flagToken, "token", "", "Relay auth token (default: relay.auth_token)")
+	cmd.Flags().StringVar(&flagNode, "node", "", "Only events for this node")
+	cmd.Flags().StringVar(&flagSince, "since", "", "Only events newer than this (duration like 1h, or RFC 3339 time)")
+	cmd.Flags().StringVar(&flagType, "type", "", "Only connect or disconnect events")
+	cmd.Flags().IntVar(&flagLimit, "limit", 0, "Show at most the N most recent events")
+
+	return cmd
+}
+
+// relayHTTPURL turns a relay listen address such as ":9443" into a URL
+// reachable from this machine.
+func relayHTTPURL(listenAddr string) string {
+	if listenAddr == "" {
+		listenAddr = ":9443"
+	}
+	if strings.HasPrefix(listenAddr, ":") {
+		listenAddr = "127.0.0.1" + listenAddr
+	}
+	return "http://" + listenAddr
+}
+
+// fetchRelayEvents queries a relay's /relay/events endpoint.
+func fetchRelayEvents(ctx context.Context, baseURL, token string, query url.Values) ([]relay.ConnEvent, error) {
+	var events []relay.ConnEvent
+	if err := relayGet(ctx, baseURL, token, "/relay/events", query, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// fetchRelayTunnel asks a relay for the live tunnel of nodeID.
+func fetchRelayTunnel(ctx context.Context, baseURL, token string, nodeID string) (*relay.TunnelInfo, error) {
+	var info relay.TunnelInfo
+	if err := relayGet(ctx, baseURL, token, "/relay/tunnels", url.Values{"node": {nodeID}}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// fetchRelayTunnels asks a relay for all of its live tunnels.
+func fetchRelayTunnels(ctx context.Context, baseURL, token string) ([]relay.TunnelInfo, error) {
+	var infos []relay.TunnelInfo
+	if err := relayGet(ctx, baseURL, token, "/relay/tunnels", nil, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// relayInFlight reports the commands a running relay still awaits from a
+// node, for node drain --wait. A node without a tunnel has none.
+func relayInFlight(baseURL, token string) fleet.InFlightFunc {
+	return func(ctx context.Context, id fleet.NodeID) ([]string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		tunnels, err := fetchRelayTunnels(ctx, baseURL, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tunnels {
+			if t.NodeID == id {
+				return t.Pending, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// relayGet issues an authenticated GET against a running relay and decodes
+// the JSON response into out.
+func relayGet(ctx context.Context, baseURL, token, path string, query url.Values, out any) error {
+	endpoint := strings.TrimRight(baseURL, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("query relay: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("relay returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode relay response from %s: %w", path, err)
+	}
+	return nil
+}
+
 // ------------------------------------------------------------------
 // Helpers
 // ------------------------------------------------------------------
 
-func buildTarget(node, tag, env string) fleet.TargetSelector {
-	target := fleet.TargetSelector{}
+// buildTarget turns the CLI targeting flags into a selector. Tags accept
+// key=value, key!=value, key=~regex, "key in (a,b)" and "key notin (a,b)";
+// exclude takes the same syntax and removes the matching nodes.
+func buildTarget(node, tag, env, exclude string) (fleet.TargetSelector, error) {
+	target, err := fleet.ParseTargetSelector(node, tag, env, exclude)
+	if err != nil {
+		return target, fmt.Errorf("--%w", err)
+	}
+	return target, nil
+}
 
-	if node != "" {
-		for _, n := range strings.Split(node, ",") {
-			target.NodeIDs = append(target.NodeIDs, fleet.NodeID(strings.TrimSpace(n)))
+// deploySwitchTarget parses --switch-target: a label selector when it
+// contains an operator, otherwise comma-separated node IDs. An empty flag
+// returns nil, so the switch runs on the deployed nodes.
+func deploySwitchTarget(flag string) (*fleet.TargetSelector, error) {
+	if strings.TrimSpace(flag) == "" {
+		return nil, nil
+	}
+	node, tag := flag, ""
+	if isLabelSelector(flag) {
+		node, tag = "", flag
+	}
+	target, err := fleet.ParseTargetSelector(node, tag, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("--switch-target: %w", errors.Unwrap(err))
+	}
+	return &target, nil
+}
+
+// isLabelSelector reports whether flag is a label selector list rather
+// than node IDs, i.e. some expression in it uses a label operator.
+func isLabelSelector(flag string) bool {
+	for _, expr := range fleet.SplitLabelSelectors(flag) {
+		if strings.ContainsAny(expr, "=!~") {
+			return true
+		}
+		if _, rest, ok := strings.Cut(strings.TrimSpace(expr), " "); ok {
+			rest = strings.TrimSpace(rest)
+			for _, op := range []fleet.LabelOp{fleet.LabelOpNotIn, fleet.LabelOpIn} {
+				if list, found := strings.CutPrefix(rest, string(op)); found && strings.HasPrefix(strings.TrimSpace(list), "(") {
+					return true
+				}
+			}
 		}
 	}
+	return false
+}
 
-	if tag != "" {
-		target.Labels = parseTags(tag)
+// targetEnv returns the env label to target: --env when given, otherwise
+// fleet.default_env unless specific nodes were named with --node.
+func targetEnv(cfg *config.Config, env, node string) string {
+	if env != "" || node != "" {
+		return env
 	}
+	return cfg.Fleet.DefaultEnv
+}
 
-	if env != "" {
-		if target.Labels == nil {
-			target.Labels = make(map[string]string)
+// targetPreview is how many nodes a selector matches, split into those
+// that will receive the command (online or degraded) and those that are
+// skipped because they are offline, draining, or unreachable.
+type targetPreview struct {
+	Matched int
+	Online  int
+	Offline int
+}
+
+// previewTarget resolves target against the store's roster without
+// dispatching anything.
+func previewTarget(ctx context.Context, store fleet.Store, target fleet.TargetSelector) (targetPreview, error) {
+	roster, err := store.ListNodes(ctx)
+	if err != nil {
+		return targetPreview{}, err
+	}
+	var p targetPreview
+	for _, n := range roster {
+		if !target.Matches(n) {
+			continue
+		}
+		p.Matched++
+		if n.Status == fleet.NodeStatusOnline || n.Status == fleet.NodeStatusDegraded {
+			p.Online++
+		} else {
+			p.Offline++
 		}
-		target.Labels["env"] = env
 	}
+	return p, nil
+}
 
-	if len(target.NodeIDs) == 0 && len(target.Labels) == 0 && len(target.Groups) == 0 {
-		target.All = true
+// writeTargetPreview prints the one-line scope summary shown before fan-out.
+func writeTargetPreview(w io.Writer, p targetPreview) {
+	if p.Matched == 0 {
+		fmt.Fprintln(w, "matched 0 nodes — check the selector")
+		return
 	}
+	noun := "nodes"
+	if p.Matched == 1 {
+		noun = "node"
+	}
+	fmt.Fprintf(w, "matched %d %s (%d online, %d offline)\n", p.Matched, noun, p.Online, p.Offline)
+}
 
-	return target
+// announceTarget prints the target scope to stderr before dispatch, unless
+// --quiet or --json is set. Lookup errors are left for the executor to report.
+func announceTarget(ctx context.Context, store fleet.Store, target fleet.TargetSelector) {
+	if flagQuiet || flagJSON {
+		return
+	}
+	p, err := previewTarget(ctx, store, target)
+	if err != nil {
+		return
+	}
+	writeTargetPreview(os.Stderr, p)
 }
 
 func parseTags(s string) map[string]string {
@@ -1215,53 +3238,676 @@ func statusIcon(status fleet.NodeStatus) string {
 	}
 }
 
-func printExecResult(result *fleet.ExecResult) error {
-	if flagJSON {
-		data, _ := json.MarshalIndent(result, "", "  ")
-		fmt.Println(string(data))
+// addLabelOutputFlags registers the --label-output/--no-label pair shared by
+// run and fleet exec. Unlabeled output is the default.
+func addLabelOutputFlags(cmd *cobra.Command, label, noLabel *bool) {
+	cmd.Flags().BoolVar(label, "label-output", false, "Prefix every output line with [nodeID] (like kubectl logs --prefix)")
+	cmd.Flags().BoolVar(noLabel, "no-label", false, "Print output without node prefixes (default)")
+	cmd.MarkFlagsMutuallyExclusive("label-output", "no-label")
+}
+
+// OutputFormat selects how a fleet execution result is rendered, in the
+// style of kubectl --output.
+type OutputFormat string
+
+const (
+	OutputText  OutputFormat = "text"  // per-node blocks with full output (default)
+	OutputJSON  OutputFormat = "json"  // versioned ExecResult as indented JSON
+	OutputYAML  OutputFormat = "yaml"  // versioned ExecResult as YAML, nodes sorted by ID
+	OutputTable OutputFormat = "table" // one row per node: NODE STATUS EXIT DURATION
+	OutputWide  OutputFormat = "wide"  // table plus the first line of output
+)
+
+// outputFormats lists the accepted --output values in help order.
+var outputFormats = []OutputFormat{OutputText, OutputJSON, OutputYAML, OutputTable, OutputWide}
+
+// parseOutputFormat validates an --output value. The empty string means
+// OutputText.
+func parseOutputFormat(s string) (OutputFormat, error) {
+	if s == "" {
+		return OutputText, nil
+	}
+	for _, f := range outputFormats {
+		if OutputFormat(strings.ToLower(s)) == f {
+			return f, nil
+		}
+	}
+	names := make([]string, len(outputFormats))
+	for i, f := range outputFormats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unknown output format %q (want one of %s)", s, strings.Join(names, ", "))
+}
+
+// structured reports whether f is meant for machines. Structured formats
+// never stream and never turn node failures into a CLI error.
+func (f OutputFormat) structured() bool {
+	return f == OutputJSON || f == OutputYAML
+}
+
+// addOutputFlag registers --output/-o on a command that renders an
+// ExecResult.
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "", "Output format: text, json, yaml, table, wide (default text; --json implies json)")
+}
+
+// resolveOutputFormat combines --output with the global --json flag;
+// an explicit --output wins.
+func resolveOutputFormat(output string) (OutputFormat, error) {
+	if output == "" && flagJSON {
+		return OutputJSON, nil
+	}
+	return parseOutputFormat(output)
+}
+
+// execRenderOptions controls how a fleet execution result is rendered.
+type execRenderOptions struct {
+	Format OutputFormat // empty means OutputText
+	Label  bool         // text format: prefix output lines with [nodeID]
+
+	// Sort orders the nodes of the text, table and wide formats: by
+	// duration (slowest first), node ID, or status (failures first). Empty
+	// keeps the result order for text and sorts tables by node ID.
+	Sort string
+	// FailedOnly lists only the nodes that did not succeed in the text,
+	// table and wide formats; the summary still counts every node.
+	FailedOnly bool
+}
+
+// Accepted --sort values.
+const (
+	execSortDuration = "duration"
+	execSortNode     = "node"
+	execSortStatus   = "status"
+)
+
+// parseExecSort validates a --sort value; empty means the default order.
+func parseExecSort(s string) (string, error) {
+	switch s = strings.ToLower(s); s {
+	case "", execSortDuration, execSortNode, execSortStatus:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown sort %q (want duration, node, or status)", s)
+	}
+}
+
+// addResultFilterFlags registers --sort and --failed-only on a command
+// that renders an ExecResult.
+func addResultFilterFlags(cmd *cobra.Command, sortBy *string, failedOnly *bool) {
+	cmd.Flags().StringVar(sortBy, "sort", "", "Order nodes by duration (slowest first), node, or status (failures first)")
+	cmd.Flags().BoolVar(failedOnly, "failed-only", false, "Only list nodes that did not succeed; the summary still counts all nodes")
+}
+
+// addMaxOutputFlag registers --max-output on a command that runs an
+// ExecRequest.
+func addMaxOutputFlag(cmd *cobra.Command, maxOutput *int64) {
+	cmd.Flags().Int64Var(maxOutput, "max-output", 0, "Keep at most this many bytes of output per node (default: each node's relay.max_output_bytes, 64 KiB)")
+}
+
+// execStatusRank orders statuses for --sort status, worst first.
+var execStatusRank = map[string]int{
+	"failure":     0,
+	"timeout":     1,
+	"unreachable": 2,
+	"denied":      3,
+	"blocked":     3,
+	"cancelled":   4,
+	"skipped":     5,
+	"dry-run":     6,
+	"success":     7,
+}
+
+// nodeResultFailed reports whether nr counts as failing for
+// --failed-only. Skipped nodes (halted batches) and dry-run nodes do not.
+func nodeResultFailed(nr fleet.NodeResult) bool {
+	return nr.Status != "success" && nr.Status != "skipped" && nr.Status != "dry-run"
+}
+
+// renderedNodeResults applies the sort and failed-only options to results,
+// which it does not modify. Ties keep node ID order.
+func renderedNodeResults(results []fleet.NodeResult, opts execRenderOptions) []fleet.NodeResult {
+	var out []fleet.NodeResult
+	if opts.Sort == "" {
+		out = append(out, results...)
+	} else {
+		out = sortedNodeResults(results)
+	}
+	switch opts.Sort {
+	case execSortDuration:
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	case execSortStatus:
+		sort.SliceStable(out, func(i, j int) bool {
+			return statusRank(out[i].Status) < statusRank(out[j].Status)
+		})
+	}
+	if !opts.FailedOnly {
+		return out
+	}
+	failed := out[:0]
+	for _, nr := range out {
+		if nodeResultFailed(nr) {
+			failed = append(failed, nr)
+		}
+	}
+	return failed
+}
+
+// statusRank is status's --sort status position; unknown statuses sort
+// just before success.
+func statusRank(status string) int {
+	if r, ok := execStatusRank[status]; ok {
+		return r
+	}
+	return execStatusRank["success"] - 1
+}
+
+// streamExecResult runs req with ExecuteStream, drawing a live per-node
+// progress view on w, and returns the aggregate result once every node has
+// finished. The view is erased before returning so the final report
+// replaces it.
+func streamExecResult(ctx context.Context, executor *fleet.Executor, req *fleet.ExecRequest, w io.Writer) (*fleet.ExecResult, error) {
+	events, err := executor.ExecuteStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	view := newLiveExecView(w)
+	var result *fleet.ExecResult
+	for ev := range events {
+		if ev.Type == fleet.NodeEventDone {
+			result = ev.Exec
+			continue
+		}
+		view.Apply(ev)
+	}
+	view.Clear()
+	return result, nil
+}
+
+// liveExecView is a per-node status board that redraws in place with ANSI
+// cursor movement: one line per node showing its state and latest output.
+type liveExecView struct {
+	w        io.Writer
+	order    []fleet.NodeID
+	nodes    map[fleet.NodeID]*liveNodeState
+	drawn    int // lines on screen from the previous draw
+	lastDraw time.Time
+	now      func() time.Time
+}
+
+type liveNodeState struct {
+	started  time.Time
+	lastLine string
+	result   *fleet.NodeResult
+}
+
+// liveRedrawInterval throttles redraws caused by output lines; start and
+// finish events always redraw.
+const liveRedrawInterval = 100 * time.Millisecond
+
+// liveLineWidth caps the output excerpt shown per node.
+const liveLineWidth = 60
+
+func newLiveExecView(w io.Writer) *liveExecView {
+	return &liveExecView{w: w, nodes: make(map[fleet.NodeID]*liveNodeState), now: time.Now}
+}
+
+// Apply records ev and redraws the board.
+func (v *liveExecView) Apply(ev fleet.NodeResultEvent) {
+	st, ok := v.nodes[ev.NodeID]
+	if !ok {
+		st = &liveNodeState{started: ev.Time}
+		v.nodes[ev.NodeID] = st
+		v.order = append(v.order, ev.NodeID)
+	}
+	switch ev.Type {
+	case fleet.NodeEventOutput:
+		if strings.TrimSpace(ev.Line) != "" {
+			st.lastLine = ev.Line
+		}
+		if v.now().Sub(v.lastDraw) < liveRedrawInterval {
+			return
+		}
+	case fleet.NodeEventFinished:
+		st.result = ev.Result
+	}
+	v.draw()
+}
+
+func (v *liveExecView) draw() {
+	var b strings.Builder
+	if v.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", v.drawn)
+	}
+	done := 0
+	for _, id := range v.order {
+		st := v.nodes[id]
+		b.WriteString("\x1b[2K")
+		if st.result != nil {
+			done++
+			fmt.Fprintf(&b, "  %s %s (%s)\n", execStatusIcon(st.result.Status), id, st.result.Duration.Round(time.Millisecond))
+			continue
+		}
+		line := fmt.Sprintf("  ⋯ %s running %s", id, v.now().Sub(st.started).Round(time.Second))
+		if st.lastLine != "" {
+			line += "  │ " + truncateRunes(st.lastLine, liveLineWidth)
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "\x1b[2K  %d/%d nodes finished\n", done, len(v.order))
+	fmt.Fprint(v.w, b.String())
+	v.drawn = len(v.order) + 1
+	v.lastDraw = v.now()
+}
+
+// Clear erases the board.
+func (v *liveExecView) Clear() {
+	if v.drawn > 0 {
+		fmt.Fprintf(v.w, "\x1b[%dA\x1b[J", v.drawn)
+		v.drawn = 0
+	}
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with "…".
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// RenderExecResult writes result to w in the given format. For the text,
+// table and wide formats it returns an error when any node failed, so CLI
+// callers exit non-zero; json and yaml report failures in the document.
+func RenderExecResult(w io.Writer, result *fleet.ExecResult, format OutputFormat) error {
+	return writeExecResult(w, result, execRenderOptions{Format: format})
+}
+
+// writeExecResult is RenderExecResult with the text-only options.
+func writeExecResult(w io.Writer, result *fleet.ExecResult, opts execRenderOptions) error {
+	switch opts.Format {
+	case OutputJSON:
+		data, _ := json.MarshalIndent(fleet.NewVersionedExecResult(result), "", "  ")
+		fmt.Fprintln(w, string(data))
 		return nil
+	case OutputYAML:
+		return writeExecResultYAML(w, result)
+	case OutputTable, OutputWide:
+		if opts.FailedOnly {
+			writeExecSummaryLine(w, result.Summary)
+			fmt.Fprintln(w)
+		}
+		if opts.Sort == "" {
+			opts.Sort = execSortNode
+		}
+		writeExecResultTable(w, renderedNodeResults(result.NodeResults, opts), opts.Format == OutputWide)
+	case OutputText, "":
+		writeExecResultText(w, result, opts)
+	default:
+		return fmt.Errorf("unknown output format %q", opts.Format)
 	}
 
-	fmt.Printf("Fleet Execution — %d nodes, %s\n", result.Summary.Total, result.Duration.Round(time.Millisecond))
-	fmt.Printf("  ✓ %d success  ✗ %d failed  ⏱ %d timeout  ○ %d skipped\n\n",
-		result.Summary.Success, result.Summary.Failed, result.Summary.Timeout, result.Summary.Skipped)
+	if result.Summary.Failed > 0 {
+		return fmt.Errorf("%d node(s) failed", result.Summary.Failed)
+	}
+	if result.Summary.Cancelled > 0 {
+		return fmt.Errorf("%d node(s) cancelled", result.Summary.Cancelled)
+	}
+	if result.Summary.Denied > 0 {
+		return fmt.Errorf("%d node(s) refused the command by policy", result.Summary.Denied)
+	}
+	if result.Summary.Unreachable > 0 {
+		return fmt.Errorf("%d node(s) unreachable: %w", result.Summary.Unreachable, fleet.ErrNoTunnel)
+	}
+	return nil
+}
+
+func writeExecResultText(w io.Writer, result *fleet.ExecResult, opts execRenderOptions) {
+	if isDryRunResult(result) {
+		writeDryRunText(w, result, opts)
+		return
+	}
+	fmt.Fprintf(w, "Fleet Execution — %d nodes, %s\n", result.Summary.Total, result.Duration.Round(time.Millisecond))
+	writeExecSummaryLine(w, result.Summary)
+	fmt.Fprintln(w)
 
+	nodes := renderedNodeResults(result.NodeResults, opts)
+	if opts.FailedOnly && len(nodes) == 0 {
+		fmt.Fprintln(w, "  No failing nodes")
+	}
+	for _, nr := range nodes {
+		detail := nr.Duration.Round(time.Millisecond).String()
+		if nr.Cached {
+			detail += ", cached"
+		}
+		fmt.Fprintf(w, "  %s %s (%s)\n", execStatusIcon(nr.Status), nr.NodeID, detail)
+		for _, line := range nodeOutputLines(nr, opts.Label) {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// isDryRunResult reports whether result is a dry run's preview.
+func isDryRunResult(result *fleet.ExecResult) bool {
+	if len(result.NodeResults) == 0 {
+		return false
+	}
 	for _, nr := range result.NodeResults {
-		icon := "✓"
-		if nr.Status == "failure" {
-			icon = "✗"
-		} else if nr.Status == "timeout" {
-			icon = "⏱"
-		} else if nr.Status == "skipped" {
-			icon = "○"
+		if nr.Status != "dry-run" {
+			return false
 		}
+	}
+	return true
+}
 
-		fmt.Printf("  %s %s (%s)\n", icon, nr.NodeID, nr.Duration.Round(time.Millisecond))
-		if nr.Output != "" {
-			for _, line := range strings.Split(strings.TrimSpace(nr.Output), "\n") {
-				fmt.Printf("    %s\n", line)
+// writeDryRunText lists the nodes a dry run matched, in node order, each
+// with the command it would have run.
+func writeDryRunText(w io.Writer, result *fleet.ExecResult, opts execRenderOptions) {
+	fmt.Fprintf(w, "DRY RUN — would run on %d nodes\n\n", len(result.NodeResults))
+	for _, nr := range sortedNodeResults(result.NodeResults) {
+		name := string(nr.NodeID)
+		if nr.Hostname != "" && nr.Hostname != name {
+			name += " (" + nr.Hostname + ")"
+		}
+		fmt.Fprintf(w, "  %s %s\n", execStatusIcon(nr.Status), name)
+		for _, line := range nodeOutputLines(nr, opts.Label) {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// writeExecSummaryLine writes the per-status node counts.
+func writeExecSummaryLine(w io.Writer, summary fleet.ExecSummary) {
+	fmt.Fprintf(w, "  ✓ %d success  ✗ %d failed  ⏱ %d timeout  ○ %d skipped",
+		summary.Success, summary.Failed, summary.Timeout, summary.Skipped)
+	if summary.Unreachable > 0 {
+		fmt.Fprintf(w, "  ⊘ %d unreachable", summary.Unreachable)
+	}
+	if summary.Cancelled > 0 {
+		fmt.Fprintf(w, "  ⊗ %d cancelled", summary.Cancelled)
+	}
+	if summary.Denied > 0 {
+		fmt.Fprintf(w, "  ⊖ %d denied", summary.Denied)
+	}
+	fmt.Fprintln(w)
+}
+
+// writeExecResultTable renders one row per node, in the given order. wide
+// adds the first line of each node's output, or its error when it printed
+// nothing.
+func writeExecResultTable(w io.Writer, nodes []fleet.NodeResult, wide bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := "NODE\tSTATUS\tEXIT\tDURATION"
+	if wide {
+		header += "\tOUTPUT"
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, nr := range nodes {
+		row := fmt.Sprintf("%s\t%s\t%d\t%s", nr.NodeID, nr.Status, nr.ExitCode, nr.Duration.Round(time.Millisecond))
+		if wide {
+			row += "\t" + firstOutputLine(nr)
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
+
+// writeExecResultYAML renders the same document as --output json. It goes
+// through JSON so keys keep their json names and the map keys come out
+// sorted; node results are sorted by ID so the output is deterministic.
+func writeExecResultYAML(w io.Writer, result *fleet.ExecResult) error {
+	sorted := *result
+	sorted.NodeResults = sortedNodeResults(result.NodeResults)
+
+	data, err := json.Marshal(fleet.NewVersionedExecResult(&sorted))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNumbers(doc)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// yamlNumbers replaces the json.Numbers in a decoded JSON document with
+// int64 or float64, which yaml.v3 would otherwise quote as strings.
+func yamlNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = yamlNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = yamlNumbers(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// sortedNodeResults returns a copy of results ordered by node ID.
+func sortedNodeResults(results []fleet.NodeResult) []fleet.NodeResult {
+	sorted := append([]fleet.NodeResult(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NodeID < sorted[j].NodeID })
+	return sorted
+}
+
+// firstOutputLine is the wide column for nr: its first non-empty output
+// line, falling back to the error.
+func firstOutputLine(nr fleet.NodeResult) string {
+	for _, line := range strings.Split(nr.Output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return nr.Error
+}
+
+// outputDiffReport is the --diff --json document.
+type outputDiffReport struct {
+	Groups []outputDiffGroup  `json:"groups"`
+	Failed []fleet.NodeResult `json:"failed,omitempty"`
+}
+
+type outputDiffGroup struct {
+	fleet.OutputGroup
+	Baseline bool   `json:"baseline,omitempty"`
+	Diff     string `json:"diff,omitempty"` // unified diff against the baseline
+}
+
+// writeOutputDiff renders fleet exec --diff: nodes grouped by identical
+// output, most common group first as the baseline, each other group shown
+// as a unified diff against it. Nodes that did not succeed are listed
+// separately. It returns an error when outputs diverge or any node failed,
+// so drift checks can gate on the exit code.
+func writeOutputDiff(w io.Writer, result *fleet.ExecResult, asJSON bool) error {
+	groups := fleet.GroupOutputs(result.NodeResults)
+	var failed []fleet.NodeResult
+	for _, nr := range result.NodeResults {
+		if nr.Status != "success" {
+			failed = append(failed, nr)
+		}
+	}
+
+	report := outputDiffReport{Failed: failed}
+	for i, g := range groups {
+		dg := outputDiffGroup{OutputGroup: g, Baseline: i == 0}
+		if i > 0 {
+			dg.Diff = fleet.DiffOutputs(groups[0], g)
+		}
+		report.Groups = append(report.Groups, dg)
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Fprintln(w, string(data))
+	} else {
+		fmt.Fprintf(w, "Output Diff — %d nodes, %d variant(s)\n\n", result.Summary.Total, len(groups))
+		for _, g := range report.Groups {
+			label := fmt.Sprintf("%d node(s)", len(g.Nodes))
+			if g.Baseline {
+				label = "baseline, " + label
+			}
+			if g.Diff != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "  [%s] %s: %s\n", g.ShortHash(), label, joinNodeIDs(g.Nodes))
+			if g.Diff == "" {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimRight(g.Diff, "\n"), "\n") {
+				fmt.Fprintln(w, "    "+line)
 			}
 		}
-		if nr.Error != "" {
-			fmt.Printf("    Error: %s\n", nr.Error)
+		if len(failed) > 0 {
+			fmt.Fprintln(w, "\n  No output:")
+			for _, nr := range failed {
+				fmt.Fprintf(w, "  %s %s (%s)", execStatusIcon(nr.Status), nr.NodeID, nr.Status)
+				if nr.Error != "" {
+					fmt.Fprintf(w, ": %s", nr.Error)
+				}
+				fmt.Fprintln(w)
+			}
 		}
 	}
 
-	if result.Summary.Failed > 0 {
-		return fmt.Errorf("%d node(s) failed", result.Summary.Failed)
+	switch {
+	case len(failed) > 0:
+		return fmt.Errorf("%d node(s) failed", len(failed))
+	case len(groups) > 1:
+		return fmt.Errorf("output differs across nodes: %d variants", len(groups))
+	}
+	return nil
+}
+
+func joinNodeIDs(ids []fleet.NodeID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = string(id)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// execStatusIcon returns the marker shown for a node result status.
+func execStatusIcon(status string) string {
+	switch status {
+	case "failure":
+		return "✗"
+	case "timeout":
+		return "⏱"
+	case "skipped", "dry-run":
+		return "○"
+	case "unreachable":
+		return "⊘"
+	case "cancelled":
+		return "⊗"
+	case "denied", "blocked":
+		return "⊖"
+	default:
+		return "✓"
+	}
+}
+
+// nodeOutputLines formats a node's output and error for display. When label
+// is set, each line is prefixed with "[nodeID] " instead of being indented,
+// so merged output stays attributable after piping through grep.
+func nodeOutputLines(nr fleet.NodeResult, label bool) []string {
+	prefix := "    "
+	if label {
+		prefix = "[" + string(nr.NodeID) + "] "
+	}
+
+	var lines []string
+	if nr.Output != "" {
+		for _, line := range strings.Split(strings.TrimSpace(nr.Output), "\n") {
+			lines = append(lines, prefix+line)
+		}
+	}
+	if nr.Truncated {
+		lines = append(lines, prefix+fmt.Sprintf("(output truncated, %d bytes total)", nr.OutputBytes))
+	}
+	if nr.Error != "" {
+		lines = append(lines, prefix+"Error: "+nr.Error)
+	}
+	return lines
+}
+
+// writeImportReport renders a fleet import report as text or JSON.
+func writeImportReport(w io.Writer, report *fleet.ImportReport, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	for _, issue := range report.Skipped {
+		fmt.Fprintf(w, "  ⊘ %s — skipped: %s\n", importIssueName(issue), issue.Reason)
+	}
+	for _, issue := range report.Failed {
+		if issue.Attempts == 0 {
+			// Rejected by validation before any store call.
+			fmt.Fprintf(w, "  ✗ %s — failed: %s\n", importIssueName(issue), issue.Reason)
+			continue
+		}
+		fmt.Fprintf(w, "  ✗ %s — failed after %d attempt(s): %s\n", importIssueName(issue), issue.Attempts, issue.Reason)
+	}
+	for _, id := range report.Removed {
+		fmt.Fprintf(w, "  − %s — removed: not in file\n", id)
+	}
+	fmt.Fprintf(w, "\nImported: %d  Skipped: %d  Failed: %d",
+		len(report.Imported), len(report.Skipped), len(report.Failed))
+	if len(report.Updated) > 0 || len(report.Removed) > 0 {
+		fmt.Fprintf(w, "  Updated: %d  Removed: %d", len(report.Updated), len(report.Removed))
+	}
+	fmt.Fprintln(w)
+	if report.Aborted {
+		fmt.Fprintln(w, "Import aborted at the first failure (--abort-on-error).")
 	}
 	return nil
 }
 
+func importIssueName(issue fleet.ImportIssue) string {
+	if issue.NodeID != "" {
+		return string(issue.NodeID)
+	}
+	return fmt.Sprintf("entry #%d", issue.Index+1)
+}
+
+// printFleetStatus renders the fleet status table to stdout.
 func printFleetStatus(summary *fleet.FleetSummary, nodes []*fleet.Node) {
-	fmt.Println("╔══════════════════════════════════════════════════════════════╗")
-	fmt.Printf("║  FLEET STATUS  ·  %d nodes  ·  %s   ║\n",
+	writeFleetStatus(os.Stdout, summary, nodes)
+}
+
+// writeFleetStatus renders the fleet status table to w.
+func writeFleetStatus(w io.Writer, summary *fleet.FleetSummary, nodes []*fleet.Node) {
+	fmt.Fprintln(w, "╔══════════════════════════════════════════════════════════════╗")
+	fmt.Fprintf(w, "║  FLEET STATUS  ·  %d nodes  ·  %s   ║\n",
 		summary.TotalNodes,
 		time.Now().Format("2006-01-02 15:04"),
 	)
-	fmt.Println("╠════════════════╦═════════════╦══════════════════════════════╣")
-	fmt.Printf("║ %-14s ║ %-11s ║ %-28s ║\n", "NODE", "STATUS", "LABELS")
-	fmt.Println("╠════════════════╬═════════════╬══════════════════════════════╣")
+	fmt.Fprintln(w, "╠════════════════╦═════════════╦══════════════════════════════╣")
+	fmt.Fprintf(w, "║ %-14s ║ %-11s ║ %-28s ║\n", "NODE", "STATUS", "LABELS")
+	fmt.Fprintln(w, "╠════════════════╬═════════════╬══════════════════════════════╣")
 
 	for _, n := range nodes {
 		status := statusIcon(n.Status) + " " + string(n.Status)
@@ -1269,22 +3915,179 @@ func printFleetStatus(summary *fleet.FleetSummary, nodes []*fleet.Node) {
 		if len(labels) > 28 {
 			labels = labels[:27] + "…"
 		}
-		fmt.Printf("║ %-14s ║ %-11s ║ %-28s ║\n", n.ID, status, labels)
+		fmt.Fprintf(w, "║ %-14s ║ %-11s ║ %-28s ║\n", n.ID, status, labels)
 	}
 
-	fmt.Println("╚════════════════╩═════════════╩══════════════════════════════╝")
-	fmt.Printf("  %d online · %d offline · %d degraded · %d unreachable\n",
+	fmt.Fprintln(w, "╚════════════════╩═════════════╩══════════════════════════════╝")
+	fmt.Fprintf(w, "  %d online · %d offline · %d degraded · %d unreachable\n",
 		summary.Online, summary.Offline, summary.Degraded, summary.Unreachable)
 }
 
-// runAgentOnce creates an agent and processes a single message.
+// writeFleetStatusGrouped renders one table per value of labelKey, with a
+// status breakdown in each heading. The NoLabelGroup bucket comes last.
+func writeFleetStatusGrouped(w io.Writer, labelKey string, groups map[string]*fleet.FleetSummary, nodes []*fleet.Node) {
+	values := make([]string, 0, len(groups))
+	for v := range groups {
+		if v != fleet.NoLabelGroup {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	if _, ok := groups[fleet.NoLabelGroup]; ok {
+		values = append(values, fleet.NoLabelGroup)
+	}
+	if len(values) == 0 {
+		fmt.Fprintln(w, "No nodes registered.")
+		return
+	}
+
+	for i, v := range values {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		s := groups[v]
+		title := labelKey + "=" + v
+		if v == fleet.NoLabelGroup {
+			title = fmt.Sprintf("%s (no %s label)", fleet.NoLabelGroup, labelKey)
+		}
+		fmt.Fprintf(w, "%s: %s\n", title, statusBreakdown(s))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, n := range nodes {
+			value, ok := n.Labels[labelKey]
+			if !ok {
+				value = fleet.NoLabelGroup
+			}
+			if value == v {
+				fmt.Fprintf(tw, "  %s\t%s %s\t%s\n", n.ID, statusIcon(n.Status), n.Status, formatLabels(n.Labels))
+			}
+		}
+		tw.Flush()
+	}
+}
+
+// statusBreakdown lists a summary's non-zero status counts, e.g.
+// "12 online / 1 degraded".
+func statusBreakdown(s *fleet.FleetSummary) string {
+	var parts []string
+	for _, c := range []struct {
+		n     int
+		label string
+	}{
+		{s.Online, "online"},
+		{s.Degraded, "degraded"},
+		{s.Draining, "draining"},
+		{s.Unreachable, "unreachable"},
+		{s.Offline, "offline"},
+	} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.label))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%d node(s)", s.TotalNodes)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// writeRelayTunnels renders connected agents as a table, with connection
+// age and last ping relative to now.
+func writeRelayTunnels(w io.Writer, tunnels []relay.TunnelInfo, now time.Time) {
+	if len(tunnels) == 0 {
+		fmt.Fprintln(w, "No agents connected.")
+		return
+	}
+
+	fmt.Fprintf(w, "%d agent(s) connected\n\n", len(tunnels))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tHOSTNAME\tREMOTE ADDR\tCONNECTED\tLAST PING")
+	for _, t := range tunnels {
+		hostname := t.Hostname
+		if hostname == "" {
+			hostname = "—"
+		}
+		connected := t.ConnectedAt.Local().Format("2006-01-02 15:04:05") +
+			" (" + now.Sub(t.ConnectedAt).Round(time.Second).String() + ")"
+		lastPing := "never"
+		if !t.LastPing.IsZero() {
+			lastPing = now.Sub(t.LastPing).Round(time.Second).String() + " ago"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.NodeID, hostname, t.RemoteAddr, connected, lastPing)
+	}
+	tw.Flush()
+}
+
+// writeRelayEvents renders connection events oldest first, followed by
+// per-node connect/disconnect counts.
+func writeRelayEvents(w io.Writer, events []relay.ConnEvent) {
+	if len(events) == 0 {
+		fmt.Fprintln(w, "No connection events.")
+		return
+	}
+
+	type counts struct{ connects, disconnects int }
+	perNode := make(map[fleet.NodeID]*counts)
+	var order []fleet.NodeID
+
+	for _, ev := range events {
+		icon := "↑"
+		if ev.Type == relay.ConnEventDisconnect {
+			icon = "↓"
+		}
+		line := fmt.Sprintf("%s  %s %-10s  %-16s  %s", ev.Time.Local().Format("2006-01-02 15:04:05"), icon, ev.Type, ev.NodeID, ev.RemoteAddr)
+		if ev.Reason != "" {
+			line += "  (" + ev.Reason + ")"
+		}
+		fmt.Fprintln(w, line)
+
+		c, ok := perNode[ev.NodeID]
+		if !ok {
+			c = &counts{}
+			perNode[ev.NodeID] = c
+			order = append(order, ev.NodeID)
+		}
+		if ev.Type == relay.ConnEventConnect {
+			c.connects++
+		} else {
+			c.disconnects++
+		}
+	}
+
+	fmt.Fprintln(w)
+	for _, id := range order {
+		c := perNode[id]
+		fmt.Fprintf(w, "  %s: %d connects · %d disconnects\n", id, c.connects, c.disconnects)
+	}
+}
+
+// setBrowseCookies points cfg's browser at the cookie source for a browse
+// run and returns how many cookies it holds. The source is parsed up front
+// so unreadable or malformed files fail before the agent starts.
+func setBrowseCookies(cfg *config.Config, source, url string) (int, error) {
+	if !cfg.Browser.Enabled {
+		return 0, fmt.Errorf("--cookies-from needs the browser tool; set browser.enabled in the config")
+	}
+	path, err := filepath.Abs(source)
+	if err != nil {
+		return 0, err
+	}
+	cookies, err := browser.LoadCookiesFile(path, url)
+	if err != nil {
+		return 0, err
+	}
+	cfg.Browser.CookiesFrom = path
+	cfg.Browser.CookiesURL = url
+	return len(cookies), nil
+}
+
+// runAgentOnce creates an agent from cfg and processes a single message.
 func runAgentOnce(cfg *config.Config, message string) error {
 	// Delegate to the agent infrastructure
 	// Set up os.Args temporarily for the legacy agent command
 	originalArgs := os.Args
 	os.Args = []string{"devopsclaw", "agent", "-m", message}
 	defer func() { os.Args = originalArgs }()
-	agentCmd()
+	agentCmdWithConfig(cfg)
 	return nil
 }
 
@@ -1294,9 +4097,10 @@ func runAgentOnce(cfg *config.Config, message string) error {
 
 func newAgentDaemonCmd() *cobra.Command {
 	var (
-		flagRelayAddr string
-		flagNodeID    string
-		flagToken     string
+		flagRelayAddr     string
+		flagNodeID        string
+		flagToken         string
+		flagAllowCommands []string
 	)
 
 	cmd := &cobra.Command{
@@ -1311,7 +4115,8 @@ No inbound ports required on the node.
 Examples:
   devopsclaw agent-daemon --relay ws://relay.company.com:9443 --node-id prod-web-1
   devopsclaw agent-daemon --relay wss://relay:9443 --node-id staging-api --token my-secret
-  RELAY_ADDR=ws://relay:9443 NODE_ID=worker-1 devopsclaw agent-daemon`,
+  RELAY_ADDR=ws://relay:9443 NODE_ID=worker-1 devopsclaw agent-daemon
+  devopsclaw agent-daemon --relay wss://relay:9443 --allow-command uptime --allow-command 're:systemctl status [a-z0-9@.-]+'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig()
 			if err != nil {
@@ -1354,14 +4159,46 @@ Examples:
 				AuthToken:         flagToken,
 				ReconnectInterval: 5 * time.Second,
 				HeartbeatInterval: 30 * time.Second,
+				MaxMessageBytes:   cfg.Relay.MaxMessageBytes,
+				Compression:       cfg.Relay.Compression,
+				WorkDir:           cfg.WorkspacePath(),
+			}
+			if m := cfg.Relay.MTLS; m.Enabled && m.ClientCertFile != "" {
+				agentCfg.MTLS = &relay.MTLSConfig{
+					CACertFile:     m.CACertFile,
+					ClientCertFile: m.ClientCertFile,
+					ClientKeyFile:  m.ClientKeyFile,
+				}
+				agentCfg.DisableCertReload = m.DisableCertReload
 			}
 
 			executor := relay.NewShellExecutor("")
+			executor.MaxOutputBytes = cfg.Relay.MaxOutputBytes
+			executor.AllowSudo = cfg.Relay.AllowSudo
+			if len(flagAllowCommands) > 0 {
+				cfg.Relay.CommandPolicy = "allow"
+				cfg.Relay.AllowedCommands = flagAllowCommands
+			}
+			switch cfg.Relay.CommandPolicy {
+			case "", "deny":
+			case "allow":
+				if err := executor.EnableAllowList(cfg.Relay.AllowedCommands); err != nil {
+					return err
+				}
+				if len(cfg.Relay.AllowedCommands) == 0 {
+					slogger.Warn("command allow-list is empty; every command will be denied")
+				}
+			default:
+				return fmt.Errorf("invalid relay.command_policy %q (want \"deny\" or \"allow\")", cfg.Relay.CommandPolicy)
+			}
 			wsAgent := relay.NewWSAgent(agentCfg, executor, slogger)
 
 			fmt.Printf("🔗 Agent daemon starting\n")
 			fmt.Printf("  Node ID:  %s\n", flagNodeID)
 			fmt.Printf("  Relay:    %s\n", flagRelayAddr)
+			if cfg.Relay.CommandPolicy == "allow" {
+				fmt.Printf("  Policy:   allow-list (%d approved patterns)\n", len(cfg.Relay.AllowedCommands))
+			}
 			fmt.Println("  Press Ctrl+C to stop")
 
 			ctx, cancel := context.WithCancel(context.Background())
@@ -1377,6 +4214,21 @@ Examples:
 				cancel()
 			}()
 
+			// SIGHUP reloads a renewed mTLS client cert for the next reconnect.
+			if agentCfg.MTLS != nil {
+				hupCh := make(chan os.Signal, 1)
+				signal.Notify(hupCh, syscall.SIGHUP)
+				go func() {
+					for range hupCh {
+						if err := wsAgent.ReloadClientCert(); err != nil {
+							slogger.Warn("mTLS client cert reload failed", "error", err)
+						} else {
+							slogger.Info("mTLS client cert reloaded; used from the next reconnect")
+						}
+					}
+				}()
+			}
+
 			return wsAgent.Run(ctx)
 		},
 	}
@@ -1384,6 +4236,7 @@ Examples:
 	cmd.Flags().StringVar(&flagRelayAddr, "relay", "", "Relay server address (ws:// or wss://)")
 	cmd.Flags().StringVar(&flagNodeID, "node-id", "", "Node identifier (default: hostname)")
 	cmd.Flags().StringVar(&flagToken, "token", "", "Auth token for relay")
+	cmd.Flags().StringArrayVar(&flagAllowCommands, "allow-command", nil, "Only run approved commands: exact command or \"re:<regexp>\" (repeatable; enables allow-list mode)")
 
 	return cmd
 }
@@ -1413,7 +4266,7 @@ func skillsCobraDispatch() {
 	case "list":
 		skillsListCmd(skillsLoader)
 	case "install":
-		skillsInstallCmd(installer, cfg)
+		skillsInstallCmd(installer, newSkillIndex(cfg), cfg)
 	case "remove", "uninstall":
 		if len(os.Args) < 4 {
 			fmt.Println("Usage: devopsclaw skills remove <skill-name>")
@@ -1425,7 +4278,7 @@ func skillsCobraDispatch() {
 	case "list-builtin":
 		skillsListBuiltinCmd()
 	case "search":
-		skillsSearchCmd(installer)
+		skillsSearchCmd(newSkillIndex(cfg), strings.Join(os.Args[3:], " "))
 	case "show":
 		if len(os.Args) < 4 {
 			fmt.Println("Usage: devopsclaw skills show <skill-name>")
@@ -0,0 +1,1438 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/audit"
+	"github.com/freitascorp/devopsclaw/pkg/config"
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
+	"github.com/freitascorp/devopsclaw/pkg/deploy"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/relay"
+	"github.com/freitascorp/devopsclaw/pkg/skills"
+)
+
+func TestNodeOutputLines_Labeled(t *testing.T) {
+	results := []fleet.NodeResult{
+		{NodeID: "web-1", Output: "INFO started\nERROR disk full\n"},
+		{NodeID: "web-2", Output: "INFO started", Error: "exit status 1"},
+	}
+
+	for _, nr := range results {
+		lines := nodeOutputLines(nr, true)
+		if len(lines) == 0 {
+			t.Fatalf("%s: expected output lines", nr.NodeID)
+		}
+		want := "[" + string(nr.NodeID) + "] "
+		for _, line := range lines {
+			if !strings.HasPrefix(line, want) {
+				t.Errorf("line %q missing prefix %q", line, want)
+			}
+		}
+	}
+
+	lines := nodeOutputLines(results[0], true)
+	if len(lines) != 2 || lines[1] != "[web-1] ERROR disk full" {
+		t.Errorf("lines = %q", lines)
+	}
+	lines = nodeOutputLines(results[1], true)
+	if lines[len(lines)-1] != "[web-2] Error: exit status 1" {
+		t.Errorf("error line = %q", lines[len(lines)-1])
+	}
+}
+
+func TestNodeOutputLines_Unlabeled(t *testing.T) {
+	lines := nodeOutputLines(fleet.NodeResult{NodeID: "web-1", Output: "a\nb"}, false)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "[web-1]") {
+			t.Errorf("unexpected prefix in %q", line)
+		}
+		if !strings.HasPrefix(line, "    ") {
+			t.Errorf("line %q should keep the default indent", line)
+		}
+	}
+}
+
+func TestNodeOutputLines_Truncated(t *testing.T) {
+	lines := nodeOutputLines(fleet.NodeResult{NodeID: "web-1", Output: "aaaa", Truncated: true, OutputBytes: 52431}, false)
+	if len(lines) != 2 || lines[1] != "    (output truncated, 52431 bytes total)" {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestNodeOutputLines_Empty(t *testing.T) {
+	if lines := nodeOutputLines(fleet.NodeResult{NodeID: "web-1"}, true); len(lines) != 0 {
+		t.Errorf("expected no lines, got %q", lines)
+	}
+}
+
+func testExecResult() *fleet.ExecResult {
+	return &fleet.ExecResult{
+		RequestID: "req-1",
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-1", Output: "up 3 days\n", Status: "success", Duration: 120 * time.Millisecond},
+			{NodeID: "web-2", Error: "exit status 2", ExitCode: 2, Status: "failure", Duration: 80 * time.Millisecond},
+			{NodeID: "web-3", Error: "execution timed out", ExitCode: -1, Status: "timeout", Duration: time.Second},
+		},
+		Summary:  fleet.ExecSummary{Total: 3, Success: 1, Failed: 1, Timeout: 1},
+		Duration: time.Second,
+	}
+}
+
+func TestWriteExecResult_Text(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeExecResult(&buf, testExecResult(), execRenderOptions{})
+	if err == nil || err.Error() != "1 node(s) failed" {
+		t.Errorf("err = %v, want 1 node(s) failed", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"Fleet Execution — 3 nodes, 1s",
+		"✓ 1 success  ✗ 1 failed  ⏱ 1 timeout  ○ 0 skipped",
+		"  ✓ web-1 (120ms)\n    up 3 days\n",
+		"  ✗ web-2 (80ms)\n    Error: exit status 2\n",
+		"  ⏱ web-3 (1s)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteExecResult_Labeled(t *testing.T) {
+	var buf bytes.Buffer
+	writeExecResult(&buf, testExecResult(), execRenderOptions{Label: true})
+
+	out := buf.String()
+	if !strings.Contains(out, "[web-1] up 3 days\n") || !strings.Contains(out, "[web-2] Error: exit status 2\n") {
+		t.Errorf("expected labeled lines:\n%s", out)
+	}
+}
+
+func TestWriteExecResult_AllSuccess(t *testing.T) {
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{{NodeID: "db-1", Status: "success"}},
+		Summary:     fleet.ExecSummary{Total: 1, Success: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := writeExecResult(&buf, result, execRenderOptions{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "✓ db-1") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+// mixedExecResult has every status and distinct durations, out of ID order.
+func mixedExecResult() *fleet.ExecResult {
+	return &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-3", Status: "success", Output: "ok\n", Duration: 300 * time.Millisecond},
+			{NodeID: "web-1", Status: "timeout", Error: "execution timed out", ExitCode: -1, Duration: 2 * time.Second},
+			{NodeID: "web-5", Status: "skipped", Duration: 0},
+			{NodeID: "web-2", Status: "failure", Error: "exit status 1", ExitCode: 1, Duration: 100 * time.Millisecond},
+			{NodeID: "web-4", Status: "success", Output: "ok\n", Duration: 900 * time.Millisecond},
+		},
+		Summary:  fleet.ExecSummary{Total: 5, Success: 2, Failed: 1, Timeout: 1, Skipped: 1},
+		Duration: 2 * time.Second,
+	}
+}
+
+func nodeIDs(results []fleet.NodeResult) []string {
+	ids := make([]string, len(results))
+	for i, nr := range results {
+		ids[i] = string(nr.NodeID)
+	}
+	return ids
+}
+
+func TestRenderedNodeResults_Sort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"web-3", "web-1", "web-5", "web-2", "web-4"}},
+		{execSortNode, []string{"web-1", "web-2", "web-3", "web-4", "web-5"}},
+		{execSortDuration, []string{"web-1", "web-4", "web-3", "web-2", "web-5"}},
+		{execSortStatus, []string{"web-2", "web-1", "web-5", "web-3", "web-4"}},
+	}
+	for _, tt := range tests {
+		got := nodeIDs(renderedNodeResults(mixedExecResult().NodeResults, execRenderOptions{Sort: tt.sort}))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort %q = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+
+	got := nodeIDs(renderedNodeResults(mixedExecResult().NodeResults, execRenderOptions{Sort: execSortDuration, FailedOnly: true}))
+	if want := []string{"web-1", "web-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failed-only by duration = %v, want %v", got, want)
+	}
+
+	if _, err := parseExecSort("size"); err == nil {
+		t.Error("expected error for unknown sort")
+	}
+}
+
+func TestWriteExecResult_FailedOnly(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeExecResult(&buf, mixedExecResult(), execRenderOptions{FailedOnly: true, Sort: execSortDuration})
+	if err == nil {
+		t.Error("expected an error for the failed node")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "✓ 2 success  ✗ 1 failed  ⏱ 1 timeout  ○ 1 skipped") {
+		t.Errorf("summary line missing:\n%s", out)
+	}
+	for _, id := range []string{"web-3", "web-4", "web-5"} {
+		if strings.Contains(out, id) {
+			t.Errorf("non-failing node %s detailed:\n%s", id, out)
+		}
+	}
+	if strings.Index(out, "web-1") > strings.Index(out, "web-2") || !strings.Contains(out, "Error: exit status 1") {
+		t.Errorf("failing nodes not detailed slowest first:\n%s", out)
+	}
+
+	buf.Reset()
+	writeExecResult(&buf, mixedExecResult(), execRenderOptions{Format: OutputTable, FailedOnly: true})
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "✗ 1 failed") || !strings.HasPrefix(lines[2], "NODE") ||
+		!strings.HasPrefix(lines[3], "web-1") || !strings.HasPrefix(lines[4], "web-2") {
+		t.Errorf("failed-only table:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	allOK := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{{NodeID: "db-1", Status: "success"}},
+		Summary:     fleet.ExecSummary{Total: 1, Success: 1},
+	}
+	if err := writeExecResult(&buf, allOK, execRenderOptions{FailedOnly: true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No failing nodes") || strings.Contains(buf.String(), "db-1") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestWriteExecResult_Cancelled(t *testing.T) {
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "db-1", Status: "success"},
+			{NodeID: "db-2", Status: "cancelled", Error: "execution cancelled", ExitCode: -1},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Success: 1, Cancelled: 1},
+	}
+
+	var buf bytes.Buffer
+	err := writeExecResult(&buf, result, execRenderOptions{})
+	if err == nil || err.Error() != "1 node(s) cancelled" {
+		t.Errorf("err = %v, want 1 node(s) cancelled", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "⊗ 1 cancelled") || !strings.Contains(out, "⊗ db-2") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestWriteExecResult_DryRun(t *testing.T) {
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-2", Hostname: "web-2.prod", Status: "dry-run", Output: "sudo -n -u root -- /bin/sh -c 'systemctl restart nginx'"},
+			{NodeID: "web-1", Hostname: "web-1.prod", Status: "dry-run", Output: "sudo -n -u root -- /bin/sh -c 'systemctl restart nginx'"},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Skipped: 2},
+	}
+
+	var buf bytes.Buffer
+	if err := writeExecResult(&buf, result, execRenderOptions{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := `DRY RUN — would run on 2 nodes
+
+  ○ web-1 (web-1.prod)
+    sudo -n -u root -- /bin/sh -c 'systemctl restart nginx'
+  ○ web-2 (web-2.prod)
+    sudo -n -u root -- /bin/sh -c 'systemctl restart nginx'
+`
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeExecResult(&buf, result, execRenderOptions{FailedOnly: true})
+	if !strings.Contains(buf.String(), "DRY RUN") {
+		t.Errorf("--failed-only hid the dry run preview:\n%s", buf.String())
+	}
+}
+
+func TestWriteExecResult_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeExecResult(&buf, testExecResult(), execRenderOptions{Format: OutputJSON}); err != nil {
+		t.Errorf("JSON mode should not return node failures as errors: %v", err)
+	}
+
+	var decoded fleet.ExecResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if decoded.RequestID != "req-1" || len(decoded.NodeResults) != 3 {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	var envelope struct {
+		SchemaVersion string `json:"schema_version"`
+	}
+	json.Unmarshal(buf.Bytes(), &envelope)
+	if envelope.SchemaVersion != fleet.ExecResultSchemaVersion {
+		t.Errorf("schema_version = %q, want %q", envelope.SchemaVersion, fleet.ExecResultSchemaVersion)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// goldenExecResult is the fixed result behind the --output golden files.
+// Nodes are deliberately out of order so sorted formats show it.
+func goldenExecResult() *fleet.ExecResult {
+	started := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	return &fleet.ExecResult{
+		RequestID: "fleet_golden",
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-2", Hostname: "web-2.internal", Error: "exit status 2", ExitCode: 2, Status: "failure",
+				Duration: 80 * time.Millisecond, StartedAt: started},
+			{NodeID: "db-1", Hostname: "db-1.internal", Output: "09:30:01 up 12 days,  load average: 0.42\nsecond line\n",
+				Status: "success", Duration: 1234 * time.Millisecond, StartedAt: started, Shell: "/bin/sh"},
+			{NodeID: "web-1", Hostname: "web-1.internal", Output: "09:30:00 up 3 days,  load average: 0.05\n",
+				Status: "success", Duration: 120 * time.Millisecond, StartedAt: started, Shell: "/bin/sh"},
+			{NodeID: "web-3", Hostname: "web-3.internal", Error: "execution timed out", ExitCode: -1, Status: "timeout",
+				Duration: 30 * time.Second, StartedAt: started},
+		},
+		Summary:    fleet.ExecSummary{Total: 4, Success: 2, Failed: 1, Timeout: 1},
+		Duration:   30 * time.Second,
+		StartedAt:  started,
+		FinishedAt: started.Add(30 * time.Second),
+	}
+}
+
+func TestRenderExecResult_Golden(t *testing.T) {
+	for _, format := range outputFormats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := RenderExecResult(&buf, goldenExecResult(), format)
+			if format.structured() {
+				if err != nil {
+					t.Errorf("%s should not return node failures as errors: %v", format, err)
+				}
+			} else if err == nil || err.Error() != "1 node(s) failed" {
+				t.Errorf("err = %v, want 1 node(s) failed", err)
+			}
+
+			path := filepath.Join("testdata", "exec_result."+string(format)+".golden")
+			if *updateGolden {
+				if err := os.MkdirAll("testdata", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("%s output does not match %s:\n--- got ---\n%s\n--- want ---\n%s", format, path, got, want)
+			}
+		})
+	}
+}
+
+func TestRenderExecResult_YAMLIsDeterministic(t *testing.T) {
+	result := goldenExecResult()
+	var first bytes.Buffer
+	RenderExecResult(&first, result, OutputYAML)
+
+	// Reversing the input order must not change the document.
+	nodes := result.NodeResults
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	var second bytes.Buffer
+	RenderExecResult(&second, result, OutputYAML)
+	if first.String() != second.String() {
+		t.Errorf("yaml depends on node order:\n%s\n---\n%s", first.String(), second.String())
+	}
+	if result.NodeResults[0].NodeID != "web-3" {
+		t.Error("rendering must not reorder the caller's results")
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for in, want := range map[string]OutputFormat{"": OutputText, "text": OutputText, "YAML": OutputYAML, "wide": OutputWide} {
+		if got, err := parseOutputFormat(in); err != nil || got != want {
+			t.Errorf("parseOutputFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseOutputFormat("csv"); err == nil || !strings.Contains(err.Error(), "text, json, yaml, table, wide") {
+		t.Errorf("err = %v, want the accepted formats listed", err)
+	}
+}
+
+func TestWriteFleetStatus(t *testing.T) {
+	summary := &fleet.FleetSummary{TotalNodes: 2, Online: 1, Unreachable: 1}
+	nodes := []*fleet.Node{
+		{ID: "web-1", Status: fleet.NodeStatusOnline, Labels: map[string]string{"env": "prod"}},
+		{ID: "web-2", Status: fleet.NodeStatusUnreachable},
+	}
+
+	var buf bytes.Buffer
+	writeFleetStatus(&buf, summary, nodes)
+
+	out := buf.String()
+	for _, want := range []string{"FLEET STATUS  ·  2 nodes", "web-1", "● online", "env=prod", "✗ unreachable", "1 online · 0 offline · 0 degraded · 1 unreachable"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteFleetStatusGrouped(t *testing.T) {
+	nodes := []*fleet.Node{
+		{ID: "web-1", Status: fleet.NodeStatusOnline, Labels: map[string]string{"env": "prod"}},
+		{ID: "web-2", Status: fleet.NodeStatusDegraded, Labels: map[string]string{"env": "prod"}},
+		{ID: "db-1", Status: fleet.NodeStatusOnline, Labels: map[string]string{"env": "staging"}},
+		{ID: "bastion", Status: fleet.NodeStatusOffline},
+	}
+	groups := map[string]*fleet.FleetSummary{
+		"prod":             {TotalNodes: 2, Online: 1, Degraded: 1},
+		"staging":          {TotalNodes: 1, Online: 1},
+		fleet.NoLabelGroup: {TotalNodes: 1, Offline: 1},
+	}
+
+	var buf bytes.Buffer
+	writeFleetStatusGrouped(&buf, "env", groups, nodes)
+	out := buf.String()
+
+	prod := strings.Index(out, "env=prod: 1 online / 1 degraded")
+	staging := strings.Index(out, "env=staging: 1 online")
+	none := strings.Index(out, "(none) (no env label): 1 offline")
+	if prod < 0 || staging < prod || none < staging {
+		t.Fatalf("group headings missing or out of order:\n%s", out)
+	}
+	if web2 := strings.Index(out, "web-2"); web2 < prod || web2 > staging {
+		t.Errorf("web-2 not listed under env=prod:\n%s", out)
+	}
+	if b := strings.Index(out, "bastion"); b < none {
+		t.Errorf("bastion not listed under (none):\n%s", out)
+	}
+}
+
+func TestWriteImportReport(t *testing.T) {
+	report := &fleet.ImportReport{
+		Imported: []fleet.NodeID{"web-1", "web-2"},
+		Skipped:  []fleet.ImportIssue{{Index: 2, NodeID: "web-3", Reason: "already registered"}, {Index: 4, Reason: "no id or hostname"}},
+		Failed:   []fleet.ImportIssue{{Index: 3, NodeID: "db-1", Reason: "database is locked", Attempts: 3}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeImportReport(&buf, report, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"web-3 — skipped: already registered",
+		"entry #5 — skipped: no id or hostname",
+		"db-1 — failed after 3 attempt(s): database is locked",
+		"Imported: 2  Skipped: 2  Failed: 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := writeImportReport(&buf, report, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded fleet.ImportReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(decoded.Failed) != 1 || decoded.Failed[0].Attempts != 3 {
+		t.Errorf("decoded failed = %+v", decoded.Failed)
+	}
+}
+
+func TestWriteImportReport_ReplaceMode(t *testing.T) {
+	report := &fleet.ImportReport{
+		Imported: []fleet.NodeID{"app-1"},
+		Updated:  []fleet.NodeID{"web-1"},
+		Removed:  []fleet.NodeID{"db-1"},
+		Failed:   []fleet.ImportIssue{{Index: 2, NodeID: "web-9", Reason: `invalid address "https://x"`}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeImportReport(&buf, report, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`web-9 — failed: invalid address "https://x"`,
+		"db-1 — removed: not in file",
+		"Imported: 1  Skipped: 0  Failed: 1  Updated: 1  Removed: 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMaintainRetention(t *testing.T) {
+	cfg := config.DefaultConfig()
+	day := 24 * time.Hour
+	tests := []struct {
+		flag string
+		days int
+		want time.Duration
+	}{
+		{"", 0, fleet.DefaultExecutionRetention},
+		{"", 14, 14 * day},
+		{"7d", 14, 7 * day},
+		{"72h", 0, 72 * time.Hour},
+		{"0", 14, 0},
+		{"0d", 0, 0},
+	}
+	for _, tt := range tests {
+		cfg.Fleet.ExecutionRetentionDays = tt.days
+		got, err := maintainRetention(tt.flag, cfg)
+		if err != nil || got != tt.want {
+			t.Errorf("maintainRetention(%q, days=%d) = %v, %v; want %v", tt.flag, tt.days, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"30", "-1d", "xd", "-5h", "month"} {
+		if _, err := maintainRetention(bad, cfg); err == nil {
+			t.Errorf("maintainRetention(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestWriteMaintenanceReport(t *testing.T) {
+	report := &fleet.MaintenanceReport{
+		DeletedExecutions: 300,
+		Cutoff:            time.Date(2026, 9, 16, 12, 0, 0, 0, time.Local),
+		SizeBefore:        3 << 20,
+		SizeAfter:         40 << 10,
+	}
+	var buf bytes.Buffer
+	if err := writeMaintenanceReport(&buf, report, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "Deleted 300 execution(s) recorded before 2026-09-16 12:00\nDatabase: 3.0 MiB → 40.0 KiB\n"
+	if buf.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeMaintenanceReport(&buf, &fleet.MaintenanceReport{SizeBefore: 512, SizeAfter: 512}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Kept all executions") || !strings.Contains(buf.String(), "512 B → 512 B") {
+		t.Errorf("no-retention output = %q", buf.String())
+	}
+}
+
+func TestWriteDeployPlan(t *testing.T) {
+	plan := &deploy.DeployPlan{
+		Service:  "myapp",
+		Version:  "v2.1.3",
+		Strategy: deploy.StrategyCanary,
+		Nodes:    3,
+		Batches: []deploy.PlannedBatch{
+			{Index: 0, Percent: 5, Nodes: []fleet.NodeID{"web-1"}},
+			{Index: 2, Percent: 100, Nodes: []fleet.NodeID{"web-2", "web-3"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	writeDeployPlan(&buf, plan)
+	out := buf.String()
+	for _, want := range []string{
+		"Plan myapp:v2.1.3 — canary 5%→100% across 3 node(s)",
+		"Batch 1 (5%):    1 node(s): web-1",
+		"Batch 3 (100%):  2 node(s): web-2, web-3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteRelayEvents(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []relay.ConnEvent{
+		{NodeID: "web-1", Type: relay.ConnEventConnect, Time: at, RemoteAddr: "10.0.0.1:5000"},
+		{NodeID: "web-1", Type: relay.ConnEventDisconnect, Time: at.Add(time.Minute), RemoteAddr: "10.0.0.1:5000", Reason: "closed by agent (1000)"},
+		{NodeID: "web-1", Type: relay.ConnEventConnect, Time: at.Add(2 * time.Minute), RemoteAddr: "10.0.0.1:5001"},
+		{NodeID: "db-1", Type: relay.ConnEventConnect, Time: at.Add(3 * time.Minute), RemoteAddr: "10.0.0.2:5000"},
+	}
+
+	var buf bytes.Buffer
+	writeRelayEvents(&buf, events)
+	out := buf.String()
+	for _, want := range []string{
+		"↓ disconnect",
+		"(closed by agent (1000))",
+		"web-1: 2 connects · 1 disconnects",
+		"db-1: 1 connects · 0 disconnects",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	writeRelayEvents(&buf, nil)
+	if !strings.Contains(buf.String(), "No connection events") {
+		t.Errorf("empty output = %q", buf.String())
+	}
+}
+
+func TestFetchRelayEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/relay/events" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("node") != "web-1" {
+			t.Errorf("node query = %q", r.URL.Query().Get("node"))
+		}
+		json.NewEncoder(w).Encode([]relay.ConnEvent{{NodeID: "web-1", Type: relay.ConnEventConnect}})
+	}))
+	defer srv.Close()
+
+	events, err := fetchRelayEvents(context.Background(), srv.URL, "tok", url.Values{"node": {"web-1"}})
+	if err != nil {
+		t.Fatalf("fetchRelayEvents() error: %v", err)
+	}
+	if len(events) != 1 || events[0].NodeID != "web-1" {
+		t.Errorf("events = %+v", events)
+	}
+
+	_, err = fetchRelayEvents(context.Background(), srv.URL, "wrong", nil)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected 401 error, got %v", err)
+	}
+}
+
+func TestNodeFromTunnel(t *testing.T) {
+	info := relay.TunnelInfo{
+		NodeID:       "web-3",
+		RemoteAddr:   "203.0.113.7:51544",
+		Hostname:     "web-3.internal",
+		Labels:       map[string]string{"env": "staging", "arch": "arm"},
+		Capabilities: []string{"shell", "file"},
+		Resources:    fleet.NodeResources{OS: "linux", Arch: "arm64", CPUCores: 4},
+	}
+
+	node := nodeFromTunnel(info, "", parseTags("env=prod,role=web"), []fleet.GroupName{"web"})
+	if node.ID != "web-3" || node.Hostname != "web-3.internal" || node.TunnelID != "web-3" {
+		t.Errorf("identity = %s/%s/%s", node.ID, node.Hostname, node.TunnelID)
+	}
+	if node.Address != "203.0.113.7" {
+		t.Errorf("Address = %q, want the tunnel's remote host", node.Address)
+	}
+	wantLabels := map[string]string{"env": "prod", "role": "web", "arch": "arm"}
+	if !reflect.DeepEqual(node.Labels, wantLabels) {
+		t.Errorf("Labels = %v, want CLI tags merged over the agent's %v", node.Labels, wantLabels)
+	}
+	if node.Resources.OS != "linux" || node.Resources.Arch != "arm64" || len(node.Capabilities) != 2 {
+		t.Errorf("resources/capabilities not copied: %+v %v", node.Resources, node.Capabilities)
+	}
+	if len(node.Groups) != 1 || node.Groups[0] != "web" {
+		t.Errorf("Groups = %v", node.Groups)
+	}
+
+	if got := nodeFromTunnel(info, "10.0.1.50", nil, nil).Address; got != "10.0.1.50" {
+		t.Errorf("--address should override the tunnel address, got %q", got)
+	}
+}
+
+func TestFetchRelayTunnel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/relay/tunnels" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("node") != "web-3" {
+			http.Error(w, "node has no active tunnel", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(relay.TunnelInfo{NodeID: "web-3", RemoteAddr: "203.0.113.7:51544"})
+	}))
+	defer srv.Close()
+
+	info, err := fetchRelayTunnel(context.Background(), srv.URL, "tok", "web-3")
+	if err != nil {
+		t.Fatalf("fetchRelayTunnel() error: %v", err)
+	}
+	if info.NodeID != "web-3" || info.RemoteAddr != "203.0.113.7:51544" {
+		t.Errorf("info = %+v", info)
+	}
+
+	_, err = fetchRelayTunnel(context.Background(), srv.URL, "tok", "web-9")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error for a node without a tunnel, got %v", err)
+	}
+}
+
+func TestTraceCommand_TagsAuditEvents(t *testing.T) {
+	ctx, tracer, endSpan := traceCommand(context.Background(), &config.Config{}, "cli.runbook", nil)
+	store := audit.NewFileStore(t.TempDir())
+	if err := audit.NewLogger(store, "cli").LogRunbook(ctx, "restart-web", false, &audit.EventResult{Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	endSpan(nil)
+
+	spans := tracer.QuerySpans(observability.SpanQueryOptions{Name: "cli.runbook"})
+	if len(spans) != 1 {
+		t.Fatalf("cli.runbook spans = %d, want 1", len(spans))
+	}
+	events, err := store.Query(context.Background(), audit.QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].TraceID != spans[0].TraceID {
+		t.Fatalf("events = %+v, want one tagged with trace %s", events, spans[0].TraceID)
+	}
+}
+
+func TestNewTaskHistory_UsesConfiguredRedaction(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Observability.TaskHistory.Path = filepath.Join(t.TempDir(), "tasks.db")
+	cfg.Redact.Patterns = []string{`xoxb-[0-9a-z-]+`}
+	h, err := newTaskHistory(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.Record(&observability.TaskRecord{
+		ID:        "call-1",
+		Action:    "tool_exec",
+		Input:     json.RawMessage(`{"command":"notify --token xoxb-123-abc password=hunter2"}`),
+		Timestamp: time.Now(),
+	})
+	recs := h.Query(observability.TaskQueryOptions{})
+	if len(recs) != 1 {
+		t.Fatalf("records = %d, want 1", len(recs))
+	}
+	if in := string(recs[0].Input); strings.Contains(in, "xoxb-123") || strings.Contains(in, "hunter2") {
+		t.Errorf("input = %s, want the configured and default patterns masked", in)
+	}
+}
+
+func TestRelayInFlight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]relay.TunnelInfo{
+			{NodeID: "web-1", Pending: []string{"cmd-1", "cmd-2"}},
+			{NodeID: "web-2"},
+		})
+	}))
+	defer srv.Close()
+
+	inFlight := relayInFlight(srv.URL, "tok")
+	for id, want := range map[fleet.NodeID][]string{
+		"web-1": {"cmd-1", "cmd-2"},
+		"web-2": nil,
+		"web-9": nil, // no tunnel, so nothing outstanding
+	} {
+		got, err := inFlight(context.Background(), id)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: in flight = %v, %v; want %v", id, got, err, want)
+		}
+	}
+
+	if _, err := relayInFlight(srv.URL, "wrong")(context.Background(), "web-1"); err == nil {
+		t.Error("expected an error when the relay refuses the token")
+	}
+}
+
+func TestFetchRelayTunnels(t *testing.T) {
+	connected := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/relay/tunnels" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]relay.TunnelInfo{
+			{NodeID: "web-1", Hostname: "web-1.internal", RemoteAddr: "203.0.113.7:51544", ConnectedAt: connected, LastPing: connected.Add(50 * time.Minute)},
+			{NodeID: "web-2", RemoteAddr: "203.0.113.8:40112", ConnectedAt: connected},
+		})
+	}))
+	defer srv.Close()
+
+	if _, err := fetchRelayTunnels(context.Background(), srv.URL, "wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 error, got %v", err)
+	}
+	tunnels, err := fetchRelayTunnels(context.Background(), srv.URL, "tok")
+	if err != nil {
+		t.Fatalf("fetchRelayTunnels() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writeRelayTunnels(&buf, tunnels, connected.Add(time.Hour))
+	out := buf.String()
+	for _, want := range []string{
+		"2 agent(s) connected",
+		"NODE", "REMOTE ADDR", "LAST PING",
+		"web-1.internal", "203.0.113.7:51544", "(1h0m0s)", "10m0s ago",
+		"never",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	writeRelayTunnels(&buf, nil, connected)
+	if !strings.Contains(buf.String(), "No agents connected") {
+		t.Errorf("empty output = %q", buf.String())
+	}
+}
+
+func TestRelayHTTPURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		"":               "http://127.0.0.1:9443",
+		":9443":          "http://127.0.0.1:9443",
+		"relay.lan:8443": "http://relay.lan:8443",
+	} {
+		if got := relayHTTPURL(addr); got != want {
+			t.Errorf("relayHTTPURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestTargetPreview(t *testing.T) {
+	ctx := context.Background()
+	store := fleet.NewMemoryStore()
+	for _, n := range []*fleet.Node{
+		{ID: "web-1", Status: fleet.NodeStatusOnline, Labels: map[string]string{"role": "web"}},
+		{ID: "web-2", Status: fleet.NodeStatusOnline, Labels: map[string]string{"role": "web"}},
+		{ID: "web-3", Status: fleet.NodeStatusOffline, Labels: map[string]string{"role": "web"}},
+		{ID: "db-1", Status: fleet.NodeStatusDegraded, Labels: map[string]string{"role": "db"}},
+		{ID: "db-2", Status: fleet.NodeStatusDraining, Labels: map[string]string{"role": "db"}},
+	} {
+		store.RegisterNode(ctx, n)
+	}
+
+	target := func(node, tag string) fleet.TargetSelector {
+		ts, err := buildTarget(node, tag, "", "")
+		if err != nil {
+			t.Fatalf("buildTarget(%q, %q): %v", node, tag, err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name   string
+		target fleet.TargetSelector
+		want   string
+	}{
+		{"all", target("", ""), "matched 5 nodes (3 online, 2 offline)\n"},
+		{"mixed split", target("", "role=web"), "matched 3 nodes (2 online, 1 offline)\n"},
+		{"degraded online, draining offline", target("", "role=db"), "matched 2 nodes (1 online, 1 offline)\n"},
+		{"single node", target("web-3", ""), "matched 1 node (0 online, 1 offline)\n"},
+		{"empty match", target("", "role=cache"), "matched 0 nodes — check the selector\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := previewTarget(ctx, store, tt.target)
+			if err != nil {
+				t.Fatalf("previewTarget() error: %v", err)
+			}
+			var buf bytes.Buffer
+			writeTargetPreview(&buf, p)
+			if buf.String() != tt.want {
+				t.Errorf("preview = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTarget_LabelExpressions(t *testing.T) {
+	target, err := buildTarget("", "role=web,region in (eu-west-1,eu-central-1)", "", "env=prod")
+	if err != nil {
+		t.Fatalf("buildTarget() error: %v", err)
+	}
+	if target.All {
+		t.Error("label selectors should not fall back to all nodes")
+	}
+	if target.Labels["role"] != "web" {
+		t.Errorf("Labels = %v, want role=web shorthand", target.Labels)
+	}
+	want := []fleet.LabelMatcher{
+		{Key: "region", Op: fleet.LabelOpIn, Values: []string{"eu-west-1", "eu-central-1"}},
+	}
+	if !reflect.DeepEqual(target.LabelMatchers, want) {
+		t.Errorf("LabelMatchers = %+v, want %+v", target.LabelMatchers, want)
+	}
+	wantExclude := []fleet.LabelMatcher{{Key: "env", Op: fleet.LabelOpEq, Values: []string{"prod"}}}
+	if !reflect.DeepEqual(target.Exclude, wantExclude) {
+		t.Errorf("Exclude = %+v, want %+v", target.Exclude, wantExclude)
+	}
+
+	if _, err := buildTarget("", "region=~eu-(", "", ""); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+	if _, err := buildTarget("", "", "", "region=~eu-("); err == nil {
+		t.Error("expected an error for an invalid exclude regex")
+	}
+}
+
+func TestDeploySwitchTarget(t *testing.T) {
+	if target, err := deploySwitchTarget(""); err != nil || target != nil {
+		t.Errorf("empty flag = %+v, %v; want nil", target, err)
+	}
+
+	target, err := deploySwitchTarget("lb-1, lb-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target.NodeIDs, []fleet.NodeID{"lb-1", "lb-2"}) || target.All {
+		t.Errorf("node IDs = %+v", target)
+	}
+
+	target, err = deploySwitchTarget("role=lb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Labels["role"] != "lb" || len(target.NodeIDs) != 0 || target.All {
+		t.Errorf("label selector = %+v", target)
+	}
+
+	for _, flag := range []string{"zone notin (us-east-1a,us-east-1b)", "zone in (eu-west-1)"} {
+		target, err = deploySwitchTarget(flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(target.LabelMatchers) != 1 || len(target.NodeIDs) != 0 {
+			t.Errorf("%q = %+v, want one label matcher", flag, target)
+		}
+	}
+
+	if _, err := deploySwitchTarget("role=~lb-("); err == nil || !strings.HasPrefix(err.Error(), "--switch-target: ") {
+		t.Errorf("invalid selector: err = %v, want a --switch-target error", err)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+		hint string
+	}{
+		{errors.New("boom"), 1, ""},
+		{fleet.ErrNoTargetsMatched, exitNoTargets, "only online nodes"},
+		{fmt.Errorf("%w: %w: web-9", fleet.ErrNoTargetsMatched, fleet.ErrNodeNotFound), exitNoTargets, "node list"},
+		{fmt.Errorf("%w: %w: web-1", fleet.ErrNoTargetsMatched, fleet.ErrNodeDraining), exitNoTargets, "draining"},
+		{fmt.Errorf("drain: %w: web-9", fleet.ErrNodeNotFound), exitNodeNotFound, "node list"},
+		{fmt.Errorf("1 node(s) unreachable: %w", fleet.ErrNoTunnel), exitNoTunnel, "not connected"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if code := reportError(&buf, tt.err); code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.err, code, tt.code)
+		}
+		out := buf.String()
+		if !strings.HasPrefix(out, "Error: "+tt.err.Error()+"\n") {
+			t.Errorf("%v: output = %q", tt.err, out)
+		}
+		if hasHint := strings.Contains(out, "Hint: "); hasHint != (tt.hint != "") || !strings.Contains(out, tt.hint) {
+			t.Errorf("%v: output = %q, want hint %q", tt.err, out, tt.hint)
+		}
+	}
+}
+
+func TestWriteExecResult_Unreachable(t *testing.T) {
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-1", Status: "success"},
+			{NodeID: "web-2", Status: "unreachable", Error: "no active tunnel", ExitCode: -1},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Success: 1, Unreachable: 1},
+	}
+	var buf bytes.Buffer
+	if err := writeExecResult(&buf, result, execRenderOptions{}); !errors.Is(err, fleet.ErrNoTunnel) {
+		t.Errorf("err = %v, want fleet.ErrNoTunnel", err)
+	}
+}
+
+func TestTargetEnv(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Fleet.DefaultEnv = "staging"
+	tests := []struct {
+		env, node, want string
+	}{
+		{"", "", "staging"},
+		{"prod", "", "prod"},
+		{"", "web-1", ""},
+		{"prod", "web-1", "prod"},
+	}
+	for _, tt := range tests {
+		if got := targetEnv(cfg, tt.env, tt.node); got != tt.want {
+			t.Errorf("targetEnv(env=%q, node=%q) = %q, want %q", tt.env, tt.node, got, tt.want)
+		}
+	}
+}
+
+func TestExecDispatchRate(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Fleet.DispatchRate = 5
+
+	cmd := newFleetExecCmd()
+	if rate, err := execDispatchRate(cmd, 0, cfg); err != nil || rate != 5 {
+		t.Errorf("default rate = %g, %v; want 5 from config", rate, err)
+	}
+	cmd.Flags().Set("rate", "0")
+	if rate, err := execDispatchRate(cmd, 0, cfg); err != nil || rate != 0 {
+		t.Errorf("--rate 0 = %g, %v; want 0 to override the config", rate, err)
+	}
+	if _, err := execDispatchRate(cmd, -2, cfg); err == nil {
+		t.Error("expected an error for a negative --rate")
+	}
+}
+
+func TestLiveExecView(t *testing.T) {
+	var buf bytes.Buffer
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := newLiveExecView(&buf)
+	v.now = func() time.Time { return clock }
+
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventStarted, NodeID: "web-1", Time: clock})
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventStarted, NodeID: "web-2", Time: clock})
+	clock = clock.Add(3 * time.Second)
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventOutput, NodeID: "web-1", Line: "Unpacking nginx (1.24.0) ..."})
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventFinished, NodeID: "web-2",
+		Result: &fleet.NodeResult{NodeID: "web-2", Status: "failure", Duration: 1500 * time.Millisecond}})
+
+	// The last frame is everything after the final cursor-up.
+	out := buf.String()
+	frame := out[strings.LastIndex(out, "\x1b[3A"):]
+	for _, want := range []string{
+		"⋯ web-1 running 3s  │ Unpacking nginx (1.24.0) ...",
+		"✗ web-2 (1.5s)",
+		"1/2 nodes finished",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame missing %q:\n%q", want, frame)
+		}
+	}
+
+	buf.Reset()
+	v.Clear()
+	if buf.String() != "\x1b[3A\x1b[J" {
+		t.Errorf("Clear() = %q, want cursor up 3 and erase", buf.String())
+	}
+}
+
+func TestLiveExecView_ThrottlesOutput(t *testing.T) {
+	var buf bytes.Buffer
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := newLiveExecView(&buf)
+	v.now = func() time.Time { return clock }
+
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventStarted, NodeID: "web-1", Time: clock})
+	drawn := buf.Len()
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventOutput, NodeID: "web-1", Line: "burst"})
+	if buf.Len() != drawn {
+		t.Error("output within the redraw interval should not redraw")
+	}
+	clock = clock.Add(liveRedrawInterval)
+	v.Apply(fleet.NodeResultEvent{Type: fleet.NodeEventOutput, NodeID: "web-1", Line: "later"})
+	if !strings.Contains(buf.String(), "later") {
+		t.Error("output after the interval should redraw")
+	}
+}
+
+func TestWriteOutputDiff(t *testing.T) {
+	base := "user nginx;\nworker_processes auto;\nevents {}\n"
+	drift := "user nginx;\nworker_processes 4;\nevents {}\n"
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-3", Status: "success", Output: drift},
+			{NodeID: "web-1", Status: "success", Output: base},
+			{NodeID: "web-2", Status: "success", Output: base},
+			{NodeID: "web-4", Status: "failure", Error: "exit status 1"},
+		},
+		Summary: fleet.ExecSummary{Total: 4, Success: 3, Failed: 1},
+	}
+	groups := fleet.GroupOutputs(result.NodeResults)
+	baseHash, driftHash := groups[0].ShortHash(), groups[1].ShortHash()
+
+	var buf bytes.Buffer
+	err := writeOutputDiff(&buf, result, false)
+	if err == nil || err.Error() != "1 node(s) failed" {
+		t.Errorf("err = %v, want 1 node(s) failed", err)
+	}
+	want := "Output Diff — 4 nodes, 2 variant(s)\n\n" +
+		"  [" + baseHash + "] baseline, 2 node(s): web-1, web-2\n\n" +
+		"  [" + driftHash + "] 1 node(s): web-3\n" +
+		"    --- " + baseHash + "\n" +
+		"    +++ " + driftHash + "\n" +
+		"    @@ -1,3 +1,3 @@\n" +
+		"     user nginx;\n" +
+		"    -worker_processes auto;\n" +
+		"    +worker_processes 4;\n" +
+		"     events {}\n" +
+		"\n  No output:\n" +
+		"  ✗ web-4 (failure): exit status 1\n"
+	if buf.String() != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Without failures, drift alone fails the command; identical output passes.
+	result.NodeResults = result.NodeResults[:3]
+	if err := writeOutputDiff(io.Discard, result, false); err == nil || err.Error() != "output differs across nodes: 2 variants" {
+		t.Errorf("err = %v, want drift error", err)
+	}
+	result.NodeResults[0].Output = base
+	if err := writeOutputDiff(io.Discard, result, false); err != nil {
+		t.Errorf("identical outputs: err = %v", err)
+	}
+}
+
+func TestWriteOutputDiff_JSON(t *testing.T) {
+	result := &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "db-1", Status: "success", Output: "max_connections = 100\n"},
+			{NodeID: "db-2", Status: "success", Output: "max_connections = 200\n"},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Success: 2},
+	}
+
+	var buf bytes.Buffer
+	writeOutputDiff(&buf, result, true)
+	var report outputDiffReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(report.Groups) != 2 || !report.Groups[0].Baseline || report.Groups[1].Baseline {
+		t.Fatalf("unexpected groups: %+v", report.Groups)
+	}
+	if report.Groups[0].Diff != "" || !strings.Contains(report.Groups[1].Diff, "+max_connections = 200") {
+		t.Errorf("unexpected diffs: %q / %q", report.Groups[0].Diff, report.Groups[1].Diff)
+	}
+}
+
+func TestFleetExecCommand(t *testing.T) {
+	cmd, err := fleetExecCommand([]string{"df", "-h"}, "", "", false, "")
+	if err != nil || cmd.Type != "shell" {
+		t.Fatalf("shell command = %+v, %v", cmd, err)
+	}
+	var shell fleet.ShellCommand
+	json.Unmarshal(cmd.Data, &shell)
+	if shell.Command != "df -h" {
+		t.Errorf("command = %q, want df -h", shell.Command)
+	}
+
+	path := filepath.Join(t.TempDir(), "setup.sh")
+	os.WriteFile(path, []byte("set -e\napt-get update\n"), 0o644)
+	cmd, err = fleetExecCommand(nil, path, "bash", false, "")
+	if err != nil || cmd.Type != "script" {
+		t.Fatalf("script command = %+v, %v", cmd, err)
+	}
+	var sc fleet.ScriptCommand
+	json.Unmarshal(cmd.Data, &sc)
+	script, _ := sc.Script()
+	if sc.Interpreter != "bash" || string(script) != "set -e\napt-get update\n" {
+		t.Errorf("script command = %+v (%q)", sc, script)
+	}
+
+	if _, err := fleetExecCommand([]string{"uptime"}, "", "bash", false, ""); err == nil || !strings.Contains(err.Error(), "--interpreter requires --file") {
+		t.Errorf("err = %v, want --interpreter requires --file", err)
+	}
+	if _, err := fleetExecCommand(nil, filepath.Join(t.TempDir(), "missing.sh"), "", false, ""); err == nil {
+		t.Error("expected an error for a missing script")
+	}
+	if _, err := fleetExecCommand(nil, path, "", true, ""); err == nil || !strings.Contains(err.Error(), "--sudo cannot be used with --file") {
+		t.Errorf("err = %v, want --sudo cannot be used with --file", err)
+	}
+}
+
+func TestShellExecCommand_Sudo(t *testing.T) {
+	cmd, err := shellExecCommand([]string{"systemctl", "restart", "nginx"}, true, "deploy")
+	if err != nil {
+		t.Fatalf("shellExecCommand: %v", err)
+	}
+	var shell fleet.ShellCommand
+	json.Unmarshal(cmd.Data, &shell)
+	if !shell.Sudo || shell.SudoUser != "deploy" || shell.Command != "systemctl restart nginx" {
+		t.Errorf("shell command = %+v", shell)
+	}
+
+	if _, err := shellExecCommand([]string{"id"}, false, "deploy"); err == nil || !strings.Contains(err.Error(), "--sudo-user requires --sudo") {
+		t.Errorf("err = %v, want --sudo-user requires --sudo", err)
+	}
+}
+
+func TestExecBatchPolicy(t *testing.T) {
+	policy, err := execBatchPolicy(0, 10, true)
+	if err != nil || policy == nil || policy.Percent != 10 || !policy.HaltOnError {
+		t.Fatalf("policy = %+v, %v", policy, err)
+	}
+	if policy, err := execBatchPolicy(0, 0, false); policy != nil || err != nil {
+		t.Errorf("no batching = %+v, %v; want nil, nil", policy, err)
+	}
+	if _, err := execBatchPolicy(0, 0, true); err == nil || !strings.Contains(err.Error(), "--halt-on-error requires") {
+		t.Errorf("err = %v, want --halt-on-error requires a batch flag", err)
+	}
+	for _, tc := range [][2]int{{2, 10}, {0, 150}, {-1, 0}} {
+		if _, err := execBatchPolicy(tc[0], tc[1], false); err == nil {
+			t.Errorf("execBatchPolicy(%d, %d) succeeded, want an error", tc[0], tc[1])
+		}
+	}
+}
+
+func TestWriteCostReport(t *testing.T) {
+	date := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+	day := &observability.DailyCost{Models: map[string]*observability.ModelUsage{
+		"gpt-4o-mini": {Calls: 4, PromptTokens: 8000, CompletionTokens: 1000, CostUSD: 0.0018},
+		"gpt-4o":      {Calls: 2, PromptTokens: 20000, CompletionTokens: 4000, CostUSD: 0.09},
+		"llama3":      {Calls: 1, PromptTokens: 100, CompletionTokens: 50, Unpriced: true},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeCostReport(&buf, date, day, false); err != nil {
+		t.Fatalf("writeCostReport: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "LLM spend today (2026-03-01): $0.0918") {
+		t.Errorf("missing total:\n%s", out)
+	}
+	if strings.Index(out, "gpt-4o ") > strings.Index(out, "gpt-4o-mini") {
+		t.Errorf("models not ordered by cost:\n%s", out)
+	}
+	if !strings.Contains(out, "unpriced") {
+		t.Errorf("unpriced model not marked:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := writeCostReport(&buf, date, day, true); err != nil {
+		t.Fatalf("writeCostReport json: %v", err)
+	}
+	var doc struct {
+		Date     string                               `json:"date"`
+		TotalUSD float64                              `json:"total_usd"`
+		Models   map[string]*observability.ModelUsage `json:"models"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+	}
+	if doc.Date != "2026-03-01" || doc.Models["gpt-4o"].Calls != 2 {
+		t.Errorf("json report = %+v", doc)
+	}
+
+	buf.Reset()
+	empty := &observability.DailyCost{Models: map[string]*observability.ModelUsage{}}
+	if err := writeCostReport(&buf, date, empty, false); err != nil {
+		t.Fatalf("writeCostReport: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No LLM usage recorded") {
+		t.Errorf("empty report = %q", buf.String())
+	}
+}
+
+func TestSkillInstallSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "vault", "source": "acme/skills/vault"}]`))
+	}))
+	defer srv.Close()
+	index := skills.NewSkillIndex(srv.URL, "", 0)
+	ctx := context.Background()
+
+	for arg, want := range map[string]string{
+		"vault":                                 "acme/skills/vault",
+		"freitascorp/devopsclaw-skills/weather": "freitascorp/devopsclaw-skills/weather",
+	} {
+		got, err := skillInstallSource(ctx, index, arg)
+		if err != nil || got != want {
+			t.Errorf("skillInstallSource(%q) = %q, %v; want %q", arg, got, err, want)
+		}
+	}
+	if _, err := skillInstallSource(ctx, index, "ansible"); err == nil {
+		t.Error("a name missing from the index should not resolve")
+	}
+}
+
+// Test that logging out edits only the base config, without copying the
+// active profile's values into it.
+func TestClearAuthMethods_KeepsProfileOutOfBaseConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(config.ProfileEnvVar, "prod")
+	dir := filepath.Join(home, ".devopsclaw")
+	if err := os.MkdirAll(filepath.Join(dir, "profiles"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+		"model_list": [{"model_name": "gpt-5.2", "model": "openai/gpt-5.2", "auth_method": "oauth"}]
+	}`), 0o600)
+	os.WriteFile(config.ProfilePath(dir, "prod"), []byte(`{"relay": {"auth_token": "prod-token"}}`), 0o600)
+
+	if err := clearAuthMethods("openai"); err != nil {
+		t.Fatalf("clearAuthMethods: %v", err)
+	}
+	saved, err := config.LoadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ModelList[0].AuthMethod != "" {
+		t.Errorf("auth_method = %q, want cleared", saved.ModelList[0].AuthMethod)
+	}
+	if saved.Relay.AuthToken != "" {
+		t.Errorf("base config picked up the profile's auth_token %q", saved.Relay.AuthToken)
+	}
+}
+
+// Test that the gateway's fleet_exec tool reaches an agent that connects
+// to the relay the gateway serves.
+func TestStartGatewayFleet_DispatchesToConnectedAgent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Fleet.Store = "sqlite"
+	cfg.Fleet.SQLitePath = filepath.Join(t.TempDir(), "fleet.db")
+	cfg.Relay.ListenAddr = addr
+	slogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	executor, stop, err := startGatewayFleet(ctx, cfg, slogger)
+	if err != nil {
+		t.Fatalf("startGatewayFleet: %v", err)
+	}
+	defer stop()
+
+	agent := relay.NewWSAgent(relay.AgentConfig{
+		NodeID:            "gw-node",
+		RelayAddr:         "ws://" + addr,
+		ReconnectInterval: 50 * time.Millisecond,
+	}, relay.NewShellExecutor(""), slogger)
+	go agent.Run(ctx)
+	defer agent.Stop()
+
+	typed := contracts.NewRegistry()
+	fleet.RegisterExecContract(typed, executor)
+	for {
+		out, err := typed.ExecuteContext(ctx, "fleet_exec", json.RawMessage(`{"command": "echo hello", "targets": ["gw-node"]}`))
+		if err == nil {
+			var resp contracts.FleetExecResponse
+			if err := json.Unmarshal(out, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Success != 1 || strings.TrimSpace(resp.Results[0].Output) != "hello" {
+				t.Fatalf("response = %+v, want hello from gw-node", resp)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("fleet_exec never reached the agent: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestSetBrowseCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(path, []byte("Cookie: sid=abc; theme=dark"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const site = "https://grafana.example.com"
+
+	cfg := config.DefaultConfig()
+	cfg.Browser.Enabled = false
+	if _, err := setBrowseCookies(cfg, path, site); err == nil {
+		t.Fatal("expected an error when the browser tool is disabled")
+	}
+
+	cfg.Browser.Enabled = true
+	n, err := setBrowseCookies(cfg, path, site)
+	if err != nil {
+		t.Fatalf("setBrowseCookies() error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("cookies = %d, want 2", n)
+	}
+	if cfg.Browser.CookiesFrom != path || cfg.Browser.CookiesURL != site {
+		t.Errorf("browser config = %q/%q, want %q/%q", cfg.Browser.CookiesFrom, cfg.Browser.CookiesURL, path, site)
+	}
+	if v := os.Getenv("DEVOPSCLAW_BROWSER_COOKIES_FROM"); v != "" {
+		t.Errorf("DEVOPSCLAW_BROWSER_COOKIES_FROM = %q, want it left unset", v)
+	}
+}
+
+func TestAgentFleetStatus_ReadsSharedStore(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.Fleet.Enabled = true
+	cfg.Fleet.Store = "memory"
+	if poll, _ := agentFleetStatus(cfg); poll != nil {
+		t.Fatal("expected no fleet status over an in-memory store")
+	}
+
+	// The relay, e.g. in the gateway, records a node in the shared store.
+	cfg.Fleet.Store = "sqlite"
+	cfg.Fleet.SQLitePath = filepath.Join(t.TempDir(), "fleet.db")
+	store, err := openFleetStore(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("openFleetStore() error: %v", err)
+	}
+	defer closeFleetStore(store)
+	if err := store.RegisterNode(ctx, &fleet.Node{ID: "web-1", Status: fleet.NodeStatusOnline}); err != nil {
+		t.Fatal(err)
+	}
+
+	poll, closeStore := agentFleetStatus(cfg)
+	if poll == nil {
+		t.Fatal("expected a fleet status source over the sqlite store")
+	}
+	defer closeStore()
+	summary, err := poll(ctx)
+	if err != nil {
+		t.Fatalf("poll() error: %v", err)
+	}
+	if summary.Online != 1 {
+		t.Errorf("online = %d, want 1", summary.Online)
+	}
+}
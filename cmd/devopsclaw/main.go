@@ -97,8 +97,7 @@ func copyDirectory(src, dst string) error {
 func main() {
 	rootCmd := newRootCmd()
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(reportError(os.Stderr, err))
 	}
 }
 
@@ -108,5 +107,9 @@ func getConfigPath() string {
 }
 
 func loadConfig() (*config.Config, error) {
-	return config.LoadConfig(getConfigPath())
+	profile, err := resolveProfile()
+	if err != nil {
+		return nil, err
+	}
+	return config.LoadProfile(getConfigPath(), profile)
 }
@@ -16,11 +16,16 @@ import (
 
 type ContextBuilder struct {
 	workspace    string
+	projectDir   string // project-scoped .devopsclaw/ directory, if any
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
 }
 
+// projectConfigDirName is the per-project config folder discovered by
+// walking up from the working directory, like git does for .git.
+const projectConfigDirName = ".devopsclaw"
+
 func getGlobalConfigDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -29,16 +34,54 @@ func getGlobalConfigDir() string {
 	return filepath.Join(home, ".devopsclaw")
 }
 
+// findProjectConfigDir walks up from start looking for a .devopsclaw/
+// directory and returns its path, or "" if the filesystem root is reached
+// without a match. The global config dir is skipped so that running from
+// somewhere under $HOME does not treat ~/.devopsclaw as a project.
+func findProjectConfigDir(start, globalDir string) string {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return ""
+	}
+	globalDir = filepath.Clean(globalDir)
+
+	for {
+		candidate := filepath.Join(dir, projectConfigDirName)
+		if candidate != globalDir {
+			if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+				return candidate
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
 func NewContextBuilder(workspace string) *ContextBuilder {
 	// builtin skills: skills directory in current project
 	// Use the skills/ directory under the current working directory
 	wd, _ := os.Getwd()
 	builtinSkillsDir := filepath.Join(wd, "skills")
-	globalSkillsDir := filepath.Join(getGlobalConfigDir(), "skills")
+	globalDir := getGlobalConfigDir()
+	globalSkillsDir := filepath.Join(globalDir, "skills")
+
+	skillsLoader := skills.NewSkillsLoader(workspace, globalSkillsDir, builtinSkillsDir)
+	projectDir := ""
+	if wd != "" {
+		projectDir = findProjectConfigDir(wd, globalDir)
+	}
+	if projectDir != "" {
+		skillsLoader.SetProjectSkills(filepath.Join(projectDir, "skills"))
+		logger.DebugCF("agent", "Using project config dir", map[string]any{"path": projectDir})
+	}
 
 	return &ContextBuilder{
 		workspace:    workspace,
-		skillsLoader: skills.NewSkillsLoader(workspace, globalSkillsDir, builtinSkillsDir),
+		projectDir:   projectDir,
+		skillsLoader: skillsLoader,
 		memory:       NewMemoryStore(workspace),
 	}
 }
@@ -80,7 +123,7 @@ Your workspace is at: %s
 
 2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
 
-3. **Memory** - When interacting with me if something seems memorable, update %s/memory/MEMORY.md`,
+3. **Memory** - When interacting with me if something seems memorable, update %s/memory/MEMORY.md. Use memory_search to look up older notes and decisions that aren't shown below.`,
 		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
 }
 
@@ -154,6 +197,14 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 		if data, err := os.ReadFile(filePath); err == nil {
 			fmt.Fprintf(&sb, "## %s\n\n%s\n\n", filename, data)
 		}
+		// Project files are appended after the workspace ones so per-repo
+		// instructions refine rather than replace the global setup.
+		if cb.projectDir != "" {
+			filePath := filepath.Join(cb.projectDir, filename)
+			if data, err := os.ReadFile(filePath); err == nil {
+				fmt.Fprintf(&sb, "## %s (project)\n\n%s\n\n", filename, data)
+			}
+		}
 	}
 
 	return sb.String()
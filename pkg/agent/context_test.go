@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindProjectConfigDir_WalksUp(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, ".devopsclaw")
+	nested := filepath.Join(root, "services", "api", "handlers")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := findProjectConfigDir(nested, "")
+	if got != project {
+		t.Errorf("findProjectConfigDir = %q, want %q", got, project)
+	}
+}
+
+func TestFindProjectConfigDir_NearestWins(t *testing.T) {
+	root := t.TempDir()
+	inner := filepath.Join(root, "monorepo", "svc")
+	for _, dir := range []string{
+		filepath.Join(root, ".devopsclaw"),
+		filepath.Join(inner, ".devopsclaw"),
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := findProjectConfigDir(inner, "")
+	if want := filepath.Join(inner, ".devopsclaw"); got != want {
+		t.Errorf("findProjectConfigDir = %q, want %q", got, want)
+	}
+}
+
+func TestFindProjectConfigDir_NoMatchAtRoot(t *testing.T) {
+	start := filepath.Join(t.TempDir(), "a", "b")
+	if err := os.MkdirAll(start, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findProjectConfigDir(start, ""); got != "" {
+		t.Errorf("expected no project dir, got %q", got)
+	}
+}
+
+func TestFindProjectConfigDir_SkipsGlobalDir(t *testing.T) {
+	home := t.TempDir()
+	global := filepath.Join(home, ".devopsclaw")
+	start := filepath.Join(home, "code", "repo")
+	if err := os.MkdirAll(global, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(start, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findProjectConfigDir(start, global); got != "" {
+		t.Errorf("global config dir should not be treated as a project, got %q", got)
+	}
+}
+
+func TestFindProjectConfigDir_IgnoresFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".devopsclaw"), []byte("not a dir"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findProjectConfigDir(root, ""); got != "" {
+		t.Errorf("expected a plain file to be ignored, got %q", got)
+	}
+}
+
+func TestContextBuilder_MergesProjectBootstrapAndSkills(t *testing.T) {
+	workspace := t.TempDir()
+	project := filepath.Join(t.TempDir(), ".devopsclaw")
+	skillDir := filepath.Join(project, "skills", "repo-deploy")
+	if err := os.MkdirAll(skillDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(workspace, "AGENTS.md"), []byte("global agent rules"), 0o644)
+	os.WriteFile(filepath.Join(project, "AGENTS.md"), []byte("repo agent rules"), 0o644)
+	os.WriteFile(filepath.Join(skillDir, "SKILL.md"),
+		[]byte("---\nname: repo-deploy\ndescription: Deploys this repo\n---\n# Deploy"), 0o644)
+
+	cb := NewContextBuilder(workspace)
+	cb.projectDir = project
+	cb.skillsLoader.SetProjectSkills(filepath.Join(project, "skills"))
+
+	bootstrap := cb.LoadBootstrapFiles()
+	if !strings.Contains(bootstrap, "global agent rules") || !strings.Contains(bootstrap, "repo agent rules") {
+		t.Errorf("expected both workspace and project AGENTS.md, got:\n%s", bootstrap)
+	}
+	if strings.Index(bootstrap, "global agent rules") > strings.Index(bootstrap, "repo agent rules") {
+		t.Error("project bootstrap should follow the workspace one")
+	}
+
+	found := false
+	for _, s := range cb.skillsLoader.ListSkills() {
+		if s.Name == "repo-deploy" {
+			found = true
+			if s.Source != "project" {
+				t.Errorf("Source = %q, want project", s.Source)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected project skill to be listed")
+	}
+}
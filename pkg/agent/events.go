@@ -21,6 +21,10 @@ const (
 	EventResponse
 	// EventError signals an error during processing.
 	EventError
+	// EventResponseDelta carries a chunk of response text in Content as a
+	// streaming provider produces it. The chunks of an iteration add up to
+	// its response; EventResponse still follows with the final text.
+	EventResponseDelta
 )
 
 // AgentEvent represents a single event during the agentic loop.
@@ -43,7 +47,7 @@ type AgentEvent struct {
 	// Denial reason (EventToolDenied)
 	DenyReason string
 
-	// Response/error content (EventResponse, EventError)
+	// Response/error content (EventResponse, EventResponseDelta, EventError)
 	Content string
 
 	// Token usage — cumulative across all iterations
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -21,9 +22,12 @@ import (
 	"github.com/freitascorp/devopsclaw/pkg/channels"
 	"github.com/freitascorp/devopsclaw/pkg/config"
 	"github.com/freitascorp/devopsclaw/pkg/constants"
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
 	"github.com/freitascorp/devopsclaw/pkg/logger"
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 	"github.com/freitascorp/devopsclaw/pkg/providers"
 	"github.com/freitascorp/devopsclaw/pkg/rbac"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 	"github.com/freitascorp/devopsclaw/pkg/routing"
 	"github.com/freitascorp/devopsclaw/pkg/skills"
 	"github.com/freitascorp/devopsclaw/pkg/state"
@@ -39,12 +43,16 @@ type AgentLoop struct {
 	running        atomic.Bool
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
+	breakers       *providers.ProviderBreakers // nil when disabled in config
 	channelManager *channels.Manager
 	toolGuard       *rbac.ToolGuard
 	confirmCb       ToolConfirmCallback
 	eventCb         EventCallback
 	sessionAllowed  map[string]bool // tools the user allowed for the whole session
 	totalUsage     usageAccumulator
+	costs          *observability.CostTracker // nil when cost accounting is off
+	tracer         *observability.Tracer      // nil when tracing is off
+	taskHistory    observability.TaskStore    // nil when task history is off
 }
 
 // ConfirmResult represents the user's decision on a tool confirmation prompt.
@@ -68,6 +76,8 @@ var toolsRequiringConfirmation = map[string]bool{
 	"edit_file":  true,
 	"append_file": true,
 	"browser":    true,
+	"docker":     true,
+	"fleet_exec": true,
 }
 
 // processOptions configures how a message is processed
@@ -92,6 +102,14 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Set up shared fallback chain
 	cooldown := providers.NewCooldownTracker()
 	fallbackChain := providers.NewFallbackChain(cooldown)
+	var breakers *providers.ProviderBreakers
+	if cb := cfg.Agents.Defaults.CircuitBreaker; !cb.Disabled {
+		breakers = providers.NewProviderBreakers(resilience.CircuitBreakerConfig{
+			MaxFailures:  cb.MaxFailures,
+			ResetTimeout: time.Duration(cb.ResetTimeoutSec) * time.Second,
+		})
+		fallbackChain.SetBreakers(breakers)
+	}
 
 	// Create state manager using default agent's workspace for channel recording
 	defaultAgent := registry.GetDefaultAgent()
@@ -122,6 +140,7 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		state:          stateManager,
 		summarizing:    sync.Map{},
 		fallback:       fallbackChain,
+		breakers:       breakers,
 		toolGuard:      toolGuard,
 		sessionAllowed: make(map[string]bool),
 	}
@@ -135,6 +154,81 @@ func (al *AgentLoop) SetConfirmCallback(cb ToolConfirmCallback) {
 	al.confirmCb = cb
 }
 
+// SetMetrics reports provider fallbacks and circuit breaker trips to
+// metrics. Call it before Run.
+func (al *AgentLoop) SetMetrics(metrics *observability.DevOpsClawMetrics) {
+	al.fallback.SetMetrics(metrics)
+	if al.breakers != nil {
+		al.breakers.SetMetrics(metrics)
+	}
+}
+
+// SetCostTracker reports the token usage of every provider response to
+// costs. Call it before Run.
+func (al *AgentLoop) SetCostTracker(costs *observability.CostTracker) {
+	al.costs = costs
+}
+
+// SetTracer records a span for every processed message, LLM call and tool
+// call on tracer. Call it before Run.
+func (al *AgentLoop) SetTracer(tracer *observability.Tracer) {
+	al.tracer = tracer
+}
+
+// startSpan starts a span on the tracer, if any, and returns the context
+// carrying it and a func that ends it with the operation's error.
+func (al *AgentLoop) startSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, func(error)) {
+	if al.tracer == nil {
+		return ctx, func(error) {}
+	}
+	ctx, span := al.tracer.StartSpan(ctx, name, attrs)
+	return ctx, func(err error) { al.tracer.EndSpan(span, err) }
+}
+
+// SetTaskHistory records every tool call, with its arguments and result,
+// to history for replay and debugging. Call it before Run.
+func (al *AgentLoop) SetTaskHistory(history observability.TaskStore) {
+	al.taskHistory = history
+}
+
+// recordTask adds one tool call to the task history, if any.
+func (al *AgentLoop) recordTask(ctx context.Context, agent *AgentInstance, opts processOptions, tc providers.ToolCall, result *tools.ToolResult, start time.Time) {
+	if al.taskHistory == nil {
+		return
+	}
+	input, _ := json.Marshal(tc.Arguments)
+	output, _ := json.Marshal(result.ForLLM)
+	rec := &observability.TaskRecord{
+		ID:        tc.ID,
+		UserID:    opts.SenderID,
+		Channel:   opts.Channel,
+		AgentID:   agent.ID,
+		Action:    "tool_exec",
+		Input:     input,
+		Output:    output,
+		Duration:  time.Since(start),
+		Timestamp: start,
+		Metadata:  map[string]string{"tool": tc.Name, "session": opts.SessionKey},
+	}
+	if span := observability.SpanFromContext(ctx); span != nil {
+		rec.TraceID = span.TraceID
+	}
+	if result.Err != nil {
+		rec.Error = result.Err.Error()
+	}
+	al.taskHistory.Record(rec)
+}
+
+// recordCost reports one response's usage to the cost tracker, if any.
+func (al *AgentLoop) recordCost(model string, usage *providers.UsageInfo) {
+	if al.costs == nil || usage == nil {
+		return
+	}
+	if _, err := al.costs.Record(model, usage.PromptTokens, usage.CompletionTokens); err != nil {
+		logger.WarnCF("agent", "Failed to record LLM cost", map[string]any{"model": model, "error": err.Error()})
+	}
+}
+
 // SetEventCallback registers a callback for real-time agent loop events.
 // This enables Claude Code–style visibility into tool calls and iterations.
 func (al *AgentLoop) SetEventCallback(cb EventCallback) {
@@ -177,6 +271,13 @@ func registerSharedTools(
 	registry *AgentRegistry,
 	provider providers.LLMProvider,
 ) {
+	var dockerTool *tools.ContractTool
+	if cfg.Tools.Docker.Enabled {
+		typed := contracts.NewRegistry()
+		contracts.RegisterDocker(typed)
+		dockerTool = tools.NewContractTool(typed, "docker")
+	}
+
 	for _, agentID := range registry.ListAgentIDs() {
 		agent, ok := registry.GetAgent(agentID)
 		if !ok {
@@ -208,10 +309,32 @@ func registerSharedTools(
 
 		// Browser automation tool — register when enabled
 		if cfg.Browser.Enabled {
-			browserTool := browser.NewBrowserTool(&browser.ManagerConfig{
-				Headless: cfg.Browser.Headless,
-			})
-			agent.Tools.Register(browserTool)
+			browserCfg := &browser.ManagerConfig{
+				Headless:      cfg.Browser.Headless,
+				ActionRetries: cfg.Browser.ActionRetries,
+				RetryBackoff:  time.Duration(cfg.Browser.RetryBackoffMS) * time.Millisecond,
+
+				ProxyServer:       cfg.Browser.ProxyServer,
+				ProxyBypass:       cfg.Browser.ProxyBypass,
+				BasicAuthOrigin:   cfg.Browser.BasicAuthOrigin,
+				BasicAuthUser:     cfg.Browser.BasicAuthUser,
+				BasicAuthPassword: cfg.Browser.BasicAuthPassword,
+			}
+			if cfg.Browser.CookiesFrom != "" {
+				cookies, err := browser.LoadCookiesFile(cfg.Browser.CookiesFrom, cfg.Browser.CookiesURL)
+				if err != nil {
+					logger.WarnCF("agent", "Failed to load browser cookies",
+						map[string]any{"path": cfg.Browser.CookiesFrom, "error": err.Error()})
+				} else {
+					browserCfg.Cookies = cookies
+				}
+			}
+			agent.Tools.Register(browser.NewBrowserTool(browserCfg))
+		}
+
+		// Docker tool — register when enabled
+		if dockerTool != nil {
+			agent.Tools.Register(dockerTool)
 		}
 
 		// Message tool
@@ -378,7 +501,13 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 	})
 }
 
-func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (_ string, err error) {
+	ctx, endSpan := al.startSpan(ctx, "agent.message", map[string]string{
+		"channel":   msg.Channel,
+		"sender_id": msg.SenderID,
+	})
+	defer func() { endSpan(err) }()
+
 	// Add message preview to log (show full content for error messages)
 	var logContent string
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
@@ -405,6 +534,30 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Route to determine agent and session key
+	agent, sessionKey, route := al.resolveSession(msg)
+
+	logger.InfoCF("agent", "Routed message",
+		map[string]any{
+			"agent_id":    agent.ID,
+			"session_key": sessionKey,
+			"matched_by":  route.MatchedBy,
+		})
+
+	return al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         msg.Channel,
+		ChatID:          msg.ChatID,
+		SenderID:        msg.SenderID,
+		UserMessage:     msg.Content,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		SendResponse:    false,
+	})
+}
+
+// resolveSession routes msg to the agent that handles it and the session
+// key its conversation is stored under.
+func (al *AgentLoop) resolveSession(msg bus.InboundMessage) (*AgentInstance, string, routing.ResolvedRoute) {
 	route := al.registry.ResolveRoute(routing.RouteInput{
 		Channel:    msg.Channel,
 		AccountID:  msg.Metadata["account_id"],
@@ -424,24 +577,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
 		sessionKey = msg.SessionKey
 	}
-
-	logger.InfoCF("agent", "Routed message",
-		map[string]any{
-			"agent_id":    agent.ID,
-			"session_key": sessionKey,
-			"matched_by":  route.MatchedBy,
-		})
-
-	return al.runAgentLoop(ctx, agent, processOptions{
-		SessionKey:      sessionKey,
-		Channel:         msg.Channel,
-		ChatID:          msg.ChatID,
-		SenderID:        msg.SenderID,
-		UserMessage:     msg.Content,
-		DefaultResponse: "I've completed processing but have no response to give.",
-		EnableSummary:   true,
-		SendResponse:    false,
-	})
+	return agent, sessionKey, route
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -597,14 +733,20 @@ func (al *AgentLoop) runLLMIteration(
 	toolCallCounts := make(map[string]int) // key = "toolName:argsJSON"
 	const maxToolRepeat = 3
 
-	for iteration < agent.MaxIterations {
+	maxIter := agent.MaxIterations
+	if n := agent.Sessions.GetMaxToolIterations(opts.SessionKey); n > 0 {
+		maxIter = n
+	}
+	answered := false
+
+	for iteration < maxIter {
 		iteration++
 
 		// Emit thinking event — the UI can show a spinner or iteration counter
 		al.emit(AgentEvent{
 			Type:      EventThinking,
 			Iteration: iteration,
-			MaxIter:   agent.MaxIterations,
+			MaxIter:   maxIter,
 			Model:     agent.Model,
 		})
 
@@ -612,7 +754,7 @@ func (al *AgentLoop) runLLMIteration(
 			map[string]any{
 				"agent_id":  agent.ID,
 				"iteration": iteration,
-				"max":       agent.MaxIterations,
+				"max":       maxIter,
 			})
 
 		// Build tool definitions
@@ -643,7 +785,23 @@ func (al *AgentLoop) runLLMIteration(
 		var response *providers.LLMResponse
 		var err error
 
-		callLLM := func() (*providers.LLMResponse, error) {
+		// Stream response text to the UI when the provider supports it.
+		llmCtx := ctx
+		if al.eventCb != nil {
+			llmCtx = providers.WithTokenCallback(ctx, func(delta string) {
+				al.emit(AgentEvent{Type: EventResponseDelta, Iteration: iteration, Content: delta})
+			})
+		}
+
+		// The model that answered, for cost accounting.
+		usedModel := agent.Model
+		callLLM := func() (_ *providers.LLMResponse, err error) {
+			ctx, endSpan := al.startSpan(llmCtx, "agent.llm", map[string]string{
+				"agent": agent.ID,
+				"model": agent.Model,
+			})
+			defer func() { endSpan(err) }()
+			usedModel = agent.Model
 			if len(agent.Candidates) > 1 && al.fallback != nil {
 				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
 					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
@@ -661,6 +819,9 @@ func (al *AgentLoop) runLLMIteration(
 						fbResult.Provider, fbResult.Model, len(fbResult.Attempts)+1),
 						map[string]any{"agent_id": agent.ID, "iteration": iteration})
 				}
+				if fbResult.Model != "" {
+					usedModel = fbResult.Model
+				}
 				return fbResult.Response, nil
 			}
 			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]any{
@@ -726,10 +887,12 @@ func (al *AgentLoop) runLLMIteration(
 
 		// Accumulate token usage
 		al.totalUsage.Add(response.Usage)
+		al.recordCost(usedModel, response.Usage)
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
+			answered = true
 			al.emit(AgentEvent{
 				Type:             EventResponse,
 				Iteration:        iteration,
@@ -928,14 +1091,18 @@ func (al *AgentLoop) runLLMIteration(
 				}
 			}
 
+			toolStart := time.Now()
+			toolCtx, endToolSpan := al.startSpan(ctx, "agent.tool", map[string]string{"tool": tc.Name})
 			toolResult := agent.Tools.ExecuteWithContext(
-				ctx,
+				toolCtx,
 				tc.Name,
 				tc.Arguments,
 				opts.Channel,
 				opts.ChatID,
 				asyncCallback,
 			)
+			al.recordTask(toolCtx, agent, opts, tc, toolResult, toolStart)
+			endToolSpan(toolResult.Err)
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -979,9 +1146,37 @@ func (al *AgentLoop) runLLMIteration(
 		}
 	}
 
+	// The model was still calling tools when the cap ran out. Stop here
+	// rather than keep spending tokens, and say so instead of returning
+	// the generic default response.
+	if !answered {
+		finalContent = toolLimitMessage(maxIter)
+		logger.WarnCF("agent", "Reached tool-call iteration limit",
+			map[string]any{
+				"agent_id":    agent.ID,
+				"session_key": opts.SessionKey,
+				"max":         maxIter,
+			})
+		al.emit(AgentEvent{
+			Type:             EventResponse,
+			Iteration:        iteration,
+			MaxIter:          maxIter,
+			Content:          finalContent,
+			PromptTokens:     al.totalUsage.PromptTokens,
+			CompletionTokens: al.totalUsage.CompletionTokens,
+			TotalTokens:      al.totalUsage.TotalTokens,
+		})
+	}
+
 	return finalContent, iteration, nil
 }
 
+// toolLimitMessage is the reply when a turn hits the tool-call iteration cap.
+func toolLimitMessage(maxIter int) string {
+	return fmt.Sprintf("Reached tool-call limit (%d iterations) before finishing. "+
+		"Ask me to continue, or raise the limit with /set max-iterations <n>.", maxIter)
+}
+
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
@@ -1220,6 +1415,7 @@ func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
 			},
 		)
 		if err == nil {
+			al.recordCost(agent.Model, resp.Usage)
 			finalSummary = resp.Content
 		} else {
 			finalSummary = s1 + " " + s2
@@ -1272,6 +1468,7 @@ func (al *AgentLoop) summarizeBatch(
 	if err != nil {
 		return "", err
 	}
+	al.recordCost(agent.Model, response.Usage)
 	return response.Content, nil
 }
 
@@ -1372,6 +1569,35 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		default:
 			return fmt.Sprintf("Unknown switch target: %s", target), true
 		}
+
+	case "/clear":
+		agent, sessionKey, _ := al.resolveSession(msg)
+		if agent == nil {
+			return "No default agent configured", true
+		}
+		agent.Sessions.SetHistory(sessionKey, nil)
+		agent.Sessions.SetSummary(sessionKey, "")
+		agent.Sessions.Save(sessionKey)
+		return "Conversation history cleared", true
+
+	case "/set":
+		if len(args) != 2 || args[0] != "max-iterations" {
+			return "Usage: /set max-iterations <n>  (0 restores the default)", true
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Sprintf("Invalid iteration limit: %s", args[1]), true
+		}
+		agent, sessionKey, _ := al.resolveSession(msg)
+		if agent == nil {
+			return "No default agent configured", true
+		}
+		agent.Sessions.SetMaxToolIterations(sessionKey, n)
+		agent.Sessions.Save(sessionKey)
+		if n == 0 {
+			return fmt.Sprintf("Tool-call limit reset to the default (%d) for this session", agent.MaxIterations), true
+		}
+		return fmt.Sprintf("Tool-call limit set to %d for this session", n), true
 	}
 
 	return "", false
@@ -3,13 +3,18 @@ package agent
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/freitascorp/devopsclaw/pkg/bus"
 	"github.com/freitascorp/devopsclaw/pkg/config"
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 	"github.com/freitascorp/devopsclaw/pkg/providers"
 	"github.com/freitascorp/devopsclaw/pkg/tools"
 )
@@ -631,3 +636,315 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// loopingMockProvider never stops asking for tools. Each call uses new
+// arguments so the repetition detector doesn't break the loop first.
+type loopingMockProvider struct {
+	calls atomic.Int32
+}
+
+func (m *loopingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	n := m.calls.Add(1)
+	return &providers.LLMResponse{
+		ToolCalls: []providers.ToolCall{{
+			ID:        fmt.Sprintf("call-%d", n),
+			Name:      "mock_custom",
+			Arguments: map[string]any{"attempt": n},
+		}},
+	}, nil
+}
+
+func (m *loopingMockProvider) GetDefaultModel() string {
+	return "mock-loop-model"
+}
+
+func newLoopingAgent(t *testing.T, maxIter int) (*AgentLoop, *loopingMockProvider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: maxIter,
+			},
+		},
+	}
+	provider := &loopingMockProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.RegisterTool(&mockCustomTool{})
+	return al, provider
+}
+
+func TestAgentLoop_ToolCallLimitStopsRunawayLoop(t *testing.T) {
+	al, provider := newLoopingAgent(t, 5)
+
+	var maxIterSeen int
+	al.SetEventCallback(func(ev AgentEvent) {
+		if ev.Type == EventThinking {
+			maxIterSeen = ev.MaxIter
+		}
+	})
+
+	response, err := al.ProcessDirect(context.Background(), "loop forever", "agent:main:loop")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if got := provider.calls.Load(); got != 5 {
+		t.Errorf("provider called %d times, want 5", got)
+	}
+	if maxIterSeen != 5 {
+		t.Errorf("EventThinking MaxIter = %d, want 5", maxIterSeen)
+	}
+	if response != toolLimitMessage(5) {
+		t.Errorf("response = %q, want the tool-call limit message", response)
+	}
+}
+
+func TestAgentLoop_ToolCallLimitSessionOverride(t *testing.T) {
+	al, provider := newLoopingAgent(t, 50)
+	ctx := context.Background()
+	sessionKey := "agent:main:override"
+
+	reply, err := al.ProcessDirect(ctx, "/set max-iterations 3", sessionKey)
+	if err != nil {
+		t.Fatalf("/set: %v", err)
+	}
+	if !strings.Contains(reply, "set to 3") {
+		t.Fatalf("/set reply = %q", reply)
+	}
+
+	response, err := al.ProcessDirect(ctx, "loop forever", sessionKey)
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if got := provider.calls.Load(); got != 3 {
+		t.Errorf("provider called %d times, want the session cap of 3", got)
+	}
+	if !strings.Contains(response, "Reached tool-call limit (3 iterations)") {
+		t.Errorf("response = %q, want the tool-call limit message", response)
+	}
+
+	// Other sessions keep the agent default.
+	provider.calls.Store(0)
+	if _, err := al.ProcessDirect(ctx, "loop forever", "agent:main:other"); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if got := provider.calls.Load(); got != 50 {
+		t.Errorf("other session: provider called %d times, want 50", got)
+	}
+
+	if reply, _ := al.ProcessDirect(ctx, "/set max-iterations -1", sessionKey); !strings.Contains(reply, "Invalid") {
+		t.Errorf("negative limit reply = %q, want rejection", reply)
+	}
+}
+
+func TestAgentLoop_ClearCommand(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "disk is fine"})
+	ctx := context.Background()
+	sessionKey := "agent:main:clear"
+
+	if _, err := al.ProcessDirect(ctx, "check disk", sessionKey); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	sessions := al.registry.GetDefaultAgent().Sessions
+	if len(sessions.GetHistory(sessionKey)) == 0 {
+		t.Fatal("expected history after a prompt")
+	}
+
+	reply, err := al.ProcessDirect(ctx, "/clear", sessionKey)
+	if err != nil {
+		t.Fatalf("/clear: %v", err)
+	}
+	if reply != "Conversation history cleared" {
+		t.Errorf("/clear reply = %q", reply)
+	}
+	if h := sessions.GetHistory(sessionKey); len(h) != 0 {
+		t.Errorf("history after /clear = %d messages, want 0", len(h))
+	}
+}
+
+// streamingMockProvider streams its reply word by word through the
+// context's token callback.
+type streamingMockProvider struct{}
+
+func (m *streamingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	words := []string{"disk ", "usage ", "is ", "42%"}
+	if onToken := providers.TokenCallbackFrom(ctx); onToken != nil {
+		for _, w := range words {
+			onToken(w)
+		}
+	}
+	return &providers.LLMResponse{Content: strings.Join(words, "")}, nil
+}
+
+func (m *streamingMockProvider) GetDefaultModel() string {
+	return "mock-stream-model"
+}
+
+func TestAgentLoop_StreamsResponseDeltas(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &streamingMockProvider{})
+
+	var streamed strings.Builder
+	al.SetEventCallback(func(ev AgentEvent) {
+		if ev.Type == EventResponseDelta {
+			streamed.WriteString(ev.Content)
+		}
+	})
+
+	response, err := al.ProcessDirect(context.Background(), "check disk", "agent:main:stream")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if streamed.String() != "disk usage is 42%" || response != streamed.String() {
+		t.Errorf("streamed %q, response %q", streamed.String(), response)
+	}
+}
+
+// usageMockProvider replies with fixed token usage.
+type usageMockProvider struct{}
+
+func (m *usageMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content: "all nodes healthy",
+		Usage:   &providers.UsageInfo{PromptTokens: 10_000, CompletionTokens: 2_000, TotalTokens: 12_000},
+	}, nil
+}
+
+func (m *usageMockProvider) GetDefaultModel() string {
+	return "gpt-4o"
+}
+
+func TestAgentLoop_RecordsCost(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	metrics := observability.NewDevOpsClawMetrics()
+	costs := observability.NewCostTracker(observability.PriceTable{"gpt-4o": {Prompt: 2.50, Completion: 10.00}})
+	costs.SetMetrics(metrics)
+	ledger := filepath.Join(t.TempDir(), "llm_costs.json")
+	costs.SetLedger(ledger)
+	al.SetCostTracker(costs)
+
+	if _, err := al.ProcessDirect(context.Background(), "check the fleet", "agent:main:cost"); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+
+	if got := metrics.LLMTokens.With("gpt-4o", "prompt").Value(); got != 10_000 {
+		t.Errorf("prompt tokens = %d, want 10000", got)
+	}
+	day, err := observability.ReadCostLedger(ledger)
+	if err != nil {
+		t.Fatalf("ReadCostLedger: %v", err)
+	}
+	if got := day.Day(time.Now()).TotalUSD(); got < 0.0449 || got > 0.0451 {
+		t.Errorf("ledger total = %v, want 0.045", got)
+	}
+}
+
+func TestAgentLoop_RecordsSpans(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	tracer := observability.NewTracer(0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	al.SetTracer(tracer)
+
+	if _, err := al.ProcessDirect(context.Background(), "check the fleet", "agent:main:trace"); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+
+	msgs := tracer.QuerySpans(observability.SpanQueryOptions{Name: "agent.message"})
+	if len(msgs) != 1 {
+		t.Fatalf("agent.message spans = %d, want 1", len(msgs))
+	}
+	llm := tracer.QuerySpans(observability.SpanQueryOptions{Name: "agent.llm"})
+	if len(llm) != 1 {
+		t.Fatalf("agent.llm spans = %d, want 1", len(llm))
+	}
+	if llm[0].TraceID != msgs[0].TraceID || llm[0].ParentID != msgs[0].SpanID {
+		t.Errorf("agent.llm span not a child of agent.message: %+v", llm[0])
+	}
+	if got := llm[0].Attributes["model"]; got != "gpt-4o" {
+		t.Errorf("model attribute = %q, want gpt-4o", got)
+	}
+}
+
+func TestAgentLoop_RecordsToolCallsInTaskHistory(t *testing.T) {
+	al, _ := newLoopingAgent(t, 2)
+	history := observability.NewTaskHistory(10)
+	al.SetTaskHistory(history)
+	tracer := observability.NewTracer(0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	al.SetTracer(tracer)
+
+	if _, err := al.ProcessDirect(context.Background(), "loop", "agent:main:history"); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+
+	recs := history.Query(observability.TaskQueryOptions{Action: "tool_exec"})
+	if len(recs) != 2 {
+		t.Fatalf("tool_exec records = %d, want 2", len(recs))
+	}
+	traceID := tracer.QuerySpans(observability.SpanQueryOptions{Name: "agent.message"})[0].TraceID
+	for _, rec := range recs {
+		if rec.Metadata["tool"] != "mock_custom" || rec.AgentID != "main" || rec.TraceID != traceID {
+			t.Errorf("record = %+v, want mock_custom by main in trace %s", rec, traceID)
+		}
+		if !strings.Contains(string(rec.Input), `"attempt"`) {
+			t.Errorf("input = %s, want the tool arguments", rec.Input)
+		}
+	}
+}
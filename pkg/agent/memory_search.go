@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/freitascorp/devopsclaw/pkg/tools"
+)
+
+// memorySnippetContext is how many lines around a match a snippet shows.
+const memorySnippetContext = 1
+
+// MemoryMatch is one place in the memory files that matches a search.
+type MemoryMatch struct {
+	Path      string  // relative to the workspace, e.g. memory/202610/20261016.md
+	Line      int     // 1-based line of the match
+	StartLine int     // first line of Snippet
+	EndLine   int     // last line of Snippet
+	Snippet   string  // the matching line with a line of context either side
+	Score     float64 // 0-1.5; higher is more relevant
+}
+
+// Search finds lines in MEMORY.md and the daily notes that contain words
+// of query, ignoring case, and returns up to limit of them, most relevant
+// first. A line scores the share of query words it contains, plus 0.5 if
+// it contains the whole query as a phrase. Ties go to long-term memory,
+// then to the newest notes. Matches whose snippets would overlap a better
+// match are dropped.
+func (ms *MemoryStore) Search(query string, limit int) ([]MemoryMatch, error) {
+	terms := memorySearchTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+	phrase := strings.ToLower(strings.Join(strings.Fields(query), " "))
+
+	var candidates []MemoryMatch
+	fileLines := map[string][]string{}
+	err := filepath.WalkDir(ms.memoryDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ms.workspace, path)
+		if err != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+		lines := strings.Split(string(data), "\n")
+		fileLines[rel] = lines
+		for i, line := range lines {
+			if score := memoryLineScore(strings.ToLower(line), terms, phrase); score > 0 {
+				candidates = append(candidates, MemoryMatch{Path: rel, Line: i + 1, Score: score})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("search memory: %w", err)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Path != b.Path {
+			return a.Path > b.Path // MEMORY.md sorts after the YYYYMM dirs
+		}
+		return a.Line < b.Line
+	})
+
+	var matches []MemoryMatch
+	for _, c := range candidates {
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+		lines := fileLines[c.Path]
+		c.StartLine = max(1, c.Line-memorySnippetContext)
+		c.EndLine = min(len(lines), c.Line+memorySnippetContext)
+		if overlapsMatch(matches, c) {
+			continue
+		}
+		c.Snippet = strings.Join(lines[c.StartLine-1:c.EndLine], "\n")
+		matches = append(matches, c)
+	}
+	return matches, nil
+}
+
+// memorySearchTerms returns the distinct lowercase words of query.
+func memorySearchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := map[string]bool{}
+	var terms []string
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// memoryLineScore scores a lowercased line against the query terms and
+// phrase; 0 means no match.
+func memoryLineScore(line string, terms []string, phrase string) float64 {
+	found := 0
+	for _, t := range terms {
+		if strings.Contains(line, t) {
+			found++
+		}
+	}
+	if found == 0 {
+		return 0
+	}
+	score := float64(found) / float64(len(terms))
+	if len(terms) > 1 && strings.Contains(line, phrase) {
+		score += 0.5
+	}
+	return math.Round(score*100) / 100
+}
+
+// overlapsMatch reports whether m's snippet shares lines with one already
+// chosen.
+func overlapsMatch(chosen []MemoryMatch, m MemoryMatch) bool {
+	for _, c := range chosen {
+		if c.Path == m.Path && m.StartLine <= c.EndLine && c.StartLine <= m.EndLine {
+			return true
+		}
+	}
+	return false
+}
+
+// MemorySearchTool lets the agent look up its memory files on demand
+// rather than relying on what fits in the system prompt.
+type MemorySearchTool struct {
+	memory *MemoryStore
+}
+
+// NewMemorySearchTool creates a memory_search tool over memory.
+func NewMemorySearchTool(memory *MemoryStore) *MemorySearchTool {
+	return &MemorySearchTool{memory: memory}
+}
+
+func (t *MemorySearchTool) Name() string {
+	return "memory_search"
+}
+
+func (t *MemorySearchTool) Description() string {
+	return "Search long-term memory (MEMORY.md) and daily notes for keywords. Returns the most relevant snippets with file paths, line numbers and a relevance score."
+}
+
+func (t *MemorySearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "Keywords to look for, e.g. \"postgres failover\"",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": "Maximum number of snippets to return (default 5, max 20)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *MemorySearchTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return tools.ErrorResult("query is required")
+	}
+	limit := 5
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), 20)
+	}
+
+	matches, err := t.memory.Search(query, limit)
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	if len(matches) == 0 {
+		return tools.SilentResult(fmt.Sprintf("No memory matches for %q", query))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d memory match(es) for %q:\n", len(matches), query)
+	for _, m := range matches {
+		fmt.Fprintf(&sb, "\n%s:%d (lines %d-%d, score %.2f)\n%s\n", m.Path, m.Line, m.StartLine, m.EndLine, m.Score, m.Snippet)
+	}
+	return tools.SilentResult(sb.String())
+}
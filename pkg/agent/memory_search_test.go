@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fixtureMemory copies testdata/memory_workspace into a temp workspace.
+func fixtureMemory(t *testing.T) *MemoryStore {
+	t.Helper()
+	workspace := t.TempDir()
+	if err := os.CopyFS(workspace, os.DirFS("testdata/memory_workspace")); err != nil {
+		t.Fatalf("copy fixture: %v", err)
+	}
+	return NewMemoryStore(workspace)
+}
+
+func TestMemoryStore_Search(t *testing.T) {
+	ms := fixtureMemory(t)
+	matches, err := ms.Search("Postgres failover", 10)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	want := []struct {
+		path  string
+		line  int
+		score float64
+	}{
+		{"memory/MEMORY.md", 5, 1.5},
+		{"memory/202610/20261014.md", 3, 1.5},
+		{"memory/202609/20260930.md", 4, 0.5},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(matches), len(want), matches)
+	}
+	for i, w := range want {
+		m := matches[i]
+		if m.Path != w.path || m.Line != w.line || m.Score != w.score {
+			t.Errorf("match %d = %s:%d score %.2f, want %s:%d score %.2f", i, m.Path, m.Line, m.Score, w.path, w.line, w.score)
+		}
+	}
+
+	// The match in MEMORY.md carries a line of context either side; the
+	// Postgres line above it overlaps and is not repeated.
+	first := matches[0]
+	if first.StartLine != 4 || first.EndLine != 6 {
+		t.Errorf("snippet lines = %d-%d, want 4-6", first.StartLine, first.EndLine)
+	}
+	if !strings.Contains(first.Snippet, "Primary database is Postgres") || !strings.Contains(first.Snippet, "Redis runs") {
+		t.Errorf("snippet = %q", first.Snippet)
+	}
+}
+
+func TestMemoryStore_SearchLimitAndMisses(t *testing.T) {
+	ms := fixtureMemory(t)
+
+	matches, err := ms.Search("redis", 1)
+	if err != nil || len(matches) != 1 || matches[0].Path != "memory/MEMORY.md" {
+		t.Errorf("limit 1: %+v, %v", matches, err)
+	}
+
+	matches, err = ms.Search("kubernetes", 5)
+	if err != nil || len(matches) != 0 {
+		t.Errorf("no match: %+v, %v", matches, err)
+	}
+
+	if _, err := ms.Search("  --  ", 5); err == nil {
+		t.Error("expected an error for a query with no words")
+	}
+
+	empty := NewMemoryStore(t.TempDir())
+	if matches, err := empty.Search("postgres", 5); err != nil || len(matches) != 0 {
+		t.Errorf("empty memory: %+v, %v", matches, err)
+	}
+}
+
+func TestMemorySearchTool(t *testing.T) {
+	tool := NewMemorySearchTool(fixtureMemory(t))
+
+	result := tool.Execute(context.Background(), map[string]any{"query": "failover", "limit": float64(1)})
+	if result.IsError {
+		t.Fatalf("Execute: %s", result.ForLLM)
+	}
+	want := "memory/MEMORY.md:5 (lines 4-6, score 1.00)"
+	if !strings.Contains(result.ForLLM, want) || strings.Contains(result.ForLLM, "20261014") {
+		t.Errorf("output = %q, want only %q", result.ForLLM, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"query": "kubernetes"})
+	if result.IsError || !strings.Contains(result.ForLLM, "No memory matches") {
+		t.Errorf("no-match result = %+v", result)
+	}
+
+	if result := tool.Execute(context.Background(), map[string]any{}); !result.IsError {
+		t.Error("expected an error without a query")
+	}
+}
@@ -2,17 +2,25 @@
 //
 // Every CLI command, fleet execution, browser session, deploy, and RBAC decision
 // is recorded as a structured event. Events are append-only and can be exported
-// to JSON for SIEM ingestion.
+// to JSON for SIEM ingestion. Each event carries the SHA-256 of the one before
+// it, so edits, deletions, and reordering can be detected with Verify.
 package audit
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/redact"
 )
 
 // EventType categorizes audit events.
@@ -44,6 +52,32 @@ type Event struct {
 	Result    *EventResult   `json:"result,omitempty"`
 	SessionID string         `json:"session_id,omitempty"`
 	Metadata  map[string]any `json:"metadata,omitempty"`
+
+	// TraceID is the trace of the observability span the action ran in,
+	// so the event can be matched to its spans. Logger sets it from the
+	// context when the event doesn't carry one.
+	TraceID string `json:"trace_id,omitempty"`
+
+	// PrevHash is the Hash of the preceding event in the log, empty for the
+	// first. Hash is the hex SHA-256 of PrevHash followed by the event's
+	// canonical JSON (the event encoded with Hash empty). Both are set by
+	// FileStore.Append.
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// computeHash returns the chain hash for e given its PrevHash.
+func (e *Event) computeHash() (string, error) {
+	c := *e
+	c.Hash = ""
+	canonical, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(e.PrevHash))
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // EventTarget describes what was targeted by the action.
@@ -81,10 +115,56 @@ type Store interface {
 	// Query retrieves events matching the given filters.
 	Query(ctx context.Context, opts QueryOptions) ([]*Event, error)
 
-	// Export writes all events since the given time as JSON lines to the writer.
+	// QueryFunc calls fn for each event matching the given filters, in log
+	// order, without materializing the result set. Iteration stops at the
+	// first error returned by fn, which is returned to the caller.
+	QueryFunc(ctx context.Context, opts QueryOptions, fn func(*Event) error) error
+
+	// Export returns all events since the given time.
 	Export(ctx context.Context, since time.Time) ([]*Event, error)
+
+	// ExportTo streams all events since the given time to w as a JSON array.
+	ExportTo(ctx context.Context, since time.Time, w io.Writer) (int, error)
+
+	// Verify walks the whole log and checks every event's hash chain.
+	Verify(ctx context.Context) (*VerifyReport, error)
+}
+
+// VerifyReport is the outcome of checking the audit log's hash chain.
+type VerifyReport struct {
+	Events int `json:"events"` // events read, including unparseable ones
+
+	// Unchained counts leading events written before hash chaining was
+	// introduced. They carry no hash and cannot be verified.
+	Unchained int `json:"unchained,omitempty"`
+
+	Broken []BrokenLink `json:"broken,omitempty"` // in log order
+}
+
+// BrokenLink is an event that failed verification.
+type BrokenLink struct {
+	Index     int       `json:"index"` // 0-based position in the log
+	ID        string    `json:"id,omitempty"`
+	Timestamp time.Time `json:"ts,omitempty"`
+	Reason    string    `json:"reason"`
+}
+
+// OK reports whether every chained event verified.
+func (r *VerifyReport) OK() bool {
+	return len(r.Broken) == 0
 }
 
+// FirstBroken returns the earliest event that failed verification, or nil.
+func (r *VerifyReport) FirstBroken() *BrokenLink {
+	if len(r.Broken) == 0 {
+		return nil
+	}
+	return &r.Broken[0]
+}
+
+// maxEventLineSize bounds a single JSONL record when streaming the log.
+const maxEventLineSize = 4 * 1024 * 1024
+
 // ------------------------------------------------------------------
 // File-based audit store (append-only JSONL)
 // ------------------------------------------------------------------
@@ -94,6 +174,13 @@ type Store interface {
 type FileStore struct {
 	dir string
 	mu  sync.Mutex
+
+	// lastHash is the Hash of the last event in the log as of when it was
+	// logSize bytes long. Append holds an flock on the log while it reads
+	// the tail and writes, so several processes can share one log; another
+	// process appending changes the size, which makes Append rescan.
+	lastHash string
+	logSize  int64
 }
 
 // NewFileStore creates a file-based audit store at the given directory.
@@ -106,7 +193,7 @@ func (s *FileStore) logFile() string {
 	return filepath.Join(s.dir, "audit.jsonl")
 }
 
-// Append writes an event to the audit log.
+// Append writes an event to the audit log, chaining it to the previous one.
 func (s *FileStore) Append(ctx context.Context, event *Event) error {
 	if event.ID == "" {
 		event.ID = fmt.Sprintf("evt_%d", time.Now().UnixNano())
@@ -115,11 +202,6 @@ func (s *FileStore) Append(ctx context.Context, event *Event) error {
 		event.Timestamp = time.Now()
 	}
 
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("marshal audit event: %w", err)
-	}
-
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -129,59 +211,146 @@ func (s *FileStore) Append(ctx context.Context, event *Event) error {
 	}
 	defer f.Close()
 
+	unlock, err := lockFile(f)
+	if err != nil {
+		return fmt.Errorf("lock audit log: %w", err)
+	}
+	defer unlock()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat audit log: %w", err)
+	}
+	if info.Size() != s.logSize {
+		if err := s.loadTailLocked(ctx); err != nil {
+			return fmt.Errorf("read audit log tail: %w", err)
+		}
+		s.logSize = info.Size()
+	}
+
+	event.PrevHash = s.lastHash
+	if event.Hash, err = event.computeHash(); err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+
 	if _, err := f.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("write audit event: %w", err)
 	}
+	s.lastHash = event.Hash
+	s.logSize += int64(len(data)) + 1
 
 	return nil
 }
 
-// Query reads events matching the given filters.
-func (s *FileStore) Query(ctx context.Context, opts QueryOptions) ([]*Event, error) {
-	all, err := s.readAll()
+// loadTailLocked sets lastHash to the Hash of the last parseable event.
+func (s *FileStore) loadTailLocked(ctx context.Context) error {
+	s.lastHash = ""
+	return s.QueryFunc(ctx, QueryOptions{}, func(e *Event) error {
+		s.lastHash = e.Hash
+		return nil
+	})
+}
+
+// Verify recomputes every event's hash and checks that it links to the
+// event before it. Unlike QueryFunc it reports unparseable lines rather
+// than skipping them, since a damaged line is itself evidence of tampering.
+func (s *FileStore) Verify(ctx context.Context) (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	f, err := os.Open(s.logFile())
 	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
 		return nil, err
 	}
+	defer f.Close()
 
-	var results []*Event
-	for _, e := range all {
-		if opts.User != "" && e.User != opts.User {
-			continue
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventLineSize)
+
+	chained := false
+	prevHash := ""
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if opts.Type != "" && e.Type != opts.Type {
+		line := scanner.Bytes()
+		if len(line) == 0 {
 			continue
 		}
-		if !opts.Since.IsZero() && e.Timestamp.Before(opts.Since) {
+		index := report.Events
+		report.Events++
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			report.Broken = append(report.Broken, BrokenLink{Index: index, Reason: "malformed event"})
 			continue
 		}
-		if !opts.Until.IsZero() && e.Timestamp.After(opts.Until) {
+		broken := func(reason string) {
+			report.Broken = append(report.Broken, BrokenLink{Index: index, ID: e.ID, Timestamp: e.Timestamp, Reason: reason})
+		}
+
+		if e.Hash == "" {
+			if chained {
+				broken("missing hash")
+			} else {
+				report.Unchained++
+			}
 			continue
 		}
-		results = append(results, e)
-		if opts.Limit > 0 && len(results) >= opts.Limit {
-			break
+		chained = true
+
+		if want, err := e.computeHash(); err != nil || want != e.Hash {
+			broken("hash mismatch: event was modified")
+		} else if e.PrevHash != prevHash {
+			broken("prev_hash mismatch: an earlier event was removed, inserted, or reordered")
 		}
+		prevHash = e.Hash
 	}
-
-	return results, nil
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
 }
 
-// Export returns all events since the given time.
-func (s *FileStore) Export(ctx context.Context, since time.Time) ([]*Event, error) {
-	return s.Query(ctx, QueryOptions{Since: since})
+// Query reads events matching the given filters.
+func (s *FileStore) Query(ctx context.Context, opts QueryOptions) ([]*Event, error) {
+	var results []*Event
+	err := s.QueryFunc(ctx, opts, func(e *Event) error {
+		results = append(results, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
-func (s *FileStore) readAll() ([]*Event, error) {
-	data, err := os.ReadFile(s.logFile())
+// QueryFunc scans the log line by line and calls fn for each matching event.
+func (s *FileStore) QueryFunc(ctx context.Context, opts QueryOptions, fn func(*Event) error) error {
+	f, err := os.Open(s.logFile())
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return nil
 		}
-		return nil, err
+		return err
 	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventLineSize)
 
-	var events []*Event
-	for _, line := range splitLines(data) {
+	matched := 0
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Bytes()
 		if len(line) == 0 {
 			continue
 		}
@@ -189,24 +358,81 @@ func (s *FileStore) readAll() ([]*Event, error) {
 		if err := json.Unmarshal(line, &e); err != nil {
 			continue // skip malformed lines
 		}
-		events = append(events, &e)
+		if !opts.matches(&e) {
+			continue
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+		matched++
+		if opts.Limit > 0 && matched >= opts.Limit {
+			break
+		}
 	}
-	return events, nil
+	return scanner.Err()
 }
 
-func splitLines(data []byte) [][]byte {
-	var lines [][]byte
-	start := 0
-	for i := range data {
-		if data[i] == '\n' {
-			lines = append(lines, data[start:i])
-			start = i + 1
+func (opts QueryOptions) matches(e *Event) bool {
+	if opts.User != "" && e.User != opts.User {
+		return false
+	}
+	if opts.Type != "" && e.Type != opts.Type {
+		return false
+	}
+	if !opts.Since.IsZero() && e.Timestamp.Before(opts.Since) {
+		return false
+	}
+	if !opts.Until.IsZero() && e.Timestamp.After(opts.Until) {
+		return false
+	}
+	return true
+}
+
+// Export returns all events since the given time.
+func (s *FileStore) Export(ctx context.Context, since time.Time) ([]*Event, error) {
+	return s.Query(ctx, QueryOptions{Since: since})
+}
+
+// ExportTo writes all events since the given time to w as an indented JSON
+// array, one event at a time, and returns the number of events written.
+// Memory use is bounded by a single event regardless of log size.
+func (s *FileStore) ExportTo(ctx context.Context, since time.Time, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("["); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err := s.QueryFunc(ctx, QueryOptions{Since: since}, func(e *Event) error {
+		data, err := json.MarshalIndent(e, "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal audit event: %w", err)
 		}
+		sep := ",\n  "
+		if n == 0 {
+			sep = "\n  "
+		}
+		if _, err := bw.WriteString(sep); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
 	}
-	if start < len(data) {
-		lines = append(lines, data[start:])
+
+	closing := "]\n"
+	if n > 0 {
+		closing = "\n]\n"
+	}
+	if _, err := bw.WriteString(closing); err != nil {
+		return n, err
 	}
-	return lines
+	return n, bw.Flush()
 }
 
 // ------------------------------------------------------------------
@@ -215,18 +441,56 @@ func splitLines(data []byte) [][]byte {
 
 // Logger provides helper methods for common audit patterns.
 type Logger struct {
-	store Store
-	user  string
+	store    Store
+	user     string
+	redactor *redact.Redactor
 }
 
-// NewLogger creates an audit logger for the given user.
+// NewLogger creates an audit logger for the given user. Secrets matching
+// redact.DefaultPatterns are masked before events are stored.
 func NewLogger(store Store, user string) *Logger {
-	return &Logger{store: store, user: user}
+	return &Logger{store: store, user: user, redactor: redact.Default()}
+}
+
+// SetRedactor replaces the redactor applied to events before they are
+// stored. A nil redactor stores events unchanged.
+func (l *Logger) SetRedactor(r *redact.Redactor) {
+	l.redactor = r
+}
+
+// append masks secrets in the event's free-text fields, tags it with the
+// trace of the span in ctx, if any, and stores it.
+func (l *Logger) append(ctx context.Context, e *Event) error {
+	if e.TraceID == "" {
+		if span := observability.SpanFromContext(ctx); span != nil {
+			e.TraceID = span.TraceID
+		}
+	}
+	r := l.redactor
+	if e.Target != nil {
+		t := *e.Target
+		if !r.Skips("command") {
+			t.Command = r.String(t.Command)
+		}
+		if !r.Skips("tags") {
+			t.Tags, _ = r.Value(t.Tags).(map[string]string)
+		}
+		e.Target = &t
+	}
+	if e.Result != nil && !r.Skips("error") {
+		res := *e.Result
+		res.Error = r.String(res.Error)
+		e.Result = &res
+	}
+	if !r.Skips("metadata") {
+		e.Metadata, _ = r.Value(e.Metadata).(map[string]any)
+	}
+	return l.store.Append(ctx, e)
 }
 
 // LogFleetExec records a fleet execution event.
 func (l *Logger) LogFleetExec(ctx context.Context, command string, target *EventTarget, result *EventResult) error {
-	return l.store.Append(ctx, &Event{
+	return l.append(ctx, &Event{
 		Type:   EventFleetExec,
 		User:   l.user,
 		Action: "fleet.exec",
@@ -240,7 +504,7 @@ func (l *Logger) LogFleetExec(ctx context.Context, command string, target *Event
 
 // LogDeploy records a deployment event.
 func (l *Logger) LogDeploy(ctx context.Context, service, version, strategy string, result *EventResult) error {
-	return l.store.Append(ctx, &Event{
+	return l.append(ctx, &Event{
 		Type:   EventFleetDeploy,
 		User:   l.user,
 		Action: "fleet.deploy",
@@ -253,9 +517,41 @@ func (l *Logger) LogDeploy(ctx context.Context, service, version, strategy strin
 	})
 }
 
+// LogDeployCapOverride records a deploy forced past the per-deploy node cap.
+func (l *Logger) LogDeployCapOverride(ctx context.Context, service, version string, resolvedNodes, maxNodes int) error {
+	return l.append(ctx, &Event{
+		Type:   EventFleetDeploy,
+		User:   l.user,
+		Action: "fleet.deploy.cap_override",
+		Result: &EventResult{Status: "overridden", NodesTotal: resolvedNodes},
+		Metadata: map[string]any{
+			"service":        service,
+			"version":        version,
+			"resolved_nodes": resolvedNodes,
+			"cap":            maxNodes,
+		},
+	})
+}
+
+// LogDeployRollback records a manual rollback of a prior deployment.
+func (l *Logger) LogDeployRollback(ctx context.Context, service, version, env, deployID string, result *EventResult) error {
+	return l.append(ctx, &Event{
+		Type:   EventFleetDeploy,
+		User:   l.user,
+		Action: "fleet.deploy.rollback",
+		Result: result,
+		Metadata: map[string]any{
+			"service":   service,
+			"version":   version,
+			"env":       env,
+			"deploy_id": deployID,
+		},
+	})
+}
+
 // LogBrowse records a browser automation event.
 func (l *Logger) LogBrowse(ctx context.Context, url, task string, result *EventResult) error {
-	return l.store.Append(ctx, &Event{
+	return l.append(ctx, &Event{
 		Type:   EventBrowse,
 		User:   l.user,
 		Action: "browse",
@@ -269,7 +565,7 @@ func (l *Logger) LogBrowse(ctx context.Context, url, task string, result *EventR
 
 // LogRunbook records a runbook execution event.
 func (l *Logger) LogRunbook(ctx context.Context, name string, dryRun bool, result *EventResult) error {
-	return l.store.Append(ctx, &Event{
+	return l.append(ctx, &Event{
 		Type:   EventRunbook,
 		User:   l.user,
 		Action: "runbook.run",
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExportFormat is an encoding for exported events.
+type ExportFormat string
+
+const (
+	ExportJSON   ExportFormat = "json"   // one indented JSON array
+	ExportNDJSON ExportFormat = "ndjson" // one compact JSON event per line
+	ExportCSV    ExportFormat = "csv"    // a header row, then one row per event
+)
+
+// DefaultCSVFields are the columns of a CSV export without Fields.
+var DefaultCSVFields = []string{"timestamp", "user", "type", "action", "status"}
+
+// fieldAliases maps convenience names in a CSV field list to the event's
+// JSON paths.
+var fieldAliases = map[string]string{
+	"timestamp": "ts",
+	"status":    "result.status",
+	"command":   "target.command",
+	"error":     "result.error",
+}
+
+// eventFields are the top-level JSON keys of an Event.
+var eventFields = map[string]bool{
+	"id": true, "ts": true, "type": true, "user": true, "action": true,
+	"target": true, "result": true, "session_id": true, "metadata": true,
+	"trace_id": true, "prev_hash": true, "hash": true,
+}
+
+// ExportOptions selects what Export writes.
+type ExportOptions struct {
+	Since  time.Time
+	Format ExportFormat // default ExportJSON
+
+	// Fields are the CSV columns, in order: JSON paths into the event such
+	// as "user" or "result.status", or an alias like "timestamp". Only
+	// used for ExportCSV; empty means DefaultCSVFields.
+	Fields []string
+}
+
+// Export streams the events since opts.Since from store to w in
+// opts.Format and returns the number of events written. Events are read
+// one at a time, so memory use does not grow with the size of the log.
+func Export(ctx context.Context, store Store, w io.Writer, opts ExportOptions) (int, error) {
+	switch opts.Format {
+	case "", ExportJSON:
+		if len(opts.Fields) > 0 {
+			return 0, fmt.Errorf("fields are only supported for csv exports")
+		}
+		return store.ExportTo(ctx, opts.Since, w)
+	case ExportNDJSON:
+		if len(opts.Fields) > 0 {
+			return 0, fmt.Errorf("fields are only supported for csv exports")
+		}
+		return exportNDJSON(ctx, store, w, opts.Since)
+	case ExportCSV:
+		fields := opts.Fields
+		if len(fields) == 0 {
+			fields = DefaultCSVFields
+		}
+		paths, err := resolveFields(fields)
+		if err != nil {
+			return 0, err
+		}
+		return exportCSV(ctx, store, w, opts.Since, fields, paths)
+	default:
+		return 0, fmt.Errorf("unknown export format %q (want json, ndjson, or csv)", opts.Format)
+	}
+}
+
+func exportNDJSON(ctx context.Context, store Store, w io.Writer, since time.Time) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	err := store.QueryFunc(ctx, QueryOptions{Since: since}, func(e *Event) error {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("marshal audit event: %w", err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+func exportCSV(ctx context.Context, store Store, w io.Writer, since time.Time, header []string, paths [][]string) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	row := make([]string, len(paths))
+	err := store.QueryFunc(ctx, QueryOptions{Since: since}, func(e *Event) error {
+		doc, err := eventDocument(e)
+		if err != nil {
+			return err
+		}
+		for i, path := range paths {
+			row[i] = csvValue(lookupPath(doc, path))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// resolveFields turns CSV field names into paths, rejecting names whose
+// first segment is not an event field.
+func resolveFields(fields []string) ([][]string, error) {
+	paths := make([][]string, len(fields))
+	for i, f := range fields {
+		name := strings.TrimSpace(f)
+		if alias, ok := fieldAliases[name]; ok {
+			name = alias
+		}
+		path := strings.Split(name, ".")
+		if !eventFields[path[0]] {
+			return nil, fmt.Errorf("unknown audit field %q", f)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// eventDocument decodes e's JSON form, keeping numbers exact.
+func eventDocument(e *Event) (map[string]any, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("marshal audit event: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookupPath walks path through nested objects, returning nil where a
+// segment is missing.
+func lookupPath(doc map[string]any, path []string) any {
+	var v any = doc
+	for _, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// csvValue renders a decoded JSON value as a cell: strings and numbers as
+// is, missing values empty, and arrays and objects as compact JSON.
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
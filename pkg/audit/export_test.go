@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport_NDJSON(t *testing.T) {
+	store := tempStore(t)
+	ctx := context.Background()
+	store.Append(ctx, &Event{User: "alice", Type: EventFleetExec, Action: "run", Timestamp: time.Now().Add(-2 * time.Hour)})
+	for _, user := range []string{"bob", "carol", "dave"} {
+		store.Append(ctx, &Event{User: user, Type: EventFleetExec, Action: "run"})
+	}
+
+	var buf bytes.Buffer
+	n, err := Export(ctx, store, &buf, ExportOptions{Since: time.Now().Add(-time.Hour), Format: ExportNDJSON})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("exported %d events, want 3", n)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %d is not an event: %v", lines+1, err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("got %d lines, want 3", lines)
+	}
+}
+
+func TestExport_CSVColumns(t *testing.T) {
+	store := tempStore(t)
+	ctx := context.Background()
+	ts := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	store.Append(ctx, &Event{
+		Timestamp: ts,
+		User:      "alice",
+		Type:      EventFleetDeploy,
+		Action:    "deploy",
+		Target:    &EventTarget{Command: "systemctl restart web, then check", NodeIDs: []string{"web-1", "web-2"}},
+		Result:    &EventResult{Status: "partial", NodesFailed: 1},
+		Metadata:  map[string]any{"version": "v2"},
+	})
+	store.Append(ctx, &Event{Timestamp: ts.Add(time.Minute), User: "bob", Type: EventBrowse, Action: "browse"})
+
+	var buf bytes.Buffer
+	fields := []string{"action", "result.status", "user", "target.node_ids", "metadata.version", "command", "timestamp"}
+	n, err := Export(ctx, store, &buf, ExportOptions{Format: ExportCSV, Fields: fields})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("exported %d events, want 2", n)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	want := [][]string{
+		fields,
+		{"deploy", "partial", "alice", `["web-1","web-2"]`, "v2", "systemctl restart web, then check", "2026-03-14T09:30:00Z"},
+		{"browse", "", "bob", "", "", "", "2026-03-14T09:31:00Z"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %q", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestExport_CSVDefaultFields(t *testing.T) {
+	store := tempStore(t)
+	store.Append(context.Background(), &Event{User: "alice", Type: EventShellExec, Action: "exec", Result: &EventResult{Status: "success"}})
+
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), store, &buf, ExportOptions{Format: ExportCSV}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "timestamp,user,type,action,status" || !strings.HasSuffix(lines[1], ",alice,shell.exec,exec,success") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestExport_InvalidOptions(t *testing.T) {
+	store := tempStore(t)
+	for _, opts := range []ExportOptions{
+		{Format: "xml"},
+		{Format: ExportCSV, Fields: []string{"user", "nodes"}},
+		{Format: ExportNDJSON, Fields: []string{"user"}},
+	} {
+		if _, err := Export(context.Background(), store, &bytes.Buffer{}, opts); err == nil {
+			t.Errorf("Export(%+v) succeeded, want an error", opts)
+		}
+	}
+}
@@ -23,13 +23,17 @@ package browser
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
 	"github.com/go-rod/rod/lib/proto"
 )
 
@@ -62,6 +66,34 @@ type ManagerConfig struct {
 	// AllowedDomains restricts navigation to these domains.
 	// If empty, all domains are allowed.
 	AllowedDomains []string
+
+	// Cookies are seeded into every new session, e.g. from ParseCookies,
+	// so automation can start from an already-authenticated state.
+	Cookies []*proto.NetworkCookieParam
+
+	// ActionRetries is how many times Click, Type, WaitFor, and Navigate are
+	// retried on transient failures (element not ready, navigation timeout).
+	// Default: 0 (no retries).
+	ActionRetries int
+
+	// RetryBackoff is the delay before the first retry; it doubles on each
+	// attempt after that. Default: 250ms.
+	RetryBackoff time.Duration
+
+	// ProxyServer routes browser traffic through a proxy, e.g.
+	// "http://proxy.corp:3128" or "socks5://127.0.0.1:1080". ProxyBypass
+	// lists hosts that skip it, in Chrome's --proxy-bypass-list syntax
+	// ("*.internal", "10.0.0.0/8"). AllowedDomains is enforced on the
+	// requested URL either way.
+	ProxyServer string
+	ProxyBypass []string
+
+	// BasicAuthUser and BasicAuthPassword, when set, answer HTTP basic
+	// auth challenges from BasicAuthOrigin in every new session; see
+	// Session.SetBasicAuth.
+	BasicAuthOrigin   string
+	BasicAuthUser     string
+	BasicAuthPassword string
 }
 
 func (c *ManagerConfig) defaults() {
@@ -104,17 +136,7 @@ func (m *Manager) ensureBrowser() error {
 		return nil
 	}
 
-	l := launcher.New()
-	if m.config.BrowserBin != "" {
-		l = l.Bin(m.config.BrowserBin)
-	}
-	if m.config.Headless {
-		l = l.Headless(true)
-	} else {
-		l = l.Headless(false)
-	}
-
-	controlURL, err := l.Launch()
+	controlURL, err := m.config.launcher().Launch()
 	if err != nil {
 		return fmt.Errorf("browser launch failed: %w", err)
 	}
@@ -128,6 +150,26 @@ func (m *Manager) ensureBrowser() error {
 	return nil
 }
 
+// launcher builds the Chromium launcher for c.
+func (c *ManagerConfig) launcher() *launcher.Launcher {
+	l := launcher.New()
+	if c.BrowserBin != "" {
+		l = l.Bin(c.BrowserBin)
+	}
+	l = l.Headless(c.Headless)
+	if c.ProxyServer != "" {
+		l = l.Proxy(c.ProxyServer)
+		if len(c.ProxyBypass) > 0 {
+			l = l.Set(proxyBypassFlag, strings.Join(c.ProxyBypass, ";"))
+		}
+	}
+	return l
+}
+
+// proxyBypassFlag is Chrome's --proxy-bypass-list, which the launcher has
+// no helper for.
+const proxyBypassFlag flags.Flag = "proxy-bypass-list"
+
 // NewSession creates or retrieves a named session.
 // Each session is an incognito browser context with its own cookies and storage.
 func (m *Manager) NewSession(name string) (*Session, error) {
@@ -152,6 +194,15 @@ func (m *Manager) NewSession(name string) (*Session, error) {
 		return nil, fmt.Errorf("incognito context failed: %w", err)
 	}
 
+	if len(m.config.Cookies) > 0 {
+		if err := m.checkCookieDomains(m.config.Cookies); err != nil {
+			return nil, err
+		}
+		if err := incognito.SetCookies(m.config.Cookies); err != nil {
+			return nil, fmt.Errorf("seed cookies failed: %w", err)
+		}
+	}
+
 	sess := &Session{
 		name:      name,
 		context:   incognito,
@@ -161,6 +212,16 @@ func (m *Manager) NewSession(name string) (*Session, error) {
 		vpWidth:   m.config.ViewportWidth,
 		vpHeight:  m.config.ViewportHeight,
 		userAgent: m.config.UserAgent,
+		authPages: make(map[string]bool),
+	}
+	sess.events, sess.stopEvents = context.WithCancel(context.Background())
+	if m.config.BasicAuthUser != "" {
+		auth, err := m.newBasicAuth(m.config.BasicAuthOrigin, m.config.BasicAuthUser, m.config.BasicAuthPassword)
+		if err != nil {
+			sess.close()
+			return nil, err
+		}
+		sess.auth.Store(auth)
 	}
 
 	m.sessions[name] = sess
@@ -232,6 +293,20 @@ func (m *Manager) isDomainAllowed(url string) bool {
 	return false
 }
 
+// checkCookieDomains rejects cookies for domains outside AllowedDomains.
+func (m *Manager) checkCookieDomains(cookies []*proto.NetworkCookieParam) error {
+	if len(m.config.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, c := range cookies {
+		host := cookieHost(c)
+		if host == "" || !m.isDomainAllowed(host) {
+			return fmt.Errorf("cookie %q: %w: %s", c.Name, ErrDomainNotAllowed, host)
+		}
+	}
+	return nil
+}
+
 // Session represents an isolated browser session with its own cookie jar and storage.
 type Session struct {
 	name      string
@@ -244,14 +319,24 @@ type Session struct {
 	vpWidth   int
 	vpHeight  int
 	userAgent string
+
+	auth       atomic.Pointer[basicAuth] // answers auth challenges; nil cancels them
+	authPages  map[string]bool           // page IDs with auth challenge handling on
+	events     context.Context           // scopes page event handlers; done on close
+	stopEvents context.CancelFunc
 }
 
 // Navigate opens a URL in the session. Returns the page title and URL.
 func (s *Session) Navigate(ctx context.Context, url string) (*ActionResult, error) {
 	if !s.manager.isDomainAllowed(url) {
-		return nil, fmt.Errorf("domain not allowed: %s", url)
+		return nil, fmt.Errorf("%w: %s", ErrDomainNotAllowed, url)
 	}
+	return s.withRetry(ctx, func() (*ActionResult, error) {
+		return s.navigate(ctx, url)
+	})
+}
 
+func (s *Session) navigate(ctx context.Context, url string) (*ActionResult, error) {
 	page, err := s.getOrCreatePage(ctx, "default")
 	if err != nil {
 		return nil, err
@@ -262,29 +347,63 @@ func (s *Session) Navigate(ctx context.Context, url string) (*ActionResult, erro
 		return nil, fmt.Errorf("navigate failed: %w", err)
 	}
 
-	// Wait for the page to stabilize
-	err = page.Timeout(s.timeout).WaitStable(300 * time.Millisecond)
-	if err != nil {
-		// Not fatal — some pages never fully stabilize
-	}
+	return finishNavigation(timeoutStablePage{page, s.timeout}, 300*time.Millisecond)
+}
+
+// navigationPage is the subset of *rod.Page used to finish a navigation,
+// so tests can simulate pages that never stabilize.
+type navigationPage interface {
+	WaitStable(d time.Duration) error
+	Info() (*proto.TargetTargetInfo, error)
+}
+
+// timeoutStablePage bounds only WaitStable by the session timeout, so a page
+// that used up the timeout settling can still report its info.
+type timeoutStablePage struct {
+	*rod.Page
+	timeout time.Duration
+}
+
+func (p timeoutStablePage) WaitStable(d time.Duration) error {
+	return p.Page.Timeout(p.timeout).WaitStable(d)
+}
+
+// finishNavigation waits for the page to settle and reports its title and URL.
+// A page that never stabilizes is not an error — some pages poll or stream
+// forever — but the result is flagged with stable=false and a
+// stabilize_warning so callers know the content may still be loading.
+func finishNavigation(page navigationPage, settle time.Duration) (*ActionResult, error) {
+	stableErr := page.WaitStable(settle)
 
 	info, err := page.Info()
 	if err != nil {
 		return nil, fmt.Errorf("page info failed: %w", err)
 	}
 
+	data := map[string]any{
+		"title":  info.Title,
+		"url":    info.URL,
+		"stable": stableErr == nil,
+	}
+	if stableErr != nil {
+		data["stabilize_warning"] = fmt.Sprintf("page did not stabilize, it may still be loading: %v", stableErr)
+	}
+
 	return &ActionResult{
 		Action:  "navigate",
 		Success: true,
-		Data: map[string]any{
-			"title": info.Title,
-			"url":   info.URL,
-		},
+		Data:    data,
 	}, nil
 }
 
 // Click clicks an element matching the CSS selector.
 func (s *Session) Click(ctx context.Context, selector string) (*ActionResult, error) {
+	return s.withRetry(ctx, func() (*ActionResult, error) {
+		return s.click(ctx, selector)
+	})
+}
+
+func (s *Session) click(ctx context.Context, selector string) (*ActionResult, error) {
 	page, err := s.getActivePage(ctx)
 	if err != nil {
 		return nil, err
@@ -315,6 +434,12 @@ func (s *Session) Click(ctx context.Context, selector string) (*ActionResult, er
 // Type types text into an element matching the CSS selector.
 // If clear is true, the field is cleared before typing.
 func (s *Session) Type(ctx context.Context, selector, text string, clear bool) (*ActionResult, error) {
+	return s.withRetry(ctx, func() (*ActionResult, error) {
+		return s.typeText(ctx, selector, text, clear)
+	})
+}
+
+func (s *Session) typeText(ctx context.Context, selector, text string, clear bool) (*ActionResult, error) {
 	page, err := s.getActivePage(ctx)
 	if err != nil {
 		return nil, err
@@ -382,25 +507,34 @@ func (s *Session) Screenshot(ctx context.Context, fullPage bool) (*ActionResult,
 // The js argument can be a raw expression (e.g. "document.title") or
 // an arrow/function expression (e.g. "() => document.title").
 // Raw expressions are automatically wrapped in an arrow function for Rod.
+//
+// Data["result"] is the value as JSON (see EvaluateJSON). A script that
+// throws is not an error: the result is unsuccessful, with the exception
+// message in Data["error"], so a caller can tell a bug in the script from
+// a browser failure.
 func (s *Session) Evaluate(ctx context.Context, js string) (*ActionResult, error) {
-	page, err := s.getActivePage(ctx)
-	if err != nil {
-		return nil, err
+	raw, err := s.EvaluateJSON(ctx, js)
+	var jsErr *JSError
+	if errors.As(err, &jsErr) {
+		return &ActionResult{
+			Action:  "evaluate",
+			Success: false,
+			Data: map[string]any{
+				"error":  jsErr.Message,
+				"line":   jsErr.Line,
+				"column": jsErr.Column,
+			},
+		}, nil
 	}
-
-	// Rod's Eval expects a function expression. Wrap raw expressions.
-	wrapped := wrapJSExpression(js)
-
-	result, err := page.Timeout(s.timeout).Eval(wrapped)
 	if err != nil {
-		return nil, fmt.Errorf("eval failed: %w", err)
+		return nil, err
 	}
 
 	return &ActionResult{
 		Action:  "evaluate",
 		Success: true,
 		Data: map[string]any{
-			"result": result.Value.Val(),
+			"result": raw,
 		},
 	}, nil
 }
@@ -471,6 +605,12 @@ func (s *Session) Extract(ctx context.Context, selector string, attribute string
 
 // WaitFor waits for an element matching the selector to appear.
 func (s *Session) WaitFor(ctx context.Context, selector string, timeout time.Duration) (*ActionResult, error) {
+	return s.withRetry(ctx, func() (*ActionResult, error) {
+		return s.waitFor(ctx, selector, timeout)
+	})
+}
+
+func (s *Session) waitFor(ctx context.Context, selector string, timeout time.Duration) (*ActionResult, error) {
 	page, err := s.getActivePage(ctx)
 	if err != nil {
 		return nil, err
@@ -587,6 +727,153 @@ func (s *Session) SetCookie(ctx context.Context, name, value, domain, path strin
 	}, nil
 }
 
+// SetBasicAuth answers HTTP basic auth challenges from origin (scheme,
+// host and port, e.g. "https://grafana.internal") with username and
+// password, on the session's pages, current and future. Challenges from
+// any other origin or from a proxy are cancelled, so the credentials are
+// never sent elsewhere. An empty username clears the credentials.
+func (s *Session) SetBasicAuth(ctx context.Context, origin, username, password string) (*ActionResult, error) {
+	var auth *basicAuth
+	if username != "" {
+		var err error
+		if auth, err = s.manager.newBasicAuth(origin, username, password); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auth.Store(auth)
+	for id, page := range s.pages {
+		if err := s.handleAuthLocked(id, page); err != nil {
+			return nil, fmt.Errorf("set basic auth failed: %w", err)
+		}
+	}
+
+	data := map[string]any{"username": username}
+	if auth != nil {
+		data["origin"] = auth.origin
+	}
+	return &ActionResult{
+		Action:  "set_basic_auth",
+		Success: true,
+		Data:    data,
+	}, nil
+}
+
+// basicAuth holds credentials for the HTTP auth challenges of one origin.
+type basicAuth struct {
+	origin   string
+	username string
+	password string
+}
+
+// newBasicAuth checks that origin is a URL within AllowedDomains and
+// returns credentials scoped to its scheme, host and port.
+func (m *Manager) newBasicAuth(origin, username, password string) (*basicAuth, error) {
+	o, err := urlOrigin(origin)
+	if err != nil {
+		return nil, fmt.Errorf("basic auth origin: %w", err)
+	}
+	if !m.isDomainAllowed(o) {
+		return nil, fmt.Errorf("basic auth origin: %w: %s", ErrDomainNotAllowed, o)
+	}
+	return &basicAuth{origin: o, username: username, password: password}, nil
+}
+
+// urlOrigin returns the scheme://host[:port] of rawURL.
+func urlOrigin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", rawURL)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// answer returns the response to an auth challenge: the credentials when a
+// server at a's origin asks for them, otherwise a cancellation. A nil a
+// cancels every challenge.
+func (a *basicAuth) answer(e *proto.FetchAuthRequired) *proto.FetchAuthChallengeResponse {
+	cancel := &proto.FetchAuthChallengeResponse{Response: proto.FetchAuthChallengeResponseResponseCancelAuth}
+	if a == nil || e.Request == nil || e.AuthChallenge == nil || e.AuthChallenge.Source == proto.FetchAuthChallengeSourceProxy {
+		return cancel
+	}
+	if o, err := urlOrigin(e.Request.URL); err != nil || o != a.origin {
+		return cancel
+	}
+	return &proto.FetchAuthChallengeResponse{
+		Response: proto.FetchAuthChallengeResponseResponseProvideCredentials,
+		Username: a.username,
+		Password: a.password,
+	}
+}
+
+// handleAuthLocked turns on auth challenge handling for page, once, when
+// the session has credentials. Fetch pauses every request once enabled, so
+// paused requests are continued unchanged; challenges are answered with
+// whatever s.auth holds at the time. The caller holds s.mu.
+func (s *Session) handleAuthLocked(id string, page *rod.Page) error {
+	if s.auth.Load() == nil || s.authPages[id] {
+		return nil
+	}
+	if err := (proto.FetchEnable{HandleAuthRequests: true}).Call(page); err != nil {
+		return err
+	}
+	s.authPages[id] = true
+
+	p := page.Context(s.events)
+	go p.EachEvent(func(e *proto.FetchRequestPaused) {
+		_ = proto.FetchContinueRequest{RequestID: e.RequestID}.Call(p)
+	}, func(e *proto.FetchAuthRequired) {
+		answer := s.auth.Load().answer(e)
+		_ = proto.FetchContinueWithAuth{RequestID: e.RequestID, AuthChallengeResponse: answer}.Call(p)
+	})()
+	return nil
+}
+
+// ImportCookies parses cookies from a curl command, Cookie header, Netscape
+// cookies.txt, or HAR export (see ParseCookies) and adds them to the session.
+// Cookies without a domain of their own, such as a bare Cookie header, are
+// scoped to the active page's URL.
+func (s *Session) ImportCookies(ctx context.Context, source string) (*ActionResult, error) {
+	defaultURL := ""
+	s.mu.Lock()
+	if s.activePage != nil {
+		if info, err := s.activePage.Info(); err == nil {
+			defaultURL = info.URL
+		}
+	}
+	s.mu.Unlock()
+
+	cookies, err := ParseCookies(source, defaultURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.manager.checkCookieDomains(cookies); err != nil {
+		return nil, err
+	}
+	if err := s.context.SetCookies(cookies); err != nil {
+		return nil, fmt.Errorf("import cookies failed: %w", err)
+	}
+
+	names := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return &ActionResult{
+		Action:  "import_cookies",
+		Success: true,
+		Data: map[string]any{
+			"names": names,
+			"count": len(cookies),
+		},
+	}, nil
+}
+
 // GetCookies returns all cookies for the current page.
 func (s *Session) GetCookies(ctx context.Context) (*ActionResult, error) {
 	page, err := s.getActivePage(ctx)
@@ -816,6 +1103,10 @@ func (s *Session) getOrCreatePage(ctx context.Context, id string) (*rod.Page, er
 		}
 	}
 
+	if err := s.handleAuthLocked(id, page); err != nil {
+		return nil, fmt.Errorf("set basic auth failed: %w", err)
+	}
+
 	s.pages[id] = page
 	s.activePage = page
 	return page, nil
@@ -840,6 +1131,7 @@ func (s *Session) close() {
 	}
 	s.pages = make(map[string]*rod.Page)
 	s.activePage = nil
+	s.stopEvents()
 	// close the incognito context
 	_ = s.context.Close()
 }
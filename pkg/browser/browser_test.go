@@ -2,8 +2,11 @@ package browser
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-rod/rod/lib/proto"
 )
 
 // ---- Unit tests for Manager and Tool dispatch (no browser needed) ----
@@ -207,6 +210,18 @@ func TestBrowserTool_Execute_ClickMissingSelector(t *testing.T) {
 	}
 }
 
+func TestBrowserTool_Execute_DownloadMissingSelector(t *testing.T) {
+	tool := NewBrowserTool(nil)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]any{
+		"action": "download",
+	})
+	if !result.IsError {
+		t.Error("expected error for missing selector")
+	}
+}
+
 func TestBrowserTool_Execute_TypeMissingArgs(t *testing.T) {
 	tool := NewBrowserTool(nil)
 	ctx := context.Background()
@@ -351,6 +366,56 @@ func TestActionResult_Structure(t *testing.T) {
 	}
 }
 
+// fakeNavigationPage simulates a loaded page with a configurable WaitStable outcome.
+type fakeNavigationPage struct {
+	stableErr error
+	info      *proto.TargetTargetInfo
+}
+
+func (p *fakeNavigationPage) WaitStable(time.Duration) error { return p.stableErr }
+
+func (p *fakeNavigationPage) Info() (*proto.TargetTargetInfo, error) { return p.info, nil }
+
+func TestFinishNavigation_Stable(t *testing.T) {
+	page := &fakeNavigationPage{info: &proto.TargetTargetInfo{Title: "Example", URL: "https://example.com/"}}
+
+	result, err := finishNavigation(page, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stable, _ := result.Data["stable"].(bool); !stable {
+		t.Error("stable should be true")
+	}
+	if _, ok := result.Data["stabilize_warning"]; ok {
+		t.Error("stabilize_warning should be absent for a stable page")
+	}
+}
+
+func TestFinishNavigation_NeverStabilizes(t *testing.T) {
+	page := &fakeNavigationPage{
+		stableErr: context.DeadlineExceeded,
+		info:      &proto.TargetTargetInfo{Title: "Dashboard", URL: "https://grafana.example.com/d/abc"},
+	}
+
+	result, err := finishNavigation(page, time.Millisecond)
+	if err != nil {
+		t.Fatalf("navigation should stay non-fatal, got: %v", err)
+	}
+	if !result.Success {
+		t.Error("Success should be true")
+	}
+	if stable, ok := result.Data["stable"].(bool); !ok || stable {
+		t.Errorf("stable = %v, want false", result.Data["stable"])
+	}
+	warning, _ := result.Data["stabilize_warning"].(string)
+	if !strings.Contains(warning, "may still be loading") || !strings.Contains(warning, "deadline exceeded") {
+		t.Errorf("stabilize_warning = %q", warning)
+	}
+	if result.Data["title"] != "Dashboard" || result.Data["url"] != "https://grafana.example.com/d/abc" {
+		t.Errorf("title/url not reported: %v", result.Data)
+	}
+}
+
 // ---- Integration tests (require Chromium, skipped in CI) ----
 
 func skipIfNoChrome(t *testing.T) {
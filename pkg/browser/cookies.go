@@ -0,0 +1,347 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ParseCookies parses cookies copied from an already-authenticated browser
+// session. The format is detected from the content:
+//
+//   - a curl command, as produced by devtools' "Copy as cURL"
+//     (cookies from -H 'Cookie: ...' or -b 'a=1; b=2', scoped to the request URL)
+//   - a bare "Cookie: a=1; b=2" header or "a=1; b=2" pair list
+//   - a Netscape cookies.txt file
+//   - a HAR export (cookies from every request and response)
+//
+// defaultURL scopes cookies whose source carries no domain, such as a bare
+// Cookie header; it may be empty for formats that name their own domain.
+func ParseCookies(source, defaultURL string) ([]*proto.NetworkCookieParam, error) {
+	trimmed := strings.TrimSpace(source)
+	if trimmed == "" {
+		return nil, fmt.Errorf("no cookies found: source is empty")
+	}
+
+	var (
+		cookies []*proto.NetworkCookieParam
+		err     error
+	)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		cookies, err = parseHARCookies(trimmed)
+	case strings.HasPrefix(trimmed, "curl ") || strings.HasPrefix(trimmed, "curl\t"):
+		cookies, err = parseCurlCookies(trimmed, defaultURL)
+	case looksLikeNetscape(trimmed):
+		cookies, err = parseNetscapeCookies(trimmed)
+	default:
+		cookies, err = parseCookieHeader(trimmed, defaultURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("no cookies found in source")
+	}
+	return cookies, nil
+}
+
+// LoadCookiesFile reads path and parses it with ParseCookies.
+func LoadCookiesFile(path, defaultURL string) ([]*proto.NetworkCookieParam, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cookies: %w", err)
+	}
+	cookies, err := ParseCookies(string(data), defaultURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cookies, nil
+}
+
+// parseCookieHeader parses "Cookie: a=1; b=2" (the header name is optional).
+func parseCookieHeader(header, defaultURL string) ([]*proto.NetworkCookieParam, error) {
+	if name, value, ok := strings.Cut(header, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "cookie") {
+		header = value
+	}
+	if defaultURL == "" {
+		return nil, fmt.Errorf("cookie header has no domain: a URL is required to scope it")
+	}
+
+	var cookies []*proto.NetworkCookieParam
+	for _, pair := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		cookies = append(cookies, &proto.NetworkCookieParam{
+			Name:  strings.TrimSpace(name),
+			Value: strings.TrimSpace(value),
+			URL:   defaultURL,
+		})
+	}
+	return cookies, nil
+}
+
+// parseCurlCookies extracts cookies from a curl command line. Cookies are
+// scoped to the request URL, falling back to defaultURL.
+func parseCurlCookies(command, defaultURL string) ([]*proto.NetworkCookieParam, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return nil, fmt.Errorf("parse curl command: %w", err)
+	}
+
+	requestURL := defaultURL
+	var headers []string
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		next := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch {
+		case arg == "-H" || arg == "--header":
+			headers = append(headers, next())
+		case arg == "-b" || arg == "--cookie":
+			// A value without '=' names a cookie jar file, not cookie data.
+			if v := next(); strings.Contains(v, "=") {
+				headers = append(headers, "Cookie: "+v)
+			}
+		case arg == "--url":
+			requestURL = next()
+		case strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://"):
+			requestURL = arg
+		}
+	}
+
+	var cookies []*proto.NetworkCookieParam
+	for _, h := range headers {
+		name, _, ok := strings.Cut(h, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "cookie") {
+			continue
+		}
+		parsed, err := parseCookieHeader(h, requestURL)
+		if err != nil {
+			return nil, err
+		}
+		cookies = append(cookies, parsed...)
+	}
+	return cookies, nil
+}
+
+// splitShellWords splits a command line into words, honouring single quotes,
+// double quotes, backslash escapes, and backslash-newline continuations, as
+// emitted by "Copy as cURL" (bash and cmd.exe's ^ continuations excepted).
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r != '\n' {
+				cur.WriteRune(r)
+				inWord = true
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+const netscapeHTTPOnlyPrefix = "#HttpOnly_"
+
+func looksLikeNetscape(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "# Netscape HTTP Cookie File") || strings.HasPrefix(line, "# HTTP Cookie File") {
+			return true
+		}
+		if line == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, netscapeHTTPOnlyPrefix)) {
+			continue
+		}
+		return len(strings.Split(line, "\t")) == 7
+	}
+	return false
+}
+
+// parseNetscapeCookies parses the cookies.txt format used by curl, wget, and
+// browser export extensions: domain, include-subdomains, path, secure,
+// expiry, name, value — tab separated, one cookie per line.
+func parseNetscapeCookies(content string) ([]*proto.NetworkCookieParam, error) {
+	var cookies []*proto.NetworkCookieParam
+	for n, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, netscapeHTTPOnlyPrefix) {
+			line = strings.TrimPrefix(line, netscapeHTTPOnlyPrefix)
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookies.txt line %d: expected 7 tab-separated fields, got %d", n+1, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies.txt line %d: invalid expiry %q", n+1, fields[4])
+		}
+
+		cookie := &proto.NetworkCookieParam{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HTTPOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expiry > 0 { // 0 marks a session cookie
+			cookie.Expires = proto.TimeSinceEpoch(expiry)
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies, nil
+}
+
+// harCookie is a cookie as recorded in a HAR 1.2 request or response.
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path"`
+	Domain   string `json:"domain"`
+	Expires  string `json:"expires"`
+	HTTPOnly bool   `json:"httpOnly"`
+	Secure   bool   `json:"secure"`
+}
+
+// parseHARCookies collects cookies from every entry of a HAR export. Later
+// entries win, so the result reflects the session's most recent state.
+func parseHARCookies(content string) ([]*proto.NetworkCookieParam, error) {
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL     string      `json:"url"`
+					Cookies []harCookie `json:"cookies"`
+				} `json:"request"`
+				Response struct {
+					Cookies []harCookie `json:"cookies"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal([]byte(content), &har); err != nil {
+		return nil, fmt.Errorf("parse HAR: %w", err)
+	}
+
+	type cookieKey struct{ name, domain, path, url string }
+	index := make(map[cookieKey]int)
+	var cookies []*proto.NetworkCookieParam
+
+	add := func(c harCookie, requestURL string) {
+		cookie := &proto.NetworkCookieParam{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		}
+		if cookie.Domain == "" {
+			cookie.URL = requestOrigin(requestURL)
+		}
+		if t, err := time.Parse(time.RFC3339, c.Expires); err == nil {
+			cookie.Expires = proto.TimeSinceEpoch(t.Unix())
+		}
+
+		key := cookieKey{cookie.Name, cookie.Domain, cookie.Path, cookie.URL}
+		if i, ok := index[key]; ok {
+			cookies[i] = cookie
+			return
+		}
+		index[key] = len(cookies)
+		cookies = append(cookies, cookie)
+	}
+
+	for _, e := range har.Log.Entries {
+		for _, c := range e.Request.Cookies {
+			add(c, e.Request.URL)
+		}
+		for _, c := range e.Response.Cookies {
+			add(c, e.Request.URL)
+		}
+	}
+	return cookies, nil
+}
+
+// requestOrigin strips the path and query from a request URL so cookies are
+// scoped to the site rather than a single endpoint.
+func requestOrigin(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// cookieHost returns the host a cookie applies to, for allowlist checks.
+func cookieHost(c *proto.NetworkCookieParam) string {
+	if c.Domain != "" {
+		return strings.TrimPrefix(c.Domain, ".")
+	}
+	if u, err := url.Parse(c.URL); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
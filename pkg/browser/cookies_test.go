@@ -0,0 +1,158 @@
+package browser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestParseCookies_Netscape(t *testing.T) {
+	source := "# Netscape HTTP Cookie File\n" +
+		"# https://curl.se/docs/http-cookies.html\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tTRUE\t1893456000\tsession_id\tabc123\n" +
+		"#HttpOnly_grafana.example.com\tFALSE\t/api\tFALSE\t0\tgrafana_session\txyz\n"
+
+	cookies, err := ParseCookies(source, "")
+	if err != nil {
+		t.Fatalf("ParseCookies() error: %v", err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+
+	c := cookies[0]
+	if c.Name != "session_id" || c.Value != "abc123" || c.Domain != ".example.com" || c.Path != "/" {
+		t.Errorf("cookie[0] = %+v", c)
+	}
+	if !c.Secure || c.HTTPOnly {
+		t.Errorf("cookie[0] secure=%v httpOnly=%v, want true/false", c.Secure, c.HTTPOnly)
+	}
+	if c.Expires != proto.TimeSinceEpoch(1893456000) {
+		t.Errorf("cookie[0].Expires = %v", c.Expires)
+	}
+
+	c = cookies[1]
+	if c.Name != "grafana_session" || c.Domain != "grafana.example.com" || c.Path != "/api" {
+		t.Errorf("cookie[1] = %+v", c)
+	}
+	if !c.HTTPOnly || c.Secure {
+		t.Errorf("cookie[1] secure=%v httpOnly=%v, want false/true", c.Secure, c.HTTPOnly)
+	}
+	if c.Expires != 0 {
+		t.Errorf("session cookie should have no expiry, got %v", c.Expires)
+	}
+}
+
+func TestParseCookies_NetscapeMalformed(t *testing.T) {
+	_, err := ParseCookies("# Netscape HTTP Cookie File\n.example.com\tTRUE\t/\n", "")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected line-numbered error, got %v", err)
+	}
+}
+
+func TestParseCookies_CookieHeader(t *testing.T) {
+	cookies, err := ParseCookies("Cookie: sid=abc; theme=dark;  csrf=t0k=en", "https://app.example.com/dash")
+	if err != nil {
+		t.Fatalf("ParseCookies() error: %v", err)
+	}
+
+	want := map[string]string{"sid": "abc", "theme": "dark", "csrf": "t0k=en"}
+	if len(cookies) != len(want) {
+		t.Fatalf("expected %d cookies, got %d", len(want), len(cookies))
+	}
+	for _, c := range cookies {
+		if want[c.Name] != c.Value {
+			t.Errorf("cookie %s = %q, want %q", c.Name, c.Value, want[c.Name])
+		}
+		if c.URL != "https://app.example.com/dash" {
+			t.Errorf("cookie %s URL = %q", c.Name, c.URL)
+		}
+	}
+}
+
+func TestParseCookies_BarePairsNeedURL(t *testing.T) {
+	if _, err := ParseCookies("sid=abc; theme=dark", ""); err == nil {
+		t.Error("expected error for a cookie header without a URL")
+	}
+	cookies, err := ParseCookies("sid=abc; theme=dark", "https://example.com")
+	if err != nil || len(cookies) != 2 {
+		t.Errorf("ParseCookies() = %d cookies, %v", len(cookies), err)
+	}
+}
+
+func TestParseCookies_Curl(t *testing.T) {
+	source := `curl 'https://grafana.example.com/api/dashboards/home' \
+  -H 'accept: application/json' \
+  -H 'cookie: grafana_session=s3cr3t; grafana_session_expiry=1700000000' \
+  -b "extra=1" \
+  --compressed`
+
+	cookies, err := ParseCookies(source, "")
+	if err != nil {
+		t.Fatalf("ParseCookies() error: %v", err)
+	}
+	if len(cookies) != 3 {
+		t.Fatalf("expected 3 cookies, got %d: %+v", len(cookies), cookies)
+	}
+	if cookies[0].Name != "grafana_session" || cookies[0].Value != "s3cr3t" {
+		t.Errorf("cookie[0] = %+v", cookies[0])
+	}
+	for _, c := range cookies {
+		if c.URL != "https://grafana.example.com/api/dashboards/home" {
+			t.Errorf("cookie %s URL = %q, want the request URL", c.Name, c.URL)
+		}
+	}
+}
+
+func TestParseCookies_HAR(t *testing.T) {
+	source := `{"log": {"entries": [
+		{"request": {"url": "https://app.example.com/login", "cookies": []},
+		 "response": {"cookies": [{"name": "sid", "value": "old", "domain": ".example.com", "path": "/", "httpOnly": true, "secure": true, "expires": "2030-01-01T00:00:00Z"}]}},
+		{"request": {"url": "https://app.example.com/home?x=1", "cookies": [{"name": "sid", "value": "new", "domain": ".example.com", "path": "/"}, {"name": "lang", "value": "en"}]},
+		 "response": {"cookies": []}}
+	]}}`
+
+	cookies, err := ParseCookies(source, "")
+	if err != nil {
+		t.Fatalf("ParseCookies() error: %v", err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d: %+v", len(cookies), cookies)
+	}
+	if cookies[0].Name != "sid" || cookies[0].Value != "new" {
+		t.Errorf("later HAR entries should win: %+v", cookies[0])
+	}
+	if cookies[1].Name != "lang" || cookies[1].URL != "https://app.example.com/" {
+		t.Errorf("domainless cookie should be scoped to the request origin: %+v", cookies[1])
+	}
+}
+
+func TestParseCookies_Empty(t *testing.T) {
+	if _, err := ParseCookies("  \n", "https://example.com"); err == nil {
+		t.Error("expected error for empty source")
+	}
+}
+
+func TestManager_CheckCookieDomains(t *testing.T) {
+	mgr := NewManager(ManagerConfig{AllowedDomains: []string{"example.com"}})
+
+	allowed := []*proto.NetworkCookieParam{
+		{Name: "a", Domain: ".example.com"},
+		{Name: "b", URL: "https://grafana.example.com/"},
+	}
+	if err := mgr.checkCookieDomains(allowed); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	denied := []*proto.NetworkCookieParam{{Name: "evil", Domain: ".attacker.io"}}
+	if err := mgr.checkCookieDomains(denied); err == nil || !strings.Contains(err.Error(), "attacker.io") {
+		t.Errorf("expected domain error, got %v", err)
+	}
+
+	open := NewManager(ManagerConfig{})
+	if err := open.checkCookieDomains(denied); err != nil {
+		t.Errorf("no allowlist should allow all domains: %v", err)
+	}
+}
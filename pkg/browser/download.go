@@ -0,0 +1,118 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ErrNoDownload is returned by DownloadFile when clicking the trigger did
+// not start a download before the timeout.
+var ErrNoDownload = errors.New("no download started")
+
+// maxDownloadBytes caps the file DownloadFile returns, since it is held in
+// memory and base64-encoded into the tool result.
+const maxDownloadBytes = 25 << 20
+
+// DownloadFile clicks the element matching triggerSelector and captures
+// the file download it starts, such as a dashboard's CSV or PDF export.
+// It waits up to timeout (the session timeout if zero) for the download to
+// begin and finish. The result carries the file as base64 along with the
+// browser's suggested filename.
+func (s *Session) DownloadFile(ctx context.Context, triggerSelector string, timeout time.Duration) (*ActionResult, error) {
+	if timeout <= 0 {
+		timeout = s.timeout
+	}
+
+	dir, err := os.MkdirTemp("", "devopsclaw-download-*")
+	if err != nil {
+		return nil, fmt.Errorf("create download dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	b := s.context.Context(waitCtx)
+
+	err = proto.BrowserSetDownloadBehavior{
+		Behavior:         proto.BrowserSetDownloadBehaviorBehaviorAllowAndName,
+		BrowserContextID: s.context.BrowserContextID,
+		DownloadPath:     dir,
+		EventsEnabled:    true,
+	}.Call(b)
+	if err != nil {
+		return nil, fmt.Errorf("enable downloads failed: %w", err)
+	}
+	defer func() {
+		_ = proto.BrowserSetDownloadBehavior{
+			Behavior:         proto.BrowserSetDownloadBehaviorBehaviorDefault,
+			BrowserContextID: s.context.BrowserContextID,
+		}.Call(s.context)
+	}()
+
+	// Subscribe before clicking so a fast download's events are not missed.
+	var (
+		begin *proto.BrowserDownloadWillBegin
+		state proto.BrowserDownloadProgressState
+	)
+	wait := b.EachEvent(func(e *proto.BrowserDownloadWillBegin) {
+		begin = e
+	}, func(e *proto.BrowserDownloadProgress) bool {
+		if begin == nil || e.GUID != begin.GUID {
+			return false
+		}
+		state = e.State
+		return state == proto.BrowserDownloadProgressStateCompleted ||
+			state == proto.BrowserDownloadProgressStateCanceled
+	})
+
+	if _, err := s.click(ctx, triggerSelector); err != nil {
+		return nil, err
+	}
+	wait()
+
+	switch {
+	case begin == nil:
+		return nil, fmt.Errorf("%w within %s after clicking %s", ErrNoDownload, timeout, triggerSelector)
+	case state == proto.BrowserDownloadProgressStateCanceled:
+		return nil, fmt.Errorf("download of %s was canceled", begin.SuggestedFilename)
+	case state != proto.BrowserDownloadProgressStateCompleted:
+		return nil, fmt.Errorf("download of %s did not finish within %s", begin.SuggestedFilename, timeout)
+	}
+	return readDownload(dir, begin, triggerSelector)
+}
+
+// readDownload loads a finished download, which Chrome saves under its
+// GUID when downloads are allowed with names, into a "download" result.
+func readDownload(dir string, begin *proto.BrowserDownloadWillBegin, selector string) (*ActionResult, error) {
+	path := filepath.Join(dir, begin.GUID)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("read download: %w", err)
+	}
+	if info.Size() > maxDownloadBytes {
+		return nil, fmt.Errorf("download %s is %d bytes, over the %d byte limit", begin.SuggestedFilename, info.Size(), maxDownloadBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read download: %w", err)
+	}
+
+	return &ActionResult{
+		Action:  "download",
+		Success: true,
+		Data: map[string]any{
+			"selector": selector,
+			"filename": begin.SuggestedFilename,
+			"url":      begin.URL,
+			"base64":   base64.StdEncoding.EncodeToString(data),
+			"size":     len(data),
+		},
+	}, nil
+}
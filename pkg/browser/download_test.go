@@ -0,0 +1,116 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestReadDownload(t *testing.T) {
+	dir := t.TempDir()
+	csv := "host,cpu\nweb-1,0.42\n"
+	if err := os.WriteFile(filepath.Join(dir, "guid-1"), []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := readDownload(dir, &proto.BrowserDownloadWillBegin{
+		GUID:              "guid-1",
+		URL:               "https://grafana.example.com/export.csv",
+		SuggestedFilename: "export.csv",
+	}, "#export")
+	if err != nil {
+		t.Fatalf("readDownload: %v", err)
+	}
+	if result.Action != "download" || result.Data["filename"] != "export.csv" || result.Data["size"] != len(csv) {
+		t.Errorf("result = %+v", result)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(result.Data["base64"].(string))
+	if string(decoded) != csv {
+		t.Errorf("content = %q, want %q", decoded, csv)
+	}
+
+	if _, err := readDownload(dir, &proto.BrowserDownloadWillBegin{GUID: "missing"}, "#export"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestBrowserTool_FormatDownloadResult(t *testing.T) {
+	tool := NewBrowserTool(nil)
+	result := tool.formatResult(&ActionResult{
+		Action:  "download",
+		Success: true,
+		Data:    map[string]any{"filename": "report.pdf", "size": 2048, "base64": "JVBERi0="},
+	})
+	if result.ForLLM != "download completed: 2048 bytes captured (report.pdf)" {
+		t.Errorf("ForLLM = %q", result.ForLLM)
+	}
+	var data map[string]any
+	if err := json.Unmarshal([]byte(result.ForUser), &data); err != nil || data["base64"] != "JVBERi0=" {
+		t.Errorf("ForUser = %q, want the full data", result.ForUser)
+	}
+}
+
+// downloadServer serves a page with an export link that downloads a CSV,
+// and a dead button that downloads nothing.
+func downloadServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+<a id="export" href="/export.csv">Export</a>
+<button id="noop">Nothing</button>
+</body></html>`))
+	})
+	mux.HandleFunc("/export.csv", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="nodes.csv"`)
+		w.Write([]byte("node,status\nweb-1,online\n"))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestIntegration_DownloadFile(t *testing.T) {
+	skipIfNoChrome(t)
+	ts := downloadServer(t)
+
+	mgr := NewManager(ManagerConfig{Headless: true})
+	defer mgr.Close()
+	sess, err := mgr.NewSession("download")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := sess.Navigate(ctx, ts.URL); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+
+	result, err := sess.DownloadFile(ctx, "#export", 10*time.Second)
+	if err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if result.Data["filename"] != "nodes.csv" {
+		t.Errorf("filename = %v, want nodes.csv", result.Data["filename"])
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(result.Data["base64"].(string))
+	if string(decoded) != "node,status\nweb-1,online\n" {
+		t.Errorf("content = %q", decoded)
+	}
+
+	_, err = sess.DownloadFile(ctx, "#noop", 500*time.Millisecond)
+	if !errors.Is(err, ErrNoDownload) || !strings.Contains(err.Error(), "within 500ms") {
+		t.Errorf("err = %v, want ErrNoDownload naming the timeout", err)
+	}
+}
@@ -0,0 +1,101 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// JSError is an exception thrown by evaluated JavaScript, as opposed to a
+// failure to run it at all (no page, a timeout, a closed browser).
+type JSError struct {
+	Message string // e.g. "ReferenceError: foo is not defined"
+	Line    int    // 0-based, as reported by the DevTools protocol
+	Column  int    // 0-based
+}
+
+func (e *JSError) Error() string {
+	return "javascript error: " + e.Message
+}
+
+// EvaluateJSON runs js like Evaluate and returns its result as JSON with
+// object keys sorted, so the same value always encodes the same way.
+// Promises are awaited. undefined, functions and values JSON cannot
+// represent (NaN, Infinity) come back as null. If the script throws, the
+// error is a *JSError carrying the exception message.
+func (s *Session) EvaluateJSON(ctx context.Context, js string) (json.RawMessage, error) {
+	page, err := s.getActivePage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := page.Timeout(s.timeout).Eval(wrapJSExpression(js))
+	if err != nil {
+		var evalErr *rod.EvalError
+		if errors.As(err, &evalErr) && evalErr.RuntimeExceptionDetails != nil {
+			return nil, jsErrorFrom(evalErr.RuntimeExceptionDetails)
+		}
+		return nil, fmt.Errorf("eval failed: %w", err)
+	}
+	return remoteObjectJSON(obj)
+}
+
+// remoteObjectJSON encodes a by-value evaluation result.
+func remoteObjectJSON(obj *proto.RuntimeRemoteObject) (json.RawMessage, error) {
+	if obj.Type == proto.RuntimeRemoteObjectTypeUndefined || obj.Type == proto.RuntimeRemoteObjectTypeFunction {
+		return json.RawMessage("null"), nil
+	}
+	data, err := obj.Value.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("encode eval result: %w", err)
+	}
+	return canonicalJSON(data)
+}
+
+// canonicalJSON re-encodes data with sorted object keys, exact numbers and
+// no HTML escaping. Empty input is null.
+func canonicalJSON(data []byte) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode eval result: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("encode eval result: %w", err)
+	}
+	return json.RawMessage(bytes.TrimRight(buf.Bytes(), "\n")), nil
+}
+
+// jsErrorFrom extracts the message of a thrown exception: the first line
+// of an Error's description (its stack follows), the thrown value for
+// anything else, such as `throw "boom"`, and the protocol's text as a last
+// resort.
+func jsErrorFrom(d *proto.RuntimeExceptionDetails) *JSError {
+	e := &JSError{Message: d.Text, Line: d.LineNumber, Column: d.ColumnNumber}
+	if ex := d.Exception; ex != nil {
+		switch {
+		case ex.Description != "":
+			e.Message, _, _ = strings.Cut(ex.Description, "\n")
+		case !ex.Value.Nil():
+			e.Message = ex.Value.String()
+		}
+	}
+	if e.Message == "" {
+		e.Message = "uncaught exception"
+	}
+	return e
+}
@@ -0,0 +1,123 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	got, err := canonicalJSON([]byte(`{"b":[3,{"z":1,"a":"<ok>"}],"a":1.5}`))
+	if err != nil {
+		t.Fatalf("canonicalJSON: %v", err)
+	}
+	if want := `{"a":1.5,"b":[3,{"a":"<ok>","z":1}]}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	got, err = canonicalJSON(nil)
+	if err != nil || string(got) != "null" {
+		t.Errorf("empty input = %s, %v; want null", got, err)
+	}
+}
+
+func TestRemoteObjectJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  *proto.RuntimeRemoteObject
+		want string
+	}{
+		{"object", &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeObject,
+			Value: gson.New(map[string]any{"nodes": 3, "healthy": true})}, `{"healthy":true,"nodes":3}`},
+		{"undefined", &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeUndefined}, "null"},
+		{"function", &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeFunction}, "null"},
+		{"NaN", &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeNumber, UnserializableValue: "NaN"}, "null"},
+		{"string", &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeString, Value: gson.New("up")}, `"up"`},
+	}
+	for _, tt := range tests {
+		got, err := remoteObjectJSON(tt.obj)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: got %s, %v; want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSErrorFrom(t *testing.T) {
+	thrownError := &proto.RuntimeExceptionDetails{
+		Text:         "Uncaught",
+		LineNumber:   0,
+		ColumnNumber: 6,
+		Exception: &proto.RuntimeRemoteObject{
+			Type:        proto.RuntimeRemoteObjectTypeObject,
+			Subtype:     proto.RuntimeRemoteObjectSubtypeError,
+			Description: "ReferenceError: foo is not defined\n    at <anonymous>:1:7",
+		},
+	}
+	if e := jsErrorFrom(thrownError); e.Message != "ReferenceError: foo is not defined" || e.Column != 6 {
+		t.Errorf("error = %+v", e)
+	}
+
+	thrownString := &proto.RuntimeExceptionDetails{
+		Text:      "Uncaught",
+		Exception: &proto.RuntimeRemoteObject{Type: proto.RuntimeRemoteObjectTypeString, Value: gson.New("boom")},
+	}
+	if e := jsErrorFrom(thrownString); e.Message != "boom" {
+		t.Errorf("message = %q, want boom", e.Message)
+	}
+
+	if e := jsErrorFrom(&proto.RuntimeExceptionDetails{Text: "Uncaught"}); e.Message != "Uncaught" {
+		t.Errorf("message = %q, want the protocol text", e.Message)
+	}
+}
+
+func TestIntegration_EvaluateJSON(t *testing.T) {
+	skipIfNoChrome(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Fleet</title></head><body></body></html>`))
+	}))
+	t.Cleanup(ts.Close)
+
+	mgr := NewManager(ManagerConfig{Headless: true})
+	defer mgr.Close()
+	sess, err := mgr.NewSession("evaluate-json")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := sess.Navigate(ctx, ts.URL); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+
+	raw, err := sess.EvaluateJSON(ctx, `({title: document.title, nodes: [1, 2], ok: true, missing: undefined})`)
+	if err != nil {
+		t.Fatalf("EvaluateJSON: %v", err)
+	}
+	if want := `{"nodes":[1,2],"ok":true,"title":"Fleet"}`; string(raw) != want {
+		t.Errorf("got %s, want %s", raw, want)
+	}
+
+	raw, err = sess.EvaluateJSON(ctx, `undefined`)
+	if err != nil || string(raw) != "null" {
+		t.Errorf("undefined = %s, %v; want null", raw, err)
+	}
+
+	_, err = sess.EvaluateJSON(ctx, `(() => { throw new TypeError("bad node list") })()`)
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) || jsErr.Message != "TypeError: bad node list" {
+		t.Errorf("err = %v, want a JSError with the thrown message", err)
+	}
+
+	result, err := sess.Evaluate(ctx, `missingFunction()`)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if result.Success || result.Data["error"] != "ReferenceError: missingFunction is not defined" {
+		t.Errorf("result = %+v", result)
+	}
+}
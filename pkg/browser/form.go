@@ -0,0 +1,156 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// ErrFieldNotFound is returned by FillForm when a field selector matches
+// nothing on the page.
+var ErrFieldNotFound = errors.New("form field not found")
+
+// FillForm types each value of fields into the element its selector
+// matches, clearing the element first, then clicks submitSelector if it is
+// not empty and waits for the resulting page load or in-page update to
+// settle, as Navigate does. Fields are filled in selector order.
+//
+// Nothing is typed unless every field is on the page: FillForm waits up to
+// the session timeout for them to appear and otherwise fails with
+// ErrFieldNotFound naming each missing selector. Values are left out of
+// the result, since they are often credentials.
+func (s *Session) FillForm(ctx context.Context, fields map[string]string, submitSelector string) (*ActionResult, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no form fields to fill")
+	}
+	page, err := s.getActivePage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selectors := make([]string, 0, len(fields))
+	for sel := range fields {
+		if strings.TrimSpace(sel) == "" {
+			return nil, fmt.Errorf("empty form field selector")
+		}
+		selectors = append(selectors, sel)
+	}
+	sort.Strings(selectors)
+
+	if err := s.waitForFields(ctx, page, selectors); err != nil {
+		return nil, err
+	}
+	for _, sel := range selectors {
+		if err := fillField(page.Context(ctx).Timeout(s.timeout), sel, fields[sel]); err != nil {
+			return nil, err
+		}
+	}
+
+	data := map[string]any{
+		"fields":    selectors,
+		"submitted": false,
+	}
+	if submitSelector == "" {
+		return &ActionResult{Action: "fill_form", Success: true, Data: data}, nil
+	}
+
+	before, _ := page.Info()
+	if _, err := s.click(ctx, submitSelector); err != nil {
+		return nil, fmt.Errorf("submit: %w", err)
+	}
+	nav, err := finishNavigation(timeoutStablePage{page, s.timeout}, 300*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("submit: %w", err)
+	}
+	for k, v := range nav.Data {
+		data[k] = v
+	}
+	data["submitted"] = true
+	data["submit"] = submitSelector
+	data["navigated"] = before != nil && before.URL != nav.Data["url"]
+	return &ActionResult{Action: "fill_form", Success: true, Data: data}, nil
+}
+
+// waitForFields waits up to the session timeout for every selector to
+// match an element, so a form that is still rendering can be filled.
+func (s *Session) waitForFields(ctx context.Context, page *rod.Page, selectors []string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	p := page.Context(waitCtx)
+
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		var missing []string
+		for _, sel := range selectors {
+			has, _, err := p.Has(sel)
+			if err != nil && waitCtx.Err() == nil {
+				return fmt.Errorf("field %s: %w", sel, err)
+			}
+			if !has {
+				missing = append(missing, sel)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w after %v: %s", ErrFieldNotFound, s.timeout, strings.Join(missing, ", "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// fillField replaces the content of the element matching selector with
+// value.
+func fillField(page *rod.Page, selector, value string) error {
+	el, err := page.Element(selector)
+	if err != nil {
+		return fmt.Errorf("field %s: %w", selector, err)
+	}
+	if err := el.SelectAllText(); err != nil {
+		return fmt.Errorf("field %s: clear failed: %w", selector, err)
+	}
+	if err := el.Input(value); err != nil {
+		return fmt.Errorf("field %s: type failed: %w", selector, err)
+	}
+	return nil
+}
+
+// formFieldsArg reads fill_form's fields argument: an object mapping CSS
+// selectors to the text to type, or the same object encoded as a JSON
+// string.
+func formFieldsArg(args map[string]any) (map[string]string, error) {
+	raw := args["fields"]
+	if s, ok := raw.(string); ok {
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return nil, fmt.Errorf("fields must be a JSON object of selector to value: %w", err)
+		}
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok || len(obj) == 0 {
+		return nil, fmt.Errorf("fields must be a non-empty object of selector to value")
+	}
+	fields := make(map[string]string, len(obj))
+	for sel, v := range obj {
+		switch v := v.(type) {
+		case string:
+			fields[sel] = v
+		case float64, bool:
+			fields[sel] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("field %s: value must be a string", sel)
+		}
+	}
+	return fields, nil
+}
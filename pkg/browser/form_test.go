@@ -0,0 +1,107 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormFieldsArg(t *testing.T) {
+	fields, err := formFieldsArg(map[string]any{
+		"fields": map[string]any{"#user": "admin", "#pin": float64(1234)},
+	})
+	if err != nil || fields["#user"] != "admin" || fields["#pin"] != "1234" {
+		t.Errorf("object = %v, %v", fields, err)
+	}
+
+	fields, err = formFieldsArg(map[string]any{"fields": `{"#user": "admin"}`})
+	if err != nil || fields["#user"] != "admin" {
+		t.Errorf("JSON string = %v, %v", fields, err)
+	}
+
+	for _, bad := range []any{nil, "not json", map[string]any{}, map[string]any{"#user": []any{"a"}}} {
+		if _, err := formFieldsArg(map[string]any{"fields": bad}); err == nil {
+			t.Errorf("formFieldsArg(%v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestBrowserTool_Execute_FillFormMissingFields(t *testing.T) {
+	tool := NewBrowserTool(nil)
+	result := tool.Execute(context.Background(), map[string]any{
+		"action": "fill_form",
+		"submit": "#login",
+	})
+	if !result.IsError {
+		t.Error("expected error for missing fields")
+	}
+}
+
+// loginServer serves a login form whose fields render after a short delay,
+// as SPA login pages do, and a page that greets the submitted user.
+func loginServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Sign in</title></head><body>
+<form id="login" method="post" action="/login"></form>
+<script>
+setTimeout(() => {
+	document.getElementById("login").innerHTML =
+		'<input id="user" name="user" value="guest">' +
+		'<input id="password" name="password" type="password">' +
+		'<button id="submit" type="submit">Sign in</button>';
+}, 200);
+</script>
+</body></html>`))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		title := "Welcome " + r.FormValue("user")
+		if r.FormValue("password") != "s3cret" {
+			title = "Denied"
+		}
+		w.Write([]byte("<html><head><title>" + title + "</title></head><body>ok</body></html>"))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestIntegration_FillForm(t *testing.T) {
+	skipIfNoChrome(t)
+	ts := loginServer(t)
+
+	mgr := NewManager(ManagerConfig{Headless: true, DefaultTimeout: 5 * time.Second})
+	defer mgr.Close()
+	sess, err := mgr.NewSession("fill-form")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := sess.Navigate(ctx, ts.URL); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+
+	_, err = sess.FillForm(ctx, map[string]string{"#user": "admin", "#otp": "123456"}, "#submit")
+	if !errors.Is(err, ErrFieldNotFound) || !strings.Contains(err.Error(), "#otp") || strings.Contains(err.Error(), "#user") {
+		t.Fatalf("err = %v, want ErrFieldNotFound naming only #otp", err)
+	}
+
+	// The pre-filled "guest" is cleared, not appended to.
+	result, err := sess.FillForm(ctx, map[string]string{"#user": "admin", "#password": "s3cret"}, "#submit")
+	if err != nil {
+		t.Fatalf("FillForm: %v", err)
+	}
+	if result.Data["title"] != "Welcome admin" || result.Data["navigated"] != true {
+		t.Errorf("result = %+v, want the welcome page", result.Data)
+	}
+	if strings.Contains(result.Data["url"].(string)+strings.Join(result.Data["fields"].([]string), ","), "s3cret") {
+		t.Error("result leaks a field value")
+	}
+}
@@ -0,0 +1,164 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestManagerConfig_LauncherProxyFlags(t *testing.T) {
+	l := (&ManagerConfig{
+		Headless:    true,
+		ProxyServer: "http://proxy.corp:3128",
+		ProxyBypass: []string{"*.internal", "10.0.0.0/8"},
+	}).launcher()
+
+	if got := l.Get(flags.ProxyServer); got != "http://proxy.corp:3128" {
+		t.Errorf("proxy-server = %q", got)
+	}
+	if got := l.Get(proxyBypassFlag); got != "*.internal;10.0.0.0/8" {
+		t.Errorf("proxy-bypass-list = %q", got)
+	}
+	if !l.Has(flags.Headless) {
+		t.Error("headless flag missing")
+	}
+
+	// A bypass list without a proxy is meaningless and not passed on.
+	l = (&ManagerConfig{ProxyBypass: []string{"*.internal"}}).launcher()
+	if l.Has(flags.ProxyServer) || l.Has(proxyBypassFlag) {
+		t.Error("proxy flags set without ProxyServer")
+	}
+	if l.Has(flags.Headless) {
+		t.Error("headless flag set for a headed browser")
+	}
+}
+
+func TestBasicAuth_Answer(t *testing.T) {
+	mgr := NewManager(ManagerConfig{AllowedDomains: []string{"dashboard.internal"}})
+	auth, err := mgr.newBasicAuth("HTTPS://Dashboard.internal:8443/login", "ops", "hunter2")
+	if err != nil {
+		t.Fatalf("newBasicAuth: %v", err)
+	}
+	if auth.origin != "https://dashboard.internal:8443" {
+		t.Errorf("origin = %q", auth.origin)
+	}
+
+	challenge := func(rawURL string, source proto.FetchAuthChallengeSource) *proto.FetchAuthRequired {
+		return &proto.FetchAuthRequired{
+			Request:       &proto.NetworkRequest{URL: rawURL},
+			AuthChallenge: &proto.FetchAuthChallenge{Source: source, Origin: rawURL, Scheme: "basic"},
+		}
+	}
+	tests := []struct {
+		name string
+		auth *basicAuth
+		e    *proto.FetchAuthRequired
+		want proto.FetchAuthChallengeResponseResponse
+	}{
+		{"target origin", auth, challenge("https://dashboard.internal:8443/api/health", proto.FetchAuthChallengeSourceServer), proto.FetchAuthChallengeResponseResponseProvideCredentials},
+		{"other host", auth, challenge("https://evil.test/", proto.FetchAuthChallengeSourceServer), proto.FetchAuthChallengeResponseResponseCancelAuth},
+		{"other port", auth, challenge("https://dashboard.internal/", proto.FetchAuthChallengeSourceServer), proto.FetchAuthChallengeResponseResponseCancelAuth},
+		{"other scheme", auth, challenge("http://dashboard.internal:8443/", proto.FetchAuthChallengeSourceServer), proto.FetchAuthChallengeResponseResponseCancelAuth},
+		{"proxy challenge", auth, challenge("https://dashboard.internal:8443/", proto.FetchAuthChallengeSourceProxy), proto.FetchAuthChallengeResponseResponseCancelAuth},
+		{"no credentials", nil, challenge("https://dashboard.internal:8443/", proto.FetchAuthChallengeSourceServer), proto.FetchAuthChallengeResponseResponseCancelAuth},
+	}
+	for _, tt := range tests {
+		got := tt.auth.answer(tt.e)
+		if got.Response != tt.want {
+			t.Errorf("%s: response = %s, want %s", tt.name, got.Response, tt.want)
+		}
+		if got.Response != proto.FetchAuthChallengeResponseResponseProvideCredentials && (got.Username != "" || got.Password != "") {
+			t.Errorf("%s: credentials sent with a %s", tt.name, got.Response)
+		}
+	}
+
+	if _, err := mgr.newBasicAuth("https://evil.test", "ops", "hunter2"); !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("origin outside AllowedDomains: err = %v, want ErrDomainNotAllowed", err)
+	}
+	if _, err := mgr.newBasicAuth("dashboard.internal", "ops", "hunter2"); err == nil {
+		t.Error("expected an error for an origin without a scheme")
+	}
+}
+
+func TestIntegration_ProxyAndBasicAuth(t *testing.T) {
+	skipIfNoChrome(t)
+
+	// The proxy serves the "internal dashboard" itself, behind basic auth,
+	// so the test sees whether requests were proxied and authenticated.
+	var (
+		mu      sync.Mutex
+		proxied []string
+		authFor = map[string]bool{}
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.Host)
+		if r.Header.Get("Authorization") != "" {
+			authFor[r.Host] = true
+		}
+		mu.Unlock()
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ops" || pass != "hunter2" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dashboard"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "<html><body>dashboard ok</body></html>")
+	}))
+	defer proxy.Close()
+
+	mgr := NewManager(ManagerConfig{
+		Headless:       true,
+		ProxyServer:    proxy.URL,
+		AllowedDomains: []string{"dashboard.internal", "other.internal"},
+	})
+	tool := NewBrowserToolWithManager(mgr)
+	defer tool.Close()
+	ctx := context.Background()
+
+	sess, err := mgr.NewSession("default")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if _, err := sess.SetBasicAuth(ctx, "http://dashboard.internal", "ops", "hunter2"); err != nil {
+		t.Fatalf("set basic auth: %v", err)
+	}
+
+	result := tool.Execute(ctx, map[string]any{"action": "navigate", "url": "http://dashboard.internal/"})
+	if result.IsError {
+		t.Fatalf("navigate failed: %s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]any{"action": "get_text"})
+	if !strings.Contains(result.ForLLM, "dashboard ok") {
+		t.Errorf("page text = %s, want the authenticated dashboard", result.ForLLM)
+	}
+	mu.Lock()
+	if len(proxied) == 0 || proxied[0] != "dashboard.internal" {
+		t.Errorf("proxied hosts = %v, want dashboard.internal", proxied)
+	}
+	mu.Unlock()
+
+	// Another origin's challenge is not answered with the credentials.
+	result = tool.Execute(ctx, map[string]any{"action": "navigate", "url": "http://other.internal/"})
+	if result.IsError {
+		t.Fatalf("navigate failed: %s", result.ForLLM)
+	}
+	mu.Lock()
+	if authFor["other.internal"] {
+		t.Error("credentials sent to other.internal")
+	}
+	mu.Unlock()
+
+	// AllowedDomains still applies with a proxy in front.
+	result = tool.Execute(ctx, map[string]any{"action": "navigate", "url": "http://evil.test/"})
+	if !result.IsError {
+		t.Error("expected an error for a blocked domain behind the proxy")
+	}
+}
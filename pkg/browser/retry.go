@@ -0,0 +1,87 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// ErrDomainNotAllowed is returned when a URL falls outside
+// ManagerConfig.AllowedDomains. It is never retried.
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// defaultRetryBackoff is the first retry delay when ActionRetries is set
+// without RetryBackoff.
+const defaultRetryBackoff = 250 * time.Millisecond
+
+// retryConfig builds the backoff policy for Click, Type, WaitFor, and
+// Navigate. ok is false when retries are disabled.
+func (c ManagerConfig) retryConfig() (cfg resilience.RetryConfig, ok bool) {
+	if c.ActionRetries <= 0 {
+		return resilience.RetryConfig{}, false
+	}
+	backoff := c.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	return resilience.RetryConfig{
+		MaxAttempts:  c.ActionRetries + 1,
+		InitialDelay: backoff,
+		MaxDelay:     10 * backoff,
+		Multiplier:   2.0,
+		JitterFrac:   0.1,
+		RetryableErr: isTransientActionError,
+	}, true
+}
+
+// isTransientActionError reports whether a failed action may succeed if
+// repeated: the element was not there or not ready yet, or the page timed
+// out loading. Policy failures such as a blocked domain, and cancellation
+// by the caller, are permanent.
+func isTransientActionError(err error) bool {
+	switch {
+	case errors.Is(err, ErrDomainNotAllowed), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	var (
+		notFound       *rod.ElementNotFoundError
+		notInteractive *rod.NotInteractableError
+		navFailed      *rod.NavigationError
+	)
+	return errors.As(err, &notFound) || errors.As(err, &notInteractive) || errors.As(err, &navFailed)
+}
+
+// withRetry runs action under the manager's retry policy. When it succeeds
+// after more than one attempt, the attempt count is added to the result.
+func (s *Session) withRetry(ctx context.Context, action func() (*ActionResult, error)) (*ActionResult, error) {
+	cfg, ok := s.manager.config.retryConfig()
+	if !ok {
+		return action()
+	}
+
+	var (
+		result   *ActionResult
+		attempts int
+	)
+	err := resilience.Retry(ctx, cfg, func(attempt int) error {
+		attempts = attempt + 1
+		r, err := action()
+		if err != nil {
+			return err
+		}
+		result = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if attempts > 1 && result.Data != nil {
+		result.Data["attempts"] = attempts
+	}
+	return result, nil
+}
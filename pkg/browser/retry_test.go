@@ -0,0 +1,122 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+func newRetrySession(retries int) *Session {
+	return &Session{manager: NewManager(ManagerConfig{ActionRetries: retries, RetryBackoff: time.Millisecond})}
+}
+
+func TestWithRetry_FlakyActionSucceeds(t *testing.T) {
+	s := newRetrySession(3)
+
+	calls := 0
+	result, err := s.withRetry(context.Background(), func() (*ActionResult, error) {
+		calls++
+		if calls < 3 {
+			return nil, fmt.Errorf("element not found: #submit: %w", &rod.ElementNotFoundError{})
+		}
+		return &ActionResult{Action: "click", Success: true, Data: map[string]any{"selector": "#submit"}}, nil
+	})
+	if err != nil {
+		t.Fatalf("withRetry() error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	if result.Data["attempts"] != 3 {
+		t.Errorf("attempts = %v, want 3", result.Data["attempts"])
+	}
+}
+
+func TestWithRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	s := newRetrySession(2)
+
+	calls := 0
+	_, err := s.withRetry(context.Background(), func() (*ActionResult, error) {
+		calls++
+		return nil, fmt.Errorf("navigate failed: %w", context.DeadlineExceeded)
+	})
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the last navigation timeout", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3 (1 + 2 retries)", calls)
+	}
+}
+
+func TestWithRetry_BlockedDomainNotRetried(t *testing.T) {
+	s := newRetrySession(3)
+
+	calls := 0
+	_, err := s.withRetry(context.Background(), func() (*ActionResult, error) {
+		calls++
+		return nil, fmt.Errorf("%w: https://evil.example", ErrDomainNotAllowed)
+	})
+	if !errors.Is(err, ErrDomainNotAllowed) {
+		t.Fatalf("err = %v, want ErrDomainNotAllowed", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, a blocked domain must not be retried", calls)
+	}
+}
+
+func TestWithRetry_Disabled(t *testing.T) {
+	s := newRetrySession(0)
+
+	calls := 0
+	s.withRetry(context.Background(), func() (*ActionResult, error) {
+		calls++
+		return nil, &rod.ElementNotFoundError{}
+	})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 with retries disabled", calls)
+	}
+}
+
+func TestNavigate_BlockedDomainFailsFast(t *testing.T) {
+	s := &Session{manager: NewManager(ManagerConfig{
+		AllowedDomains: []string{"example.com"},
+		ActionRetries:  3,
+	})}
+
+	start := time.Now()
+	_, err := s.Navigate(context.Background(), "https://evil.test/login")
+	if !errors.Is(err, ErrDomainNotAllowed) {
+		t.Fatalf("err = %v, want ErrDomainNotAllowed", err)
+	}
+	if strings.Contains(err.Error(), "max retries") || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("blocked navigation should fail without retrying: %v", err)
+	}
+}
+
+func TestIsTransientActionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"element not found", fmt.Errorf("element not found: #x: %w", &rod.ElementNotFoundError{}), true},
+		{"element covered", &rod.CoveredError{}, true},
+		{"navigation failed", &rod.NavigationError{Reason: "net::ERR_CONNECTION_RESET"}, true},
+		{"timeout", fmt.Errorf("wait timed out: %w", context.DeadlineExceeded), true},
+		{"blocked domain", fmt.Errorf("%w: https://evil.test", ErrDomainNotAllowed), false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("eval js error"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientActionError(tt.err); got != tt.want {
+				t.Errorf("isTransientActionError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
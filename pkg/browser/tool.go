@@ -17,6 +17,7 @@ import (
 //   - navigate: Open a URL
 //   - click: Click an element by CSS selector
 //   - type: Type text into an input
+//   - fill_form: Fill several inputs at once and optionally submit
 //   - screenshot: Capture page screenshot (base64 PNG)
 //   - evaluate: Execute JavaScript
 //   - extract: Extract text/attributes from elements
@@ -29,6 +30,7 @@ import (
 //   - get_cookies: List all cookies
 //   - set_cookie: Set a cookie
 //   - pdf: Generate PDF (base64)
+//   - download: Click an element and capture the file it downloads (base64)
 //   - new_session: Create a new isolated session
 //   - close_session: Close a session
 //   - list_sessions: List active sessions
@@ -61,8 +63,8 @@ func (t *BrowserTool) Name() string {
 
 func (t *BrowserTool) Description() string {
 	return `Automate a web browser to navigate pages, interact with elements, take screenshots, and extract data. ` +
-		`Actions: navigate, click, type, screenshot, evaluate, extract, wait_for, scroll, get_text, ` +
-		`page_info, hover, select, get_cookies, set_cookie, pdf, new_session, close_session, list_sessions.`
+		`Actions: navigate, click, type, fill_form, screenshot, evaluate, extract, wait_for, wait_gone, wait_idle, scroll, ` +
+		`get_text, page_info, hover, select, get_cookies, set_cookie, pdf, download, new_session, close_session, list_sessions.`
 }
 
 func (t *BrowserTool) Parameters() map[string]any {
@@ -71,14 +73,15 @@ func (t *BrowserTool) Parameters() map[string]any {
 		"properties": map[string]any{
 			"action": map[string]any{
 				"type": "string",
-				"description": "The browser action to perform. One of: navigate, click, type, screenshot, " +
-					"evaluate, extract, wait_for, scroll, get_text, page_info, hover, select, " +
-					"get_cookies, set_cookie, pdf, new_session, close_session, list_sessions",
+				"description": "The browser action to perform. One of: navigate, click, type, fill_form, screenshot, " +
+					"evaluate, extract, wait_for, wait_gone, wait_idle, scroll, get_text, page_info, hover, " +
+					"select, get_cookies, set_cookie, pdf, download, new_session, close_session, list_sessions",
 				"enum": []string{
-					"navigate", "click", "type", "screenshot", "evaluate",
-					"extract", "wait_for", "scroll", "get_text", "page_info",
-					"hover", "select", "get_cookies", "set_cookie", "pdf",
-					"new_session", "close_session", "list_sessions",
+					"navigate", "click", "type", "fill_form", "screenshot", "evaluate",
+					"extract", "wait_for", "wait_gone", "wait_idle", "scroll",
+					"get_text", "page_info", "hover", "select", "get_cookies",
+					"set_cookie", "pdf", "download", "new_session", "close_session",
+					"list_sessions",
 				},
 			},
 			"url": map[string]any{
@@ -87,19 +90,28 @@ func (t *BrowserTool) Parameters() map[string]any {
 			},
 			"selector": map[string]any{
 				"type":        "string",
-				"description": "CSS selector for targeting elements (for click, type, extract, wait_for, hover, select)",
+				"description": "CSS selector for targeting elements (for click, type, extract, wait_for, wait_gone, hover, select; for 'download', the element whose click starts the download)",
 			},
 			"text": map[string]any{
 				"type":        "string",
 				"description": "Text to type into an input field (for 'type' action)",
 			},
+			"fields": map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+				"description":          "CSS selector to text for each input to fill, e.g. {\"#username\": \"admin\", \"#password\": \"...\"} (for 'fill_form'; fields are cleared first)",
+			},
+			"submit": map[string]any{
+				"type":        "string",
+				"description": "CSS selector of the button to click once the fields are filled, waiting for the page to load (for 'fill_form'; omit to only fill)",
+			},
 			"clear": map[string]any{
 				"type":        "boolean",
 				"description": "Clear the input field before typing (for 'type' action, default false)",
 			},
 			"javascript": map[string]any{
 				"type":        "string",
-				"description": "JavaScript code to evaluate on the page (for 'evaluate' action)",
+				"description": "JavaScript code to evaluate on the page (for 'evaluate' action). The result comes back as JSON; an exception is reported in data.error",
 			},
 			"attribute": map[string]any{
 				"type":        "string",
@@ -146,9 +158,13 @@ func (t *BrowserTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Session name for isolation (default 'default'). Use new_session to create.",
 			},
+			"idle_ms": map[string]any{
+				"type":        "integer",
+				"description": "How long the page must have no network requests in flight, in milliseconds (for 'wait_idle' action, default 500)",
+			},
 			"timeout": map[string]any{
 				"type":        "integer",
-				"description": "Timeout in seconds for the action (default: manager default)",
+				"description": "Timeout in seconds for the action (default: manager default). For 'download', how long to wait for the file to start and finish downloading",
 			},
 		},
 		"required": []string{"action"},
@@ -209,6 +225,13 @@ func (t *BrowserTool) Execute(ctx context.Context, args map[string]any) *tools.T
 		clear, _ := args["clear"].(bool)
 		result, err = sess.Type(ctx, selector, text, clear)
 
+	case "fill_form":
+		fields, ferr := formFieldsArg(args)
+		if ferr != nil {
+			return tools.ErrorResult(fmt.Sprintf("fill_form: %v", ferr))
+		}
+		result, err = sess.FillForm(ctx, fields, stringArg(args, "submit", ""))
+
 	case "screenshot":
 		fullPage, _ := args["full_page"].(bool)
 		result, err = sess.Screenshot(ctx, fullPage)
@@ -239,6 +262,27 @@ func (t *BrowserTool) Execute(ctx context.Context, args map[string]any) *tools.T
 		}
 		result, err = sess.WaitFor(ctx, selector, timeout)
 
+	case "wait_gone":
+		selector := stringArg(args, "selector", "")
+		if selector == "" {
+			return tools.ErrorResult("selector is required for wait_gone action")
+		}
+		var timeout time.Duration
+		if timeoutSec, ok := args["timeout"].(float64); ok {
+			timeout = time.Duration(timeoutSec) * time.Second
+		}
+		result, err = sess.WaitForGone(ctx, selector, timeout)
+
+	case "wait_idle":
+		var idleFor, timeout time.Duration
+		if idleMs, ok := args["idle_ms"].(float64); ok && idleMs > 0 {
+			idleFor = time.Duration(idleMs) * time.Millisecond
+		}
+		if timeoutSec, ok := args["timeout"].(float64); ok {
+			timeout = time.Duration(timeoutSec) * time.Second
+		}
+		result, err = sess.WaitNetworkIdle(ctx, idleFor, timeout)
+
 	case "scroll":
 		scrollX, _ := args["scroll_x"].(float64)
 		scrollY, _ := args["scroll_y"].(float64)
@@ -292,6 +336,17 @@ func (t *BrowserTool) Execute(ctx context.Context, args map[string]any) *tools.T
 	case "pdf":
 		result, err = sess.PDF(ctx)
 
+	case "download":
+		selector := stringArg(args, "selector", "")
+		if selector == "" {
+			return tools.ErrorResult("selector is required for download action")
+		}
+		var timeout time.Duration
+		if timeoutSec, ok := args["timeout"].(float64); ok {
+			timeout = time.Duration(timeoutSec) * time.Second
+		}
+		result, err = sess.DownloadFile(ctx, selector, timeout)
+
 	default:
 		return tools.ErrorResult(fmt.Sprintf("unknown action: %s", action))
 	}
@@ -341,10 +396,13 @@ func (t *BrowserTool) doListSessions() *tools.ToolResult {
 // ---- helpers ----
 
 func (t *BrowserTool) formatResult(result *ActionResult) *tools.ToolResult {
-	// For screenshots and PDFs, return a summary (base64 is huge)
-	if result.Action == "screenshot" || result.Action == "pdf" {
+	// For screenshots, PDFs and downloads, return a summary (base64 is huge)
+	if result.Action == "screenshot" || result.Action == "pdf" || result.Action == "download" {
 		size, _ := result.Data["size"].(int)
 		summary := fmt.Sprintf("%s completed: %d bytes captured", result.Action, size)
+		if name, _ := result.Data["filename"].(string); name != "" {
+			summary += fmt.Sprintf(" (%s)", name)
+		}
 		// Attach the full data as JSON for downstream processing
 		fullJSON, _ := json.Marshal(result.Data)
 		return &tools.ToolResult{
@@ -0,0 +1,181 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DefaultNetworkIdle is how long WaitNetworkIdle requires the page to have
+// no requests in flight when idleFor is zero.
+const DefaultNetworkIdle = 500 * time.Millisecond
+
+// waitPollInterval is how often WaitForGone and WaitNetworkIdle re-check
+// the page.
+const waitPollInterval = 50 * time.Millisecond
+
+// WaitForGone waits until no element matches the selector, such as a
+// loading spinner an SPA removes once its data has arrived. It succeeds
+// immediately if the element is already absent.
+func (s *Session) WaitForGone(ctx context.Context, selector string, timeout time.Duration) (*ActionResult, error) {
+	page, err := s.getActivePage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		timeout = s.timeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	p := page.Context(waitCtx)
+
+	start := time.Now()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		has, _, err := p.Has(selector)
+		if err == nil && !has {
+			break
+		}
+		if err != nil && waitCtx.Err() == nil {
+			return nil, fmt.Errorf("wait_gone %s failed: %w", selector, err)
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%s still present after %v: %w", selector, time.Since(start).Round(time.Millisecond), waitCtx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return &ActionResult{
+		Action:  "wait_gone",
+		Success: true,
+		Data: map[string]any{
+			"selector": selector,
+			"elapsed":  time.Since(start).String(),
+		},
+	}, nil
+}
+
+// WaitNetworkIdle waits until the active page has had no network requests
+// in flight for idleFor (DefaultNetworkIdle if zero), giving up after
+// timeout (the session timeout if zero). Requests are tracked from CDP
+// Network events, so only requests started after the call are counted; a
+// page that polls continuously never becomes idle.
+func (s *Session) WaitNetworkIdle(ctx context.Context, idleFor, timeout time.Duration) (*ActionResult, error) {
+	page, err := s.getActivePage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if idleFor <= 0 {
+		idleFor = DefaultNetworkIdle
+	}
+	if timeout <= 0 {
+		timeout = s.timeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	p := page.Context(waitCtx)
+
+	if err := (proto.NetworkEnable{}).Call(p); err != nil {
+		return nil, fmt.Errorf("enable network events failed: %w", err)
+	}
+
+	start := time.Now()
+	tracker := newRequestTracker(start)
+	wait := p.EachEvent(func(e *proto.NetworkRequestWillBeSent) {
+		tracker.started(e.RequestID, time.Now())
+	}, func(e *proto.NetworkLoadingFinished) {
+		tracker.finished(e.RequestID, time.Now())
+	}, func(e *proto.NetworkLoadingFailed) {
+		tracker.finished(e.RequestID, time.Now())
+	})
+	go wait() // returns once waitCtx is done
+
+	ticker := time.NewTicker(min(waitPollInterval, idleFor))
+	defer ticker.Stop()
+	for !tracker.idle(time.Now(), idleFor) {
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("network not idle for %v within %v (%d request(s) in flight): %w",
+				idleFor, timeout, tracker.inFlight(), waitCtx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return &ActionResult{
+		Action:  "wait_idle",
+		Success: true,
+		Data: map[string]any{
+			"idle_for": idleFor.String(),
+			"elapsed":  time.Since(start).String(),
+			"requests": tracker.total(),
+		},
+	}, nil
+}
+
+// requestTracker counts a page's in-flight requests and when that count
+// last changed.
+type requestTracker struct {
+	mu       sync.Mutex
+	inflight map[proto.NetworkRequestID]bool
+	since    time.Time // last time a request started or finished
+	seen     int
+}
+
+func newRequestTracker(now time.Time) *requestTracker {
+	return &requestTracker{inflight: make(map[proto.NetworkRequestID]bool), since: now}
+}
+
+// started records a request. A redirect reuses its request's ID and is
+// not counted twice.
+func (t *requestTracker) started(id proto.NetworkRequestID, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.inflight[id] {
+		t.inflight[id] = true
+		t.seen++
+	}
+	t.since = now
+}
+
+// finished records a request ending. Requests that started before tracking
+// began are unknown and ignored.
+func (t *requestTracker) finished(id proto.NetworkRequestID, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inflight[id] {
+		delete(t.inflight, id)
+		t.since = now
+	}
+}
+
+// idle reports whether nothing has been in flight for at least idleFor.
+func (t *requestTracker) idle(now time.Time, idleFor time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inflight) == 0 && now.Sub(t.since) >= idleFor
+}
+
+func (t *requestTracker) inFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inflight)
+}
+
+func (t *requestTracker) total() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seen
+}
@@ -0,0 +1,140 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTracker_Idle(t *testing.T) {
+	start := time.Now()
+	tr := newRequestTracker(start)
+	idleFor := 500 * time.Millisecond
+
+	if tr.idle(start.Add(100*time.Millisecond), idleFor) {
+		t.Error("idle before idleFor elapsed")
+	}
+	if !tr.idle(start.Add(idleFor), idleFor) {
+		t.Error("not idle with no requests after idleFor")
+	}
+
+	tr.started("1", start.Add(time.Second))
+	tr.started("1", start.Add(1100*time.Millisecond)) // redirect
+	tr.started("2", start.Add(1200*time.Millisecond))
+	if tr.inFlight() != 2 || tr.total() != 2 {
+		t.Fatalf("inFlight = %d, total = %d, want 2, 2", tr.inFlight(), tr.total())
+	}
+	if tr.idle(start.Add(time.Hour), idleFor) {
+		t.Error("idle with requests in flight")
+	}
+
+	tr.finished("1", start.Add(2*time.Second))
+	tr.finished("unknown", start.Add(3*time.Second)) // started before tracking
+	tr.finished("2", start.Add(2500*time.Millisecond))
+	if tr.idle(start.Add(2900*time.Millisecond), idleFor) {
+		t.Error("idle before idleFor elapsed since the last request")
+	}
+	if !tr.idle(start.Add(3*time.Second), idleFor) {
+		t.Error("not idle idleFor after the last request finished")
+	}
+}
+
+func TestBrowserTool_Execute_WaitGoneMissingSelector(t *testing.T) {
+	tool := NewBrowserTool(nil)
+	result := tool.Execute(context.Background(), map[string]any{
+		"action": "wait_gone",
+	})
+	if !result.IsError {
+		t.Error("expected error for missing selector")
+	}
+}
+
+// asyncServer serves a page that shows a spinner until a slow /api/data
+// request, started after load, completes.
+func asyncServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+<div id="spinner">Loading...</div>
+<script>
+setTimeout(() => fetch("/api/data").then(r => r.text()).then(() => {
+	document.getElementById("spinner").remove();
+}), 100);
+</script>
+</body></html>`))
+	})
+	mux.HandleFunc("/api/data", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte(`{"nodes":3}`))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestIntegration_WaitForGone(t *testing.T) {
+	skipIfNoChrome(t)
+	ts := asyncServer(t, 300*time.Millisecond)
+
+	mgr := NewManager(ManagerConfig{Headless: true})
+	defer mgr.Close()
+	sess, err := mgr.NewSession("wait-gone")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := sess.Navigate(ctx, ts.URL); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+
+	_, err = sess.WaitForGone(ctx, "body", 200*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a timeout for an element that never goes", err)
+	}
+
+	result, err := sess.WaitForGone(ctx, "#spinner", 10*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForGone: %v", err)
+	}
+	if result.Action != "wait_gone" || result.Data["selector"] != "#spinner" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestIntegration_WaitNetworkIdle(t *testing.T) {
+	skipIfNoChrome(t)
+	ts := asyncServer(t, 400*time.Millisecond)
+
+	mgr := NewManager(ManagerConfig{Headless: true})
+	defer mgr.Close()
+	sess, err := mgr.NewSession("wait-idle")
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := sess.Navigate(ctx, ts.URL); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+
+	start := time.Now()
+	result, err := sess.WaitNetworkIdle(ctx, 300*time.Millisecond, 10*time.Second)
+	if err != nil {
+		t.Fatalf("WaitNetworkIdle: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 700*time.Millisecond {
+		t.Errorf("returned after %v, before the slow request finished and the page settled", elapsed)
+	}
+	if result.Action != "wait_idle" || result.Data["requests"].(int) < 1 {
+		t.Errorf("result = %+v, want the slow request counted", result)
+	}
+
+	// The spinner is gone once the request is done.
+	if _, err := sess.WaitForGone(ctx, "#spinner", time.Second); err != nil {
+		t.Errorf("spinner still present after network idle: %v", err)
+	}
+}
@@ -61,6 +61,15 @@ type Config struct {
 	Relay     RelayConfig     `json:"relay"`
 	Browser   BrowserConfig   `json:"browser"`
 	RBAC      RBACConfig      `json:"rbac"`
+	Deploy    DeployConfig    `json:"deploy,omitempty"`
+	Redact    RedactConfig    `json:"redact,omitempty"`
+
+	Observability ObservabilityConfig `json:"observability,omitempty"`
+
+	// Profiles are named partial configs merged over this one when
+	// selected; see LoadConfigWithProfile. Kept raw so saving the config
+	// writes them back unchanged.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
 }
 
 // FleetConfig configures the fleet management subsystem.
@@ -74,6 +83,34 @@ type FleetConfig struct {
 
 	// PostgreSQL settings (when store = "postgres")
 	Postgres PostgresStoreConfig `json:"postgres,omitempty"`
+
+	// MaxNodesPerDeploy caps how many nodes a single deploy may target (0 = no cap).
+	MaxNodesPerDeploy int `json:"max_nodes_per_deploy,omitempty" env:"DEVOPSCLAW_FLEET_MAX_NODES_PER_DEPLOY"`
+
+	// DefaultEnv is the env label targeted by fleet exec, fleet status,
+	// and deploy when neither --env nor --node is given. Usually set per
+	// profile, so "--profile staging" only reaches staging nodes.
+	DefaultEnv string `json:"default_env,omitempty" env:"DEVOPSCLAW_FLEET_DEFAULT_ENV"`
+
+	// DispatchRate is the default for fleet exec --rate: the most nodes a
+	// command starts on per second (0 = unpaced).
+	DispatchRate float64 `json:"dispatch_rate,omitempty" env:"DEVOPSCLAW_FLEET_DISPATCH_RATE"`
+
+	// GroupDispatchRate caps how many nodes of any one group commands
+	// start on per second, across all of a process's requests (0 = no cap).
+	GroupDispatchRate float64 `json:"group_dispatch_rate,omitempty" env:"DEVOPSCLAW_FLEET_GROUP_DISPATCH_RATE"`
+
+	// ExecutionRetentionDays is how many days of execution history
+	// fleet maintain keeps in the SQLite store when --retain is not given
+	// (0 = 30 days).
+	ExecutionRetentionDays int `json:"execution_retention_days,omitempty" env:"DEVOPSCLAW_FLEET_EXECUTION_RETENTION_DAYS"`
+}
+
+// DeployConfig configures the deploy command.
+type DeployConfig struct {
+	// WebhookURL receives a JSON summary when a deploy rolls back or fails
+	// (Slack incoming webhooks work as is).
+	WebhookURL string `json:"webhook_url,omitempty" env:"DEVOPSCLAW_DEPLOY_WEBHOOK_URL"`
 }
 
 // PostgresStoreConfig holds PostgreSQL connection parameters for the fleet store.
@@ -93,6 +130,19 @@ type RelayConfig struct {
 	AuthToken  string `json:"auth_token"  env:"DEVOPSCLAW_RELAY_AUTH_TOKEN"` // legacy, prefer mTLS
 	MaxNodes   int    `json:"max_nodes"   env:"DEVOPSCLAW_RELAY_MAX_NODES"`
 
+	// Record every command dispatched through the relay in the fleet store
+	AuditCommands bool `json:"audit_commands,omitempty" env:"DEVOPSCLAW_RELAY_AUDIT_COMMANDS"`
+
+	// Largest single WebSocket message accepted, in bytes (default 16 MiB),
+	// and whether to negotiate permessage-deflate compression. Both apply
+	// to the relay server and the agent.
+	MaxMessageBytes int64 `json:"max_message_bytes,omitempty" env:"DEVOPSCLAW_RELAY_MAX_MESSAGE_BYTES"`
+	Compression     bool  `json:"compression,omitempty"       env:"DEVOPSCLAW_RELAY_COMPRESSION"`
+
+	// Agent mode: output a command keeps, stdout and stderr each, before
+	// the rest is dropped (default 64 KiB). Requests can lower it.
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty" env:"DEVOPSCLAW_RELAY_MAX_OUTPUT_BYTES"`
+
 	// mTLS configuration (replaces auth_token)
 	MTLS RelayMTLSConfig `json:"mtls,omitempty"`
 
@@ -100,6 +150,31 @@ type RelayConfig struct {
 	RelayAddr string `json:"relay_addr" env:"DEVOPSCLAW_RELAY_ADDR"`
 	NodeID    string `json:"node_id"    env:"DEVOPSCLAW_RELAY_NODE_ID"`
 
+	// Agent command policy: "deny" (default) blocks known-dangerous commands;
+	// "allow" runs only commands matching AllowedCommands (exact, or "re:<regexp>").
+	CommandPolicy   string   `json:"command_policy,omitempty"   env:"DEVOPSCLAW_RELAY_COMMAND_POLICY"`
+	AllowedCommands []string `json:"allowed_commands,omitempty" env:"DEVOPSCLAW_RELAY_ALLOWED_COMMANDS"`
+
+	// Agent mode: run commands sent with --sudo through passwordless sudo.
+	// Off by default, so such commands are blocked.
+	AllowSudo bool `json:"allow_sudo,omitempty" env:"DEVOPSCLAW_RELAY_ALLOW_SUDO"`
+
+	// Serve POST /relay/exec so another process (e.g. an API server in an
+	// HA setup) can run commands on nodes connected to this relay. Callers
+	// need exec_token, or a client cert whose CN is in exec_clients; the
+	// agents' auth_token is not accepted.
+	ExecAPI     bool     `json:"exec_api,omitempty"     env:"DEVOPSCLAW_RELAY_EXEC_API"`
+	ExecToken   string   `json:"exec_token,omitempty"   env:"DEVOPSCLAW_RELAY_EXEC_TOKEN"`
+	ExecClients []string `json:"exec_clients,omitempty" env:"DEVOPSCLAW_RELAY_EXEC_CLIENTS"`
+
+	// How long the relay waits on shutdown for in-flight commands to
+	// finish before closing tunnels (default 30).
+	DrainTimeoutSec int `json:"drain_timeout_sec,omitempty" env:"DEVOPSCLAW_RELAY_DRAIN_TIMEOUT_SEC"`
+
+	// Per-credential agent restrictions: the node-ID prefixes a token or
+	// cert CN may register as and the command types sent to those agents.
+	ACLs []RelayACLConfig `json:"acls,omitempty"`
+
 	// HA configuration
 	HA RelayHAConfig `json:"ha,omitempty"`
 }
@@ -113,6 +188,21 @@ type RelayMTLSConfig struct {
 	ClientCertFile    string `json:"client_cert_file"   env:"DEVOPSCLAW_RELAY_MTLS_CLIENT_CERT"`
 	ClientKeyFile     string `json:"client_key_file"    env:"DEVOPSCLAW_RELAY_MTLS_CLIENT_KEY"`
 	RequireClientCert bool   `json:"require_client_cert" env:"DEVOPSCLAW_RELAY_MTLS_REQUIRE_CLIENT_CERT"`
+
+	// Agent: client_cert_file/client_key_file are re-read before every
+	// reconnect, so renewed certs are used without a restart; set this to
+	// keep the cert loaded at startup instead. The agent daemon also
+	// reloads them on SIGHUP.
+	DisableCertReload bool `json:"disable_cert_reload,omitempty" env:"DEVOPSCLAW_RELAY_MTLS_DISABLE_CERT_RELOAD"`
+}
+
+// RelayACLConfig restricts the agents that connect with one credential.
+// Empty lists allow anything.
+type RelayACLConfig struct {
+	Token        string   `json:"token,omitempty"`
+	CertCN       string   `json:"cert_cn,omitempty"`
+	NodePrefixes []string `json:"node_prefixes,omitempty"`
+	CommandTypes []string `json:"command_types,omitempty"`
 }
 
 // RelayHAConfig configures relay high availability.
@@ -123,10 +213,81 @@ type RelayHAConfig struct {
 	AdvertiseAddr  string   `json:"advertise_addr"   env:"DEVOPSCLAW_RELAY_HA_ADVERTISE_ADDR"`
 }
 
+// ObservabilityConfig configures telemetry export.
+type ObservabilityConfig struct {
+	OTLP OTLPConfig `json:"otlp,omitempty"`
+
+	// LLMPrices adds to or overrides the built-in per-model prices used
+	// for LLM cost accounting, keyed by model name or name prefix.
+	LLMPrices map[string]LLMPrice `json:"llm_prices,omitempty"`
+
+	TaskHistory TaskHistoryConfig `json:"task_history,omitempty"`
+}
+
+// TaskHistoryConfig configures the gateway's replayable log of agent tool
+// calls, kept in SQLite.
+type TaskHistoryConfig struct {
+	Path       string `json:"path,omitempty"         env:"DEVOPSCLAW_TASK_HISTORY_PATH"`         // default: ~/.devopsclaw/task_history.db
+	MaxAgeDays int    `json:"max_age_days,omitempty" env:"DEVOPSCLAW_TASK_HISTORY_MAX_AGE_DAYS"` // 0 = no age limit
+	MaxRecords int    `json:"max_records,omitempty"  env:"DEVOPSCLAW_TASK_HISTORY_MAX_RECORDS"`  // 0 = no count limit
+}
+
+// LLMPrice is a model's price in USD per million tokens.
+type LLMPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// OTLPConfig configures OTLP/HTTP trace export. Export is enabled when
+// Endpoint is set.
+type OTLPConfig struct {
+	Endpoint string            `json:"endpoint,omitempty" env:"DEVOPSCLAW_OTLP_ENDPOINT"` // e.g. http://collector:4318
+	Headers  map[string]string `json:"headers,omitempty"  env:"DEVOPSCLAW_OTLP_HEADERS"`  // "key:value,key2:value2"
+}
+
 // BrowserConfig configures the browser automation subsystem.
 type BrowserConfig struct {
 	Enabled  bool `json:"enabled"  env:"DEVOPSCLAW_BROWSER_ENABLED"`
 	Headless bool `json:"headless" env:"DEVOPSCLAW_BROWSER_HEADLESS"`
+
+	// CookiesFrom seeds every browser session with cookies from a curl
+	// command, Cookie header, cookies.txt, or HAR file. CookiesURL scopes
+	// cookies whose source names no domain, such as a bare Cookie header.
+	CookiesFrom string `json:"cookies_from,omitempty" env:"DEVOPSCLAW_BROWSER_COOKIES_FROM"`
+	CookiesURL  string `json:"cookies_url,omitempty"  env:"DEVOPSCLAW_BROWSER_COOKIES_URL"`
+
+	// ActionRetries retries click, type, wait_for, and navigate on transient
+	// failures; RetryBackoffMS is the first delay, doubling after each try.
+	ActionRetries  int `json:"action_retries,omitempty"   env:"DEVOPSCLAW_BROWSER_ACTION_RETRIES"`
+	RetryBackoffMS int `json:"retry_backoff_ms,omitempty" env:"DEVOPSCLAW_BROWSER_RETRY_BACKOFF_MS"`
+
+	// ProxyServer routes browser traffic through a proxy; hosts in
+	// ProxyBypass (Chrome bypass-list syntax) go direct.
+	ProxyServer string   `json:"proxy_server,omitempty" env:"DEVOPSCLAW_BROWSER_PROXY_SERVER"`
+	ProxyBypass []string `json:"proxy_bypass,omitempty" env:"DEVOPSCLAW_BROWSER_PROXY_BYPASS"`
+
+	// BasicAuthUser and BasicAuthPassword answer HTTP basic auth
+	// challenges from BasicAuthOrigin in every browser session; other
+	// origins never see them.
+	BasicAuthOrigin   string `json:"basic_auth_origin,omitempty"   env:"DEVOPSCLAW_BROWSER_BASIC_AUTH_ORIGIN"`
+	BasicAuthUser     string `json:"basic_auth_user,omitempty"     env:"DEVOPSCLAW_BROWSER_BASIC_AUTH_USER"`
+	BasicAuthPassword string `json:"basic_auth_password,omitempty" env:"DEVOPSCLAW_BROWSER_BASIC_AUTH_PASSWORD"`
+}
+
+// RedactConfig configures the secret masking applied to the audit log and
+// task history. The built-in patterns cover AWS keys, bearer and basic
+// credentials, GitHub tokens, private keys and password=... assignments.
+type RedactConfig struct {
+	Disabled bool `json:"disabled,omitempty" env:"DEVOPSCLAW_REDACT_DISABLED"`
+
+	// Patterns are extra regular expressions to mask. A group named
+	// "secret" limits the mask to that group. ReplaceDefaults drops the
+	// built-in patterns so only these apply.
+	Patterns        []string `json:"patterns,omitempty"`
+	ReplaceDefaults bool     `json:"replace_defaults,omitempty"`
+
+	// SkipFields opts fields out of masking by JSON key, e.g. "command".
+	SkipFields []string `json:"skip_fields,omitempty" env:"DEVOPSCLAW_REDACT_SKIP_FIELDS"`
 }
 
 // RBACConfig configures role-based access control.
@@ -252,6 +413,18 @@ type AgentDefaults struct {
 	MaxTokens           int      `json:"max_tokens"                      env:"DEVOPSCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
 	Temperature         *float64 `json:"temperature,omitempty"           env:"DEVOPSCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int      `json:"max_tool_iterations"             env:"DEVOPSCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+
+	CircuitBreaker ProviderBreakerConfig `json:"circuit_breaker,omitempty"`
+}
+
+// ProviderBreakerConfig configures the circuit breaker each provider in a
+// model fallback chain is called through. After MaxFailures failed calls
+// in a row the provider is skipped for ResetTimeoutSec, then one test call
+// is let through. Zero values mean 5 failures and 30 seconds.
+type ProviderBreakerConfig struct {
+	Disabled        bool `json:"disabled,omitempty"          env:"DEVOPSCLAW_AGENTS_DEFAULTS_CIRCUIT_BREAKER_DISABLED"`
+	MaxFailures     int  `json:"max_failures,omitempty"      env:"DEVOPSCLAW_AGENTS_DEFAULTS_CIRCUIT_BREAKER_MAX_FAILURES"`
+	ResetTimeoutSec int  `json:"reset_timeout_sec,omitempty" env:"DEVOPSCLAW_AGENTS_DEFAULTS_CIRCUIT_BREAKER_RESET_TIMEOUT_SEC"`
 }
 
 type ChannelsConfig struct {
@@ -527,10 +700,17 @@ type ExecConfig struct {
 	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"DEVOPSCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
 }
 
+// DockerToolsConfig configures the agent's docker tool, which drives the
+// docker CLI on the host.
+type DockerToolsConfig struct {
+	Enabled bool `json:"enabled" env:"DEVOPSCLAW_TOOLS_DOCKER_ENABLED"`
+}
+
 type ToolsConfig struct {
 	Web    WebToolsConfig    `json:"web"`
 	Cron   CronToolsConfig   `json:"cron"`
 	Exec   ExecConfig        `json:"exec"`
+	Docker DockerToolsConfig `json:"docker"`
 	Skills SkillsToolsConfig `json:"skills"`
 }
 
@@ -538,6 +718,14 @@ type SkillsToolsConfig struct {
 	Registries            SkillsRegistriesConfig `json:"registries"`
 	MaxConcurrentSearches int                    `json:"max_concurrent_searches" env:"DEVOPSCLAW_SKILLS_MAX_CONCURRENT_SEARCHES"`
 	SearchCache           SearchCacheConfig      `json:"search_cache"`
+	Index                 SkillsIndexConfig      `json:"index,omitempty"`
+}
+
+// SkillsIndexConfig points `skills search` and `skills install <name>` at a
+// remote skill catalog, cached locally for TTLSeconds (default 86400).
+type SkillsIndexConfig struct {
+	URL        string `json:"url,omitempty"         env:"DEVOPSCLAW_SKILLS_INDEX_URL"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty" env:"DEVOPSCLAW_SKILLS_INDEX_TTL_SECONDS"`
 }
 
 type SearchCacheConfig struct {
@@ -573,9 +761,15 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("parse %s: %w", path, DescribeJSONError(data, err))
 	}
 
+	return finalizeConfig(cfg)
+}
+
+// finalizeConfig applies environment overrides, migrates legacy provider
+// settings, and validates a config decoded from one or more files.
+func finalizeConfig(cfg *Config) (*Config, error) {
 	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
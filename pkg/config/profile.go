@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ProfileEnvVar selects a config profile when no --profile flag is given.
+const ProfileEnvVar = "DEVOPSCLAW_PROFILE"
+
+const (
+	profilesDirName   = "profiles"
+	activeProfileFile = "active_profile"
+	configFileName    = "config.json"
+	profilesKey       = "profiles" // inline profiles in config.json
+)
+
+// ProfilePath returns the path of the named profile under configDir,
+// e.g. ~/.devopsclaw/profiles/prod.json.
+func ProfilePath(configDir, name string) string {
+	return filepath.Join(configDir, profilesDirName, name+".json")
+}
+
+// ValidateProfileName rejects names that would escape the profiles directory.
+func ValidateProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+// ListProfiles returns the names of all profiles under configDir, sorted:
+// the profiles/<name>.json files and the keys of the "profiles" object in
+// configDir/config.json.
+func ListProfiles(configDir string) ([]string, error) {
+	seen := make(map[string]bool)
+	entries, err := os.ReadDir(filepath.Join(configDir, profilesDirName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		seen[strings.TrimSuffix(e.Name(), ".json")] = true
+	}
+
+	inline, err := readInlineProfiles(filepath.Join(configDir, configFileName))
+	if err != nil {
+		return nil, err
+	}
+	for name := range inline {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readInlineProfiles returns the "profiles" object of the config at path,
+// or nil if the file or the object does not exist.
+func readInlineProfiles(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	obj, err := decodeJSONObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, DescribeJSONError(data, err))
+	}
+	return inlineProfiles(obj), nil
+}
+
+// inlineProfiles returns the profiles defined in a decoded config.
+func inlineProfiles(obj map[string]any) map[string]any {
+	profiles, _ := obj[profilesKey].(map[string]any)
+	return profiles
+}
+
+// ActiveProfile returns the profile persisted by SetActiveProfile, or "" if
+// none is set.
+func ActiveProfile(configDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(configDir, activeProfileFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetActiveProfile persists name as the default profile. An empty name
+// clears it so the base config is used on its own.
+func SetActiveProfile(configDir, name string) error {
+	path := filepath.Join(configDir, activeProfileFile)
+	if name == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	names, err := ListProfiles(configDir)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(names, name) {
+		return unknownProfileError(configDir, name)
+	}
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(name+"\n"), 0o600)
+}
+
+// LoadProfile loads the config at path with profile merged over it, looking
+// for profile files next to path. An empty profile loads the config as is.
+func LoadProfile(path, profile string) (*Config, error) {
+	return LoadConfigWithProfile(path, filepath.Dir(path), profile)
+}
+
+// LoadConfigWithProfile loads the base config at path and, if profile is
+// non-empty, merges the named profile over it: first the entry in the base
+// config's "profiles" object, then configDir/profiles/<profile>.json, so
+// a profile file wins over an inline profile of the same name. Keys present
+// in a profile replace those in the base; nested objects are merged key by
+// key, while lists are replaced wholesale. Environment variables still take
+// precedence over both.
+func LoadConfigWithProfile(path, configDir, profile string) (*Config, error) {
+	if profile == "" {
+		return LoadConfig(path)
+	}
+	if err := ValidateProfileName(profile); err != nil {
+		return nil, err
+	}
+
+	var merged map[string]any
+	base, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if merged, err = decodeJSONObject(base); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, DescribeJSONError(base, err))
+		}
+	}
+
+	found := false
+	if inline, ok := inlineProfiles(merged)[profile]; ok {
+		layer, ok := inline.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("parse profile %q: %s.%s must be an object", profile, profilesKey, profile)
+		}
+		merged = mergeJSONObjects(merged, layer)
+		found = true
+	}
+
+	overlay, err := os.ReadFile(ProfilePath(configDir, profile))
+	switch {
+	case err == nil:
+		layer, err := decodeJSONObject(overlay)
+		if err != nil {
+			return nil, fmt.Errorf("parse profile %q: %w", profile, DescribeJSONError(overlay, err))
+		}
+		merged = mergeJSONObjects(merged, layer)
+		found = true
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	if !found {
+		return nil, unknownProfileError(configDir, profile)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("apply profile %q: %w", profile, DescribeJSONError(data, err))
+	}
+
+	return finalizeConfig(cfg)
+}
+
+// decodeJSONObject decodes a config file into a generic object, keeping
+// numbers as json.Number so large integers survive the round trip.
+func decodeJSONObject(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// mergeJSONObjects merges overlay into base recursively. Objects present in
+// both are merged; any other overlay value replaces the base value.
+func mergeJSONObjects(base, overlay map[string]any) map[string]any {
+	if base == nil {
+		base = make(map[string]any, len(overlay))
+	}
+	for k, v := range overlay {
+		if ov, ok := v.(map[string]any); ok {
+			if bv, ok := base[k].(map[string]any); ok {
+				base[k] = mergeJSONObjects(bv, ov)
+				continue
+			}
+		}
+		base[k] = v
+	}
+	return base
+}
+
+func unknownProfileError(configDir, name string) error {
+	available, _ := ListProfiles(configDir)
+	if len(available) == 0 {
+		return fmt.Errorf("unknown profile %q: no profiles in %s or %s", name,
+			filepath.Join(configDir, configFileName), filepath.Join(configDir, profilesDirName))
+	}
+	return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(available, ", "))
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeProfileFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll() error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+}
+
+func TestLoadConfigWithProfile_MergesOverBase(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeProfileFixture(t, configPath, `{
+		"relay": {"listen_addr": ":9443", "auth_token": "base-token", "max_nodes": 50},
+		"gateway": {"host": "127.0.0.1", "port": 18790}
+	}`)
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{
+		"relay": {"auth_token": "prod-token", "audit_commands": true}
+	}`)
+
+	cfg, err := LoadConfigWithProfile(configPath, dir, "prod")
+	if err != nil {
+		t.Fatalf("LoadConfigWithProfile() error: %v", err)
+	}
+	if cfg.Relay.AuthToken != "prod-token" {
+		t.Errorf("Relay.AuthToken = %q, want prod-token", cfg.Relay.AuthToken)
+	}
+	if !cfg.Relay.AuditCommands {
+		t.Error("Relay.AuditCommands should be set by the profile")
+	}
+	if cfg.Relay.ListenAddr != ":9443" || cfg.Relay.MaxNodes != 50 {
+		t.Errorf("base relay keys lost: listen_addr=%q max_nodes=%d", cfg.Relay.ListenAddr, cfg.Relay.MaxNodes)
+	}
+	if cfg.Gateway.Port != 18790 {
+		t.Errorf("Gateway.Port = %d, want 18790 from base", cfg.Gateway.Port)
+	}
+}
+
+func TestLoadConfigWithProfile_ReplacesLists(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeProfileFixture(t, configPath, `{"relay": {"ha": {"peer_addrs": ["a:9443", "b:9443"]}}}`)
+	writeProfileFixture(t, ProfilePath(dir, "staging"), `{"relay": {"ha": {"peer_addrs": ["c:9443"]}}}`)
+
+	cfg, err := LoadConfigWithProfile(configPath, dir, "staging")
+	if err != nil {
+		t.Fatalf("LoadConfigWithProfile() error: %v", err)
+	}
+	if want := []string{"c:9443"}; !reflect.DeepEqual(cfg.Relay.HA.PeerAddrs, want) {
+		t.Errorf("PeerAddrs = %v, want %v", cfg.Relay.HA.PeerAddrs, want)
+	}
+}
+
+func TestLoadConfigWithProfile_NoBaseConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeProfileFixture(t, ProfilePath(dir, "dev"), `{"relay": {"listen_addr": ":7443"}}`)
+
+	cfg, err := LoadConfigWithProfile(filepath.Join(dir, "config.json"), dir, "dev")
+	if err != nil {
+		t.Fatalf("LoadConfigWithProfile() error: %v", err)
+	}
+	if cfg.Relay.ListenAddr != ":7443" {
+		t.Errorf("Relay.ListenAddr = %q, want :7443", cfg.Relay.ListenAddr)
+	}
+	if cfg.Agents.Defaults.Workspace != DefaultConfig().Agents.Defaults.Workspace {
+		t.Error("defaults should apply when there is no base config")
+	}
+}
+
+func TestLoadConfigWithProfile_UnknownProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeProfileFixture(t, ProfilePath(dir, "dev"), `{}`)
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{}`)
+
+	_, err := LoadConfigWithProfile(filepath.Join(dir, "config.json"), dir, "qa")
+	if err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+	if !strings.Contains(err.Error(), `unknown profile "qa"`) || !strings.Contains(err.Error(), "dev, prod") {
+		t.Errorf("error = %q, want unknown profile with available list", err)
+	}
+}
+
+func TestLoadConfigWithProfile_InvalidName(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadConfigWithProfile(filepath.Join(dir, "config.json"), dir, "../config"); err == nil {
+		t.Fatal("expected error for profile name with path separator")
+	}
+}
+
+func TestListProfiles(t *testing.T) {
+	dir := t.TempDir()
+	if names, err := ListProfiles(dir); err != nil || len(names) != 0 {
+		t.Fatalf("ListProfiles() on empty dir = %v, %v", names, err)
+	}
+
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{}`)
+	writeProfileFixture(t, ProfilePath(dir, "dev"), `{}`)
+	writeProfileFixture(t, filepath.Join(dir, "profiles", "notes.txt"), "ignored")
+
+	names, err := ListProfiles(dir)
+	if err != nil {
+		t.Fatalf("ListProfiles() error: %v", err)
+	}
+	if want := []string{"dev", "prod"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListProfiles() = %v, want %v", names, want)
+	}
+}
+
+func TestSetActiveProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{}`)
+
+	if err := SetActiveProfile(dir, "missing"); err == nil {
+		t.Error("expected error when activating an unknown profile")
+	}
+
+	if err := SetActiveProfile(dir, "prod"); err != nil {
+		t.Fatalf("SetActiveProfile() error: %v", err)
+	}
+	if name, _ := ActiveProfile(dir); name != "prod" {
+		t.Errorf("ActiveProfile() = %q, want prod", name)
+	}
+
+	if err := SetActiveProfile(dir, ""); err != nil {
+		t.Fatalf("SetActiveProfile(clear) error: %v", err)
+	}
+	if name, _ := ActiveProfile(dir); name != "" {
+		t.Errorf("ActiveProfile() after clear = %q, want empty", name)
+	}
+}
+
+func TestLoadProfile_InlineProfile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeProfileFixture(t, configPath, `{
+		"relay": {"relay_addr": "wss://relay.example.com:9443", "auth_token": "base-token"},
+		"profiles": {
+			"staging": {"relay": {"relay_addr": "wss://relay.staging:9443"}, "fleet": {"default_env": "staging"}},
+			"prod": {"relay": {"auth_token": "prod-token"}}
+		}
+	}`)
+
+	cfg, err := LoadProfile(configPath, "staging")
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+	if cfg.Relay.RelayAddr != "wss://relay.staging:9443" || cfg.Fleet.DefaultEnv != "staging" {
+		t.Errorf("profile not applied: relay_addr=%q default_env=%q", cfg.Relay.RelayAddr, cfg.Fleet.DefaultEnv)
+	}
+	if cfg.Relay.AuthToken != "base-token" {
+		t.Errorf("Relay.AuthToken = %q, want base-token from the base config", cfg.Relay.AuthToken)
+	}
+
+	base, err := LoadProfile(configPath, "")
+	if err != nil {
+		t.Fatalf("LoadProfile() without a profile error: %v", err)
+	}
+	if base.Relay.RelayAddr != "wss://relay.example.com:9443" || base.Fleet.DefaultEnv != "" {
+		t.Errorf("base config changed without a profile: relay_addr=%q default_env=%q", base.Relay.RelayAddr, base.Fleet.DefaultEnv)
+	}
+	if len(base.Profiles) != 2 {
+		t.Errorf("Profiles = %d entries, want 2 kept for saving", len(base.Profiles))
+	}
+}
+
+func TestLoadProfile_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeProfileFixture(t, configPath, `{
+		"relay": {"relay_addr": "base:9443", "auth_token": "base-token", "node_id": "base-node"},
+		"profiles": {"prod": {"relay": {"relay_addr": "inline:9443", "auth_token": "inline-token"}}}
+	}`)
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{"relay": {"auth_token": "file-token"}}`)
+	t.Setenv("DEVOPSCLAW_RELAY_NODE_ID", "env-node")
+
+	cfg, err := LoadProfile(configPath, "prod")
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+	// base < inline profile < profile file < environment
+	if cfg.Relay.RelayAddr != "inline:9443" {
+		t.Errorf("Relay.RelayAddr = %q, want inline:9443", cfg.Relay.RelayAddr)
+	}
+	if cfg.Relay.AuthToken != "file-token" {
+		t.Errorf("Relay.AuthToken = %q, want file-token", cfg.Relay.AuthToken)
+	}
+	if cfg.Relay.NodeID != "env-node" {
+		t.Errorf("Relay.NodeID = %q, want env-node", cfg.Relay.NodeID)
+	}
+}
+
+func TestLoadProfile_UnknownInlineProfile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeProfileFixture(t, configPath, `{"profiles": {"staging": {}, "prod": {}}}`)
+
+	_, err := LoadProfile(configPath, "qa")
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "qa" (available: prod, staging)`) {
+		t.Errorf("error = %v, want unknown profile with the inline profiles listed", err)
+	}
+
+	writeProfileFixture(t, configPath, `{"profiles": {"prod": "oops"}}`)
+	if _, err := LoadProfile(configPath, "prod"); err == nil || !strings.Contains(err.Error(), "must be an object") {
+		t.Errorf("error = %v, want a non-object profile rejected", err)
+	}
+}
+
+func TestListProfiles_IncludesInline(t *testing.T) {
+	dir := t.TempDir()
+	writeProfileFixture(t, filepath.Join(dir, "config.json"), `{"profiles": {"staging": {}, "prod": {}}}`)
+	writeProfileFixture(t, ProfilePath(dir, "prod"), `{}`)
+	writeProfileFixture(t, ProfilePath(dir, "dev"), `{}`)
+
+	names, err := ListProfiles(dir)
+	if err != nil {
+		t.Fatalf("ListProfiles() error: %v", err)
+	}
+	if want := []string{"dev", "prod", "staging"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListProfiles() = %v, want %v", names, want)
+	}
+	if err := SetActiveProfile(dir, "staging"); err != nil {
+		t.Errorf("SetActiveProfile() for an inline profile error: %v", err)
+	}
+}
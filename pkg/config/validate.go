@@ -0,0 +1,263 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxRelayNodes is the largest relay.max_nodes accepted by Validate.
+const MaxRelayNodes = 100000
+
+// ValidationError is one problem found by Validate.
+type ValidationError struct {
+	Field  string `json:"field"` // JSON path, e.g. "relay.listen_addr"
+	Reason string `json:"reason"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// Validate checks cfg for settings that decode fine but cannot work: bad
+// relay addresses, out-of-range limits, missing mTLS files, unknown enum
+// values, and settings that exclude each other. It returns every problem
+// found, in field order; nil means the config is valid.
+func Validate(cfg *Config) []ValidationError {
+	var errs []ValidationError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	cb := cfg.Agents.Defaults.CircuitBreaker
+	if cb.MaxFailures < 0 {
+		add("agents.defaults.circuit_breaker.max_failures", "must not be negative")
+	}
+	if cb.ResetTimeoutSec < 0 {
+		add("agents.defaults.circuit_breaker.reset_timeout_sec", "must not be negative")
+	}
+
+	switch cfg.Fleet.Store {
+	case "", "memory", "sqlite":
+	case "postgres":
+		if cfg.Fleet.Postgres.Host == "" {
+			add("fleet.postgres.host", "required when fleet.store is \"postgres\"")
+		}
+	default:
+		add("fleet.store", "unknown store %q (want memory, sqlite, or postgres)", cfg.Fleet.Store)
+	}
+	if cfg.Fleet.SQLitePath != "" && cfg.Fleet.Store != "sqlite" {
+		add("fleet.sqlite_path", "set but fleet.store is %q, not \"sqlite\"", cfg.Fleet.Store)
+	}
+	if p := cfg.Fleet.Postgres.Port; p < 0 || p > 65535 {
+		add("fleet.postgres.port", "%d is out of range 1-65535", p)
+	}
+	if cfg.Fleet.MaxNodesPerDeploy < 0 {
+		add("fleet.max_nodes_per_deploy", "must not be negative")
+	}
+
+	r := cfg.Relay
+	if r.ListenAddr != "" {
+		if err := checkListenAddr(r.ListenAddr); err != nil {
+			add("relay.listen_addr", "%v", err)
+		}
+	}
+	if r.MaxNodes < 0 || r.MaxNodes > MaxRelayNodes {
+		add("relay.max_nodes", "%d is out of range 0-%d", r.MaxNodes, MaxRelayNodes)
+	}
+	if r.DrainTimeoutSec < 0 {
+		add("relay.drain_timeout_sec", "must not be negative")
+	}
+	if r.MaxMessageBytes < 0 {
+		add("relay.max_message_bytes", "must not be negative")
+	}
+	if r.RelayAddr != "" {
+		if err := checkRelayAddr(r.RelayAddr); err != nil {
+			add("relay.relay_addr", "%v", err)
+		}
+	}
+	switch r.CommandPolicy {
+	case "", "deny":
+		if len(r.AllowedCommands) > 0 {
+			add("relay.allowed_commands", "only used when relay.command_policy is \"allow\"")
+		}
+	case "allow":
+	default:
+		add("relay.command_policy", "unknown policy %q (want deny or allow)", r.CommandPolicy)
+	}
+
+	if r.ExecAPI && r.ExecToken == "" && len(r.ExecClients) == 0 {
+		add("relay.exec_api", "requires relay.exec_token or relay.exec_clients; /relay/exec refuses every caller without them")
+	}
+	if r.ExecToken != "" && r.ExecToken == r.AuthToken {
+		add("relay.exec_token", "must differ from relay.auth_token, which every agent holds")
+	}
+
+	for i, acl := range r.ACLs {
+		field := fmt.Sprintf("relay.acls[%d]", i)
+		switch {
+		case (acl.Token == "") == (acl.CertCN == ""):
+			add(field, "set exactly one of token or cert_cn")
+		case acl.CertCN != "" && !r.MTLS.Enabled:
+			add(field+".cert_cn", "requires relay.mtls.enabled")
+		}
+	}
+
+	if r.MTLS.Enabled {
+		if r.AuthToken != "" {
+			add("relay.auth_token", "cannot be combined with relay.mtls.enabled; mTLS replaces the token")
+		}
+		if r.MTLS.CACertFile == "" {
+			add("relay.mtls.ca_cert_file", "required when relay.mtls.enabled is true")
+		}
+		// The relay needs the server pair and an agent the client pair.
+		if r.MTLS.ServerCertFile == "" && r.MTLS.ServerKeyFile == "" &&
+			r.MTLS.ClientCertFile == "" && r.MTLS.ClientKeyFile == "" {
+			add("relay.mtls", "enabled but neither server_cert_file/server_key_file nor client_cert_file/client_key_file is set")
+		}
+		if (r.MTLS.ServerCertFile == "") != (r.MTLS.ServerKeyFile == "") {
+			add("relay.mtls.server_key_file", "server_cert_file and server_key_file must be set together")
+		}
+		if (r.MTLS.ClientCertFile == "") != (r.MTLS.ClientKeyFile == "") {
+			add("relay.mtls.client_key_file", "client_cert_file and client_key_file must be set together")
+		}
+		for _, f := range []struct{ field, path string }{
+			{"relay.mtls.ca_cert_file", r.MTLS.CACertFile},
+			{"relay.mtls.server_cert_file", r.MTLS.ServerCertFile},
+			{"relay.mtls.server_key_file", r.MTLS.ServerKeyFile},
+			{"relay.mtls.client_cert_file", r.MTLS.ClientCertFile},
+			{"relay.mtls.client_key_file", r.MTLS.ClientKeyFile},
+		} {
+			if f.path == "" {
+				continue
+			}
+			if _, err := os.Stat(expandHome(f.path)); err != nil {
+				add(f.field, "cannot read %s: %v", f.path, unwrapPathError(err))
+			}
+		}
+	}
+
+	if r.HA.Enabled && r.HA.InstanceID == "" {
+		add("relay.ha.instance_id", "required when relay.ha.enabled is true")
+	}
+	for i, peer := range r.HA.PeerAddrs {
+		if _, _, err := net.SplitHostPort(peer); err != nil {
+			add(fmt.Sprintf("relay.ha.peer_addrs[%d]", i), "%q is not host:port", peer)
+		}
+	}
+
+	if cfg.Browser.BasicAuthUser != "" && cfg.Browser.BasicAuthOrigin == "" {
+		add("browser.basic_auth_origin", "required when browser.basic_auth_user is set; credentials are only sent to that origin")
+	}
+
+	for i, expr := range cfg.Redact.Patterns {
+		if _, err := regexp.Compile(expr); err != nil {
+			add(fmt.Sprintf("redact.patterns[%d]", i), "%v", err)
+		}
+	}
+
+	th := cfg.Observability.TaskHistory
+	if th.MaxAgeDays < 0 {
+		add("observability.task_history.max_age_days", "must not be negative")
+	}
+	if th.MaxRecords < 0 {
+		add("observability.task_history.max_records", "must not be negative")
+	}
+
+	return errs
+}
+
+// checkListenAddr reports whether addr is a host:port the relay can bind,
+// such as ":9443" or "0.0.0.0:9443".
+func checkListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%q is not host:port (e.g. \":9443\")", addr)
+	}
+	return checkPort(addr, port)
+}
+
+// checkRelayAddr accepts the forms the agent dials: a ws:// or wss:// URL,
+// or a bare host:port.
+func checkRelayAddr(addr string) error {
+	if !strings.Contains(addr, "://") {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" {
+			return fmt.Errorf("%q is not a ws:// or wss:// URL or host:port", addr)
+		}
+		return checkPort(addr, port)
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL", addr)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("scheme %q is not ws or wss", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%q has no host", addr)
+	}
+	if port := u.Port(); port != "" {
+		return checkPort(addr, port)
+	}
+	return nil
+}
+
+func checkPort(addr, port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q has invalid port %q", addr, port)
+	}
+	return nil
+}
+
+// unwrapPathError drops the path from an *os.PathError, since the caller
+// already names the file.
+func unwrapPathError(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// DescribeJSONError rewrites a decode error from a config file into one
+// that names where the problem is: the line and column of a syntax error,
+// or the field path of a value with the wrong type. Other errors are
+// returned unchanged.
+func DescribeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, col := lineCol(data, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %s", line, col, syntaxErr.Error())
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("%s: expected %s, got JSON %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return err
+}
+
+// lineCol converts a byte offset into a 1-based line and column.
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col = 1, 1
+	// Offset counts the bytes read, including the one that failed.
+	for _, b := range data[:max(offset-1, 0)] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
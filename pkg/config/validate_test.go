@@ -0,0 +1,230 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate_Default(t *testing.T) {
+	if errs := Validate(DefaultConfig()); len(errs) != 0 {
+		t.Errorf("default config should be valid, got %v", errs)
+	}
+}
+
+func TestValidate_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, []byte("ca"), 0o600)
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		want   []string // field paths, in order
+	}{
+		{
+			name: "negative circuit breaker settings",
+			mutate: func(c *Config) {
+				c.Agents.Defaults.CircuitBreaker = ProviderBreakerConfig{MaxFailures: -1, ResetTimeoutSec: -30}
+			},
+			want: []string{"agents.defaults.circuit_breaker.max_failures", "agents.defaults.circuit_breaker.reset_timeout_sec"},
+		},
+		{
+			name:   "listen addr without colon",
+			mutate: func(c *Config) { c.Relay.ListenAddr = "9443" },
+			want:   []string{"relay.listen_addr"},
+		},
+		{
+			name:   "listen addr bad port",
+			mutate: func(c *Config) { c.Relay.ListenAddr = ":94430" },
+			want:   []string{"relay.listen_addr"},
+		},
+		{
+			name: "max nodes out of bounds and bad relay url",
+			mutate: func(c *Config) {
+				c.Relay.MaxNodes = -1
+				c.Relay.RelayAddr = "http://relay:9443"
+			},
+			want: []string{"relay.max_nodes", "relay.relay_addr"},
+		},
+		{
+			name:   "max nodes over limit",
+			mutate: func(c *Config) { c.Relay.MaxNodes = MaxRelayNodes + 1 },
+			want:   []string{"relay.max_nodes"},
+		},
+		{
+			name: "mtls missing files and token",
+			mutate: func(c *Config) {
+				c.Relay.AuthToken = "secret"
+				c.Relay.MTLS = RelayMTLSConfig{
+					Enabled:        true,
+					CACertFile:     caFile,
+					ServerCertFile: missing,
+					ClientCertFile: caFile,
+				}
+			},
+			want: []string{
+				"relay.auth_token",
+				"relay.mtls.server_key_file",
+				"relay.mtls.client_key_file",
+				"relay.mtls.server_cert_file",
+			},
+		},
+		{
+			name: "mtls agent with client pair only",
+			mutate: func(c *Config) {
+				c.Relay.MTLS = RelayMTLSConfig{
+					Enabled:        true,
+					CACertFile:     caFile,
+					ClientCertFile: caFile,
+					ClientKeyFile:  caFile,
+				}
+			},
+		},
+		{
+			name: "mtls without any pair",
+			mutate: func(c *Config) {
+				c.Relay.MTLS = RelayMTLSConfig{Enabled: true}
+			},
+			want: []string{"relay.mtls.ca_cert_file", "relay.mtls"},
+		},
+		{
+			name: "mtls disabled ignores files",
+			mutate: func(c *Config) {
+				c.Relay.AuthToken = "secret"
+				c.Relay.MTLS = RelayMTLSConfig{ServerCertFile: missing}
+			},
+		},
+		{
+			name: "command policy",
+			mutate: func(c *Config) {
+				c.Relay.AllowedCommands = []string{"uptime"}
+			},
+			want: []string{"relay.allowed_commands"},
+		},
+		{
+			name: "relay acls",
+			mutate: func(c *Config) {
+				c.Relay.ACLs = []RelayACLConfig{
+					{Token: "web-token", NodePrefixes: []string{"web-"}},
+					{NodePrefixes: []string{"db-"}},
+					{CertCN: "db-1"},
+				}
+			},
+			want: []string{"relay.acls[1]", "relay.acls[2].cert_cn"},
+		},
+		{
+			name: "exec api without its own credential",
+			mutate: func(c *Config) {
+				c.Relay.AuthToken = "shared"
+				c.Relay.ExecAPI = true
+			},
+			want: []string{"relay.exec_api"},
+		},
+		{
+			name: "exec token reuses the agent token",
+			mutate: func(c *Config) {
+				c.Relay.AuthToken = "shared"
+				c.Relay.ExecAPI = true
+				c.Relay.ExecToken = "shared"
+			},
+			want: []string{"relay.exec_token"},
+		},
+		{
+			name: "browser basic auth without an origin",
+			mutate: func(c *Config) {
+				c.Browser.BasicAuthUser = "ops"
+			},
+			want: []string{"browser.basic_auth_origin"},
+		},
+		{
+			name: "fleet store",
+			mutate: func(c *Config) {
+				c.Fleet.Store = "mysql"
+				c.Fleet.SQLitePath = "/tmp/fleet.db"
+				c.Relay.CommandPolicy = "permit"
+			},
+			want: []string{"fleet.store", "fleet.sqlite_path", "relay.command_policy"},
+		},
+		{
+			name: "postgres and ha",
+			mutate: func(c *Config) {
+				c.Fleet.Store = "postgres"
+				c.Relay.HA = RelayHAConfig{Enabled: true, PeerAddrs: []string{"relay-2:9443", "relay-3"}}
+			},
+			want: []string{"fleet.postgres.host", "relay.ha.instance_id", "relay.ha.peer_addrs[1]"},
+		},
+		{
+			name: "redact patterns",
+			mutate: func(c *Config) {
+				c.Redact.Patterns = []string{`(?P<secret>xoxb-[0-9a-z-]+)`, `token=(`}
+			},
+			want: []string{"redact.patterns[1]"},
+		},
+		{
+			name: "task history retention",
+			mutate: func(c *Config) {
+				c.Observability.TaskHistory = TaskHistoryConfig{MaxAgeDays: -1, MaxRecords: -5}
+			},
+			want: []string{"observability.task_history.max_age_days", "observability.task_history.max_records"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.mutate(cfg)
+
+			var got []string
+			for _, e := range Validate(cfg) {
+				if e.Reason == "" {
+					t.Errorf("%s: empty reason", e.Field)
+				}
+				got = append(got, e.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_RelayAddrForms(t *testing.T) {
+	for _, addr := range []string{"ws://localhost:9443", "wss://relay.example.com", "relay.example.com:9443"} {
+		if err := checkRelayAddr(addr); err != nil {
+			t.Errorf("%q: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"relay.example.com", "ws://:9443", "wss://relay:0", "tcp://relay:9443"} {
+		if err := checkRelayAddr(addr); err == nil {
+			t.Errorf("%q: expected an error", addr)
+		}
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	e := ValidationError{Field: "relay.listen_addr", Reason: "bad"}
+	if e.Error() != "relay.listen_addr: bad" {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
+
+func TestLoadConfig_DescribesJSONErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	os.WriteFile(path, []byte("{\n  \"relay\": {\n    \"listen_addr\": \":9443\",,\n  }\n}\n"), 0o600)
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 28") {
+		t.Errorf("syntax error = %v, want line 3, column 28", err)
+	}
+
+	os.WriteFile(path, []byte(`{"relay": {"max_nodes": "lots"}}`), 0o600)
+	_, err = LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "relay.max_nodes: expected int, got JSON string") {
+		t.Errorf("type error = %v, want field path", err)
+	}
+}
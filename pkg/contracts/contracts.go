@@ -11,6 +11,7 @@
 package contracts
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -32,6 +33,11 @@ type ToolContract[Req any, Resp any] struct {
 
 	// Execute runs the tool with typed input and produces typed output.
 	Execute func(req *Req) (*Resp, error)
+
+	// ExecuteContext, when set, is used instead of Execute and is given
+	// the caller's context, for tools that should stop when the call is
+	// cancelled.
+	ExecuteContext func(ctx context.Context, req *Req) (*Resp, error)
 }
 
 // ToolMeta is the untyped metadata for registration/discovery.
@@ -291,31 +297,55 @@ type FleetNodeResult struct {
 // type-safe execution plus LLM-compatible schema generation.
 type Registry struct {
 	tools map[string]ToolMeta
-	executors map[string]func(json.RawMessage) (json.RawMessage, error)
+	executors map[string]func(context.Context, json.RawMessage) (json.RawMessage, error)
+
+	successors map[string]string // old tool name → tool whose Supersedes names it
+	migrations map[string]func(json.RawMessage) (json.RawMessage, error)
 }
 
 // NewRegistry creates a typed tool contract registry.
 func NewRegistry() *Registry {
 	return &Registry{
 		tools:     make(map[string]ToolMeta),
-		executors: make(map[string]func(json.RawMessage) (json.RawMessage, error)),
+		executors: make(map[string]func(context.Context, json.RawMessage) (json.RawMessage, error)),
+		successors: make(map[string]string),
+		migrations: make(map[string]func(json.RawMessage) (json.RawMessage, error)),
 	}
 }
 
-// Register adds a typed tool contract to the registry.
+// Register adds a typed tool contract to the registry. If schema.Parameters
+// is nil, it is generated from Req with GenerateSchema. Requests are checked
+// against Req's `validate` tags with ValidateStruct before contract.Validate
+// and contract.Execute run. If schema.Supersedes names an older tool, calls
+// to that tool are routed here (see Execute).
 func Register[Req any, Resp any](r *Registry, contract ToolContract[Req, Resp], schema ToolMeta) {
+	if schema.Parameters == nil {
+		schema.Parameters = GenerateSchema[Req]()
+	}
 	r.tools[contract.ToolName] = schema
-	r.executors[contract.ToolName] = func(raw json.RawMessage) (json.RawMessage, error) {
+	if schema.Supersedes != "" && schema.Supersedes != contract.ToolName {
+		r.successors[schema.Supersedes] = contract.ToolName
+	}
+	r.executors[contract.ToolName] = func(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
 		var req Req
 		if err := json.Unmarshal(raw, &req); err != nil {
 			return nil, fmt.Errorf("invalid request for %s: %w", contract.ToolName, err)
 		}
+		if err := ValidateStruct(&req); err != nil {
+			return nil, fmt.Errorf("validation failed for %s: %w", contract.ToolName, err)
+		}
 		if contract.Validate != nil {
 			if err := contract.Validate(&req); err != nil {
 				return nil, fmt.Errorf("validation failed for %s: %w", contract.ToolName, err)
 			}
 		}
-		resp, err := contract.Execute(&req)
+		var resp *Resp
+		var err error
+		if contract.ExecuteContext != nil {
+			resp, err = contract.ExecuteContext(ctx, &req)
+		} else {
+			resp, err = contract.Execute(&req)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -325,12 +355,24 @@ func Register[Req any, Resp any](r *Registry, contract ToolContract[Req, Resp],
 
 // Execute runs a tool by name with raw JSON input, returning raw JSON output.
 // This is the bridge between the LLM tool-calling interface and typed contracts.
+// A call to a tool that another tool supersedes runs the replacement
+// instead, with the input passed through any registered migration.
 func (r *Registry) Execute(name string, input json.RawMessage) (json.RawMessage, error) {
+	return r.ExecuteContext(context.Background(), name, input)
+}
+
+// ExecuteContext is Execute with a context, which is passed to tools that
+// set ExecuteContext.
+func (r *Registry) ExecuteContext(ctx context.Context, name string, input json.RawMessage) (json.RawMessage, error) {
+	name, input, err := r.route(name, input)
+	if err != nil {
+		return nil, err
+	}
 	exec, ok := r.executors[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown tool: %s", name)
 	}
-	return exec(input)
+	return exec(ctx, input)
 }
 
 // ListTools returns metadata for all registered tools.
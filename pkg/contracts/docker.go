@@ -0,0 +1,224 @@
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------------
+// Docker tool
+// ------------------------------------------------------------------
+
+// ErrDockerNotInstalled is returned when the docker CLI is not on PATH.
+var ErrDockerNotInstalled = errors.New("docker is not installed (no docker binary on PATH)")
+
+// dockerTimeout bounds one docker invocation; pulls of large images are
+// the slowest.
+const dockerTimeout = 10 * time.Minute
+
+// defaultDockerTailLines is how many log lines the logs action returns
+// when the request doesn't say.
+const defaultDockerTailLines = 100
+
+// DockerRunner runs the docker CLI with args and returns its stdout,
+// stderr and exit code. err is for failing to run docker at all, not for
+// a non-zero exit.
+type DockerRunner func(ctx context.Context, args []string) (stdout, stderr []byte, exitCode int, err error)
+
+// NewDockerContract returns the "docker" tool backed by run, or by the
+// docker CLI on PATH when run is nil. Arguments are passed to docker as an
+// argv array, never through a shell.
+func NewDockerContract(run DockerRunner) ToolContract[DockerExecRequest, DockerExecResponse] {
+	if run == nil {
+		run = execDocker
+	}
+	return ToolContract[DockerExecRequest, DockerExecResponse]{
+		ToolName:    "docker",
+		ToolVersion: "1.0.0",
+		Description: "Manage Docker containers: run, stop, restart, logs, ps, pull, inspect",
+		Category:    "docker",
+		Validate: func(req *DockerExecRequest) error {
+			_, err := dockerArgs(req)
+			return err
+		},
+		ExecuteContext: func(ctx context.Context, req *DockerExecRequest) (*DockerExecResponse, error) {
+			args, err := dockerArgs(req)
+			if err != nil {
+				return nil, err
+			}
+			ctx, cancel := context.WithTimeout(ctx, dockerTimeout)
+			defer cancel()
+			stdout, stderr, code, err := run(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			return dockerResponse(req, stdout, stderr, code), nil
+		},
+	}
+}
+
+// RegisterDocker adds the docker tool, run by the docker CLI, to r.
+func RegisterDocker(r *Registry) {
+	c := NewDockerContract(nil)
+	Register(r, c, ToolMeta{
+		Name:        c.ToolName,
+		Version:     c.ToolVersion,
+		Description: c.Description,
+		Category:    c.Category,
+		Returns:     GenerateSchema[DockerExecResponse](),
+	})
+}
+
+// dockerArgs builds the docker argv for req. Flag values are joined to
+// their flag ("--env=K=V"), and the image and container, which docker
+// reads as positional arguments, may not start with "-", so no field can
+// smuggle in an extra flag.
+func dockerArgs(req *DockerExecRequest) ([]string, error) {
+	needs := func(field, value string) error {
+		if value == "" {
+			return fmt.Errorf("docker %s requires %s", req.Action, field)
+		}
+		if strings.HasPrefix(value, "-") {
+			return fmt.Errorf("docker %s: %s %q must not start with '-'", req.Action, field, value)
+		}
+		return nil
+	}
+
+	switch req.Action {
+	case "run":
+		if err := needs("image", req.Image); err != nil {
+			return nil, err
+		}
+		args := []string{"run", "--detach"}
+		if req.Container != "" {
+			args = append(args, "--name="+req.Container)
+		}
+		for _, p := range req.Ports {
+			args = append(args, "--publish="+p)
+		}
+		keys := make([]string, 0, len(req.Env))
+		for k := range req.Env {
+			if k == "" || strings.Contains(k, "=") {
+				return nil, fmt.Errorf("docker run: invalid env name %q", k)
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "--env="+k+"="+req.Env[k])
+		}
+		for _, v := range req.Volumes {
+			args = append(args, "--volume="+v)
+		}
+		args = append(args, req.Image)
+		return append(args, req.Command...), nil
+
+	case "stop", "restart", "inspect":
+		if err := needs("container", req.Container); err != nil {
+			return nil, err
+		}
+		return []string{req.Action, req.Container}, nil
+
+	case "logs":
+		if err := needs("container", req.Container); err != nil {
+			return nil, err
+		}
+		tail := req.TailLines
+		if tail <= 0 {
+			tail = defaultDockerTailLines
+		}
+		return []string{"logs", "--tail=" + strconv.Itoa(tail), req.Container}, nil
+
+	case "ps":
+		args := []string{"ps", "--all", "--no-trunc"}
+		if req.Container != "" {
+			args = append(args, "--filter=name="+req.Container)
+		}
+		return args, nil
+
+	case "pull":
+		if err := needs("image", req.Image); err != nil {
+			return nil, err
+		}
+		return []string{"pull", req.Image}, nil
+	}
+	return nil, fmt.Errorf("unknown docker action %q", req.Action)
+}
+
+// dockerResponse interprets the output of the docker command for req. A
+// failed command is reported through ExitCode and Status "failed", with
+// docker's error message in Output.
+func dockerResponse(req *DockerExecRequest, stdout, stderr []byte, exitCode int) *DockerExecResponse {
+	resp := &DockerExecResponse{Output: string(stdout), ExitCode: exitCode}
+	if exitCode != 0 {
+		resp.Output = strings.TrimSpace(string(stderr) + "\n" + string(stdout))
+		resp.Status = "failed"
+		return resp
+	}
+
+	switch req.Action {
+	case "run":
+		// docker run --detach prints the new container's ID, after any
+		// pull progress on stderr.
+		resp.ContainerID = lastLine(stdout)
+		resp.Status = "running"
+	case "stop":
+		resp.Status = "exited"
+	case "restart":
+		resp.Status = "running"
+	case "logs":
+		// Containers log to both streams; docker replays each on its own.
+		resp.Output = string(stdout) + string(stderr)
+	case "inspect":
+		var info []struct {
+			ID    string `json:"Id"`
+			State struct {
+				Status   string `json:"Status"`
+				ExitCode int    `json:"ExitCode"`
+			} `json:"State"`
+		}
+		if err := json.Unmarshal(stdout, &info); err == nil && len(info) > 0 {
+			resp.ContainerID = info[0].ID
+			resp.Status = info[0].State.Status
+		}
+	}
+	return resp
+}
+
+// lastLine returns the last non-empty line of b.
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// execDocker runs the docker CLI on PATH.
+func execDocker(ctx context.Context, args []string) ([]byte, []byte, int, error) {
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, nil, 0, ErrDockerNotInstalled
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, nil, 0, fmt.Errorf("docker %s: %w", args[0], ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.Bytes(), stderr.Bytes(), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), 0, nil
+}
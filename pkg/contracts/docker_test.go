@@ -0,0 +1,200 @@
+package contracts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDockerArgs_Run(t *testing.T) {
+	req := &DockerExecRequest{
+		Action:    "run",
+		Image:     "nginx:1.27",
+		Container: "web",
+		Ports:     []string{"8080:80", "8443:443"},
+		Env:       map[string]string{"TZ": "UTC", "MODE": "prod; rm -rf /"},
+		Volumes:   []string{"/srv/www:/usr/share/nginx/html:ro"},
+		Command:   []string{"nginx", "-g", "daemon off;"},
+	}
+	got, err := dockerArgs(req)
+	if err != nil {
+		t.Fatalf("dockerArgs: %v", err)
+	}
+	want := []string{
+		"run", "--detach", "--name=web",
+		"--publish=8080:80", "--publish=8443:443",
+		"--env=MODE=prod; rm -rf /", "--env=TZ=UTC",
+		"--volume=/srv/www:/usr/share/nginx/html:ro",
+		"nginx:1.27", "nginx", "-g", "daemon off;",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("argv =\n  %q\nwant\n  %q", got, want)
+	}
+}
+
+func TestDockerArgs_Actions(t *testing.T) {
+	tests := []struct {
+		req  DockerExecRequest
+		want []string
+	}{
+		{DockerExecRequest{Action: "stop", Container: "web"}, []string{"stop", "web"}},
+		{DockerExecRequest{Action: "restart", Container: "web"}, []string{"restart", "web"}},
+		{DockerExecRequest{Action: "inspect", Container: "web"}, []string{"inspect", "web"}},
+		{DockerExecRequest{Action: "logs", Container: "web"}, []string{"logs", "--tail=100", "web"}},
+		{DockerExecRequest{Action: "logs", Container: "web", TailLines: 20}, []string{"logs", "--tail=20", "web"}},
+		{DockerExecRequest{Action: "ps"}, []string{"ps", "--all", "--no-trunc"}},
+		{DockerExecRequest{Action: "ps", Container: "web"}, []string{"ps", "--all", "--no-trunc", "--filter=name=web"}},
+		{DockerExecRequest{Action: "pull", Image: "redis:7"}, []string{"pull", "redis:7"}},
+	}
+	for _, tt := range tests {
+		got, err := dockerArgs(&tt.req)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, %v; want %q", tt.req.Action, got, err, tt.want)
+		}
+	}
+}
+
+func TestDockerArgs_Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		req  DockerExecRequest
+		want string
+	}{
+		{"run without image", DockerExecRequest{Action: "run"}, "requires image"},
+		{"flag as image", DockerExecRequest{Action: "run", Image: "--privileged"}, "must not start with '-'"},
+		{"flag as container", DockerExecRequest{Action: "stop", Container: "-t"}, "must not start with '-'"},
+		{"logs without container", DockerExecRequest{Action: "logs"}, "requires container"},
+		{"env name with =", DockerExecRequest{Action: "run", Image: "nginx", Env: map[string]string{"A=B": "c"}}, "invalid env name"},
+	}
+	for _, tt := range tests {
+		_, err := dockerArgs(&tt.req)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// fakeDocker records the argv it's called with and replies with fixed
+// output.
+type fakeDocker struct {
+	args   []string
+	stdout string
+	stderr string
+	code   int
+	err    error
+}
+
+func (f *fakeDocker) run(_ context.Context, args []string) ([]byte, []byte, int, error) {
+	f.args = args
+	return []byte(f.stdout), []byte(f.stderr), f.code, f.err
+}
+
+func executeDocker(t *testing.T, fake *fakeDocker, input string) (DockerExecResponse, error) {
+	t.Helper()
+	r := NewRegistry()
+	Register(r, NewDockerContract(fake.run), ToolMeta{Name: "docker"})
+	out, err := r.Execute("docker", json.RawMessage(input))
+	var resp DockerExecResponse
+	if err == nil {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return resp, err
+}
+
+func TestDockerContract_Run(t *testing.T) {
+	fake := &fakeDocker{stdout: "3f4e8a9b1c2d\n"}
+	resp, err := executeDocker(t, fake, `{"action":"run","image":"nginx","ports":["80:80"]}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if resp.ContainerID != "3f4e8a9b1c2d" || resp.Status != "running" {
+		t.Errorf("response = %+v", resp)
+	}
+	if want := []string{"run", "--detach", "--publish=80:80", "nginx"}; !reflect.DeepEqual(fake.args, want) {
+		t.Errorf("argv = %q, want %q", fake.args, want)
+	}
+}
+
+func TestDockerContract_Inspect(t *testing.T) {
+	fake := &fakeDocker{stdout: `[{"Id":"3f4e8a9b1c2d","State":{"Status":"exited","ExitCode":137}}]`}
+	resp, err := executeDocker(t, fake, `{"action":"inspect","container":"web"}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if resp.ContainerID != "3f4e8a9b1c2d" || resp.Status != "exited" {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestDockerContract_CommandFails(t *testing.T) {
+	fake := &fakeDocker{stderr: "Error response from daemon: No such container: web", code: 1}
+	resp, err := executeDocker(t, fake, `{"action":"stop","container":"web"}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if resp.ExitCode != 1 || resp.Status != "failed" || !strings.Contains(resp.Output, "No such container") {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestDockerContract_ValidatesBeforeRunning(t *testing.T) {
+	fake := &fakeDocker{}
+	if _, err := executeDocker(t, fake, `{"action":"pull"}`); err == nil || !strings.Contains(err.Error(), "requires image") {
+		t.Errorf("err = %v, want a missing image error", err)
+	}
+	if _, err := executeDocker(t, fake, `{"action":"exec","container":"web"}`); err == nil {
+		t.Error("expected an unknown action to be rejected")
+	}
+	if fake.args != nil {
+		t.Errorf("docker ran with %q", fake.args)
+	}
+}
+
+func TestDockerContract_PassesCallerContext(t *testing.T) {
+	type key struct{}
+	var got context.Context
+	run := func(ctx context.Context, args []string) ([]byte, []byte, int, error) {
+		got = ctx
+		return nil, nil, 0, ctx.Err()
+	}
+	r := NewRegistry()
+	Register(r, NewDockerContract(run), ToolMeta{Name: "docker"})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "call"))
+	cancel()
+	_, err := r.ExecuteContext(ctx, "docker", json.RawMessage(`{"action":"ps"}`))
+	if got == nil || got.Value(key{}) != "call" {
+		t.Fatal("docker ran without the caller's context")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if _, ok := got.Deadline(); !ok {
+		t.Error("docker ran without the per-call timeout")
+	}
+}
+
+func TestExecDocker_NotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, _, _, err := execDocker(context.Background(), []string{"ps"})
+	if !errors.Is(err, ErrDockerNotInstalled) {
+		t.Errorf("err = %v, want ErrDockerNotInstalled", err)
+	}
+}
+
+func TestRegisterDocker(t *testing.T) {
+	r := NewRegistry()
+	RegisterDocker(r)
+	meta, ok := r.GetTool("docker")
+	if !ok {
+		t.Fatal("docker tool not registered")
+	}
+	if meta.Category != "docker" || meta.Parameters == nil || meta.Returns == nil {
+		t.Errorf("meta = %+v", meta)
+	}
+}
@@ -0,0 +1,144 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ExampleResult is the outcome of running one documented tool example.
+type ExampleResult struct {
+	Tool        string          `json:"tool"`
+	Index       int             `json:"index"` // position in ToolMeta.Examples
+	Description string          `json:"description"`
+	Passed      bool            `json:"passed"`
+	Expected    json.RawMessage `json:"expected,omitempty"`
+	Actual      json.RawMessage `json:"actual,omitempty"`
+	Mismatch    string          `json:"mismatch,omitempty"` // first difference found
+	Error       string          `json:"error,omitempty"`    // input or execution failure
+}
+
+// RunExamples executes every registered tool's examples through the
+// registry and checks the output against the documented Output. Results are
+// ordered by tool name, then example order.
+//
+// Expected output is matched as a subset: every field the example declares
+// must be present with an equal value, while fields it omits — durations,
+// timestamps, IDs — are ignored. Arrays must match element for element.
+func RunExamples(r *Registry) []ExampleResult {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []ExampleResult
+	for _, name := range names {
+		for i, ex := range r.tools[name].Examples {
+			results = append(results, runExample(r, name, i, ex))
+		}
+	}
+	return results
+}
+
+func runExample(r *Registry, name string, index int, ex ToolExample) ExampleResult {
+	res := ExampleResult{Tool: name, Index: index, Description: ex.Description}
+
+	input, err := json.Marshal(ex.Input)
+	if err != nil {
+		res.Error = fmt.Sprintf("encode example input: %v", err)
+		return res
+	}
+	expected, err := json.Marshal(ex.Output)
+	if err != nil {
+		res.Error = fmt.Sprintf("encode example output: %v", err)
+		return res
+	}
+	res.Expected = expected
+
+	actual, err := r.Execute(name, input)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Actual = actual
+
+	var want, got any
+	if err := decodeJSON(expected, &want); err != nil {
+		res.Error = fmt.Sprintf("decode example output: %v", err)
+		return res
+	}
+	if err := decodeJSON(actual, &got); err != nil {
+		res.Error = fmt.Sprintf("decode tool output: %v", err)
+		return res
+	}
+
+	res.Mismatch = matchSubset("$", want, got)
+	res.Passed = res.Mismatch == ""
+	return res
+}
+
+// decodeJSON decodes with UseNumber so integers compare exactly.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// matchSubset reports the first place got differs from want, or "" if every
+// value in want is matched in got.
+func matchSubset(path string, want, got any) string {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return fmt.Sprintf("%s: expected an object, got %s", path, compactJSON(got))
+		}
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			gv, ok := g[k]
+			if !ok {
+				return fmt.Sprintf("%s.%s: missing from output", path, k)
+			}
+			if m := matchSubset(path+"."+k, w[k], gv); m != "" {
+				return m
+			}
+		}
+		return ""
+
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return fmt.Sprintf("%s: expected an array, got %s", path, compactJSON(got))
+		}
+		if len(g) != len(w) {
+			return fmt.Sprintf("%s: expected %d elements, got %d", path, len(w), len(g))
+		}
+		for i := range w {
+			if m := matchSubset(fmt.Sprintf("%s[%d]", path, i), w[i], g[i]); m != "" {
+				return m
+			}
+		}
+		return ""
+
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Sprintf("%s: expected %s, got %s", path, compactJSON(want), compactJSON(got))
+		}
+		return ""
+	}
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
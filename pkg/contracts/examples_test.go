@@ -0,0 +1,110 @@
+package contracts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerExampleTools registers a file-edit tool whose documented example
+// matches its behaviour and a shell tool whose example has gone stale.
+func registerExampleTools(r *Registry) {
+	Register(r, ToolContract[FileEditRequest, FileEditResponse]{
+		ToolName: "edit_file",
+		Execute: func(req *FileEditRequest) (*FileEditResponse, error) {
+			return &FileEditResponse{Replacements: 1, Path: req.Path}, nil
+		},
+	}, ToolMeta{
+		Name: "edit_file",
+		Examples: []ToolExample{{
+			Description: "replace a single occurrence",
+			Input:       FileEditRequest{Path: "/etc/app.conf", OldText: "debug=true", NewText: "debug=false"},
+			Output:      map[string]any{"replacements": 1, "path": "/etc/app.conf"},
+		}},
+	})
+
+	Register(r, ToolContract[ShellExecRequest, ShellExecResponse]{
+		ToolName: "shell_exec",
+		Validate: func(req *ShellExecRequest) error {
+			if req.Command == "" {
+				return errors.New("command is required")
+			}
+			return nil
+		},
+		Execute: func(req *ShellExecRequest) (*ShellExecResponse, error) {
+			// Output format changed from "v1.2" to "version 1.2"; the docs did not.
+			return &ShellExecResponse{Stdout: "version 1.2\n", Duration: 5 * time.Millisecond}, nil
+		},
+	}, ToolMeta{
+		Name: "shell_exec",
+		Examples: []ToolExample{
+			{
+				Description: "print the version",
+				Input:       map[string]any{"command": "app --version"},
+				Output:      map[string]any{"stdout": "v1.2\n", "exit_code": 0},
+			},
+			{
+				Description: "missing command",
+				Input:       map[string]any{},
+				Output:      map[string]any{"exit_code": 0},
+			},
+		},
+	})
+}
+
+func TestRunExamples(t *testing.T) {
+	r := NewRegistry()
+	registerExampleTools(r)
+
+	results := RunExamples(r)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	pass := results[0]
+	if pass.Tool != "edit_file" || !pass.Passed {
+		t.Errorf("edit_file example should pass: %+v", pass)
+	}
+
+	stale := results[1]
+	if stale.Tool != "shell_exec" || stale.Index != 0 || stale.Passed {
+		t.Fatalf("stale shell_exec example should fail: %+v", stale)
+	}
+	if !strings.Contains(stale.Mismatch, "$.stdout") || !strings.Contains(stale.Mismatch, `"version 1.2\n"`) {
+		t.Errorf("mismatch = %q, want the stdout difference", stale.Mismatch)
+	}
+	if len(stale.Actual) == 0 || len(stale.Expected) == 0 {
+		t.Error("failing result should carry expected and actual output")
+	}
+
+	invalid := results[2]
+	if invalid.Passed || !strings.Contains(invalid.Error, "validation failed") {
+		t.Errorf("invalid input should report the execution error: %+v", invalid)
+	}
+}
+
+func TestMatchSubset(t *testing.T) {
+	tests := []struct {
+		name      string
+		want, got string
+		mismatch  string
+	}{
+		{"extra fields ignored", `{"a": 1}`, `{"a": 1, "duration": 5000}`, ""},
+		{"nested", `{"r": [{"id": "x"}]}`, `{"r": [{"id": "x", "ok": true}]}`, ""},
+		{"missing field", `{"a": 1, "b": 2}`, `{"a": 1}`, "$.b: missing from output"},
+		{"value differs", `{"a": {"b": 1}}`, `{"a": {"b": 2}}`, "$.a.b: expected 1, got 2"},
+		{"array length", `[1, 2]`, `[1]`, "$: expected 2 elements, got 1"},
+		{"type differs", `{"a": [1]}`, `{"a": "1"}`, `$.a: expected an array, got "1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want, got any
+			decodeJSON([]byte(tt.want), &want)
+			decodeJSON([]byte(tt.got), &got)
+			if m := matchSubset("$", want, got); m != tt.mismatch {
+				t.Errorf("matchSubset() = %q, want %q", m, tt.mismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/freitascorp/devopsclaw/pkg/logger"
+)
+
+// RegisterMigration sets the function that converts input written for the
+// tool oldName into input for the tool that supersedes it. Without one,
+// input is passed to the replacement unchanged.
+func (r *Registry) RegisterMigration(oldName string, fn func(json.RawMessage) (json.RawMessage, error)) {
+	r.migrations[oldName] = fn
+}
+
+// route resolves name to the tool that should run it, following Supersedes
+// links forward (v1 → v2 → v3) and migrating input at each step. A
+// deprecated tool with no replacement still runs, with a warning.
+func (r *Registry) route(name string, input json.RawMessage) (string, json.RawMessage, error) {
+	seen := map[string]bool{name: true}
+	for {
+		next, ok := r.successors[name]
+		if !ok || seen[next] {
+			break
+		}
+		if migrate := r.migrations[name]; migrate != nil {
+			migrated, err := migrate(input)
+			if err != nil {
+				return "", nil, fmt.Errorf("migrating %s input to %s: %w", name, next, err)
+			}
+			input = migrated
+		}
+		logger.WarnCF("contracts", "Deprecated tool called, routing to its replacement",
+			map[string]any{"tool": name, "replacement": next})
+		seen[next] = true
+		name = next
+	}
+	if meta, ok := r.tools[name]; ok && meta.Deprecated {
+		logger.WarnCF("contracts", "Deprecated tool called with no replacement registered",
+			map[string]any{"tool": name})
+	}
+	return name, input, nil
+}
@@ -0,0 +1,102 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// migrationRegistry registers run_shell v1, superseded by shell_exec, whose
+// request renamed "cmd" to "command".
+func migrationRegistry(t *testing.T, got *ShellExecRequest) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	Register(r, ToolContract[struct {
+		Cmd string `json:"cmd"`
+	}, ShellExecResponse]{
+		ToolName: "run_shell",
+		Execute: func(req *struct {
+			Cmd string `json:"cmd"`
+		}) (*ShellExecResponse, error) {
+			t.Error("deprecated run_shell should not run")
+			return &ShellExecResponse{}, nil
+		},
+	}, ToolMeta{Name: "run_shell", Version: "1.0", Deprecated: true})
+	Register(r, ToolContract[ShellExecRequest, ShellExecResponse]{
+		ToolName: "shell_exec",
+		Execute: func(req *ShellExecRequest) (*ShellExecResponse, error) {
+			*got = *req
+			return &ShellExecResponse{Stdout: "ran " + req.Command}, nil
+		},
+	}, ToolMeta{Name: "shell_exec", Version: "2.0", Supersedes: "run_shell"})
+	return r
+}
+
+func TestExecute_RoutesSupersededToolWithMigration(t *testing.T) {
+	var got ShellExecRequest
+	r := migrationRegistry(t, &got)
+	r.RegisterMigration("run_shell", func(in json.RawMessage) (json.RawMessage, error) {
+		var old struct {
+			Cmd string `json:"cmd"`
+		}
+		if err := json.Unmarshal(in, &old); err != nil {
+			return nil, err
+		}
+		return json.Marshal(ShellExecRequest{Command: old.Cmd, TimeoutSec: 30})
+	})
+
+	out, err := r.Execute("run_shell", json.RawMessage(`{"cmd": "uptime"}`))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got.Command != "uptime" || got.TimeoutSec != 30 {
+		t.Errorf("shell_exec got %+v, want the migrated request", got)
+	}
+	var resp ShellExecResponse
+	json.Unmarshal(out, &resp)
+	if resp.Stdout != "ran uptime" {
+		t.Errorf("output = %s", out)
+	}
+}
+
+func TestExecute_RoutesWithoutMigration(t *testing.T) {
+	var got ShellExecRequest
+	r := migrationRegistry(t, &got)
+
+	// Without a migration the input is passed through unchanged, so input
+	// that already fits the new contract works.
+	if _, err := r.Execute("run_shell", json.RawMessage(`{"command": "df -h"}`)); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got.Command != "df -h" {
+		t.Errorf("shell_exec got %+v", got)
+	}
+}
+
+func TestExecute_MigrationChainAndErrors(t *testing.T) {
+	var got ShellExecRequest
+	r := migrationRegistry(t, &got)
+
+	// An old name that was never registered itself still routes forward,
+	// through run_shell to shell_exec, migrating at each step.
+	r.successors["sh"] = "run_shell"
+	r.RegisterMigration("sh", func(in json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(in), `"c"`, `"cmd"`, 1)), nil
+	})
+	r.RegisterMigration("run_shell", func(in json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(in), `"cmd"`, `"command"`, 1)), nil
+	})
+	if _, err := r.Execute("sh", json.RawMessage(`{"c": "whoami"}`)); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got.Command != "whoami" {
+		t.Errorf("shell_exec got %+v", got)
+	}
+
+	boom := errors.New("boom")
+	r.RegisterMigration("run_shell", func(json.RawMessage) (json.RawMessage, error) { return nil, boom })
+	if _, err := r.Execute("run_shell", json.RawMessage(`{}`)); !errors.Is(err, boom) || !strings.Contains(err.Error(), "shell_exec") {
+		t.Errorf("err = %v, want the migration error naming the replacement", err)
+	}
+}
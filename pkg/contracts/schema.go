@@ -0,0 +1,169 @@
+package contracts
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------------
+// JSON Schema generation from request structs
+// ------------------------------------------------------------------
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// GenerateSchema builds the JSON Schema for T from its fields, so the
+// schema handed to the LLM can't drift from the struct that validates the
+// call. Property names come from `json` tags. The `validate` tag supplies
+// the rest: required marks the field required, oneof becomes an enum,
+// gte/lte (or min/max) become bounds on numbers, string lengths and array
+// sizes, and url sets the "uri" format.
+func GenerateSchema[T any]() map[string]any {
+	return typeSchema(reflect.TypeOf((*T)(nil)).Elem(), map[reflect.Type]bool{})
+}
+
+// typeSchema returns the schema for t. seen holds the structs being
+// expanded, so a recursive type becomes a plain object instead of looping.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"} // []byte is base64 in JSON
+		}
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]any{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		props := map[string]any{}
+		var required []string
+		addStructFields(t, props, &required, seen)
+		schema := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+// addStructFields adds t's fields to props, flattening embedded structs the
+// way encoding/json does.
+func addStructFields(t reflect.Type, props map[string]any, required *[]string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructFields(ft, props, required, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := typeSchema(f.Type, seen)
+		if applyValidateTag(schema, f.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		props[name] = schema
+	}
+}
+
+// applyValidateTag adds the constraints of a `validate` tag to schema and
+// reports whether the tag marks the field required. Rules with no JSON
+// Schema equivalent are ignored.
+func applyValidateTag(schema map[string]any, tag string) (required bool) {
+	minKey, maxKey := "minimum", "maximum"
+	switch schema["type"] {
+	case "string":
+		minKey, maxKey = "minLength", "maxLength"
+	case "array":
+		minKey, maxKey = "minItems", "maxItems"
+	case "object":
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+
+	for _, rule := range parseValidateTag(tag) {
+		arg := rule.param
+		switch rule.name {
+		case "required":
+			required = true
+		case "oneof":
+			values := strings.Fields(arg)
+			enum := make([]any, 0, len(values))
+			for _, v := range values {
+				enum = append(enum, enumValue(schema["type"], v))
+			}
+			schema["enum"] = enum
+		case "gte", "min":
+			if n, err := strconv.ParseFloat(arg, 64); err == nil {
+				schema[minKey] = boundValue(n)
+			}
+		case "lte", "max":
+			if n, err := strconv.ParseFloat(arg, 64); err == nil {
+				schema[maxKey] = boundValue(n)
+			}
+		case "url":
+			schema["format"] = "uri"
+		}
+	}
+	return required
+}
+
+// enumValue converts a oneof value to the field's JSON type.
+func enumValue(typ any, v string) any {
+	switch typ {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// boundValue keeps whole-number bounds as integers, matching the integer
+// fields and lengths they usually constrain.
+func boundValue(n float64) any {
+	if n == float64(int64(n)) {
+		return int64(n)
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package contracts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateSchema_ShellExecRequest(t *testing.T) {
+	schema := GenerateSchema[ShellExecRequest]()
+
+	if schema["type"] != "object" {
+		t.Fatalf("type = %v, want object", schema["type"])
+	}
+	if got := schema["required"]; !reflect.DeepEqual(got, []string{"command"}) {
+		t.Errorf("required = %v, want [command]", got)
+	}
+
+	props := schema["properties"].(map[string]any)
+	if len(props) != 6 {
+		t.Errorf("got %d properties, want 6: %v", len(props), props)
+	}
+	timeout := props["timeout_sec"].(map[string]any)
+	want := map[string]any{"type": "integer", "minimum": int64(0), "maximum": int64(3600)}
+	if !reflect.DeepEqual(timeout, want) {
+		t.Errorf("timeout_sec = %v, want %v", timeout, want)
+	}
+	env := props["env"].(map[string]any)
+	if env["type"] != "object" || !reflect.DeepEqual(env["additionalProperties"], map[string]any{"type": "string"}) {
+		t.Errorf("env = %v, want an object of strings", env)
+	}
+	if props["deny_check"].(map[string]any)["type"] != "boolean" {
+		t.Errorf("deny_check = %v, want boolean", props["deny_check"])
+	}
+}
+
+func TestGenerateSchema_DeployRequest(t *testing.T) {
+	schema := GenerateSchema[DeployRequest]()
+
+	want := []string{"service", "version", "strategy", "environment"}
+	if got := schema["required"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("required = %v, want %v", got, want)
+	}
+
+	props := schema["properties"].(map[string]any)
+	strategy := props["strategy"].(map[string]any)
+	if got := strategy["enum"]; !reflect.DeepEqual(got, []any{"rolling", "blue-green", "canary"}) {
+		t.Errorf("strategy enum = %v", got)
+	}
+	if got := props["rollback_on"].(map[string]any)["enum"]; !reflect.DeepEqual(got, []any{"failure", "health-check", "manual"}) {
+		t.Errorf("rollback_on enum = %v", got)
+	}
+	if got := props["health_url"].(map[string]any)["format"]; got != "uri" {
+		t.Errorf("health_url format = %v, want uri", got)
+	}
+	targets := props["targets"].(map[string]any)
+	if targets["type"] != "array" || !reflect.DeepEqual(targets["items"], map[string]any{"type": "string"}) {
+		t.Errorf("targets = %v, want an array of strings", targets)
+	}
+}
+
+func TestGenerateSchema_NestedAndEmbedded(t *testing.T) {
+	type base struct {
+		ID string `json:"id" validate:"required"`
+	}
+	type node struct {
+		base
+		Name     string  `json:"name,omitempty" validate:"max=63"`
+		Priority int     `json:"priority" validate:"oneof=1 2 3"`
+		Children []*node `json:"children,omitempty"`
+		Skipped  string  `json:"-"`
+		internal string
+	}
+
+	schema := GenerateSchema[node]()
+	props := schema["properties"].(map[string]any)
+
+	if _, ok := props["id"]; !ok {
+		t.Error("embedded struct fields should be flattened")
+	}
+	if !reflect.DeepEqual(schema["required"], []string{"id"}) {
+		t.Errorf("required = %v, want [id]", schema["required"])
+	}
+	if got := props["name"].(map[string]any)["maxLength"]; got != int64(63) {
+		t.Errorf("name maxLength = %v, want 63", got)
+	}
+	if got := props["priority"].(map[string]any)["enum"]; !reflect.DeepEqual(got, []any{int64(1), int64(2), int64(3)}) {
+		t.Errorf("priority enum = %v, want integers", got)
+	}
+	items := props["children"].(map[string]any)["items"]
+	if !reflect.DeepEqual(items, map[string]any{"type": "object"}) {
+		t.Errorf("recursive children items = %v, want a plain object", items)
+	}
+	for _, name := range []string{"Skipped", "-", "internal"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("property %q should be omitted", name)
+		}
+	}
+}
+
+func TestGenerateSchema_Viewport(t *testing.T) {
+	props := GenerateSchema[BrowserRequest]()["properties"].(map[string]any)
+	viewport := props["viewport"].(map[string]any)
+	want := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"width":  map[string]any{"type": "integer"},
+			"height": map[string]any{"type": "integer"},
+		},
+	}
+	if !reflect.DeepEqual(viewport, want) {
+		t.Errorf("viewport = %v, want %v", viewport, want)
+	}
+}
+
+func TestRegister_GeneratesParameters(t *testing.T) {
+	r := NewRegistry()
+	Register(r, ToolContract[DeployRequest, DeployResponse]{ToolName: "deploy"}, ToolMeta{Name: "deploy"})
+
+	tool, _ := r.GetTool("deploy")
+	if !reflect.DeepEqual(tool.Parameters, GenerateSchema[DeployRequest]()) {
+		t.Errorf("Parameters = %v, want the generated schema", tool.Parameters)
+	}
+
+	custom := map[string]any{"type": "object"}
+	Register(r, ToolContract[ShellExecRequest, ShellExecResponse]{ToolName: "shell"}, ToolMeta{Name: "shell", Parameters: custom})
+	tool, _ = r.GetTool("shell")
+	if !reflect.DeepEqual(tool.Parameters, custom) {
+		t.Errorf("Parameters = %v, want the caller's schema kept", tool.Parameters)
+	}
+}
@@ -0,0 +1,228 @@
+package contracts
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ------------------------------------------------------------------
+// Runtime enforcement of `validate` struct tags
+// ------------------------------------------------------------------
+
+// validateRule is one comma-separated entry of a `validate` tag, e.g.
+// "oneof=rolling canary" or "required".
+type validateRule struct {
+	name  string
+	param string
+}
+
+func parseValidateTag(tag string) []validateRule {
+	if tag == "" {
+		return nil
+	}
+	var rules []validateRule
+	for _, r := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(r), "=")
+		if name != "" {
+			rules = append(rules, validateRule{name: name, param: param})
+		}
+	}
+	return rules
+}
+
+// FieldError is one `validate` rule a request field failed.
+type FieldError struct {
+	Field string `json:"field"` // JSON path, e.g. "viewport.width"
+	Rule  string `json:"rule"`  // e.g. "oneof"
+	Param string `json:"param,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+func (e FieldError) Error() string {
+	switch e.Rule {
+	case "required":
+		return e.Field + ": is required (required)"
+	case "oneof":
+		return fmt.Sprintf("%s: %v is not one of [%s] (oneof)", e.Field, e.Value, e.Param)
+	case "gte", "min":
+		return fmt.Sprintf("%s: %v is less than %s (%s=%s)", e.Field, e.Value, e.Param, e.Rule, e.Param)
+	case "lte", "max":
+		return fmt.Sprintf("%s: %v is greater than %s (%s=%s)", e.Field, e.Value, e.Param, e.Rule, e.Param)
+	case "url":
+		return fmt.Sprintf("%s: %q is not an absolute URL (url)", e.Field, e.Value)
+	}
+	return fmt.Sprintf("%s: failed %s (%s)", e.Field, e.Rule, e.Param)
+}
+
+// ValidationErrors lists every field of a request that failed its tags.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateStruct checks v, a struct or pointer to one, against the
+// `validate` tags of its fields, descending into nested structs. It
+// supports the rules GenerateSchema understands: required, omitempty,
+// oneof, gte/lte, min/max and url; other rules are ignored. It returns
+// ValidationErrors naming each failing field and rule, or nil.
+func ValidateStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	validateFields(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateFields(rv reflect.Value, prefix string, errs *ValidationErrors) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && name == "" {
+			for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				validateFields(fv, prefix, errs)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		path := prefix + name
+
+		if checkRules(fv, path, parseValidateTag(f.Tag.Get("validate")), errs) {
+			for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				validateFields(fv, path+".", errs)
+			}
+		}
+	}
+}
+
+// checkRules applies rules to fv and reports whether validation should
+// continue into it: false once a rule fails or omitempty skips an empty
+// value.
+func checkRules(fv reflect.Value, path string, rules []validateRule, errs *ValidationErrors) bool {
+	for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	empty := isEmptyValue(fv)
+
+	for _, r := range rules {
+		fail := func() bool {
+			fe := FieldError{Field: path, Rule: r.name, Param: r.param}
+			if r.name != "required" && fv.Kind() != reflect.Pointer {
+				fe.Value = fv.Interface()
+			}
+			*errs = append(*errs, fe)
+			return false
+		}
+
+		switch r.name {
+		case "omitempty":
+			if empty {
+				return false
+			}
+		case "required":
+			if empty {
+				return fail()
+			}
+		case "oneof":
+			if fv.Kind() == reflect.Pointer {
+				continue
+			}
+			s := fmt.Sprint(fv.Interface())
+			found := false
+			for _, allowed := range strings.Fields(r.param) {
+				if s == allowed {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fail()
+			}
+		case "gte", "min", "lte", "max":
+			bound, err := strconv.ParseFloat(r.param, 64)
+			n, ok := measure(fv)
+			if err != nil || !ok {
+				continue
+			}
+			if (r.name == "gte" || r.name == "min") && n < bound {
+				return fail()
+			}
+			if (r.name == "lte" || r.name == "max") && n > bound {
+				return fail()
+			}
+		case "url":
+			if fv.Kind() != reflect.String {
+				continue
+			}
+			if u, err := url.Parse(fv.String()); err != nil || u.Scheme == "" || u.Host == "" {
+				return fail()
+			}
+		}
+	}
+	return true
+}
+
+// measure returns the number a bound applies to: the value of a number, or
+// the length of a string (in runes), slice or map.
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true
+	}
+	return 0, false
+}
+
+// isEmptyValue reports whether fv is a nil pointer, a zero value, or an
+// empty slice or map.
+func isEmptyValue(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return fv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return fv.IsNil()
+	}
+	return fv.IsZero()
+}
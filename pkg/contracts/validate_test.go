@@ -0,0 +1,152 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateStruct_TimeoutOutOfRange(t *testing.T) {
+	err := ValidateStruct(&ShellExecRequest{Command: "sleep 1", TimeoutSec: 7200})
+
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 1 {
+		t.Fatalf("err = %v, want one field error", err)
+	}
+	want := FieldError{Field: "timeout_sec", Rule: "lte", Param: "3600", Value: 7200}
+	if !reflect.DeepEqual(verrs[0], want) {
+		t.Errorf("error = %+v, want %+v", verrs[0], want)
+	}
+	if msg := err.Error(); msg != "timeout_sec: 7200 is greater than 3600 (lte=3600)" {
+		t.Errorf("message = %q", msg)
+	}
+
+	err = ValidateStruct(&ShellExecRequest{Command: "sleep 1", TimeoutSec: -1})
+	if err == nil || err.Error() != "timeout_sec: -1 is less than 0 (gte=0)" {
+		t.Errorf("negative timeout: err = %v", err)
+	}
+}
+
+func TestValidateStruct_StrategyNotAllowed(t *testing.T) {
+	req := DeployRequest{Service: "api", Version: "v2", Strategy: "yolo", Environment: "prod"}
+	err := ValidateStruct(req)
+	if err == nil || err.Error() != "strategy: yolo is not one of [rolling blue-green canary] (oneof)" {
+		t.Errorf("err = %v", err)
+	}
+
+	req.Strategy = "canary"
+	if err := ValidateStruct(req); err != nil {
+		t.Errorf("valid request: %v", err)
+	}
+}
+
+func TestValidateStruct_Rules(t *testing.T) {
+	tests := []struct {
+		name string
+		req  any
+		want []string // "field/rule"
+	}{
+		{
+			name: "missing required fields",
+			req:  &DeployRequest{Strategy: "rolling"},
+			want: []string{"service/required", "version/required", "environment/required"},
+		},
+		{
+			name: "omitempty skips empty optional fields",
+			req:  &DeployRequest{Service: "api", Version: "v2", Strategy: "rolling", Environment: "prod"},
+		},
+		{
+			name: "optional fields checked when set",
+			req: &DeployRequest{
+				Service: "api", Version: "v2", Strategy: "rolling", Environment: "prod",
+				HealthURL: "/healthz", RollbackOn: "never", Replicas: -2,
+			},
+			want: []string{"replicas/gte", "health_url/url", "rollback_on/oneof"},
+		},
+		{
+			name: "required slice",
+			req:  &FleetExecRequest{Command: "uptime", Targets: []string{}},
+			want: []string{"targets/required"},
+		},
+		{
+			name: "required enum reports required only",
+			req:  &BrowserRequest{},
+			want: []string{"action/required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var verrs ValidationErrors
+			if err := ValidateStruct(tt.req); errors.As(err, &verrs) {
+				for _, e := range verrs {
+					got = append(got, e.Field+"/"+e.Rule)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStruct_NestedPath(t *testing.T) {
+	type limits struct {
+		CPU int `json:"cpu" validate:"gte=1"`
+	}
+	type spec struct {
+		Name   string  `json:"name" validate:"max=3"`
+		Limits *limits `json:"limits,omitempty"`
+	}
+
+	err := ValidateStruct(spec{Name: "abcd", Limits: &limits{}})
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 2 {
+		t.Fatalf("err = %v, want two field errors", err)
+	}
+	if verrs[0].Field != "name" || verrs[1].Field != "limits.cpu" {
+		t.Errorf("fields = %s, %s; want name, limits.cpu", verrs[0].Field, verrs[1].Field)
+	}
+	if err := ValidateStruct(spec{Name: "ab"}); err != nil {
+		t.Errorf("nil nested struct: %v", err)
+	}
+}
+
+func TestRegister_EnforcesValidateTags(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	Register(r, ToolContract[DeployRequest, DeployResponse]{
+		ToolName: "deploy",
+		Validate: func(req *DeployRequest) error {
+			calls++
+			return nil
+		},
+		Execute: func(req *DeployRequest) (*DeployResponse, error) {
+			calls++
+			return &DeployResponse{Status: "success"}, nil
+		},
+	}, ToolMeta{Name: "deploy"})
+
+	input, _ := json.Marshal(DeployRequest{Service: "api", Version: "v2", Strategy: "big-bang", Environment: "prod"})
+	_, err := r.Execute("deploy", input)
+	if err == nil || !strings.Contains(err.Error(), "validation failed for deploy: strategy: big-bang is not one of") {
+		t.Fatalf("err = %v, want a strategy oneof error", err)
+	}
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || verrs[0].Rule != "oneof" {
+		t.Errorf("err should wrap ValidationErrors, got %T", errors.Unwrap(err))
+	}
+	if calls != 0 {
+		t.Errorf("Validate/Execute ran %d time(s) for an invalid request", calls)
+	}
+
+	input, _ = json.Marshal(DeployRequest{Service: "api", Version: "v2", Strategy: "rolling", Environment: "prod"})
+	if _, err := r.Execute("deploy", input); err != nil {
+		t.Fatalf("valid request: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want Validate and Execute", calls)
+	}
+}
@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// CanaryAnalysis configures canary analysis: after each canary batch the
+// health URL is probed Samples times, Interval apart, on every node
+// deployed so far, and the rollout aborts if fewer than MinSuccessRatio of
+// the probes succeed. Samples 0 disables it in favor of a single health
+// check.
+type CanaryAnalysis struct {
+	Samples         int           `json:"samples,omitempty"`
+	Interval        time.Duration `json:"interval,omitempty"`          // default: DefaultCanaryInterval
+	MinSuccessRatio float64       `json:"min_success_ratio,omitempty"` // 0 < r ≤ 1; default: DefaultCanaryMinSuccess
+}
+
+const (
+	// DefaultCanaryInterval is the wait between canary analysis samples.
+	DefaultCanaryInterval = 5 * time.Second
+
+	// DefaultCanaryMinSuccess is the passing success ratio when
+	// CanaryAnalysis.MinSuccessRatio is unset.
+	DefaultCanaryMinSuccess = 0.95
+)
+
+// Enabled reports whether canary analysis should run.
+func (a CanaryAnalysis) Enabled() bool { return a.Samples > 0 }
+
+// validate checks a CanaryAnalysis against the spec it belongs to.
+func (a CanaryAnalysis) validate(spec Spec) error {
+	if !a.Enabled() {
+		return nil
+	}
+	if spec.HealthCheckURL == "" {
+		return fmt.Errorf("canary analysis needs a health check URL")
+	}
+	if a.MinSuccessRatio < 0 || a.MinSuccessRatio > 1 {
+		return fmt.Errorf("canary min success ratio %g must be between 0 and 1", a.MinSuccessRatio)
+	}
+	if a.Interval < 0 {
+		return fmt.Errorf("canary analysis interval %s must not be negative", a.Interval)
+	}
+	return nil
+}
+
+func (a CanaryAnalysis) withDefaults() CanaryAnalysis {
+	if a.Interval == 0 {
+		a.Interval = DefaultCanaryInterval
+	}
+	if a.MinSuccessRatio == 0 {
+		a.MinSuccessRatio = DefaultCanaryMinSuccess
+	}
+	return a
+}
+
+// analyzeCanary runs canary analysis against nodes. It stops early once
+// so many probes have failed that the ratio can no longer be met.
+func (d *Deployer) analyzeCanary(ctx context.Context, spec Spec, nodes []*fleet.Node) error {
+	a := spec.CanaryAnalysis.withDefaults()
+	total := a.Samples * len(nodes)
+	allowedFailures := total - int(math.Ceil(a.MinSuccessRatio*float64(total)-1e-9))
+
+	d.logger.Info("running canary analysis", "nodes", len(nodes), "samples", a.Samples,
+		"interval", a.Interval, "min_success_ratio", a.MinSuccessRatio)
+
+	var passed, failed int
+	for i := 0; i < a.Samples; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(a.Interval):
+			}
+		}
+
+		result, err := d.probeHealth(ctx, spec, nodes)
+		if err != nil {
+			return fmt.Errorf("health check execution: %w", err)
+		}
+		for _, nr := range result.NodeResults {
+			if nr.Status == "success" {
+				passed++
+			} else {
+				failed++
+			}
+		}
+
+		if failed > allowedFailures {
+			return fmt.Errorf("success ratio %.2f is below %.2f after %d of %d samples (%d of %d probes failed)",
+				float64(passed)/float64(passed+failed), a.MinSuccessRatio, i+1, a.Samples, failed, passed+failed)
+		}
+	}
+
+	d.logger.Info("canary analysis passed", "passed", passed, "failed", failed)
+	return nil
+}
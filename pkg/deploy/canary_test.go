@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// flakyHealthServer is a health endpoint that answers 503 to the listed
+// request numbers (1-based) and 200 to the rest.
+type flakyHealthServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	hits  int
+	fails map[int]bool
+}
+
+func newFlakyHealthServer(t *testing.T, failOn ...int) *flakyHealthServer {
+	t.Helper()
+	s := &flakyHealthServer{fails: make(map[int]bool)}
+	for _, n := range failOn {
+		s.fails[n] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits++
+		fail := s.fails[s.hits]
+		s.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *flakyHealthServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits
+}
+
+// curlRelay behaves like scriptedRelay but performs health check curls
+// against the real URL, failing the way `curl -sf` does on an error status.
+type curlRelay struct {
+	scriptedRelay
+}
+
+func (r *curlRelay) Execute(ctx context.Context, node *fleet.Node, cmd fleet.TypedCommand) (*fleet.NodeResult, error) {
+	var sc fleet.ShellCommand
+	json.Unmarshal(cmd.Data, &sc)
+	if !strings.HasPrefix(sc.Command, "curl -sf ") {
+		return r.scriptedRelay.Execute(ctx, node, cmd)
+	}
+
+	url, err := strconv.Unquote(strings.TrimPrefix(sc.Command, "curl -sf "))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return &fleet.NodeResult{NodeID: node.ID, ExitCode: 7, Error: err.Error()}, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &fleet.NodeResult{NodeID: node.ID, ExitCode: 22, Error: resp.Status}, nil
+	}
+	return &fleet.NodeResult{NodeID: node.ID}, nil
+}
+
+func canarySpec(healthURL string, analysis CanaryAnalysis) Spec {
+	return Spec{
+		Service:         "myapp",
+		Version:         "v2",
+		Strategy:        StrategyCanary,
+		Target:          fleet.TargetSelector{All: true},
+		CanaryPercent:   []int{25, 100},
+		DeployCommand:   "./deploy.sh",
+		RollbackCommand: "./rollback.sh",
+		RollbackOnFail:  true,
+		HealthCheckURL:  healthURL,
+		CanaryAnalysis:  analysis,
+	}
+}
+
+func TestDeploy_CanaryAnalysisAborts(t *testing.T) {
+	// 10 samples at 80% tolerate two failures; the third, on sample 9,
+	// pushes the ratio out of reach.
+	health := newFlakyHealthServer(t, 3, 6, 9)
+	relay := &curlRelay{}
+	d := newTestDeployer(t, relay, 4)
+
+	result, err := d.Deploy(context.Background(), canarySpec(health.URL, CanaryAnalysis{
+		Samples:         10,
+		Interval:        time.Millisecond,
+		MinSuccessRatio: 0.8,
+	}))
+	if err == nil {
+		t.Fatal("expected canary analysis to fail")
+	}
+	if !strings.Contains(err.Error(), "canary analysis failed at 25%") ||
+		!strings.Contains(err.Error(), "after 9 of 10 samples") {
+		t.Errorf("error = %v", err)
+	}
+	if got := health.requests(); got != 9 {
+		t.Errorf("health endpoint hit %d times, want the analysis to stop after 9", got)
+	}
+	if !result.RolledBack || result.State != StateFailed {
+		t.Errorf("result = %s, rolled back %v; want failed and rolled back", result.State, result.RolledBack)
+	}
+	if len(result.Batches) != 1 {
+		t.Errorf("expected only the canary batch to run, got %d batches", len(result.Batches))
+	}
+
+	var deploys, rollbacks int
+	for _, c := range relay.commands() {
+		switch {
+		case strings.Contains(c, "./deploy.sh"):
+			deploys++
+		case strings.Contains(c, "./rollback.sh"):
+			rollbacks++
+		}
+	}
+	if deploys != 1 || rollbacks == 0 {
+		t.Errorf("deploys = %d, rollbacks = %d; want the single canary node deployed then rolled back", deploys, rollbacks)
+	}
+}
+
+func TestDeploy_CanaryAnalysisPasses(t *testing.T) {
+	health := newFlakyHealthServer(t, 2, 5)
+	relay := &curlRelay{}
+	d := newTestDeployer(t, relay, 4)
+
+	result, err := d.Deploy(context.Background(), canarySpec(health.URL, CanaryAnalysis{
+		Samples:         10,
+		Interval:        time.Millisecond,
+		MinSuccessRatio: 0.8,
+	}))
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete || result.RolledBack {
+		t.Errorf("result = %s, rolled back %v", result.State, result.RolledBack)
+	}
+	if got := health.requests(); got != 10 {
+		t.Errorf("health endpoint hit %d times, want all 10 samples", got)
+	}
+	if len(result.Batches) != 2 {
+		t.Errorf("expected both canary batches, got %d", len(result.Batches))
+	}
+}
+
+func TestDeploy_CanaryAnalysisValidation(t *testing.T) {
+	d := newTestDeployer(t, &curlRelay{}, 1)
+
+	spec := canarySpec("", CanaryAnalysis{Samples: 3})
+	if _, err := d.Deploy(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "health check URL") {
+		t.Errorf("missing health URL: err = %v", err)
+	}
+
+	spec = canarySpec("http://localhost/health", CanaryAnalysis{Samples: 3, MinSuccessRatio: 1.5})
+	if _, err := d.Deploy(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "between 0 and 1") {
+		t.Errorf("bad ratio: err = %v", err)
+	}
+}
@@ -7,12 +7,14 @@ package deploy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/freitascorp/devopsclaw/pkg/audit"
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
 )
 
@@ -35,13 +37,34 @@ type Spec struct {
 	Target           fleet.TargetSelector `json:"target"`
 	HealthCheckURL   string            `json:"health_check_url,omitempty"`
 	HealthTimeout    time.Duration     `json:"health_timeout,omitempty"`
+	HealthCheckMode  HealthMode        `json:"health_check_mode,omitempty"` // default HealthModeNode
 	RollbackOnFail   bool              `json:"rollback_on_failure"`
 	MaxUnavailable   int               `json:"max_unavailable,omitempty"`   // for rolling
 	CanaryPercent    []int             `json:"canary_percent,omitempty"`    // e.g., [5, 25, 100]
 	SerialDelay      time.Duration     `json:"serial_delay,omitempty"`     // for serial
 	DeployCommand    string            `json:"deploy_command"`             // shell command to run
+	PreCheckCommand  string            `json:"precheck_command,omitempty"` // run once on one node before rollout
 	RollbackCommand  string            `json:"rollback_command,omitempty"` // shell command for rollback
 	Requester        string            `json:"requester"`
+
+	// Blast-radius limit: refuse to deploy when the target resolves to more
+	// than MaxNodesPerDeploy nodes (0 = no cap), unless ForceOverCap is set.
+	MaxNodesPerDeploy int  `json:"max_nodes_per_deploy,omitempty"`
+	ForceOverCap      bool `json:"force_over_cap,omitempty"`
+
+	// CanaryAnalysis replaces the single health check between canary
+	// batches with repeated sampling; see CanaryAnalysis.
+	CanaryAnalysis CanaryAnalysis `json:"canary_analysis,omitempty"`
+
+	// SwitchCommand moves traffic to the new version once every blue-green
+	// node has been deployed and passed its health check, e.g. by updating
+	// a load balancer or flipping a symlink. It runs on the nodes
+	// SwitchTarget selects (often a separate load balancer node), or on
+	// the deployed nodes when SwitchTarget is nil. It gets $DEPLOY_SERVICE
+	// and $DEPLOY_VERSION but no arguments. A failed switch fails the
+	// deploy, which rolls back under RollbackOnFail.
+	SwitchCommand string                `json:"switch_command,omitempty"`
+	SwitchTarget  *fleet.TargetSelector `json:"switch_target,omitempty"`
 }
 
 // State tracks deployment progress.
@@ -51,6 +74,7 @@ const (
 	StatePending    State = "pending"
 	StateRunning    State = "running"
 	StateHealthCheck State = "health_check"
+	StateSwitch     State = "switch" // blue-green: moving traffic to the new version
 	StateRollback   State = "rollback"
 	StateComplete   State = "complete"
 	StateFailed     State = "failed"
@@ -66,9 +90,20 @@ type Result struct {
 	Duration    time.Duration       `json:"duration"`
 	Batches     []BatchResult       `json:"batches"`
 	RolledBack  bool                `json:"rolled_back"`
+	CapOverride bool                `json:"cap_override,omitempty"` // deployed past MaxNodesPerDeploy with ForceOverCap
+	RollbackOf  string              `json:"rollback_of,omitempty"`  // set on manual rollbacks: the deploy ID rolled back
+	Switch      *SwitchResult       `json:"switch,omitempty"`       // blue-green traffic switch, once attempted
 	Error       string              `json:"error,omitempty"`
 }
 
+// SwitchResult is the outcome of a blue-green deploy's SwitchCommand.
+type SwitchResult struct {
+	Nodes      []fleet.NodeResult `json:"nodes"`
+	OK         bool               `json:"ok"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at"`
+}
+
 // BatchResult is the outcome of a single deployment batch.
 type BatchResult struct {
 	BatchIndex  int                 `json:"batch_index"`
@@ -83,6 +118,9 @@ type Deployer struct {
 	executor *fleet.Executor
 	store    fleet.Store
 	logger   *slog.Logger
+	auditLog *audit.Logger // optional; records forced cap overrides and manual rollbacks
+	notifier Notifier      // optional; told about rollbacks and failures
+	lockTTL  time.Duration // deploy lock TTL; 0 = defaultLockTTL
 	mu       sync.Mutex
 	active   map[string]*Result // deploy ID → active result
 }
@@ -97,7 +135,18 @@ func NewDeployer(executor *fleet.Executor, store fleet.Store, logger *slog.Logge
 	}
 }
 
-// Deploy executes a deployment according to the given spec.
+// SetAuditLogger sets where policy overrides, such as forcing a deploy past
+// MaxNodesPerDeploy, and manual rollbacks are recorded.
+func (d *Deployer) SetAuditLogger(l *audit.Logger) {
+	d.auditLog = l
+}
+
+// ErrBlastRadius is returned when a deploy's target exceeds MaxNodesPerDeploy.
+var ErrBlastRadius = errors.New("deploy blast radius exceeded")
+
+// Deploy executes a deployment according to the given spec. Only one
+// deploy of a service to an environment runs at a time; a second one
+// fails with ErrDeployInProgress while the first holds the lock.
 func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 	if spec.Service == "" {
 		return nil, fmt.Errorf("service name is required")
@@ -108,6 +157,24 @@ func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 	if spec.DeployCommand == "" {
 		return nil, fmt.Errorf("deploy_command is required")
 	}
+	if err := validateStrategy(spec.Strategy); err != nil {
+		return nil, err
+	}
+	if err := validateHealthMode(spec); err != nil {
+		return nil, err
+	}
+	if err := spec.CanaryAnalysis.validate(spec); err != nil {
+		return nil, err
+	}
+	if err := validateSwitch(spec); err != nil {
+		return nil, err
+	}
+
+	release, err := d.acquireLock(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	start := time.Now()
 	result := &Result{
@@ -125,6 +192,7 @@ func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 		delete(d.active, result.ID)
 		d.mu.Unlock()
 	}()
+	defer d.record(ctx, result)
 
 	d.logger.Info("starting deployment",
 		"id", result.ID,
@@ -140,7 +208,18 @@ func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 	}
 	targets := spec.Target.Resolve(roster)
 	if len(targets) == 0 {
-		return d.fail(result, fmt.Errorf("no nodes matched target selector"))
+		return d.fail(result, fleet.NoTargetsError(&spec.Target, roster))
+	}
+	if err := d.checkBlastRadius(ctx, spec, len(targets), result); err != nil {
+		return d.fail(result, err)
+	}
+
+	// Verify the artifact exists before touching any node. A failed
+	// precheck aborts without rollback since nothing was changed.
+	if spec.PreCheckCommand != "" {
+		if err := d.preCheck(ctx, spec, targets[0]); err != nil {
+			return d.fail(result, fmt.Errorf("precheck failed: %w", err))
+		}
 	}
 
 	// Execute deployment strategy
@@ -161,6 +240,7 @@ func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 	}
 
 	if deployErr != nil {
+		result.Error = deployErr.Error() // so the rollback notification says why
 		if spec.RollbackOnFail && spec.RollbackCommand != "" {
 			d.rollback(ctx, spec, targets, result)
 		}
@@ -180,22 +260,44 @@ func (d *Deployer) Deploy(ctx context.Context, spec Spec) (*Result, error) {
 	return result, nil
 }
 
+// checkBlastRadius enforces MaxNodesPerDeploy against the resolved target
+// count. A forced override is allowed but logged and audited.
+func (d *Deployer) checkBlastRadius(ctx context.Context, spec Spec, resolved int, result *Result) error {
+	if spec.MaxNodesPerDeploy <= 0 || resolved <= spec.MaxNodesPerDeploy {
+		return nil
+	}
+	if !spec.ForceOverCap {
+		return fmt.Errorf("%w: target resolved to %d nodes, cap is %d (narrow the selector or use --force)",
+			ErrBlastRadius, resolved, spec.MaxNodesPerDeploy)
+	}
+
+	result.CapOverride = true
+	d.logger.Warn("deploy node cap overridden",
+		"id", result.ID,
+		"service", spec.Service,
+		"resolved_nodes", resolved,
+		"cap", spec.MaxNodesPerDeploy,
+		"requester", spec.Requester,
+	)
+	if d.auditLog != nil {
+		if err := d.auditLog.LogDeployCapOverride(ctx, spec.Service, spec.Version, resolved, spec.MaxNodesPerDeploy); err != nil {
+			d.logger.Warn("failed to audit deploy cap override", "id", result.ID, "error", err)
+		}
+	}
+	return nil
+}
+
 func (d *Deployer) fail(result *Result, err error) (*Result, error) {
-	result.State = StateFailed
 	result.Error = err.Error()
 	result.FinishedAt = time.Now()
 	result.Duration = result.FinishedAt.Sub(result.StartedAt)
+	d.setState(result, StateFailed)
 	return result, err
 }
 
 // deployRolling deploys in batches, checking health between each batch.
 func (d *Deployer) deployRolling(ctx context.Context, spec Spec, targets []*fleet.Node, result *Result) error {
-	batchSize := spec.MaxUnavailable
-	if batchSize <= 0 {
-		batchSize = 1
-	}
-
-	batches := splitIntoBatches(targets, batchSize)
+	batches := splitIntoBatches(targets, rollingBatchSize(spec))
 	for i, batch := range batches {
 		select {
 		case <-ctx.Done():
@@ -223,25 +325,9 @@ func (d *Deployer) deployRolling(ctx context.Context, spec Spec, targets []*flee
 
 // deployCanary deploys to increasing percentages of nodes.
 func (d *Deployer) deployCanary(ctx context.Context, spec Spec, targets []*fleet.Node, result *Result) error {
-	percentages := spec.CanaryPercent
-	if len(percentages) == 0 {
-		percentages = []int{5, 25, 100} // default canary percentages
-	}
-
 	deployed := 0
-	for i, pct := range percentages {
-		target := (len(targets) * pct) / 100
-		if target < 1 {
-			target = 1
-		}
-		if target > len(targets) {
-			target = len(targets)
-		}
-
-		batch := targets[deployed:target]
-		if len(batch) == 0 {
-			continue
-		}
+	for _, step := range canarySteps(spec, targets) {
+		i, pct, batch := step.index, step.percent, step.nodes
 
 		d.logger.Info("canary batch", "batch", i+1, "percent", pct, "nodes", len(batch))
 
@@ -251,11 +337,15 @@ func (d *Deployer) deployCanary(ctx context.Context, spec Spec, targets []*fleet
 			return fmt.Errorf("canary batch %d (%d%%) failed: %w", i+1, pct, err)
 		}
 
-		deployed = target
+		deployed += len(batch)
 
 		// Health check between canary steps
 		if spec.HealthCheckURL != "" && pct < 100 {
-			if err := d.healthCheck(ctx, spec, batch); err != nil {
+			if spec.CanaryAnalysis.Enabled() {
+				if err := d.analyzeCanary(ctx, spec, targets[:deployed]); err != nil {
+					return fmt.Errorf("canary analysis failed at %d%%: %w", pct, err)
+				}
+			} else if err := d.healthCheck(ctx, spec, batch); err != nil {
 				return fmt.Errorf("canary health check failed at %d%%: %w", pct, err)
 			}
 		}
@@ -263,9 +353,9 @@ func (d *Deployer) deployCanary(ctx context.Context, spec Spec, targets []*fleet
 	return nil
 }
 
-// deployBlueGreen deploys to all nodes at once, then switches.
+// deployBlueGreen deploys the new (green) version to all nodes at once,
+// health-checks them, and only then runs SwitchCommand to move traffic.
 func (d *Deployer) deployBlueGreen(ctx context.Context, spec Spec, targets []*fleet.Node, result *Result) error {
-	// Blue-green: deploy to all, health check all, then done
 	br, err := d.executeBatch(ctx, spec, targets, 0)
 	result.Batches = append(result.Batches, br)
 	if err != nil {
@@ -278,6 +368,74 @@ func (d *Deployer) deployBlueGreen(ctx context.Context, spec Spec, targets []*fl
 		}
 	}
 
+	if spec.SwitchCommand != "" {
+		if err := d.switchTraffic(ctx, spec, targets, result); err != nil {
+			return fmt.Errorf("blue-green traffic switch failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateSwitch checks that a traffic switch is only configured for
+// blue-green deploys.
+func validateSwitch(spec Spec) error {
+	if spec.SwitchTarget != nil && spec.SwitchCommand == "" {
+		return fmt.Errorf("switch target requires a switch command")
+	}
+	if spec.SwitchCommand != "" && spec.Strategy != StrategyBlueGreen {
+		return fmt.Errorf("switch command requires the blue-green strategy, not %s", spec.Strategy)
+	}
+	return nil
+}
+
+// switchTraffic runs spec.SwitchCommand on the switch target, or on the
+// deployed nodes without one, and records the outcome in result.Switch.
+// Every selected node must succeed.
+func (d *Deployer) switchTraffic(ctx context.Context, spec Spec, targets []*fleet.Node, result *Result) error {
+	d.setState(result, StateSwitch)
+
+	nodes := targets
+	if spec.SwitchTarget != nil {
+		roster, err := d.store.ListNodes(ctx)
+		if err != nil {
+			return fmt.Errorf("list nodes: %w", err)
+		}
+		nodes = spec.SwitchTarget.Resolve(roster)
+		if len(nodes) == 0 {
+			return fmt.Errorf("switch target: %w", fleet.NoTargetsError(spec.SwitchTarget, roster))
+		}
+	}
+	d.logger.Info("switching traffic", "id", result.ID, "service", spec.Service, "version", spec.Version, "nodes", len(nodes))
+
+	sw := &SwitchResult{StartedAt: time.Now()}
+	result.Switch = sw
+	cmdJSON, _ := json.Marshal(fleet.ShellCommand{
+		Command: deployEnv(spec, spec.SwitchCommand),
+	})
+	req := &fleet.ExecRequest{
+		ID:        fmt.Sprintf("switch_%d", time.Now().UnixNano()),
+		Target:    fleet.TargetSelector{NodeIDs: nodeIDs(nodes)},
+		Command:   fleet.TypedCommand{Type: "shell", Data: cmdJSON},
+		Timeout:   5 * time.Minute,
+		Requester: spec.Requester,
+	}
+	res, err := d.executor.Execute(ctx, req)
+	sw.FinishedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	sw.Nodes = res.NodeResults
+
+	for _, nr := range res.NodeResults {
+		if nr.Status != "success" {
+			if nr.Error != "" {
+				return fmt.Errorf("node %s: %s", nr.NodeID, nr.Error)
+			}
+			return fmt.Errorf("node %s: exit code %d", nr.NodeID, nr.ExitCode)
+		}
+	}
+	sw.OK = true
 	return nil
 }
 
@@ -327,19 +485,8 @@ func (d *Deployer) executeBatch(ctx context.Context, spec Spec, nodes []*fleet.N
 		StartedAt:  start,
 	}
 
-	// Build the deploy command with env-var injection to avoid shell injection.
-	// The deploy command can reference $DEPLOY_SERVICE and $DEPLOY_VERSION.
-	deployCmd := spec.DeployCommand
-	if !strings.Contains(deployCmd, "$DEPLOY_SERVICE") {
-		// Legacy mode: append service and version as arguments (shell-safe via env vars)
-		deployCmd = fmt.Sprintf("DEPLOY_SERVICE=%q DEPLOY_VERSION=%q %s \"$DEPLOY_SERVICE\" \"$DEPLOY_VERSION\"",
-			spec.Service, spec.Version, spec.DeployCommand)
-	} else {
-		deployCmd = fmt.Sprintf("DEPLOY_SERVICE=%q DEPLOY_VERSION=%q %s",
-			spec.Service, spec.Version, spec.DeployCommand)
-	}
 	cmdJSON, _ := json.Marshal(fleet.ShellCommand{
-		Command: deployCmd,
+		Command: templateCommand(spec, spec.DeployCommand),
 	})
 
 	req := &fleet.ExecRequest{
@@ -370,17 +517,76 @@ func (d *Deployer) executeBatch(ctx context.Context, spec Spec, nodes []*fleet.N
 	return br, nil
 }
 
+// preCheck runs the spec's PreCheckCommand once on a single node, e.g. to
+// verify that the container image tag for the version is pullable.
+func (d *Deployer) preCheck(ctx context.Context, spec Spec, node *fleet.Node) error {
+	d.logger.Info("running deploy precheck", "service", spec.Service, "version", spec.Version, "node", node.ID)
+
+	cmdJSON, _ := json.Marshal(fleet.ShellCommand{
+		Command: templateCommand(spec, spec.PreCheckCommand),
+	})
+
+	req := &fleet.ExecRequest{
+		ID:        fmt.Sprintf("precheck_%d", time.Now().UnixNano()),
+		Target:    fleet.TargetSelector{NodeIDs: []fleet.NodeID{node.ID}},
+		Command:   fleet.TypedCommand{Type: "shell", Data: cmdJSON},
+		Timeout:   5 * time.Minute,
+		Requester: spec.Requester,
+	}
+
+	result, err := d.executor.Execute(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for _, nr := range result.NodeResults {
+		if nr.Status != "success" {
+			if nr.Error != "" {
+				return fmt.Errorf("node %s: %s", nr.NodeID, nr.Error)
+			}
+			return fmt.Errorf("node %s: exit code %d", nr.NodeID, nr.ExitCode)
+		}
+	}
+	return nil
+}
+
 func (d *Deployer) healthCheck(ctx context.Context, spec Spec, nodes []*fleet.Node) error {
 	timeout := spec.HealthTimeout
 	if timeout <= 0 {
 		timeout = 30 * time.Second
 	}
 
-	d.logger.Info("running health check", "url", spec.HealthCheckURL, "nodes", len(nodes))
+	d.logger.Info("running health check", "url", spec.HealthCheckURL, "mode", spec.HealthCheckMode, "nodes", len(nodes))
+
+	result, err := d.probeHealth(ctx, spec, nodes)
+	if err != nil {
+		return fmt.Errorf("health check execution: %w", err)
+	}
+
+	for _, nr := range result.NodeResults {
+		if nr.Status != "success" {
+			return fmt.Errorf("health check failed on %s: %s", nr.NodeID, nr.Error)
+		}
+	}
+
+	return nil
+}
+
+// probeHealth requests spec.HealthCheckURL once for each node, from the
+// node itself or, in HealthModeControlPlane, from the Deployer.
+func (d *Deployer) probeHealth(ctx context.Context, spec Spec, nodes []*fleet.Node) (*fleet.ExecResult, error) {
+	timeout := spec.HealthTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
 
 	healthCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	if spec.HealthCheckMode == HealthModeControlPlane {
+		return d.probeHealthHTTP(healthCtx, spec, nodes, timeout), nil
+	}
+
 	// Use shell-quoted health check URL to prevent injection
 	cmdJSON, _ := json.Marshal(fleet.ShellCommand{
 		Command:    fmt.Sprintf("curl -sf %q", spec.HealthCheckURL),
@@ -394,24 +600,13 @@ func (d *Deployer) healthCheck(ctx context.Context, spec Spec, nodes []*fleet.No
 		Timeout: timeout,
 	}
 
-	result, err := d.executor.Execute(healthCtx, req)
-	if err != nil {
-		return fmt.Errorf("health check execution: %w", err)
-	}
-
-	for _, nr := range result.NodeResults {
-		if nr.Status != "success" {
-			return fmt.Errorf("health check failed on %s: %s", nr.NodeID, nr.Error)
-		}
-	}
-
-	return nil
+	return d.executor.Execute(healthCtx, req)
 }
 
 func (d *Deployer) rollback(ctx context.Context, spec Spec, targets []*fleet.Node, result *Result) {
 	d.logger.Warn("rolling back deployment", "id", result.ID, "service", spec.Service)
-	result.State = StateRollback
 	result.RolledBack = true
+	d.setState(result, StateRollback)
 
 	cmdJSON, _ := json.Marshal(fleet.ShellCommand{
 		Command: spec.RollbackCommand,
@@ -441,6 +636,23 @@ func (d *Deployer) ActiveDeployments() []*Result {
 	return results
 }
 
+// templateCommand injects the service and version as env vars to avoid shell
+// injection. The command can reference $DEPLOY_SERVICE and $DEPLOY_VERSION.
+func templateCommand(spec Spec, command string) string {
+	if !strings.Contains(command, "$DEPLOY_SERVICE") && !strings.Contains(command, "$DEPLOY_VERSION") {
+		// Legacy mode: append service and version as arguments (shell-safe via env vars)
+		return deployEnv(spec, command+` "$DEPLOY_SERVICE" "$DEPLOY_VERSION"`)
+	}
+	return deployEnv(spec, command)
+}
+
+// deployEnv prefixes command with the service and version as
+// $DEPLOY_SERVICE and $DEPLOY_VERSION.
+func deployEnv(spec Spec, command string) string {
+	return fmt.Sprintf("DEPLOY_SERVICE=%q DEPLOY_VERSION=%q %s",
+		spec.Service, spec.Version, command)
+}
+
 func splitIntoBatches(nodes []*fleet.Node, batchSize int) [][]*fleet.Node {
 	var batches [][]*fleet.Node
 	for i := 0; i < len(nodes); i += batchSize {
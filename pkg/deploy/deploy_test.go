@@ -1,9 +1,17 @@
 package deploy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/freitascorp/devopsclaw/pkg/audit"
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
 )
 
@@ -168,3 +176,496 @@ func TestDeployer_FailHelper(t *testing.T) {
 		t.Errorf("Error = %q, want test error", got.Error)
 	}
 }
+
+// scriptedRelay is a fleet.RelayClient that records shell commands and fails
+// any command containing one of the configured substrings.
+type scriptedRelay struct {
+	mu     sync.Mutex
+	calls  []string
+	failOn []string
+}
+
+func (r *scriptedRelay) Execute(_ context.Context, node *fleet.Node, cmd fleet.TypedCommand) (*fleet.NodeResult, error) {
+	var sc fleet.ShellCommand
+	json.Unmarshal(cmd.Data, &sc)
+
+	r.mu.Lock()
+	r.calls = append(r.calls, sc.Command)
+	r.mu.Unlock()
+
+	for _, s := range r.failOn {
+		if strings.Contains(sc.Command, s) {
+			return &fleet.NodeResult{NodeID: node.ID, ExitCode: 1, Error: "manifest unknown"}, nil
+		}
+	}
+	return &fleet.NodeResult{NodeID: node.ID, Output: "ok"}, nil
+}
+
+func (r *scriptedRelay) Ping(_ context.Context, _ *fleet.Node) error { return nil }
+
+func (r *scriptedRelay) commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func newTestDeployer(t *testing.T, relay fleet.RelayClient, nodes int) *Deployer {
+	t.Helper()
+	store := fleet.NewMemoryStore()
+	for i := 0; i < nodes; i++ {
+		store.RegisterNode(context.Background(), &fleet.Node{
+			ID:     fleet.NodeID(fmt.Sprintf("node-%d", i+1)),
+			Status: fleet.NodeStatusOnline,
+		})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDeployer(fleet.NewExecutor(store, relay, logger), store, logger)
+}
+
+func TestDeploy_PreCheckFailureAborts(t *testing.T) {
+	relay := &scriptedRelay{failOn: []string{"docker manifest inspect"}}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), Spec{
+		Service:         "myapp",
+		Version:         "v9.9.9-typo",
+		Strategy:        StrategyAllAtOnce,
+		Target:          fleet.TargetSelector{All: true},
+		DeployCommand:   "./deploy.sh",
+		PreCheckCommand: "docker manifest inspect myapp:$DEPLOY_VERSION",
+	})
+	if err == nil {
+		t.Fatal("expected precheck error")
+	}
+	if !strings.Contains(err.Error(), "precheck failed") {
+		t.Errorf("error = %q, want precheck failed", err.Error())
+	}
+	if result.State != StateFailed {
+		t.Errorf("State = %q, want failed", result.State)
+	}
+	if len(result.Batches) != 0 {
+		t.Errorf("expected no batches, got %d", len(result.Batches))
+	}
+
+	cmds := relay.commands()
+	if len(cmds) != 1 {
+		t.Fatalf("expected only the precheck to run, got %d commands: %v", len(cmds), cmds)
+	}
+	if !strings.Contains(cmds[0], `DEPLOY_VERSION="v9.9.9-typo"`) {
+		t.Errorf("precheck command not templated: %q", cmds[0])
+	}
+}
+
+func TestDeploy_PreCheckSuccessProceeds(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), Spec{
+		Service:         "myapp",
+		Version:         "v2.0.0",
+		Strategy:        StrategyAllAtOnce,
+		Target:          fleet.TargetSelector{All: true},
+		DeployCommand:   "./deploy.sh",
+		PreCheckCommand: "docker manifest inspect myapp:$DEPLOY_VERSION",
+	})
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete {
+		t.Errorf("State = %q, want complete", result.State)
+	}
+
+	cmds := relay.commands()
+	if len(cmds) != 4 { // 1 precheck + 3 deploys
+		t.Fatalf("expected 4 commands, got %d: %v", len(cmds), cmds)
+	}
+	if !strings.Contains(cmds[0], "docker manifest inspect") {
+		t.Errorf("first command = %q, want precheck", cmds[0])
+	}
+}
+
+func capSpec(maxNodes int, force bool) Spec {
+	return Spec{
+		Service:           "myapp",
+		Version:           "v2.0.0",
+		Strategy:          StrategyAllAtOnce,
+		Target:            fleet.TargetSelector{All: true},
+		DeployCommand:     "./deploy.sh",
+		MaxNodesPerDeploy: maxNodes,
+		ForceOverCap:      force,
+	}
+}
+
+func TestDeploy_NodeCapUnderLimit(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), capSpec(3, false))
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete || result.CapOverride {
+		t.Errorf("State = %q, CapOverride = %v; want complete without override", result.State, result.CapOverride)
+	}
+	if n := len(relay.commands()); n != 3 {
+		t.Errorf("expected 3 deploy commands, got %d", n)
+	}
+}
+
+func TestDeploy_NodeCapExceededAborts(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 5)
+
+	result, err := d.Deploy(context.Background(), capSpec(2, false))
+	if !errors.Is(err, ErrBlastRadius) {
+		t.Fatalf("err = %v, want ErrBlastRadius", err)
+	}
+	if !strings.Contains(err.Error(), "target resolved to 5 nodes, cap is 2") {
+		t.Errorf("error = %q, want the resolved count and cap", err.Error())
+	}
+	if result.State != StateFailed {
+		t.Errorf("State = %q, want failed", result.State)
+	}
+	if cmds := relay.commands(); len(cmds) != 0 {
+		t.Errorf("no commands should run when over the cap, got %v", cmds)
+	}
+}
+
+func TestDeploy_NodeCapForcedIsAudited(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 5)
+	auditStore := audit.NewFileStore(t.TempDir())
+	d.SetAuditLogger(audit.NewLogger(auditStore, "alice"))
+
+	result, err := d.Deploy(context.Background(), capSpec(2, true))
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete || !result.CapOverride {
+		t.Errorf("State = %q, CapOverride = %v; want complete with override", result.State, result.CapOverride)
+	}
+	if n := len(relay.commands()); n != 5 {
+		t.Errorf("expected 5 deploy commands, got %d", n)
+	}
+
+	events, err := auditStore.Query(context.Background(), audit.QueryOptions{})
+	if err != nil {
+		t.Fatalf("audit query: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "fleet.deploy.cap_override" || ev.User != "alice" {
+		t.Errorf("audit event = %+v", ev)
+	}
+	if ev.Metadata["resolved_nodes"] != float64(5) || ev.Metadata["cap"] != float64(2) {
+		t.Errorf("audit metadata = %v, want resolved_nodes=5 cap=2", ev.Metadata)
+	}
+}
+
+// newEnvDeployer registers two nodes in each of the given environments.
+func newEnvDeployer(t *testing.T, relay fleet.RelayClient, envs ...string) *Deployer {
+	t.Helper()
+	store := fleet.NewMemoryStore()
+	for _, env := range envs {
+		for i := 1; i <= 2; i++ {
+			store.RegisterNode(context.Background(), &fleet.Node{
+				ID:     fleet.NodeID(fmt.Sprintf("%s-%d", env, i)),
+				Status: fleet.NodeStatusOnline,
+				Labels: map[string]string{"env": env},
+			})
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDeployer(fleet.NewExecutor(store, relay, logger), store, logger)
+}
+
+func envSpec(env, version string) Spec {
+	return Spec{
+		Service:         "myapp",
+		Version:         version,
+		Strategy:        StrategyAllAtOnce,
+		Target:          fleet.TargetSelector{Labels: map[string]string{"env": env}},
+		DeployCommand:   "./deploy.sh " + version,
+		RollbackCommand: "./rollback.sh " + env + " " + version,
+	}
+}
+
+func TestRollbackTargets_LatestSuccessfulPerEnv(t *testing.T) {
+	relay := &scriptedRelay{failOn: []string{"./deploy.sh v3-broken"}}
+	d := newEnvDeployer(t, relay, "prod", "staging", "dev")
+	ctx := context.Background()
+
+	for _, spec := range []Spec{
+		envSpec("prod", "v1"),
+		envSpec("staging", "v1"),
+		envSpec("prod", "v2"),
+		envSpec("staging", "v2"),
+		envSpec("prod", "v3-broken"), // fails, so prod should still pick v2
+		envSpec("dev", "v2"),
+	} {
+		d.Deploy(ctx, spec)
+	}
+	other := envSpec("prod", "v9")
+	other.Service = "otherapp"
+	d.Deploy(ctx, other)
+
+	plan, err := d.RollbackTargets(ctx, "myapp", nil)
+	if err != nil {
+		t.Fatalf("RollbackTargets: %v", err)
+	}
+	var got []string
+	for _, r := range plan {
+		got = append(got, r.Spec.Environment()+"@"+r.Spec.Version)
+	}
+	want := []string{"dev@v2", "prod@v2", "staging@v2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("plan = %v, want %v", got, want)
+	}
+
+	plan, err = d.RollbackTargets(ctx, "myapp", []string{"prod", "staging"})
+	if err != nil {
+		t.Fatalf("RollbackTargets: %v", err)
+	}
+	if len(plan) != 2 || plan[0].Spec.Environment() != "prod" || plan[1].Spec.Environment() != "staging" {
+		t.Errorf("--env prod,staging plan = %+v", plan)
+	}
+}
+
+func TestRollbackAll_RunsRollbackPerEnv(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newEnvDeployer(t, relay, "prod", "staging")
+	auditStore := audit.NewFileStore(t.TempDir())
+	d.SetAuditLogger(audit.NewLogger(auditStore, "alice"))
+	ctx := context.Background()
+
+	d.Deploy(ctx, envSpec("prod", "v2"))
+	d.Deploy(ctx, envSpec("staging", "v2"))
+	plan, err := d.RollbackTargets(ctx, "myapp", nil)
+	if err != nil {
+		t.Fatalf("RollbackTargets: %v", err)
+	}
+
+	deployCalls := len(relay.commands())
+	results, err := d.RollbackAll(ctx, plan, false)
+	if err != nil {
+		t.Fatalf("RollbackAll: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 rollback results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.State != StateComplete || r.RollbackOf != plan[i].ID {
+			t.Errorf("results[%d] = state %q rollback_of %q, want complete of %s", i, r.State, r.RollbackOf, plan[i].ID)
+		}
+	}
+
+	// Serial: prod's two nodes, then staging's two nodes.
+	cmds := relay.commands()[deployCalls:]
+	want := []string{"./rollback.sh prod v2", "./rollback.sh prod v2", "./rollback.sh staging v2", "./rollback.sh staging v2"}
+	if strings.Join(cmds, "|") != strings.Join(want, "|") {
+		t.Errorf("rollback commands = %v, want %v", cmds, want)
+	}
+
+	events, err := auditStore.Query(ctx, audit.QueryOptions{})
+	if err != nil {
+		t.Fatalf("audit query: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != "fleet.deploy.rollback" {
+		t.Fatalf("audit events = %+v, want 2 rollbacks", events)
+	}
+
+	// Rollbacks are recorded but never picked as rollback targets.
+	history, _ := d.History(ctx, "myapp")
+	if len(history) != 4 {
+		t.Errorf("history has %d records, want 2 deploys + 2 rollbacks", len(history))
+	}
+	if again, _ := d.RollbackTargets(ctx, "myapp", nil); len(again) != 2 || again[0].RollbackOf != "" {
+		t.Errorf("rollback records should not be rollback targets: %+v", again)
+	}
+}
+
+func TestRollbackAll_MissingRollbackCommand(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newEnvDeployer(t, relay, "prod")
+	ctx := context.Background()
+
+	spec := envSpec("prod", "v2")
+	spec.RollbackCommand = ""
+	d.Deploy(ctx, spec)
+	plan, _ := d.RollbackTargets(ctx, "myapp", nil)
+
+	_, err := d.RollbackAll(ctx, plan, false)
+	if !errors.Is(err, ErrNoRollbackCommand) {
+		t.Errorf("err = %v, want ErrNoRollbackCommand", err)
+	}
+}
+
+func TestRollbackByID(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newEnvDeployer(t, relay, "prod")
+	ctx := context.Background()
+
+	deployed, err := d.Deploy(ctx, envSpec("prod", "v2"))
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+
+	// The target is re-resolved, so a node added since the deploy is
+	// rolled back too.
+	d.store.RegisterNode(ctx, &fleet.Node{ID: "prod-3", Status: fleet.NodeStatusOnline, Labels: map[string]string{"env": "prod"}})
+	deployCalls := len(relay.commands())
+
+	result, err := d.RollbackByID(ctx, deployed.ID)
+	if err != nil {
+		t.Fatalf("RollbackByID: %v", err)
+	}
+	if result.State != StateComplete || result.RollbackOf != deployed.ID {
+		t.Errorf("result = state %q rollback_of %q", result.State, result.RollbackOf)
+	}
+	if n := len(relay.commands()) - deployCalls; n != 3 {
+		t.Errorf("rollback ran on %d nodes, want 3", n)
+	}
+
+	req, _, err := d.store.GetExecution(ctx, result.ID)
+	if err != nil {
+		t.Fatalf("rollback was not recorded: %v", err)
+	}
+	if req.Command.Type != "deploy" {
+		t.Errorf("rollback record type = %q, want deploy", req.Command.Type)
+	}
+}
+
+func TestRollbackByID_Errors(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newEnvDeployer(t, relay, "prod")
+	ctx := context.Background()
+
+	if _, err := d.RollbackByID(ctx, "deploy_missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing deploy: err = %v, want not found", err)
+	}
+
+	spec := envSpec("prod", "v2")
+	spec.RollbackCommand = ""
+	deployed, _ := d.Deploy(ctx, spec)
+	if _, err := d.RollbackByID(ctx, deployed.ID); !errors.Is(err, ErrNoRollbackCommand) {
+		t.Errorf("no rollback command: err = %v, want ErrNoRollbackCommand", err)
+	}
+
+	// Batch executions live in the same store but aren't deployments.
+	reqs, _ := d.store.ListExecutions(ctx, fleet.ListExecOptions{})
+	for _, req := range reqs {
+		if req.Command.Type == "shell" {
+			if _, err := d.RollbackByID(ctx, req.ID); err == nil || !strings.Contains(err.Error(), "not a deployment") {
+				t.Errorf("shell execution: err = %v, want not a deployment", err)
+			}
+			break
+		}
+	}
+}
+
+func switchSpec() Spec {
+	return Spec{
+		Service:         "myapp",
+		Version:         "v2.0.0",
+		Strategy:        StrategyBlueGreen,
+		Target:          fleet.TargetSelector{NodeIDs: []fleet.NodeID{"node-1", "node-2"}},
+		DeployCommand:   "./deploy.sh",
+		HealthCheckURL:  "http://localhost:8080/health",
+		RollbackOnFail:  true,
+		RollbackCommand: "./rollback.sh",
+		SwitchCommand:   "./switch-lb.sh",
+		SwitchTarget:    &fleet.TargetSelector{NodeIDs: []fleet.NodeID{"node-3"}},
+	}
+}
+
+func TestDeploy_BlueGreenSwitchAfterHealth(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), switchSpec())
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete {
+		t.Errorf("State = %q, want complete", result.State)
+	}
+	if result.Switch == nil || !result.Switch.OK || len(result.Switch.Nodes) != 1 || result.Switch.Nodes[0].NodeID != "node-3" {
+		t.Fatalf("Switch = %+v, want a successful switch on node-3", result.Switch)
+	}
+
+	cmds := relay.commands()
+	if len(cmds) != 5 { // 2 deploys + 2 health checks + 1 switch
+		t.Fatalf("expected 5 commands, got %d: %v", len(cmds), cmds)
+	}
+	last := cmds[len(cmds)-1]
+	if !strings.Contains(last, "./switch-lb.sh") || strings.HasSuffix(last, `"$DEPLOY_VERSION"`) {
+		t.Errorf("last command = %q, want the switch with no appended arguments", last)
+	}
+	for _, c := range cmds[:len(cmds)-1] {
+		if strings.Contains(c, "switch-lb") {
+			t.Errorf("switch ran before the health checks: %v", cmds)
+		}
+	}
+}
+
+func TestDeploy_BlueGreenNoSwitchOnUnhealthy(t *testing.T) {
+	relay := &scriptedRelay{failOn: []string{"curl"}}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), switchSpec())
+	if err == nil || !strings.Contains(err.Error(), "health check failed") {
+		t.Fatalf("err = %v, want a health check failure", err)
+	}
+	if result.Switch != nil {
+		t.Errorf("Switch = %+v, want no switch attempt", result.Switch)
+	}
+	for _, c := range relay.commands() {
+		if strings.Contains(c, "switch-lb") {
+			t.Errorf("switch ran despite failed health check: %q", c)
+		}
+	}
+}
+
+func TestDeploy_BlueGreenSwitchFailureRollsBack(t *testing.T) {
+	relay := &scriptedRelay{failOn: []string{"switch-lb"}}
+	d := newTestDeployer(t, relay, 3)
+
+	result, err := d.Deploy(context.Background(), switchSpec())
+	if err == nil || !strings.Contains(err.Error(), "traffic switch failed") {
+		t.Fatalf("err = %v, want a traffic switch failure", err)
+	}
+	if result.State != StateFailed {
+		t.Errorf("State = %q, want failed", result.State)
+	}
+	if result.Switch == nil || result.Switch.OK || len(result.Switch.Nodes) != 1 {
+		t.Errorf("Switch = %+v, want a failed switch recorded", result.Switch)
+	}
+
+	var rollbacks int
+	for _, c := range relay.commands() {
+		if strings.Contains(c, "./rollback.sh") {
+			rollbacks++
+		}
+	}
+	if rollbacks != 2 {
+		t.Errorf("rollback ran on %d nodes, want the 2 deployed nodes", rollbacks)
+	}
+}
+
+func TestDeploy_SwitchValidation(t *testing.T) {
+	d := &Deployer{active: make(map[string]*Result)}
+
+	spec := switchSpec()
+	spec.Strategy = StrategyRolling
+	if _, err := d.Deploy(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "blue-green") {
+		t.Errorf("rolling with a switch: err = %v, want a blue-green error", err)
+	}
+
+	spec = switchSpec()
+	spec.SwitchCommand = ""
+	if _, err := d.Deploy(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "switch command") {
+		t.Errorf("switch target alone: err = %v, want a switch command error", err)
+	}
+}
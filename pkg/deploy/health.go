@@ -0,0 +1,143 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// HealthMode selects where a deploy's health checks run.
+type HealthMode string
+
+const (
+	// HealthModeNode runs `curl -sf <url>` on each node, so the URL is
+	// resolved from the node itself. This is the default.
+	HealthModeNode HealthMode = "node"
+
+	// HealthModeControlPlane has the Deployer GET the URL itself, once
+	// per node, with the node's fields substituted into the URL template.
+	// Nodes need no curl, and the check sees what a client of a shared
+	// VIP would see.
+	HealthModeControlPlane HealthMode = "control-plane"
+)
+
+// validateHealthMode checks spec's health mode against its health URL.
+func validateHealthMode(spec Spec) error {
+	switch spec.HealthCheckMode {
+	case "", HealthModeNode:
+		return nil
+	case HealthModeControlPlane:
+		if spec.HealthCheckURL == "" {
+			return fmt.Errorf("control-plane health checks need a health check URL")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown health check mode %q (want %s or %s)",
+			spec.HealthCheckMode, HealthModeNode, HealthModeControlPlane)
+	}
+}
+
+// healthURL expands a control-plane health URL template for node:
+// {node.id}, {node.hostname}, {node.address} and {node.host} (the address
+// without its port).
+func healthURL(template string, node *fleet.Node) (string, error) {
+	if strings.Contains(template, "{node.address}") || strings.Contains(template, "{node.host}") {
+		if node.Address == "" {
+			return "", fmt.Errorf("node has no address")
+		}
+	}
+	host := node.Address
+	if h, _, err := net.SplitHostPort(node.Address); err == nil {
+		host = h
+	}
+	return strings.NewReplacer(
+		"{node.id}", string(node.ID),
+		"{node.hostname}", node.Hostname,
+		"{node.address}", node.Address,
+		"{node.host}", host,
+	).Replace(template), nil
+}
+
+// probeHealthHTTP GETs each node's health URL from the control plane and
+// reports a 2xx answer as success, in the same shape probeHealth returns
+// for node-side checks.
+func (d *Deployer) probeHealthHTTP(ctx context.Context, spec Spec, nodes []*fleet.Node, timeout time.Duration) *fleet.ExecResult {
+	client := &http.Client{Timeout: timeout}
+	start := time.Now()
+	result := &fleet.ExecResult{
+		RequestID:   fmt.Sprintf("health_%d", start.UnixNano()),
+		NodeResults: make([]fleet.NodeResult, len(nodes)),
+		StartedAt:   start,
+	}
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *fleet.Node) {
+			defer wg.Done()
+			result.NodeResults[i] = getHealth(ctx, client, spec.HealthCheckURL, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	result.Summary.Total = len(nodes)
+	for _, nr := range result.NodeResults {
+		switch nr.Status {
+		case "success":
+			result.Summary.Success++
+		case "timeout":
+			result.Summary.Timeout++
+		default:
+			result.Summary.Failed++
+		}
+	}
+	result.FinishedAt = time.Now()
+	result.Duration = result.FinishedAt.Sub(start)
+	return result
+}
+
+// getHealth performs one control-plane health GET for node.
+func getHealth(ctx context.Context, client *http.Client, template string, node *fleet.Node) (nr fleet.NodeResult) {
+	start := time.Now()
+	nr = fleet.NodeResult{NodeID: node.ID, Hostname: node.Hostname, Status: "failure", StartedAt: start}
+	defer func() { nr.Duration = time.Since(start) }()
+
+	url, err := healthURL(template, node)
+	if err != nil {
+		nr.Error = err.Error()
+		return nr
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		nr.Error = fmt.Sprintf("health check URL: %v", err)
+		return nr
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if ctx.Err() != nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+			nr.Status = "timeout"
+		}
+		nr.Error = fmt.Sprintf("GET %s: %v", url, err)
+		return nr
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		nr.ExitCode = 1
+		nr.Error = fmt.Sprintf("GET %s: status %d", url, resp.StatusCode)
+		return nr
+	}
+	nr.Status = "success"
+	nr.Output = resp.Status
+	return nr
+}
@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// statusServer is a health endpoint answering every request with status.
+func statusServer(t *testing.T, status int) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+	return strings.TrimPrefix(ts.URL, "http://")
+}
+
+// newAddressedDeployer registers one online node per address.
+func newAddressedDeployer(t *testing.T, relay fleet.RelayClient, addrs ...string) *Deployer {
+	t.Helper()
+	store := fleet.NewMemoryStore()
+	for i, addr := range addrs {
+		store.RegisterNode(context.Background(), &fleet.Node{
+			ID:      fleet.NodeID(fmt.Sprintf("node-%d", i+1)),
+			Address: addr,
+			Status:  fleet.NodeStatusOnline,
+		})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDeployer(fleet.NewExecutor(store, relay, logger), store, logger)
+}
+
+func TestHealthURL(t *testing.T) {
+	node := &fleet.Node{ID: "web-1", Hostname: "web-1.internal", Address: "10.0.0.5:9443"}
+	tests := []struct {
+		template, want string
+	}{
+		{"http://{node.address}/health", "http://10.0.0.5:9443/health"},
+		{"http://{node.host}:8080/health", "http://10.0.0.5:8080/health"},
+		{"https://{node.hostname}/healthz?node={node.id}", "https://web-1.internal/healthz?node=web-1"},
+		{"https://vip.example.com/health", "https://vip.example.com/health"},
+	}
+	for _, tt := range tests {
+		got, err := healthURL(tt.template, node)
+		if err != nil || got != tt.want {
+			t.Errorf("healthURL(%q) = %q, %v; want %q", tt.template, got, err, tt.want)
+		}
+	}
+
+	if _, err := healthURL("http://{node.host}/health", &fleet.Node{ID: "no-addr"}); err == nil {
+		t.Error("expected an error for a node without an address")
+	}
+}
+
+func TestProbeHealthHTTP_MixedStatuses(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newAddressedDeployer(t, relay,
+		statusServer(t, http.StatusOK),
+		statusServer(t, http.StatusNoContent),
+		statusServer(t, http.StatusServiceUnavailable),
+		statusServer(t, http.StatusNotFound),
+		"",
+	)
+	nodes, _ := d.store.ListNodes(context.Background())
+
+	spec := Spec{HealthCheckURL: "http://{node.address}/health", HealthCheckMode: HealthModeControlPlane, HealthTimeout: 5 * time.Second}
+	result, err := d.probeHealth(context.Background(), spec, nodes)
+	if err != nil {
+		t.Fatalf("probeHealth: %v", err)
+	}
+
+	want := map[fleet.NodeID]string{
+		"node-1": "success",
+		"node-2": "success",
+		"node-3": "failure",
+		"node-4": "failure",
+		"node-5": "failure",
+	}
+	for _, nr := range result.NodeResults {
+		if nr.Status != want[nr.NodeID] {
+			t.Errorf("%s: status = %q (%s), want %q", nr.NodeID, nr.Status, nr.Error, want[nr.NodeID])
+		}
+	}
+	if s := result.Summary; s.Total != 5 || s.Success != 2 || s.Failed != 3 {
+		t.Errorf("Summary = %+v, want 2 of 5 succeeded", s)
+	}
+	if cmds := relay.commands(); len(cmds) != 0 {
+		t.Errorf("control-plane health check ran commands on nodes: %v", cmds)
+	}
+}
+
+func TestDeploy_ControlPlaneHealthCheck(t *testing.T) {
+	healthy := statusServer(t, http.StatusOK)
+	sick := statusServer(t, http.StatusServiceUnavailable)
+
+	spec := Spec{
+		Service:         "myapp",
+		Version:         "v2",
+		Strategy:        StrategyBlueGreen,
+		Target:          fleet.TargetSelector{All: true},
+		DeployCommand:   "./deploy.sh",
+		HealthCheckURL:  "http://{node.address}/health",
+		HealthCheckMode: HealthModeControlPlane,
+	}
+
+	relay := &scriptedRelay{}
+	result, err := newAddressedDeployer(t, relay, healthy, healthy).Deploy(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if result.State != StateComplete {
+		t.Errorf("State = %q, want complete", result.State)
+	}
+	for _, c := range relay.commands() {
+		if strings.Contains(c, "curl") {
+			t.Errorf("health check ran on a node: %q", c)
+		}
+	}
+
+	result, err = newAddressedDeployer(t, &scriptedRelay{}, healthy, sick).Deploy(context.Background(), spec)
+	if err == nil || !strings.Contains(err.Error(), "health check failed on node-2") {
+		t.Fatalf("err = %v, want a health check failure on node-2", err)
+	}
+	if !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("err = %q, want the HTTP status", err)
+	}
+	if result.State != StateFailed {
+		t.Errorf("State = %q, want failed", result.State)
+	}
+}
+
+func TestValidateHealthMode(t *testing.T) {
+	tests := []struct {
+		spec    Spec
+		wantErr string
+	}{
+		{Spec{}, ""},
+		{Spec{HealthCheckMode: HealthModeNode, HealthCheckURL: "/health"}, ""},
+		{Spec{HealthCheckMode: HealthModeControlPlane, HealthCheckURL: "http://{node.host}/health"}, ""},
+		{Spec{HealthCheckMode: HealthModeControlPlane}, "need a health check URL"},
+		{Spec{HealthCheckMode: "sidecar", HealthCheckURL: "/health"}, "unknown health check mode"},
+	}
+	for _, tt := range tests {
+		err := validateHealthMode(tt.spec)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%+v: unexpected error %v", tt.spec, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%+v: err = %v, want %q", tt.spec, err, tt.wantErr)
+		}
+	}
+}
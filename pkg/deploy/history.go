@@ -0,0 +1,328 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/audit"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// historyCommandType marks fleet execution records that hold a deployment.
+// The record's command data is the JSON-encoded Result, so the full Spec —
+// including RollbackCommand — can be recovered later.
+const historyCommandType = "deploy"
+
+// Environment returns the env label the deploy targeted, or "" when the
+// target was not scoped to one environment.
+func (s Spec) Environment() string {
+	if env := s.Target.Labels["env"]; env != "" {
+		return env
+	}
+	for _, m := range s.Target.LabelMatchers {
+		if m.Key == "env" && m.Op == fleet.LabelOpEq && len(m.Values) == 1 {
+			return m.Values[0]
+		}
+	}
+	return ""
+}
+
+// record persists result in the fleet execution store so it shows up in
+// History. Failures are logged; a deploy never fails because of them.
+func (d *Deployer) record(ctx context.Context, result *Result) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		d.logger.Warn("failed to encode deploy record", "id", result.ID, "error", err)
+		return
+	}
+
+	req := &fleet.ExecRequest{
+		ID:        result.ID,
+		Target:    result.Spec.Target,
+		Command:   fleet.TypedCommand{Type: historyCommandType, Data: data},
+		Requester: result.Spec.Requester,
+		CreatedAt: result.StartedAt,
+	}
+	execResult := &fleet.ExecResult{
+		RequestID:  result.ID,
+		Duration:   result.Duration,
+		StartedAt:  result.StartedAt,
+		FinishedAt: result.FinishedAt,
+	}
+	for _, b := range result.Batches {
+		for _, nr := range b.Nodes {
+			execResult.NodeResults = append(execResult.NodeResults, nr)
+			execResult.Summary.Total++
+			switch nr.Status {
+			case "success":
+				execResult.Summary.Success++
+			case "timeout":
+				execResult.Summary.Timeout++
+			case "skipped":
+				execResult.Summary.Skipped++
+			case "unreachable":
+				execResult.Summary.Unreachable++
+			case "cancelled":
+				execResult.Summary.Cancelled++
+			case "denied", "blocked":
+				execResult.Summary.Denied++
+			default:
+				execResult.Summary.Failed++
+			}
+		}
+	}
+
+	if err := d.store.RecordExecution(ctx, req, execResult); err != nil {
+		d.logger.Warn("failed to record deploy", "id", result.ID, "error", err)
+	}
+}
+
+// History returns the recorded deployments of service, newest first. An
+// empty service returns every deployment.
+func (d *Deployer) History(ctx context.Context, service string) ([]*Result, error) {
+	reqs, err := d.store.ListExecutions(ctx, fleet.ListExecOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list executions: %w", err)
+	}
+
+	var history []*Result
+	for _, req := range reqs {
+		if req.Command.Type != historyCommandType {
+			continue
+		}
+		var r Result
+		if err := json.Unmarshal(req.Command.Data, &r); err != nil {
+			d.logger.Warn("skipping unreadable deploy record", "id", req.ID, "error", err)
+			continue
+		}
+		if service != "" && r.Spec.Service != service {
+			continue
+		}
+		history = append(history, &r)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].StartedAt.After(history[j].StartedAt)
+	})
+	return history, nil
+}
+
+// RollbackTargets picks, for each environment service was deployed to, the
+// most recent deployment that completed without being rolled back. When
+// envs is non-empty only those environments are considered. The result is
+// ordered by environment name.
+func (d *Deployer) RollbackTargets(ctx context.Context, service string, envs []string) ([]*Result, error) {
+	history, err := d.History(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return latestSuccessfulByEnv(history, envs), nil
+}
+
+// latestSuccessfulByEnv expects history newest first.
+func latestSuccessfulByEnv(history []*Result, envs []string) []*Result {
+	wanted := make(map[string]bool, len(envs))
+	for _, env := range envs {
+		wanted[env] = true
+	}
+
+	latest := make(map[string]*Result)
+	for _, r := range history {
+		if r.State != StateComplete || r.RolledBack || r.RollbackOf != "" {
+			continue
+		}
+		env := r.Spec.Environment()
+		if len(wanted) > 0 && !wanted[env] {
+			continue
+		}
+		if _, seen := latest[env]; !seen {
+			latest[env] = r
+		}
+	}
+
+	out := make([]*Result, 0, len(latest))
+	for _, r := range latest {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Spec.Environment() < out[j].Spec.Environment()
+	})
+	return out
+}
+
+// ErrNoRollbackCommand is returned when a recorded deploy has no
+// RollbackCommand to replay.
+var ErrNoRollbackCommand = errors.New("deploy has no rollback command")
+
+// RollbackAll runs the rollback command of each prior deployment, usually
+// the output of RollbackTargets. Environments are rolled back one at a
+// time unless parallel is set. Every rollback is attempted; the returned
+// error joins the individual failures.
+func (d *Deployer) RollbackAll(ctx context.Context, deploys []*Result, parallel bool) ([]*Result, error) {
+	results := make([]*Result, len(deploys))
+	errs := make([]error, len(deploys))
+
+	run := func(i int) {
+		results[i], errs[i] = d.rollbackDeploy(ctx, deploys[i])
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%s (%s): %w", EnvName(deploys[i].Spec.Environment()), deploys[i].ID, errs[i])
+		}
+	}
+
+	if parallel {
+		var wg sync.WaitGroup
+		for i := range deploys {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range deploys {
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				continue
+			}
+			run(i)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// RollbackByID replays the rollback command of the recorded deployment id
+// against its original target. The rollback is recorded as a new
+// deployment whose RollbackOf is id.
+func (d *Deployer) RollbackByID(ctx context.Context, id string) (*Result, error) {
+	prior, err := d.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return d.rollbackDeploy(ctx, prior)
+}
+
+// lookup loads a recorded deployment from the fleet execution store.
+func (d *Deployer) lookup(ctx context.Context, id string) (*Result, error) {
+	req, _, err := d.store.GetExecution(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("look up deploy %s: %w", id, err)
+	}
+	if req == nil || req.Command.Type != historyCommandType {
+		return nil, fmt.Errorf("%s is not a deployment", id)
+	}
+	var r Result
+	if err := json.Unmarshal(req.Command.Data, &r); err != nil {
+		return nil, fmt.Errorf("decode deploy %s: %w", id, err)
+	}
+	return &r, nil
+}
+
+// rollbackDeploy re-resolves prior's target and runs its RollbackCommand.
+// The rollback is recorded in history as its own deployment.
+func (d *Deployer) rollbackDeploy(ctx context.Context, prior *Result) (*Result, error) {
+	spec := prior.Spec
+	if spec.RollbackCommand == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoRollbackCommand, prior.ID)
+	}
+	release, err := d.acquireLock(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	result := &Result{
+		ID:         fmt.Sprintf("rollback_%d", start.UnixNano()),
+		Spec:       spec,
+		State:      StateRollback,
+		StartedAt:  start,
+		RolledBack: true,
+		RollbackOf: prior.ID,
+	}
+	defer d.record(ctx, result)
+	defer d.auditRollback(ctx, result)
+
+	d.logger.Warn("rolling back deployment",
+		"id", prior.ID,
+		"service", spec.Service,
+		"version", spec.Version,
+		"env", spec.Environment(),
+	)
+
+	roster, err := d.store.ListNodes(ctx)
+	if err != nil {
+		return d.fail(result, fmt.Errorf("list nodes: %w", err))
+	}
+	targets := spec.Target.Resolve(roster)
+	if len(targets) == 0 {
+		return d.fail(result, fleet.NoTargetsError(&spec.Target, roster))
+	}
+
+	cmdJSON, _ := json.Marshal(fleet.ShellCommand{Command: spec.RollbackCommand})
+	req := &fleet.ExecRequest{
+		ID:        result.ID + "_exec",
+		Target:    fleet.TargetSelector{NodeIDs: nodeIDs(targets)},
+		Command:   fleet.TypedCommand{Type: "shell", Data: cmdJSON},
+		Timeout:   5 * time.Minute,
+		Requester: spec.Requester,
+	}
+	execResult, err := d.executor.Execute(ctx, req)
+	if err != nil {
+		return d.fail(result, err)
+	}
+	result.Batches = []BatchResult{{
+		Nodes:      execResult.NodeResults,
+		StartedAt:  execResult.StartedAt,
+		FinishedAt: execResult.FinishedAt,
+	}}
+	for _, nr := range execResult.NodeResults {
+		if nr.Status != "success" {
+			return d.fail(result, fmt.Errorf("rollback failed on node %s: %s", nr.NodeID, nr.Error))
+		}
+	}
+	result.Batches[0].HealthOK = true
+
+	result.State = StateComplete
+	result.FinishedAt = time.Now()
+	result.Duration = result.FinishedAt.Sub(start)
+	return result, nil
+}
+
+func (d *Deployer) auditRollback(ctx context.Context, result *Result) {
+	if d.auditLog == nil {
+		return
+	}
+	ev := &audit.EventResult{Status: "success", Duration: result.Duration, Error: result.Error}
+	if result.State != StateComplete {
+		ev.Status = "failure"
+	}
+	for _, b := range result.Batches {
+		for _, nr := range b.Nodes {
+			ev.NodesTotal++
+			if nr.Status == "success" {
+				ev.NodesSuccess++
+			} else {
+				ev.NodesFailed++
+			}
+		}
+	}
+	spec := result.Spec
+	if err := d.auditLog.LogDeployRollback(ctx, spec.Service, spec.Version, spec.Environment(), result.RollbackOf, ev); err != nil {
+		d.logger.Warn("failed to audit rollback", "id", result.ID, "error", err)
+	}
+}
+
+// EnvName returns env for display, or "(no env)" for deploys without an
+// env label.
+func EnvName(env string) string {
+	if env == "" {
+		return "(no env)"
+	}
+	return env
+}
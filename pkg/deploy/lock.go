@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// ErrDeployInProgress is returned when another deploy or manual rollback
+// of the same service and environment holds the deploy lock.
+var ErrDeployInProgress = errors.New("deployment already in progress")
+
+// defaultLockTTL is how long a deploy lock outlives a crashed holder. A
+// running deploy extends it every third of the TTL.
+const defaultLockTTL = 2 * time.Minute
+
+// lockKey is the fleet store lock serializing deploys of spec's service
+// to spec's environment.
+func lockKey(spec Spec) string {
+	return "deploy:" + spec.Service + ":" + spec.Environment()
+}
+
+// acquireLock takes the deploy lock for spec and keeps extending it until
+// the returned release func is called.
+func (d *Deployer) acquireLock(ctx context.Context, spec Spec) (release func(), err error) {
+	ttl := d.lockTTL
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	key := lockKey(spec)
+	lock, err := d.store.AcquireLock(ctx, key, ttl)
+	if errors.Is(err, fleet.ErrLockHeld) {
+		if env := spec.Environment(); env != "" {
+			return nil, fmt.Errorf("%w for service %s in env %s", ErrDeployInProgress, spec.Service, env)
+		}
+		return nil, fmt.Errorf("%w for service %s", ErrDeployInProgress, spec.Service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("acquire deploy lock: %w", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := lock.Extend(context.Background(), ttl); err != nil {
+					d.logger.Warn("failed to extend deploy lock", "key", key, "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		// The deploy's context may be cancelled by now; release anyway.
+		if err := lock.Unlock(context.Background()); err != nil {
+			d.logger.Warn("failed to release deploy lock", "key", key, "error", err)
+		}
+	}, nil
+}
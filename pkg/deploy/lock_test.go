@@ -0,0 +1,116 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// blockingRelay holds every command until release is closed, signalling
+// started on the first one.
+type blockingRelay struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingRelay() *blockingRelay {
+	return &blockingRelay{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (r *blockingRelay) Execute(ctx context.Context, node *fleet.Node, _ fleet.TypedCommand) (*fleet.NodeResult, error) {
+	select {
+	case r.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &fleet.NodeResult{NodeID: node.ID, Output: "ok"}, nil
+}
+
+func (r *blockingRelay) Ping(_ context.Context, _ *fleet.Node) error { return nil }
+
+func newSQLiteDeployer(t *testing.T, path string, relay fleet.RelayClient) *Deployer {
+	t.Helper()
+	store, err := fleet.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, env := range []string{"prod", "staging"} {
+		store.RegisterNode(context.Background(), &fleet.Node{
+			ID:     fleet.NodeID(env + "-1"),
+			Status: fleet.NodeStatusOnline,
+			Labels: map[string]string{"env": env},
+		})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := NewDeployer(fleet.NewExecutor(store, relay, logger), store, logger)
+	d.lockTTL = 30 * time.Millisecond
+	return d
+}
+
+func TestDeploy_ConcurrentDeployRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.db")
+	relay := newBlockingRelay()
+	first := newSQLiteDeployer(t, path, relay)
+	// A second operator's process, sharing the fleet database.
+	second := newSQLiteDeployer(t, path, &scriptedRelay{})
+	ctx := context.Background()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := first.Deploy(ctx, envSpec("prod", "v2"))
+		errc <- err
+	}()
+	<-relay.started
+
+	// Outlive the lock TTL so the holder has to extend it.
+	time.Sleep(100 * time.Millisecond)
+
+	for _, d := range []*Deployer{first, second} {
+		_, err := d.Deploy(ctx, envSpec("prod", "v3"))
+		if !errors.Is(err, ErrDeployInProgress) {
+			t.Fatalf("concurrent deploy: err = %v, want ErrDeployInProgress", err)
+		}
+		if want := "deployment already in progress for service myapp in env prod"; err.Error() != want {
+			t.Errorf("error = %q, want %q", err, want)
+		}
+	}
+
+	// Another environment is not blocked.
+	if _, err := second.Deploy(ctx, envSpec("staging", "v3")); err != nil {
+		t.Errorf("deploy to staging: %v", err)
+	}
+
+	close(relay.release)
+	if err := <-errc; err != nil {
+		t.Fatalf("first deploy: %v", err)
+	}
+	if _, err := second.Deploy(ctx, envSpec("prod", "v3")); err != nil {
+		t.Errorf("deploy after the lock was released: %v", err)
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	tests := []struct {
+		spec Spec
+		want string
+	}{
+		{envSpec("prod", "v1"), "deploy:myapp:prod"},
+		{Spec{Service: "api", Target: fleet.TargetSelector{All: true}}, "deploy:api:"},
+	}
+	for _, tt := range tests {
+		if got := lockKey(tt.spec); got != tt.want {
+			t.Errorf("lockKey(%s) = %q, want %q", tt.spec.Service, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// Notifier is told when a deployment changes state. The Deployer calls it
+// on transitions to StateRollback and StateFailed, synchronously, so
+// implementations should bound their own latency. A notifier cannot fail a
+// deploy; it is expected to log its own errors.
+type Notifier interface {
+	OnStateChange(result *Result, from, to State)
+}
+
+// notifyStates are the transitions a Deployer reports to its Notifier.
+var notifyStates = map[State]bool{
+	StateRollback: true,
+	StateFailed:   true,
+}
+
+// SetNotifier sets who is told about rollbacks and failures.
+func (d *Deployer) SetNotifier(n Notifier) {
+	d.notifier = n
+}
+
+// setState moves result to state and notifies if the transition is one
+// operators need to hear about.
+func (d *Deployer) setState(result *Result, to State) {
+	from := result.State
+	result.State = to
+	if d.notifier != nil && from != to && notifyStates[to] {
+		d.notifier.OnStateChange(result, from, to)
+	}
+}
+
+// DefaultWebhookTimeout bounds a single webhook delivery.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON body WebhookNotifier posts. Text is a one-line
+// summary, so Slack incoming webhooks render it without any adapter.
+type WebhookPayload struct {
+	Text        string         `json:"text"`
+	ID          string         `json:"id"`
+	Service     string         `json:"service"`
+	Version     string         `json:"version"`
+	Strategy    Strategy       `json:"strategy"`
+	Environment string         `json:"environment,omitempty"`
+	From        State          `json:"from"`
+	State       State          `json:"state"`
+	RolledBack  bool           `json:"rolled_back"`
+	FailedNodes []fleet.NodeID `json:"failed_nodes"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// WebhookNotifier posts a WebhookPayload to URL on every notified
+// transition. Delivery failures are logged and otherwise ignored.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+	Logger *slog.Logger
+}
+
+// NewWebhookNotifier creates a notifier posting to url with
+// DefaultWebhookTimeout.
+func NewWebhookNotifier(url string, logger *slog.Logger) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: DefaultWebhookTimeout},
+		Logger: logger,
+	}
+}
+
+// OnStateChange implements Notifier.
+func (n *WebhookNotifier) OnStateChange(result *Result, from, to State) {
+	if err := n.post(newWebhookPayload(result, from, to)); err != nil && n.Logger != nil {
+		n.Logger.Warn("deploy notification failed", "id", result.ID, "state", to, "error", err)
+	}
+}
+
+func (n *WebhookNotifier) post(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func newWebhookPayload(result *Result, from, to State) WebhookPayload {
+	spec := result.Spec
+	p := WebhookPayload{
+		ID:          result.ID,
+		Service:     spec.Service,
+		Version:     spec.Version,
+		Strategy:    spec.Strategy,
+		Environment: spec.Environment(),
+		From:        from,
+		State:       to,
+		RolledBack:  result.RolledBack,
+		FailedNodes: failedNodes(result),
+		Error:       result.Error,
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Deploy %s:%s", spec.Service, spec.Version)
+	if p.Environment != "" {
+		fmt.Fprintf(&b, " to %s", p.Environment)
+	}
+	fmt.Fprintf(&b, " (%s) is %s", spec.Strategy, to)
+	if to == StateFailed && result.RolledBack {
+		b.WriteString(", rolled back")
+	}
+	if len(p.FailedNodes) > 0 {
+		fmt.Fprintf(&b, "; %d node(s) failed", len(p.FailedNodes))
+	}
+	if p.Error != "" {
+		fmt.Fprintf(&b, ": %s", p.Error)
+	}
+	p.Text = b.String()
+	return p
+}
+
+// failedNodes lists the nodes whose deploy command did not succeed, sorted
+// by ID since nodes within a batch finish in any order.
+func failedNodes(result *Result) []fleet.NodeID {
+	ids := []fleet.NodeID{}
+	for _, batch := range result.Batches {
+		for _, nr := range batch.Nodes {
+			if nr.Status != "success" {
+				ids = append(ids, nr.NodeID)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,141 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// webhookRecorder is an httptest server that keeps every payload posted to it.
+type webhookRecorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	payloads []WebhookPayload
+}
+
+func newWebhookRecorder(t *testing.T, status int) *webhookRecorder {
+	t.Helper()
+	rec := &webhookRecorder{}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var p WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		rec.mu.Lock()
+		rec.payloads = append(rec.payloads, p)
+		rec.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func (r *webhookRecorder) received() []WebhookPayload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WebhookPayload(nil), r.payloads...)
+}
+
+func TestWebhookNotifier_FailedDeployWithRollback(t *testing.T) {
+	hook := newWebhookRecorder(t, http.StatusOK)
+	relay := &scriptedRelay{failOn: []string{"./deploy.sh"}}
+	d := newEnvDeployer(t, relay, "prod")
+	d.SetNotifier(NewWebhookNotifier(hook.URL, d.logger))
+
+	spec := envSpec("prod", "v2.1.3")
+	spec.RollbackOnFail = true
+	result, err := d.Deploy(context.Background(), spec)
+	if err == nil {
+		t.Fatal("expected deploy to fail")
+	}
+
+	got := hook.received()
+	if len(got) != 2 {
+		t.Fatalf("expected rollback and failed notifications, got %d: %+v", len(got), got)
+	}
+	rollback, failed := got[0], got[1]
+	if rollback.State != StateRollback || rollback.From != StateRunning {
+		t.Errorf("first notification = %s→%s, want running→rollback", rollback.From, rollback.State)
+	}
+	if failed.State != StateFailed || failed.From != StateRollback {
+		t.Errorf("second notification = %s→%s, want rollback→failed", failed.From, failed.State)
+	}
+
+	if failed.ID != result.ID || failed.Service != "myapp" || failed.Version != "v2.1.3" ||
+		failed.Strategy != StrategyAllAtOnce || failed.Environment != "prod" {
+		t.Errorf("payload identity = %+v", failed)
+	}
+	if !failed.RolledBack {
+		t.Error("expected rolled_back in the failed notification")
+	}
+	if len(failed.FailedNodes) != 2 || failed.FailedNodes[0] != "prod-1" || failed.FailedNodes[1] != "prod-2" {
+		t.Errorf("failed_nodes = %v, want [prod-1 prod-2]", failed.FailedNodes)
+	}
+	if failed.Error == "" || rollback.Error == "" {
+		t.Errorf("expected the deploy error in both payloads, got %q and %q", rollback.Error, failed.Error)
+	}
+	if !strings.Contains(failed.Text, "Deploy myapp:v2.1.3 to prod (all-at-once) is failed, rolled back; 2 node(s) failed") {
+		t.Errorf("text = %q", failed.Text)
+	}
+}
+
+func TestWebhookNotifier_SuccessIsQuiet(t *testing.T) {
+	hook := newWebhookRecorder(t, http.StatusOK)
+	d := newEnvDeployer(t, &scriptedRelay{}, "prod")
+	d.SetNotifier(NewWebhookNotifier(hook.URL, d.logger))
+
+	if _, err := d.Deploy(context.Background(), envSpec("prod", "v2")); err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if got := hook.received(); len(got) != 0 {
+		t.Errorf("expected no notifications for a clean deploy, got %+v", got)
+	}
+}
+
+func TestWebhookNotifier_DeliveryFailureIsNonFatal(t *testing.T) {
+	hook := newWebhookRecorder(t, http.StatusInternalServerError)
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	n := NewWebhookNotifier(hook.URL, logger)
+	n.OnStateChange(&Result{ID: "deploy_1", Spec: Spec{Service: "myapp"}}, StateRunning, StateFailed)
+
+	if len(hook.received()) != 1 {
+		t.Fatal("expected the webhook to be called")
+	}
+	if !strings.Contains(logs.String(), "deploy notification failed") || !strings.Contains(logs.String(), "500") {
+		t.Errorf("expected the failure to be logged, got %q", logs.String())
+	}
+
+	// An unreachable endpoint is logged the same way.
+	hook.Close()
+	n.OnStateChange(&Result{ID: "deploy_2"}, StateRunning, StateFailed)
+	if got := strings.Count(logs.String(), "deploy notification failed"); got != 2 {
+		t.Errorf("expected 2 logged failures, got %d", got)
+	}
+
+	// A deploy still reports its own outcome when notifications fail.
+	d := newTestDeployer(t, &scriptedRelay{failOn: []string{"./deploy.sh"}}, 1)
+	d.SetNotifier(NewWebhookNotifier(hook.URL, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	result, err := d.Deploy(context.Background(), Spec{
+		Service:       "myapp",
+		Version:       "v1",
+		Strategy:      StrategyAllAtOnce,
+		Target:        fleet.TargetSelector{All: true},
+		DeployCommand: "./deploy.sh",
+	})
+	if err == nil || result.State != StateFailed {
+		t.Errorf("deploy = %v, %v; want its own failure", result.State, err)
+	}
+}
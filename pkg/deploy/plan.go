@@ -0,0 +1,189 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// Strategies lists every supported deployment strategy.
+var Strategies = []Strategy{StrategyRolling, StrategyCanary, StrategyBlueGreen, StrategyAllAtOnce, StrategySerial}
+
+// Valid reports whether s is a supported strategy.
+func (s Strategy) Valid() bool {
+	for _, known := range Strategies {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStrategy returns an error naming the valid strategies if s is
+// not one of them.
+func validateStrategy(s Strategy) error {
+	if s.Valid() {
+		return nil
+	}
+	names := make([]string, len(Strategies))
+	for i, known := range Strategies {
+		names[i] = string(known)
+	}
+	return fmt.Errorf("unknown strategy: %s (valid: %s)", s, strings.Join(names, ", "))
+}
+
+// DeployPlan is the batch breakdown a deployment would follow, computed
+// without running anything.
+type DeployPlan struct {
+	Service  string         `json:"service"`
+	Version  string         `json:"version"`
+	Strategy Strategy       `json:"strategy"`
+	Nodes    int            `json:"nodes"` // resolved target count
+	Batches  []PlannedBatch `json:"batches"`
+
+	// CapOverride is set when the target exceeds MaxNodesPerDeploy and
+	// the spec forces past it.
+	CapOverride bool `json:"cap_override,omitempty"`
+}
+
+// PlannedBatch is one step of a DeployPlan.
+type PlannedBatch struct {
+	Index   int            `json:"index"`
+	Percent int            `json:"percent,omitempty"` // canary: cumulative share of the fleet after this batch
+	Nodes   []fleet.NodeID `json:"nodes"`
+}
+
+// Summary describes the plan in one line, e.g. "4 rolling batches of up to
+// 2 nodes" or "canary 5%→25%→100%".
+func (p *DeployPlan) Summary() string {
+	switch p.Strategy {
+	case StrategyCanary:
+		steps := make([]string, len(p.Batches))
+		for i, b := range p.Batches {
+			steps[i] = fmt.Sprintf("%d%%", b.Percent)
+		}
+		return "canary " + strings.Join(steps, "→")
+	case StrategyRolling:
+		largest, uniform := 0, true
+		for _, b := range p.Batches {
+			if len(b.Nodes) > largest {
+				largest = len(b.Nodes)
+			}
+			uniform = uniform && len(b.Nodes) == len(p.Batches[0].Nodes)
+		}
+		size := fmt.Sprintf("%d node(s)", largest)
+		if !uniform {
+			size = "up to " + size
+		}
+		return fmt.Sprintf("%d rolling batch(es) of %s", len(p.Batches), size)
+	case StrategySerial:
+		return fmt.Sprintf("%d serial step(s) of 1 node", len(p.Batches))
+	default:
+		return fmt.Sprintf("%s: 1 batch of %d node(s)", p.Strategy, p.Nodes)
+	}
+}
+
+// Plan validates spec, resolves its targets, and returns the batches
+// Deploy would run, without executing or recording anything. A target
+// over MaxNodesPerDeploy fails the same way Deploy would.
+func (d *Deployer) Plan(ctx context.Context, spec Spec) (*DeployPlan, error) {
+	if spec.Service == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	if spec.Version == "" {
+		return nil, fmt.Errorf("version is required")
+	}
+	if err := validateStrategy(spec.Strategy); err != nil {
+		return nil, err
+	}
+	if err := validateHealthMode(spec); err != nil {
+		return nil, err
+	}
+
+	roster, err := d.store.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+	targets := spec.Target.Resolve(roster)
+	if len(targets) == 0 {
+		return nil, fleet.NoTargetsError(&spec.Target, roster)
+	}
+
+	plan := &DeployPlan{
+		Service:  spec.Service,
+		Version:  spec.Version,
+		Strategy: spec.Strategy,
+		Nodes:    len(targets),
+	}
+	if spec.MaxNodesPerDeploy > 0 && len(targets) > spec.MaxNodesPerDeploy {
+		if !spec.ForceOverCap {
+			return nil, fmt.Errorf("%w: target resolved to %d nodes, cap is %d (narrow the selector or use --force)",
+				ErrBlastRadius, len(targets), spec.MaxNodesPerDeploy)
+		}
+		plan.CapOverride = true
+	}
+
+	switch spec.Strategy {
+	case StrategyRolling:
+		for i, batch := range splitIntoBatches(targets, rollingBatchSize(spec)) {
+			plan.Batches = append(plan.Batches, PlannedBatch{Index: i, Nodes: nodeIDs(batch)})
+		}
+	case StrategyCanary:
+		for _, step := range canarySteps(spec, targets) {
+			plan.Batches = append(plan.Batches, PlannedBatch{Index: step.index, Percent: step.percent, Nodes: nodeIDs(step.nodes)})
+		}
+	case StrategySerial:
+		for i, node := range targets {
+			plan.Batches = append(plan.Batches, PlannedBatch{Index: i, Nodes: []fleet.NodeID{node.ID}})
+		}
+	default:
+		plan.Batches = []PlannedBatch{{Index: 0, Nodes: nodeIDs(targets)}}
+	}
+	return plan, nil
+}
+
+// rollingBatchSize is the number of nodes deployed at once by a rolling
+// deploy.
+func rollingBatchSize(spec Spec) int {
+	if spec.MaxUnavailable <= 0 {
+		return 1
+	}
+	return spec.MaxUnavailable
+}
+
+// canaryStep is one non-empty batch of a canary rollout.
+type canaryStep struct {
+	index   int // position in the percentage list
+	percent int
+	nodes   []*fleet.Node
+}
+
+// canarySteps splits targets by the spec's cumulative canary percentages.
+// Each step deploys at least one node; a percentage that adds no nodes
+// beyond the previous step is skipped.
+func canarySteps(spec Spec, targets []*fleet.Node) []canaryStep {
+	percentages := spec.CanaryPercent
+	if len(percentages) == 0 {
+		percentages = []int{5, 25, 100} // default canary percentages
+	}
+
+	var steps []canaryStep
+	deployed := 0
+	for i, pct := range percentages {
+		target := (len(targets) * pct) / 100
+		if target < 1 {
+			target = 1
+		}
+		if target > len(targets) {
+			target = len(targets)
+		}
+		if target <= deployed {
+			continue
+		}
+		steps = append(steps, canaryStep{index: i, percent: pct, nodes: targets[deployed:target]})
+		deployed = target
+	}
+	return steps
+}
@@ -0,0 +1,176 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+func TestStrategy_Valid(t *testing.T) {
+	for _, s := range Strategies {
+		if !s.Valid() {
+			t.Errorf("%q should be valid", s)
+		}
+	}
+	for _, s := range []Strategy{"", "rollng", "Rolling"} {
+		if s.Valid() {
+			t.Errorf("%q should not be valid", s)
+		}
+	}
+}
+
+func TestDeploy_UnknownStrategyFailsUpFront(t *testing.T) {
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 3)
+
+	_, err := d.Deploy(context.Background(), Spec{
+		Service:       "myapp",
+		Version:       "v2.0.0",
+		Strategy:      "rollng",
+		Target:        fleet.TargetSelector{All: true},
+		DeployCommand: "./deploy.sh",
+	})
+	want := "unknown strategy: rollng (valid: rolling, canary, blue-green, all-at-once, serial)"
+	if err == nil || err.Error() != want {
+		t.Fatalf("err = %v, want %q", err, want)
+	}
+	if cmds := relay.commands(); len(cmds) != 0 {
+		t.Errorf("expected nothing to run, got %v", cmds)
+	}
+}
+
+func TestDeployer_Plan(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        Spec
+		wantSizes   []int
+		wantPercent []int
+		wantSummary string
+	}{
+		{
+			name:        "rolling",
+			spec:        Spec{Strategy: StrategyRolling, MaxUnavailable: 2},
+			wantSizes:   []int{2, 2, 2, 1},
+			wantSummary: "4 rolling batch(es) of up to 2 node(s)",
+		},
+		{
+			name:        "rolling default batch size",
+			spec:        Spec{Strategy: StrategyRolling},
+			wantSizes:   []int{1, 1, 1, 1, 1, 1, 1},
+			wantSummary: "7 rolling batch(es) of 1 node(s)",
+		},
+		{
+			name:        "canary",
+			spec:        Spec{Strategy: StrategyCanary, CanaryPercent: []int{10, 50, 100}},
+			wantSizes:   []int{1, 2, 4},
+			wantPercent: []int{10, 50, 100},
+			wantSummary: "canary 10%→50%→100%",
+		},
+		{
+			// 25% of 7 rounds down to the single node already deployed at 5%.
+			name:        "canary default skips empty step",
+			spec:        Spec{Strategy: StrategyCanary},
+			wantSizes:   []int{1, 6},
+			wantPercent: []int{5, 100},
+			wantSummary: "canary 5%→100%",
+		},
+		{
+			name:        "blue-green",
+			spec:        Spec{Strategy: StrategyBlueGreen},
+			wantSizes:   []int{7},
+			wantSummary: "blue-green: 1 batch of 7 node(s)",
+		},
+		{
+			name:        "all-at-once",
+			spec:        Spec{Strategy: StrategyAllAtOnce},
+			wantSizes:   []int{7},
+			wantSummary: "all-at-once: 1 batch of 7 node(s)",
+		},
+		{
+			name:        "serial",
+			spec:        Spec{Strategy: StrategySerial},
+			wantSizes:   []int{1, 1, 1, 1, 1, 1, 1},
+			wantSummary: "7 serial step(s) of 1 node",
+		},
+	}
+
+	relay := &scriptedRelay{}
+	d := newTestDeployer(t, relay, 7)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			spec.Service, spec.Version = "myapp", "v2.0.0"
+			spec.Target = fleet.TargetSelector{All: true}
+
+			plan, err := d.Plan(context.Background(), spec)
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if plan.Nodes != 7 {
+				t.Errorf("Nodes = %d, want 7", plan.Nodes)
+			}
+
+			var sizes, percents []int
+			seen := map[fleet.NodeID]bool{}
+			for _, b := range plan.Batches {
+				sizes = append(sizes, len(b.Nodes))
+				if b.Percent != 0 {
+					percents = append(percents, b.Percent)
+				}
+				for _, id := range b.Nodes {
+					if seen[id] {
+						t.Errorf("node %s planned twice", id)
+					}
+					seen[id] = true
+				}
+			}
+			if !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tt.wantSizes)
+			}
+			if !reflect.DeepEqual(percents, tt.wantPercent) {
+				t.Errorf("percents = %v, want %v", percents, tt.wantPercent)
+			}
+			if len(seen) != 7 {
+				t.Errorf("plan covers %d nodes, want 7", len(seen))
+			}
+			if got := plan.Summary(); got != tt.wantSummary {
+				t.Errorf("Summary() = %q, want %q", got, tt.wantSummary)
+			}
+		})
+	}
+
+	if cmds := relay.commands(); len(cmds) != 0 {
+		t.Errorf("Plan ran commands: %v", cmds)
+	}
+}
+
+func TestDeployer_PlanErrors(t *testing.T) {
+	d := newTestDeployer(t, &scriptedRelay{}, 7)
+	ctx := context.Background()
+
+	spec := Spec{Service: "myapp", Version: "v2.0.0", Strategy: "rollng", Target: fleet.TargetSelector{All: true}}
+	if _, err := d.Plan(ctx, spec); err == nil || !strings.Contains(err.Error(), "unknown strategy: rollng") {
+		t.Errorf("unknown strategy: err = %v", err)
+	}
+
+	spec.Strategy = StrategyRolling
+	spec.MaxNodesPerDeploy = 5
+	if _, err := d.Plan(ctx, spec); !errors.Is(err, ErrBlastRadius) {
+		t.Errorf("over cap: err = %v, want ErrBlastRadius", err)
+	}
+
+	spec.ForceOverCap = true
+	plan, err := d.Plan(ctx, spec)
+	if err != nil || !plan.CapOverride {
+		t.Errorf("forced over cap: plan = %+v, err = %v; want CapOverride", plan, err)
+	}
+
+	spec = Spec{Service: "myapp", Version: "v2.0.0", Strategy: StrategyRolling, Target: fleet.TargetSelector{NodeIDs: []fleet.NodeID{"nope"}}}
+	if _, err := d.Plan(ctx, spec); err == nil || !strings.Contains(err.Error(), "no nodes matched") {
+		t.Errorf("no targets: err = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package fleet
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BatchPolicy splits an ExecRequest's targets into batches that run one
+// after another, in node ID order. Within a batch, nodes run concurrently
+// up to Target.MaxConcurrency. Set either Size or Percent.
+type BatchPolicy struct {
+	Size    int `json:"size,omitempty"`    // nodes per batch
+	Percent int `json:"percent,omitempty"` // share of the matched nodes per batch, 1-100
+
+	// HaltOnError stops after a batch in which any node did not succeed.
+	// The nodes of later batches are reported as skipped.
+	HaltOnError bool `json:"halt_on_error,omitempty"`
+}
+
+// BatchByCount runs n nodes at a time.
+func BatchByCount(n int) *BatchPolicy {
+	return &BatchPolicy{Size: n}
+}
+
+// BatchByPercent runs pct percent of the matched nodes at a time.
+func BatchByPercent(pct int) *BatchPolicy {
+	return &BatchPolicy{Percent: pct}
+}
+
+// Validate checks that exactly one of Size and Percent is set and in range.
+func (p *BatchPolicy) Validate() error {
+	switch {
+	case p.Size != 0 && p.Percent != 0:
+		return fmt.Errorf("batch size and percent are mutually exclusive")
+	case p.Size < 0:
+		return fmt.Errorf("batch size must not be negative")
+	case p.Percent < 0 || p.Percent > 100:
+		return fmt.Errorf("batch percent %d is out of range 1-100", p.Percent)
+	case p.Size == 0 && p.Percent == 0:
+		return fmt.Errorf("batch policy needs a size or a percent")
+	}
+	return nil
+}
+
+// BatchSize returns how many of total nodes go in each batch. A
+// percentage is rounded up, so 10% of 25 nodes is 3 and every batch has
+// at least one node.
+func (p *BatchPolicy) BatchSize(total int) int {
+	size := p.Size
+	if p.Percent > 0 {
+		size = (total*p.Percent + 99) / 100
+	}
+	if size < 1 {
+		size = 1
+	}
+	if size > total {
+		size = total
+	}
+	return size
+}
+
+// batches splits targets by the policy; a nil policy is a single batch.
+func (p *BatchPolicy) batches(targets []*Node) [][]*Node {
+	if p == nil || len(targets) == 0 {
+		return [][]*Node{targets}
+	}
+	ordered := make([]*Node, len(targets))
+	copy(ordered, targets)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].ID < ordered[j].ID })
+
+	size := p.BatchSize(len(ordered))
+	var out [][]*Node
+	for start := 0; start < len(ordered); start += size {
+		end := min(start+size, len(ordered))
+		out = append(out, ordered[start:end])
+	}
+	return out
+}
+
+// batchFailed reports whether any node in results did not succeed.
+// Skipped and dry-run nodes do not count as failures.
+func batchFailed(results []NodeResult) bool {
+	for _, r := range results {
+		if r.Status != "success" && r.Status != "skipped" && r.Status != "dry-run" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchPolicy_BatchSize(t *testing.T) {
+	tests := []struct {
+		policy *BatchPolicy
+		total  int
+		want   int
+	}{
+		{BatchByPercent(10), 100, 10},
+		{BatchByPercent(10), 25, 3}, // rounded up
+		{BatchByPercent(10), 5, 1},  // never empty
+		{BatchByPercent(50), 3, 2},
+		{BatchByPercent(100), 7, 7},
+		{BatchByCount(4), 10, 4},
+		{BatchByCount(20), 10, 10},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.BatchSize(tt.total); got != tt.want {
+			t.Errorf("%+v.BatchSize(%d) = %d, want %d", *tt.policy, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestBatchPolicy_Batches(t *testing.T) {
+	var nodes []*Node
+	for i := 7; i >= 1; i-- {
+		nodes = append(nodes, &Node{ID: NodeID(fmt.Sprintf("node-%d", i))})
+	}
+
+	var got []string
+	for _, b := range BatchByPercent(40).batches(nodes) {
+		var ids []string
+		for _, n := range b {
+			ids = append(ids, string(n.ID))
+		}
+		got = append(got, strings.Join(ids, ","))
+	}
+	want := []string{"node-1,node-2,node-3", "node-4,node-5,node-6", "node-7"}
+	if strings.Join(got, " | ") != strings.Join(want, " | ") {
+		t.Errorf("batches = %q, want %q", got, want)
+	}
+
+	var none *BatchPolicy
+	if b := none.batches(nodes); len(b) != 1 || len(b[0]) != 7 {
+		t.Errorf("nil policy made %d batches, want one of all nodes", len(b))
+	}
+}
+
+func TestBatchPolicy_Validate(t *testing.T) {
+	for _, p := range []BatchPolicy{{}, {Size: -1}, {Percent: 101}, {Size: 2, Percent: 10}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", p)
+		}
+	}
+	if err := BatchByPercent(10).Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func batchTestExecutor(t *testing.T, relay RelayClient, n int) *Executor {
+	t.Helper()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 1; i <= n; i++ {
+		id := NodeID(fmt.Sprintf("node-%d", i))
+		store.RegisterNode(ctx, &Node{ID: id, Hostname: string(id), Status: NodeStatusOnline})
+	}
+	return NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func batchRequest(id string, batch *BatchPolicy) *ExecRequest {
+	return &ExecRequest{
+		ID:      id,
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+		Batch:   batch,
+	}
+}
+
+func TestExecutor_BatchesRunInOrder(t *testing.T) {
+	relay := &countingRelay{}
+	executor := batchTestExecutor(t, relay, 4)
+
+	result, err := executor.Execute(context.Background(), batchRequest("exec-batch", BatchByPercent(50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Total != 4 || result.Summary.Success != 4 {
+		t.Fatalf("summary = %+v, want 4 successes", result.Summary)
+	}
+	// Each batch finishes before the next starts.
+	first := map[NodeID]bool{}
+	for _, nr := range result.NodeResults[:2] {
+		first[nr.NodeID] = true
+	}
+	if !first["node-1"] || !first["node-2"] {
+		t.Errorf("first batch = %v, want node-1 and node-2", result.NodeResults[:2])
+	}
+}
+
+func TestExecutor_BatchHaltOnError(t *testing.T) {
+	relay := &stubRelay{failNode: "node-2"}
+	executor := batchTestExecutor(t, relay, 5)
+
+	batch := BatchByCount(2)
+	batch.HaltOnError = true
+	result, err := executor.Execute(context.Background(), batchRequest("exec-halt", batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ExecSummary{Total: 5, Success: 1, Failed: 1, Skipped: 3}
+	if result.Summary != want {
+		t.Errorf("summary = %+v, want %+v", result.Summary, want)
+	}
+	for _, nr := range result.NodeResults[2:] {
+		if nr.Status != "skipped" || !strings.Contains(nr.Error, "batch 1 failed") {
+			t.Errorf("%s = status %q error %q, want skipped after batch 1", nr.NodeID, nr.Status, nr.Error)
+		}
+	}
+	for i := 3; i <= 5; i++ {
+		if ids := executor.InFlight(NodeID(fmt.Sprintf("node-%d", i))); len(ids) != 0 {
+			t.Errorf("node-%d still has in-flight requests %v", i, ids)
+		}
+	}
+
+	// Without halting, every batch runs.
+	result, err = executor.Execute(context.Background(), batchRequest("exec-no-halt", BatchByCount(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Success != 4 || result.Summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 4 successes and 1 failure", result.Summary)
+	}
+}
+
+// startCountingRelay counts dispatched commands, each of which blocks until
+// its context is done.
+type startCountingRelay struct {
+	gatedRelay
+	started atomic.Int32
+}
+
+func (r *startCountingRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	r.started.Add(1)
+	return r.gatedRelay.Execute(ctx, node, cmd)
+}
+
+func TestExecutor_TimeoutCoversAllBatches(t *testing.T) {
+	relay := &startCountingRelay{gatedRelay: gatedRelay{release: make(chan struct{})}}
+	executor := batchTestExecutor(t, relay, 3)
+
+	req := batchRequest("exec-batch-timeout", BatchByCount(1))
+	req.Timeout = 100 * time.Millisecond
+	result, err := executor.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Timeout != 3 {
+		t.Fatalf("summary = %+v, want 3 timeouts", result.Summary)
+	}
+	// The first batch uses up the budget; later batches are not dispatched.
+	if n := relay.started.Load(); n != 1 {
+		t.Errorf("dispatched %d nodes, want only the first batch", n)
+	}
+}
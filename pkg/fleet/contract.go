@@ -0,0 +1,156 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
+)
+
+// Defaults and bounds for fleet_exec's timeout_sec.
+const (
+	defaultContractTimeout = 60 * time.Second
+	maxContractTimeoutSec  = 3600
+)
+
+// NewExecContract returns the "fleet_exec" tool, which runs a shell
+// command on fleet nodes through exec. It is meant for AI clients that
+// reach devopsclaw through a contracts.Registry.
+//
+// Each target is "all", a "key=value" label, or a node ID or group name.
+// When the timeout expires, nodes that have answered keep their results
+// and the rest are reported with status "timeout". Errors are kept for
+// requests that can't run at all, such as targets that match no node;
+// failures on individual nodes are in the results.
+func NewExecContract(exec *Executor) contracts.ToolContract[contracts.FleetExecRequest, contracts.FleetExecResponse] {
+	return contracts.ToolContract[contracts.FleetExecRequest, contracts.FleetExecResponse]{
+		ToolName:    "fleet_exec",
+		ToolVersion: "1.0.0",
+		Description: "Run a shell command on fleet nodes selected by node ID, group, key=value label, or \"all\", and return each node's output",
+		Category:    "fleet",
+		Validate: func(req *contracts.FleetExecRequest) error {
+			_, err := contractExecRequest(req, time.Now())
+			return err
+		},
+		ExecuteContext: func(ctx context.Context, req *contracts.FleetExecRequest) (*contracts.FleetExecResponse, error) {
+			execReq, err := contractExecRequest(req, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			result, err := exec.Execute(ctx, execReq)
+			if err != nil {
+				return nil, fmt.Errorf("fleet_exec: %w", err)
+			}
+			return contractExecResponse(result), nil
+		},
+	}
+}
+
+// RegisterExecContract adds the fleet_exec tool, run by exec, to r.
+func RegisterExecContract(r *contracts.Registry, exec *Executor) {
+	c := NewExecContract(exec)
+	contracts.Register(r, c, contracts.ToolMeta{
+		Name:        c.ToolName,
+		Version:     c.ToolVersion,
+		Description: c.Description,
+		Category:    c.Category,
+		Returns:     contracts.GenerateSchema[contracts.FleetExecResponse](),
+	})
+}
+
+// contractExecRequest converts a fleet_exec request to an ExecRequest.
+func contractExecRequest(req *contracts.FleetExecRequest, now time.Time) (*ExecRequest, error) {
+	if strings.TrimSpace(req.Command) == "" {
+		return nil, fmt.Errorf("fleet_exec: command is empty")
+	}
+	if req.TimeoutSec < 0 || req.TimeoutSec > maxContractTimeoutSec {
+		return nil, fmt.Errorf("fleet_exec: timeout_sec %d is out of range 0-%d", req.TimeoutSec, maxContractTimeoutSec)
+	}
+	if req.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("fleet_exec: max_concurrency must not be negative")
+	}
+	target, err := contractTarget(req.Targets)
+	if err != nil {
+		return nil, err
+	}
+	target.MaxConcurrency = req.MaxConcurrency
+
+	timeout := defaultContractTimeout
+	if req.TimeoutSec > 0 {
+		timeout = time.Duration(req.TimeoutSec) * time.Second
+	}
+	data, err := json.Marshal(ShellCommand{Command: req.Command, WorkDir: req.WorkDir})
+	if err != nil {
+		return nil, err
+	}
+	return &ExecRequest{
+		ID:        fmt.Sprintf("contract_%d", now.UnixNano()),
+		Target:    target,
+		Command:   TypedCommand{Type: "shell", Data: data},
+		Timeout:   timeout,
+		DryRun:    req.DryRun,
+		Requester: "fleet_exec",
+		CreatedAt: now,
+	}, nil
+}
+
+// contractTarget builds a selector from fleet_exec targets. A bare name is
+// matched against both node IDs and groups.
+func contractTarget(targets []string) (TargetSelector, error) {
+	var ts TargetSelector
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+			return TargetSelector{}, fmt.Errorf("fleet_exec: empty target")
+		case t == "all":
+			ts.All = true
+		case strings.Contains(t, "="):
+			k, v, _ := strings.Cut(t, "=")
+			if k == "" {
+				return TargetSelector{}, fmt.Errorf("fleet_exec: target %q has no label name", t)
+			}
+			if ts.Labels == nil {
+				ts.Labels = map[string]string{}
+			}
+			ts.Labels[k] = v
+		default:
+			ts.NodeIDs = append(ts.NodeIDs, NodeID(t))
+			ts.Groups = append(ts.Groups, GroupName(t))
+		}
+	}
+	if !ts.All && len(ts.NodeIDs) == 0 && len(ts.Labels) == 0 {
+		return TargetSelector{}, fmt.Errorf("fleet_exec: no targets")
+	}
+	return ts, nil
+}
+
+// contractExecResponse converts an ExecResult to the fleet_exec response,
+// with results in node ID order. Failed counts every node that neither
+// succeeded nor was skipped.
+func contractExecResponse(result *ExecResult) *contracts.FleetExecResponse {
+	resp := &contracts.FleetExecResponse{
+		RequestID: result.RequestID,
+		Results:   make([]contracts.FleetNodeResult, 0, len(result.NodeResults)),
+		Total:     result.Summary.Total,
+		Success:   result.Summary.Success,
+		Failed:    result.Summary.Total - result.Summary.Success - result.Summary.Skipped,
+		Duration:  result.Duration,
+	}
+	for _, nr := range result.NodeResults {
+		resp.Results = append(resp.Results, contracts.FleetNodeResult{
+			NodeID:   string(nr.NodeID),
+			Hostname: nr.Hostname,
+			Output:   nr.Output,
+			ExitCode: nr.ExitCode,
+			Status:   nr.Status,
+			Error:    nr.Error,
+		})
+	}
+	sort.SliceStable(resp.Results, func(i, j int) bool { return resp.Results[i].NodeID < resp.Results[j].NodeID })
+	return resp
+}
@@ -0,0 +1,169 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
+)
+
+func TestContractExecRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	req, err := contractExecRequest(&contracts.FleetExecRequest{
+		Targets:        []string{"web", "env=prod"},
+		Command:        "uptime",
+		WorkDir:        "/srv",
+		MaxConcurrency: 4,
+		DryRun:         true,
+	}, now)
+	if err != nil {
+		t.Fatalf("contractExecRequest: %v", err)
+	}
+	want := TargetSelector{
+		NodeIDs:        []NodeID{"web"},
+		Groups:         []GroupName{"web"},
+		Labels:         map[string]string{"env": "prod"},
+		MaxConcurrency: 4,
+	}
+	if !reflect.DeepEqual(req.Target, want) {
+		t.Errorf("target = %+v, want %+v", req.Target, want)
+	}
+	if req.Timeout != defaultContractTimeout || !req.DryRun || req.Requester != "fleet_exec" {
+		t.Errorf("request = %+v", req)
+	}
+	var shell ShellCommand
+	if err := json.Unmarshal(req.Command.Data, &shell); err != nil || req.Command.Type != "shell" {
+		t.Fatalf("command = %s %s, %v", req.Command.Type, req.Command.Data, err)
+	}
+	if shell.Command != "uptime" || shell.WorkDir != "/srv" {
+		t.Errorf("shell command = %+v", shell)
+	}
+
+	req, err = contractExecRequest(&contracts.FleetExecRequest{Targets: []string{"all"}, Command: "id", TimeoutSec: 5}, now)
+	if err != nil || !req.Target.All || req.Timeout != 5*time.Second {
+		t.Errorf("all: %+v, %v", req, err)
+	}
+}
+
+func TestContractExecRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  contracts.FleetExecRequest
+		want string
+	}{
+		{"blank command", contracts.FleetExecRequest{Targets: []string{"web"}, Command: "  "}, "command is empty"},
+		{"no targets", contracts.FleetExecRequest{Command: "id"}, "no targets"},
+		{"blank target", contracts.FleetExecRequest{Targets: []string{""}, Command: "id"}, "empty target"},
+		{"label without name", contracts.FleetExecRequest{Targets: []string{"=prod"}, Command: "id"}, "no label name"},
+		{"timeout too long", contracts.FleetExecRequest{Targets: []string{"web"}, Command: "id", TimeoutSec: 7200}, "out of range"},
+		{"negative concurrency", contracts.FleetExecRequest{Targets: []string{"web"}, Command: "id", MaxConcurrency: -1}, "must not be negative"},
+	}
+	for _, tt := range tests {
+		_, err := contractExecRequest(&tt.req, time.Now())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// newContractRegistry registers fleet_exec over the test roster and relay.
+func newContractRegistry(t *testing.T, relay RelayClient) *contracts.Registry {
+	t.Helper()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(context.Background(), n)
+	}
+	r := contracts.NewRegistry()
+	RegisterExecContract(r, NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	return r
+}
+
+func runFleetExecTool(t *testing.T, r *contracts.Registry, input string) (*contracts.FleetExecResponse, error) {
+	t.Helper()
+	out, err := r.Execute("fleet_exec", json.RawMessage(input))
+	if err != nil {
+		return nil, err
+	}
+	var resp contracts.FleetExecResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return &resp, nil
+}
+
+func TestExecContract_NodeFailures(t *testing.T) {
+	r := newContractRegistry(t, &stubRelay{failNode: "node-2"})
+	resp, err := runFleetExecTool(t, r, `{"targets":["web"],"command":"uptime"}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if resp.Total != 2 || resp.Success != 1 || resp.Failed != 1 {
+		t.Errorf("counts = %d total, %d success, %d failed", resp.Total, resp.Success, resp.Failed)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].NodeID != "node-1" || resp.Results[1].NodeID != "node-2" {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if got := resp.Results[1]; got.Status != "failure" || !strings.Contains(got.Error, "connection refused") {
+		t.Errorf("failed node = %+v", got)
+	}
+}
+
+func TestExecContract_Errors(t *testing.T) {
+	r := newContractRegistry(t, &stubRelay{})
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"targets":["nope"],"command":"uptime"}`, "no nodes matched"},
+		{`{"command":"uptime"}`, "validation failed"},
+		{`{"targets":"web","command":"uptime"}`, "invalid request"},
+	}
+	for _, tt := range tests {
+		_, err := runFleetExecTool(t, r, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+// slowNodeRelay answers at once except on slow, which waits for the
+// request to be abandoned.
+type slowNodeRelay struct {
+	slow NodeID
+}
+
+func (r *slowNodeRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	if node.ID == r.slow {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &NodeResult{NodeID: node.ID, Hostname: node.Hostname, Output: "ok"}, nil
+}
+
+func (r *slowNodeRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+func TestExecContract_TimeoutReturnsPartialResults(t *testing.T) {
+	r := newContractRegistry(t, &slowNodeRelay{slow: "node-2"})
+	resp, err := runFleetExecTool(t, r, `{"targets":["web"],"command":"sleep 600","timeout_sec":1}`)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	if got := resp.Results[0]; got.Status != "success" || got.Output != "ok" {
+		t.Errorf("fast node = %+v", got)
+	}
+	if got := resp.Results[1]; got.Status != "timeout" {
+		t.Errorf("slow node = %+v, want status timeout", got)
+	}
+	if resp.Success != 1 || resp.Failed != 1 {
+		t.Errorf("counts = %d success, %d failed", resp.Success, resp.Failed)
+	}
+}
@@ -0,0 +1,84 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned, usually wrapped, by stores, relays and the executor, so
+// callers can tell failures apart with errors.Is instead of matching
+// messages.
+var (
+	// ErrNodeNotFound is returned when a node ID is not registered.
+	ErrNodeNotFound = errors.New("node not found")
+
+	// ErrNoTunnel is returned (wrapped) by a RelayClient when a node has no
+	// active connection to the relay. The executor reports such nodes as
+	// "unreachable" instead of failed.
+	ErrNoTunnel = errors.New("no active tunnel")
+
+	// ErrNoTargetsMatched is returned when a target selector resolves to
+	// no online node.
+	ErrNoTargetsMatched = errors.New("no nodes matched target selector")
+
+	// ErrNodeDraining is wrapped alongside ErrNoTargetsMatched when nodes
+	// the selector names were left out because they are draining.
+	ErrNodeDraining = errors.New("node is draining")
+)
+
+// nodeNotFound reports that id is not registered.
+func nodeNotFound(id NodeID) error {
+	return fmt.Errorf("%w: %s", ErrNodeNotFound, id)
+}
+
+// NoTargetsError explains why sel resolved to no node of roster. It always
+// wraps ErrNoTargetsMatched, and also ErrNodeNotFound when sel names node
+// IDs that are not registered, or else ErrNodeDraining when nodes it
+// selects are draining.
+func NoTargetsError(sel *TargetSelector, roster []*Node) error {
+	known := make(map[NodeID]bool, len(roster))
+	var draining []string
+	for _, n := range roster {
+		known[n.ID] = true
+		if n.Status == NodeStatusDraining && sel.Matches(n) {
+			draining = append(draining, string(n.ID))
+		}
+	}
+	var missing []string
+	for _, id := range sel.NodeIDs {
+		if !known[id] {
+			missing = append(missing, string(id))
+		}
+	}
+
+	switch {
+	case len(missing) > 0:
+		return fmt.Errorf("%w: %w: %s", ErrNoTargetsMatched, ErrNodeNotFound, strings.Join(missing, ", "))
+	case len(draining) > 0:
+		return fmt.Errorf("%w: %w: %s", ErrNoTargetsMatched, ErrNodeDraining, strings.Join(draining, ", "))
+	}
+	return ErrNoTargetsMatched
+}
+
+// Err returns the failure r records as an error, or nil if the node ran
+// the command successfully or was not meant to run it (skipped, dry run).
+// An unreachable node's error wraps ErrNoTunnel, and a timed-out or
+// cancelled one wraps context.DeadlineExceeded or context.Canceled.
+func (r *NodeResult) Err() error {
+	switch r.Status {
+	case "success", "skipped", "dry-run":
+		return nil
+	case "unreachable":
+		return fmt.Errorf("node %s: %w", r.NodeID, ErrNoTunnel)
+	case "timeout":
+		return fmt.Errorf("node %s: %w", r.NodeID, context.DeadlineExceeded)
+	case "cancelled":
+		return fmt.Errorf("node %s: %w", r.NodeID, context.Canceled)
+	}
+	if r.Error != "" {
+		return fmt.Errorf("node %s: %s", r.NodeID, r.Error)
+	}
+	return fmt.Errorf("node %s: exit code %d", r.NodeID, r.ExitCode)
+}
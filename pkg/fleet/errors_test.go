@@ -0,0 +1,124 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func errorsTestExecutor(t *testing.T, relay RelayClient) (*Executor, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(context.Background(), n)
+	}
+	return NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil))), store
+}
+
+func TestExecutor_NoTunnelErrorsIs(t *testing.T) {
+	relay := &stubRelay{noTunnelFor: map[NodeID]bool{"node-2": true}}
+	executor, _ := errorsTestExecutor(t, relay)
+
+	result, err := executor.Execute(context.Background(), &ExecRequest{
+		ID:      "exec-no-tunnel",
+		Command: shellTyped(t, ShellCommand{Command: "uptime"}),
+		Target:  TargetSelector{NodeIDs: []NodeID{"node-1", "node-2"}},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nr := range result.NodeResults {
+		err := nr.Err()
+		switch nr.NodeID {
+		case "node-1":
+			if err != nil {
+				t.Errorf("node-1 Err() = %v, want nil", err)
+			}
+		case "node-2":
+			if !errors.Is(err, ErrNoTunnel) || !strings.Contains(err.Error(), "node-2") {
+				t.Errorf("node-2 Err() = %v, want ErrNoTunnel naming the node", err)
+			}
+		}
+	}
+}
+
+func TestNodeResult_Err(t *testing.T) {
+	tests := []struct {
+		nr   NodeResult
+		want error
+	}{
+		{NodeResult{Status: "timeout"}, context.DeadlineExceeded},
+		{NodeResult{Status: "cancelled"}, context.Canceled},
+	}
+	for _, tt := range tests {
+		if err := tt.nr.Err(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Err() = %v, want %v", tt.nr.Status, err, tt.want)
+		}
+	}
+	for _, status := range []string{"skipped", "dry-run"} {
+		if err := (&NodeResult{Status: status}).Err(); err != nil {
+			t.Errorf("%s: Err() = %v, want nil", status, err)
+		}
+	}
+	err := (&NodeResult{NodeID: "web-1", Status: "failure", ExitCode: 2}).Err()
+	if err == nil || err.Error() != "node web-1: exit code 2" {
+		t.Errorf("failure: Err() = %v", err)
+	}
+}
+
+func TestExecutor_NoTargetsErrors(t *testing.T) {
+	executor, store := errorsTestExecutor(t, &stubRelay{})
+	ctx := context.Background()
+	store.RegisterNode(ctx, &Node{ID: "node-5", Hostname: "web-5", Status: NodeStatusDraining, Groups: []GroupName{"edge"}})
+
+	tests := []struct {
+		name   string
+		target TargetSelector
+		also   error // wrapped besides ErrNoTargetsMatched, if any
+	}{
+		{"no match", TargetSelector{Groups: []GroupName{"cache"}}, nil},
+		{"unknown node", TargetSelector{NodeIDs: []NodeID{"node-9"}}, ErrNodeNotFound},
+		{"draining", TargetSelector{Groups: []GroupName{"edge"}}, ErrNodeDraining},
+	}
+	for _, tt := range tests {
+		_, err := executor.Execute(ctx, &ExecRequest{
+			ID:      "exec-" + strings.ReplaceAll(tt.name, " ", "-"),
+			Command: shellTyped(t, ShellCommand{Command: "uptime"}),
+			Target:  tt.target,
+			Timeout: 5 * time.Second,
+		})
+		if !errors.Is(err, ErrNoTargetsMatched) {
+			t.Errorf("%s: err = %v, want ErrNoTargetsMatched", tt.name, err)
+			continue
+		}
+		for _, other := range []error{ErrNodeNotFound, ErrNodeDraining} {
+			if got := errors.Is(err, other); got != (other == tt.also) {
+				t.Errorf("%s: errors.Is(%v, %v) = %v", tt.name, err, other, got)
+			}
+		}
+	}
+}
+
+func TestMemoryStore_NodeNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if _, err := store.GetNode(ctx, "ghost"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("GetNode: err = %v, want ErrNodeNotFound", err)
+	}
+	if err := store.UpdateNodeStatus(ctx, "ghost", NodeStatusDraining); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("UpdateNodeStatus: err = %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestNodeManager_HeartbeatUnknownNode(t *testing.T) {
+	nm := NewNodeManager(NewMemoryStore(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err := nm.Heartbeat(context.Background(), "ghost", NodeResources{})
+	if !errors.Is(err, ErrNodeNotFound) || !strings.HasPrefix(err.Error(), "heartbeat ghost: ") {
+		t.Errorf("err = %v, want ErrNodeNotFound wrapped with the node ID", err)
+	}
+}
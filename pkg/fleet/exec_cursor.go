@@ -0,0 +1,57 @@
+package fleet
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DefaultExecPageSize is the ListExecutionsAfter page size when
+// ListExecOptions.Limit is unset.
+const DefaultExecPageSize = 50
+
+// execCursor is the position after the last execution of a page. Keyset
+// paging on (created_at, id) stays stable when new executions are
+// recorded between pages, unlike LIMIT/OFFSET.
+type execCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// encodeExecCursor returns the opaque cursor for the page ending at
+// (createdAt, id).
+func encodeExecCursor(createdAt time.Time, id string) string {
+	data, _ := json.Marshal(execCursor{CreatedAt: createdAt.UTC(), ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeExecCursor parses a cursor from encodeExecCursor. ok is false for
+// the empty cursor, which means start from the newest execution.
+func decodeExecCursor(s string) (c execCursor, ok bool, err error) {
+	if s == "" {
+		return execCursor{}, false, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.ID == "" {
+		return execCursor{}, false, fmt.Errorf("invalid execution cursor %q", s)
+	}
+	return c, true, nil
+}
+
+// execPageSize resolves the page size for ListExecutionsAfter.
+func execPageSize(opts ListExecOptions) int {
+	if opts.Limit > 0 {
+		return opts.Limit
+	}
+	return DefaultExecPageSize
+}
+
+// execBefore reports whether (t, id) sorts after c in newest-first order,
+// i.e. belongs on a later page.
+func (c execCursor) execBefore(t time.Time, id string) bool {
+	return t.Before(c.CreatedAt) || (t.Equal(c.CreatedAt) && id < c.ID)
+}
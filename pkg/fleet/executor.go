@@ -2,23 +2,38 @@ package fleet
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 )
 
 // Executor fans out commands across fleet nodes with concurrency control,
 // timeout enforcement, and result aggregation.
 type Executor struct {
-	store  Store
-	relay  RelayClient
-	logger *slog.Logger
+	store       Store
+	relay       RelayClient
+	logger      *slog.Logger
+	idempotency *resilience.IdempotencyController
+	tracer      *observability.Tracer // nil when tracing is off
+
+	groupLimits      *resilience.RateLimiterRegistry
+	dispatchObserver func(key string, wait time.Duration)
 
 	mu       sync.RWMutex
 	inflight map[string]context.CancelFunc // request ID → cancel
+	byNode   map[NodeID]map[string]int     // node → request ID → unfinished runs on it
 }
 
+// DefaultIdempotencyTTL is how long a node's result for an
+// ExecRequest.IdempotencyKey is replayed instead of running again.
+const DefaultIdempotencyTTL = 10 * time.Minute
+
 // RelayClient abstracts the connection to remote nodes.
 // Implementations: DirectClient (same-network SSH), TunnelClient (NAT-traversal relay).
 type RelayClient interface {
@@ -32,30 +47,72 @@ type RelayClient interface {
 // NewExecutor creates a fleet command executor.
 func NewExecutor(store Store, relay RelayClient, logger *slog.Logger) *Executor {
 	return &Executor{
-		store:    store,
-		relay:    relay,
-		logger:   logger,
-		inflight: make(map[string]context.CancelFunc),
+		store:       store,
+		relay:       relay,
+		logger:      logger,
+		idempotency: resilience.NewIdempotencyController(DefaultIdempotencyTTL, logger),
+		inflight:    make(map[string]context.CancelFunc),
+		byNode:      make(map[NodeID]map[string]int),
 	}
 }
 
+// SetIdempotency replaces the controller that deduplicates requests with
+// an IdempotencyKey. Its TTL also bounds how old a result saved in the
+// store may be to be replayed.
+func (e *Executor) SetIdempotency(ic *resilience.IdempotencyController) {
+	e.idempotency = ic
+}
+
+// SetTracer records a span for every run and for each node it is
+// dispatched to on tracer.
+func (e *Executor) SetTracer(tracer *observability.Tracer) {
+	e.tracer = tracer
+}
+
+// startSpan starts a span on the tracer, if any, and returns the context
+// carrying it and a func that ends it with the operation's error.
+func (e *Executor) startSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, func(error)) {
+	if e.tracer == nil {
+		return ctx, func(error) {}
+	}
+	ctx, span := e.tracer.StartSpan(ctx, name, attrs)
+	return ctx, func(err error) { e.tracer.EndSpan(span, err) }
+}
+
 // Execute fans out a command to targeted nodes with concurrency control.
 func (e *Executor) Execute(ctx context.Context, req *ExecRequest) (*ExecResult, error) {
+	targets, err := e.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return e.run(ctx, req, targets, nil), nil
+}
+
+// prepare validates req and resolves its targets.
+func (e *Executor) prepare(ctx context.Context, req *ExecRequest) ([]*Node, error) {
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
-
-	start := time.Now()
-
-	// Resolve target nodes
 	roster, err := e.store.ListNodes(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list nodes: %w", err)
 	}
 	targets := req.Target.Resolve(roster)
 	if len(targets) == 0 {
-		return nil, fmt.Errorf("no nodes matched target selector")
+		return nil, NoTargetsError(&req.Target, roster)
 	}
+	return targets, nil
+}
+
+// run fans req out to targets and aggregates the results. When emit is set,
+// per-node progress is reported through it as it happens.
+func (e *Executor) run(ctx context.Context, req *ExecRequest, targets []*Node, emit func(NodeResultEvent)) *ExecResult {
+	start := time.Now()
+	ctx, endSpan := e.startSpan(ctx, "fleet.exec", map[string]string{
+		"request_id":   req.ID,
+		"command_type": req.Command.Type,
+		"target_count": fmt.Sprint(len(targets)),
+	})
 
 	e.logger.Info("executing fleet command",
 		"request_id", req.ID,
@@ -65,11 +122,15 @@ func (e *Executor) Execute(ctx context.Context, req *ExecRequest) (*ExecResult,
 		"requester", req.Requester,
 	)
 
-	// Register inflight for cancellation
-	execCtx, cancel := context.WithTimeout(ctx, req.Timeout)
+	// Register inflight for cancellation. Timeout bounds the whole run,
+	// across every batch.
+	reqCtx, cancel := context.WithTimeout(ctx, req.Timeout)
 	defer cancel()
 	e.mu.Lock()
 	e.inflight[req.ID] = cancel
+	for _, n := range targets {
+		e.trackNodeLocked(n.ID, req.ID, 1)
+	}
 	e.mu.Unlock()
 	defer func() {
 		e.mu.Lock()
@@ -77,36 +138,23 @@ func (e *Executor) Execute(ctx context.Context, req *ExecRequest) (*ExecResult,
 		e.mu.Unlock()
 	}()
 
-	// Fan-out with concurrency limiter
-	concurrency := req.Target.MaxConcurrency
-	if concurrency <= 0 {
-		concurrency = 10 // sensible default
-	}
-	sem := make(chan struct{}, concurrency)
-	resultCh := make(chan NodeResult, len(targets))
-
-	var wg sync.WaitGroup
-	for _, node := range targets {
-		wg.Add(1)
-		go func(n *Node) {
-			defer wg.Done()
-			sem <- struct{}{} // acquire
-			defer func() { <-sem }() // release
-
-			nr := e.executeOnNode(execCtx, n, req)
-			resultCh <- nr
-		}(node)
-	}
-
-	// Wait for all results
-	go func() {
-		wg.Wait()
-		close(resultCh)
-	}()
-
+	batches := req.Batch.batches(targets)
+	pacer := e.pacer(req)
 	var results []NodeResult
-	for nr := range resultCh {
-		results = append(results, nr)
+	for i, batch := range batches {
+		if len(batches) > 1 {
+			e.logger.Info("fleet batch", "request_id", req.ID, "batch", i+1, "of", len(batches), "nodes", len(batch))
+		}
+		batchResults := e.runBatch(reqCtx, req, batch, pacer, emit)
+		results = append(results, batchResults...)
+
+		if req.Batch != nil && req.Batch.HaltOnError && i < len(batches)-1 && batchFailed(batchResults) {
+			e.logger.Warn("halting fleet command after failed batch", "request_id", req.ID, "batch", i+1)
+			for _, rest := range batches[i+1:] {
+				results = append(results, e.skipBatch(req, rest, i+1)...)
+			}
+			break
+		}
 	}
 
 	// Build summary
@@ -119,20 +167,29 @@ func (e *Executor) Execute(ctx context.Context, req *ExecRequest) (*ExecResult,
 			summary.Failed++
 		case "timeout":
 			summary.Timeout++
-		case "skipped":
+		case "skipped", "dry-run":
 			summary.Skipped++
+		case "unreachable":
+			summary.Unreachable++
+		case "cancelled":
+			summary.Cancelled++
+		case "denied", "blocked":
+			summary.Denied++
 		}
 	}
 
+	finished := time.Now()
 	result := &ExecResult{
 		RequestID:   req.ID,
 		NodeResults: results,
 		Summary:     summary,
-		Duration:    time.Since(start),
+		Duration:    finished.Sub(start),
+		StartedAt:   start,
+		FinishedAt:  finished,
 	}
 
-	// Audit trail
-	if err := e.store.RecordExecution(ctx, req, result); err != nil {
+	// Audit trail, kept for cancelled requests too
+	if err := e.store.RecordExecution(context.WithoutCancel(ctx), req, result); err != nil {
 		e.logger.Error("failed to record execution", "error", err, "request_id", req.ID)
 	}
 
@@ -143,9 +200,114 @@ func (e *Executor) Execute(ctx context.Context, req *ExecRequest) (*ExecResult,
 		"success", summary.Success,
 		"failed", summary.Failed,
 		"timeout", summary.Timeout,
+		"unreachable", summary.Unreachable,
+		"cancelled", summary.Cancelled,
+		"denied", summary.Denied,
 	)
 
-	return result, nil
+	var spanErr error
+	if bad := summary.Total - summary.Success - summary.Skipped; bad > 0 {
+		spanErr = fmt.Errorf("%d of %d nodes did not succeed", bad, summary.Total)
+	}
+	endSpan(spanErr)
+
+	return result
+}
+
+// runBatch fans req out to one batch of targets and returns the results in
+// completion order. Each node is dispatched once it has a concurrency slot
+// and pacer allows it.
+func (e *Executor) runBatch(ctx context.Context, req *ExecRequest, targets []*Node, pacer *dispatchPacer, emit func(NodeResultEvent)) []NodeResult {
+	// Fan-out with concurrency limiter
+	concurrency := req.Target.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 10 // sensible default
+	}
+	sem := make(chan struct{}, concurrency)
+	resultCh := make(chan NodeResult, len(targets))
+
+	var wg sync.WaitGroup
+	for _, node := range targets {
+		wg.Add(1)
+		go func(n *Node) {
+			defer wg.Done()
+			sem <- struct{}{} // acquire
+			defer func() { <-sem }() // release
+
+			// If the run times out while waiting, executeOnce reports the
+			// node as interrupted without dispatching it.
+			_ = pacer.wait(ctx, n)
+
+			if emit != nil {
+				emit(NodeResultEvent{Type: NodeEventStarted, NodeID: n.ID, Time: time.Now()})
+			}
+			nr := e.executeOnNodeBudget(ctx, n, req, emit)
+			e.mu.Lock()
+			e.trackNodeLocked(n.ID, req.ID, -1)
+			e.mu.Unlock()
+			if emit != nil {
+				emit(NodeResultEvent{Type: NodeEventFinished, NodeID: n.ID, Result: &nr, Time: time.Now()})
+			}
+			resultCh <- nr
+		}(node)
+	}
+
+	// Wait for all results
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	results := make([]NodeResult, 0, len(targets))
+	for nr := range resultCh {
+		results = append(results, nr)
+	}
+	return results
+}
+
+// executeOnNodeBudget runs req on node within req.NodeTimeout, if set, as
+// well as the run's deadline in ctx. A node cut off by its own timeout
+// is told apart from one cut off by the run's in the result's Error.
+func (e *Executor) executeOnNodeBudget(ctx context.Context, node *Node, req *ExecRequest, emit func(NodeResultEvent)) (nr NodeResult) {
+	ctx, endSpan := e.startSpan(ctx, "fleet.node", map[string]string{"node": string(node.ID)})
+	defer func() {
+		var err error
+		if nr.Error != "" {
+			err = errors.New(nr.Error)
+		}
+		endSpan(err)
+	}()
+	if req.NodeTimeout <= 0 {
+		return e.executeOnce(ctx, node, req, emit)
+	}
+	nodeCtx, cancel := context.WithTimeout(ctx, req.NodeTimeout)
+	defer cancel()
+	nr = e.executeOnce(nodeCtx, node, req, emit)
+	if nr.Status == "timeout" && ctx.Err() == nil {
+		nr.Error = fmt.Sprintf("node timed out after %s", req.NodeTimeout)
+	}
+	return nr
+}
+
+// skipBatch reports targets as skipped because batch number failed did not
+// succeed and BatchPolicy.HaltOnError is set.
+func (e *Executor) skipBatch(req *ExecRequest, targets []*Node, failed int) []NodeResult {
+	results := make([]NodeResult, 0, len(targets))
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, n := range targets {
+		e.trackNodeLocked(n.ID, req.ID, -1)
+		results = append(results, NodeResult{
+			NodeID:    n.ID,
+			Hostname:  n.Hostname,
+			Error:     fmt.Sprintf("not run: batch %d failed and halt on error is set", failed),
+			StartedAt: now,
+			Status:    "skipped",
+			ExitCode:  -1,
+		})
+	}
+	return results
 }
 
 // Cancel aborts an inflight execution.
@@ -160,47 +322,177 @@ func (e *Executor) Cancel(requestID string) bool {
 	return false
 }
 
-func (e *Executor) executeOnNode(ctx context.Context, node *Node, req *ExecRequest) NodeResult {
+// InFlight returns the IDs of requests that target node and have not
+// finished on it yet, including ones still queued behind MaxConcurrency.
+func (e *Executor) InFlight(node NodeID) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ids := make([]string, 0, len(e.byNode[node]))
+	for id := range e.byNode[node] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// trackNodeLocked adjusts the count of unfinished runs of requestID on
+// node. e.mu must be held.
+func (e *Executor) trackNodeLocked(node NodeID, requestID string, delta int) {
+	reqs := e.byNode[node]
+	if reqs == nil {
+		reqs = make(map[string]int)
+		e.byNode[node] = reqs
+	}
+	reqs[requestID] += delta
+	if reqs[requestID] <= 0 {
+		delete(reqs, requestID)
+	}
+	if len(reqs) == 0 {
+		delete(e.byNode, node)
+	}
+}
+
+// executeOnce runs req on node unless the node already ran a request with
+// the same IdempotencyKey within the TTL, in which case that result is
+// returned with Cached set. Results are kept in process by the idempotency
+// controller and in the store so that they survive across CLI invocations.
+// An unreachable node never ran the command, and a cancelled one did not
+// finish it, so their results are not kept.
+func (e *Executor) executeOnce(ctx context.Context, node *Node, req *ExecRequest, emit func(NodeResultEvent)) NodeResult {
+	if req.IdempotencyKey == "" || req.DryRun {
+		return e.executeOnNode(ctx, node, req, emit)
+	}
+
+	key := req.IdempotencyKey + "/" + string(node.ID)
+	ran := false
+	v, _ := e.idempotency.Execute(key, func() (any, error) {
+		since := time.Now().Add(-e.idempotency.TTL())
+		saved, err := e.store.GetIdempotentResult(ctx, req.IdempotencyKey, node.ID, since)
+		if err != nil {
+			e.logger.Warn("idempotency lookup failed", "error", err, "node", node.ID)
+		} else if saved != nil {
+			return *saved, nil
+		}
+
+		ran = true
+		nr := e.executeOnNode(ctx, node, req, emit)
+		if nr.Status != "unreachable" && nr.Status != "cancelled" {
+			if err := e.store.SaveIdempotentResult(ctx, req.IdempotencyKey, node.ID, &nr); err != nil {
+				e.logger.Warn("failed to save idempotent result", "error", err, "node", node.ID)
+			}
+		}
+		return nr, nil
+	})
+
+	nr := v.(NodeResult)
+	if ran {
+		if nr.Status == "unreachable" || nr.Status == "cancelled" {
+			e.idempotency.Forget(key)
+		}
+		return nr
+	}
+	e.logger.Info("replaying result for repeated idempotency key",
+		"request_id", req.ID, "idempotency_key", req.IdempotencyKey, "node", node.ID)
+	nr.Cached = true
+	return nr
+}
+
+func (e *Executor) executeOnNode(ctx context.Context, node *Node, req *ExecRequest, emit func(NodeResultEvent)) NodeResult {
 	start := time.Now()
 
 	if req.DryRun {
-		return NodeResult{
-			NodeID:   node.ID,
-			Hostname: node.Hostname,
-			Output:   "[dry-run] would execute on this node",
-			ExitCode: 0,
-			Duration: time.Since(start),
-			Status:   "skipped",
+		// Nothing is sent to the node; Output shows what would run.
+		nr := NodeResult{
+			NodeID:    node.ID,
+			Hostname:  node.Hostname,
+			StartedAt: start,
+			Status:    "dry-run",
 		}
+		if preview, err := req.nodeCommand().Preview(); err != nil {
+			nr.Error = err.Error()
+		} else {
+			nr.Output = preview
+		}
+		nr.Duration = time.Since(start)
+		return nr
 	}
 
-	nr, err := e.relay.Execute(ctx, node, req.Command)
+	if ctx.Err() != nil {
+		// Cancelled or timed out while queued behind MaxConcurrency or a
+		// dispatch rate limit: the command never reached the node.
+		return interruptedResult(ctx, node, start)
+	}
+
+	var (
+		nr  *NodeResult
+		err error
+	)
+	if sr, ok := e.relay.(StreamingRelayClient); ok && emit != nil {
+		nr, err = sr.ExecuteStream(ctx, node, req.nodeCommand(), func(line string) {
+			emit(NodeResultEvent{Type: NodeEventOutput, NodeID: node.ID, Line: line, Time: time.Now()})
+		})
+	} else {
+		nr, err = e.relay.Execute(ctx, node, req.nodeCommand())
+	}
 	if err != nil {
-		if ctx.Err() != nil {
+		if errors.Is(err, ErrNoTunnel) {
+			// Matched but not connected: report it rather than count it
+			// as a command failure.
 			return NodeResult{
-				NodeID:   node.ID,
-				Hostname: node.Hostname,
-				Error:    "execution timed out",
-				Duration: time.Since(start),
-				Status:   "timeout",
-				ExitCode: -1,
+				NodeID:    node.ID,
+				Hostname:  node.Hostname,
+				Error:     ErrNoTunnel.Error(),
+				Duration:  time.Since(start),
+				StartedAt: start,
+				Status:    "unreachable",
+				ExitCode:  -1,
 			}
 		}
+		if ctx.Err() != nil {
+			return interruptedResult(ctx, node, start)
+		}
 		return NodeResult{
-			NodeID:   node.ID,
-			Hostname: node.Hostname,
-			Error:    err.Error(),
-			Duration: time.Since(start),
-			Status:   "failure",
-			ExitCode: -1,
+			NodeID:    node.ID,
+			Hostname:  node.Hostname,
+			Error:     err.Error(),
+			Duration:  time.Since(start),
+			StartedAt: start,
+			Status:    "failure",
+			ExitCode:  -1,
 		}
 	}
 
 	nr.Duration = time.Since(start)
-	if nr.ExitCode == 0 && nr.Error == "" {
+	nr.StartedAt = start
+	switch {
+	case nr.Status == "denied" || nr.Status == "blocked":
+		// Refused by the node's command policy or the relay's ACLs; the
+		// command never ran, so it is not reported as a failed run.
+	case nr.ExitCode == 0 && nr.Error == "":
 		nr.Status = "success"
-	} else {
+	default:
 		nr.Status = "failure"
 	}
 	return *nr
 }
+
+// interruptedResult reports a node whose run was cut short by ctx: a
+// cancelled request, such as one interrupted from the CLI, is "cancelled"
+// and an expired deadline is "timeout". The relay tells the node to kill
+// the command when the wait for its result is abandoned.
+func interruptedResult(ctx context.Context, node *Node, start time.Time) NodeResult {
+	nr := NodeResult{
+		NodeID:    node.ID,
+		Hostname:  node.Hostname,
+		Error:     "execution timed out",
+		Duration:  time.Since(start),
+		StartedAt: start,
+		Status:    "timeout",
+		ExitCode:  -1,
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		nr.Error = "execution cancelled"
+		nr.Status = "cancelled"
+	}
+	return nr
+}
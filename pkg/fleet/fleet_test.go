@@ -2,8 +2,19 @@ package fleet
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 )
 
 func TestTargetSelector_Resolve_All(t *testing.T) {
@@ -51,6 +62,173 @@ func TestTargetSelector_Resolve_MaxNodes(t *testing.T) {
 	}
 }
 
+func TestTargetSelector_Matches_IgnoresStatus(t *testing.T) {
+	roster := testRoster()
+	sel := &TargetSelector{Groups: []GroupName{"web"}}
+
+	var matched []NodeID
+	for _, n := range roster {
+		if sel.Matches(n) {
+			matched = append(matched, n.ID)
+		}
+	}
+	if len(matched) != 3 {
+		t.Errorf("Matches selected %v, want node-1, node-2 and offline node-4", matched)
+	}
+	if got := len(sel.Resolve(roster)); got != 2 {
+		t.Errorf("Resolve returned %d nodes, want the 2 online ones", got)
+	}
+}
+
+// Resolve is Matches plus status: degraded nodes are only taken when
+// targeted by ID or with All, and exclusions apply either way.
+func TestTargetSelector_Resolve_AgreesWithMatches(t *testing.T) {
+	roster := testRoster()
+	staging := []LabelMatcher{{Key: "env", Op: LabelOpEq, Values: []string{"staging"}}}
+	tests := []struct {
+		name string
+		sel  TargetSelector
+		want []NodeID
+	}{
+		{"degraded by ID", TargetSelector{NodeIDs: []NodeID{"node-3"}}, []NodeID{"node-3"}},
+		{"degraded by group", TargetSelector{Groups: []GroupName{"db"}}, nil},
+		{"degraded by label", TargetSelector{Labels: map[string]string{"env": "staging"}}, nil},
+		{"all with exclude", TargetSelector{All: true, Exclude: staging}, []NodeID{"node-1", "node-2"}},
+		{"ID excluded", TargetSelector{NodeIDs: []NodeID{"node-1", "node-3"}, Exclude: staging}, []NodeID{"node-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []NodeID
+			for _, n := range tt.sel.Resolve(roster) {
+				if !tt.sel.Matches(n) {
+					t.Errorf("Resolve returned %s, which Matches rejects", n.ID)
+				}
+				got = append(got, n.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetSelector_Resolve_LabelMatchers(t *testing.T) {
+	roster := []*Node{
+		{ID: "eu-1", Status: NodeStatusOnline, Labels: map[string]string{"region": "eu-west-1", "env": "prod"}},
+		{ID: "eu-2", Status: NodeStatusOnline, Labels: map[string]string{"region": "eu-central-1", "env": "staging"}},
+		{ID: "us-1", Status: NodeStatusOnline, Labels: map[string]string{"region": "us-east-1", "env": "dev"}},
+		{ID: "bare", Status: NodeStatusOnline},
+	}
+
+	tests := []struct {
+		name string
+		sel  TargetSelector
+		want []NodeID
+	}{
+		{"regex", TargetSelector{LabelMatchers: []LabelMatcher{
+			{Key: "region", Op: LabelOpRegex, Values: []string{"eu-.*"}},
+		}}, []NodeID{"eu-1", "eu-2"}},
+		{"regex is anchored", TargetSelector{LabelMatchers: []LabelMatcher{
+			{Key: "region", Op: LabelOpRegex, Values: []string{"west"}},
+		}}, nil},
+		{"notin with multiple values", TargetSelector{LabelMatchers: []LabelMatcher{
+			{Key: "env", Op: LabelOpNotIn, Values: []string{"prod", "staging"}},
+		}}, []NodeID{"us-1", "bare"}},
+		{"in", TargetSelector{LabelMatchers: []LabelMatcher{
+			{Key: "env", Op: LabelOpIn, Values: []string{"prod", "dev"}},
+		}}, []NodeID{"eu-1", "us-1"}},
+		{"labels shorthand ANDed with matchers", TargetSelector{
+			Labels:        map[string]string{"env": "staging"},
+			LabelMatchers: []LabelMatcher{{Key: "region", Op: LabelOpRegex, Values: []string{"eu-.*"}}},
+		}, []NodeID{"eu-2"}},
+		{"ne", TargetSelector{LabelMatchers: []LabelMatcher{
+			{Key: "env", Op: LabelOpNe, Values: []string{"prod"}},
+		}}, []NodeID{"eu-2", "us-1", "bare"}},
+		{"exclude filters node IDs", TargetSelector{
+			NodeIDs: []NodeID{"us-1"},
+			Exclude: []LabelMatcher{{Key: "env", Op: LabelOpEq, Values: []string{"prod"}}},
+		}, []NodeID{"us-1"}},
+		{"exclude filters all", TargetSelector{All: true, Exclude: []LabelMatcher{
+			{Key: "region", Op: LabelOpRegex, Values: []string{"eu-.*"}},
+		}}, []NodeID{"us-1", "bare"}},
+		{"exclude wins over selection", TargetSelector{
+			Labels:  map[string]string{"env": "prod"},
+			Exclude: []LabelMatcher{{Key: "region", Op: LabelOpIn, Values: []string{"eu-west-1"}}},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []NodeID
+			for _, n := range tt.sel.Resolve(roster) {
+				got = append(got, n.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabelMatcher(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    LabelMatcher
+		wantErr bool
+	}{
+		{expr: "role=web", want: LabelMatcher{Key: "role", Op: LabelOpEq, Values: []string{"web"}}},
+		{expr: "env!=prod", want: LabelMatcher{Key: "env", Op: LabelOpNe, Values: []string{"prod"}}},
+		{expr: "region=~eu-.*", want: LabelMatcher{Key: "region", Op: LabelOpRegex, Values: []string{"eu-.*"}}},
+		{expr: "region in (eu-west-1, eu-central-1)", want: LabelMatcher{Key: "region", Op: LabelOpIn, Values: []string{"eu-west-1", "eu-central-1"}}},
+		{expr: "env notin (prod,staging)", want: LabelMatcher{Key: "env", Op: LabelOpNotIn, Values: []string{"prod", "staging"}}},
+		{expr: "region in eu-west-1", wantErr: true},
+		{expr: "env notin ()", wantErr: true},
+		{expr: "region=~eu-(", wantErr: true},
+		{expr: "role", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseLabelMatcher(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLabelMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLabelMatcher() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTargetSelector(t *testing.T) {
+	got, err := ParseTargetSelector("web-1, ,web-2", "role=web,zone!=us-east-1a", "prod", "canary=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TargetSelector{
+		NodeIDs:       []NodeID{"web-1", "web-2"},
+		Labels:        map[string]string{"role": "web", "env": "prod"},
+		LabelMatchers: []LabelMatcher{{Key: "zone", Op: LabelOpNe, Values: []string{"us-east-1a"}}},
+		Exclude:       []LabelMatcher{{Key: "canary", Op: LabelOpEq, Values: []string{"true"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTargetSelector() = %+v, want %+v", got, want)
+	}
+
+	if got, _ := ParseTargetSelector("", "", "", ""); !got.All {
+		t.Errorf("empty flags = %+v, want All", got)
+	}
+	if _, err := ParseTargetSelector("", "", "", "role=~web-("); err == nil || !strings.HasPrefix(err.Error(), "exclude: ") {
+		t.Errorf("bad exclude error = %v, want it prefixed with exclude", err)
+	}
+}
+
+func TestSplitLabelSelectors(t *testing.T) {
+	got := SplitLabelSelectors("role=web, region in (eu-west-1,eu-central-1),env!=prod")
+	want := []string{"role=web", "region in (eu-west-1,eu-central-1)", "env!=prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitLabelSelectors() = %q, want %q", got, want)
+	}
+}
+
 func TestMemoryStore_CRUD(t *testing.T) {
 	ctx := context.Background()
 	store := NewMemoryStore()
@@ -116,6 +294,8 @@ func TestExecRequest_Validate(t *testing.T) {
 		{"unknown command type", ExecRequest{ID: "1", Command: TypedCommand{Type: "unknown"}}, true},
 		{"valid shell", ExecRequest{ID: "1", Command: TypedCommand{Type: "shell"}}, false},
 		{"valid deploy", ExecRequest{ID: "1", Command: TypedCommand{Type: "deploy"}}, false},
+		{"valid script", ExecRequest{ID: "1", Command: TypedCommand{Type: "script"}}, false},
+		{"negative max output", ExecRequest{ID: "1", Command: TypedCommand{Type: "shell"}, MaxOutputBytes: -1}, true},
 	}
 
 	for _, tt := range tests {
@@ -128,6 +308,49 @@ func TestExecRequest_Validate(t *testing.T) {
 	}
 }
 
+func TestScriptCommand_RoundTrip(t *testing.T) {
+	script := []byte("#!/bin/sh\nset -eu\necho \"it's $(hostname)\" \\\n  > /tmp/out\n\x00\xff")
+
+	cmd, err := NewScriptCommand(script, "bash")
+	if err != nil {
+		t.Fatalf("NewScriptCommand: %v", err)
+	}
+	if cmd.Type != "script" {
+		t.Errorf("Type = %q, want script", cmd.Type)
+	}
+
+	// Survives the relay's JSON envelope byte for byte.
+	wire, _ := json.Marshal(cmd)
+	var decoded TypedCommand
+	if err := json.Unmarshal(wire, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var sc ScriptCommand
+	if err := json.Unmarshal(decoded.Data, &sc); err != nil {
+		t.Fatalf("unmarshal ScriptCommand: %v", err)
+	}
+	if sc.Interpreter != "bash" {
+		t.Errorf("Interpreter = %q, want bash", sc.Interpreter)
+	}
+	got, err := sc.Script()
+	if err != nil {
+		t.Fatalf("Script: %v", err)
+	}
+	if string(got) != string(script) {
+		t.Errorf("script = %q, want %q", got, script)
+	}
+
+	// The default interpreter is left for the node to fill in.
+	cmd, _ = NewScriptCommand([]byte("true"), "")
+	if strings.Contains(string(cmd.Data), "interpreter") {
+		t.Errorf("data = %s, want interpreter omitted", cmd.Data)
+	}
+
+	if _, err := (ScriptCommand{Content: "not base64!"}).Script(); err == nil {
+		t.Error("expected an error for invalid content")
+	}
+}
+
 func testRoster() []*Node {
 	return []*Node{
 		{ID: "node-1", Hostname: "web-1", Status: NodeStatusOnline, Groups: []GroupName{"web"}, Labels: map[string]string{"env": "prod"}},
@@ -184,3 +407,821 @@ func TestMemoryStore_RecordExecution(t *testing.T) {
 		t.Errorf("expected 2 success, got %d", gotResult.Summary.Success)
 	}
 }
+
+// stubRelay answers every command after a short delay, failing on failNode.
+type stubRelay struct {
+	delay       time.Duration
+	failNode    NodeID
+	blockNode   NodeID          // answered as refused by the allow-list
+	noTunnelFor map[NodeID]bool // matched nodes not connected to the relay
+}
+
+func (r *stubRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	time.Sleep(r.delay)
+	if node.ID == r.failNode {
+		return nil, errors.New("connection refused")
+	}
+	if r.noTunnelFor[node.ID] {
+		return nil, fmt.Errorf("%w for node %s", ErrNoTunnel, node.ID)
+	}
+	if node.ID == r.blockNode {
+		return &NodeResult{NodeID: node.ID, Status: "blocked", ExitCode: -1, Error: "command not in allow-list"}, nil
+	}
+	return &NodeResult{NodeID: node.ID, Hostname: node.Hostname, Output: "ok"}, nil
+}
+
+func (r *stubRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+func TestExecutor_Timestamps(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+
+	executor := NewExecutor(store, &stubRelay{delay: 5 * time.Millisecond, failNode: "node-2"},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	before := time.Now()
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-ts",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	if result.StartedAt.Before(before) || result.FinishedAt.After(after) {
+		t.Errorf("result window [%v, %v] outside call window [%v, %v]", result.StartedAt, result.FinishedAt, before, after)
+	}
+	if result.FinishedAt.Before(result.StartedAt) {
+		t.Errorf("FinishedAt %v before StartedAt %v", result.FinishedAt, result.StartedAt)
+	}
+	if got := result.FinishedAt.Sub(result.StartedAt); got != result.Duration {
+		t.Errorf("FinishedAt-StartedAt = %v, want Duration %v", got, result.Duration)
+	}
+
+	if len(result.NodeResults) != 3 {
+		t.Fatalf("expected 3 node results, got %d", len(result.NodeResults))
+	}
+	for _, nr := range result.NodeResults {
+		if nr.StartedAt.IsZero() {
+			t.Errorf("%s: StartedAt not set (status %s)", nr.NodeID, nr.Status)
+			continue
+		}
+		if nr.StartedAt.Before(result.StartedAt) {
+			t.Errorf("%s: StartedAt %v before execution start %v", nr.NodeID, nr.StartedAt, result.StartedAt)
+		}
+		if end := nr.StartedAt.Add(nr.Duration); end.After(result.FinishedAt) {
+			t.Errorf("%s: finished at %v, after execution end %v", nr.NodeID, end, result.FinishedAt)
+		}
+	}
+}
+
+func TestExecutor_RecordsSpans(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	executor := NewExecutor(store, &stubRelay{failNode: "node-2"}, logger)
+	tracer := observability.NewTracer(0, logger)
+	executor.SetTracer(tracer)
+
+	if _, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-span",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := tracer.QuerySpans(observability.SpanQueryOptions{Name: "fleet.exec"})
+	if len(runs) != 1 {
+		t.Fatalf("fleet.exec spans = %d, want 1", len(runs))
+	}
+	if runs[0].Status != "error" || runs[0].Attributes["request_id"] != "exec-span" {
+		t.Errorf("fleet.exec span = %+v, want an error span for exec-span", runs[0])
+	}
+	nodes := tracer.QuerySpans(observability.SpanQueryOptions{TraceID: runs[0].TraceID, Name: "fleet.node"})
+	if len(nodes) != 3 {
+		t.Fatalf("fleet.node spans = %d, want 3", len(nodes))
+	}
+	for _, s := range nodes {
+		wantStatus := "ok"
+		if s.Attributes["node"] == "node-2" {
+			wantStatus = "error"
+		}
+		if s.ParentID != runs[0].SpanID || s.Status != wantStatus {
+			t.Errorf("fleet.node span for %s: parent %s status %s, want %s %s",
+				s.Attributes["node"], s.ParentID, s.Status, runs[0].SpanID, wantStatus)
+		}
+	}
+}
+
+func TestExecutor_DryRunTimestamps(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+
+	executor := NewExecutor(store, &stubRelay{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-dry",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{NodeIDs: []NodeID{"node-1"}},
+		Timeout: time.Second,
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StartedAt.IsZero() || result.FinishedAt.IsZero() {
+		t.Error("execution timestamps should be set for dry runs")
+	}
+	if result.NodeResults[0].StartedAt.IsZero() {
+		t.Error("node StartedAt should be set for skipped nodes")
+	}
+}
+
+func TestExecutor_UnreachableNodes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+
+	relay := &stubRelay{noTunnelFor: map[NodeID]bool{"node-2": true, "node-3": true}}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-partial",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("partial connectivity should not fail the run: %v", err)
+	}
+
+	want := ExecSummary{Total: 3, Success: 1, Unreachable: 2}
+	if result.Summary != want {
+		t.Errorf("summary = %+v, want %+v", result.Summary, want)
+	}
+	for _, nr := range result.NodeResults {
+		switch nr.NodeID {
+		case "node-1":
+			if nr.Status != "success" {
+				t.Errorf("node-1 status = %q, want success", nr.Status)
+			}
+		default:
+			if nr.Status != "unreachable" || nr.Error != "no active tunnel" {
+				t.Errorf("%s = status %q error %q, want unreachable / no active tunnel", nr.NodeID, nr.Status, nr.Error)
+			}
+		}
+	}
+}
+
+func TestExecutor_BlockedNodes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+
+	executor := NewExecutor(store, &stubRelay{blockNode: "node-2"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-blocked",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"rm -rf /tmp/cache"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	want := ExecSummary{Total: 3, Success: 2, Denied: 1}
+	if result.Summary != want {
+		t.Errorf("summary = %+v, want %+v", result.Summary, want)
+	}
+	for _, nr := range result.NodeResults {
+		if nr.NodeID == "node-2" && nr.Status != "blocked" {
+			t.Errorf("node-2 status = %q, want blocked", nr.Status)
+		}
+	}
+}
+
+// streamingStubRelay emits each line of a node's canned output through
+// onLine before returning the result.
+type streamingStubRelay struct {
+	stubRelay
+	output map[NodeID][]string
+}
+
+func (r *streamingStubRelay) ExecuteStream(ctx context.Context, node *Node, cmd TypedCommand, onLine func(string)) (*NodeResult, error) {
+	for _, line := range r.output[node.ID] {
+		onLine(line)
+	}
+	return r.Execute(ctx, node, cmd)
+}
+
+func TestExecutor_ExecuteStream(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+
+	relay := &streamingStubRelay{
+		stubRelay: stubRelay{failNode: "node-2"},
+		output: map[NodeID][]string{
+			"node-1": {"Reading package lists...", "0 upgraded"},
+			"node-3": {"done"},
+		},
+	}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	events, err := executor.ExecuteStream(ctx, &ExecRequest{
+		ID:      "exec-stream",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"apt upgrade -y"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perNode := map[NodeID][]string{}
+	var final *ExecResult
+	for ev := range events {
+		if final != nil {
+			t.Fatalf("event %+v after done", ev)
+		}
+		switch ev.Type {
+		case NodeEventStarted:
+			perNode[ev.NodeID] = append(perNode[ev.NodeID], "started")
+		case NodeEventOutput:
+			perNode[ev.NodeID] = append(perNode[ev.NodeID], ev.Line)
+		case NodeEventFinished:
+			perNode[ev.NodeID] = append(perNode[ev.NodeID], "finished:"+ev.Result.Status)
+		case NodeEventDone:
+			final = ev.Exec
+		}
+	}
+
+	want := map[NodeID][]string{
+		"node-1": {"started", "Reading package lists...", "0 upgraded", "finished:success"},
+		"node-2": {"started", "finished:failure"},
+		"node-3": {"started", "done", "finished:success"},
+	}
+	if !reflect.DeepEqual(perNode, want) {
+		t.Errorf("per-node events = %v, want %v", perNode, want)
+	}
+	if final == nil {
+		t.Fatal("stream should end with the aggregate result")
+	}
+	if final.Summary.Total != 3 || final.Summary.Success != 2 || final.Summary.Failed != 1 {
+		t.Errorf("summary = %+v", final.Summary)
+	}
+}
+
+func TestExecutor_ExecuteStream_NoMatch(t *testing.T) {
+	executor := NewExecutor(NewMemoryStore(), &stubRelay{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	_, err := executor.ExecuteStream(context.Background(), &ExecRequest{
+		ID:      "exec-none",
+		Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:  TargetSelector{All: true},
+		Timeout: time.Second,
+	})
+	if err == nil {
+		t.Error("expected an error before streaming when no nodes match")
+	}
+}
+
+func TestGroupOutputs(t *testing.T) {
+	results := []NodeResult{
+		{NodeID: "web-3", Status: "success", Output: "worker_processes 4;\n"},
+		{NodeID: "web-1", Status: "success", Output: "worker_processes auto;\n"},
+		{NodeID: "web-4", Status: "failure", Output: "cat: no such file\n"},
+		{NodeID: "web-2", Status: "success", Output: "worker_processes auto;\n"},
+	}
+
+	groups := GroupOutputs(results)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if !reflect.DeepEqual(groups[0].Nodes, []NodeID{"web-1", "web-2"}) {
+		t.Errorf("baseline nodes = %v, want [web-1 web-2]", groups[0].Nodes)
+	}
+	if !reflect.DeepEqual(groups[1].Nodes, []NodeID{"web-3"}) {
+		t.Errorf("drift nodes = %v, want [web-3]", groups[1].Nodes)
+	}
+	if groups[0].Hash == groups[1].Hash || len(groups[0].ShortHash()) != 12 {
+		t.Errorf("unexpected hashes %q %q", groups[0].Hash, groups[1].Hash)
+	}
+
+	diff := DiffOutputs(groups[0], groups[1])
+	for _, want := range []string{
+		"--- " + groups[0].ShortHash() + "\n",
+		"+++ " + groups[1].ShortHash() + "\n",
+		"-worker_processes auto;\n",
+		"+worker_processes 4;\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, diff)
+		}
+	}
+}
+
+func TestMemoryStore_ListExecutionsAfter(t *testing.T) {
+	testExecutionPaging(t, NewMemoryStore())
+}
+
+func TestExecCursor_RoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	c, ok, err := decodeExecCursor(encodeExecCursor(at, "exec-7"))
+	if err != nil || !ok {
+		t.Fatalf("decode: ok=%v err=%v", ok, err)
+	}
+	if !c.CreatedAt.Equal(at) || c.ID != "exec-7" {
+		t.Errorf("cursor = %+v", c)
+	}
+	if _, ok, err := decodeExecCursor(""); ok || err != nil {
+		t.Errorf("empty cursor: ok=%v err=%v", ok, err)
+	}
+}
+
+// gatedRelay holds every command until release is closed.
+type gatedRelay struct {
+	release chan struct{}
+}
+
+func (r *gatedRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	select {
+	case <-r.release:
+		return &NodeResult{NodeID: node.ID, Output: "ok"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *gatedRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+// newDrainTestStack starts request reqID on node-1 and node-2 and returns
+// once both are in flight. Closing the returned channel lets them finish;
+// the returned done channel closes when Execute has returned.
+func newDrainTestStack(t *testing.T, reqID string) (*NodeManager, *Executor, chan struct{}, <-chan struct{}) {
+	t.Helper()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	relay := &gatedRelay{release: make(chan struct{})}
+	executor := NewExecutor(store, relay, logger)
+	nm := NewNodeManager(store, logger)
+	nm.SetExecutor(executor)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		executor.Execute(ctx, &ExecRequest{
+			ID:      reqID,
+			Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"sleep 60"}`)},
+			Target:  TargetSelector{NodeIDs: []NodeID{"node-1", "node-2"}},
+			Timeout: 5 * time.Second,
+		})
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(executor.InFlight("node-1")) == 0 || len(executor.InFlight("node-2")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("request never went in flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nm, executor, relay.release, done
+}
+
+func TestExecutor_InFlight(t *testing.T) {
+	_, executor, release, done := newDrainTestStack(t, "exec-busy")
+
+	if got := executor.InFlight("node-1"); !reflect.DeepEqual(got, []string{"exec-busy"}) {
+		t.Errorf("InFlight(node-1) = %v, want [exec-busy]", got)
+	}
+	if got := executor.InFlight("node-3"); len(got) != 0 {
+		t.Errorf("InFlight(node-3) = %v, want none (not targeted)", got)
+	}
+
+	close(release)
+	<-done
+	if got := executor.InFlight("node-1"); len(got) != 0 {
+		t.Errorf("InFlight(node-1) after finish = %v, want none", got)
+	}
+}
+
+func TestExecutor_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	executor := NewExecutor(store, &gatedRelay{release: make(chan struct{})}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	resultCh := make(chan *ExecResult, 1)
+	go func() {
+		result, _ := executor.Execute(ctx, &ExecRequest{
+			ID:      "exec-cancel",
+			Command: TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"sleep 60"}`)},
+			Target:  TargetSelector{NodeIDs: []NodeID{"node-1", "node-2"}},
+			Timeout: 5 * time.Second,
+		})
+		resultCh <- result
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(executor.InFlight("node-1")) == 0 || len(executor.InFlight("node-2")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("request never went in flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	result := <-resultCh
+	if result.Summary.Cancelled != 2 || result.Summary.Timeout != 0 {
+		t.Errorf("summary = %+v, want 2 cancelled", result.Summary)
+	}
+	for _, nr := range result.NodeResults {
+		if nr.Status != "cancelled" || nr.Error != "execution cancelled" {
+			t.Errorf("%s: status %q, error %q, want cancelled", nr.NodeID, nr.Status, nr.Error)
+		}
+	}
+}
+
+func TestExecutor_NodeTimeout(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	executor := NewExecutor(store, &slowNodeRelay{slow: "node-2"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	start := time.Now()
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:          "exec-node-timeout",
+		Command:     TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+		Target:      TargetSelector{NodeIDs: []NodeID{"node-1", "node-2", "node-3"}},
+		Timeout:     5 * time.Second,
+		NodeTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v; the slow node should be cut off at NodeTimeout", elapsed)
+	}
+	if result.Summary.Success != 2 || result.Summary.Timeout != 1 {
+		t.Errorf("summary = %+v, want 2 success and 1 timeout", result.Summary)
+	}
+	for _, nr := range result.NodeResults {
+		if nr.NodeID == "node-2" && (nr.Status != "timeout" || nr.Error != "node timed out after 100ms") {
+			t.Errorf("node-2: status %q, error %q, want its own timeout", nr.Status, nr.Error)
+		}
+	}
+}
+
+func TestExecutor_TimeoutAbortsUnstartedNodes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	executor := NewExecutor(store, &gatedRelay{release: make(chan struct{})}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// One node at a time: the first is cut off by its node timeout, the
+	// second by the overall timeout, and the third never starts.
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:          "exec-budget",
+		Command:     TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"sleep 60"}`)},
+		Target:      TargetSelector{NodeIDs: []NodeID{"node-1", "node-2", "node-3"}, MaxConcurrency: 1},
+		Timeout:     250 * time.Millisecond,
+		NodeTimeout: 150 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Timeout != 3 {
+		t.Fatalf("summary = %+v, want 3 timeouts", result.Summary)
+	}
+	errs := map[string]int{}
+	for _, nr := range result.NodeResults {
+		errs[nr.Error]++
+	}
+	if errs["node timed out after 150ms"] != 1 || errs["execution timed out"] != 2 {
+		t.Errorf("errors = %v, want one node timeout and two overall timeouts", errs)
+	}
+}
+
+func TestNodeManager_DrainAndWait(t *testing.T) {
+	old := drainPollInterval
+	drainPollInterval = time.Millisecond
+	t.Cleanup(func() { drainPollInterval = old })
+
+	nm, _, release, done := newDrainTestStack(t, "exec-drain")
+
+	drained := make(chan error, 1)
+	go func() { drained <- nm.DrainAndWait(context.Background(), "node-1", 5*time.Second) }()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("DrainAndWait returned while work was in flight: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	node, _ := nm.store.GetNode(context.Background(), "node-1")
+	if node.Status != NodeStatusDraining {
+		t.Errorf("status while waiting = %s, want draining", node.Status)
+	}
+
+	close(release)
+	<-done
+	if err := <-drained; err != nil {
+		t.Fatalf("DrainAndWait: %v", err)
+	}
+}
+
+func TestNodeManager_DrainAndWaitTimeout(t *testing.T) {
+	nm, _, release, done := newDrainTestStack(t, "exec-stuck")
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	err := nm.DrainAndWait(context.Background(), "node-2", 30*time.Millisecond)
+	var timeoutErr *DrainTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("err = %v, want *DrainTimeoutError", err)
+	}
+	if !reflect.DeepEqual(timeoutErr.Pending, []string{"exec-stuck"}) {
+		t.Errorf("Pending = %v, want [exec-stuck]", timeoutErr.Pending)
+	}
+	if !strings.Contains(err.Error(), "node node-2 still has 1 execution(s) running after 30ms: exec-stuck") {
+		t.Errorf("error = %q", err.Error())
+	}
+
+	if err := NewNodeManager(nm.store, nm.logger).DrainAndWait(context.Background(), "node-2", time.Second); err == nil {
+		t.Error("expected an error without an in-flight source to wait on")
+	}
+}
+
+func TestNodeManager_SummaryBy(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	roster := append(testRoster(),
+		&Node{ID: "node-5", Status: NodeStatusUnreachable, Labels: map[string]string{"env": "prod"}},
+		&Node{ID: "node-6", Status: NodeStatusOnline, Labels: map[string]string{"role": "bastion"}},
+		&Node{ID: "node-7", Status: NodeStatusDraining},
+	)
+	for _, n := range roster {
+		store.RegisterNode(ctx, n)
+	}
+	nm := NewNodeManager(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	groups, err := nm.SummaryBy(ctx, "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type counts struct{ total, online, offline, degraded, draining, unreachable int }
+	want := map[string]counts{
+		"prod":       {total: 3, online: 2, unreachable: 1},
+		"staging":    {total: 2, offline: 1, degraded: 1},
+		NoLabelGroup: {total: 2, online: 1, draining: 1},
+	}
+	if len(groups) != len(want) {
+		t.Errorf("got %d groups, want %d: %v", len(groups), len(want), groups)
+	}
+	for value, w := range want {
+		s, ok := groups[value]
+		if !ok {
+			t.Errorf("missing group %q", value)
+			continue
+		}
+		got := counts{s.TotalNodes, s.Online, s.Offline, s.Degraded, s.Draining, s.Unreachable}
+		if got != w {
+			t.Errorf("group %q = %+v, want %+v", value, got, w)
+		}
+	}
+	if groups["prod"].GroupCounts["web"] != 2 {
+		t.Errorf("prod web count = %d, want 2", groups["prod"].GroupCounts["web"])
+	}
+
+	whole, _ := nm.Summary(ctx)
+	if whole.TotalNodes != 7 || whole.Online != 3 {
+		t.Errorf("Summary = %+v, want 7 nodes with 3 online", whole)
+	}
+}
+
+// countingRelay counts how many times each node was asked to run a command.
+type countingRelay struct {
+	mu   sync.Mutex
+	runs map[NodeID]int
+}
+
+func (r *countingRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.runs == nil {
+		r.runs = make(map[NodeID]int)
+	}
+	r.runs[node.ID]++
+	return &NodeResult{NodeID: node.ID, Output: fmt.Sprintf("run %d", r.runs[node.ID])}, nil
+}
+
+func (r *countingRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+func (r *countingRelay) count(id NodeID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[id]
+}
+
+// commandRecordingRelay keeps the command each node was sent.
+type commandRecordingRelay struct {
+	mu   sync.Mutex
+	sent map[NodeID]TypedCommand
+}
+
+func (r *commandRecordingRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sent == nil {
+		r.sent = make(map[NodeID]TypedCommand)
+	}
+	r.sent[node.ID] = cmd
+	return &NodeResult{NodeID: node.ID, Output: "ok"}, nil
+}
+
+func (r *commandRecordingRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+func TestExecutor_SendsMaxOutputBytes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	relay := &commandRecordingRelay{}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	req := &ExecRequest{
+		ID:             "exec-max-output",
+		Command:        TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"cat /var/log/huge.log"}`)},
+		Target:         TargetSelector{All: true},
+		Timeout:        5 * time.Second,
+		MaxOutputBytes: 4096,
+	}
+	if _, err := executor.Execute(ctx, req); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(relay.sent) == 0 {
+		t.Fatal("no commands sent")
+	}
+	for id, cmd := range relay.sent {
+		if cmd.MaxOutputBytes != 4096 {
+			t.Errorf("node %s got MaxOutputBytes %d, want 4096", id, cmd.MaxOutputBytes)
+		}
+	}
+	if req.Command.MaxOutputBytes != 0 {
+		t.Error("Execute modified the request's command")
+	}
+}
+
+func idempotentRequest(id, key string, nodes ...NodeID) *ExecRequest {
+	return &ExecRequest{
+		ID:             id,
+		Command:        TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"systemctl restart db"}`)},
+		Target:         TargetSelector{NodeIDs: nodes},
+		Timeout:        time.Second,
+		IdempotencyKey: key,
+	}
+}
+
+func TestExecutor_IdempotencyCacheHit(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	relay := &countingRelay{}
+	executor := NewExecutor(store, relay, logger)
+
+	first, err := executor.Execute(ctx, idempotentRequest("exec-1", "restart-db", "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := executor.Execute(ctx, idempotentRequest("exec-2", "restart-db", "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := relay.count("node-1"); got != 1 {
+		t.Errorf("node-1 ran %d times, want 1", got)
+	}
+	if first.NodeResults[0].Cached {
+		t.Error("first result should not be cached")
+	}
+	nr := second.NodeResults[0]
+	if !nr.Cached || nr.Output != "run 1" || nr.Status != "success" {
+		t.Errorf("second result = cached %v output %q status %q, want cached replay of run 1", nr.Cached, nr.Output, nr.Status)
+	}
+
+	// A new executor on the same store stands in for a later CLI invocation.
+	again, err := NewExecutor(store, relay, logger).Execute(ctx, idempotentRequest("exec-3", "restart-db", "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relay.count("node-1"); got != 1 || !again.NodeResults[0].Cached {
+		t.Errorf("after restart: node-1 ran %d times, cached %v; want 1, true", got, again.NodeResults[0].Cached)
+	}
+
+	if _, err := executor.Execute(ctx, idempotentRequest("exec-4", "", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := relay.count("node-1"); got != 2 {
+		t.Errorf("request without a key: node-1 ran %d times, want 2", got)
+	}
+}
+
+func TestExecutor_IdempotencyTTLExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	relay := &countingRelay{}
+	executor := NewExecutor(store, relay, logger)
+	executor.SetIdempotency(resilience.NewIdempotencyController(20*time.Millisecond, logger))
+
+	if _, err := executor.Execute(ctx, idempotentRequest("exec-1", "restart-db", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	result, err := executor.Execute(ctx, idempotentRequest("exec-2", "restart-db", "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := relay.count("node-1"); got != 2 {
+		t.Errorf("node-1 ran %d times, want 2 once the key expired", got)
+	}
+	if nr := result.NodeResults[0]; nr.Cached || nr.Output != "run 2" {
+		t.Errorf("result after expiry = cached %v output %q, want a fresh run 2", nr.Cached, nr.Output)
+	}
+}
+
+func TestExecutor_IdempotencyPerNode(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	relay := &countingRelay{}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := executor.Execute(ctx, idempotentRequest("exec-1", "restart-db", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	result, err := executor.Execute(ctx, idempotentRequest("exec-2", "restart-db", "node-1", "node-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := relay.count("node-1"); got != 1 {
+		t.Errorf("node-1 ran %d times, want 1", got)
+	}
+	if got := relay.count("node-2"); got != 1 {
+		t.Errorf("node-2 ran %d times, want 1 (the key was only used on node-1)", got)
+	}
+	for _, nr := range result.NodeResults {
+		if want := nr.NodeID == "node-1"; nr.Cached != want {
+			t.Errorf("%s cached = %v, want %v", nr.NodeID, nr.Cached, want)
+		}
+	}
+}
+
+func TestNodeResources_UtilizationSummary(t *testing.T) {
+	if got := (NodeResources{CPUCores: 4, MemoryMB: 8000}).UtilizationSummary(); got != "-" {
+		t.Errorf("without utilization = %q, want -", got)
+	}
+	r := NodeResources{Load1: 0.5, MemoryMB: 8000, MemoryUsedMB: 2000, DiskMB: 100 * 1024, DiskFreeMB: 12 * 1024}
+	if got, want := r.UtilizationSummary(), "load 0.50 mem 25% disk 12.0G free"; got != want {
+		t.Errorf("UtilizationSummary = %q, want %q", got, want)
+	}
+}
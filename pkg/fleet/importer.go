@@ -0,0 +1,329 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// ImportRecord is one node entry in a bulk import file.
+type ImportRecord struct {
+	ID           string            `yaml:"id"           json:"id"`
+	Hostname     string            `yaml:"hostname"     json:"hostname"`
+	Address      string            `yaml:"address"      json:"address,omitempty"`
+	Labels       map[string]string `yaml:"labels"       json:"labels,omitempty"`
+	Groups       []string          `yaml:"groups"       json:"groups,omitempty"`
+	Capabilities []string          `yaml:"capabilities" json:"capabilities,omitempty"`
+}
+
+// Roster is an exported fleet roster. ParseImportFile reads it back, so an
+// export can be imported on another control plane.
+type Roster struct {
+	ExportedAt time.Time      `json:"exported_at"`
+	Nodes      []ImportRecord `json:"nodes"`
+}
+
+// Export snapshots the roster's definitions (IDs, hostnames, addresses,
+// labels, groups and capabilities), ordered by node ID. Runtime state such
+// as status and resources is left out.
+func (nm *NodeManager) Export(ctx context.Context) (*Roster, error) {
+	nodes, err := nm.store.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	roster := &Roster{ExportedAt: time.Now().UTC(), Nodes: make([]ImportRecord, 0, len(nodes))}
+	for _, n := range nodes {
+		rec := ImportRecord{
+			ID:           string(n.ID),
+			Hostname:     n.Hostname,
+			Address:      n.Address,
+			Labels:       n.Labels,
+			Capabilities: n.Capabilities,
+		}
+		for _, g := range n.Groups {
+			rec.Groups = append(rec.Groups, string(g))
+		}
+		roster.Nodes = append(roster.Nodes, rec)
+	}
+	return roster, nil
+}
+
+// ParseImportFile parses a bulk import file. It accepts YAML or JSON, either
+// as a top-level list of nodes or as an object with a "nodes" list.
+func ParseImportFile(data []byte) ([]ImportRecord, error) {
+	var records []ImportRecord
+	if err := yaml.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	var doc struct {
+		Nodes []ImportRecord `yaml:"nodes"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse import file: %w", err)
+	}
+	return doc.Nodes, nil
+}
+
+// ImportMode says what an import does with nodes already in the roster.
+type ImportMode string
+
+const (
+	// ImportSkipExisting leaves registered nodes untouched (the default).
+	ImportSkipExisting ImportMode = ""
+	// ImportMerge updates registered nodes: labels are merged, groups are
+	// added, and a non-empty hostname, address or capability list replaces
+	// the current one.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace makes the file the whole roster: registered nodes take
+	// the file's definition, and nodes missing from the file are removed.
+	ImportReplace ImportMode = "replace"
+)
+
+// ImportOptions controls a bulk import.
+type ImportOptions struct {
+	Mode ImportMode
+	// AbortOnError stops at the first node that fails to import. Nodes
+	// already imported stay registered.
+	AbortOnError bool
+	// Retry governs retries of store errors for each node. Zero values
+	// fall back to resilience.DefaultRetryConfig.
+	Retry resilience.RetryConfig
+}
+
+// ImportReport summarises a bulk import.
+type ImportReport struct {
+	Imported []NodeID      `json:"imported"`
+	Updated  []NodeID      `json:"updated,omitempty"` // existing nodes, with ImportMerge or ImportReplace
+	Removed  []NodeID      `json:"removed,omitempty"` // nodes missing from the file, with ImportReplace
+	Skipped  []ImportIssue `json:"skipped"`
+	Failed   []ImportIssue `json:"failed"`
+	Aborted  bool          `json:"aborted,omitempty"` // stopped early by AbortOnError
+}
+
+// ImportIssue records why a node was skipped or failed.
+type ImportIssue struct {
+	Index    int    `json:"index"` // position in the import file, from 0; -1 for removals
+	NodeID   NodeID `json:"node_id,omitempty"`
+	Reason   string `json:"reason"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// Import registers records with the fleet, one node at a time.
+//
+// Each record is validated first; invalid ones are reported as failed.
+// Store errors are retried with backoff; a node that still fails is recorded
+// in the report and the import moves on, unless opts.AbortOnError is set.
+// By default nodes already in the store are skipped, so re-running an import
+// after a partial failure only registers what is missing; opts.Mode can
+// update them instead.
+//
+// The report is always returned. The error is non-nil only when the existing
+// roster could not be read or the context was cancelled.
+func (nm *NodeManager) Import(ctx context.Context, records []ImportRecord, opts ImportOptions) (*ImportReport, error) {
+	retry := opts.Retry
+	if retry.MaxAttempts == 0 {
+		retry = resilience.DefaultRetryConfig()
+	}
+	switch opts.Mode {
+	case ImportSkipExisting, ImportMerge, ImportReplace:
+	default:
+		return nil, fmt.Errorf("unknown import mode %q (want merge or replace)", opts.Mode)
+	}
+	retry.RetryableErr = func(err error) bool {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	report := &ImportReport{
+		Imported: []NodeID{},
+		Skipped:  []ImportIssue{},
+		Failed:   []ImportIssue{},
+	}
+
+	var existing []*Node
+	err := resilience.Retry(ctx, retry, func(int) error {
+		var err error
+		existing, err = nm.store.ListNodes(ctx)
+		return err
+	})
+	if err != nil {
+		return report, fmt.Errorf("list existing nodes: %w", err)
+	}
+	registered := make(map[NodeID]*Node, len(existing))
+	for _, n := range existing {
+		registered[n.ID] = n
+	}
+	inFile := make(map[NodeID]bool, len(records))
+
+	for i, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		id := NodeID(strings.TrimSpace(rec.ID))
+		if id == "" {
+			id = NodeID(strings.TrimSpace(rec.Hostname))
+		}
+		current := registered[id]
+		switch {
+		case id == "":
+			report.Skipped = append(report.Skipped, ImportIssue{Index: i, Reason: "no id or hostname"})
+			continue
+		case inFile[id]:
+			report.Skipped = append(report.Skipped, ImportIssue{Index: i, NodeID: id, Reason: "duplicate entry in file"})
+			continue
+		case current != nil && opts.Mode == ImportSkipExisting:
+			inFile[id] = true
+			report.Skipped = append(report.Skipped, ImportIssue{Index: i, NodeID: id, Reason: "already registered"})
+			continue
+		}
+		inFile[id] = true
+
+		if err := rec.validate(); err != nil {
+			report.Failed = append(report.Failed, ImportIssue{Index: i, NodeID: id, Reason: err.Error()})
+			if opts.AbortOnError {
+				report.Aborted = true
+				return report, nil
+			}
+			continue
+		}
+
+		node := rec.node(id)
+		if current != nil {
+			node = rec.apply(current, opts.Mode)
+		}
+		attempts := 0
+		err := resilience.Retry(ctx, retry, func(int) error {
+			attempts++
+			return nm.Register(ctx, node)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			nm.logger.Warn("node import failed", "node_id", id, "attempts", attempts, "error", err)
+			report.Failed = append(report.Failed, ImportIssue{Index: i, NodeID: id, Reason: err.Error(), Attempts: attempts})
+			if opts.AbortOnError {
+				report.Aborted = true
+				return report, nil
+			}
+			continue
+		}
+		if current != nil {
+			report.Updated = append(report.Updated, id)
+		} else {
+			report.Imported = append(report.Imported, id)
+		}
+	}
+
+	if opts.Mode == ImportReplace {
+		nm.removeUnlisted(ctx, existing, inFile, retry, report)
+	}
+	return report, nil
+}
+
+// removeUnlisted deregisters the existing nodes an ImportReplace file does
+// not list. Nodes whose record failed validation count as listed, so a
+// typo does not remove a node.
+func (nm *NodeManager) removeUnlisted(ctx context.Context, existing []*Node, listed map[NodeID]bool, retry resilience.RetryConfig, report *ImportReport) {
+	for _, n := range existing {
+		if listed[n.ID] || ctx.Err() != nil {
+			continue
+		}
+		attempts := 0
+		err := resilience.Retry(ctx, retry, func(int) error {
+			attempts++
+			return nm.Deregister(ctx, n.ID)
+		})
+		if err != nil {
+			report.Failed = append(report.Failed, ImportIssue{Index: -1, NodeID: n.ID, Reason: "remove: " + err.Error(), Attempts: attempts})
+			continue
+		}
+		report.Removed = append(report.Removed, n.ID)
+	}
+}
+
+// validate rejects records that would register an unusable node.
+func (rec ImportRecord) validate() error {
+	if strings.ContainsAny(strings.TrimSpace(rec.ID), " \t\n") {
+		return fmt.Errorf("invalid id %q: contains whitespace", rec.ID)
+	}
+	if rec.Address != "" && (strings.ContainsAny(rec.Address, " \t\n") || strings.Contains(rec.Address, "://")) {
+		return fmt.Errorf("invalid address %q: want a host or host:port", rec.Address)
+	}
+	for k := range rec.Labels {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("empty label key")
+		}
+	}
+	for _, g := range rec.Groups {
+		if strings.TrimSpace(g) == "" {
+			return fmt.Errorf("empty group name")
+		}
+	}
+	return nil
+}
+
+// apply returns current updated with rec according to mode. Runtime state
+// (status, resources, version, tunnel) is kept either way.
+func (rec ImportRecord) apply(current *Node, mode ImportMode) *Node {
+	n := *current
+	if mode == ImportReplace {
+		def := rec.node(current.ID)
+		n.Hostname, n.Address, n.Labels, n.Groups, n.Capabilities =
+			def.Hostname, def.Address, def.Labels, def.Groups, def.Capabilities
+		return &n
+	}
+
+	if rec.Hostname != "" {
+		n.Hostname = rec.Hostname
+	}
+	if rec.Address != "" {
+		n.Address = rec.Address
+	}
+	if len(rec.Capabilities) > 0 {
+		n.Capabilities = rec.Capabilities
+	}
+	n.Labels = make(map[string]string, len(current.Labels)+len(rec.Labels))
+	for k, v := range current.Labels {
+		n.Labels[k] = v
+	}
+	for k, v := range rec.Labels {
+		n.Labels[k] = v
+	}
+	n.Groups = append([]GroupName(nil), current.Groups...)
+	for _, g := range rec.Groups {
+		if !slices.Contains(n.Groups, GroupName(g)) {
+			n.Groups = append(n.Groups, GroupName(g))
+		}
+	}
+	return &n
+}
+
+func (rec ImportRecord) node(id NodeID) *Node {
+	hostname := rec.Hostname
+	if hostname == "" {
+		hostname = string(id)
+	}
+	node := &Node{
+		ID:           id,
+		Hostname:     hostname,
+		Address:      rec.Address,
+		Labels:       rec.Labels,
+		Capabilities: rec.Capabilities,
+	}
+	for _, g := range rec.Groups {
+		node.Groups = append(node.Groups, GroupName(g))
+	}
+	return node
+}
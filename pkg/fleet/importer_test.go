@@ -0,0 +1,317 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// flakyStore fails RegisterNode for selected nodes a fixed number of times
+// before letting the call through; a negative count fails forever.
+type flakyStore struct {
+	*MemoryStore
+
+	mu       sync.Mutex
+	failures map[NodeID]int
+	calls    map[NodeID]int
+}
+
+func newFlakyStore(failures map[NodeID]int) *flakyStore {
+	return &flakyStore{
+		MemoryStore: NewMemoryStore(),
+		failures:    failures,
+		calls:       make(map[NodeID]int),
+	}
+}
+
+func (s *flakyStore) RegisterNode(ctx context.Context, node *Node) error {
+	s.mu.Lock()
+	s.calls[node.ID]++
+	remaining := s.failures[node.ID]
+	if remaining != 0 {
+		s.failures[node.ID] = remaining - 1
+		s.mu.Unlock()
+		return errors.New("database is locked")
+	}
+	s.mu.Unlock()
+	return s.MemoryStore.RegisterNode(ctx, node)
+}
+
+func fastRetry() resilience.RetryConfig {
+	return resilience.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+}
+
+func importRecords(ids ...string) []ImportRecord {
+	records := make([]ImportRecord, len(ids))
+	for i, id := range ids {
+		records[i] = ImportRecord{ID: id, Address: "10.0.0." + id}
+	}
+	return records
+}
+
+func TestNodeManager_Import_RetriesAndReports(t *testing.T) {
+	store := newFlakyStore(map[NodeID]int{
+		"2": 2,  // transient: succeeds on the third attempt
+		"4": -1, // permanent
+	})
+	nm := NewNodeManager(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	store.MemoryStore.RegisterNode(context.Background(), &Node{ID: "5"})
+
+	records := append(importRecords("1", "2", "3", "4", "5"), ImportRecord{Address: "10.0.0.9"})
+	report, err := nm.Import(context.Background(), records, ImportOptions{Retry: fastRetry()})
+	if err != nil {
+		t.Fatalf("Import() error: %v", err)
+	}
+
+	if got := len(report.Imported); got != 3 {
+		t.Errorf("imported = %v, want 3 nodes", report.Imported)
+	}
+	if got := len(report.Skipped); got != 2 {
+		t.Errorf("skipped = %+v, want 2 (existing and no id)", report.Skipped)
+	}
+	if len(report.Failed) != 1 {
+		t.Fatalf("failed = %+v, want 1", report.Failed)
+	}
+
+	failed := report.Failed[0]
+	if failed.NodeID != "4" || failed.Index != 3 || failed.Attempts != 3 {
+		t.Errorf("failed entry = %+v", failed)
+	}
+	if !strings.Contains(failed.Reason, "database is locked") {
+		t.Errorf("reason = %q, want the store error", failed.Reason)
+	}
+	if store.calls["2"] != 3 {
+		t.Errorf("node 2 register calls = %d, want 3", store.calls["2"])
+	}
+	if _, err := store.GetNode(context.Background(), "2"); err != nil {
+		t.Errorf("node 2 should be registered after retries: %v", err)
+	}
+	if report.Aborted {
+		t.Error("report should not be marked aborted")
+	}
+}
+
+func TestNodeManager_Import_AbortOnError(t *testing.T) {
+	store := newFlakyStore(map[NodeID]int{"2": -1})
+	nm := NewNodeManager(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	report, err := nm.Import(context.Background(), importRecords("1", "2", "3"), ImportOptions{
+		AbortOnError: true,
+		Retry:        fastRetry(),
+	})
+	if err != nil {
+		t.Fatalf("Import() error: %v", err)
+	}
+	if !report.Aborted {
+		t.Error("report should be marked aborted")
+	}
+	if len(report.Imported) != 1 || len(report.Failed) != 1 {
+		t.Errorf("imported = %v, failed = %+v", report.Imported, report.Failed)
+	}
+	if store.calls["3"] != 0 {
+		t.Error("import should stop before node 3")
+	}
+}
+
+func TestNodeManager_Import_RerunSkipsImported(t *testing.T) {
+	store := newFlakyStore(map[NodeID]int{"2": 3})
+	nm := NewNodeManager(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	records := importRecords("1", "2")
+
+	first, _ := nm.Import(context.Background(), records, ImportOptions{Retry: fastRetry()})
+	if len(first.Failed) != 1 {
+		t.Fatalf("first run failed = %+v, want 1", first.Failed)
+	}
+
+	second, _ := nm.Import(context.Background(), records, ImportOptions{Retry: fastRetry()})
+	if len(second.Imported) != 1 || second.Imported[0] != "2" {
+		t.Errorf("second run imported = %v, want [2]", second.Imported)
+	}
+	if len(second.Skipped) != 1 || second.Skipped[0].NodeID != "1" {
+		t.Errorf("second run skipped = %+v, want node 1", second.Skipped)
+	}
+}
+
+func TestParseImportFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"yaml list", "- id: web-1\n  address: 10.0.0.1\n  labels: {env: prod}\n- id: web-2\n"},
+		{"yaml nodes key", "nodes:\n  - id: web-1\n    address: 10.0.0.1\n    labels: {env: prod}\n  - id: web-2\n"},
+		{"json list", `[{"id": "web-1", "address": "10.0.0.1", "labels": {"env": "prod"}}, {"id": "web-2"}]`},
+		{"json nodes key", `{"nodes": [{"id": "web-1", "address": "10.0.0.1", "labels": {"env": "prod"}}, {"id": "web-2"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseImportFile([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseImportFile() error: %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("expected 2 records, got %d", len(records))
+			}
+			if records[0].ID != "web-1" || records[0].Address != "10.0.0.1" || records[0].Labels["env"] != "prod" {
+				t.Errorf("record[0] = %+v", records[0])
+			}
+		})
+	}
+
+	if _, err := ParseImportFile([]byte("nodes: [")); err == nil {
+		t.Error("expected error for malformed file")
+	}
+}
+
+func rosterNodes() []*Node {
+	return []*Node{
+		{ID: "web-1", Hostname: "web-1.internal", Address: "10.0.0.1", Labels: map[string]string{"env": "prod", "role": "web"}, Groups: []GroupName{"web", "prod"}},
+		{ID: "web-2", Hostname: "web-2.internal", Address: "10.0.0.2:2222", Labels: map[string]string{"env": "prod", "role": "web"}, Groups: []GroupName{"web"}},
+		{ID: "db-1", Hostname: "db-1", Labels: map[string]string{"env": "staging"}, Capabilities: []string{"docker"}},
+	}
+}
+
+func TestNodeManager_ExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	src := NewNodeManager(NewMemoryStore(), logger)
+	for _, n := range rosterNodes() {
+		if err := src.Register(ctx, n); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	roster, err := src.Export(ctx)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	data, err := json.Marshal(roster)
+	if err != nil {
+		t.Fatalf("marshal roster: %v", err)
+	}
+	records, err := ParseImportFile(data)
+	if err != nil {
+		t.Fatalf("ParseImportFile: %v", err)
+	}
+
+	dstStore := NewMemoryStore()
+	dst := NewNodeManager(dstStore, logger)
+	report, err := dst.Import(ctx, records, ImportOptions{Retry: fastRetry()})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(report.Imported) != 3 || len(report.Failed) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	for _, want := range rosterNodes() {
+		got, err := dstStore.GetNode(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("GetNode(%s): %v", want.ID, err)
+		}
+		if got.Hostname != want.Hostname || got.Address != want.Address ||
+			!reflect.DeepEqual(got.Labels, want.Labels) || !reflect.DeepEqual(got.Groups, want.Groups) ||
+			!reflect.DeepEqual(got.Capabilities, want.Capabilities) {
+			t.Errorf("%s after round trip = %+v, want %+v", want.ID, got, want)
+		}
+	}
+	if members, _ := dstStore.ListNodesByGroup(ctx, "web"); len(members) != 2 {
+		t.Errorf("group web has %d members after import, want 2", len(members))
+	}
+}
+
+func TestNodeManager_Import_Modes(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	setup := func() (*MemoryStore, *NodeManager) {
+		store := NewMemoryStore()
+		nm := NewNodeManager(store, logger)
+		for _, n := range rosterNodes() {
+			nm.Register(ctx, n)
+		}
+		store.UpdateNodeStatus(ctx, "web-1", NodeStatusDraining)
+		return store, nm
+	}
+	records := []ImportRecord{
+		{ID: "web-1", Address: "10.0.1.1", Labels: map[string]string{"tier": "edge"}, Groups: []string{"edge"}},
+		{ID: "app-1", Address: "10.0.2.1"},
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		store, nm := setup()
+		report, err := nm.Import(ctx, records, ImportOptions{Mode: ImportMerge, Retry: fastRetry()})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		if !reflect.DeepEqual(report.Updated, []NodeID{"web-1"}) || !reflect.DeepEqual(report.Imported, []NodeID{"app-1"}) || len(report.Removed) != 0 {
+			t.Errorf("report = %+v", report)
+		}
+		web, _ := store.GetNode(ctx, "web-1")
+		wantLabels := map[string]string{"env": "prod", "role": "web", "tier": "edge"}
+		if web.Address != "10.0.1.1" || web.Hostname != "web-1.internal" || !reflect.DeepEqual(web.Labels, wantLabels) {
+			t.Errorf("merged web-1 = %+v", web)
+		}
+		if !reflect.DeepEqual(web.Groups, []GroupName{"web", "prod", "edge"}) || web.Status != NodeStatusDraining {
+			t.Errorf("merged web-1 groups %v, status %s", web.Groups, web.Status)
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		store, nm := setup()
+		report, err := nm.Import(ctx, records, ImportOptions{Mode: ImportReplace, Retry: fastRetry()})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		removed := append([]NodeID(nil), report.Removed...)
+		sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+		if !reflect.DeepEqual(removed, []NodeID{"db-1", "web-2"}) {
+			t.Errorf("removed = %v, want db-1 and web-2", report.Removed)
+		}
+		web, _ := store.GetNode(ctx, "web-1")
+		if !reflect.DeepEqual(web.Labels, map[string]string{"tier": "edge"}) || !reflect.DeepEqual(web.Groups, []GroupName{"edge"}) {
+			t.Errorf("replaced web-1 = %+v", web)
+		}
+		if nodes, _ := store.ListNodes(ctx); len(nodes) != 2 {
+			t.Errorf("roster has %d nodes, want 2", len(nodes))
+		}
+	})
+}
+
+func TestNodeManager_Import_ValidatesEachNode(t *testing.T) {
+	store := NewMemoryStore()
+	nm := NewNodeManager(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	records := []ImportRecord{
+		{ID: "web-1", Address: "https://10.0.0.1"},
+		{ID: "web 2"},
+		{ID: "web-3", Groups: []string{""}},
+		{ID: "web-4", Address: "10.0.0.4"},
+		{ID: "web-4", Address: "10.0.0.5"},
+	}
+	report, err := nm.Import(context.Background(), records, ImportOptions{Retry: fastRetry()})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(report.Failed) != 3 || !reflect.DeepEqual(report.Imported, []NodeID{"web-4"}) {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Reason != "duplicate entry in file" {
+		t.Errorf("skipped = %+v", report.Skipped)
+	}
+	if n, _ := store.GetNode(context.Background(), "web-4"); n == nil || n.Address != "10.0.0.4" {
+		t.Errorf("web-4 = %+v", n)
+	}
+
+	if _, err := nm.Import(context.Background(), nil, ImportOptions{Mode: "upsert"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
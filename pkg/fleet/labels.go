@@ -0,0 +1,248 @@
+package fleet
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// LabelOp is the comparison a LabelMatcher applies to a node label.
+type LabelOp string
+
+const (
+	LabelOpEq    LabelOp = "eq"
+	LabelOpNe    LabelOp = "ne"
+	LabelOpIn    LabelOp = "in"
+	LabelOpNotIn LabelOp = "notin"
+	LabelOpRegex LabelOp = "regex"
+)
+
+// LabelMatcher selects nodes by a single label. Negative operators (ne,
+// notin) also match nodes that don't carry the key at all, so
+// env!=prod includes unlabelled nodes. Regex patterns must match the
+// whole value.
+type LabelMatcher struct {
+	Key    string   `json:"key"`
+	Op     LabelOp  `json:"op"`
+	Values []string `json:"values"`
+}
+
+// Validate checks the operator, arity, and regex syntax.
+func (m LabelMatcher) Validate() error {
+	if m.Key == "" {
+		return fmt.Errorf("label matcher has no key")
+	}
+	switch m.Op {
+	case LabelOpEq, LabelOpNe, LabelOpRegex:
+		if len(m.Values) != 1 {
+			return fmt.Errorf("label matcher %s %s takes exactly one value", m.Key, m.Op)
+		}
+	case LabelOpIn, LabelOpNotIn:
+		if len(m.Values) == 0 {
+			return fmt.Errorf("label matcher %s %s needs at least one value", m.Key, m.Op)
+		}
+	default:
+		return fmt.Errorf("unknown label operator %q", m.Op)
+	}
+	if m.Op == LabelOpRegex {
+		if _, err := compileLabelRegex(m.Values[0]); err != nil {
+			return fmt.Errorf("label matcher %s: %w", m.Key, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether labels satisfy m. Invalid matchers match nothing.
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	v, ok := labels[m.Key]
+	switch m.Op {
+	case LabelOpEq:
+		return ok && len(m.Values) == 1 && v == m.Values[0]
+	case LabelOpNe:
+		return len(m.Values) == 1 && (!ok || v != m.Values[0])
+	case LabelOpIn:
+		return ok && containsString(m.Values, v)
+	case LabelOpNotIn:
+		return len(m.Values) > 0 && (!ok || !containsString(m.Values, v))
+	case LabelOpRegex:
+		if !ok || len(m.Values) != 1 {
+			return false
+		}
+		re, err := compileLabelRegex(m.Values[0])
+		return err == nil && re.MatchString(v)
+	}
+	return false
+}
+
+// String renders m in the syntax ParseLabelMatcher accepts.
+func (m LabelMatcher) String() string {
+	switch m.Op {
+	case LabelOpEq:
+		return m.Key + "=" + strings.Join(m.Values, ",")
+	case LabelOpNe:
+		return m.Key + "!=" + strings.Join(m.Values, ",")
+	case LabelOpRegex:
+		return m.Key + "=~" + strings.Join(m.Values, ",")
+	default:
+		return fmt.Sprintf("%s %s (%s)", m.Key, m.Op, strings.Join(m.Values, ","))
+	}
+}
+
+// ParseLabelMatcher parses one selector expression:
+//
+//	key=value             eq
+//	key!=value            ne
+//	key=~pattern          regex (anchored)
+//	key in (a,b,...)      in
+//	key notin (a,b,...)   notin
+func ParseLabelMatcher(expr string) (LabelMatcher, error) {
+	expr = strings.TrimSpace(expr)
+	if key, rest, ok := strings.Cut(expr, " "); ok {
+		rest = strings.TrimSpace(rest)
+		for _, op := range []LabelOp{LabelOpNotIn, LabelOpIn} {
+			list, found := strings.CutPrefix(rest, string(op))
+			if !found {
+				continue
+			}
+			list = strings.TrimSpace(list)
+			if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+				return LabelMatcher{}, fmt.Errorf("invalid label selector %q: expected %s (a,b,...)", expr, op)
+			}
+			var values []string
+			for _, v := range strings.Split(list[1:len(list)-1], ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			m := LabelMatcher{Key: key, Op: op, Values: values}
+			return m, m.Validate()
+		}
+	}
+
+	// The first '=' decides the operator, so values and patterns may
+	// themselves contain '=', '!=' or '=~'.
+	i := strings.Index(expr, "=")
+	if i < 0 {
+		return LabelMatcher{}, fmt.Errorf("invalid label selector %q", expr)
+	}
+	m := LabelMatcher{Key: expr[:i], Op: LabelOpEq, Values: []string{expr[i+1:]}}
+	switch {
+	case i > 0 && expr[i-1] == '!':
+		m.Key, m.Op = expr[:i-1], LabelOpNe
+	case strings.HasPrefix(expr[i+1:], "~"):
+		m.Op, m.Values[0] = LabelOpRegex, expr[i+2:]
+	}
+	m.Key = strings.TrimSpace(m.Key)
+	m.Values[0] = strings.TrimSpace(m.Values[0])
+	return m, m.Validate()
+}
+
+// SplitLabelSelectors splits a comma-separated selector list, keeping the
+// commas inside "in (...)" value lists together.
+func SplitLabelSelectors(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				if part := strings.TrimSpace(s[start:i]); part != "" {
+					out = append(out, part)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		out = append(out, part)
+	}
+	return out
+}
+
+// ParseTargetSelector builds a selector from the CLI's targeting flags:
+// node is a comma-separated list of node IDs, tag and exclude are label
+// selector lists (see ParseLabelMatcher), and env matches the env label.
+// Plain key=value tags become Labels, the rest LabelMatchers. A selector
+// that names no nodes or labels selects every node. Errors are prefixed
+// with the field at fault, "tag" or "exclude".
+func ParseTargetSelector(node, tag, env, exclude string) (TargetSelector, error) {
+	var ts TargetSelector
+	for _, n := range strings.Split(node, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			ts.NodeIDs = append(ts.NodeIDs, NodeID(n))
+		}
+	}
+	for _, expr := range SplitLabelSelectors(tag) {
+		m, err := ParseLabelMatcher(expr)
+		if err != nil {
+			return ts, fmt.Errorf("tag: %w", err)
+		}
+		if m.Op == LabelOpEq {
+			if ts.Labels == nil {
+				ts.Labels = make(map[string]string)
+			}
+			ts.Labels[m.Key] = m.Values[0]
+			continue
+		}
+		ts.LabelMatchers = append(ts.LabelMatchers, m)
+	}
+	if env != "" {
+		if ts.Labels == nil {
+			ts.Labels = make(map[string]string)
+		}
+		ts.Labels["env"] = env
+	}
+	for _, expr := range SplitLabelSelectors(exclude) {
+		m, err := ParseLabelMatcher(expr)
+		if err != nil {
+			return ts, fmt.Errorf("exclude: %w", err)
+		}
+		ts.Exclude = append(ts.Exclude, m)
+	}
+	if len(ts.NodeIDs) == 0 && len(ts.Labels) == 0 && len(ts.LabelMatchers) == 0 {
+		ts.All = true
+	}
+	return ts, nil
+}
+
+// matchAllMatchers reports whether labels satisfy every matcher.
+func matchAllMatchers(labels map[string]string, matchers []LabelMatcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// labelRegexCache holds compiled label patterns; selectors are evaluated
+// against every node in the roster, so each pattern is compiled once.
+var labelRegexCache sync.Map // pattern -> *regexp.Regexp
+
+func compileLabelRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := labelRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	labelRegexCache.Store(pattern, re)
+	return re, nil
+}
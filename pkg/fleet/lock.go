@@ -0,0 +1,16 @@
+package fleet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newLockHolder returns a token identifying one acquisition of a lock.
+// Stores record it with the lock and match Unlock and Extend against it,
+// so a holder whose lock expired and was taken over cannot release or
+// extend the new holder's lock.
+func newLockHolder() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package fleet
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// DefaultNodeHistory is how many executions ListExecutionsByNode returns
+// when no limit is given.
+const DefaultNodeHistory = 10
+
+// NodeExecution is one node's part in a recorded execution: the request
+// and the result that node returned.
+type NodeExecution struct {
+	Request *ExecRequest `json:"request"`
+	Result  NodeResult   `json:"result"`
+}
+
+// nodeExecution picks node's result out of an execution, reporting false
+// if the execution did not include node.
+func nodeExecution(req *ExecRequest, result *ExecResult, node NodeID) (NodeExecution, bool) {
+	if result == nil {
+		return NodeExecution{}, false
+	}
+	for _, nr := range result.NodeResults {
+		if nr.NodeID == node {
+			return NodeExecution{Request: req, Result: nr}, true
+		}
+	}
+	return NodeExecution{}, false
+}
+
+func nodeHistoryLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultNodeHistory
+	}
+	return limit
+}
+
+// scanNodeExecutions reads (request, result) JSON rows, as selected by the
+// SQL stores' ListExecutionsByNode, and picks out node's results.
+func scanNodeExecutions(rows *sql.Rows, node NodeID) ([]NodeExecution, error) {
+	defer rows.Close()
+	var out []NodeExecution
+	for rows.Next() {
+		var reqJSON, resJSON string
+		if err := rows.Scan(&reqJSON, &resJSON); err != nil {
+			return nil, err
+		}
+		var req ExecRequest
+		var result ExecResult
+		if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(resJSON), &result); err != nil {
+			return nil, err
+		}
+		if ne, ok := nodeExecution(&req, &result, node); ok {
+			out = append(out, ne)
+		}
+	}
+	return out, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,6 +14,8 @@ type NodeManager struct {
 	store  Store
 	logger *slog.Logger
 
+	inFlight InFlightFunc // optional; DrainAndWait polls it
+
 	mu         sync.RWMutex
 	watchers   []NodeWatcher
 	gcInterval time.Duration // how often to check for stale nodes
@@ -85,12 +88,12 @@ func (nm *NodeManager) Deregister(ctx context.Context, id NodeID) error {
 func (nm *NodeManager) Heartbeat(ctx context.Context, id NodeID, resources NodeResources) error {
 	node, err := nm.store.GetNode(ctx, id)
 	if err != nil {
-		return fmt.Errorf("node %s not found: %w", id, err)
+		return fmt.Errorf("heartbeat %s: %w", id, err)
 	}
 
 	oldStatus := node.Status
 	if err := nm.store.UpdateNodeHeartbeat(ctx, id, resources); err != nil {
-		return err
+		return fmt.Errorf("heartbeat %s: %w", id, err)
 	}
 
 	// Transition back to online if was unreachable
@@ -127,6 +130,85 @@ func (nm *NodeManager) Drain(ctx context.Context, id NodeID) error {
 	return nil
 }
 
+// InFlightFunc lists the IDs of requests still running on a node.
+type InFlightFunc func(ctx context.Context, id NodeID) ([]string, error)
+
+// SetExecutor makes DrainAndWait wait on the requests e has in flight,
+// which only covers work dispatched by this process.
+func (nm *NodeManager) SetExecutor(e *Executor) {
+	nm.inFlight = func(_ context.Context, id NodeID) ([]string, error) {
+		return e.InFlight(id), nil
+	}
+}
+
+// SetInFlight makes DrainAndWait wait on the requests f reports, such as
+// the commands a running relay still awaits from the node.
+func (nm *NodeManager) SetInFlight(f InFlightFunc) {
+	nm.inFlight = f
+}
+
+// drainPollInterval is how often DrainAndWait rechecks in-flight work.
+var drainPollInterval = 100 * time.Millisecond
+
+// DrainTimeoutError is returned by DrainAndWait when work is still running
+// on the node after the timeout.
+type DrainTimeoutError struct {
+	NodeID  NodeID
+	Timeout time.Duration
+	Pending []string // request IDs still running on the node
+}
+
+func (e *DrainTimeoutError) Error() string {
+	return fmt.Sprintf("node %s still has %d execution(s) running after %s: %s",
+		e.NodeID, len(e.Pending), e.Timeout, strings.Join(e.Pending, ", "))
+}
+
+// DrainAndWait drains the node, then blocks until the in-flight source set
+// with SetExecutor or SetInFlight reports no requests on it. If timeout
+// (0 = no limit) passes first it returns a *DrainTimeoutError listing the
+// requests still running; the node stays draining either way.
+func (nm *NodeManager) DrainAndWait(ctx context.Context, id NodeID, timeout time.Duration) error {
+	if nm.inFlight == nil {
+		return fmt.Errorf("drain %s: no in-flight source to wait on", id)
+	}
+	if err := nm.Drain(ctx, id); err != nil {
+		return err
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending, err := nm.inFlight(ctx, id)
+		if err != nil {
+			return fmt.Errorf("drain %s: %w", id, err)
+		}
+		if len(pending) == 0 {
+			nm.logger.Info("node drained", "node_id", id)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			if last, err := nm.inFlight(ctx, id); err == nil {
+				if len(last) == 0 {
+					return nil
+				}
+				pending = last
+			}
+			return &DrainTimeoutError{NodeID: id, Timeout: timeout, Pending: pending}
+		case <-ticker.C:
+		}
+	}
+}
+
 // AddWatcher registers a node lifecycle event listener.
 func (nm *NodeManager) AddWatcher(w NodeWatcher) {
 	nm.mu.Lock()
@@ -179,7 +261,39 @@ func (nm *NodeManager) Summary(ctx context.Context) (*FleetSummary, error) {
 	if err != nil {
 		return nil, err
 	}
+	return summarize(nodes), nil
+}
+
+// NoLabelGroup is the SummaryBy bucket for nodes without the label.
+const NoLabelGroup = "(none)"
+
+// SummaryBy returns a status overview per value of the given label, e.g.
+// one summary for env=prod and one for env=staging. Nodes without the
+// label are counted under NoLabelGroup.
+func (nm *NodeManager) SummaryBy(ctx context.Context, labelKey string) (map[string]*FleetSummary, error) {
+	nodes, err := nm.store.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]*Node)
+	for _, n := range nodes {
+		value, ok := n.Labels[labelKey]
+		if !ok {
+			value = NoLabelGroup
+		}
+		groups[value] = append(groups[value], n)
+	}
+
+	summaries := make(map[string]*FleetSummary, len(groups))
+	for value, members := range groups {
+		summaries[value] = summarize(members)
+	}
+	return summaries, nil
+}
 
+// summarize counts nodes by status and group.
+func summarize(nodes []*Node) *FleetSummary {
 	summary := &FleetSummary{
 		TotalNodes:  len(nodes),
 		GroupCounts: make(map[GroupName]int),
@@ -203,7 +317,7 @@ func (nm *NodeManager) Summary(ctx context.Context) (*FleetSummary, error) {
 		}
 	}
 
-	return summary, nil
+	return summary
 }
 
 // FleetSummary is a quick status of the entire fleet.
@@ -0,0 +1,86 @@
+package fleet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// OutputGroup is a set of nodes whose command produced identical output.
+type OutputGroup struct {
+	Hash   string   `json:"hash"` // hex SHA-256 of Output
+	Output string   `json:"output"`
+	Nodes  []NodeID `json:"nodes"`
+}
+
+// ShortHash is the abbreviated hash shown to users.
+func (g OutputGroup) ShortHash() string {
+	if len(g.Hash) > 12 {
+		return g.Hash[:12]
+	}
+	return g.Hash
+}
+
+// GroupOutputs buckets successful node results by output content. Groups
+// are ordered most common first (ties by first node ID), so the first
+// group is the natural baseline for drift comparison. Results that did not
+// succeed have no trustworthy output and are left out.
+func GroupOutputs(results []NodeResult) []OutputGroup {
+	byHash := make(map[string]*OutputGroup)
+	for _, nr := range results {
+		if nr.Status != "success" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(nr.Output))
+		hash := hex.EncodeToString(sum[:])
+		g, ok := byHash[hash]
+		if !ok {
+			g = &OutputGroup{Hash: hash, Output: nr.Output}
+			byHash[hash] = g
+		}
+		g.Nodes = append(g.Nodes, nr.NodeID)
+	}
+
+	groups := make([]OutputGroup, 0, len(byHash))
+	for _, g := range byHash {
+		sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i] < g.Nodes[j] })
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Nodes) != len(groups[j].Nodes) {
+			return len(groups[i].Nodes) > len(groups[j].Nodes)
+		}
+		return groups[i].Nodes[0] < groups[j].Nodes[0]
+	})
+	return groups
+}
+
+// DiffOutputs returns a unified diff from base's output to g's, labelled
+// with each group's short hash.
+func DiffOutputs(base, g OutputGroup) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(base.Output),
+		B:        diffLines(g.Output),
+		FromFile: base.ShortHash(),
+		ToFile:   g.ShortHash(),
+		Context:  3,
+	})
+	return diff
+}
+
+// diffLines splits s into newline-terminated lines without the phantom
+// empty line a trailing newline would otherwise produce.
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
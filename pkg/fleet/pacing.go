@@ -0,0 +1,80 @@
+package fleet
+
+import (
+	"context"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// SetGroupRateLimits paces dispatch per node group: a node starts only
+// once the limiter for each of its groups, keyed by group name, has a
+// token. The limiters are shared by every request the executor runs, so
+// concurrent requests to a group are paced together.
+func (e *Executor) SetGroupRateLimits(limits *resilience.RateLimiterRegistry) {
+	e.groupLimits = limits
+}
+
+// SetDispatchWaitObserver registers fn to be called each time a node's
+// dispatch was held back by a rate limit, with the limit's key ("request"
+// or "group:<name>") and how long the node waited. fn must be fast;
+// observability.DevOpsClawMetrics.ObserveDispatchWait fits.
+func (e *Executor) SetDispatchWaitObserver(fn func(key string, wait time.Duration)) {
+	e.dispatchObserver = fn
+}
+
+// dispatchPacer holds the rate limits that gate one request's dispatch.
+// A nil pacer dispatches immediately.
+type dispatchPacer struct {
+	request *resilience.RateLimiter         // ExecRequest.DispatchRate, if set
+	groups  *resilience.RateLimiterRegistry // the executor's group limits, if set
+	observe func(key string, wait time.Duration)
+}
+
+// pacer returns the pacer for req, or nil when nothing limits it. Dry runs
+// dispatch nothing and are never paced.
+func (e *Executor) pacer(req *ExecRequest) *dispatchPacer {
+	if req.DryRun || (req.DispatchRate <= 0 && e.groupLimits == nil) {
+		return nil
+	}
+	p := &dispatchPacer{groups: e.groupLimits, observe: e.dispatchObserver}
+	if req.DispatchRate > 0 {
+		p.request = resilience.NewRateLimiter(req.DispatchRate, 1)
+	}
+	return p
+}
+
+// wait blocks until node may be dispatched: the request's limit and then
+// each of the node's group limits must allow it. It gates only the start
+// of the command, not its completion. It returns ctx's error if the
+// request ends first.
+func (p *dispatchPacer) wait(ctx context.Context, node *Node) error {
+	if p == nil {
+		return nil
+	}
+	if p.request != nil {
+		if err := p.take(ctx, "request", p.request); err != nil {
+			return err
+		}
+	}
+	if p.groups != nil {
+		for _, g := range node.Groups {
+			if err := p.take(ctx, "group:"+string(g), p.groups.Get(string(g))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *dispatchPacer) take(ctx context.Context, key string, rl *resilience.RateLimiter) error {
+	if rl.Allow() {
+		return nil
+	}
+	start := time.Now()
+	err := rl.Wait(ctx)
+	if p.observe != nil {
+		p.observe(key, time.Since(start))
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// stampingRelay records when each node was asked to run a command.
+type stampingRelay struct {
+	mu     sync.Mutex
+	starts map[NodeID]time.Time
+}
+
+func (r *stampingRelay) Execute(ctx context.Context, node *Node, cmd TypedCommand) (*NodeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.starts == nil {
+		r.starts = make(map[NodeID]time.Time)
+	}
+	r.starts[node.ID] = time.Now()
+	return &NodeResult{NodeID: node.ID}, nil
+}
+
+func (r *stampingRelay) Ping(ctx context.Context, node *Node) error { return nil }
+
+// sortedStarts returns the dispatch times of ids, earliest first.
+func (r *stampingRelay) sortedStarts(ids ...NodeID) []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ts []time.Time
+	for _, id := range ids {
+		if t, ok := r.starts[id]; ok {
+			ts = append(ts, t)
+		}
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+	return ts
+}
+
+// checkSpacing fails unless starts are spaced for rate per second.
+func checkSpacing(t *testing.T, name string, starts []time.Time, rate float64) {
+	t.Helper()
+	interval := time.Duration(float64(time.Second) / rate)
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < interval/2 {
+			t.Errorf("%s: dispatch %d came %v after the previous, want about %v", name, i, gap, interval)
+		}
+	}
+	if span, want := starts[len(starts)-1].Sub(starts[0]), time.Duration(len(starts)-1)*interval*9/10; span < want {
+		t.Errorf("%s: %d dispatches spanned %v, want at least %v", name, len(starts), span, want)
+	}
+}
+
+func TestExecutor_DispatchRate(t *testing.T) {
+	relay := &stampingRelay{}
+	executor := batchTestExecutor(t, relay, 6)
+	var mu sync.Mutex
+	waits := map[string]int{}
+	executor.SetDispatchWaitObserver(func(key string, wait time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits[key]++
+	})
+
+	req := batchRequest("exec-paced", nil)
+	req.DispatchRate = 20
+	result, err := executor.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Success != 6 {
+		t.Fatalf("summary = %+v, want 6 successes", result.Summary)
+	}
+
+	starts := relay.sortedStarts("node-1", "node-2", "node-3", "node-4", "node-5", "node-6")
+	if len(starts) != 6 {
+		t.Fatalf("got %d dispatches, want 6", len(starts))
+	}
+	checkSpacing(t, "request", starts, 20)
+	// The first node goes at once; the other five wait their turn.
+	if waits["request"] != 5 {
+		t.Errorf("observed %d waits, want 5: %v", waits["request"], waits)
+	}
+}
+
+func TestExecutor_GroupRateLimits(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	var db, web []NodeID
+	for i := 1; i <= 3; i++ {
+		d, w := NodeID(fmt.Sprintf("db-%d", i)), NodeID(fmt.Sprintf("web-%d", i))
+		store.RegisterNode(ctx, &Node{ID: d, Hostname: string(d), Status: NodeStatusOnline, Groups: []GroupName{"db"}})
+		store.RegisterNode(ctx, &Node{ID: w, Hostname: string(w), Status: NodeStatusOnline, Groups: []GroupName{"web"}})
+		db, web = append(db, d), append(web, w)
+	}
+	relay := &stampingRelay{}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	executor.SetGroupRateLimits(resilience.NewRateLimiterRegistry(10, 1))
+
+	result, err := executor.Execute(ctx, batchRequest("exec-groups", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Success != 6 {
+		t.Fatalf("summary = %+v, want 6 successes", result.Summary)
+	}
+
+	dbStarts, webStarts := relay.sortedStarts(db...), relay.sortedStarts(web...)
+	checkSpacing(t, "db", dbStarts, 10)
+	checkSpacing(t, "web", webStarts, 10)
+	// Each group has its own budget, so they are paced side by side.
+	if !webStarts[0].Before(dbStarts[2]) || !dbStarts[0].Before(webStarts[2]) {
+		t.Errorf("groups were paced one after the other: db %v, web %v", dbStarts, webStarts)
+	}
+}
+
+func TestExecutor_DispatchRateSkipsDryRun(t *testing.T) {
+	relay := &stampingRelay{}
+	executor := batchTestExecutor(t, relay, 4)
+	executor.SetGroupRateLimits(resilience.NewRateLimiterRegistry(1, 1))
+
+	req := batchRequest("exec-dry-paced", nil)
+	req.DispatchRate = 1
+	req.DryRun = true
+	start := time.Now()
+	result, err := executor.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("dry run took %v; it should not be paced", elapsed)
+	}
+	if result.Summary.Skipped != 4 {
+		t.Errorf("summary = %+v, want 4 skipped", result.Summary)
+	}
+}
+
+func TestExecRequest_ValidateDispatchRate(t *testing.T) {
+	req := batchRequest("exec-rate", nil)
+	req.DispatchRate = -1
+	if err := req.Validate(); err == nil {
+		t.Error("expected an error for a negative dispatch rate")
+	}
+}
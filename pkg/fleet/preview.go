@@ -0,0 +1,126 @@
+package fleet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validSudoUser matches a user or group name, or a #uid.
+var validSudoUser = regexp.MustCompile(`^(#[0-9]+|[A-Za-z_][A-Za-z0-9_.-]*\$?)$`)
+
+// validEnvName matches the environment variable names passed through env.
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Argv returns the argv that runs sc with shell. With sc.Sudo it is
+//
+//	sudo -n -u <user> -- env K=V... <shell> -c <command>
+//
+// so sudo fails rather than prompts, and sc.Env survives sudo's
+// environment reset. Without sudo, sc.Env is set in the process
+// environment instead. It fails for a user or variable name that could be
+// read as an option.
+func (sc ShellCommand) Argv(shell string) ([]string, error) {
+	if !sc.Sudo {
+		return []string{shell, "-c", sc.Command}, nil
+	}
+	user := sc.SudoUser
+	if user == "" {
+		user = "root"
+	}
+	if !validSudoUser.MatchString(user) {
+		return nil, fmt.Errorf("invalid sudo_user")
+	}
+	argv := []string{"sudo", "-n", "-u", user, "--"}
+	if len(sc.Env) > 0 {
+		keys := make([]string, 0, len(sc.Env))
+		for k := range sc.Env {
+			if !validEnvName.MatchString(k) {
+				return nil, fmt.Errorf("invalid env name under sudo")
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		argv = append(argv, "env")
+		for _, k := range keys {
+			argv = append(argv, k+"="+sc.Env[k])
+		}
+	}
+	return append(argv, shell, "-c", sc.Command), nil
+}
+
+// Preview returns the command a node would run for c, as a shell command
+// line: for a shell command the full argv, with sudo and env wrapping and
+// any working directory; for a script the interpreter followed by the
+// script; for other types the type and its parameters.
+func (c TypedCommand) Preview() (string, error) {
+	switch c.Type {
+	case "shell":
+		var sc ShellCommand
+		if err := json.Unmarshal(c.Data, &sc); err != nil {
+			return "", fmt.Errorf("decode shell command: %w", err)
+		}
+		shell := sc.Shell
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		argv, err := sc.Argv(shell)
+		if err != nil {
+			return "", err
+		}
+		var parts []string
+		if sc.WorkDir != "" {
+			parts = append(parts, "cd", shellQuote(sc.WorkDir), "&&")
+		}
+		if !sc.Sudo {
+			keys := make([]string, 0, len(sc.Env))
+			for k := range sc.Env {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				parts = append(parts, k+"="+shellQuote(sc.Env[k]))
+			}
+		}
+		for _, arg := range argv {
+			parts = append(parts, shellQuote(arg))
+		}
+		return strings.Join(parts, " "), nil
+
+	case "script":
+		var sc ScriptCommand
+		if err := json.Unmarshal(c.Data, &sc); err != nil {
+			return "", fmt.Errorf("decode script command: %w", err)
+		}
+		script, err := sc.Script()
+		if err != nil {
+			return "", err
+		}
+		interpreter := sc.Interpreter
+		if interpreter == "" {
+			interpreter = "/bin/sh"
+		}
+		return fmt.Sprintf("%s <script, %d bytes>\n%s", interpreter, len(script), strings.TrimRight(string(script), "\n")), nil
+	}
+
+	var data bytes.Buffer
+	if err := json.Compact(&data, c.Data); err != nil {
+		data.Reset()
+		data.Write(c.Data)
+	}
+	return strings.TrimSpace(c.Type + " " + data.String()), nil
+}
+
+// shellQuote quotes s for a POSIX shell when it contains anything but
+// characters that are safe unquoted.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%_+=:,./-", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,106 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shellTyped(t *testing.T, sc ShellCommand) TypedCommand {
+	t.Helper()
+	data, err := json.Marshal(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TypedCommand{Type: "shell", Data: data}
+}
+
+func TestTypedCommand_Preview(t *testing.T) {
+	script, err := NewScriptCommand([]byte("#!/bin/bash\nset -e\napt-get update\n"), "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		cmd  TypedCommand
+		want string
+	}{
+		{"plain", shellTyped(t, ShellCommand{Command: "uptime"}), "/bin/sh -c uptime"},
+		{"quoted", shellTyped(t, ShellCommand{Command: "echo 'hi' | wc -c"}), `/bin/sh -c 'echo '\''hi'\'' | wc -c'`},
+		{"env and workdir", shellTyped(t, ShellCommand{Command: "./deploy.sh", WorkDir: "/srv/app", Env: map[string]string{"VERSION": "v2", "APP": "web app"}, Shell: "/bin/bash"}),
+			"cd /srv/app && APP='web app' VERSION=v2 /bin/bash -c ./deploy.sh"},
+		{"sudo", shellTyped(t, ShellCommand{Command: "systemctl restart nginx", Sudo: true, SudoUser: "deploy", Env: map[string]string{"A": "1"}}),
+			"sudo -n -u deploy -- env A=1 /bin/sh -c 'systemctl restart nginx'"},
+		{"script", script, "bash <script, 34 bytes>\n#!/bin/bash\nset -e\napt-get update"},
+		{"other", TypedCommand{Type: "deploy", Data: json.RawMessage(`{"service": "api", "version": "v3"}`)}, `deploy {"service":"api","version":"v3"}`},
+	}
+	for _, tt := range tests {
+		got, err := tt.cmd.Preview()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: preview =\n  %s\nwant\n  %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := shellTyped(t, ShellCommand{Command: "id", Sudo: true, SudoUser: "-s"}).Preview(); err == nil {
+		t.Error("expected an error for an invalid sudo user")
+	}
+}
+
+func TestExecutor_DryRunPreview(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, n := range testRoster() {
+		store.RegisterNode(ctx, n)
+	}
+	relay := &countingRelay{}
+	executor := NewExecutor(store, relay, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	result, err := executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-dry",
+		Command: shellTyped(t, ShellCommand{Command: "rm -rf /var/cache/app", Sudo: true}),
+		Target:  TargetSelector{Groups: []GroupName{"web"}},
+		Timeout: 5 * time.Second,
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(relay.runs) != 0 {
+		t.Errorf("dry run sent commands to the relay: %v", relay.runs)
+	}
+	if result.Summary.Total != 2 || result.Summary.Skipped != 2 || result.Summary.Failed != 0 {
+		t.Errorf("summary = %+v", result.Summary)
+	}
+	want := "sudo -n -u root -- /bin/sh -c 'rm -rf /var/cache/app'"
+	for _, nr := range result.NodeResults {
+		if nr.Status != "dry-run" || nr.Output != want || nr.Hostname == "" {
+			t.Errorf("%s: %+v, want status dry-run and output %q", nr.NodeID, nr, want)
+		}
+	}
+
+	// A command the node would refuse is reported without failing the run.
+	result, err = executor.Execute(ctx, &ExecRequest{
+		ID:      "exec-dry-bad",
+		Command: shellTyped(t, ShellCommand{Command: "id", Sudo: true, SudoUser: "-s"}),
+		Target:  TargetSelector{NodeIDs: []NodeID{"node-1"}},
+		Timeout: 5 * time.Second,
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nr := result.NodeResults[0]; nr.Status != "dry-run" || !strings.Contains(nr.Error, "invalid sudo_user") {
+		t.Errorf("invalid command preview = %+v", nr)
+	}
+	if len(relay.runs) != 0 {
+		t.Errorf("dry run sent commands to the relay: %v", relay.runs)
+	}
+}
@@ -0,0 +1,32 @@
+package fleet
+
+import _ "embed"
+
+// ExecResultSchemaVersion is the version of the JSON contract for ExecResult
+// as emitted by `run --json` and `fleet exec --json`.
+//
+// Stability contract: within a major version, fields are only added, never
+// removed, renamed, or retyped, and the minor version is bumped when they
+// are. Any breaking change bumps the major version. Consumers should ignore
+// unknown fields and reject majors they do not understand.
+const ExecResultSchemaVersion = "1.8"
+
+//go:embed exec_result.schema.json
+var execResultSchema []byte
+
+// ExecResultSchema returns the JSON Schema describing VersionedExecResult.
+func ExecResultSchema() []byte {
+	return execResultSchema
+}
+
+// VersionedExecResult is the JSON envelope for ExecResult output. The
+// embedded result's fields are inlined next to schema_version.
+type VersionedExecResult struct {
+	SchemaVersion string `json:"schema_version"`
+	*ExecResult
+}
+
+// NewVersionedExecResult wraps result with the current schema version.
+func NewVersionedExecResult(result *ExecResult) VersionedExecResult {
+	return VersionedExecResult{SchemaVersion: ExecResultSchemaVersion, ExecResult: result}
+}
@@ -0,0 +1,217 @@
+package fleet
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jsonSchema is the subset of JSON Schema used by exec_result.schema.json.
+type jsonSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       any                    `json:"type"`
+	Format     string                 `json:"format"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Defs       map[string]*jsonSchema `json:"$defs"`
+}
+
+func (s *jsonSchema) types() []string {
+	switch v := s.Type.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, t := range v {
+			out = append(out, t.(string))
+		}
+		return out
+	}
+	return nil
+}
+
+func (s *jsonSchema) hasType(t string) bool {
+	for _, have := range s.types() {
+		if have == t {
+			return true
+		}
+	}
+	return false
+}
+
+func loadExecResultSchema(t *testing.T) *jsonSchema {
+	t.Helper()
+	var root jsonSchema
+	if err := json.Unmarshal(ExecResultSchema(), &root); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	return &root
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// checkSchemaMatches asserts that schema describes typ exactly: the same
+// property names, compatible types, and required fields for every field
+// not tagged omitempty.
+func checkSchemaMatches(t *testing.T, root, schema *jsonSchema, typ reflect.Type, path string) {
+	t.Helper()
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		def, ok := root.Defs[name]
+		if !ok {
+			t.Errorf("%s: unresolved $ref %q", path, schema.Ref)
+			return
+		}
+		schema = def
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ == timeType:
+		if !schema.hasType("string") || schema.Format != "date-time" {
+			t.Errorf("%s: time.Time should be a date-time string, schema has type %v format %q", path, schema.Type, schema.Format)
+		}
+		return
+	case typ == durationType:
+		if !schema.hasType("integer") {
+			t.Errorf("%s: time.Duration should be an integer, schema has %v", path, schema.Type)
+		}
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		if !schema.hasType("string") {
+			t.Errorf("%s: want string, schema has %v", path, schema.Type)
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if !schema.hasType("integer") {
+			t.Errorf("%s: want integer, schema has %v", path, schema.Type)
+		}
+	case reflect.Bool:
+		if !schema.hasType("boolean") {
+			t.Errorf("%s: want boolean, schema has %v", path, schema.Type)
+		}
+	case reflect.Slice:
+		if !schema.hasType("array") || schema.Items == nil {
+			t.Errorf("%s: want array with items, schema has %v", path, schema.Type)
+			return
+		}
+		checkSchemaMatches(t, root, schema.Items, typ.Elem(), path+"[]")
+	case reflect.Struct:
+		if !schema.hasType("object") {
+			t.Errorf("%s: want object, schema has %v", path, schema.Type)
+			return
+		}
+		fields := map[string]reflect.StructField{}
+		var required []string
+		collectJSONFields(typ, fields, &required)
+
+		for name, f := range fields {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				t.Errorf("%s.%s: field missing from schema", path, name)
+				continue
+			}
+			checkSchemaMatches(t, root, prop, f.Type, path+"."+name)
+		}
+		for name := range schema.Properties {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("%s.%s: schema property has no matching struct field", path, name)
+			}
+		}
+
+		sort.Strings(required)
+		gotRequired := append([]string(nil), schema.Required...)
+		sort.Strings(gotRequired)
+		if !reflect.DeepEqual(required, gotRequired) {
+			t.Errorf("%s: required = %v, want %v (fields without omitempty)", path, gotRequired, required)
+		}
+	default:
+		t.Errorf("%s: unhandled kind %s", path, typ.Kind())
+	}
+}
+
+// collectJSONFields gathers the JSON-visible fields of typ, inlining
+// embedded structs the way encoding/json does.
+func collectJSONFields(typ reflect.Type, fields map[string]reflect.StructField, required *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			collectJSONFields(embedded, fields, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func TestExecResultSchema_MatchesStruct(t *testing.T) {
+	root := loadExecResultSchema(t)
+	checkSchemaMatches(t, root, root, reflect.TypeOf(VersionedExecResult{}), "$")
+}
+
+func TestExecResultSchema_VersionFormat(t *testing.T) {
+	if !regexp.MustCompile(`^[0-9]+\.[0-9]+$`).MatchString(ExecResultSchemaVersion) {
+		t.Errorf("ExecResultSchemaVersion = %q, want major.minor", ExecResultSchemaVersion)
+	}
+	if !strings.Contains(loadExecResultSchemaID(t), "/exec-result/"+strings.Split(ExecResultSchemaVersion, ".")[0]+".json") {
+		t.Error("schema $id should name the current major version")
+	}
+}
+
+func loadExecResultSchemaID(t *testing.T) string {
+	t.Helper()
+	var doc struct {
+		ID string `json:"$id"`
+	}
+	if err := json.Unmarshal(ExecResultSchema(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.ID
+}
+
+func TestVersionedExecResult_InlinesFields(t *testing.T) {
+	data, err := json.Marshal(NewVersionedExecResult(&ExecResult{RequestID: "req-1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["schema_version"] != ExecResultSchemaVersion {
+		t.Errorf("schema_version = %v", decoded["schema_version"])
+	}
+	if decoded["request_id"] != "req-1" {
+		t.Errorf("result fields should be inlined, got %v", decoded)
+	}
+}
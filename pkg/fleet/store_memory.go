@@ -3,6 +3,7 @@ package fleet
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,6 +14,9 @@ type MemoryStore struct {
 	mu         sync.RWMutex
 	nodes      map[NodeID]*Node
 	executions map[string]*executionRecord
+	idempotent map[idempotentKey]idempotentRecord
+	locks      map[string]*memoryLock
+	events     nodeEventHub
 }
 
 type executionRecord struct {
@@ -20,11 +24,23 @@ type executionRecord struct {
 	Result  *ExecResult
 }
 
+type idempotentKey struct {
+	key  string
+	node NodeID
+}
+
+type idempotentRecord struct {
+	result  NodeResult
+	savedAt time.Time
+}
+
 // NewMemoryStore creates an in-memory fleet store.
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		nodes:      make(map[NodeID]*Node),
 		executions: make(map[string]*executionRecord),
+		idempotent: make(map[idempotentKey]idempotentRecord),
+		locks:      make(map[string]*memoryLock),
 	}
 }
 
@@ -32,6 +48,7 @@ func (s *MemoryStore) RegisterNode(_ context.Context, node *Node) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.nodes[node.ID] = node
+	s.events.publish(NodeChangeRegistered, node.ID, node)
 	return nil
 }
 
@@ -39,9 +56,10 @@ func (s *MemoryStore) DeregisterNode(_ context.Context, id NodeID) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.nodes[id]; !ok {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
 	delete(s.nodes, id)
+	s.events.publish(NodeChangeDeregistered, id, nil)
 	return nil
 }
 
@@ -50,9 +68,13 @@ func (s *MemoryStore) UpdateNodeStatus(_ context.Context, id NodeID, status Node
 	defer s.mu.Unlock()
 	n, ok := s.nodes[id]
 	if !ok {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
+	}
+	if n.Status == status {
+		return nil
 	}
 	n.Status = status
+	s.events.publish(NodeChangeStatus, id, n)
 	return nil
 }
 
@@ -61,7 +83,7 @@ func (s *MemoryStore) UpdateNodeHeartbeat(_ context.Context, id NodeID, resource
 	defer s.mu.Unlock()
 	n, ok := s.nodes[id]
 	if !ok {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
 	n.LastSeen = time.Now()
 	n.Resources = resources
@@ -73,7 +95,7 @@ func (s *MemoryStore) GetNode(_ context.Context, id NodeID) (*Node, error) {
 	defer s.mu.RUnlock()
 	n, ok := s.nodes[id]
 	if !ok {
-		return nil, fmt.Errorf("node %s not found", id)
+		return nil, nodeNotFound(id)
 	}
 	return n, nil
 }
@@ -115,6 +137,11 @@ func (s *MemoryStore) ListNodesByLabels(_ context.Context, labels map[string]str
 	return out, nil
 }
 
+// Watch streams node events from this store to an in-process subscriber.
+func (s *MemoryStore) Watch(ctx context.Context) (<-chan NodeEvent, error) {
+	return s.events.subscribe(ctx), nil
+}
+
 func (s *MemoryStore) RecordExecution(_ context.Context, req *ExecRequest, result *ExecResult) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -155,14 +182,120 @@ func (s *MemoryStore) ListExecutions(_ context.Context, opts ListExecOptions) ([
 	return out, nil
 }
 
+func (s *MemoryStore) ListExecutionsAfter(_ context.Context, opts ListExecOptions, cursor string) ([]*ExecRequest, string, error) {
+	after, hasCursor, err := decodeExecCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	var out []*ExecRequest
+	for _, rec := range s.executions {
+		req := rec.Request
+		if opts.Requester != "" && req.Requester != opts.Requester {
+			continue
+		}
+		if !opts.Since.IsZero() && req.CreatedAt.Before(opts.Since) {
+			continue
+		}
+		if hasCursor && !after.execBefore(req.CreatedAt, req.ID) {
+			continue
+		}
+		out = append(out, req)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	limit := execPageSize(opts)
+	if len(out) <= limit {
+		return out, "", nil
+	}
+	out = out[:limit]
+	last := out[limit-1]
+	return out, encodeExecCursor(last.CreatedAt, last.ID), nil
+}
+
+func (s *MemoryStore) ListExecutionsByNode(_ context.Context, node NodeID, limit int) ([]NodeExecution, error) {
+	s.mu.RLock()
+	var out []NodeExecution
+	for _, rec := range s.executions {
+		if ne, ok := nodeExecution(rec.Request, rec.Result, node); ok {
+			out = append(out, ne)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Request, out[j].Request
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	if limit = nodeHistoryLimit(limit); len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) GetIdempotentResult(_ context.Context, key string, node NodeID, since time.Time) (*NodeResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.idempotent[idempotentKey{key, node}]
+	if !ok || rec.savedAt.Before(since) {
+		return nil, nil
+	}
+	result := rec.result
+	return &result, nil
+}
+
+func (s *MemoryStore) SaveIdempotentResult(_ context.Context, key string, node NodeID, result *NodeResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotent[idempotentKey{key, node}] = idempotentRecord{result: *result, savedAt: time.Now()}
+	return nil
+}
+
+// AcquireLock takes key until ttl passes or the lock is released. The lock
+// only excludes holders in this process.
 func (s *MemoryStore) AcquireLock(_ context.Context, key string, ttl time.Duration) (Lock, error) {
-	// Simple in-memory lock — not suitable for multi-process use.
-	return &memoryLock{key: key}, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if existing, ok := s.locks[key]; ok && existing.expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: %s until %s", ErrLockHeld, key, existing.expiresAt.Format(time.RFC3339))
+	}
+	lock := &memoryLock{store: s, key: key, expiresAt: now.Add(ttl)}
+	s.locks[key] = lock
+	return lock, nil
 }
 
 type memoryLock struct {
-	key string
+	store     *MemoryStore
+	key       string
+	expiresAt time.Time
 }
 
-func (l *memoryLock) Unlock(_ context.Context) error   { return nil }
-func (l *memoryLock) Extend(_ context.Context, _ time.Duration) error { return nil }
+func (l *memoryLock) Unlock(_ context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.locks[l.key] == l {
+		delete(l.store.locks, l.key)
+	}
+	return nil
+}
+
+func (l *memoryLock) Extend(_ context.Context, ttl time.Duration) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.locks[l.key] != l {
+		return fmt.Errorf("extend lock %s: %w", l.key, ErrLockLost)
+	}
+	l.expiresAt = time.Now().Add(ttl)
+	return nil
+}
@@ -17,13 +17,14 @@ import (
 	"sync"
 	"time"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 // PostgresStore implements the fleet Store interface with PostgreSQL.
 type PostgresStore struct {
-	db *sql.DB
-	mu sync.RWMutex
+	db  *sql.DB
+	dsn string // for the LISTEN connections opened by Watch
+	mu  sync.RWMutex
 }
 
 // PostgresConfig holds connection parameters for PostgreSQL.
@@ -70,7 +71,7 @@ func NewPostgresStore(cfg PostgresConfig) (*PostgresStore, error) {
 		return nil, fmt.Errorf("ping postgres: %w", err)
 	}
 
-	store := &PostgresStore{db: db}
+	store := &PostgresStore{db: db, dsn: cfg.DSN()}
 	if err := store.migrate(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("migrate: %w", err)
@@ -112,6 +113,13 @@ func (s *PostgresStore) migrate() error {
 			holder TEXT NOT NULL,
 			expires_at TIMESTAMPTZ NOT NULL
 		)`,
+		`CREATE TABLE IF NOT EXISTS fleet_idempotency (
+			key TEXT NOT NULL,
+			node_id TEXT NOT NULL,
+			result JSONB NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (key, node_id)
+		)`,
 	}
 
 	for _, m := range migrations {
@@ -148,8 +156,11 @@ func (s *PostgresStore) RegisterNode(ctx context.Context, node *Node) error {
 	`, node.ID, node.Hostname, node.Address, string(labelsJSON), string(groupsJSON),
 		string(node.Status), string(capsJSON), string(resJSON),
 		node.LastSeen.UTC(), node.RegisteredAt.UTC(), node.Version, node.TunnelID)
-
-	return err
+	if err != nil {
+		return err
+	}
+	s.notify(ctx, NodeChangeRegistered, node.ID)
+	return nil
 }
 
 func (s *PostgresStore) DeregisterNode(ctx context.Context, id NodeID) error {
@@ -159,19 +170,28 @@ func (s *PostgresStore) DeregisterNode(ctx context.Context, id NodeID) error {
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
+	s.notify(ctx, NodeChangeDeregistered, id)
 	return nil
 }
 
 func (s *PostgresStore) UpdateNodeStatus(ctx context.Context, id NodeID, status NodeStatus) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE fleet_nodes SET status = $1 WHERE id = $2", string(status), string(id))
+	// The CTE reads the status being replaced, so only changes are notified.
+	var prev string
+	err := s.db.QueryRowContext(ctx, `
+		WITH prev AS (SELECT status FROM fleet_nodes WHERE id = $2 FOR UPDATE)
+		UPDATE fleet_nodes SET status = $1 FROM prev WHERE fleet_nodes.id = $2
+		RETURNING prev.status
+	`, string(status), string(id)).Scan(&prev)
+	if err == sql.ErrNoRows {
+		return nodeNotFound(id)
+	}
 	if err != nil {
 		return err
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+	if NodeStatus(prev) != status {
+		s.notify(ctx, NodeChangeStatus, id)
 	}
 	return nil
 }
@@ -185,7 +205,7 @@ func (s *PostgresStore) UpdateNodeHeartbeat(ctx context.Context, id NodeID, reso
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
 	return nil
 }
@@ -233,6 +253,65 @@ func (s *PostgresStore) ListNodesByLabels(ctx context.Context, labels map[string
 	return pgScanNodes(rows)
 }
 
+// ------------------------------------------------------------------
+// Node events (LISTEN/NOTIFY)
+// ------------------------------------------------------------------
+
+// pgNodeEventsChannel is the NOTIFY channel node changes are published on,
+// so every relay sharing the database sees every instance's writes.
+const pgNodeEventsChannel = "devopsclaw_fleet_nodes"
+
+// notify publishes a node change. The payload carries only the type and
+// node ID, well under NOTIFY's 8000-byte limit; watchers load the node.
+// A failed NOTIFY is not returned, since the write itself has succeeded.
+func (s *PostgresStore) notify(ctx context.Context, typ NodeChangeType, id NodeID) {
+	payload, _ := json.Marshal(NodeEvent{Type: typ, NodeID: id, Timestamp: time.Now().UTC()})
+	_, _ = s.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", pgNodeEventsChannel, string(payload))
+}
+
+// Watch opens a LISTEN connection and streams node events from every
+// writer to the database, until ctx is done. Events sent while the
+// connection is down and reconnecting are missed.
+func (s *PostgresStore) Watch(ctx context.Context) (<-chan NodeEvent, error) {
+	listener := pq.NewListener(s.dsn, time.Second, time.Minute, nil)
+	if err := listener.Listen(pgNodeEventsChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen %s: %w", pgNodeEventsChannel, err)
+	}
+
+	out := make(chan NodeEvent, watchBuffer)
+	go func() {
+		defer close(out)
+		defer listener.Close()
+		for {
+			var n *pq.Notification
+			select {
+			case <-ctx.Done():
+				return
+			case n = <-listener.Notify:
+			}
+			if n == nil {
+				continue // sent after a reconnect
+			}
+			var ev NodeEvent
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				continue
+			}
+			if ev.Type != NodeChangeDeregistered {
+				if node, err := s.GetNode(ctx, ev.NodeID); err == nil {
+					ev.Node = node
+				}
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
 // ------------------------------------------------------------------
 // Execution audit
 // ------------------------------------------------------------------
@@ -316,6 +395,123 @@ func (s *PostgresStore) ListExecutions(ctx context.Context, opts ListExecOptions
 	return out, rows.Err()
 }
 
+// ListExecutionsByNode matches node with JSONB containment on the stored
+// results.
+func (s *PostgresStore) ListExecutionsByNode(ctx context.Context, node NodeID, limit int) ([]NodeExecution, error) {
+	match, _ := json.Marshal([]map[string]NodeID{{"node_id": node}})
+	rows, err := s.db.QueryContext(ctx, `SELECT request, result FROM fleet_executions
+		WHERE result->'node_results' @> $1::jsonb
+		ORDER BY created_at DESC, id DESC LIMIT $2`, string(match), nodeHistoryLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return scanNodeExecutions(rows, node)
+}
+
+func (s *PostgresStore) ListExecutionsAfter(ctx context.Context, opts ListExecOptions, cursor string) ([]*ExecRequest, string, error) {
+	after, hasCursor, err := decodeExecCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := execPageSize(opts)
+	query, args := pgExecPageQuery(opts, after, hasCursor, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var (
+		out     []*ExecRequest
+		lastAt  time.Time
+		lastID  string
+		hasMore bool
+	)
+	for rows.Next() {
+		if len(out) == limit {
+			hasMore = true
+			break
+		}
+		var reqJSON string
+		if err := rows.Scan(&reqJSON, &lastAt, &lastID); err != nil {
+			return nil, "", err
+		}
+		var req ExecRequest
+		if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
+			return nil, "", err
+		}
+		out = append(out, &req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if !hasMore {
+		return out, "", nil
+	}
+	return out, encodeExecCursor(lastAt, lastID), nil
+}
+
+// pgExecPageQuery builds the keyset page query for ListExecutionsAfter.
+// The row comparison walks idx_fleet_exec_created; one extra row is
+// fetched to detect whether another page follows.
+func pgExecPageQuery(opts ListExecOptions, after execCursor, hasCursor bool, limit int) (string, []any) {
+	query := "SELECT request, created_at, id FROM fleet_executions WHERE true"
+	var args []any
+	argIdx := 1
+
+	if opts.Requester != "" {
+		query += fmt.Sprintf(" AND requester = $%d", argIdx)
+		args = append(args, opts.Requester)
+		argIdx++
+	}
+	if !opts.Since.IsZero() {
+		query += fmt.Sprintf(" AND created_at >= $%d", argIdx)
+		args = append(args, opts.Since.UTC())
+		argIdx++
+	}
+	if hasCursor {
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", argIdx, argIdx+1)
+		args = append(args, after.CreatedAt.UTC(), after.ID)
+		argIdx += 2
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", argIdx)
+	args = append(args, limit+1)
+	return query, args
+}
+
+// ------------------------------------------------------------------
+// Idempotency cache
+// ------------------------------------------------------------------
+
+func (s *PostgresStore) GetIdempotentResult(ctx context.Context, key string, node NodeID, since time.Time) (*NodeResult, error) {
+	var resJSON string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT result FROM fleet_idempotency WHERE key = $1 AND node_id = $2 AND created_at >= $3`,
+		key, string(node), since.UTC()).Scan(&resJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result NodeResult
+	if err := json.Unmarshal([]byte(resJSON), &result); err != nil {
+		return nil, fmt.Errorf("unmarshal result: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *PostgresStore) SaveIdempotentResult(ctx context.Context, key string, node NodeID, result *NodeResult) error {
+	resJSON, _ := json.Marshal(result)
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fleet_idempotency (key, node_id, result, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key, node_id) DO UPDATE SET result = EXCLUDED.result, created_at = EXCLUDED.created_at`,
+		key, string(node), string(resJSON), time.Now().UTC())
+	return err
+}
+
 // ------------------------------------------------------------------
 // Distributed locking (PostgreSQL advisory locks)
 // ------------------------------------------------------------------
@@ -326,43 +522,51 @@ func (s *PostgresStore) AcquireLock(ctx context.Context, key string, ttl time.Du
 	s.db.ExecContext(ctx, "DELETE FROM fleet_locks WHERE expires_at < NOW()")
 
 	expiresAt := time.Now().Add(ttl)
+	holder := newLockHolder()
 
 	// Try to insert, fail if already held
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO fleet_locks (key, holder, expires_at) VALUES ($1, $2, $3)
 		ON CONFLICT(key) DO UPDATE SET holder=EXCLUDED.holder, expires_at=EXCLUDED.expires_at
 		WHERE fleet_locks.expires_at < NOW()`,
-		key, "self", expiresAt.UTC())
+		key, holder, expiresAt.UTC())
 	if err != nil {
 		return nil, fmt.Errorf("acquire lock %s: %w", key, err)
 	}
 
 	// Verify we actually hold the lock
-	var holder string
-	err = s.db.QueryRowContext(ctx, "SELECT holder FROM fleet_locks WHERE key = $1", key).Scan(&holder)
-	if err != nil || holder != "self" {
-		return nil, fmt.Errorf("failed to acquire lock %s: held by another instance", key)
+	var current string
+	err = s.db.QueryRowContext(ctx, "SELECT holder FROM fleet_locks WHERE key = $1", key).Scan(&current)
+	if err != nil || current != holder {
+		return nil, fmt.Errorf("%w: %s by another instance", ErrLockHeld, key)
 	}
 
-	return &pgLock{db: s.db, key: key, expiresAt: expiresAt}, nil
+	return &pgLock{db: s.db, key: key, holder: holder, expiresAt: expiresAt}, nil
 }
 
 type pgLock struct {
 	db        *sql.DB
 	key       string
+	holder    string
 	expiresAt time.Time
 }
 
 func (l *pgLock) Unlock(ctx context.Context) error {
-	_, err := l.db.ExecContext(ctx, "DELETE FROM fleet_locks WHERE key = $1 AND holder = 'self'", l.key)
+	_, err := l.db.ExecContext(ctx, "DELETE FROM fleet_locks WHERE key = $1 AND holder = $2", l.key, l.holder)
 	return err
 }
 
 func (l *pgLock) Extend(ctx context.Context, ttl time.Duration) error {
 	l.expiresAt = time.Now().Add(ttl)
-	_, err := l.db.ExecContext(ctx, "UPDATE fleet_locks SET expires_at = $1 WHERE key = $2 AND holder = 'self'",
-		l.expiresAt.UTC(), l.key)
-	return err
+	res, err := l.db.ExecContext(ctx, "UPDATE fleet_locks SET expires_at = $1 WHERE key = $2 AND holder = $3",
+		l.expiresAt.UTC(), l.key, l.holder)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("extend lock %s: %w", l.key, ErrLockLost)
+	}
+	return nil
 }
 
 // ------------------------------------------------------------------
@@ -378,7 +582,7 @@ func pgScanNode(row scanner) (*Node, error) {
 		&statusStr, &capsJSON, &resJSON, &lastSeen, &registeredAt, &n.Version, &n.TunnelID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("node not found")
+			return nil, ErrNodeNotFound
 		}
 		return nil, err
 	}
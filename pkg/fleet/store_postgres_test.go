@@ -0,0 +1,22 @@
+package fleet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPgExecPageQuery(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	query, args := pgExecPageQuery(ListExecOptions{Requester: "admin"}, execCursor{CreatedAt: at, ID: "exec-09"}, true, 10)
+
+	wantQuery := "SELECT request, created_at, id FROM fleet_executions WHERE true AND requester = $1" +
+		" AND (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4"
+	if query != wantQuery {
+		t.Errorf("query = %q, want %q", query, wantQuery)
+	}
+	wantArgs := []any{"admin", at, "exec-09", 11}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -21,15 +22,20 @@ import (
 // SQLiteStore implements the fleet Store interface with SQLite persistence.
 type SQLiteStore struct {
 	db *sql.DB
+	path string // database file, or ":memory:"
+	retention time.Duration // execution history kept by Maintain
 	mu sync.RWMutex // protects lock map for in-process distributed locking
 	locks map[string]*sqliteLock
+	events nodeEventHub
 }
 
 // NewSQLiteStore creates a new SQLite-backed fleet store.
 // The dbPath is the path to the SQLite database file (e.g., "/var/lib/devopsclaw/fleet.db").
 // Use ":memory:" for an in-memory database (testing).
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
+	// _pragma=busy_timeout is the modernc spelling; without it a second
+	// process writing the same file gets SQLITE_BUSY instead of waiting.
+	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite %s: %w", dbPath, err)
 	}
@@ -41,8 +47,10 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	}
 
 	store := &SQLiteStore{
-		db:    db,
-		locks: make(map[string]*sqliteLock),
+		db:        db,
+		path:      dbPath,
+		retention: DefaultExecutionRetention,
+		locks:     make(map[string]*sqliteLock),
 	}
 
 	if err := store.migrate(); err != nil {
@@ -85,6 +93,13 @@ func (s *SQLiteStore) migrate() error {
 			holder TEXT NOT NULL,
 			expires_at DATETIME NOT NULL
 		)`,
+		`CREATE TABLE IF NOT EXISTS idempotency (
+			key TEXT NOT NULL,
+			node_id TEXT NOT NULL,
+			result TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (key, node_id)
+		)`,
 	}
 
 	for _, m := range migrations {
@@ -121,8 +136,11 @@ func (s *SQLiteStore) RegisterNode(_ context.Context, node *Node) error {
 	`, node.ID, node.Hostname, node.Address, string(labelsJSON), string(groupsJSON),
 		string(node.Status), string(capsJSON), string(resJSON),
 		node.LastSeen.UTC(), node.RegisteredAt.UTC(), node.Version, node.TunnelID)
-
-	return err
+	if err != nil {
+		return err
+	}
+	s.events.publish(NodeChangeRegistered, node.ID, node)
+	return nil
 }
 
 func (s *SQLiteStore) DeregisterNode(_ context.Context, id NodeID) error {
@@ -132,19 +150,26 @@ func (s *SQLiteStore) DeregisterNode(_ context.Context, id NodeID) error {
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
+	s.events.publish(NodeChangeDeregistered, id, nil)
 	return nil
 }
 
-func (s *SQLiteStore) UpdateNodeStatus(_ context.Context, id NodeID, status NodeStatus) error {
-	res, err := s.db.Exec("UPDATE nodes SET status = ? WHERE id = ?", string(status), string(id))
+func (s *SQLiteStore) UpdateNodeStatus(ctx context.Context, id NodeID, status NodeStatus) error {
+	// Skip rows already in this status, so watchers only hear of changes.
+	res, err := s.db.Exec("UPDATE nodes SET status = ? WHERE id = ? AND status != ?", string(status), string(id), string(status))
 	if err != nil {
 		return err
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetNode(ctx, id); err != nil {
+			return nodeNotFound(id)
+		}
+		return nil
+	}
+	if node, err := s.GetNode(ctx, id); err == nil {
+		s.events.publish(NodeChangeStatus, id, node)
 	}
 	return nil
 }
@@ -158,7 +183,7 @@ func (s *SQLiteStore) UpdateNodeHeartbeat(_ context.Context, id NodeID, resource
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("node %s not found", id)
+		return nodeNotFound(id)
 	}
 	return nil
 }
@@ -226,6 +251,13 @@ func (s *SQLiteStore) ListNodesByLabels(_ context.Context, labels map[string]str
 	return filtered, nil
 }
 
+// Watch streams node events to an in-process subscriber. Only writes made
+// through this SQLiteStore are seen, which covers the single-process
+// deployments it is meant for.
+func (s *SQLiteStore) Watch(ctx context.Context) (<-chan NodeEvent, error) {
+	return s.events.subscribe(ctx), nil
+}
+
 // ------------------------------------------------------------------
 // Execution audit
 // ------------------------------------------------------------------
@@ -304,6 +336,174 @@ func (s *SQLiteStore) ListExecutions(_ context.Context, opts ListExecOptions) ([
 	return out, rows.Err()
 }
 
+// ListExecutionsByNode matches node against the node IDs in each stored
+// result with SQLite's JSON functions.
+func (s *SQLiteStore) ListExecutionsByNode(_ context.Context, node NodeID, limit int) ([]NodeExecution, error) {
+	rows, err := s.db.Query(`SELECT request, result FROM executions
+		WHERE EXISTS (SELECT 1 FROM json_each(executions.result, '$.node_results') WHERE json_extract(value, '$.node_id') = ?)
+		ORDER BY created_at DESC, id DESC LIMIT ?`, string(node), nodeHistoryLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return scanNodeExecutions(rows, node)
+}
+
+func (s *SQLiteStore) ListExecutionsAfter(_ context.Context, opts ListExecOptions, cursor string) ([]*ExecRequest, string, error) {
+	after, hasCursor, err := decodeExecCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := "SELECT request, created_at, id FROM executions WHERE 1=1"
+	var args []any
+
+	if opts.Requester != "" {
+		query += " AND requester = ?"
+		args = append(args, opts.Requester)
+	}
+	if !opts.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, opts.Since.UTC())
+	}
+	if hasCursor {
+		query += " AND (created_at, id) < (?, ?)"
+		args = append(args, after.CreatedAt.UTC(), after.ID)
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	limit := execPageSize(opts)
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var (
+		out     []*ExecRequest
+		lastAt  time.Time
+		lastID  string
+		hasMore bool
+	)
+	for rows.Next() {
+		if len(out) == limit {
+			hasMore = true
+			break
+		}
+		var reqJSON string
+		if err := rows.Scan(&reqJSON, &lastAt, &lastID); err != nil {
+			return nil, "", err
+		}
+		var req ExecRequest
+		if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
+			return nil, "", err
+		}
+		out = append(out, &req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if !hasMore {
+		return out, "", nil
+	}
+	return out, encodeExecCursor(lastAt, lastID), nil
+}
+
+// ------------------------------------------------------------------
+// Maintenance
+// ------------------------------------------------------------------
+
+// DefaultExecutionRetention is how much execution history Maintain keeps
+// unless SetRetention says otherwise.
+const DefaultExecutionRetention = 30 * 24 * time.Hour
+
+// MaintenanceReport is what one Maintain run did.
+type MaintenanceReport struct {
+	DeletedExecutions int64     `json:"deleted_executions"`
+	Cutoff            time.Time `json:"cutoff"`      // executions recorded before this were deleted
+	SizeBefore        int64     `json:"size_before"` // bytes in the database file and its WAL
+	SizeAfter         int64     `json:"size_after"`
+}
+
+// SetRetention sets how long Maintain keeps executions. Zero or less
+// keeps them all.
+func (s *SQLiteStore) SetRetention(d time.Duration) {
+	s.retention = d
+}
+
+// Maintain deletes executions older than the retention window, rebuilds
+// the database with VACUUM to give the freed pages back to the file
+// system, and checkpoints the WAL into the database, truncating it. A
+// long-running single-node deployment should run it periodically, since
+// neither the WAL nor the execution history otherwise stops growing.
+func (s *SQLiteStore) Maintain(ctx context.Context) (*MaintenanceReport, error) {
+	report := &MaintenanceReport{SizeBefore: s.diskSize()}
+
+	if s.retention > 0 {
+		report.Cutoff = time.Now().Add(-s.retention).UTC()
+		res, err := s.db.ExecContext(ctx, "DELETE FROM executions WHERE created_at < ?", report.Cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("delete old executions: %w", err)
+		}
+		report.DeletedExecutions, _ = res.RowsAffected()
+	}
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return nil, fmt.Errorf("vacuum: %w", err)
+	}
+	// VACUUM in WAL mode writes the rebuilt pages to the WAL; the file
+	// only shrinks once they are checkpointed back.
+	if _, err := s.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return nil, fmt.Errorf("wal checkpoint: %w", err)
+	}
+
+	report.SizeAfter = s.diskSize()
+	return report, nil
+}
+
+// diskSize returns the bytes used by the database file and its WAL; 0 for
+// an in-memory database.
+func (s *SQLiteStore) diskSize() int64 {
+	var size int64
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// ------------------------------------------------------------------
+// Idempotency cache
+// ------------------------------------------------------------------
+
+func (s *SQLiteStore) GetIdempotentResult(_ context.Context, key string, node NodeID, since time.Time) (*NodeResult, error) {
+	var resJSON string
+	err := s.db.QueryRow(`SELECT result FROM idempotency WHERE key = ? AND node_id = ? AND created_at >= ?`,
+		key, string(node), since.UTC()).Scan(&resJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result NodeResult
+	if err := json.Unmarshal([]byte(resJSON), &result); err != nil {
+		return nil, fmt.Errorf("unmarshal result: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteStore) SaveIdempotentResult(_ context.Context, key string, node NodeID, result *NodeResult) error {
+	resJSON, _ := json.Marshal(result)
+	_, err := s.db.Exec(`
+		INSERT INTO idempotency (key, node_id, result, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key, node_id) DO UPDATE SET result=excluded.result, created_at=excluded.created_at`,
+		key, string(node), string(resJSON), time.Now().UTC())
+	return err
+}
+
 // ------------------------------------------------------------------
 // Distributed locking (process-level for SQLite)
 // ------------------------------------------------------------------
@@ -316,7 +516,7 @@ func (s *SQLiteStore) AcquireLock(_ context.Context, key string, ttl time.Durati
 	now := time.Now()
 	if existing, ok := s.locks[key]; ok {
 		if existing.expiresAt.After(now) {
-			return nil, fmt.Errorf("lock %s is held until %s", key, existing.expiresAt.Format(time.RFC3339))
+			return nil, fmt.Errorf("%w: %s until %s", ErrLockHeld, key, existing.expiresAt.Format(time.RFC3339))
 		}
 		delete(s.locks, key)
 	}
@@ -326,17 +526,23 @@ func (s *SQLiteStore) AcquireLock(_ context.Context, key string, ttl time.Durati
 
 	// Try to acquire
 	expiresAt := now.Add(ttl)
-	_, err := s.db.Exec(`INSERT INTO locks (key, holder, expires_at) VALUES (?, ?, ?)
+	holder := newLockHolder()
+	res, err := s.db.Exec(`INSERT INTO locks (key, holder, expires_at) VALUES (?, ?, ?)
 		ON CONFLICT(key) DO UPDATE SET holder=excluded.holder, expires_at=excluded.expires_at
 		WHERE locks.expires_at < ?`,
-		key, "self", expiresAt.UTC(), now.UTC())
+		key, holder, expiresAt.UTC(), now.UTC())
 	if err != nil {
 		return nil, fmt.Errorf("acquire lock %s: %w", key, err)
 	}
+	// No row changed: another process sharing the database holds it.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("%w: %s by another process", ErrLockHeld, key)
+	}
 
 	lock := &sqliteLock{
 		store:     s,
 		key:       key,
+		holder:    holder,
 		expiresAt: expiresAt,
 	}
 	s.locks[key] = lock
@@ -346,14 +552,17 @@ func (s *SQLiteStore) AcquireLock(_ context.Context, key string, ttl time.Durati
 type sqliteLock struct {
 	store     *SQLiteStore
 	key       string
+	holder    string
 	expiresAt time.Time
 }
 
 func (l *sqliteLock) Unlock(_ context.Context) error {
 	l.store.mu.Lock()
 	defer l.store.mu.Unlock()
-	delete(l.store.locks, l.key)
-	_, err := l.store.db.Exec("DELETE FROM locks WHERE key = ?", l.key)
+	if l.store.locks[l.key] == l {
+		delete(l.store.locks, l.key)
+	}
+	_, err := l.store.db.Exec("DELETE FROM locks WHERE key = ? AND holder = ?", l.key, l.holder)
 	return err
 }
 
@@ -361,8 +570,15 @@ func (l *sqliteLock) Extend(_ context.Context, ttl time.Duration) error {
 	l.store.mu.Lock()
 	defer l.store.mu.Unlock()
 	l.expiresAt = time.Now().Add(ttl)
-	_, err := l.store.db.Exec("UPDATE locks SET expires_at = ? WHERE key = ?", l.expiresAt.UTC(), l.key)
-	return err
+	res, err := l.store.db.Exec("UPDATE locks SET expires_at = ? WHERE key = ? AND holder = ?",
+		l.expiresAt.UTC(), l.key, l.holder)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("extend lock %s: %w", l.key, ErrLockLost)
+	}
+	return nil
 }
 
 // ------------------------------------------------------------------
@@ -382,7 +598,7 @@ func scanNode(row scanner) (*Node, error) {
 		&statusStr, &capsJSON, &resJSON, &lastSeen, &registeredAt, &n.Version, &n.TunnelID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("node not found")
+			return nil, ErrNodeNotFound
 		}
 		return nil, err
 	}
@@ -2,9 +2,13 @@ package fleet
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -193,6 +197,181 @@ func TestSQLiteStore_Executions(t *testing.T) {
 	}
 }
 
+func TestStore_ListExecutionsByNode(t *testing.T) {
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer sqlite.Close()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Now().Add(-time.Hour)
+			for i, nodes := range [][]NodeID{{"web-1", "web-2"}, {"web-2"}, {"web-1"}, {"web-10"}} {
+				id := fmt.Sprintf("exec-%d", i)
+				result := &ExecResult{RequestID: id}
+				for _, n := range nodes {
+					result.NodeResults = append(result.NodeResults, NodeResult{NodeID: n, Status: "success", Output: id + " on " + string(n)})
+				}
+				req := &ExecRequest{ID: id, CreatedAt: base.Add(time.Duration(i) * time.Minute), Command: TypedCommand{Type: "shell"}}
+				if err := store.RecordExecution(ctx, req, result); err != nil {
+					t.Fatalf("RecordExecution: %v", err)
+				}
+			}
+
+			history, err := store.ListExecutionsByNode(ctx, "web-1", 0)
+			if err != nil {
+				t.Fatalf("ListExecutionsByNode: %v", err)
+			}
+			var got []string
+			for _, ne := range history {
+				got = append(got, ne.Result.Output)
+			}
+			if want := []string{"exec-2 on web-1", "exec-0 on web-1"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("web-1 history = %v, want %v", got, want)
+			}
+
+			history, err = store.ListExecutionsByNode(ctx, "web-2", 1)
+			if err != nil || len(history) != 1 || history[0].Request.ID != "exec-1" {
+				t.Errorf("web-2 history with limit 1 = %+v, %v; want exec-1 only", history, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteStore_Maintain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	// 300 executions from last quarter, each with some output, and 5
+	// from this week.
+	output := strings.Repeat("Reading package lists... Done\n", 100)
+	record := func(id string, at time.Time) {
+		t.Helper()
+		req := &ExecRequest{ID: id, Requester: "cron", CreatedAt: at, Command: TypedCommand{Type: "shell"}}
+		result := &ExecResult{RequestID: id, NodeResults: []NodeResult{{NodeID: "web-1", Status: "success", Output: output}}}
+		if err := store.RecordExecution(ctx, req, result); err != nil {
+			t.Fatalf("RecordExecution: %v", err)
+		}
+	}
+	now := time.Now()
+	for i := 0; i < 300; i++ {
+		record(fmt.Sprintf("old-%03d", i), now.Add(-90*24*time.Hour).Add(time.Duration(i)*time.Minute))
+	}
+	for i := 0; i < 5; i++ {
+		record(fmt.Sprintf("new-%d", i), now.Add(-time.Duration(i)*24*time.Hour))
+	}
+
+	store.SetRetention(30 * 24 * time.Hour)
+	report, err := store.Maintain(ctx)
+	if err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if report.DeletedExecutions != 300 {
+		t.Errorf("deleted %d executions, want 300", report.DeletedExecutions)
+	}
+	if report.SizeAfter >= report.SizeBefore/2 {
+		t.Errorf("size went from %d to %d bytes, want it at least halved", report.SizeBefore, report.SizeAfter)
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() != 0 {
+		t.Errorf("WAL is %d bytes after the checkpoint, want it truncated", info.Size())
+	}
+
+	execs, err := store.ListExecutions(ctx, ListExecOptions{})
+	if err != nil {
+		t.Fatalf("ListExecutions: %v", err)
+	}
+	if len(execs) != 5 {
+		t.Fatalf("%d executions left, want the 5 recent ones", len(execs))
+	}
+	for _, e := range execs {
+		if !strings.HasPrefix(e.ID, "new-") {
+			t.Errorf("kept %s, which is past the retention window", e.ID)
+		}
+	}
+
+	// Without retention nothing is deleted.
+	store.SetRetention(0)
+	if report, err := store.Maintain(ctx); err != nil || report.DeletedExecutions != 0 {
+		t.Errorf("Maintain without retention = %+v, %v", report, err)
+	}
+}
+
+func TestSQLiteStore_ListExecutionsAfter(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	testExecutionPaging(t, store)
+}
+
+// testExecutionPaging records 25 executions — some sharing a timestamp so
+// the id tiebreak matters — and pages through them 10 at a time, recording
+// a newer execution mid-way to show the cursor is unaffected.
+func testExecutionPaging(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	record := func(id string, at time.Time) {
+		req := &ExecRequest{ID: id, Requester: "admin", CreatedAt: at, Command: TypedCommand{Type: "shell"}}
+		if err := store.RecordExecution(ctx, req, &ExecResult{RequestID: id}); err != nil {
+			t.Fatalf("RecordExecution %s: %v", id, err)
+		}
+	}
+	var want []string
+	for i := 0; i < 25; i++ {
+		id := fmt.Sprintf("exec-%02d", i)
+		record(id, base.Add(time.Duration(i/2)*time.Second))
+		want = append([]string{id}, want...) // newest first
+	}
+
+	var (
+		got    []string
+		pages  int
+		cursor string
+	)
+	for {
+		page, next, err := store.ListExecutionsAfter(ctx, ListExecOptions{Requester: "admin", Limit: 10}, cursor)
+		if err != nil {
+			t.Fatalf("ListExecutionsAfter page %d: %v", pages+1, err)
+		}
+		pages++
+		for _, req := range page {
+			got = append(got, req.ID)
+		}
+		if pages == 1 {
+			record("exec-late", base.Add(time.Hour))
+		}
+		if next == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		cursor = next
+	}
+
+	if pages != 3 {
+		t.Errorf("pages = %d, want 3", pages)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged ids =\n%v\nwant\n%v", got, want)
+	}
+
+	if _, _, err := store.ListExecutionsAfter(ctx, ListExecOptions{}, "not-a-cursor"); err == nil {
+		t.Error("expected error for malformed cursor")
+	}
+}
+
 func TestSQLiteStore_Lock(t *testing.T) {
 	dir := t.TempDir()
 	store, err := NewSQLiteStore(filepath.Join(dir, "test.db"))
@@ -220,6 +399,121 @@ func TestSQLiteStore_Lock(t *testing.T) {
 	}
 }
 
+func TestSQLiteStore_LockHeldAcrossStores(t *testing.T) {
+	// Two stores on one file stand in for two processes.
+	path := filepath.Join(t.TempDir(), "test.db")
+	a, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer a.Close()
+	b, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+
+	lock, err := a.AcquireLock(ctx, "deploy-lock", 10*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if _, err := a.AcquireLock(ctx, "deploy-lock", 10*time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("same store: err = %v, want ErrLockHeld", err)
+	}
+	if _, err := b.AcquireLock(ctx, "deploy-lock", 10*time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("other store: err = %v, want ErrLockHeld", err)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if _, err := b.AcquireLock(ctx, "deploy-lock", 10*time.Second); err != nil {
+		t.Errorf("after unlock: %v", err)
+	}
+
+	// An expired lock can be taken over.
+	if _, err := a.AcquireLock(ctx, "short-lock", time.Millisecond); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := b.AcquireLock(ctx, "short-lock", 10*time.Second); err != nil {
+		t.Errorf("after expiry: %v", err)
+	}
+}
+
+func TestStore_LockScopedToHolder(t *testing.T) {
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer sqlite.Close()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := store.AcquireLock(ctx, "deploy:web:prod", time.Minute); err != nil {
+				t.Fatalf("AcquireLock: %v", err)
+			}
+			if _, err := store.AcquireLock(ctx, "deploy:web:prod", time.Minute); !errors.Is(err, ErrLockHeld) {
+				t.Fatalf("second AcquireLock: err = %v, want ErrLockHeld", err)
+			}
+
+			// A holder whose lock expired and was taken over can neither
+			// extend nor release the new holder's lock.
+			stale, err := store.AcquireLock(ctx, "short", time.Millisecond)
+			if err != nil {
+				t.Fatalf("AcquireLock: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if _, err := store.AcquireLock(ctx, "short", time.Minute); err != nil {
+				t.Fatalf("take over expired lock: %v", err)
+			}
+			if err := stale.Extend(ctx, time.Minute); !errors.Is(err, ErrLockLost) {
+				t.Errorf("stale Extend: err = %v, want ErrLockLost", err)
+			}
+			if err := stale.Unlock(ctx); err != nil {
+				t.Fatalf("stale Unlock: %v", err)
+			}
+			if _, err := store.AcquireLock(ctx, "short", time.Minute); !errors.Is(err, ErrLockHeld) {
+				t.Errorf("after stale Unlock: err = %v, want the new holder's lock kept", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteStore_IdempotentResults(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if got, err := store.GetIdempotentResult(ctx, "restart-db", "node-1", time.Now().Add(-time.Minute)); err != nil || got != nil {
+		t.Fatalf("before save: got %v, err %v; want nil, nil", got, err)
+	}
+
+	saved := &NodeResult{NodeID: "node-1", Status: "success", Output: "restarted", ExitCode: 0}
+	if err := store.SaveIdempotentResult(ctx, "restart-db", "node-1", saved); err != nil {
+		t.Fatalf("SaveIdempotentResult: %v", err)
+	}
+
+	got, err := store.GetIdempotentResult(ctx, "restart-db", "node-1", time.Now().Add(-time.Minute))
+	if err != nil || got == nil {
+		t.Fatalf("GetIdempotentResult: got %v, err %v", got, err)
+	}
+	if got.Output != "restarted" || got.Status != "success" {
+		t.Errorf("result = %+v, want the saved one", got)
+	}
+	if got, _ := store.GetIdempotentResult(ctx, "restart-db", "node-2", time.Now().Add(-time.Minute)); got != nil {
+		t.Errorf("node-2 = %+v, want nil (results are per node)", got)
+	}
+	if got, _ := store.GetIdempotentResult(ctx, "restart-db", "node-1", time.Now().Add(time.Minute)); got != nil {
+		t.Errorf("result older than since = %+v, want nil", got)
+	}
+}
+
 func TestSQLiteStore_Persistence(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "persist.db")
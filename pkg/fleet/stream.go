@@ -0,0 +1,60 @@
+package fleet
+
+import (
+	"context"
+	"time"
+)
+
+// NodeEventType identifies a step in a streamed execution.
+type NodeEventType string
+
+const (
+	NodeEventStarted  NodeEventType = "started"  // dispatched to the node
+	NodeEventOutput   NodeEventType = "output"   // one line of output
+	NodeEventFinished NodeEventType = "finished" // node result available
+	NodeEventDone     NodeEventType = "done"     // all nodes finished; Exec is set
+)
+
+// NodeResultEvent is an incremental update from ExecuteStream.
+type NodeResultEvent struct {
+	Type   NodeEventType `json:"type"`
+	NodeID NodeID        `json:"node_id,omitempty"`
+	Line   string        `json:"line,omitempty"`   // NodeEventOutput
+	Result *NodeResult   `json:"result,omitempty"` // NodeEventFinished
+	Exec   *ExecResult   `json:"exec,omitempty"`   // NodeEventDone
+	Time   time.Time     `json:"time"`
+}
+
+// StreamingRelayClient is a RelayClient that can deliver a command's output
+// line by line while it runs. onLine may be called from another goroutine
+// and must not block for long.
+type StreamingRelayClient interface {
+	RelayClient
+	ExecuteStream(ctx context.Context, node *Node, cmd TypedCommand, onLine func(line string)) (*NodeResult, error)
+}
+
+// streamBuffer is the event channel capacity; a slow reader backs up
+// output delivery rather than dropping lines.
+const streamBuffer = 256
+
+// ExecuteStream is Execute with progress: it emits started, output, and
+// finished events for each node as they happen, then a final NodeEventDone
+// carrying the aggregate ExecResult, and closes the channel. Output events
+// are only produced when the relay client implements StreamingRelayClient.
+//
+// Validation and target resolution errors are returned before anything is
+// dispatched. The caller must drain the channel.
+func (e *Executor) ExecuteStream(ctx context.Context, req *ExecRequest) (<-chan NodeResultEvent, error) {
+	targets, err := e.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan NodeResultEvent, streamBuffer)
+	go func() {
+		defer close(events)
+		result := e.run(ctx, req, targets, func(ev NodeResultEvent) { events <- ev })
+		events <- NodeResultEvent{Type: NodeEventDone, Exec: result, Time: time.Now()}
+	}()
+	return events, nil
+}
@@ -11,8 +11,11 @@ package fleet
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -57,6 +60,33 @@ type NodeResources struct {
 	OS          string `json:"os"`
 	Arch        string `json:"arch"`
 	GoVersion   string `json:"go_version"`
+
+	// Utilization, as sampled by the agent on each relay heartbeat. Zero
+	// when the node has not reported it (e.g. non-Linux agents).
+	Load1        float64 `json:"load1,omitempty"`          // 1-minute load average
+	MemoryUsedMB int     `json:"memory_used_mb,omitempty"` // of MemoryMB
+	DiskFreeMB   int     `json:"disk_free_mb,omitempty"`   // of DiskMB, on the agent's workspace mount
+}
+
+// HasUtilization reports whether the node has reported any usage figures.
+func (r NodeResources) HasUtilization() bool {
+	return r.Load1 > 0 || r.MemoryUsedMB > 0 || r.DiskFreeMB > 0
+}
+
+// UtilizationSummary renders the usage figures compactly, e.g.
+// "load 0.42 mem 61% disk 12.3G free", or "-" when none were reported.
+func (r NodeResources) UtilizationSummary() string {
+	if !r.HasUtilization() {
+		return "-"
+	}
+	parts := []string{fmt.Sprintf("load %.2f", r.Load1)}
+	if r.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("mem %d%%", r.MemoryUsedMB*100/r.MemoryMB))
+	}
+	if r.DiskMB > 0 {
+		parts = append(parts, fmt.Sprintf("disk %.1fG free", float64(r.DiskFreeMB)/1024))
+	}
+	return strings.Join(parts, " ")
 }
 
 // TargetSelector specifies which nodes a command should execute on.
@@ -67,69 +97,95 @@ type TargetSelector struct {
 	Labels   map[string]string `json:"labels,omitempty"`
 	All      bool              `json:"all,omitempty"`
 
+	// LabelMatchers narrow the label selection with eq, ne, in, notin and
+	// regex operators. They are ANDed with Labels, which is shorthand for
+	// eq matchers.
+	LabelMatchers []LabelMatcher `json:"label_matchers,omitempty"`
+
+	// Exclude drops nodes matching any of these matchers from whatever the
+	// fields above select.
+	Exclude []LabelMatcher `json:"exclude,omitempty"`
+
 	// Limits
 	MaxConcurrency int `json:"max_concurrency,omitempty"` // 0 = unlimited
 	MaxNodes       int `json:"max_nodes,omitempty"`       // 0 = all matching
 }
 
-// Resolve returns the effective node list by filtering the full roster.
+// Resolve returns the effective node list by filtering the full roster:
+// the nodes Matches selects that can take commands, in roster order, up to
+// MaxNodes.
 func (ts *TargetSelector) Resolve(roster []*Node) []*Node {
-	if ts.All {
-		return filterOnline(roster, ts.MaxNodes)
-	}
-	var matched []*Node
-	if len(ts.NodeIDs) > 0 {
-		idSet := make(map[NodeID]bool, len(ts.NodeIDs))
-		for _, id := range ts.NodeIDs {
-			idSet[id] = true
+	var out []*Node
+	for _, n := range roster {
+		if !ts.Matches(n) || !ts.dispatchable(n) || alreadyIn(out, n) {
+			continue
 		}
-		for _, n := range roster {
-			if idSet[n.ID] && (n.Status == NodeStatusOnline || n.Status == NodeStatusDegraded) {
-				matched = append(matched, n)
-			}
+		out = append(out, n)
+		if ts.MaxNodes > 0 && len(out) >= ts.MaxNodes {
+			break
 		}
 	}
-	if len(ts.Groups) > 0 {
-		groupSet := make(map[GroupName]bool, len(ts.Groups))
-		for _, g := range ts.Groups {
-			groupSet[g] = true
-		}
-		for _, n := range roster {
-			if n.Status != NodeStatusOnline {
-				continue
-			}
-			for _, ng := range n.Groups {
-				if groupSet[ng] {
-					matched = append(matched, n)
-					break
-				}
+	return out
+}
+
+// Matches reports whether n is selected by ts, regardless of the node's
+// status or MaxNodes. Resolve additionally drops nodes that are not online
+// or degraded; callers use Matches to show what that filtering left out.
+func (ts *TargetSelector) Matches(n *Node) bool {
+	if ts.excluded(n) {
+		return false
+	}
+	if ts.All || ts.namesNode(n) {
+		return true
+	}
+	for _, g := range ts.Groups {
+		for _, ng := range n.Groups {
+			if ng == g {
+				return true
 			}
 		}
 	}
-	if len(ts.Labels) > 0 {
-		for _, n := range roster {
-			if n.Status != NodeStatusOnline && !alreadyIn(matched, n) {
-				continue
-			}
-			if matchLabels(n.Labels, ts.Labels) {
-				matched = append(matched, n)
-			}
+	return ts.hasLabelSelector() && ts.matchesLabels(n.Labels)
+}
+
+// dispatchable reports whether a selected node can take commands. Online
+// nodes always can; degraded ones only when all nodes are targeted or the
+// node is named by ID, not when it merely shares a group or labels.
+func (ts *TargetSelector) dispatchable(n *Node) bool {
+	switch n.Status {
+	case NodeStatusOnline:
+		return true
+	case NodeStatusDegraded:
+		return ts.All || ts.namesNode(n)
+	}
+	return false
+}
+
+func (ts *TargetSelector) namesNode(n *Node) bool {
+	for _, id := range ts.NodeIDs {
+		if n.ID == id {
+			return true
 		}
 	}
-	return dedup(filterOnline(matched, ts.MaxNodes))
+	return false
 }
 
-func filterOnline(nodes []*Node, max int) []*Node {
-	var out []*Node
-	for _, n := range nodes {
-		if n.Status == NodeStatusOnline || n.Status == NodeStatusDegraded {
-			out = append(out, n)
-			if max > 0 && len(out) >= max {
-				break
-			}
+func (ts *TargetSelector) hasLabelSelector() bool {
+	return len(ts.Labels) > 0 || len(ts.LabelMatchers) > 0
+}
+
+func (ts *TargetSelector) matchesLabels(labels map[string]string) bool {
+	return matchLabels(labels, ts.Labels) && matchAllMatchers(labels, ts.LabelMatchers)
+}
+
+// excluded reports whether n matches any of the Exclude matchers.
+func (ts *TargetSelector) excluded(n *Node) bool {
+	for _, m := range ts.Exclude {
+		if m.Matches(n.Labels) {
+			return true
 		}
 	}
-	return out
+	return false
 }
 
 func alreadyIn(nodes []*Node, n *Node) bool {
@@ -150,18 +206,6 @@ func matchLabels(nodeLabels, required map[string]string) bool {
 	return true
 }
 
-func dedup(nodes []*Node) []*Node {
-	seen := make(map[NodeID]bool, len(nodes))
-	var out []*Node
-	for _, n := range nodes {
-		if !seen[n.ID] {
-			seen[n.ID] = true
-			out = append(out, n)
-		}
-	}
-	return out
-}
-
 // ------------------------------------------------------------------
 // Command execution types
 // ------------------------------------------------------------------
@@ -172,16 +216,56 @@ type ExecRequest struct {
 	Target    TargetSelector `json:"target"`
 	Command   TypedCommand   `json:"command"`
 	Timeout   time.Duration  `json:"timeout"`
-	DryRun    bool           `json:"dry_run"`
+	DryRun    bool           `json:"dry_run"`   // contact no node; results have status "dry-run" and the command as Output
 	Requester string         `json:"requester"` // user/role who initiated
 	CreatedAt time.Time      `json:"created_at"`
+
+	// IdempotencyKey, when set, makes the request safe to repeat: a node
+	// that already ran a request with the same key within the executor's
+	// idempotency TTL returns its recorded result instead of running the
+	// command again.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// Batch, when set, runs the targets in sequential batches instead of
+	// all at once. Timeout covers all batches together.
+	Batch *BatchPolicy `json:"batch,omitempty"`
+
+	// MaxOutputBytes caps the output each node keeps for the command; the
+	// rest is dropped on the node and the result is marked Truncated. Zero
+	// uses the node's own limit, which a request can lower but not raise.
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty"`
+
+	// DispatchRate caps how many nodes the command starts on per second,
+	// to spare shared backends such as a package mirror. Zero dispatches
+	// as fast as MaxConcurrency allows.
+	DispatchRate float64 `json:"dispatch_rate,omitempty"`
+
+	// NodeTimeout, when set, bounds each node's run from the moment it is
+	// dispatched: a node still running after NodeTimeout is stopped and
+	// reported as "timeout" while the others carry on. Timeout stays the
+	// budget for the whole fan-out; nodes not started by then are not run.
+	NodeTimeout time.Duration `json:"node_timeout,omitempty"`
+}
+
+// nodeCommand is the command sent to each node, carrying the request's
+// output limit.
+func (r *ExecRequest) nodeCommand() TypedCommand {
+	cmd := r.Command
+	if r.MaxOutputBytes > 0 {
+		cmd.MaxOutputBytes = r.MaxOutputBytes
+	}
+	return cmd
 }
 
 // TypedCommand is a discriminated union for command types.
 // Each variant has its own strongly-typed schema.
 type TypedCommand struct {
-	Type string          `json:"type"` // "shell", "deploy", "docker", "k8s", "file", "browser"
+	Type string          `json:"type"` // "shell", "script", "deploy", "docker", "k8s", "file", "browser"
 	Data json.RawMessage `json:"data"`
+
+	// MaxOutputBytes is the output limit the node applies, set from
+	// ExecRequest.MaxOutputBytes; zero means the node's default.
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty"`
 }
 
 // ShellCommand runs a shell command on target nodes.
@@ -191,6 +275,42 @@ type ShellCommand struct {
 	Env        map[string]string `json:"env,omitempty"`
 	TimeoutSec int              `json:"timeout_sec,omitempty"`
 	Shell      string            `json:"shell,omitempty"` // default: /bin/sh
+
+	// Sudo runs the command through non-interactive sudo as SudoUser
+	// (default root). Nodes without passwordless sudo fail it with
+	// Reason ReasonSudoPasswordRequired.
+	Sudo     bool   `json:"sudo,omitempty"`
+	SudoUser string `json:"sudo_user,omitempty"`
+}
+
+// ScriptCommand runs a script file on target nodes. The node writes
+// Content to a temporary file, runs it with Interpreter, and removes it.
+type ScriptCommand struct {
+	Interpreter string `json:"interpreter,omitempty"` // default: /bin/sh
+	Content     string `json:"content"`               // base64-encoded script
+	TimeoutSec  int    `json:"timeout_sec,omitempty"` // default 30s, capped at 120s like ShellCommand
+}
+
+// NewScriptCommand encodes script as a "script" TypedCommand run by
+// interpreter (empty for /bin/sh).
+func NewScriptCommand(script []byte, interpreter string) (TypedCommand, error) {
+	data, err := json.Marshal(ScriptCommand{
+		Interpreter: interpreter,
+		Content:     base64.StdEncoding.EncodeToString(script),
+	})
+	if err != nil {
+		return TypedCommand{}, err
+	}
+	return TypedCommand{Type: "script", Data: data}, nil
+}
+
+// Script decodes Content.
+func (c ScriptCommand) Script() ([]byte, error) {
+	script, err := base64.StdEncoding.DecodeString(c.Content)
+	if err != nil {
+		return nil, fmt.Errorf("decode script content: %w", err)
+	}
+	return script, nil
 }
 
 // DeployCommand triggers a deployment on target nodes.
@@ -249,30 +369,60 @@ type FileCommand struct {
 
 // ExecResult is the aggregated result of a fleet-wide command.
 type ExecResult struct {
-	RequestID  string        `json:"request_id"`
-	NodeResults []NodeResult `json:"node_results"`
-	Summary    ExecSummary   `json:"summary"`
-	Duration   time.Duration `json:"duration"`
+	RequestID   string        `json:"request_id"`
+	NodeResults []NodeResult  `json:"node_results"`
+	Summary     ExecSummary   `json:"summary"`
+	Duration    time.Duration `json:"duration"`
+	StartedAt   time.Time     `json:"started_at"`
+	FinishedAt  time.Time     `json:"finished_at"`
 }
 
 // NodeResult is the outcome from a single node.
 type NodeResult struct {
-	NodeID   NodeID        `json:"node_id"`
-	Hostname string        `json:"hostname"`
-	Output   string        `json:"output"`
-	ExitCode int           `json:"exit_code"`
-	Error    string        `json:"error,omitempty"`
-	Duration time.Duration `json:"duration"`
-	Status   string        `json:"status"` // "success", "failure", "timeout", "skipped"
+	NodeID    NodeID        `json:"node_id"`
+	Hostname  string        `json:"hostname"`
+	Output    string        `json:"output"`
+	ExitCode  int           `json:"exit_code"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	StartedAt time.Time     `json:"started_at"` // when the control plane dispatched to this node
+	Status    string        `json:"status"`     // "success", "failure", "timeout", "skipped", "dry-run", "unreachable", "cancelled"
+
+	// Execution environment, reported by the node agent for shell commands.
+	WorkDir string `json:"work_dir,omitempty"` // absolute directory the command ran in
+	Shell   string `json:"shell,omitempty"`    // interpreter used, e.g. /bin/sh
+	Signal  string `json:"signal,omitempty"`   // terminating signal, e.g. SIGKILL for OOM-kills
+
+	// Cached is set when the result was replayed for a repeated
+	// ExecRequest.IdempotencyKey rather than produced by running the command.
+	Cached bool `json:"cached,omitempty"`
+
+	// Reason is a machine-readable cause for a failure that has one, such
+	// as ReasonSudoPasswordRequired.
+	Reason string `json:"reason,omitempty"`
+
+	// OutputBytes is how much output the command wrote, stdout and stderr
+	// together. When it exceeds the node's output limit, Output holds only
+	// the start of it and Truncated is set.
+	OutputBytes int64 `json:"output_bytes,omitempty"`
+	Truncated   bool  `json:"truncated,omitempty"`
 }
 
+// ReasonSudoPasswordRequired is the NodeResult.Reason for a sudo command
+// on a node where sudo would have prompted for a password.
+const ReasonSudoPasswordRequired = "sudo_password_required"
+
 // ExecSummary is a quick overview of fleet execution.
 type ExecSummary struct {
 	Total    int `json:"total"`
 	Success  int `json:"success"`
 	Failed   int `json:"failed"`
 	Timeout  int `json:"timeout"`
-	Skipped  int `json:"skipped"`
+	Skipped  int `json:"skipped"` // not run: halted batches and dry runs
+
+	Unreachable int `json:"unreachable,omitempty"` // matched nodes with no active tunnel
+	Cancelled   int `json:"cancelled,omitempty"`   // runs interrupted by cancelling the request
+	Denied      int `json:"denied,omitempty"`      // refused by node command policy or relay ACLs ("denied" or "blocked")
 }
 
 // ------------------------------------------------------------------
@@ -292,16 +442,41 @@ type Store interface {
 	ListNodes(ctx context.Context) ([]*Node, error)
 	ListNodesByGroup(ctx context.Context, group GroupName) ([]*Node, error)
 	ListNodesByLabels(ctx context.Context, labels map[string]string) ([]*Node, error)
+	// Watch streams node registrations, status changes and
+	// deregistrations made after the call, until ctx is done.
+	Watch(ctx context.Context) (<-chan NodeEvent, error)
 
 	// Execution audit
 	RecordExecution(ctx context.Context, req *ExecRequest, result *ExecResult) error
 	GetExecution(ctx context.Context, id string) (*ExecRequest, *ExecResult, error)
 	ListExecutions(ctx context.Context, opts ListExecOptions) ([]*ExecRequest, error)
+	// ListExecutionsAfter pages through executions newest first. Pass ""
+	// for the first page and the returned cursor for each next one; an
+	// empty next cursor means there are no more. opts.Limit is the page
+	// size (DefaultExecPageSize if unset) and opts.Offset is ignored.
+	ListExecutionsAfter(ctx context.Context, opts ListExecOptions, cursor string) ([]*ExecRequest, string, error)
+	// ListExecutionsByNode returns node's part in the executions that
+	// targeted it, newest first: at most limit, or DefaultNodeHistory if
+	// limit is not positive.
+	ListExecutionsByNode(ctx context.Context, node NodeID, limit int) ([]NodeExecution, error)
+
+	// Idempotency cache (see ExecRequest.IdempotencyKey).
+	// GetIdempotentResult returns the result saved for key on node at or
+	// after since, or nil if there is none.
+	GetIdempotentResult(ctx context.Context, key string, node NodeID, since time.Time) (*NodeResult, error)
+	SaveIdempotentResult(ctx context.Context, key string, node NodeID, result *NodeResult) error
 
 	// Distributed locking (for leader election / concurrency control)
 	AcquireLock(ctx context.Context, key string, ttl time.Duration) (Lock, error)
 }
 
+// ErrLockHeld is returned by AcquireLock when another holder has the lock.
+var ErrLockHeld = errors.New("lock is held")
+
+// ErrLockLost is returned by Lock.Extend when the lock expired and was
+// taken by another holder.
+var ErrLockLost = errors.New("lock is no longer held")
+
 // Lock represents a distributed lock.
 type Lock interface {
 	Unlock(ctx context.Context) error
@@ -328,10 +503,31 @@ func (r *ExecRequest) Validate() error {
 		r.Timeout = 30 * time.Second
 	}
 	switch r.Command.Type {
-	case "shell", "deploy", "docker", "k8s", "file", "browser":
+	case "shell", "script", "deploy", "docker", "k8s", "file", "browser":
 		// valid
 	default:
 		return fmt.Errorf("unknown command type: %s", r.Command.Type)
 	}
+	for _, matchers := range [][]LabelMatcher{r.Target.LabelMatchers, r.Target.Exclude} {
+		for _, m := range matchers {
+			if err := m.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Batch != nil {
+		if err := r.Batch.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.MaxOutputBytes < 0 {
+		return fmt.Errorf("max output bytes must not be negative")
+	}
+	if r.NodeTimeout < 0 {
+		return fmt.Errorf("node timeout must not be negative")
+	}
+	if r.DispatchRate < 0 {
+		return fmt.Errorf("dispatch rate must not be negative")
+	}
 	return nil
 }
@@ -0,0 +1,75 @@
+package fleet
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NodeChangeType is the kind of registry change a NodeEvent reports.
+type NodeChangeType string
+
+const (
+	NodeChangeRegistered   NodeChangeType = "register"
+	NodeChangeStatus       NodeChangeType = "status"
+	NodeChangeDeregistered NodeChangeType = "deregister"
+)
+
+// NodeEvent is a change to the node registry, delivered by Store.Watch.
+// Node is the node's state after the change, and nil for deregistrations.
+type NodeEvent struct {
+	Type      NodeChangeType `json:"type"`
+	NodeID    NodeID         `json:"node_id"`
+	Node      *Node          `json:"node,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// watchBuffer is how many events a watcher may fall behind before further
+// events are dropped for it. Stores never block a write on a slow watcher.
+const watchBuffer = 64
+
+// nodeEventHub fans node events out to in-process watchers. The zero
+// value is ready to use.
+type nodeEventHub struct {
+	mu   sync.Mutex
+	subs map[chan NodeEvent]struct{}
+}
+
+// subscribe returns a channel of events published from now on. It is
+// closed when ctx is done.
+func (h *nodeEventHub) subscribe(ctx context.Context) <-chan NodeEvent {
+	ch := make(chan NodeEvent, watchBuffer)
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[chan NodeEvent]struct{})
+	}
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.subs, ch)
+		close(ch)
+		h.mu.Unlock()
+	}()
+	return ch
+}
+
+// publish delivers ev to every watcher with room in its buffer.
+func (h *nodeEventHub) publish(typ NodeChangeType, id NodeID, node *Node) {
+	ev := NodeEvent{Type: typ, NodeID: id, Timestamp: time.Now()}
+	if node != nil {
+		snapshot := *node
+		ev.Node = &snapshot
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
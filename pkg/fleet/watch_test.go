@@ -0,0 +1,121 @@
+package fleet
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func nextNodeEvent(t *testing.T, events <-chan NodeEvent) NodeEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a node event")
+	}
+	return NodeEvent{}
+}
+
+// testStoreWatch checks the events a store emits for a node's lifecycle.
+func testStoreWatch(t *testing.T, store Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := store.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	other, err := store.Watch(ctx)
+	if err != nil {
+		t.Fatalf("second Watch: %v", err)
+	}
+
+	node := &Node{ID: "web-1", Hostname: "web-1", Status: NodeStatusOnline, LastSeen: time.Now(), RegisteredAt: time.Now()}
+	if err := store.RegisterNode(ctx, node); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	for _, ch := range []<-chan NodeEvent{events, other} {
+		ev := nextNodeEvent(t, ch)
+		if ev.Type != NodeChangeRegistered || ev.NodeID != "web-1" || ev.Node == nil || ev.Node.Hostname != "web-1" {
+			t.Errorf("register event = %+v", ev)
+		}
+		if ev.Timestamp.IsZero() {
+			t.Error("event has no timestamp")
+		}
+	}
+
+	// Setting the status it already has is not a change.
+	if err := store.UpdateNodeStatus(ctx, "web-1", NodeStatusOnline); err != nil {
+		t.Fatalf("UpdateNodeStatus: %v", err)
+	}
+	if err := store.UpdateNodeStatus(ctx, "web-1", NodeStatusDraining); err != nil {
+		t.Fatalf("UpdateNodeStatus: %v", err)
+	}
+	ev := nextNodeEvent(t, events)
+	if ev.Type != NodeChangeStatus || ev.Node == nil || ev.Node.Status != NodeStatusDraining {
+		t.Errorf("status event = %+v, want draining", ev)
+	}
+	if err := store.UpdateNodeStatus(ctx, "missing", NodeStatusOnline); err == nil {
+		t.Error("expected an error updating a missing node")
+	}
+
+	if err := store.DeregisterNode(ctx, "web-1"); err != nil {
+		t.Fatalf("DeregisterNode: %v", err)
+	}
+	ev = nextNodeEvent(t, events)
+	if ev.Type != NodeChangeDeregistered || ev.NodeID != "web-1" || ev.Node != nil {
+		t.Errorf("deregister event = %+v", ev)
+	}
+
+	cancel()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("event channel not closed after cancel")
+		}
+	}
+}
+
+func TestMemoryStore_Watch(t *testing.T) {
+	testStoreWatch(t, NewMemoryStore())
+}
+
+func TestSQLiteStore_Watch(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "watch.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+	testStoreWatch(t, store)
+}
+
+func TestNodeEventHub_SlowWatcherDoesNotBlock(t *testing.T) {
+	var hub nodeEventHub
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := hub.subscribe(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < watchBuffer*2; i++ {
+			hub.publish(NodeChangeStatus, "web-1", nil)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publish blocked on a watcher that is not reading")
+	}
+	if len(events) != watchBuffer {
+		t.Errorf("buffered %d events, want %d", len(events), watchBuffer)
+	}
+}
@@ -3,7 +3,9 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"runtime"
 	"strings"
@@ -31,6 +33,7 @@ var (
 	}
 
 	currentLevel    = INFO
+	currentFormat   = FormatText
 	suppressConsole bool
 	logger          *Logger
 	once            sync.Once
@@ -71,6 +74,71 @@ func GetLevel() LogLevel {
 	return currentLevel
 }
 
+// Format selects how log lines are written to the console.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// FormatEnvVar names the environment variable that selects the log format.
+const FormatEnvVar = "DEVOPSCLAW_LOG_FORMAT"
+
+// ParseFormat parses a --log-format or DEVOPSCLAW_LOG_FORMAT value. The
+// empty string means text.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid log format %q (want text or json)", s)
+}
+
+// SetFormat sets the console log format for this package and for slog
+// handlers built by NewHandler.
+func SetFormat(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	currentFormat = f
+}
+
+func GetFormat() Format {
+	mu.RLock()
+	defer mu.RUnlock()
+	return currentFormat
+}
+
+// NewHandler returns a slog handler writing to w in the current format.
+// Its level follows SetLevel, including changes made after it was built.
+func NewHandler(w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slogLevel{}}
+	if GetFormat() == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// slogLevel adapts the package level to slog.Leveler.
+type slogLevel struct{}
+
+func (slogLevel) Level() slog.Level {
+	switch GetLevel() {
+	case DEBUG:
+		return slog.LevelDebug
+	case INFO:
+		return slog.LevelInfo
+	case WARN:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+var _ slog.Leveler = slogLevel{}
+
 // SuppressConsole disables stderr log output (e.g. while Bubble Tea owns the terminal).
 // File logging remains active.
 func SuppressConsole() {
@@ -135,28 +203,35 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 		}
 	}
 
-	if logger.file != nil {
-		jsonData, err := json.Marshal(entry)
-		if err == nil {
-			logger.file.WriteString(string(jsonData) + "\n")
-		}
+	jsonData, jsonErr := json.Marshal(entry)
+	if logger.file != nil && jsonErr == nil {
+		logger.file.WriteString(string(jsonData) + "\n")
 	}
 
-	var fieldStr string
-	if len(fields) > 0 {
-		fieldStr = " " + formatFields(fields)
+	var logLine string
+	if GetFormat() == FormatJSON && jsonErr == nil {
+		logLine = string(jsonData)
+	} else {
+		var fieldStr string
+		if len(fields) > 0 {
+			fieldStr = " " + formatFields(fields)
+		}
+		logLine = fmt.Sprintf("[%s] [%s]%s %s%s",
+			entry.Timestamp,
+			logLevelNames[level],
+			formatComponent(component),
+			message,
+			fieldStr,
+		)
 	}
 
-	logLine := fmt.Sprintf("[%s] [%s]%s %s%s",
-		entry.Timestamp,
-		logLevelNames[level],
-		formatComponent(component),
-		message,
-		fieldStr,
-	)
-
 	if !suppressConsole {
-		log.Println(logLine)
+		if GetFormat() == FormatJSON {
+			// No log.Println: its timestamp prefix would break the JSON line.
+			fmt.Fprintln(log.Writer(), logLine)
+		} else {
+			log.Println(logLine)
+		}
 	}
 
 	if level == FATAL {
@@ -1,6 +1,12 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +143,84 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]any{"key": "value"})
 }
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{"": FormatText, "text": FormatText, "JSON": FormatJSON, " json ": FormatJSON}
+	for in, want := range tests {
+		got, err := ParseFormat(in)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("logfmt"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestNewHandler_Format(t *testing.T) {
+	initialFormat, initialLevel := GetFormat(), GetLevel()
+	defer func() {
+		SetFormat(initialFormat)
+		SetLevel(initialLevel)
+	}()
+	SetLevel(INFO)
+
+	var buf bytes.Buffer
+	SetFormat(FormatJSON)
+	h := NewHandler(&buf)
+	if _, ok := h.(*slog.JSONHandler); !ok {
+		t.Fatalf("json format built %T, want *slog.JSONHandler", h)
+	}
+	slog.New(h).Info("node registered", "node_id", "web-1")
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("json handler output %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "node registered" || rec["node_id"] != "web-1" {
+		t.Errorf("record = %v", rec)
+	}
+
+	SetFormat(FormatText)
+	h = NewHandler(&buf)
+	if _, ok := h.(*slog.TextHandler); !ok {
+		t.Fatalf("text format built %T, want *slog.TextHandler", h)
+	}
+
+	// The handler's level tracks SetLevel after it was built.
+	if h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug enabled at INFO")
+	}
+	SetLevel(DEBUG)
+	if !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug still disabled after SetLevel(DEBUG)")
+	}
+	SetLevel(ERROR)
+	if h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("warn enabled at ERROR")
+	}
+}
+
+func TestConsoleJSONFormat(t *testing.T) {
+	initialFormat, initialLevel := GetFormat(), GetLevel()
+	var buf bytes.Buffer
+	initialOutput := log.Writer()
+	log.SetOutput(&buf)
+	defer func() {
+		SetFormat(initialFormat)
+		SetLevel(initialLevel)
+		log.SetOutput(initialOutput)
+	}()
+
+	SetLevel(INFO)
+	SetFormat(FormatJSON)
+	InfoCF("relay", "tunnel opened", map[string]any{"node": "web-1"})
+
+	line := strings.TrimSpace(buf.String())
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("console line %q is not JSON: %v", line, err)
+	}
+	if entry.Level != "INFO" || entry.Component != "relay" || entry.Message != "tunnel opened" || entry.Fields["node"] != "web-1" {
+		t.Errorf("entry = %+v", entry)
+	}
+}
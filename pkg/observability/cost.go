@@ -0,0 +1,259 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelPrice is what a model costs, in USD per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Cost returns the USD cost of a call with the given token counts.
+func (p ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Prompt + float64(completionTokens)*p.Completion) / 1e6
+}
+
+// PriceTable maps model names to prices. A name matches a model when it
+// equals the model or is its longest prefix, ignoring any "provider/"
+// qualifier, so "gpt-4o" prices "openai/gpt-4o-2024-08-06".
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable returns list prices for common models at the time of
+// writing. Prices change; override or extend them in config.
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gpt-4o":            {Prompt: 2.50, Completion: 10.00},
+		"gpt-4o-mini":       {Prompt: 0.15, Completion: 0.60},
+		"gpt-4.1":           {Prompt: 2.00, Completion: 8.00},
+		"gpt-4.1-mini":      {Prompt: 0.40, Completion: 1.60},
+		"o3-mini":           {Prompt: 1.10, Completion: 4.40},
+		"claude-3-5-sonnet": {Prompt: 3.00, Completion: 15.00},
+		"claude-3-5-haiku":  {Prompt: 0.80, Completion: 4.00},
+		"claude-sonnet-4":   {Prompt: 3.00, Completion: 15.00},
+		"claude-opus-4":     {Prompt: 15.00, Completion: 75.00},
+		"gemini-1.5-pro":    {Prompt: 1.25, Completion: 5.00},
+		"gemini-1.5-flash":  {Prompt: 0.075, Completion: 0.30},
+		"gemini-2.0-flash":  {Prompt: 0.10, Completion: 0.40},
+		"deepseek-chat":     {Prompt: 0.27, Completion: 1.10},
+		"deepseek-reasoner": {Prompt: 0.55, Completion: 2.19},
+	}
+}
+
+// Lookup returns the price for model.
+func (t PriceTable) Lookup(model string) (ModelPrice, bool) {
+	candidates := []string{model}
+	if _, bare, ok := strings.Cut(model, "/"); ok {
+		candidates = append(candidates, bare)
+	}
+	for _, m := range candidates {
+		if p, ok := t[m]; ok {
+			return p, true
+		}
+	}
+	best := ""
+	for name := range t {
+		for _, m := range candidates {
+			if strings.HasPrefix(m, name) && len(name) > len(best) {
+				best = name
+			}
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return t[best], true
+}
+
+// ------------------------------------------------------------------
+// Cost tracker
+// ------------------------------------------------------------------
+
+// costLedgerDays is how many days of spend a ledger keeps.
+const costLedgerDays = 90
+
+// ModelUsage is the usage and spend of one model.
+type ModelUsage struct {
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	Unpriced         bool    `json:"unpriced,omitempty"` // no price in the table; CostUSD is 0
+}
+
+// DailyCost is one day's usage by model.
+type DailyCost struct {
+	Models map[string]*ModelUsage `json:"models"`
+}
+
+// TotalUSD returns the day's spend across models.
+func (d *DailyCost) TotalUSD() float64 {
+	total := 0.0
+	for _, u := range d.Models {
+		total += u.CostUSD
+	}
+	return total
+}
+
+// ModelNames returns the day's models, most expensive first.
+func (d *DailyCost) ModelNames() []string {
+	names := sortedKeys(d.Models)
+	sort.SliceStable(names, func(i, j int) bool {
+		return d.Models[names[i]].CostUSD > d.Models[names[j]].CostUSD
+	})
+	return names
+}
+
+// CostLedger is the persisted spend, by local date ("2006-01-02").
+type CostLedger struct {
+	Days map[string]*DailyCost `json:"days"`
+}
+
+// Day returns the spend on t's date, empty if nothing was recorded.
+func (l *CostLedger) Day(t time.Time) *DailyCost {
+	if d, ok := l.Days[t.Format(time.DateOnly)]; ok {
+		return d
+	}
+	return &DailyCost{Models: map[string]*ModelUsage{}}
+}
+
+// ReadCostLedger loads the ledger at path. A missing file is an empty
+// ledger.
+func ReadCostLedger(path string) (*CostLedger, error) {
+	ledger := &CostLedger{Days: map[string]*DailyCost{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cost ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("parse cost ledger %s: %w", path, err)
+	}
+	if ledger.Days == nil {
+		ledger.Days = map[string]*DailyCost{}
+	}
+	return ledger, nil
+}
+
+// CostTracker records the tokens and cost of each LLM call: in the
+// devopsclaw_llm_tokens_total and devopsclaw_llm_cost_usd_total metrics
+// when SetMetrics is called, and in a daily ledger file when SetLedger is,
+// so that another process can report the day's spend. Thread-safe.
+type CostTracker struct {
+	prices PriceTable
+	now    func() time.Time
+
+	mu         sync.Mutex
+	metrics    *DevOpsClawMetrics
+	ledgerPath string
+}
+
+// NewCostTracker creates a tracker that prices calls with prices.
+func NewCostTracker(prices PriceTable) *CostTracker {
+	return &CostTracker{prices: prices, now: time.Now}
+}
+
+// SetMetrics reports usage to the LLMTokens and LLMCost metrics.
+func (t *CostTracker) SetMetrics(metrics *DevOpsClawMetrics) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = metrics
+}
+
+// SetLedger adds each call to the ledger file at path. Processes sharing
+// a ledger each rewrite it whole, so two calls recorded at the same
+// instant may lose one.
+func (t *CostTracker) SetLedger(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ledgerPath = path
+}
+
+// Record accounts for one call to model and returns its cost in USD. A
+// model missing from the price table costs 0; its tokens are still
+// counted. The error is from updating the ledger.
+func (t *CostTracker) Record(model string, promptTokens, completionTokens int) (float64, error) {
+	price, priced := t.prices.Lookup(model)
+	cost := price.Cost(promptTokens, completionTokens)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.metrics != nil {
+		t.metrics.LLMTokens.With(model, "prompt").Add(int64(promptTokens))
+		t.metrics.LLMTokens.With(model, "completion").Add(int64(completionTokens))
+		t.metrics.LLMCost.With(model).Add(cost)
+	}
+	if t.ledgerPath == "" {
+		return cost, nil
+	}
+	return cost, t.updateLedgerLocked(func(day *DailyCost) {
+		u := day.Models[model]
+		if u == nil {
+			u = &ModelUsage{}
+			day.Models[model] = u
+		}
+		u.Calls++
+		u.PromptTokens += int64(promptTokens)
+		u.CompletionTokens += int64(completionTokens)
+		u.CostUSD += cost
+		u.Unpriced = !priced
+	})
+}
+
+// updateLedgerLocked applies update to today's entry, drops days older
+// than costLedgerDays, and writes the ledger back. t.mu must be held.
+func (t *CostTracker) updateLedgerLocked(update func(*DailyCost)) error {
+	ledger, err := ReadCostLedger(t.ledgerPath)
+	if err != nil {
+		return err
+	}
+	now := t.now()
+	today := now.Format(time.DateOnly)
+	day := ledger.Days[today]
+	if day == nil {
+		day = &DailyCost{Models: map[string]*ModelUsage{}}
+		ledger.Days[today] = day
+	}
+	update(day)
+
+	oldest := now.AddDate(0, 0, -costLedgerDays).Format(time.DateOnly)
+	for date := range ledger.Days {
+		if date < oldest {
+			delete(ledger.Days, date)
+		}
+	}
+
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.ledgerPath), 0o755); err != nil {
+		return fmt.Errorf("create cost ledger dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.ledgerPath), ".cost-ledger-*.tmp")
+	if err != nil {
+		return fmt.Errorf("write cost ledger: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cost ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write cost ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.ledgerPath); err != nil {
+		return fmt.Errorf("write cost ledger: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package observability
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModelPrice_Cost(t *testing.T) {
+	p := ModelPrice{Prompt: 2.50, Completion: 10.00}
+	got := p.Cost(10_000, 2_000)
+	if want := 0.045; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", got, want)
+	}
+}
+
+func TestPriceTable_Lookup(t *testing.T) {
+	table := PriceTable{
+		"gpt-4o":      {Prompt: 2.50, Completion: 10.00},
+		"gpt-4o-mini": {Prompt: 0.15, Completion: 0.60},
+		"my/custom":   {Prompt: 1, Completion: 1},
+	}
+	tests := []struct {
+		model  string
+		prompt float64
+		ok     bool
+	}{
+		{"gpt-4o", 2.50, true},
+		{"gpt-4o-mini", 0.15, true},
+		{"gpt-4o-mini-2024-07-18", 0.15, true},
+		{"gpt-4o-2024-08-06", 2.50, true},
+		{"openai/gpt-4o-mini", 0.15, true},
+		{"my/custom", 1, true},
+		{"llama3", 0, false},
+	}
+	for _, tt := range tests {
+		p, ok := table.Lookup(tt.model)
+		if ok != tt.ok || p.Prompt != tt.prompt {
+			t.Errorf("Lookup(%q) = %v, %v; want prompt %v, %v", tt.model, p, ok, tt.prompt, tt.ok)
+		}
+	}
+}
+
+func TestCostTracker_Metrics(t *testing.T) {
+	m := NewDevOpsClawMetrics()
+	tracker := NewCostTracker(PriceTable{"gpt-4o": {Prompt: 2.50, Completion: 10.00}})
+	tracker.SetMetrics(m)
+
+	cost, err := tracker.Record("gpt-4o", 10_000, 2_000)
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if math.Abs(cost-0.045) > 1e-12 {
+		t.Errorf("cost = %v, want 0.045", cost)
+	}
+	if _, err := tracker.Record("llama3", 100, 50); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if got := m.LLMTokens.With("gpt-4o", "prompt").Value(); got != 10_000 {
+		t.Errorf("prompt tokens = %d, want 10000", got)
+	}
+	if got := m.LLMTokens.With("llama3", "completion").Value(); got != 50 {
+		t.Errorf("unpriced completion tokens = %d, want 50", got)
+	}
+
+	w := httptest.NewRecorder()
+	MetricsHandler(m.Registry)(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE devopsclaw_llm_cost_usd_total counter\n",
+		`devopsclaw_llm_cost_usd_total{model="gpt-4o"} 0.045` + "\n",
+		`devopsclaw_llm_cost_usd_total{model="llama3"} 0` + "\n",
+		`devopsclaw_llm_tokens_total{model="gpt-4o",type="completion"} 2000` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition missing %q\ngot:\n%s", want, body)
+		}
+	}
+}
+
+func TestCostTracker_Ledger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "llm_costs.json")
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	tracker := NewCostTracker(PriceTable{"gpt-4o": {Prompt: 2.50, Completion: 10.00}})
+	tracker.SetLedger(path)
+	tracker.now = func() time.Time { return day1 }
+	for i := 0; i < 2; i++ {
+		if _, err := tracker.Record("gpt-4o", 10_000, 2_000); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if _, err := tracker.Record("llama3", 100, 50); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	ledger, err := ReadCostLedger(path)
+	if err != nil {
+		t.Fatalf("ReadCostLedger: %v", err)
+	}
+	day := ledger.Day(day1)
+	u := day.Models["gpt-4o"]
+	if u == nil || u.Calls != 2 || u.PromptTokens != 20_000 || u.CompletionTokens != 4_000 {
+		t.Fatalf("gpt-4o usage = %+v", u)
+	}
+	if math.Abs(day.TotalUSD()-0.09) > 1e-12 {
+		t.Errorf("TotalUSD = %v, want 0.09", day.TotalUSD())
+	}
+	if !day.Models["llama3"].Unpriced {
+		t.Error("llama3 should be marked unpriced")
+	}
+	if names := day.ModelNames(); names[0] != "gpt-4o" {
+		t.Errorf("ModelNames = %v, want gpt-4o first", names)
+	}
+
+	// A call more than costLedgerDays later drops the old day.
+	later := day1.AddDate(0, 0, costLedgerDays+1)
+	tracker.now = func() time.Time { return later }
+	if _, err := tracker.Record("gpt-4o", 1, 1); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	ledger, err = ReadCostLedger(path)
+	if err != nil {
+		t.Fatalf("ReadCostLedger: %v", err)
+	}
+	if len(ledger.Days) != 1 || len(ledger.Day(day1).Models) != 0 {
+		t.Errorf("expired day kept: %v", ledger.Days)
+	}
+}
+
+func TestReadCostLedger_Missing(t *testing.T) {
+	ledger, err := ReadCostLedger(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatalf("ReadCostLedger: %v", err)
+	}
+	if got := ledger.Day(time.Now()).TotalUSD(); got != 0 {
+		t.Errorf("TotalUSD = %v, want 0", got)
+	}
+}
@@ -7,15 +7,24 @@
 package observability
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/redact"
 )
 
 // ------------------------------------------------------------------
@@ -41,18 +50,22 @@ type Metric struct {
 
 // MetricsRegistry collects and exposes application metrics.
 type MetricsRegistry struct {
-	mu         sync.RWMutex
-	counters   map[string]*Counter
-	gauges     map[string]*Gauge
-	histograms map[string]*Histogram
+	mu               sync.RWMutex
+	counters         map[string]*Counter
+	counterVecs      map[string]*CounterVec
+	floatCounterVecs map[string]*FloatCounterVec
+	gauges           map[string]*Gauge
+	histograms       map[string]*Histogram
 }
 
 // NewMetricsRegistry creates a metrics registry.
 func NewMetricsRegistry() *MetricsRegistry {
 	return &MetricsRegistry{
-		counters:   make(map[string]*Counter),
-		gauges:     make(map[string]*Gauge),
-		histograms: make(map[string]*Histogram),
+		counters:         make(map[string]*Counter),
+		counterVecs:      make(map[string]*CounterVec),
+		floatCounterVecs: make(map[string]*FloatCounterVec),
+		gauges:           make(map[string]*Gauge),
+		histograms:       make(map[string]*Histogram),
 	}
 }
 
@@ -63,6 +76,45 @@ type Counter struct {
 	value atomic.Int64
 }
 
+// CounterVec is a family of counters that share a name and label names,
+// with one counter per distinct set of label values, e.g.
+// devopsclaw_provider_calls_total{provider="openai"}.
+type CounterVec struct {
+	name       string
+	desc       string
+	labelNames []string
+
+	mu       sync.RWMutex
+	children map[string]*labeledCounter // keyed by joined label values
+}
+
+type labeledCounter struct {
+	values  []string
+	counter *Counter
+}
+
+// FloatCounter is a counter with a fractional value, such as a cost in
+// USD.
+type FloatCounter struct {
+	bits atomic.Uint64 // float64 bits
+}
+
+// FloatCounterVec is a CounterVec of FloatCounters, e.g.
+// devopsclaw_llm_cost_usd_total{model="gpt-4o"}.
+type FloatCounterVec struct {
+	name       string
+	desc       string
+	labelNames []string
+
+	mu       sync.RWMutex
+	children map[string]*labeledFloatCounter // keyed by joined label values
+}
+
+type labeledFloatCounter struct {
+	values  []string
+	counter *FloatCounter
+}
+
 // Gauge is a metric that can go up and down.
 type Gauge struct {
 	name  string
@@ -99,6 +151,56 @@ func (r *MetricsRegistry) GetCounter(name, description string) *Counter {
 	return c
 }
 
+// GetCounterVec returns (or creates) a counter vector with the given label
+// names. A second call with the same name returns the existing vector and
+// ignores labelNames.
+func (r *MetricsRegistry) GetCounterVec(name, description string, labelNames []string) *CounterVec {
+	r.mu.RLock()
+	v, ok := r.counterVecs[name]
+	r.mu.RUnlock()
+	if ok {
+		return v
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok = r.counterVecs[name]; ok {
+		return v
+	}
+	v = &CounterVec{
+		name:       name,
+		desc:       description,
+		labelNames: append([]string(nil), labelNames...),
+		children:   make(map[string]*labeledCounter),
+	}
+	r.counterVecs[name] = v
+	return v
+}
+
+// GetFloatCounterVec returns (or creates) a float counter vector with the
+// given label names. Like GetCounterVec, a second call with the same name
+// ignores labelNames.
+func (r *MetricsRegistry) GetFloatCounterVec(name, description string, labelNames []string) *FloatCounterVec {
+	r.mu.RLock()
+	v, ok := r.floatCounterVecs[name]
+	r.mu.RUnlock()
+	if ok {
+		return v
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok = r.floatCounterVecs[name]; ok {
+		return v
+	}
+	v = &FloatCounterVec{
+		name:       name,
+		desc:       description,
+		labelNames: append([]string(nil), labelNames...),
+		children:   make(map[string]*labeledFloatCounter),
+	}
+	r.floatCounterVecs[name] = v
+	return v
+}
+
 // GetGauge returns (or creates) a gauge metric.
 func (r *MetricsRegistry) GetGauge(name, description string) *Gauge {
 	r.mu.RLock()
@@ -145,6 +247,120 @@ func (c *Counter) Add(n int64) { c.value.Add(n) }
 // Value returns the counter's current value.
 func (c *Counter) Value() int64 { return c.value.Load() }
 
+// With returns the counter for the given label values, given in the order
+// of the vector's label names, creating it at zero on first use. It panics
+// if the number of values does not match the number of label names.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("observability: %s has %d label(s), got %d value(s)", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child.counter
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[key]; ok {
+		return child.counter
+	}
+	child = &labeledCounter{
+		values:  append([]string(nil), labelValues...),
+		counter: &Counter{name: v.name, desc: v.desc},
+	}
+	v.children[key] = child
+	return child.counter
+}
+
+// sortedChildren returns the vector's counters ordered by label values,
+// each with its rendered label set.
+func (v *CounterVec) sortedChildren() (labels []string, counters []*Counter) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, key := range sortedKeys(v.children) {
+		child := v.children[key]
+		labels = append(labels, formatLabels(v.labelNames, child.values))
+		counters = append(counters, child.counter)
+	}
+	return labels, counters
+}
+
+// Add increments the counter by v, which must not be negative.
+func (c *FloatCounter) Add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Value returns the counter's current value.
+func (c *FloatCounter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+// With returns the counter for the given label values, as CounterVec.With
+// does.
+func (v *FloatCounterVec) With(labelValues ...string) *FloatCounter {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("observability: %s has %d label(s), got %d value(s)", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child.counter
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[key]; ok {
+		return child.counter
+	}
+	child = &labeledFloatCounter{
+		values:  append([]string(nil), labelValues...),
+		counter: &FloatCounter{},
+	}
+	v.children[key] = child
+	return child.counter
+}
+
+// sortedChildren returns the vector's counters ordered by label values,
+// each with its rendered label set.
+func (v *FloatCounterVec) sortedChildren() (labels []string, counters []*FloatCounter) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, key := range sortedKeys(v.children) {
+		child := v.children[key]
+		labels = append(labels, formatLabels(v.labelNames, child.values))
+		counters = append(counters, child.counter)
+	}
+	return labels, counters
+}
+
+// formatLabels renders a Prometheus label set such as {provider="openai"}.
+func formatLabels(names, values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelValueEscaper applies the exposition format's label value escaping.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
 // Set sets the gauge value.
 func (g *Gauge) Set(v int64) { g.value.Store(v) }
 
@@ -187,6 +403,8 @@ type DevOpsClawMetrics struct {
 	LLMCalls          *Counter
 	LLMErrors         *Counter
 	LLMLatency        *Histogram
+	LLMTokens         *CounterVec      // by model and type (prompt, completion)
+	LLMCost           *FloatCounterVec // USD, by model
 	ToolCalls         *Counter
 	ToolErrors        *Counter
 	ToolLatency       *Histogram
@@ -198,6 +416,7 @@ type DevOpsClawMetrics struct {
 	FleetExecTotal    *Counter
 	FleetExecErrors   *Counter
 	FleetExecLatency  *Histogram
+	FleetDispatchWait *Histogram
 
 	// Channels
 	ChannelMessages   *Counter
@@ -212,6 +431,8 @@ type DevOpsClawMetrics struct {
 	CircuitBreakerTrips  *Counter
 	RateLimitRejects     *Counter
 	BulkheadRejects      *Counter
+	BulkheadWaiters      *Gauge
+	BulkheadWaitTime     *Histogram
 	RetryAttempts        *Counter
 
 	// System
@@ -234,6 +455,8 @@ func NewDevOpsClawMetrics() *DevOpsClawMetrics {
 		LLMCalls:          r.GetCounter("devopsclaw_llm_calls_total", "Total LLM API calls"),
 		LLMErrors:         r.GetCounter("devopsclaw_llm_errors_total", "Total LLM API errors"),
 		LLMLatency:        r.GetHistogram("devopsclaw_llm_latency_seconds", "LLM call latency", latencyBuckets),
+		LLMTokens:         r.GetCounterVec("devopsclaw_llm_tokens_total", "LLM tokens used", []string{"model", "type"}),
+		LLMCost:           r.GetFloatCounterVec("devopsclaw_llm_cost_usd_total", "LLM spend in USD", []string{"model"}),
 		ToolCalls:         r.GetCounter("devopsclaw_tool_calls_total", "Total tool executions"),
 		ToolErrors:        r.GetCounter("devopsclaw_tool_errors_total", "Total tool execution errors"),
 		ToolLatency:       r.GetHistogram("devopsclaw_tool_latency_seconds", "Tool execution latency", latencyBuckets),
@@ -244,6 +467,8 @@ func NewDevOpsClawMetrics() *DevOpsClawMetrics {
 		FleetExecTotal:    r.GetCounter("devopsclaw_fleet_exec_total", "Total fleet command executions"),
 		FleetExecErrors:   r.GetCounter("devopsclaw_fleet_exec_errors_total", "Total fleet execution errors"),
 		FleetExecLatency:  r.GetHistogram("devopsclaw_fleet_exec_latency_seconds", "Fleet execution latency", latencyBuckets),
+		FleetDispatchWait: r.GetHistogram("devopsclaw_fleet_dispatch_wait_seconds", "Time fleet nodes waited on a dispatch rate limit",
+			[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}),
 
 		ChannelMessages:   r.GetCounter("devopsclaw_channel_messages_total", "Total channel messages"),
 		ChannelErrors:     r.GetCounter("devopsclaw_channel_errors_total", "Total channel errors"),
@@ -255,6 +480,9 @@ func NewDevOpsClawMetrics() *DevOpsClawMetrics {
 		CircuitBreakerTrips: r.GetCounter("devopsclaw_circuit_breaker_trips_total", "Circuit breaker trip events"),
 		RateLimitRejects:    r.GetCounter("devopsclaw_rate_limit_rejects_total", "Rate limit rejections"),
 		BulkheadRejects:     r.GetCounter("devopsclaw_bulkhead_rejects_total", "Bulkhead rejections"),
+		BulkheadWaiters:     r.GetGauge("devopsclaw_bulkhead_waiters", "Callers queued for a bulkhead slot"),
+		BulkheadWaitTime:    r.GetHistogram("devopsclaw_bulkhead_wait_seconds", "Time spent waiting for a bulkhead slot",
+			[]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}),
 		RetryAttempts:       r.GetCounter("devopsclaw_retry_attempts_total", "Retry attempts"),
 
 		Uptime:         r.GetGauge("devopsclaw_uptime_seconds", "Process uptime in seconds"),
@@ -262,45 +490,210 @@ func NewDevOpsClawMetrics() *DevOpsClawMetrics {
 	}
 }
 
+// ObserveBulkheadWait records one bulkhead wait and the queue depth left
+// behind it. Its signature matches resilience.WithWaitObserver.
+func (m *DevOpsClawMetrics) ObserveBulkheadWait(name string, wait time.Duration, waiters int) {
+	m.BulkheadWaitTime.Observe(wait.Seconds())
+	m.BulkheadWaiters.Set(int64(waiters))
+}
+
+// ObserveDispatchWait records one fleet node held back by a dispatch rate
+// limit and how long it waited. Its signature matches
+// fleet.Executor.SetDispatchWaitObserver.
+func (m *DevOpsClawMetrics) ObserveDispatchWait(key string, wait time.Duration) {
+	m.RateLimitRejects.Inc()
+	m.FleetDispatchWait.Observe(wait.Seconds())
+}
+
+// CircuitBreakerState returns the gauge holding a breaker's current state
+// (0=closed, 1=half-open, 2=open). The registry has no labels, so the
+// breaker name is folded into the metric name:
+// devopsclaw_circuit_breaker_state_<name>.
+func (m *DevOpsClawMetrics) CircuitBreakerState(name string) *Gauge {
+	return m.Registry.GetGauge("devopsclaw_circuit_breaker_state_"+metricNameSuffix(name),
+		fmt.Sprintf("Circuit breaker %s state (0=closed, 1=half-open, 2=open)", name))
+}
+
+// metricNameSuffix maps s onto the Prometheus metric name alphabet,
+// lowercased, with every other character replaced by "_".
+func metricNameSuffix(s string) string {
+	b := []byte(strings.ToLower(s))
+	for i, c := range b {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
 // ------------------------------------------------------------------
 // Metrics HTTP endpoint (Prometheus-compatible)
 // ------------------------------------------------------------------
 
+// DefaultMetricsCacheTTL is a scrape-friendly cache window: short enough
+// that metrics stay fresh, long enough that several Prometheus replicas
+// scraping at once share one render.
+const DefaultMetricsCacheTTL = time.Second
+
+// MetricsHandlerOption configures MetricsHandler.
+type MetricsHandlerOption func(*metricsHandler)
+
+// WithMetricsGzip compresses the exposition when the scraper sends
+// Accept-Encoding: gzip.
+func WithMetricsGzip() MetricsHandlerOption {
+	return func(h *metricsHandler) { h.gzip = true }
+}
+
+// WithMetricsCache reuses the rendered exposition for ttl instead of
+// walking the registry on every scrape. A ttl of zero disables caching.
+func WithMetricsCache(ttl time.Duration) MetricsHandlerOption {
+	return func(h *metricsHandler) { h.cacheTTL = ttl }
+}
+
+// metricsHandler renders the registry and caches the last exposition.
+type metricsHandler struct {
+	registry *MetricsRegistry
+	gzip     bool
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	body       []byte
+	gzipBody   []byte // compressed lazily from body
+	renderedAt time.Time
+}
+
 // MetricsHandler returns an HTTP handler that exports metrics in
-// Prometheus exposition format.
-func MetricsHandler(registry *MetricsRegistry) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-
-		registry.mu.RLock()
-		defer registry.mu.RUnlock()
-
-		for _, c := range registry.counters {
-			fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.desc)
-			fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
-			fmt.Fprintf(w, "%s %d\n", c.name, c.value.Load())
+// Prometheus exposition format. By default every scrape renders the
+// registry uncompressed; see WithMetricsGzip and WithMetricsCache.
+func MetricsHandler(registry *MetricsRegistry, opts ...MetricsHandlerOption) http.HandlerFunc {
+	h := &metricsHandler{registry: registry, now: time.Now}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h.serveHTTP
+}
+
+func (h *metricsHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if h.gzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			body, err := h.compressed()
+			if err == nil {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(body)
+				return
+			}
 		}
-		for _, g := range registry.gauges {
-			fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.desc)
-			fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
-			fmt.Fprintf(w, "%s %d\n", g.name, g.value.Load())
+	}
+	w.Write(h.exposition())
+}
+
+// exposition returns the rendered registry. Concurrent scrapes of an
+// expired cache wait on one render rather than each taking the registry
+// locks.
+func (h *metricsHandler) exposition() []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.currentLocked()
+}
+
+// compressed returns the gzipped exposition, compressing at most once per
+// cached render.
+func (h *metricsHandler) compressed() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	body := h.currentLocked()
+	if h.gzipBody != nil {
+		return h.gzipBody, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if h.cacheTTL > 0 {
+		h.gzipBody = buf.Bytes()
+	}
+	return buf.Bytes(), nil
+}
+
+// currentLocked returns the cached exposition, rendering a fresh one when
+// caching is off or the window has expired. h.mu must be held.
+func (h *metricsHandler) currentLocked() []byte {
+	if h.body != nil && h.cacheTTL > 0 && h.now().Sub(h.renderedAt) < h.cacheTTL {
+		return h.body
+	}
+	var buf bytes.Buffer
+	writeExposition(&buf, h.registry)
+	h.body = buf.Bytes()
+	h.gzipBody = nil
+	h.renderedAt = h.now()
+	return h.body
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
 		}
-		for _, h := range registry.histograms {
-			fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.desc)
-			fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
-			h.mu.Lock()
-			cumulative := int64(0)
-			for i, b := range h.buckets {
-				cumulative += h.counts[i]
-				fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, b, cumulative)
-			}
-			cumulative += h.counts[len(h.buckets)]
-			fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, cumulative)
-			fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
-			fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
-			h.mu.Unlock()
+	}
+	return false
+}
+
+// writeExposition writes the registry in Prometheus text format.
+func writeExposition(w io.Writer, registry *MetricsRegistry) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for _, c := range registry.counters {
+		fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.desc)
+		fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+		fmt.Fprintf(w, "%s %d\n", c.name, c.value.Load())
+	}
+	for _, v := range registry.counterVecs {
+		fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.desc)
+		fmt.Fprintf(w, "# TYPE %s counter\n", v.name)
+		labels, counters := v.sortedChildren()
+		for i, c := range counters {
+			fmt.Fprintf(w, "%s%s %d\n", v.name, labels[i], c.Value())
 		}
 	}
+	for _, v := range registry.floatCounterVecs {
+		fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.desc)
+		fmt.Fprintf(w, "# TYPE %s counter\n", v.name)
+		labels, counters := v.sortedChildren()
+		for i, c := range counters {
+			fmt.Fprintf(w, "%s%s %g\n", v.name, labels[i], c.Value())
+		}
+	}
+	for _, g := range registry.gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.desc)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+		fmt.Fprintf(w, "%s %d\n", g.name, g.value.Load())
+	}
+	for _, h := range registry.histograms {
+		fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.desc)
+		fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+		h.mu.Lock()
+		cumulative := int64(0)
+		for i, b := range h.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, b, cumulative)
+		}
+		cumulative += h.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, cumulative)
+		fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+		fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+		h.mu.Unlock()
+	}
 }
 
 // ------------------------------------------------------------------
@@ -334,6 +727,7 @@ type Tracer struct {
 	spans    []*Span
 	maxSpans int
 	logger   *slog.Logger
+	exporter *otlpExporter // nil unless WithOTLPExporter was called
 }
 
 // NewTracer creates a tracer.
@@ -353,8 +747,8 @@ type traceContextKey struct{}
 // StartSpan begins a new span and attaches it to the context.
 func (t *Tracer) StartSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, *Span) {
 	span := &Span{
-		TraceID:    generateID(),
-		SpanID:     generateID(),
+		TraceID:    randomHexID(16),
+		SpanID:     randomHexID(8),
 		Name:       name,
 		StartTime:  time.Now(),
 		Status:     "ok",
@@ -370,6 +764,12 @@ func (t *Tracer) StartSpan(ctx context.Context, name string, attrs map[string]st
 	return context.WithValue(ctx, traceContextKey{}, span), span
 }
 
+// SpanFromContext returns the span StartSpan attached to ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(traceContextKey{}).(*Span)
+	return span
+}
+
 // EndSpan completes a span and records it.
 func (t *Tracer) EndSpan(span *Span, err error) {
 	span.EndTime = time.Now()
@@ -386,6 +786,10 @@ func (t *Tracer) EndSpan(span *Span, err error) {
 	t.spans = append(t.spans, span)
 	t.mu.Unlock()
 
+	if t.exporter != nil {
+		t.exporter.enqueue(span)
+	}
+
 	t.logger.Debug("span completed",
 		"trace_id", span.TraceID,
 		"span_id", span.SpanID,
@@ -460,34 +864,73 @@ type TaskRecord struct {
 	Metadata    map[string]string      `json:"metadata,omitempty"`
 }
 
-// TaskHistory stores and queries task execution records.
+// TaskStore records and queries task history. TaskHistory keeps records
+// in memory; SQLiteTaskHistory persists them across restarts.
+type TaskStore interface {
+	Record(rec *TaskRecord)
+	Query(opts TaskQueryOptions) []*TaskRecord
+}
+
+// TaskHistory stores and queries task execution records in memory.
 type TaskHistory struct {
-	mu      sync.Mutex
-	records []*TaskRecord
-	maxSize int
+	mu       sync.Mutex
+	records  []*TaskRecord
+	maxSize  int
+	redactor *redact.Redactor
 }
 
-// NewTaskHistory creates a task history store.
+// NewTaskHistory creates a task history store. Secrets matching
+// redact.DefaultPatterns are masked in recorded inputs and outputs.
 func NewTaskHistory(maxSize int) *TaskHistory {
 	if maxSize <= 0 {
 		maxSize = 50000
 	}
 	return &TaskHistory{
-		records: make([]*TaskRecord, 0, maxSize),
-		maxSize: maxSize,
+		records:  make([]*TaskRecord, 0, maxSize),
+		maxSize:  maxSize,
+		redactor: redact.Default(),
 	}
 }
 
-// Record adds a task record.
+// SetRedactor replaces the redactor applied by Record. A nil redactor
+// records tasks unchanged.
+func (th *TaskHistory) SetRedactor(r *redact.Redactor) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.redactor = r
+}
+
+// Record adds a task record, masking secrets in its Input, Output and
+// Error. The caller's record is not modified.
 func (th *TaskHistory) Record(rec *TaskRecord) {
 	th.mu.Lock()
 	defer th.mu.Unlock()
+	rec = redactTaskRecord(th.redactor, rec)
 	if len(th.records) >= th.maxSize {
 		th.records = th.records[th.maxSize/10:]
 	}
 	th.records = append(th.records, rec)
 }
 
+// redactTaskRecord returns a copy of rec with secrets masked in its Input,
+// Output and Error, or rec itself when r is nil.
+func redactTaskRecord(r *redact.Redactor, rec *TaskRecord) *TaskRecord {
+	if r == nil {
+		return rec
+	}
+	c := *rec
+	if !r.Skips("input") {
+		c.Input = r.JSON(c.Input)
+	}
+	if !r.Skips("output") {
+		c.Output = r.JSON(c.Output)
+	}
+	if !r.Skips("error") {
+		c.Error = r.String(c.Error)
+	}
+	return &c
+}
+
 // Query returns records matching the filter.
 func (th *TaskHistory) Query(opts TaskQueryOptions) []*TaskRecord {
 	th.mu.Lock()
@@ -536,3 +979,13 @@ var idCounter atomic.Int64
 func generateID() string {
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), idCounter.Add(1))
 }
+
+// randomHexID returns n random bytes hex-encoded, the W3C/OpenTelemetry
+// format for trace (16 bytes) and span (8 bytes) IDs.
+func randomHexID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return otlpID(generateID(), n)
+	}
+	return hex.EncodeToString(b)
+}
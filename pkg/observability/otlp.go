@@ -0,0 +1,354 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OTLP exporter defaults.
+const (
+	DefaultOTLPQueueSize     = 2048
+	DefaultOTLPBatchSize     = 256
+	DefaultOTLPFlushInterval = 5 * time.Second
+
+	otlpTracesPath   = "/v1/traces"
+	otlpServiceName  = "devopsclaw"
+	otlpTraceIDBytes = 16
+	otlpSpanIDBytes  = 8
+)
+
+// WithOTLPExporter makes t ship every completed span to an OTLP/HTTP
+// collector (JSON encoding) at endpoint. A bare endpoint such as
+// http://collector:4318 gets the standard /v1/traces path appended.
+// headers are sent with every request, e.g. for collector auth.
+//
+// Spans are queued on EndSpan and posted in batches by a background
+// goroutine; when the queue is full new spans are dropped rather than
+// blocking the caller. The ring buffer used by QuerySpans is unaffected.
+// Call Shutdown to flush queued spans before exit.
+func (t *Tracer) WithOTLPExporter(endpoint string, headers map[string]string) *Tracer {
+	t.exporter = newOTLPExporter(otlpTracesURL(endpoint), headers, t.logger)
+	go t.exporter.run()
+	return t
+}
+
+// Shutdown flushes spans still queued for export and stops the exporter.
+// It is a no-op when no exporter is configured.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+// DroppedSpans reports how many spans were discarded because the export
+// queue was full or the collector rejected them.
+func (t *Tracer) DroppedSpans() int64 {
+	if t.exporter == nil {
+		return 0
+	}
+	return t.exporter.dropped.Load()
+}
+
+// otlpExporter batches spans from a bounded queue and posts them to a
+// collector.
+type otlpExporter struct {
+	url           string
+	headers       map[string]string
+	client        *http.Client
+	logger        *slog.Logger
+	batchSize     int
+	flushInterval time.Duration
+
+	queue   chan *Span
+	dropped atomic.Int64
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+func newOTLPExporter(url string, headers map[string]string, logger *slog.Logger) *otlpExporter {
+	return &otlpExporter{
+		url:           url,
+		headers:       headers,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		logger:        logger,
+		batchSize:     DefaultOTLPBatchSize,
+		flushInterval: DefaultOTLPFlushInterval,
+		queue:         make(chan *Span, DefaultOTLPQueueSize),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// enqueue hands span to the exporter without blocking.
+func (e *otlpExporter) enqueue(span *Span) {
+	select {
+	case <-e.closing:
+		e.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case e.queue <- span:
+	default:
+		if e.dropped.Add(1) == 1 {
+			e.logger.Warn("otlp export queue full, dropping spans", "endpoint", e.url)
+		}
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(context.Background(), batch); err != nil {
+			e.dropped.Add(int64(len(batch)))
+			e.logger.Warn("otlp export failed", "endpoint", e.url, "spans", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.closing:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *otlpExporter) shutdown(ctx context.Context) error {
+	e.closeOnce.Do(func() { close(e.closing) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export posts one batch of spans.
+func (e *otlpExporter) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeOTLPSpans(spans))
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// otlpTracesURL appends the standard traces path to a bare collector
+// endpoint and leaves explicit paths alone.
+func otlpTracesURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Path != "" && u.Path != "/") {
+		return endpoint
+	}
+	u.Path = otlpTracesPath
+	return u.String()
+}
+
+// ------------------------------------------------------------------
+// OTLP/JSON encoding
+// ------------------------------------------------------------------
+
+// OTLP status codes and span kind.
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+
+	otlpKindInternal = 1
+)
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func encodeOTLPSpans(spans []*Span) otlpTracesRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		ps := otlpSpan{
+			TraceID:           otlpID(s.TraceID, otlpTraceIDBytes),
+			SpanID:            otlpID(s.SpanID, otlpSpanIDBytes),
+			Name:              s.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: unixNano(s.StartTime),
+			EndTimeUnixNano:   unixNano(s.EndTime),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.ParentID != "" {
+			ps.ParentSpanID = otlpID(s.ParentID, otlpSpanIDBytes)
+		}
+		for _, ev := range s.Events {
+			ps.Events = append(ps.Events, otlpEvent{
+				TimeUnixNano: unixNano(ev.Timestamp),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+			if s.Status == "error" && ev.Name == "error" {
+				ps.Status = otlpStatus{Code: otlpStatusError, Message: ev.Attributes["message"]}
+			}
+		}
+		if s.Status == "error" {
+			ps.Status.Code = otlpStatusError
+		}
+		out = append(out, ps)
+	}
+
+	return otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpAnyValue{StringValue: otlpServiceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: otlpServiceName},
+			Spans: out,
+		}},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attrs[k]}})
+	}
+	return out
+}
+
+// otlpID returns id as the lowercase hex OTLP expects for an ID of size
+// bytes. IDs minted by StartSpan already have that form; anything else
+// (e.g. a trace ID adopted from an upstream system) is hashed, so every
+// span sharing an ID still shares it after conversion.
+func otlpID(id string, size int) string {
+	if len(id) == size*2 {
+		if _, err := hex.DecodeString(id); err == nil {
+			return id
+		}
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:size])
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
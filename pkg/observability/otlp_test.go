@@ -0,0 +1,139 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracer_OTLPExport(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []otlpSpan
+		auth     string
+		path     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpTracesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				received = append(received, ss.Spans...)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(100, testLogger()).WithOTLPExporter(srv.URL, map[string]string{"Authorization": "Bearer t0k"})
+
+	ctx, parent := tracer.StartSpan(context.Background(), "deploy", map[string]string{"service": "api"})
+	_, child := tracer.StartSpan(ctx, "batch", nil)
+	tracer.EndSpan(child, errors.New("health check failed"))
+	tracer.EndSpan(parent, nil)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" {
+		t.Errorf("path = %q, want /v1/traces", path)
+	}
+	if auth != "Bearer t0k" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(received) != 2 {
+		t.Fatalf("received %d spans, want 2", len(received))
+	}
+	gotChild, gotParent := received[0], received[1]
+	if len(gotParent.TraceID) != 32 || len(gotParent.SpanID) != 16 {
+		t.Errorf("ids not OTLP sized: trace=%q span=%q", gotParent.TraceID, gotParent.SpanID)
+	}
+	if gotParent.TraceID != parent.TraceID || gotParent.SpanID != parent.SpanID {
+		t.Error("parent ids changed in export")
+	}
+	if gotChild.TraceID != gotParent.TraceID || gotChild.ParentSpanID != gotParent.SpanID {
+		t.Errorf("child not linked to parent: %+v", gotChild)
+	}
+	if gotParent.ParentSpanID != "" {
+		t.Errorf("root span has parent %q", gotParent.ParentSpanID)
+	}
+	if gotChild.Status.Code != otlpStatusError || gotChild.Status.Message != "health check failed" {
+		t.Errorf("child status = %+v", gotChild.Status)
+	}
+	if gotParent.Status.Code != otlpStatusOK {
+		t.Errorf("parent status = %+v", gotParent.Status)
+	}
+	if len(gotParent.Attributes) != 1 || gotParent.Attributes[0].Key != "service" || gotParent.Attributes[0].Value.StringValue != "api" {
+		t.Errorf("attributes = %+v", gotParent.Attributes)
+	}
+
+	// The local ring buffer still serves queries.
+	if n := len(tracer.QuerySpans(SpanQueryOptions{TraceID: parent.TraceID})); n != 2 {
+		t.Errorf("QuerySpans returned %d spans, want 2", n)
+	}
+}
+
+func TestTracer_OTLPExportNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tracer := NewTracer(100, testLogger()).WithOTLPExporter(srv.URL, nil)
+
+	start := time.Now()
+	total := DefaultOTLPBatchSize + DefaultOTLPQueueSize + 100
+	for i := 0; i < total; i++ {
+		_, span := tracer.StartSpan(context.Background(), "op", nil)
+		tracer.EndSpan(span, nil)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("EndSpan stalled behind a slow collector: %s", elapsed)
+	}
+	if tracer.DroppedSpans() == 0 {
+		t.Error("expected spans to be dropped once the queue filled")
+	}
+}
+
+func TestOTLPTracesURL(t *testing.T) {
+	tests := map[string]string{
+		"http://collector:4318":                "http://collector:4318/v1/traces",
+		"http://collector:4318/":               "http://collector:4318/v1/traces",
+		"https://otlp.example.com/custom/path": "https://otlp.example.com/custom/path",
+	}
+	for in, want := range tests {
+		if got := otlpTracesURL(in); got != want {
+			t.Errorf("otlpTracesURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestOTLPID(t *testing.T) {
+	hexID := "0123456789abcdef0123456789abcdef"
+	if got := otlpID(hexID, 16); got != hexID {
+		t.Errorf("valid id rewritten: %q", got)
+	}
+	legacy := otlpID("1700000000-42", 8)
+	if len(legacy) != 16 {
+		t.Errorf("converted id length = %d, want 16", len(legacy))
+	}
+	if otlpID("1700000000-42", 8) != legacy {
+		t.Error("conversion is not deterministic")
+	}
+}
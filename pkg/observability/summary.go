@@ -0,0 +1,136 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+)
+
+// summaryQuantiles are the percentiles MetricsSummaryHandler reports for
+// each histogram.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// MetricsSummaryHandler returns an HTTP handler that renders the registry
+// as a human-readable table: counter (one row per label set for counter
+// vectors) and gauge values, and for each histogram its count, mean and
+// approximate p50/p90/p99. It is meant for
+// curl while debugging without a Prometheus server; scrape MetricsHandler
+// instead.
+func MetricsSummaryHandler(registry *MetricsRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeSummary(w, registry)
+	}
+}
+
+// Quantile estimates the q-quantile (0 ≤ q ≤ 1) of the observed values the
+// way Prometheus's histogram_quantile does: find the bucket holding the
+// rank and interpolate linearly inside it, treating the first bucket as
+// starting at zero. Values in the +Inf bucket report the highest finite
+// bound. It returns NaN when nothing has been observed.
+func (h *Histogram) Quantile(q float64) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return bucketQuantile(q, h.buckets, h.counts, h.count)
+}
+
+func bucketQuantile(q float64, bounds []float64, counts []int64, total int64) float64 {
+	if total == 0 || len(bounds) == 0 {
+		return math.NaN()
+	}
+	q = math.Max(0, math.Min(1, q))
+	rank := q * float64(total)
+
+	var cumulative int64
+	for i, upper := range bounds {
+		prev := cumulative
+		cumulative += counts[i]
+		if float64(cumulative) < rank || counts[i] == 0 {
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		} else if upper <= 0 {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(prev))/float64(counts[i])
+	}
+	return bounds[len(bounds)-1]
+}
+
+// writeSummary renders the registry for MetricsSummaryHandler, each
+// section sorted by metric name.
+func writeSummary(w io.Writer, registry *MetricsRegistry) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	names := sortedKeys(registry.counters)
+	if len(names) > 0 || len(registry.counterVecs) > 0 || len(registry.floatCounterVecs) > 0 {
+		fmt.Fprintln(tw, "COUNTER\tVALUE")
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%d\n", name, registry.counters[name].Value())
+		}
+		for _, name := range sortedKeys(registry.counterVecs) {
+			labels, counters := registry.counterVecs[name].sortedChildren()
+			for i, c := range counters {
+				fmt.Fprintf(tw, "%s%s\t%d\n", name, labels[i], c.Value())
+			}
+		}
+		for _, name := range sortedKeys(registry.floatCounterVecs) {
+			labels, counters := registry.floatCounterVecs[name].sortedChildren()
+			for i, c := range counters {
+				fmt.Fprintf(tw, "%s%s\t%.4g\n", name, labels[i], c.Value())
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+
+	names = sortedKeys(registry.gauges)
+	if len(names) > 0 {
+		fmt.Fprintln(tw, "GAUGE\tVALUE")
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%d\n", name, registry.gauges[name].Value())
+		}
+		fmt.Fprintln(tw)
+	}
+
+	names = sortedKeys(registry.histograms)
+	if len(names) > 0 {
+		fmt.Fprintln(tw, "HISTOGRAM\tCOUNT\tMEAN\tP50\tP90\tP99")
+		for _, name := range names {
+			h := registry.histograms[name]
+			h.mu.Lock()
+			count, sum := h.count, h.sum
+			row := fmt.Sprintf("%s\t%d\t%s", name, count, summaryValue(sum/float64(count), count))
+			for _, q := range summaryQuantiles {
+				row += "\t" + summaryValue(bucketQuantile(q, h.buckets, h.counts, count), count)
+			}
+			h.mu.Unlock()
+			fmt.Fprintln(tw, row)
+		}
+	}
+}
+
+// summaryValue formats a summary statistic, or "-" for an empty histogram.
+func summaryValue(v float64, count int64) string {
+	if count == 0 || math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.4g", v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
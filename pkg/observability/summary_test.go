@@ -0,0 +1,97 @@
+package observability
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	r := NewMetricsRegistry()
+	h := r.GetHistogram("test_latency_ms", "Latency", []float64{10, 25, 50, 100, 250})
+	if q := h.Quantile(0.99); !math.IsNaN(q) {
+		t.Errorf("empty histogram p99 = %v, want NaN", q)
+	}
+
+	// 1..100 ms, evenly spread: half the observations sit in (50, 100].
+	for v := 1; v <= 100; v++ {
+		h.Observe(float64(v))
+	}
+
+	tests := []struct {
+		q, lo, hi float64
+	}{
+		{0.5, 25, 50},
+		{0.9, 50, 100},
+		{0.99, 50, 100},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if got < tt.lo || got > tt.hi {
+			t.Errorf("p%g = %v, want within bucket (%v, %v]", tt.q*100, got, tt.lo, tt.hi)
+		}
+	}
+	// Linear interpolation inside (50, 100]: rank 99 is the 49th of 50.
+	if got := h.Quantile(0.99); math.Abs(got-99) > 0.01 {
+		t.Errorf("p99 = %v, want 99", got)
+	}
+
+	// Outliers past the last bucket report its bound.
+	h.Observe(1000)
+	h.Observe(2000)
+	if got := h.Quantile(1); got != 250 {
+		t.Errorf("p100 = %v, want the highest finite bound 250", got)
+	}
+}
+
+func TestMetricsSummaryHandler(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.GetCounter("test_requests_total", "Total requests").Add(42)
+	r.GetGauge("test_active", "Active connections").Set(5)
+	h := r.GetHistogram("test_latency_seconds", "Request latency", []float64{0.1, 0.5, 1.0})
+	for i := 0; i < 10; i++ {
+		h.Observe(0.3)
+	}
+	r.GetHistogram("test_idle_seconds", "Never observed", []float64{1})
+
+	w := httptest.NewRecorder()
+	MetricsSummaryHandler(r)(w, httptest.NewRequest(http.MethodGet, "/metrics/summary", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"COUNTER              VALUE\ntest_requests_total  42\n",
+		"GAUGE        VALUE\ntest_active  5\n",
+		"HISTOGRAM",
+		"P50", "P90", "P99",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("summary missing %q:\n%s", want, body)
+		}
+	}
+
+	lines := strings.Split(body, "\n")
+	var idle, latency []string
+	for _, line := range lines {
+		switch fields := strings.Fields(line); {
+		case len(fields) > 0 && fields[0] == "test_idle_seconds":
+			idle = fields
+		case len(fields) > 0 && fields[0] == "test_latency_seconds":
+			latency = fields
+		}
+	}
+	if strings.Join(idle, " ") != "test_idle_seconds 0 - - - -" {
+		t.Errorf("idle row = %q, want dashes for an empty histogram", idle)
+	}
+	// All ten observations are in (0.1, 0.5]: count 10, mean 0.3.
+	if len(latency) != 6 || latency[1] != "10" || latency[2] != "0.3" || latency[5] != "0.496" {
+		t.Errorf("latency row = %q, want count 10, mean 0.3, p99 0.496", latency)
+	}
+	if strings.Index(body, "test_idle_seconds") > strings.Index(body, "test_latency_seconds") {
+		t.Error("histograms should be sorted by name")
+	}
+}
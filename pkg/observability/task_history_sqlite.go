@@ -0,0 +1,265 @@
+package observability
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/redact"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver (no CGo)
+)
+
+// TaskRetention bounds how much history SQLiteTaskHistory keeps. Records
+// older than MaxAge, and the oldest records beyond MaxCount, are deleted
+// as new ones arrive. Zero fields do not limit.
+type TaskRetention struct {
+	MaxAge   time.Duration
+	MaxCount int
+}
+
+// SQLiteTaskHistory is a TaskStore persisted to SQLite, so replayable
+// history survives restarts. Secrets are masked as in TaskHistory.
+//
+// Record and Query satisfy TaskStore and log errors; RecordContext and
+// QueryContext return them.
+type SQLiteTaskHistory struct {
+	db        *sql.DB
+	retention TaskRetention
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	redactor *redact.Redactor
+}
+
+// NewSQLiteTaskHistory opens or creates the task history database at
+// dbPath (":memory:" for tests). A nil logger uses slog.Default().
+func NewSQLiteTaskHistory(dbPath string, retention TaskRetention, logger *slog.Logger) (*SQLiteTaskHistory, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	// modernc only applies pragmas spelled _pragma=name(value).
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", dbPath, err)
+	}
+	// One connection: ":memory:" databases are per connection, and writes
+	// are serialized by SQLite anyway.
+	db.SetMaxOpenConns(1)
+
+	h := &SQLiteTaskHistory{
+		db:        db,
+		retention: retention,
+		logger:    logger,
+		redactor:  redact.Default(),
+	}
+	if err := h.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return h, nil
+}
+
+func (h *SQLiteTaskHistory) migrate() error {
+	migrations := []string{
+		`CREATE TABLE IF NOT EXISTS task_history (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			id TEXT NOT NULL,
+			trace_id TEXT NOT NULL DEFAULT '',
+			user_id TEXT NOT NULL DEFAULT '',
+			channel TEXT NOT NULL DEFAULT '',
+			agent_id TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL DEFAULT '',
+			input TEXT,
+			output TEXT,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ns INTEGER NOT NULL DEFAULT 0,
+			timestamp INTEGER NOT NULL, -- unix nanoseconds
+			metadata TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_history_user ON task_history(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_history_agent ON task_history(agent_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_history_action ON task_history(action)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_history_timestamp ON task_history(timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_history_trace ON task_history(trace_id)`,
+	}
+	for _, m := range migrations {
+		if _, err := h.db.Exec(m); err != nil {
+			return fmt.Errorf("migration failed: %w\nSQL: %s", err, m)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (h *SQLiteTaskHistory) Close() error {
+	return h.db.Close()
+}
+
+// SetRedactor replaces the redactor applied by Record. A nil redactor
+// records tasks unchanged.
+func (h *SQLiteTaskHistory) SetRedactor(r *redact.Redactor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.redactor = r
+}
+
+// Record stores rec, logging any error.
+func (h *SQLiteTaskHistory) Record(rec *TaskRecord) {
+	if err := h.RecordContext(context.Background(), rec); err != nil {
+		h.logger.Warn("task history: record failed", "id", rec.ID, "error", err)
+	}
+}
+
+// RecordContext stores rec with secrets masked, then applies the retention
+// policy. The caller's record is not modified.
+func (h *SQLiteTaskHistory) RecordContext(ctx context.Context, rec *TaskRecord) error {
+	h.mu.Lock()
+	rec = redactTaskRecord(h.redactor, rec)
+	h.mu.Unlock()
+
+	ts := rec.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var metadata []byte
+	if len(rec.Metadata) > 0 {
+		metadata, _ = json.Marshal(rec.Metadata)
+	}
+
+	_, err := h.db.ExecContext(ctx,
+		`INSERT INTO task_history
+			(id, trace_id, user_id, channel, agent_id, action, input, output, error, duration_ns, timestamp, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.TraceID, rec.UserID, rec.Channel, rec.AgentID, rec.Action,
+		nullableText(rec.Input), nullableText(rec.Output), rec.Error,
+		int64(rec.Duration), ts.UnixNano(), nullableText(metadata),
+	)
+	if err != nil {
+		return fmt.Errorf("insert task record: %w", err)
+	}
+	_, err = h.Trim(ctx)
+	return err
+}
+
+// Trim deletes the records the retention policy no longer keeps and
+// returns how many were deleted.
+func (h *SQLiteTaskHistory) Trim(ctx context.Context) (int64, error) {
+	var deleted int64
+	if h.retention.MaxAge > 0 {
+		cutoff := time.Now().Add(-h.retention.MaxAge).UnixNano()
+		res, err := h.db.ExecContext(ctx, `DELETE FROM task_history WHERE timestamp < ?`, cutoff)
+		if err != nil {
+			return deleted, fmt.Errorf("trim task history by age: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	if h.retention.MaxCount > 0 {
+		// Keep the newest MaxCount rows, like a ring buffer.
+		res, err := h.db.ExecContext(ctx,
+			`DELETE FROM task_history WHERE seq <= (
+				SELECT seq FROM task_history ORDER BY seq DESC LIMIT 1 OFFSET ?
+			)`, h.retention.MaxCount)
+		if err != nil {
+			return deleted, fmt.Errorf("trim task history by count: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// Query returns records matching opts, oldest first, logging any error.
+func (h *SQLiteTaskHistory) Query(opts TaskQueryOptions) []*TaskRecord {
+	records, err := h.QueryContext(context.Background(), opts)
+	if err != nil {
+		h.logger.Warn("task history: query failed", "error", err)
+	}
+	return records
+}
+
+// QueryContext returns records matching opts in the order they were
+// recorded. Limit keeps the first matches, as TaskHistory.Query does.
+func (h *SQLiteTaskHistory) QueryContext(ctx context.Context, opts TaskQueryOptions) ([]*TaskRecord, error) {
+	var where []string
+	var args []any
+	for _, f := range []struct {
+		column, value string
+	}{
+		{"user_id", opts.UserID},
+		{"agent_id", opts.AgentID},
+		{"action", opts.Action},
+		{"trace_id", opts.TraceID},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if !opts.Since.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, opts.Since.UnixNano())
+	}
+
+	q := `SELECT id, trace_id, user_id, channel, agent_id, action, input, output, error, duration_ns, timestamp, metadata
+		FROM task_history`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY seq"
+	if opts.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := h.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query task history: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*TaskRecord
+	for rows.Next() {
+		var (
+			rec                     TaskRecord
+			input, output, metadata sql.NullString
+			durationNS, timestampNS int64
+		)
+		if err := rows.Scan(&rec.ID, &rec.TraceID, &rec.UserID, &rec.Channel, &rec.AgentID, &rec.Action,
+			&input, &output, &rec.Error, &durationNS, &timestampNS, &metadata); err != nil {
+			return out, fmt.Errorf("scan task record: %w", err)
+		}
+		if input.Valid {
+			rec.Input = json.RawMessage(input.String)
+		}
+		if output.Valid {
+			rec.Output = json.RawMessage(output.String)
+		}
+		if metadata.Valid {
+			json.Unmarshal([]byte(metadata.String), &rec.Metadata)
+		}
+		rec.Duration = time.Duration(durationNS)
+		rec.Timestamp = time.Unix(0, timestampNS)
+		out = append(out, &rec)
+	}
+	return out, rows.Err()
+}
+
+// nullableText stores empty JSON as NULL so it reads back as nil.
+func nullableText(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+var (
+	_ TaskStore = (*TaskHistory)(nil)
+	_ TaskStore = (*SQLiteTaskHistory)(nil)
+)
@@ -0,0 +1,145 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteTaskHistory(t *testing.T, path string, retention TaskRetention) *SQLiteTaskHistory {
+	t.Helper()
+	h, err := NewSQLiteTaskHistory(path, retention, nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteTaskHistory: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestSQLiteTaskHistory_Query(t *testing.T) {
+	h := newTestSQLiteTaskHistory(t, filepath.Join(t.TempDir(), "tasks.db"), TaskRetention{})
+	ctx := context.Background()
+
+	now := time.Now()
+	records := []*TaskRecord{
+		{ID: "1", UserID: "user-1", AgentID: "agent-1", Action: "llm_call", Timestamp: now.Add(-time.Hour)},
+		{ID: "2", UserID: "user-2", AgentID: "agent-1", Action: "tool_exec", Timestamp: now},
+		{ID: "3", UserID: "user-1", AgentID: "agent-2", Action: "llm_call", TraceID: "trace-abc", Timestamp: now},
+	}
+	for _, rec := range records {
+		if err := h.RecordContext(ctx, rec); err != nil {
+			t.Fatalf("RecordContext: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts TaskQueryOptions
+		want []string
+	}{
+		{"all", TaskQueryOptions{}, []string{"1", "2", "3"}},
+		{"action", TaskQueryOptions{Action: "llm_call"}, []string{"1", "3"}},
+		{"user and agent", TaskQueryOptions{UserID: "user-1", AgentID: "agent-2"}, []string{"3"}},
+		{"trace", TaskQueryOptions{TraceID: "trace-abc"}, []string{"3"}},
+		{"since", TaskQueryOptions{Since: now.Add(-30 * time.Minute)}, []string{"2", "3"}},
+		{"limit", TaskQueryOptions{Action: "llm_call", Limit: 1}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, rec := range h.Query(tt.opts) {
+				got = append(got, rec.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Query(%+v) = %v, want %v", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteTaskHistory_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	h := newTestSQLiteTaskHistory(t, path, TaskRetention{})
+
+	ts := time.Now().Add(-time.Minute)
+	h.Record(&TaskRecord{
+		ID:        "1",
+		Channel:   "slack",
+		Action:    "tool_exec",
+		Input:     json.RawMessage(`{"command":"mysql --password=hunter2"}`),
+		Output:    json.RawMessage(`"ok"`),
+		Error:     "exit 1",
+		Duration:  1500 * time.Millisecond,
+		Timestamp: ts,
+		Metadata:  map[string]string{"node": "web-1"},
+	})
+	h.Close()
+
+	// Records survive reopening the database.
+	h = newTestSQLiteTaskHistory(t, path, TaskRetention{})
+	got := h.Query(TaskQueryOptions{})
+	if len(got) != 1 {
+		t.Fatalf("expected 1 record after reopen, got %d", len(got))
+	}
+	rec := got[0]
+	if rec.Channel != "slack" || rec.Error != "exit 1" || rec.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if !rec.Timestamp.Equal(ts) {
+		t.Errorf("Timestamp = %v, want %v", rec.Timestamp, ts)
+	}
+	if rec.Metadata["node"] != "web-1" || string(rec.Output) != `"ok"` {
+		t.Errorf("Metadata = %v, Output = %s", rec.Metadata, rec.Output)
+	}
+	if strings.Contains(string(rec.Input), "hunter2") {
+		t.Errorf("secret persisted: %s", rec.Input)
+	}
+}
+
+func TestSQLiteTaskHistory_RetentionMaxCount(t *testing.T) {
+	h := newTestSQLiteTaskHistory(t, ":memory:", TaskRetention{MaxCount: 3})
+
+	for i := 1; i <= 5; i++ {
+		h.Record(&TaskRecord{ID: fmt.Sprint(i), Action: "llm_call"})
+	}
+
+	got := h.Query(TaskQueryOptions{})
+	if len(got) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(got))
+	}
+	if got[0].ID != "3" || got[2].ID != "5" {
+		t.Errorf("expected the newest records 3-5, got %s..%s", got[0].ID, got[2].ID)
+	}
+}
+
+func TestSQLiteTaskHistory_RetentionMaxAge(t *testing.T) {
+	h := newTestSQLiteTaskHistory(t, ":memory:", TaskRetention{MaxAge: time.Hour})
+
+	h.Record(&TaskRecord{ID: "old", Timestamp: time.Now().Add(-2 * time.Hour)})
+	h.Record(&TaskRecord{ID: "new"})
+
+	got := h.Query(TaskQueryOptions{})
+	if len(got) != 1 || got[0].ID != "new" {
+		t.Errorf("expected only the new record, got %d records", len(got))
+	}
+}
+
+func TestSQLiteTaskHistory_Pragmas(t *testing.T) {
+	h := newTestSQLiteTaskHistory(t, filepath.Join(t.TempDir(), "tasks.db"), TaskRetention{})
+
+	var mode string
+	var timeout int
+	if err := h.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" || timeout != 5000 {
+		t.Errorf("journal_mode = %q, busy_timeout = %d, want wal and 5000", mode, timeout)
+	}
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"sync"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+// ProviderBreakers holds one circuit breaker per provider for the fallback
+// chain, so a provider that keeps failing is skipped outright instead of
+// being called again on every request. Thread-safe. In-memory only.
+type ProviderBreakers struct {
+	config resilience.CircuitBreakerConfig
+
+	mu       sync.Mutex
+	metrics  *observability.DevOpsClawMetrics
+	breakers map[string]*resilience.CircuitBreaker
+}
+
+// NewProviderBreakers creates breakers from config; its Name is replaced
+// with "provider_<name>" for each provider.
+func NewProviderBreakers(config resilience.CircuitBreakerConfig) *ProviderBreakers {
+	return &ProviderBreakers{
+		config:   config,
+		breakers: make(map[string]*resilience.CircuitBreaker),
+	}
+}
+
+// SetMetrics reports breakers created from now on to metrics: trips in
+// CircuitBreakerTrips and state in a per-provider gauge.
+func (pb *ProviderBreakers) SetMetrics(metrics *observability.DevOpsClawMetrics) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.metrics = metrics
+}
+
+// Get returns the breaker for provider, creating it on first use.
+func (pb *ProviderBreakers) Get(provider string) *resilience.CircuitBreaker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if cb, ok := pb.breakers[provider]; ok {
+		return cb
+	}
+	config := pb.config
+	config.Name = "provider_" + provider
+	var cb *resilience.CircuitBreaker
+	if pb.metrics != nil {
+		cb = resilience.NewCircuitBreakerWithMetrics(config, pb.metrics)
+	} else {
+		cb = resilience.NewCircuitBreaker(config)
+	}
+	pb.breakers[provider] = cb
+	return cb
+}
+
+// State returns the state of provider's breaker; providers never called
+// are closed.
+func (pb *ProviderBreakers) State(provider string) resilience.CircuitState {
+	pb.mu.Lock()
+	cb, ok := pb.breakers[provider]
+	pb.mu.Unlock()
+	if !ok {
+		return resilience.CircuitClosed
+	}
+	return cb.State()
+}
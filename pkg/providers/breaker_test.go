@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
+)
+
+func TestFallback_BreakerOpensAndFallsBack(t *testing.T) {
+	now := time.Now()
+	ct := NewCooldownTracker()
+	ct.nowFunc = func() time.Time { return now }
+	fc := NewFallbackChain(ct)
+	breakers := NewProviderBreakers(resilience.CircuitBreakerConfig{MaxFailures: 3, ResetTimeout: time.Hour})
+	metrics := observability.NewDevOpsClawMetrics()
+	breakers.SetMetrics(metrics)
+	fc.SetBreakers(breakers)
+	fc.SetMetrics(metrics)
+
+	candidates := []FallbackCandidate{
+		makeCandidate("openai", "gpt-4"),
+		makeCandidate("anthropic", "claude-opus"),
+	}
+	calls := map[string]int{}
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		calls[provider]++
+		if provider == "openai" {
+			return nil, errors.New("API error: status 503 service unavailable")
+		}
+		return &LLMResponse{Content: "from claude", FinishReason: "stop"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		// Step past the cooldown so only the breaker can skip openai.
+		now = now.Add(2 * time.Hour)
+		result, err := fc.Execute(context.Background(), candidates, run)
+		if err != nil || result.Provider != "anthropic" {
+			t.Fatalf("call %d: result %+v, err %v", i+1, result, err)
+		}
+	}
+	if calls["openai"] != 3 {
+		t.Fatalf("openai called %d times, want 3", calls["openai"])
+	}
+	if got := breakers.State("openai"); got != resilience.CircuitOpen {
+		t.Fatalf("openai breaker = %s, want open", got)
+	}
+	if got := breakers.State("anthropic"); got != resilience.CircuitClosed {
+		t.Errorf("anthropic breaker = %s, want closed", got)
+	}
+
+	now = now.Add(2 * time.Hour)
+	result, err := fc.Execute(context.Background(), candidates, run)
+	if err != nil || result.Provider != "anthropic" {
+		t.Fatalf("after trip: result %+v, err %v", result, err)
+	}
+	if calls["openai"] != 3 {
+		t.Errorf("openai called again with its breaker open")
+	}
+	if len(result.Attempts) != 1 || !result.Attempts[0].Skipped || !strings.Contains(result.Attempts[0].Error.Error(), "is open") {
+		t.Errorf("attempts = %+v, want openai skipped by its breaker", result.Attempts)
+	}
+	if got := metrics.ProviderFallbacks.Value(); got != 4 {
+		t.Errorf("ProviderFallbacks = %d, want 4", got)
+	}
+	waitUntil(t, func() bool { return metrics.CircuitBreakerTrips.Value() == 1 })
+}
+
+func TestFallback_BreakerIgnoresFormatErrors(t *testing.T) {
+	fc := NewFallbackChain(NewCooldownTracker())
+	breakers := NewProviderBreakers(resilience.CircuitBreakerConfig{MaxFailures: 1})
+	fc.SetBreakers(breakers)
+
+	_, err := fc.Execute(context.Background(), []FallbackCandidate{makeCandidate("openai", "gpt-4")},
+		failRun(errors.New("400 bad request: invalid request format")))
+	if err == nil {
+		t.Fatal("expected the format error")
+	}
+	if got := breakers.State("openai"); got != resilience.CircuitClosed {
+		t.Errorf("breaker = %s after a malformed request, want closed", got)
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
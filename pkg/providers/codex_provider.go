@@ -100,9 +100,13 @@ func (p *CodexProvider) Chat(
 	stream := p.client.Responses.NewStreaming(ctx, params, opts...)
 	defer stream.Close()
 
+	onToken := TokenCallbackFrom(ctx)
 	var resp *responses.Response
 	for stream.Next() {
 		evt := stream.Current()
+		if evt.Type == "response.output_text.delta" && onToken != nil {
+			onToken(evt.Delta)
+		}
 		if evt.Type == "response.completed" || evt.Type == "response.failed" || evt.Type == "response.incomplete" {
 			evtResp := evt.Response
 			if evtResp.ID != "" {
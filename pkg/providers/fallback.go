@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 )
 
 // FallbackChain orchestrates model fallback across multiple candidates.
 type FallbackChain struct {
 	cooldown *CooldownTracker
+	breakers *ProviderBreakers                // optional, see SetBreakers
+	metrics  *observability.DevOpsClawMetrics // optional, see SetMetrics
 }
 
 // FallbackCandidate represents one model/provider to try.
@@ -41,6 +45,19 @@ func NewFallbackChain(cooldown *CooldownTracker) *FallbackChain {
 	return &FallbackChain{cooldown: cooldown}
 }
 
+// SetBreakers routes each candidate's calls through its provider's circuit
+// breaker. Retriable failures count against the breaker; while it is open
+// the candidate is skipped like one in cooldown.
+func (fc *FallbackChain) SetBreakers(breakers *ProviderBreakers) {
+	fc.breakers = breakers
+}
+
+// SetMetrics counts each move to a later candidate in
+// metrics.ProviderFallbacks.
+func (fc *FallbackChain) SetMetrics(metrics *observability.DevOpsClawMetrics) {
+	fc.metrics = metrics
+}
+
 // ResolveCandidates parses model config into a deduplicated candidate list.
 func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandidate {
 	seen := make(map[string]bool)
@@ -77,7 +94,8 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 // It tries each candidate in order, respecting cooldowns and error classification.
 //
 // Behavior:
-//   - Candidates in cooldown are skipped (logged as skipped attempt).
+//   - Candidates in cooldown or with an open breaker are skipped (logged
+//     as skipped attempt).
 //   - context.Canceled aborts immediately (user abort, no fallback).
 //   - Non-retriable errors (format) abort immediately.
 //   - Retriable errors trigger fallback to next candidate.
@@ -101,6 +119,9 @@ func (fc *FallbackChain) Execute(
 		if ctx.Err() == context.Canceled {
 			return nil, context.Canceled
 		}
+		if i > 0 && fc.metrics != nil {
+			fc.metrics.ProviderFallbacks.Inc()
+		}
 
 		// Check cooldown.
 		if !fc.cooldown.IsAvailable(candidate.Provider) {
@@ -121,9 +142,20 @@ func (fc *FallbackChain) Execute(
 
 		// Execute the run function.
 		start := time.Now()
-		resp, err := run(ctx, candidate.Provider, candidate.Model)
+		resp, ran, err := fc.call(ctx, candidate, run)
 		elapsed := time.Since(start)
 
+		if !ran {
+			// Breaker open: skip without calling the provider.
+			result.Attempts = append(result.Attempts, FallbackAttempt{
+				Provider: candidate.Provider,
+				Model:    candidate.Model,
+				Skipped:  true,
+				Error:    err,
+			})
+			continue
+		}
+
 		if err == nil {
 			// Success.
 			fc.cooldown.MarkSuccess(candidate.Provider)
@@ -191,6 +223,34 @@ func (fc *FallbackChain) Execute(
 	return nil, &FallbackExhaustedError{Attempts: result.Attempts}
 }
 
+// call runs candidate through its provider's breaker, if breakers are
+// set. ran is false when the breaker refused the call, with err saying so.
+func (fc *FallbackChain) call(
+	ctx context.Context,
+	candidate FallbackCandidate,
+	run func(ctx context.Context, provider, model string) (*LLMResponse, error),
+) (resp *LLMResponse, ran bool, err error) {
+	if fc.breakers == nil {
+		resp, err = run(ctx, candidate.Provider, candidate.Model)
+		return resp, true, err
+	}
+
+	breakerErr := fc.breakers.Get(candidate.Provider).Execute(func() error {
+		ran = true
+		resp, err = run(ctx, candidate.Provider, candidate.Model)
+		// Only failures that are the provider's fault trip the breaker,
+		// not user aborts or malformed requests.
+		if failErr := ClassifyError(err, candidate.Provider, candidate.Model); failErr != nil && failErr.IsRetriable() {
+			return failErr
+		}
+		return nil
+	})
+	if !ran {
+		return nil, false, breakerErr
+	}
+	return resp, true, err
+}
+
 // ExecuteImage runs the fallback chain for image/vision requests.
 // Simpler than Execute: no cooldown checks (image endpoints have different rate limits).
 // Image dimension/size errors abort immediately (non-retriable).
@@ -277,7 +337,7 @@ func (e *FallbackExhaustedError) Error() string {
 	sb.WriteString(fmt.Sprintf("fallback: all %d candidates failed:", len(e.Attempts)))
 	for i, a := range e.Attempts {
 		if a.Skipped {
-			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: skipped (cooldown)", i+1, a.Provider, a.Model))
+			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: skipped: %v", i+1, a.Provider, a.Model, a.Error))
 		} else {
 			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: %v (reason=%s, %s)",
 				i+1, a.Provider, a.Model, a.Error, a.Reason, a.Duration.Round(time.Millisecond)))
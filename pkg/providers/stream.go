@@ -0,0 +1,22 @@
+package providers
+
+import "context"
+
+// TokenCallback receives response text as a provider streams it. It is
+// called from the provider's goroutine and should return quickly.
+type TokenCallback func(delta string)
+
+type tokenCallbackKey struct{}
+
+// WithTokenCallback returns a context asking providers to report text
+// deltas to cb while a Chat call is in flight. Providers that do not
+// stream ignore it; Chat still returns the complete response either way.
+func WithTokenCallback(ctx context.Context, cb TokenCallback) context.Context {
+	return context.WithValue(ctx, tokenCallbackKey{}, cb)
+}
+
+// TokenCallbackFrom returns the callback set by WithTokenCallback, or nil.
+func TokenCallbackFrom(ctx context.Context) TokenCallback {
+	cb, _ := ctx.Value(tokenCallbackKey{}).(TokenCallback)
+	return cb
+}
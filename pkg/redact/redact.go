@@ -0,0 +1,201 @@
+// Package redact masks secrets such as access keys, bearer tokens and
+// passwords in text before it is persisted to the audit log or task
+// history.
+//
+// A Redactor matches a set of regular expressions. When a pattern has a
+// group named "secret", only that group is masked, so "password=hunter2"
+// becomes "password=***REDACTED***"; otherwise the whole match is.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces each redacted secret.
+const Mask = "***REDACTED***"
+
+// Pattern is a named secret shape.
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// DefaultPatterns returns the built-in secret shapes: AWS access key IDs
+// and secret keys, bearer and basic authorization credentials, GitHub
+// tokens, PEM private keys, and password/secret/token/api_key assignments.
+func DefaultPatterns() []Pattern {
+	return []Pattern{
+		{"aws_access_key_id", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{"aws_secret_access_key", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`)},
+		{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`)},
+		{"basic_auth", regexp.MustCompile(`(?i)\bauthorization["']?\s*[=:]\s*["']?basic\s+(?P<secret>[A-Za-z0-9+/]+=*)`)},
+		{"github_token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+		{"credential_assignment", regexp.MustCompile(`(?i)\b(?:password|passwd|secret|token|api[_-]?key)["']?\s*[=:]\s*["']?(?P<secret>[^\s"'&,;]+)`)},
+	}
+}
+
+// CompilePatterns compiles user-supplied expressions, naming each after
+// its position ("custom_1", ...).
+func CompilePatterns(exprs []string) ([]Pattern, error) {
+	patterns := make([]Pattern, 0, len(exprs))
+	for i, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %d: %w", i+1, err)
+		}
+		patterns = append(patterns, Pattern{Name: fmt.Sprintf("custom_%d", i+1), Regexp: re})
+	}
+	return patterns, nil
+}
+
+// sensitiveKey matches JSON keys such as "password", "db_password" or
+// "apiToken", whose string values are masked whole since a decoded value
+// like "hunter2" no longer looks like a secret.
+var sensitiveKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_-]?key|authorization|credentials?)$`)
+
+// Redactor masks secrets in strings and decoded JSON values. A nil
+// *Redactor is valid and leaves everything unchanged.
+type Redactor struct {
+	patterns []Pattern
+	skip     map[string]bool
+}
+
+// New returns a Redactor for patterns.
+func New(patterns []Pattern) *Redactor {
+	return &Redactor{patterns: patterns, skip: map[string]bool{}}
+}
+
+// Default returns a Redactor for DefaultPatterns.
+func Default() *Redactor {
+	return New(DefaultPatterns())
+}
+
+// SkipFields opts fields out of redaction. A field is named by its JSON
+// key, such as "command" or a metadata key, and is skipped at any depth.
+func (r *Redactor) SkipFields(fields ...string) {
+	for _, f := range fields {
+		r.skip[f] = true
+	}
+}
+
+// Skips reports whether field has been opted out.
+func (r *Redactor) Skips(field string) bool {
+	return r == nil || r.skip[field]
+}
+
+// String returns s with every secret masked.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, p := range r.patterns {
+		s = maskMatches(p.Regexp, s)
+	}
+	return s
+}
+
+// maskMatches masks each match of re in s, or only its "secret" group
+// when re has one.
+func maskMatches(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	group := re.SubexpIndex("secret")
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if group > 0 {
+			start, end = m[2*group], m[2*group+1]
+			if start < 0 {
+				continue
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Mask)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Value returns a copy of v, as decoded from JSON, with secrets masked in
+// every string and string values of keys such as "password" or
+// "api_token" masked whole. Keys of opted-out fields keep their values.
+func (r *Redactor) Value(v any) any {
+	if r == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			_, isString := val.(string)
+			switch {
+			case r.skip[k]:
+				out[k] = val
+			case isString && sensitiveKey.MatchString(k):
+				out[k] = Mask
+			default:
+				out[k] = r.Value(val)
+			}
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, val := range v {
+			switch {
+			case r.skip[k]:
+				out[k] = val
+			case sensitiveKey.MatchString(k):
+				out[k] = Mask
+			default:
+				out[k] = r.String(val)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = r.Value(val)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, val := range v {
+			out[i] = r.String(val)
+		}
+		return out
+	}
+	return v
+}
+
+// JSON returns raw with secrets masked as Value masks them. Documents
+// without secrets are returned as is; those with secrets are re-encoded.
+// Input that is not valid JSON is masked as plain text.
+func (r *Redactor) JSON(raw json.RawMessage) json.RawMessage {
+	if r == nil || len(raw) == 0 {
+		return raw
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return json.RawMessage(r.String(string(raw)))
+	}
+	before, _ := json.Marshal(v)
+	after, err := json.Marshal(r.Value(v))
+	if err != nil || bytes.Equal(before, after) {
+		return raw
+	}
+	return after
+}
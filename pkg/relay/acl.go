@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// AgentACL limits what agents connecting with one credential may do: the
+// node IDs they may register as and the command types the relay will
+// dispatch to them. It bounds the damage a leaked token or certificate can
+// do. An agent whose credential matches no ACL is unrestricted.
+type AgentACL struct {
+	// Token is a bearer token agents may connect with, accepted alongside
+	// ServerConfig.AuthToken. CertCN instead matches the CN of a verified
+	// mTLS client certificate. Set one of them.
+	Token  string `json:"token,omitempty"`
+	CertCN string `json:"cert_cn,omitempty"`
+
+	// NodePrefixes are the node-ID prefixes agents may register under,
+	// e.g. ["web-"]. Empty allows any node ID.
+	NodePrefixes []string `json:"node_prefixes,omitempty"`
+
+	// CommandTypes are the fleet.TypedCommand types dispatched to these
+	// agents, e.g. ["shell"] to rule out file pushes and deploys. Empty
+	// allows every type.
+	CommandTypes []string `json:"command_types,omitempty"`
+}
+
+// allowsNode reports whether the ACL lets an agent register as id. A nil
+// ACL allows any ID.
+func (a *AgentACL) allowsNode(id fleet.NodeID) bool {
+	if a == nil || len(a.NodePrefixes) == 0 {
+		return true
+	}
+	for _, p := range a.NodePrefixes {
+		if strings.HasPrefix(string(id), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCommand reports whether the ACL lets the relay dispatch commands
+// of type typ. A nil ACL allows every type.
+func (a *AgentACL) allowsCommand(typ string) bool {
+	return a == nil || len(a.CommandTypes) == 0 || slices.Contains(a.CommandTypes, typ)
+}
+
+// tokenACL returns the ACL whose token r presents, or nil.
+func (s *WSServer) tokenACL(r *http.Request) *AgentACL {
+	for i := range s.config.ACLs {
+		if acl := &s.config.ACLs[i]; acl.Token != "" && validBearer(r, acl.Token) {
+			return acl
+		}
+	}
+	return nil
+}
+
+// certACL returns the ACL for the client certificate CN cn, or nil.
+func (s *WSServer) certACL(cn string) *AgentACL {
+	for i := range s.config.ACLs {
+		if acl := &s.config.ACLs[i]; acl.CertCN != "" && acl.CertCN == cn {
+			return acl
+		}
+	}
+	return nil
+}
+
+// hasTokenACLs reports whether any ACL grants access by bearer token, in
+// which case agents must authenticate even without an AuthToken.
+func (s *WSServer) hasTokenACLs() bool {
+	return slices.ContainsFunc(s.config.ACLs, func(a AgentACL) bool { return a.Token != "" })
+}
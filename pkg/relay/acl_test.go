@@ -0,0 +1,140 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// aclTestServer starts a relay that accepts the shared token "shared" and
+// "web-token", which may only register web-* nodes and run shell commands.
+func aclTestServer(t *testing.T) (*WSServer, *httptest.Server) {
+	t.Helper()
+	srv := NewWSServer(ServerConfig{
+		AuthToken:    "shared",
+		MaxNodes:     10,
+		PingInterval: time.Hour,
+		ACLs: []AgentACL{
+			{Token: "web-token", NodePrefixes: []string{"web-"}, CommandTypes: []string{"shell"}},
+		},
+	}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func bearer(token string) *websocket.DialOptions {
+	return &websocket.DialOptions{HTTPHeader: http.Header{"Authorization": {"Bearer " + token}}}
+}
+
+func TestWSServer_ACLNodePrefix(t *testing.T) {
+	srv, ts := aclTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", bearer("web-token"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "db-1", Timestamp: time.Now()})
+	_, _, err = conn.Read(ctx)
+	if got := websocket.CloseStatus(err); got != websocket.StatusPolicyViolation {
+		t.Errorf("close status = %v (err %v), want StatusPolicyViolation", got, err)
+	}
+	if ids := srv.ConnectedNodeIDs(); len(ids) != 0 {
+		t.Errorf("connected = %v, want db-1 refused", ids)
+	}
+
+	// Inside its prefix the ACL token registers, and the shared token is
+	// not restricted.
+	web := dialTestAgent(t, ctx, ts, "web-1", bearer("web-token"))
+	defer web.CloseNow()
+	db := dialTestAgent(t, ctx, ts, "db-1", bearer("shared"))
+	defer db.CloseNow()
+
+	_, resp, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", bearer("stolen"))
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unknown token: err = %v, want 401", err)
+	}
+}
+
+func TestWSServer_ACLCommandType(t *testing.T) {
+	srv, ts := aclTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialTestAgent(t, ctx, ts, "web-1", bearer("web-token"))
+	defer conn.CloseNow()
+
+	fileData, _ := json.Marshal(fleet.FileCommand{Action: "write", Path: "/etc/sudoers", Content: "evil"})
+	result, err := srv.SendCommandWS(ctx, "web-1", &CommandEnvelope{
+		RequestID: "req-file",
+		Command:   fleet.TypedCommand{Type: "file", Data: fileData},
+	})
+	if err != nil {
+		t.Fatalf("SendCommandWS: %v", err)
+	}
+	if result.Result.Status != "denied" || !strings.Contains(result.Result.Error, `"file" not allowed`) {
+		t.Errorf("result = %+v, want the file command denied", result.Result)
+	}
+
+	// The denied command never reached the agent: the first message it
+	// reads is the allowed shell command.
+	shellData, _ := json.Marshal(fleet.ShellCommand{Command: "uptime"})
+	go srv.SendCommandWS(ctx, "web-1", &CommandEnvelope{
+		RequestID: "req-shell",
+		Command:   fleet.TypedCommand{Type: "shell", Data: shellData},
+	})
+	var msg WSMessage
+	if err := wsjson.Read(ctx, conn, &msg); err != nil {
+		t.Fatalf("read command: %v", err)
+	}
+	if msg.Type != "command" || msg.RequestID != "req-shell" {
+		t.Errorf("agent got %s %s, want the shell command", msg.Type, msg.RequestID)
+	}
+}
+
+func TestAgentACL_NilAllowsAll(t *testing.T) {
+	var acl *AgentACL
+	if !acl.allowsNode("db-1") || !acl.allowsCommand("deploy") {
+		t.Error("a nil ACL should not restrict the agent")
+	}
+	acl = &AgentACL{NodePrefixes: []string{"web-", "edge-"}}
+	if !acl.allowsNode("edge-3") || acl.allowsNode("db-1") || !acl.allowsCommand("deploy") {
+		t.Errorf("prefix-only ACL = %+v misapplied", acl)
+	}
+}
+
+func TestExecutor_ACLDenialReported(t *testing.T) {
+	srv, ts := aclTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialTestAgent(t, ctx, ts, "web-1", bearer("web-token"))
+	defer conn.CloseNow()
+
+	executor := fleet.NewExecutor(srv.store, NewWSRelayClient(srv, wsTestLogger()), wsTestLogger())
+	fileData, _ := json.Marshal(fleet.FileCommand{Action: "write", Path: "/etc/sudoers", Content: "evil"})
+	result, err := executor.Execute(ctx, &fleet.ExecRequest{
+		ID:      "req-file",
+		Target:  fleet.TargetSelector{NodeIDs: []fleet.NodeID{"web-1"}},
+		Command: fleet.TypedCommand{Type: "file", Data: fileData},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(result.NodeResults) != 1 || result.NodeResults[0].Status != "denied" {
+		t.Fatalf("node results = %+v, want web-1 denied", result.NodeResults)
+	}
+	if s := result.Summary; s.Denied != 1 || s.Failed != 0 {
+		t.Errorf("summary = %+v, want the denial counted as denied, not failed", s)
+	}
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DefaultReconnectJitter is the jitter fraction used when
+// AgentConfig.ReconnectJitter is unset.
+const DefaultReconnectJitter = 0.2
+
+// reconnectBackoff computes the wait between agent reconnect attempts. The
+// delay doubles after each failed attempt, starting at base and capped at
+// max, and is then shortened by a random amount of up to jitter×delay so
+// that agents dropped at the same moment don't all come back together.
+type reconnectBackoff struct {
+	base    time.Duration
+	max     time.Duration
+	jitter  float64
+	rand    func() float64 // in [0, 1); math/rand.Float64 unless a test overrides it
+	attempt int
+}
+
+func newReconnectBackoff(base, max time.Duration, jitter float64) *reconnectBackoff {
+	return &reconnectBackoff{base: base, max: max, jitter: jitter, rand: rand.Float64}
+}
+
+// next returns the delay before the next attempt and advances the backoff.
+func (b *reconnectBackoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 62 { // avoid overflowing the shift
+		if d := b.base << b.attempt; d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	b.attempt++
+	return delay - time.Duration(float64(delay)*b.jitter*b.rand())
+}
+
+// reset starts the backoff over at base, after a successful connect.
+func (b *reconnectBackoff) reset() {
+	b.attempt = 0
+}
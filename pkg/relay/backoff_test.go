@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff_GrowsAndCaps(t *testing.T) {
+	b := newReconnectBackoff(time.Second, 10*time.Second, 0)
+
+	var got []time.Duration
+	for i := 0; i < 6; i++ {
+		got = append(got, b.next())
+	}
+	want := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("delays = %v, want %v", got, want)
+		}
+	}
+
+	b.reset()
+	if d := b.next(); d != time.Second {
+		t.Errorf("after reset: delay = %v, want 1s", d)
+	}
+}
+
+func TestReconnectBackoff_JitterWithinBounds(t *testing.T) {
+	b := newReconnectBackoff(time.Second, 60*time.Second, 0.2)
+
+	// Simulate a long run of failed connects.
+	ceiling := time.Second
+	for i := 0; i < 100; i++ {
+		d := b.next()
+		if floor := ceiling - ceiling/5; d < floor || d > ceiling {
+			t.Fatalf("attempt %d: delay %v outside [%v, %v]", i, d, floor, ceiling)
+		}
+		ceiling = min(2*ceiling, 60*time.Second)
+	}
+}
+
+func TestReconnectBackoff_JitterExtremes(t *testing.T) {
+	b := newReconnectBackoff(4*time.Second, 60*time.Second, 0.5)
+
+	b.rand = func() float64 { return 0 }
+	if d := b.next(); d != 4*time.Second {
+		t.Errorf("no jitter drawn: delay = %v, want 4s", d)
+	}
+	b.rand = func() float64 { return 0.999999 }
+	if d := b.next(); d <= 4*time.Second || d > 4*time.Second+time.Millisecond {
+		t.Errorf("full jitter: delay = %v, want just over half of 8s", d)
+	}
+}
+
+func TestReconnectBackoff_NoOverflow(t *testing.T) {
+	b := newReconnectBackoff(time.Second, time.Minute, 0)
+	for i := 0; i < 200; i++ {
+		if d := b.next(); d <= 0 || d > time.Minute {
+			t.Fatalf("attempt %d: delay %v", i, d)
+		}
+	}
+}
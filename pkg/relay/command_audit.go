@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// relayRequester marks execution records written by the relay itself, as
+// opposed to the CLI or agent that initiated the fleet command.
+const relayRequester = "relay"
+
+// recordCommand writes a single relay dispatch to the fleet store's
+// execution table, keyed by the envelope's request ID, so the relay acts as
+// an auditable chokepoint independent of the caller.
+func (s *WSServer) recordCommand(nodeID fleet.NodeID, env *CommandEnvelope, result *ResultEnvelope, sendErr error, start time.Time) {
+	duration := time.Since(start)
+
+	req := &fleet.ExecRequest{
+		ID:        env.RequestID,
+		Target:    fleet.TargetSelector{NodeIDs: []fleet.NodeID{nodeID}},
+		Command:   env.Command,
+		Requester: relayRequester,
+		CreatedAt: start,
+	}
+
+	var nr fleet.NodeResult
+	if result != nil {
+		nr = result.Result
+	}
+	nr.NodeID = nodeID
+	nr.Duration = duration
+	switch {
+	case errors.Is(sendErr, context.DeadlineExceeded):
+		nr.Status = "timeout"
+		nr.Error = sendErr.Error()
+	case sendErr != nil:
+		nr.Status = "failure"
+		nr.Error = sendErr.Error()
+	case nr.Status == "":
+		if nr.ExitCode == 0 && nr.Error == "" {
+			nr.Status = "success"
+		} else {
+			nr.Status = "failure"
+		}
+	}
+
+	summary := fleet.ExecSummary{Total: 1}
+	switch nr.Status {
+	case "success":
+		summary.Success = 1
+	case "timeout":
+		summary.Timeout = 1
+	case "skipped":
+		summary.Skipped = 1
+	default:
+		summary.Failed = 1
+	}
+
+	execResult := &fleet.ExecResult{
+		RequestID:   env.RequestID,
+		NodeResults: []fleet.NodeResult{nr},
+		Summary:     summary,
+		Duration:    duration,
+	}
+
+	// The caller's context may already be cancelled (e.g. on timeout), but
+	// the audit record must still be written.
+	if err := s.store.RecordExecution(context.Background(), req, execResult); err != nil {
+		s.logger.Error("failed to record relay command", "error", err, "request_id", env.RequestID, "node_id", nodeID)
+	}
+}
@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// ConnEventType distinguishes agent connection events.
+type ConnEventType string
+
+const (
+	ConnEventConnect    ConnEventType = "connect"
+	ConnEventDisconnect ConnEventType = "disconnect"
+)
+
+// ConnEvent records an agent connecting to or disconnecting from the relay.
+type ConnEvent struct {
+	NodeID     fleet.NodeID  `json:"node_id"`
+	Type       ConnEventType `json:"type"`
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	Reason     string        `json:"reason,omitempty"`
+}
+
+// EventQuery filters connection events. Zero fields match everything.
+type EventQuery struct {
+	NodeID fleet.NodeID
+	Type   ConnEventType
+	Since  time.Time
+	Limit  int // most recent N matches; 0 = all
+}
+
+// DefaultEventLogSize is the number of events kept when ServerConfig
+// does not set EventLogSize.
+const DefaultEventLogSize = 10000
+
+// EventLog is a bounded, in-memory ring buffer of connection events.
+// Once full, the oldest events are overwritten.
+type EventLog struct {
+	mu     sync.RWMutex
+	events []ConnEvent
+	next   int  // index the next event is written to
+	full   bool // the buffer has wrapped at least once
+}
+
+// NewEventLog creates an event log holding up to capacity events.
+func NewEventLog(capacity int) *EventLog {
+	if capacity <= 0 {
+		capacity = DefaultEventLogSize
+	}
+	return &EventLog{events: make([]ConnEvent, capacity)}
+}
+
+// Record appends an event, evicting the oldest if the log is full.
+func (l *EventLog) Record(ev ConnEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	l.mu.Lock()
+	l.events[l.next] = ev
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+}
+
+// Query returns matching events, oldest first.
+func (l *EventLog) Query(q EventQuery) []ConnEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start, count := 0, l.next
+	if l.full {
+		start, count = l.next, len(l.events)
+	}
+
+	out := []ConnEvent{}
+	for i := 0; i < count; i++ {
+		ev := l.events[(start+i)%len(l.events)]
+		if q.NodeID != "" && ev.NodeID != q.NodeID {
+			continue
+		}
+		if q.Type != "" && ev.Type != q.Type {
+			continue
+		}
+		if !q.Since.IsZero() && ev.Time.Before(q.Since) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// Len returns the number of events currently held.
+func (l *EventLog) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.full {
+		return len(l.events)
+	}
+	return l.next
+}
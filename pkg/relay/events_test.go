@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+func TestEventLog_QueryFilters(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	log := NewEventLog(100)
+	for i := 0; i < 6; i++ {
+		node := fleet.NodeID("web-1")
+		if i%3 == 2 {
+			node = "db-1"
+		}
+		typ := ConnEventConnect
+		if i%2 == 1 {
+			typ = ConnEventDisconnect
+		}
+		log.Record(ConnEvent{NodeID: node, Type: typ, Time: base.Add(time.Duration(i) * time.Minute)})
+	}
+
+	tests := []struct {
+		name  string
+		query EventQuery
+		want  int
+	}{
+		{"all", EventQuery{}, 6},
+		{"by node", EventQuery{NodeID: "web-1"}, 4},
+		{"by type", EventQuery{Type: ConnEventDisconnect}, 3},
+		{"node and type", EventQuery{NodeID: "web-1", Type: ConnEventConnect}, 2},
+		{"since", EventQuery{Since: base.Add(3 * time.Minute)}, 3},
+		{"limit keeps newest", EventQuery{Limit: 2}, 2},
+		{"unknown node", EventQuery{NodeID: "nope"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := log.Query(tt.query)
+			if len(got) != tt.want {
+				t.Fatalf("got %d events, want %d: %+v", len(got), tt.want, got)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Time.Before(got[i-1].Time) {
+					t.Errorf("events not oldest-first: %+v", got)
+				}
+			}
+		})
+	}
+
+	if got := log.Query(EventQuery{Limit: 2}); got[1].Time != base.Add(5*time.Minute) {
+		t.Errorf("limit should keep the most recent events, got %+v", got)
+	}
+}
+
+func TestEventLog_Bounded(t *testing.T) {
+	log := NewEventLog(3)
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		log.Record(ConnEvent{NodeID: "flappy", Type: ConnEventConnect, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	if log.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", log.Len())
+	}
+	got := log.Query(EventQuery{})
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3", len(got))
+	}
+	for i, ev := range got {
+		if want := base.Add(time.Duration(i+2) * time.Second); !ev.Time.Equal(want) {
+			t.Errorf("event %d time = %v, want %v (oldest evicted first)", i, ev.Time, want)
+		}
+	}
+}
+
+func TestParseEventQuery(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	q, err := parseEventQuery(url.Values{"node": {"web-1"}, "type": {"disconnect"}, "since": {"1h"}, "limit": {"50"}}, now)
+	if err != nil {
+		t.Fatalf("parseEventQuery() error: %v", err)
+	}
+	if q.NodeID != "web-1" || q.Type != ConnEventDisconnect || q.Limit != 50 || !q.Since.Equal(now.Add(-time.Hour)) {
+		t.Errorf("query = %+v", q)
+	}
+
+	q, err = parseEventQuery(url.Values{"since": {"2026-01-01T10:00:00Z"}}, now)
+	if err != nil || !q.Since.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("RFC 3339 since = %v, %v", q.Since, err)
+	}
+
+	for _, bad := range []url.Values{
+		{"type": {"flap"}},
+		{"since": {"yesterday"}},
+		{"limit": {"-1"}},
+	} {
+		if _, err := parseEventQuery(bad, now); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
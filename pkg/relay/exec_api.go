@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// DefaultExecTimeout bounds a /relay/exec command whose request sets no
+// timeout.
+const DefaultExecTimeout = 30 * time.Second
+
+// ExecRequest is the body of POST /relay/exec: a shell command to run on
+// one connected node. Timeout is a Go duration such as "45s".
+type ExecRequest struct {
+	NodeID  fleet.NodeID `json:"node_id"`
+	Command string       `json:"command"`
+	Timeout string       `json:"timeout,omitempty"`
+}
+
+// handleExec runs an ExecRequest through the node's tunnel and responds
+// with the fleet.NodeResult. It is only routed when ServerConfig.ExecAPI is
+// set. Errors: 401/403 for a caller that fails authorizeExec, 400 for a bad
+// body, 404 when the node has no tunnel, 504 when the command times out.
+func (s *WSServer) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller, status := s.authorizeExec(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var req ExecRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.NodeID == "" || req.Command == "" {
+		http.Error(w, "node_id and command are required", http.StatusBadRequest)
+		return
+	}
+	timeout := DefaultExecTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout %q: want a positive duration like 30s", req.Timeout), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	data, _ := json.Marshal(fleet.ShellCommand{
+		Command:    req.Command,
+		TimeoutSec: int(math.Ceil(timeout.Seconds())),
+	})
+	env := &CommandEnvelope{
+		RequestID: fmt.Sprintf("exec-%d", time.Now().UnixNano()),
+		Command:   fleet.TypedCommand{Type: "shell", Data: data},
+		Deadline:  time.Now().Add(timeout),
+	}
+	s.logger.Info("exec api command", "node_id", req.NodeID, "caller", caller, "request_id", env.RequestID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	result, err := s.SendCommandWS(ctx, req.NodeID, env)
+	switch {
+	case errors.Is(err, fleet.ErrNoTunnel):
+		http.Error(w, fmt.Sprintf("node %s has no active tunnel", req.NodeID), http.StatusNotFound)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, fmt.Sprintf("command on %s timed out after %s", req.NodeID, timeout), http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result.Result)
+}
+
+// authorizeExec authenticates a /relay/exec caller by its own credential:
+// the ExecToken as a bearer token, or a verified client certificate. The
+// agent AuthToken is not accepted, since every enrolled node holds it.
+// Agent certificates share the relay's CA, so a certificate is only
+// accepted if its CN is listed in ExecClients. It returns a label for the
+// caller and http.StatusOK, or the status to reject with.
+func (s *WSServer) authorizeExec(r *http.Request) (string, int) {
+	if s.config.ExecToken != "" && validBearer(r, s.config.ExecToken) {
+		return "token", http.StatusOK
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		id, err := VerifyClientCert(r.TLS)
+		if err != nil || !slices.Contains(s.config.ExecClients, id.NodeID) {
+			s.logger.Warn("exec api caller rejected", "remote", r.RemoteAddr, "error", err)
+			return "", http.StatusForbidden
+		}
+		return "cert:" + id.NodeID, http.StatusOK
+	}
+	return "", http.StatusUnauthorized
+}
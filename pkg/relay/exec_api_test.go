@@ -0,0 +1,243 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// startExecRelay serves a relay with the exec API enabled and a fake agent
+// connected as "web-1". The agent answers each shell command with
+// "ran: <command>", except "sleep", which it never answers.
+func startExecRelay(t *testing.T, config ServerConfig) (*WSServer, *httptest.Server) {
+	t.Helper()
+	config.PingInterval = time.Hour
+	config.ExecAPI = true
+	srv := NewWSServer(config, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	header := http.Header{}
+	if config.AuthToken != "" {
+		header.Set("Authorization", "Bearer "+config.AuthToken)
+	}
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "web-1", Timestamp: time.Now()})
+	var ack WSMessage
+	if err := wsjson.Read(ctx, conn, &ack); err != nil || ack.Type != "registered" {
+		t.Fatalf("registration: %v (%q)", err, ack.Type)
+	}
+
+	go func() {
+		for {
+			var msg WSMessage
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				return
+			}
+			if msg.Type != "command" {
+				continue
+			}
+			var tc fleet.TypedCommand
+			var sc fleet.ShellCommand
+			json.Unmarshal(msg.Payload, &tc)
+			json.Unmarshal(tc.Data, &sc)
+			if sc.Command == "sleep" {
+				continue
+			}
+			payload, _ := json.Marshal(fleet.NodeResult{NodeID: "web-1", Status: "success", Output: "ran: " + sc.Command})
+			wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: msg.RequestID, NodeID: "web-1", Payload: payload, Timestamp: time.Now()})
+		}
+	}()
+	return srv, ts
+}
+
+func postExec(t *testing.T, url, token, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/relay/exec", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /relay/exec: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestWSServer_Exec(t *testing.T) {
+	_, ts := startExecRelay(t, ServerConfig{AuthToken: "secret", ExecToken: "exec-secret"})
+
+	status, body := postExec(t, ts.URL, "exec-secret", `{"node_id": "web-1", "command": "uptime", "timeout": "5s"}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d (%s), want 200", status, body)
+	}
+	var result fleet.NodeResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if result.NodeID != "web-1" || result.Status != "success" || result.Output != "ran: uptime" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestWSServer_ExecErrors(t *testing.T) {
+	_, ts := startExecRelay(t, ServerConfig{AuthToken: "secret", ExecToken: "exec-secret"})
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"no token", "", `{"node_id": "web-1", "command": "uptime"}`, http.StatusUnauthorized, "Unauthorized"},
+		{"wrong token", "nope", `{"node_id": "web-1", "command": "uptime"}`, http.StatusUnauthorized, "Unauthorized"},
+		{"agent token", "secret", `{"node_id": "web-1", "command": "uptime"}`, http.StatusUnauthorized, "Unauthorized"},
+		{"bad json", "exec-secret", `{"node_id":`, http.StatusBadRequest, "invalid request"},
+		{"missing command", "exec-secret", `{"node_id": "web-1"}`, http.StatusBadRequest, "node_id and command are required"},
+		{"bad timeout", "exec-secret", `{"node_id": "web-1", "command": "uptime", "timeout": "-1s"}`, http.StatusBadRequest, "invalid timeout"},
+		{"unknown node", "exec-secret", `{"node_id": "db-9", "command": "uptime"}`, http.StatusNotFound, "node db-9 has no active tunnel"},
+		{"timeout", "exec-secret", `{"node_id": "web-1", "command": "sleep", "timeout": "100ms"}`, http.StatusGatewayTimeout, "timed out after 100ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postExec(t, ts.URL, tt.token, tt.body)
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("got %d %q, want %d containing %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/relay/exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestWSServer_ExecDisabledByDefault(t *testing.T) {
+	srv := NewWSServer(ServerConfig{AuthToken: "secret"}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	if status, _ := postExec(t, ts.URL, "secret", `{"node_id": "web-1", "command": "uptime"}`); status != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when ExecAPI is off", status)
+	}
+}
+
+func TestWSServer_ExecWithoutCredentialsConfigured(t *testing.T) {
+	_, ts := startExecRelay(t, ServerConfig{AuthToken: "secret"})
+	if status, _ := postExec(t, ts.URL, "secret", `{"node_id": "web-1", "command": "uptime"}`); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 with no exec token or exec clients configured", status)
+	}
+}
+
+func TestWSServer_AuthorizeExecClientCert(t *testing.T) {
+	caCert, caKey, err := GenerateCA("test-org", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	certFor := func(cn string) *x509.Certificate {
+		certPEM, _, err := GenerateNodeCert(caCert, caKey, cn, time.Hour)
+		if err != nil {
+			t.Fatalf("GenerateNodeCert: %v", err)
+		}
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("ParseCertificate: %v", err)
+		}
+		return cert
+	}
+
+	srv := NewWSServer(ServerConfig{ExecAPI: true, ExecClients: []string{"control-plane"}}, fleet.NewMemoryStore(), wsTestLogger())
+	for _, tt := range []struct {
+		cn         string
+		wantCaller string
+		wantStatus int
+	}{
+		{"control-plane", "cert:control-plane", http.StatusOK},
+		{"web-1", "", http.StatusForbidden}, // an agent's cert cannot drive other nodes
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/relay/exec", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certFor(tt.cn)}}
+		caller, status := srv.authorizeExec(r)
+		if caller != tt.wantCaller || status != tt.wantStatus {
+			t.Errorf("%s: authorizeExec = %q, %d; want %q, %d", tt.cn, caller, status, tt.wantCaller, tt.wantStatus)
+		}
+	}
+}
+
+func TestWSServer_EventsNeedExecClientCertUnderMTLS(t *testing.T) {
+	caCert, caKey, err := GenerateCA("test-org", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	certFor := func(cn string) *x509.Certificate {
+		certPEM, _, err := GenerateNodeCert(caCert, caKey, cn, time.Hour)
+		if err != nil {
+			t.Fatalf("GenerateNodeCert: %v", err)
+		}
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("ParseCertificate: %v", err)
+		}
+		return cert
+	}
+
+	// An mTLS-only relay: no bearer token to fall back on.
+	srv := NewWSServer(ServerConfig{
+		MTLS:        &MTLSConfig{CACertFile: "ca.pem", RequireClientCert: true},
+		ExecClients: []string{"control-plane"},
+	}, fleet.NewMemoryStore(), wsTestLogger())
+	for _, tt := range []struct {
+		cn         string
+		wantStatus int
+	}{
+		{"", http.StatusUnauthorized},
+		{"web-1", http.StatusForbidden}, // every agent holds a cert from the same CA
+		{"control-plane", http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/relay/events", nil)
+		if tt.cn != "" {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certFor(tt.cn)}}
+		}
+		w := httptest.NewRecorder()
+		srv.handleEvents(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("cert %q: status = %d, want %d", tt.cn, w.Code, tt.wantStatus)
+		}
+	}
+
+	// With nothing configured the relay stays open, as before.
+	open := NewWSServer(ServerConfig{}, fleet.NewMemoryStore(), wsTestLogger())
+	w := httptest.NewRecorder()
+	open.handleEvents(w, httptest.NewRequest(http.MethodGet, "/relay/events", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("open relay status = %d, want 200", w.Code)
+	}
+}
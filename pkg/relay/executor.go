@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
 )
@@ -33,23 +38,126 @@ var relayDenyPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`\bsource\s+.*\.sh\b`),
 }
 
+// DefaultMaxOutputBytes is how much output a command keeps when the
+// executor has no MaxOutputBytes.
+const DefaultMaxOutputBytes = 64 << 10
+
 // ShellExecutor implements LocalExecutor by running shell commands locally.
 type ShellExecutor struct {
 	WorkDir      string
 	DenyPatterns []string
+
+	// MaxOutputBytes caps the output kept per command, stdout and stderr
+	// each; output past it is counted but dropped. Zero means
+	// DefaultMaxOutputBytes. A command's own MaxOutputBytes can only lower
+	// it.
+	MaxOutputBytes int64
+
+	// AllowSudo lets shell commands that set Sudo run through sudo. It is
+	// off by default: such commands are blocked, since sudo is exactly
+	// what the deny patterns keep out of plain commands.
+	AllowSudo bool
+
+	// Allow-list mode (see EnableAllowList). When set, only approved
+	// commands run and the deny patterns are not consulted.
+	allowListMode bool
+	allowRules    []allowRule
 }
 
+// allowRule is a compiled allow-list entry: an exact command or a regexp.
+type allowRule struct {
+	exact string
+	re    *regexp.Regexp
+}
+
+// allowRegexPrefix marks an allow-list entry as a regular expression.
+const allowRegexPrefix = "re:"
+
 // NewShellExecutor creates a local shell command executor.
 func NewShellExecutor(workDir string) *ShellExecutor {
 	return &ShellExecutor{WorkDir: workDir}
 }
 
+// EnableAllowList switches the executor to a positive security model: a
+// shell command runs only if it matches one of patterns, and everything else
+// is rejected with status "denied". File and script commands are rejected
+// too, since they cannot match a command pattern.
+//
+// A pattern is either an exact command, compared after collapsing
+// whitespace, or a regular expression prefixed with "re:" that must match
+// the whole command (it is anchored, so "re:systemctl status \S+" does not
+// admit "systemctl status nginx; rm -rf /"). An empty list denies everything.
+func (e *ShellExecutor) EnableAllowList(patterns []string) error {
+	rules := make([]allowRule, 0, len(patterns))
+	for _, p := range patterns {
+		if expr, ok := strings.CutPrefix(p, allowRegexPrefix); ok {
+			re, err := regexp.Compile(`^(?:` + expr + `)$`)
+			if err != nil {
+				return fmt.Errorf("invalid allow-list pattern %q: %w", p, err)
+			}
+			rules = append(rules, allowRule{re: re})
+			continue
+		}
+		if exact := normalizeCommand(p); exact != "" {
+			rules = append(rules, allowRule{exact: exact})
+		}
+	}
+	e.allowListMode = true
+	e.allowRules = rules
+	return nil
+}
+
+// commandAllowed reports whether command matches an allow-list rule.
+func (e *ShellExecutor) commandAllowed(command string) bool {
+	normalized := normalizeCommand(command)
+	trimmed := strings.TrimSpace(command)
+	for _, r := range e.allowRules {
+		if r.re != nil {
+			if r.re.MatchString(trimmed) {
+				return true
+			}
+		} else if r.exact == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCommand collapses runs of whitespace for exact comparisons.
+func normalizeCommand(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
+
+func deniedResult(reason string) *fleet.NodeResult {
+	return &fleet.NodeResult{
+		Error:    "command denied by node allow-list (" + reason + ")",
+		Status:   "denied",
+		ExitCode: -1,
+	}
+}
+
 // Execute runs a typed command locally on this node.
 func (e *ShellExecutor) Execute(ctx context.Context, cmd fleet.TypedCommand) (*fleet.NodeResult, error) {
+	return e.ExecuteStream(ctx, cmd, nil)
+}
+
+// ExecuteStream runs a typed command like Execute, calling onLine with each
+// line a shell command writes to stdout or stderr as it is produced. The
+// returned result still holds the complete output.
+func (e *ShellExecutor) ExecuteStream(ctx context.Context, cmd fleet.TypedCommand, onLine func(line string)) (*fleet.NodeResult, error) {
+	limit := e.outputLimit(cmd.MaxOutputBytes)
 	switch cmd.Type {
 	case "shell":
-		return e.executeShell(ctx, cmd.Data)
+		return e.executeShell(ctx, cmd.Data, limit, onLine)
+	case "script":
+		if e.allowListMode {
+			return deniedResult("script commands are not allowed"), nil
+		}
+		return e.executeScript(ctx, cmd.Data, limit, onLine)
 	case "file":
+		if e.allowListMode {
+			return deniedResult("file commands are not allowed"), nil
+		}
 		return e.executeFile(ctx, cmd.Data)
 	default:
 		return &fleet.NodeResult{
@@ -60,6 +168,19 @@ func (e *ShellExecutor) Execute(ctx context.Context, cmd fleet.TypedCommand) (*f
 	}
 }
 
+// outputLimit resolves the output limit for a command that asked for
+// requested bytes (0 for no preference).
+func (e *ShellExecutor) outputLimit(requested int64) int64 {
+	limit := e.MaxOutputBytes
+	if limit <= 0 {
+		limit = DefaultMaxOutputBytes
+	}
+	if requested > 0 && requested < limit {
+		limit = requested
+	}
+	return limit
+}
+
 // guardRelayCommand checks a command against the relay deny patterns.
 // Returns an error string if blocked, empty string if allowed.
 func guardRelayCommand(command string) string {
@@ -72,32 +193,47 @@ func guardRelayCommand(command string) string {
 	return ""
 }
 
-func (e *ShellExecutor) executeShell(ctx context.Context, data json.RawMessage) (*fleet.NodeResult, error) {
+func (e *ShellExecutor) executeShell(ctx context.Context, data json.RawMessage, limit int64, onLine func(string)) (*fleet.NodeResult, error) {
 	var sc fleet.ShellCommand
 	if err := json.Unmarshal(data, &sc); err != nil {
 		return nil, fmt.Errorf("unmarshal shell command: %w", err)
 	}
 
-	// Guard: deny dangerous commands
-	if guardErr := guardRelayCommand(sc.Command); guardErr != "" {
+	// Guard: in allow-list mode only approved commands run; otherwise deny
+	// dangerous commands. Env (BASH_ENV, LD_PRELOAD), a custom shell or a
+	// work dir would change what an approved command does, so the caller
+	// may not set them in allow-list mode.
+	if sc.Sudo && !e.AllowSudo {
+		if e.allowListMode {
+			return deniedResult("sudo is not allowed"), nil
+		}
 		return &fleet.NodeResult{
-			Error:    guardErr,
+			Error:    "command blocked by relay safety guard (sudo is not enabled on this node; set relay.allow_sudo in the agent's config)",
 			Status:   "blocked",
 			ExitCode: -1,
 		}, nil
 	}
-
-	// Enforce maximum timeout of 120 seconds
-	timeout := 30 * time.Second
-	if sc.TimeoutSec > 0 {
-		timeout = time.Duration(sc.TimeoutSec) * time.Second
-	}
-	maxTimeout := 120 * time.Second
-	if timeout > maxTimeout {
-		timeout = maxTimeout
+	if e.allowListMode {
+		switch {
+		case len(sc.Env) > 0:
+			return deniedResult("env is not allowed"), nil
+		case sc.Shell != "":
+			return deniedResult("shell is not allowed"), nil
+		case sc.WorkDir != "":
+			return deniedResult("work_dir is not allowed"), nil
+		}
+		if !e.commandAllowed(sc.Command) {
+			return deniedResult("no approved pattern matched"), nil
+		}
+	} else if guardErr := guardRelayCommand(sc.Command); guardErr != "" {
+		return &fleet.NodeResult{
+			Error:    guardErr,
+			Status:   "blocked",
+			ExitCode: -1,
+		}, nil
 	}
 
-	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout(sc.TimeoutSec))
 	defer cancel()
 
 	shell := sc.Shell
@@ -105,7 +241,15 @@ func (e *ShellExecutor) executeShell(ctx context.Context, data json.RawMessage)
 		shell = "/bin/sh"
 	}
 
-	cmd := exec.CommandContext(cmdCtx, shell, "-c", sc.Command)
+	argv, guardErr := shellArgv(sc, shell)
+	if guardErr != "" {
+		return &fleet.NodeResult{
+			Error:    guardErr,
+			Status:   "blocked",
+			ExitCode: -1,
+		}, nil
+	}
+	cmd := exec.CommandContext(cmdCtx, argv[0], argv[1:]...)
 
 	// Validate working directory — prevent traversal
 	workDir := e.WorkDir
@@ -123,36 +267,131 @@ func (e *ShellExecutor) executeShell(ctx context.Context, data json.RawMessage)
 		cmd.Dir = workDir
 	}
 
-	for k, v := range sc.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	// Under sudo the variables are passed through env in argv, since sudo
+	// resets the environment it is started with.
+	if !sc.Sudo {
+		for k, v := range sc.Env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	result := runCommand(cmdCtx, cmd, limit, onLine)
+	result.WorkDir = resolveWorkDir(workDir)
+	result.Shell = shell
+	if sc.Sudo && sudoPasswordRequired(result) {
+		result.Error = fmt.Sprintf("sudo as %s requires a password on this node; grant the agent's user passwordless (NOPASSWD) sudo to run commands with --sudo", sudoUser(sc))
+		result.Reason = fleet.ReasonSudoPasswordRequired
+	}
+	return result, nil
+}
+
+// sudoPasswordPrompt is what sudo -n prints, before exiting 1, when it
+// would have had to prompt for a password.
+const sudoPasswordPrompt = "sudo: a password is required"
+
+func sudoPasswordRequired(result *fleet.NodeResult) bool {
+	return result.Status == "failure" && result.ExitCode == 1 &&
+		strings.Contains(result.Output, sudoPasswordPrompt)
+}
 
+func sudoUser(sc fleet.ShellCommand) string {
+	if sc.SudoUser == "" {
+		return "root"
+	}
+	return sc.SudoUser
+}
+
+// shellArgv returns the argv that runs sc with shell (see
+// fleet.ShellCommand.Argv), or a guard error for a user or variable name
+// that could be read as an option.
+func shellArgv(sc fleet.ShellCommand, shell string) ([]string, string) {
+	argv, err := sc.Argv(shell)
+	if err != nil {
+		return nil, "command blocked by relay safety guard (" + err.Error() + ")"
+	}
+	return argv, ""
+}
+
+// commandTimeout resolves a command's timeout in seconds: 30s by default,
+// capped at 120s.
+func commandTimeout(sec int) time.Duration {
+	timeout := 30 * time.Second
+	if sec > 0 {
+		timeout = time.Duration(sec) * time.Second
+	}
+	maxTimeout := 120 * time.Second
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	return timeout
+}
+
+// killWaitDelay is how long runCommand waits for a finished or killed
+// command's output to close before giving up on it.
+const killWaitDelay = 2 * time.Second
+
+// runCommand runs cmd, which must have been created with cmdCtx, and
+// reports its combined output and exit status. Each of stdout and stderr
+// keeps at most limit bytes, and so does the combined output; the rest is
+// only counted, so a chatty command cannot exhaust the node's memory.
+// onLine, if set, receives each kept output line as it is written.
+func runCommand(cmdCtx context.Context, cmd *exec.Cmd, limit int64, onLine func(string)) *fleet.NodeResult {
+	var stdout, stderr bytes.Buffer
+	outSink, errSink := io.Writer(&stdout), io.Writer(&stderr)
+	var outLines, errLines *lineWriter
+	if onLine != nil {
+		// stdout and stderr are copied from separate goroutines.
+		var mu sync.Mutex
+		emit := func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			onLine(line)
+		}
+		outLines, errLines = &lineWriter{emit: emit}, &lineWriter{emit: emit}
+		outSink = io.MultiWriter(&stdout, outLines)
+		errSink = io.MultiWriter(&stderr, errLines)
+	}
+	outLimit := &limitWriter{w: outSink, remaining: limit}
+	errLimit := &limitWriter{w: errSink, remaining: limit}
+	cmd.Stdout = outLimit
+	cmd.Stderr = errLimit
+
+	// Cancelling kills the shell's whole process group. Once the shell
+	// exits, children it left running that still hold its output open must
+	// not keep Run waiting.
+	killProcessGroup(cmd)
+	cmd.WaitDelay = killWaitDelay
 	start := time.Now()
 	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The command itself exited cleanly.
+		err = nil
+	}
 	duration := time.Since(start)
+	if onLine != nil {
+		outLines.Flush()
+		errLines.Flush()
+	}
 
 	result := &fleet.NodeResult{
-		Output:   stdout.String(),
-		Duration: duration,
+		Output:      stdout.String(),
+		Duration:    duration,
+		OutputBytes: outLimit.written + errLimit.written,
 	}
 
 	if stderr.Len() > 0 {
 		result.Output += "\n" + stderr.String()
 	}
-
-	// Truncate output to prevent memory exhaustion
-	const maxOutput = 10000
-	if len(result.Output) > maxOutput {
-		result.Output = result.Output[:maxOutput] + fmt.Sprintf("\n... (truncated, %d more chars)", len(result.Output)-maxOutput)
+	result.Truncated = outLimit.dropped() || errLimit.dropped()
+	if int64(len(result.Output)) > limit {
+		result.Output = truncateUTF8(result.Output, int(limit))
+		result.Truncated = true
 	}
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			result.ExitCode = exitErr.ExitCode()
+			result.Signal = terminatingSignal(exitErr.ProcessState)
 		} else {
 			result.ExitCode = -1
 		}
@@ -167,9 +406,209 @@ func (e *ShellExecutor) executeShell(ctx context.Context, data json.RawMessage)
 		result.Status = "success"
 	}
 
+	return result
+}
+
+// limitWriter passes the first remaining bytes written to it on to w and
+// drops the rest, counting everything. It never fails a write, so the
+// command is not killed by a broken pipe once the limit is reached.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+	written   int64 // bytes written to the limitWriter
+	kept      int64 // bytes passed on to w
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	l.written += int64(len(p))
+	keep := p
+	if int64(len(keep)) > l.remaining {
+		keep = keep[:l.remaining]
+	}
+	if len(keep) == 0 {
+		return len(p), nil
+	}
+	l.remaining -= int64(len(keep))
+	l.kept += int64(len(keep))
+	if _, err := l.w.Write(keep); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// dropped reports whether any output went past the limit.
+func (l *limitWriter) dropped() bool {
+	return l.written > l.kept
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// executeScript writes a ScriptCommand to a private temporary file and runs
+// it with the requested interpreter. The file is removed however the run
+// ends. Scripts are held to the same deny patterns as shell commands.
+func (e *ShellExecutor) executeScript(ctx context.Context, data json.RawMessage, limit int64, onLine func(string)) (*fleet.NodeResult, error) {
+	var sc fleet.ScriptCommand
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("unmarshal script command: %w", err)
+	}
+	script, err := sc.Script()
+	if err != nil {
+		return &fleet.NodeResult{Error: err.Error(), Status: "failure", ExitCode: -1}, nil
+	}
+
+	if guardErr := guardRelayCommand(string(script)); guardErr != "" {
+		return &fleet.NodeResult{
+			Error:    guardErr,
+			Status:   "blocked",
+			ExitCode: -1,
+		}, nil
+	}
+
+	interpreter := scriptInterpreter(sc.Interpreter)
+	if strings.ContainsAny(interpreter, " \t\n") {
+		return &fleet.NodeResult{
+			Error:    fmt.Sprintf("invalid interpreter %q: want a program name or path", sc.Interpreter),
+			Status:   "failure",
+			ExitCode: -1,
+		}, nil
+	}
+
+	path, err := writeScriptFile(script)
+	if err != nil {
+		return &fleet.NodeResult{Error: err.Error(), Status: "failure", ExitCode: -1}, nil
+	}
+	defer os.Remove(path)
+
+	cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout(sc.TimeoutSec))
+	defer cancel()
+
+	cmd := exec.CommandContext(cmdCtx, interpreter, path)
+	if e.WorkDir != "" {
+		cmd.Dir = e.WorkDir
+	}
+
+	result := runCommand(cmdCtx, cmd, limit, onLine)
+	result.WorkDir = resolveWorkDir(e.WorkDir)
+	result.Shell = interpreter
 	return result, nil
 }
 
+// scriptInterpreter resolves a ScriptCommand interpreter; bare names such
+// as "bash" are looked up on PATH when the command runs.
+func scriptInterpreter(name string) string {
+	if name == "" {
+		return "/bin/sh"
+	}
+	return name
+}
+
+// writeScriptFile saves script to a new temporary file readable only by
+// this user and returns its path.
+func writeScriptFile(script []byte) (string, error) {
+	f, err := os.CreateTemp("", "devopsclaw-script-*")
+	if err != nil {
+		return "", fmt.Errorf("create script file: %w", err)
+	}
+	_, err = f.Write(script)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o700)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write script file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// lineWriter splits written bytes into lines and passes each complete line,
+// without its newline, to emit. Flush emits any trailing partial line.
+type lineWriter struct {
+	emit    func(line string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits the remaining partial line, if any.
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.emit(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// resolveWorkDir returns the absolute directory a command runs in: dir
+// itself, or the agent's own working directory when dir is empty.
+func resolveWorkDir(dir string) string {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		return wd
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// signalNames maps the signals that commonly end a fleet command to their
+// conventional names; syscall.Signal.String gives only a description.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// terminatingSignal names the signal that killed a process, or returns ""
+// if it exited normally.
+func terminatingSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	ws, ok := state.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	})
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	sig := ws.Signal()
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d (%s)", int(sig), sig)
+}
+
 func (e *ShellExecutor) executeFile(ctx context.Context, data json.RawMessage) (*fleet.NodeResult, error) {
 	var fc fleet.FileCommand
 	if err := json.Unmarshal(data, &fc); err != nil {
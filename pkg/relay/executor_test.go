@@ -0,0 +1,517 @@
+package relay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+func shellCmd(t *testing.T, command string) fleet.TypedCommand {
+	t.Helper()
+	data, err := json.Marshal(fleet.ShellCommand{Command: command})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fleet.TypedCommand{Type: "shell", Data: data}
+}
+
+func TestShellExecutor_AllowListDecisions(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList([]string{
+		"echo approved",
+		"re:echo status [a-z]+",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"echo approved", true},
+		{"  echo   approved ", true},             // exact match ignores whitespace runs
+		{"echo approved now", false},             // exact means exact
+		{"echo status nginx", true},              // pattern match
+		{"echo status nginx; echo pwned", false}, // patterns are anchored
+		{"echo status NGINX", false},
+		{"echo other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			result, err := e.Execute(context.Background(), shellCmd(t, tt.command))
+			if err != nil {
+				t.Fatalf("Execute() error: %v", err)
+			}
+			if tt.allowed {
+				if result.Status != "success" {
+					t.Errorf("status = %q (%s), want success", result.Status, result.Error)
+				}
+				return
+			}
+			if result.Status != "denied" {
+				t.Errorf("status = %q, want denied", result.Status)
+			}
+			if !strings.Contains(result.Error, "allow-list") {
+				t.Errorf("error = %q, want allow-list reason", result.Error)
+			}
+		})
+	}
+}
+
+func TestShellExecutor_AllowListTakesPrecedenceOverDenyList(t *testing.T) {
+	// "sudo" trips the deny patterns in the default mode.
+	command := "echo sudo"
+
+	e := NewShellExecutor("")
+	result, _ := e.Execute(context.Background(), shellCmd(t, command))
+	if result.Status != "blocked" {
+		t.Fatalf("default mode status = %q, want blocked", result.Status)
+	}
+
+	if err := e.EnableAllowList([]string{command}); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = e.Execute(context.Background(), shellCmd(t, command))
+	if result.Status != "success" {
+		t.Errorf("allow-list mode status = %q (%s), want success", result.Status, result.Error)
+	}
+}
+
+func TestShellExecutor_EmptyAllowListDeniesEverything(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := e.Execute(context.Background(), shellCmd(t, "true"))
+	if result.Status != "denied" {
+		t.Errorf("status = %q, want denied", result.Status)
+	}
+}
+
+func TestShellExecutor_AllowListDeniesFileCommands(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList([]string{"re:.*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(fleet.FileCommand{Action: "read", Path: "/etc/hostname"})
+	result, _ := e.Execute(context.Background(), fleet.TypedCommand{Type: "file", Data: data})
+	if result.Status != "denied" {
+		t.Errorf("status = %q, want denied", result.Status)
+	}
+}
+
+func scriptCmd(t *testing.T, script, interpreter string) fleet.TypedCommand {
+	t.Helper()
+	cmd, err := fleet.NewScriptCommand([]byte(script), interpreter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestShellExecutor_Script(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts need /bin/sh")
+	}
+
+	// The script prints its own path so the test can check it was removed,
+	// including when the script fails.
+	for _, tt := range []struct {
+		name, script, status string
+		exitCode             int
+	}{
+		{"success", "echo \"$0\"\necho 'multi \"quoted\" line'\n", "success", 0},
+		{"failure", "echo \"$0\"\nexit 4\n", "failure", 4},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewShellExecutor("").Execute(context.Background(), scriptCmd(t, tt.script, ""))
+			if err != nil {
+				t.Fatalf("Execute() error: %v", err)
+			}
+			if result.Status != tt.status || result.ExitCode != tt.exitCode {
+				t.Fatalf("status %q exit %d (%s), want %q exit %d", result.Status, result.ExitCode, result.Error, tt.status, tt.exitCode)
+			}
+			if result.Shell != "/bin/sh" {
+				t.Errorf("Shell = %q, want the /bin/sh default", result.Shell)
+			}
+
+			path := strings.SplitN(result.Output, "\n", 2)[0]
+			if !strings.Contains(path, "devopsclaw-script-") {
+				t.Fatalf("output = %q, want the script path first", result.Output)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("script file %s still exists (stat err %v)", path, err)
+			}
+			if tt.status == "success" && !strings.Contains(result.Output, `multi "quoted" line`) {
+				t.Errorf("output = %q", result.Output)
+			}
+		})
+	}
+}
+
+func TestShellExecutor_ScriptInterpreter(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+
+	// BASH_VERSION is only set when bash runs the script.
+	const script = "echo \"bash=${BASH_VERSION:+yes}\"\n"
+	e := NewShellExecutor("")
+
+	result, _ := e.Execute(context.Background(), scriptCmd(t, script, "bash"))
+	if result.Status != "success" || !strings.Contains(result.Output, "bash=yes") {
+		t.Errorf("bash: status %q output %q, want bash to run the script", result.Status, result.Output)
+	}
+	if result.Shell != "bash" {
+		t.Errorf("Shell = %q, want bash", result.Shell)
+	}
+
+	result, _ = e.Execute(context.Background(), scriptCmd(t, script, ""))
+	if result.Shell != "/bin/sh" {
+		t.Errorf("Shell = %q, want /bin/sh", result.Shell)
+	}
+
+	result, _ = e.Execute(context.Background(), scriptCmd(t, script, "bash -x"))
+	if result.Status != "failure" || !strings.Contains(result.Error, "invalid interpreter") {
+		t.Errorf("status %q error %q, want the interpreter rejected", result.Status, result.Error)
+	}
+}
+
+func TestShellExecutor_ScriptTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts need /bin/sh")
+	}
+
+	data, _ := json.Marshal(fleet.ScriptCommand{
+		Content:    base64.StdEncoding.EncodeToString([]byte("sleep 10\n")),
+		TimeoutSec: 1,
+	})
+	start := time.Now()
+	result, err := NewShellExecutor("").Execute(context.Background(), fleet.TypedCommand{Type: "script", Data: data})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if result.Status != "timeout" {
+		t.Errorf("status = %q, want timeout", result.Status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("script ran %s, want it stopped after timeout_sec", elapsed)
+	}
+}
+
+func TestShellExecutor_ScriptGuards(t *testing.T) {
+	e := NewShellExecutor("")
+	result, _ := e.Execute(context.Background(), scriptCmd(t, "echo ok\nsudo reboot\n", ""))
+	if result.Status != "blocked" {
+		t.Errorf("status = %q, want blocked by the deny patterns", result.Status)
+	}
+
+	if err := e.EnableAllowList([]string{"re:.*"}); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = e.Execute(context.Background(), scriptCmd(t, "echo ok\n", ""))
+	if result.Status != "denied" {
+		t.Errorf("status = %q, want denied in allow-list mode", result.Status)
+	}
+}
+
+func TestShellExecutor_AllowListInvalidPattern(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList([]string{"re:([unclosed"}); err == nil {
+		t.Error("expected error for invalid regexp")
+	}
+}
+
+func TestShellExecutor_ReportsEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "pwd", WorkDir: dir, Shell: "/bin/sh"})
+
+	e := NewShellExecutor("")
+	result, err := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if result.WorkDir != dir {
+		t.Errorf("WorkDir = %q, want %q", result.WorkDir, dir)
+	}
+	if result.Shell != "/bin/sh" {
+		t.Errorf("Shell = %q, want /bin/sh", result.Shell)
+	}
+	if result.Signal != "" {
+		t.Errorf("Signal = %q, want none for a clean exit", result.Signal)
+	}
+}
+
+func TestShellExecutor_DefaultEnvironment(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := NewShellExecutor("").Execute(context.Background(), shellCmd(t, "exit 3"))
+	if result.WorkDir != wd {
+		t.Errorf("WorkDir = %q, want the agent's directory %q", result.WorkDir, wd)
+	}
+	if result.Shell != "/bin/sh" {
+		t.Errorf("Shell = %q, want the /bin/sh default", result.Shell)
+	}
+	if result.ExitCode != 3 || result.Signal != "" {
+		t.Errorf("exit code %d signal %q, want 3 and no signal", result.ExitCode, result.Signal)
+	}
+}
+
+func TestShellExecutor_ReportsSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are POSIX-only")
+	}
+
+	result, _ := NewShellExecutor("").Execute(context.Background(), shellCmd(t, "kill -KILL $$"))
+	if result.Status != "failure" {
+		t.Errorf("status = %q, want failure", result.Status)
+	}
+	if result.Signal != "SIGKILL" {
+		t.Errorf("Signal = %q, want SIGKILL", result.Signal)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{emit: func(l string) { lines = append(lines, l) }}
+
+	w.Write([]byte("Get:1 http://deb"))
+	w.Write([]byte("ian.org stable\r\nGet:2 ok\n\nFetched"))
+	if want := []string{"Get:1 http://debian.org stable", "Get:2 ok", ""}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+	w.Flush()
+	if lines[len(lines)-1] != "Fetched" {
+		t.Errorf("Flush should emit the trailing partial line, got %q", lines)
+	}
+}
+
+func TestShellExecutor_TruncatesOutput(t *testing.T) {
+	e := NewShellExecutor("")
+	e.MaxOutputBytes = 1000
+
+	result, err := e.Execute(context.Background(), shellCmd(t, "head -c 5000 /dev/zero | tr '\\0' a"))
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("status = %q (%s), want success", result.Status, result.Error)
+	}
+	if len(result.Output) != 1000 || !result.Truncated || result.OutputBytes != 5000 {
+		t.Errorf("output %d bytes, truncated %v, total %d; want 1000, true, 5000",
+			len(result.Output), result.Truncated, result.OutputBytes)
+	}
+
+	// A request can lower the node's limit but not raise it.
+	cmd := shellCmd(t, "head -c 5000 /dev/zero | tr '\\0' a")
+	cmd.MaxOutputBytes = 100
+	result, _ = e.Execute(context.Background(), cmd)
+	if len(result.Output) != 100 || !result.Truncated {
+		t.Errorf("lowered limit: output %d bytes, truncated %v", len(result.Output), result.Truncated)
+	}
+	cmd.MaxOutputBytes = 1 << 20
+	result, _ = e.Execute(context.Background(), cmd)
+	if len(result.Output) != 1000 {
+		t.Errorf("raised limit: output %d bytes, want the node's 1000", len(result.Output))
+	}
+
+	// Output within the limit is untouched but still counted.
+	result, _ = e.Execute(context.Background(), shellCmd(t, "printf hello"))
+	if result.Output != "hello" || result.Truncated || result.OutputBytes != 5 {
+		t.Errorf("short output = %q, truncated %v, total %d", result.Output, result.Truncated, result.OutputBytes)
+	}
+}
+
+func TestShellExecutor_TruncatesCombinedOutput(t *testing.T) {
+	e := NewShellExecutor("")
+	e.MaxOutputBytes = 10
+
+	result, _ := e.Execute(context.Background(), shellCmd(t, "printf 12345678; printf abcdefgh >&2"))
+	if result.Output != "12345678\na" || !result.Truncated || result.OutputBytes != 16 {
+		t.Errorf("output = %q, truncated %v, total %d", result.Output, result.Truncated, result.OutputBytes)
+	}
+}
+
+func TestLimitWriter(t *testing.T) {
+	var buf strings.Builder
+	w := &limitWriter{w: &buf, remaining: 5}
+	for _, chunk := range []string{"abc", "defg", "hij"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v; want every byte accepted", chunk, n, err)
+		}
+	}
+	if buf.String() != "abcde" || w.written != 10 || !w.dropped() {
+		t.Errorf("kept %q, written %d, dropped %v", buf.String(), w.written, w.dropped())
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	if got := truncateUTF8("añb", 2); got != "a" {
+		t.Errorf("truncateUTF8 split a character: %q", got)
+	}
+	if got := truncateUTF8("añb", 3); got != "añ" {
+		t.Errorf("truncateUTF8 = %q, want añ", got)
+	}
+}
+
+func TestShellArgv(t *testing.T) {
+	tests := []struct {
+		name string
+		sc   fleet.ShellCommand
+		want []string
+	}{
+		{"plain", fleet.ShellCommand{Command: "uptime"}, []string{"/bin/sh", "-c", "uptime"}},
+		{"sudo defaults to root", fleet.ShellCommand{Command: "uptime", Sudo: true},
+			[]string{"sudo", "-n", "-u", "root", "--", "/bin/sh", "-c", "uptime"}},
+		{"sudo user", fleet.ShellCommand{Command: "whoami", Sudo: true, SudoUser: "deploy"},
+			[]string{"sudo", "-n", "-u", "deploy", "--", "/bin/sh", "-c", "whoami"}},
+		{"sudo env", fleet.ShellCommand{Command: "./deploy.sh", Sudo: true, Env: map[string]string{"DEPLOY_VERSION": "v2", "APP": "web app"}},
+			[]string{"sudo", "-n", "-u", "root", "--", "env", "APP=web app", "DEPLOY_VERSION=v2", "/bin/sh", "-c", "./deploy.sh"}},
+	}
+	for _, tt := range tests {
+		got, guardErr := shellArgv(tt.sc, "/bin/sh")
+		if guardErr != "" {
+			t.Errorf("%s: guard error %q", tt.name, guardErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: argv = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	for _, sc := range []fleet.ShellCommand{
+		{Command: "id", Sudo: true, SudoUser: "-s"},
+		{Command: "id", Sudo: true, SudoUser: "root bob"},
+		{Command: "id", Sudo: true, Env: map[string]string{"-i": "x"}},
+	} {
+		if _, guardErr := shellArgv(sc, "/bin/sh"); guardErr == "" {
+			t.Errorf("shellArgv(%+v) was not blocked", sc)
+		}
+	}
+}
+
+// fakeSudo puts a sudo on PATH that runs the command after "--" itself,
+// or fails as sudo -n does without passwordless sudo.
+func fakeSudo(t *testing.T, needsPassword bool) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("sudo is POSIX-only")
+	}
+	script := "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n"
+	if needsPassword {
+		script = "#!/bin/sh\necho 'sudo: a password is required' >&2\nexit 1\n"
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/sudo", []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestShellExecutor_Sudo(t *testing.T) {
+	fakeSudo(t, false)
+	data, _ := json.Marshal(fleet.ShellCommand{
+		Command: `DEPLOY_SERVICE="web" sh -c 'echo $DEPLOY_SERVICE $RELEASE'`,
+		Env:     map[string]string{"RELEASE": "v2"},
+		Sudo:    true,
+	})
+
+	e := NewShellExecutor("")
+	e.AllowSudo = true
+	result, err := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if result.Status != "success" || strings.TrimSpace(result.Output) != "web v2" {
+		t.Errorf("result = %+v, want the command run with both variables", result)
+	}
+}
+
+func TestShellExecutor_SudoPasswordRequired(t *testing.T) {
+	fakeSudo(t, true)
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "systemctl restart nginx", Sudo: true, SudoUser: "ops"})
+
+	e := NewShellExecutor("")
+	e.AllowSudo = true
+	result, _ := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+	if result.Status != "failure" || result.Reason != fleet.ReasonSudoPasswordRequired {
+		t.Errorf("status %q reason %q, want failure and %q", result.Status, result.Reason, fleet.ReasonSudoPasswordRequired)
+	}
+	if !strings.Contains(result.Error, "sudo as ops requires a password") {
+		t.Errorf("Error = %q", result.Error)
+	}
+}
+
+func TestShellExecutor_SudoNeedsOptIn(t *testing.T) {
+	fakeSudo(t, false)
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "echo ran", Sudo: true})
+
+	result, _ := NewShellExecutor("").Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+	if result.Status != "blocked" || !strings.Contains(result.Error, "relay.allow_sudo") {
+		t.Errorf("result = %+v, want blocked until the agent allows sudo", result)
+	}
+	if strings.Contains(result.Output, "ran") {
+		t.Error("command ran without AllowSudo")
+	}
+}
+
+func TestShellExecutor_AllowListWithSudo(t *testing.T) {
+	fakeSudo(t, false)
+	e := NewShellExecutor("")
+	e.AllowSudo = true
+	if err := e.EnableAllowList([]string{"echo ok"}); err != nil {
+		t.Fatal(err)
+	}
+	for cmd, want := range map[string]string{"echo ok": "success", "echo other": "denied"} {
+		data, _ := json.Marshal(fleet.ShellCommand{Command: cmd, Sudo: true})
+		result, _ := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+		if result.Status != want {
+			t.Errorf("%q: status = %q, want %s", cmd, result.Status, want)
+		}
+	}
+}
+
+func TestShellExecutor_AllowListDeniesSudo(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList([]string{"uptime"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "uptime", Sudo: true})
+	result, _ := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+	if result.Status != "denied" {
+		t.Errorf("status = %q, want denied", result.Status)
+	}
+}
+
+func TestShellExecutor_AllowListDeniesEnvShellAndWorkDir(t *testing.T) {
+	e := NewShellExecutor("")
+	if err := e.EnableAllowList([]string{"uptime"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, sc := range map[string]fleet.ShellCommand{
+		"env":      {Command: "uptime", Env: map[string]string{"BASH_ENV": "/tmp/evil.sh"}},
+		"shell":    {Command: "uptime", Shell: "/tmp/evil"},
+		"work_dir": {Command: "uptime", WorkDir: "/tmp"},
+	} {
+		data, _ := json.Marshal(sc)
+		result, _ := e.Execute(context.Background(), fleet.TypedCommand{Type: "shell", Data: data})
+		if result.Status != "denied" || !strings.Contains(result.Error, name+" is not allowed") {
+			t.Errorf("%s: status %q (%s), want denied", name, result.Status, result.Error)
+		}
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -87,28 +88,78 @@ func ServerTLSConfig(cfg MTLSConfig) (*tls.Config, error) {
 
 // ClientTLSConfig builds a *tls.Config for a node agent connecting to the relay.
 // The agent presents its own cert and verifies the server's cert against the CA.
+// The client cert is served through GetClientCertificate from a
+// ClientCertReloader, so it can be swapped without rebuilding the config.
 func ClientTLSConfig(cfg MTLSConfig) (*tls.Config, error) {
+	tlsCfg, _, err := clientTLSConfig(cfg)
+	return tlsCfg, err
+}
+
+// clientTLSConfig is ClientTLSConfig, also returning the reloader behind
+// the config's GetClientCertificate.
+func clientTLSConfig(cfg MTLSConfig) (*tls.Config, *ClientCertReloader, error) {
 	// Load CA certificate pool (to verify server)
 	caCert, err := os.ReadFile(cfg.CACertFile)
 	if err != nil {
-		return nil, fmt.Errorf("read CA cert %s: %w", cfg.CACertFile, err)
+		return nil, nil, fmt.Errorf("read CA cert %s: %w", cfg.CACertFile, err)
 	}
 	caPool := x509.NewCertPool()
 	if !caPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to parse CA certificate from %s", cfg.CACertFile)
+		return nil, nil, fmt.Errorf("failed to parse CA certificate from %s", cfg.CACertFile)
 	}
 
 	// Load client certificate and key
-	clientCert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+	certs, err := NewClientCertReloader(cfg.ClientCertFile, cfg.ClientKeyFile)
 	if err != nil {
-		return nil, fmt.Errorf("load client cert/key: %w", err)
+		return nil, nil, err
 	}
 
 	return &tls.Config{
-		Certificates: []tls.Certificate{clientCert},
-		RootCAs:      caPool,
-		MinVersion:   tls.VersionTLS13,
-	}, nil
+		GetClientCertificate: certs.GetClientCertificate,
+		RootCAs:              caPool,
+		MinVersion:           tls.VersionTLS13,
+	}, certs, nil
+}
+
+// ClientCertReloader serves a client certificate loaded from a cert/key
+// pair on disk, re-reading the files on Reload. A handshake uses whichever
+// pair is current when it starts; connections already established keep
+// the certificate they presented.
+type ClientCertReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewClientCertReloader loads the pair once, failing if it is unreadable.
+func NewClientCertReloader(certFile, keyFile string) (*ClientCertReloader, error) {
+	r := &ClientCertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the cert/key pair. On error the previously loaded pair
+// stays in use, so a half-written renewal never leaves the agent without
+// a certificate.
+func (r *ClientCertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load client cert/key: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *ClientCertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
 }
 
 // ExtractNodeIDFromCert extracts the node ID from a verified client certificate.
@@ -2,6 +2,8 @@ package relay
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
@@ -173,8 +175,11 @@ func TestClientTLSConfig_mTLS(t *testing.T) {
 	if tlsCfg.RootCAs == nil {
 		t.Error("expected non-nil RootCAs pool")
 	}
-	if len(tlsCfg.Certificates) != 1 {
-		t.Errorf("expected 1 client certificate, got %d", len(tlsCfg.Certificates))
+	if tlsCfg.GetClientCertificate == nil {
+		t.Fatal("expected a GetClientCertificate callback")
+	}
+	if cert, err := tlsCfg.GetClientCertificate(&tls.CertificateRequestInfo{}); err != nil || len(cert.Certificate) == 0 {
+		t.Errorf("GetClientCertificate = %v, %v; want the node cert", cert, err)
 	}
 	if tlsCfg.MinVersion != tls.VersionTLS13 {
 		t.Errorf("MinVersion = %v, want TLS 1.3", tlsCfg.MinVersion)
@@ -208,3 +213,72 @@ func TestVerifyClientCert_NoPeerCerts(t *testing.T) {
 		t.Error("expected error for no peer certs")
 	}
 }
+
+// writeTestNodeCert issues a node cert from the CA into certPath/keyPath
+// and returns its serial number.
+func writeTestNodeCert(t *testing.T, caCert, caKey []byte, nodeID, certPath, keyPath string) *big.Int {
+	t.Helper()
+	certPEM, keyPEM, err := GenerateNodeCert(caCert, caKey, nodeID, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateNodeCert: %v", err)
+	}
+	if err := WriteCertFiles(certPath, keyPath, certPEM, keyPEM); err != nil {
+		t.Fatalf("WriteCertFiles: %v", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return leaf.SerialNumber
+}
+
+func TestClientCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey, err := GenerateCA("test-org", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	certPath, keyPath := filepath.Join(dir, "node.pem"), filepath.Join(dir, "node-key.pem")
+
+	if _, err := NewClientCertReloader(certPath, keyPath); err == nil {
+		t.Fatal("expected an error for missing files")
+	}
+
+	first := writeTestNodeCert(t, caCert, caKey, "node-a", certPath, keyPath)
+	r, err := NewClientCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("NewClientCertReloader: %v", err)
+	}
+	serial := func() *big.Int {
+		cert, err := r.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetClientCertificate: %v", err)
+		}
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.SerialNumber
+	}
+
+	second := writeTestNodeCert(t, caCert, caKey, "node-a", certPath, keyPath)
+	if got := serial(); got.Cmp(first) != 0 {
+		t.Errorf("cert changed before Reload: serial %v, want %v", got, first)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := serial(); got.Cmp(second) != 0 {
+		t.Errorf("after Reload serial = %v, want %v", got, second)
+	}
+
+	// A half-written renewal keeps the last good pair.
+	os.WriteFile(certPath, []byte("-----BEGIN CERTIFICATE-----\ntrunc"), 0o644)
+	if err := r.Reload(); err == nil {
+		t.Error("expected Reload to fail on a truncated cert")
+	}
+	if got := serial(); got.Cmp(second) != 0 {
+		t.Errorf("after failed Reload serial = %v, want %v", got, second)
+	}
+}
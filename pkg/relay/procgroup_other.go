@@ -0,0 +1,9 @@
+//go:build !unix
+
+package relay
+
+import "os/exec"
+
+// killProcessGroup is a stub for platforms without process groups;
+// cancelling kills only the shell.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -38,8 +38,42 @@ type ServerConfig struct {
 	MaxNodes   int           `json:"max_nodes"`
 	PingInterval time.Duration `json:"ping_interval"`
 	MTLS       *MTLSConfig   `json:"mtls,omitempty"` // mTLS config (replaces AuthToken)
+	AuditCommands bool       `json:"audit_commands,omitempty"` // record each dispatch in the fleet store
+	EventLogSize  int        `json:"event_log_size,omitempty"` // connect/disconnect events kept in memory (default 10000)
+
+	// MaxMessageBytes caps a single message from an agent (default
+	// DefaultMaxMessageBytes). An agent that sends a larger one has its
+	// tunnel closed, so a runaway output cannot exhaust relay memory.
+	MaxMessageBytes int64 `json:"max_message_bytes,omitempty"`
+
+	// Compression negotiates permessage-deflate with agents that support
+	// it, trading CPU for bandwidth on large outputs.
+	Compression bool `json:"compression,omitempty"`
+
+	// ExecAPI serves POST /relay/exec, letting another process run
+	// commands on connected nodes through this relay. Callers must present
+	// ExecToken or a client certificate whose CN is in ExecClients; with
+	// neither configured every request is refused. The agent AuthToken is
+	// never accepted, so an enrolled node cannot drive the others.
+	ExecAPI     bool     `json:"exec_api,omitempty"`
+	ExecToken   string   `json:"exec_token,omitempty"`
+	ExecClients []string `json:"exec_clients,omitempty"`
+
+	// DrainTimeout bounds how long WSServer.Shutdown waits for in-flight
+	// commands to return their results before closing tunnels (default
+	// 30s).
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty"`
+
+	// ACLs restrict agents by credential: which node IDs a token or cert
+	// CN may register as, and which command types reach them. Tokens
+	// listed here are accepted in addition to AuthToken.
+	ACLs []AgentACL `json:"acls,omitempty"`
 }
 
+// DefaultMaxMessageBytes is the default per-message size limit for relay
+// WebSocket connections.
+const DefaultMaxMessageBytes = 16 << 20
+
 // Server is the relay server that brokers connections between the
 // control plane and fleet nodes.
 type Server struct {
@@ -138,7 +172,7 @@ func (s *Server) SendCommand(ctx context.Context, nodeID fleet.NodeID, env *Comm
 	tunnel, ok := s.tunnels[nodeID]
 	s.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("no tunnel for node %s", nodeID)
+		return nil, fmt.Errorf("%w for node %s", fleet.ErrNoTunnel, nodeID)
 	}
 
 	// Send command
@@ -188,6 +222,35 @@ type AgentConfig struct {
 	MTLS         *MTLSConfig   `json:"mtls,omitempty"` // mTLS config (replaces AuthToken)
 	ReconnectInterval time.Duration `json:"reconnect_interval"`
 	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+
+	// MaxMessageBytes caps a single message from the relay (default
+	// DefaultMaxMessageBytes).
+	MaxMessageBytes int64 `json:"max_message_bytes,omitempty"`
+
+	// Compression offers permessage-deflate to the relay. It is used only
+	// if the relay has compression enabled too.
+	Compression bool `json:"compression,omitempty"`
+
+	// DisableCertReload keeps the mTLS client cert/key loaded on the first
+	// connect for every reconnect. By default they are re-read from disk
+	// before each reconnect, so a renewed certificate is picked up without
+	// restarting the agent.
+	DisableCertReload bool `json:"disable_cert_reload,omitempty"`
+
+	// MaxReconnectInterval caps the WebSocket agent's reconnect backoff,
+	// which starts at ReconnectInterval and doubles after each failed
+	// attempt (default 60s).
+	MaxReconnectInterval time.Duration `json:"max_reconnect_interval,omitempty"`
+
+	// ReconnectJitter shortens each reconnect delay by a random fraction
+	// of up to this much, so agents dropped together spread out their
+	// reconnects (default DefaultReconnectJitter, at most 1). A negative
+	// value disables jitter.
+	ReconnectJitter float64 `json:"reconnect_jitter,omitempty"`
+
+	// WorkDir is the directory whose filesystem the WebSocket agent reports
+	// disk usage for on each heartbeat (default the current directory).
+	WorkDir string `json:"work_dir,omitempty"`
 }
 
 // Agent runs on each fleet node, maintaining an outbound connection to the relay.
@@ -206,6 +269,14 @@ type LocalExecutor interface {
 	Execute(ctx context.Context, cmd fleet.TypedCommand) (*fleet.NodeResult, error)
 }
 
+// StreamingExecutor is a LocalExecutor that can report output line by line
+// while a command runs. WSAgent forwards those lines as "result_chunk"
+// messages.
+type StreamingExecutor interface {
+	LocalExecutor
+	ExecuteStream(ctx context.Context, cmd fleet.TypedCommand, onLine func(line string)) (*fleet.NodeResult, error)
+}
+
 // NewAgent creates a node relay agent.
 func NewAgent(config AgentConfig, executor LocalExecutor, logger *slog.Logger) *Agent {
 	if config.ReconnectInterval <= 0 {
@@ -343,7 +414,7 @@ func (c *TunnelRelayClient) Ping(ctx context.Context, node *fleet.Node) error {
 	_, ok := c.server.tunnels[node.ID]
 	c.server.mu.RUnlock()
 	if !ok {
-		return fmt.Errorf("no active tunnel for node %s", node.ID)
+		return fmt.Errorf("%w for node %s", fleet.ErrNoTunnel, node.ID)
 	}
 	return nil
 }
@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// collectResources returns the node's resource profile with its current
+// utilization, for the registration and each heartbeat. Sampling reads a
+// couple of /proc files and one statfs, so it is cheap enough to run on
+// every heartbeat; figures that cannot be read are left zero.
+func collectResources(workDir string) fleet.NodeResources {
+	res := fleet.NodeResources{
+		CPUCores:  runtime.NumCPU(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+	}
+	sampleUsage(&res, workDir)
+	return res
+}
+
+// parseLoadavg returns the 1-minute load average from /proc/loadavg.
+func parseLoadavg(data string) (float64, error) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// parseMeminfo returns total and used memory in MB from /proc/meminfo.
+// Used is MemTotal less MemAvailable, so page cache counts as free.
+func parseMeminfo(data string) (totalMB, usedMB int, err error) {
+	var totalKB, availKB int
+	var haveTotal, haveAvail bool
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			totalKB, haveTotal = n, true
+		case "MemAvailable:":
+			availKB, haveAvail = n, true
+		}
+	}
+	if !haveTotal || !haveAvail {
+		return 0, 0, fmt.Errorf("meminfo has no MemTotal or MemAvailable")
+	}
+	return totalKB / 1024, (totalKB - availKB) / 1024, nil
+}
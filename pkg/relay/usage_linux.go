@@ -0,0 +1,33 @@
+//go:build linux
+
+package relay
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// sampleUsage fills in load, memory and disk figures from /proc and
+// statfs(2) on workDir.
+func sampleUsage(res *fleet.NodeResources, workDir string) {
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if load, err := parseLoadavg(string(data)); err == nil {
+			res.Load1 = load
+		}
+	}
+	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+		if total, used, err := parseMeminfo(string(data)); err == nil {
+			res.MemoryMB, res.MemoryUsedMB = total, used
+		}
+	}
+	if workDir == "" {
+		workDir = "."
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(workDir, &fs); err == nil {
+		res.DiskMB = int(fs.Blocks * uint64(fs.Bsize) >> 20)
+		res.DiskFreeMB = int(fs.Bavail * uint64(fs.Bsize) >> 20)
+	}
+}
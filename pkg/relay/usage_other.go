@@ -0,0 +1,9 @@
+//go:build !linux
+
+package relay
+
+import "github.com/freitascorp/devopsclaw/pkg/fleet"
+
+// sampleUsage is a stub for non-Linux platforms; only the static profile
+// is reported.
+func sampleUsage(res *fleet.NodeResources, workDir string) {}
@@ -0,0 +1,27 @@
+package relay
+
+import "testing"
+
+func TestParseLoadavg(t *testing.T) {
+	load, err := parseLoadavg("0.42 0.35 0.30 1/123 4567\n")
+	if err != nil || load != 0.42 {
+		t.Errorf("parseLoadavg = %v, %v; want 0.42", load, err)
+	}
+	if _, err := parseLoadavg(""); err == nil {
+		t.Error("expected an error for empty input")
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	data := "MemTotal:        8192000 kB\nMemFree:          512000 kB\nMemAvailable:    2048000 kB\n"
+	total, used, err := parseMeminfo(data)
+	if err != nil {
+		t.Fatalf("parseMeminfo: %v", err)
+	}
+	if total != 8000 || used != 6000 {
+		t.Errorf("total, used = %d, %d; want 8000, 6000", total, used)
+	}
+	if _, _, err := parseMeminfo("MemTotal: 1024 kB\n"); err == nil {
+		t.Error("expected an error without MemAvailable")
+	}
+}
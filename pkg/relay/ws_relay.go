@@ -5,11 +5,17 @@ import (
 	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +23,7 @@ import (
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 )
 
 // ------------------------------------------------------------------
@@ -34,6 +41,14 @@ type WSServer struct {
 	mu       sync.RWMutex
 	tunnels  map[fleet.NodeID]*WSTunnel
 	httpSrv  *http.Server
+	draining bool // set by Shutdown; new registrations are refused
+
+	// statusMu orders the store writes that follow a tunnel being added
+	// or removed, so they land in the same order as the map changes
+	// without holding mu across store I/O. Take it before mu.
+	statusMu sync.Mutex
+
+	events *EventLog // connect/disconnect history, for diagnosing flapping agents
 }
 
 // WSTunnel is a WebSocket connection from a node agent to the relay.
@@ -41,16 +56,42 @@ type WSTunnel struct {
 	NodeID     fleet.NodeID
 	Conn       *websocket.Conn
 	ConnectedAt time.Time
-	LastPing   time.Time
+	LastPing   time.Time // guarded by mu once the tunnel is registered
 	RemoteAddr string
 
+	// Registration is the node metadata the agent reported when it
+	// connected (hostname, capabilities, resources, labels).
+	Registration fleet.Node
+
+	// acl is the ACL matched by the agent's credential, or nil if it is
+	// unrestricted.
+	acl *AgentACL
+
 	mu        sync.Mutex
 	pending   map[string]chan *ResultEnvelope // requestID → result channel
+	chunkSinks map[string]*chunkStream         // requestID → streamed output consumer
+}
+
+// TunnelInfo describes a connected agent, as served by /relay/tunnels.
+type TunnelInfo struct {
+	NodeID       fleet.NodeID        `json:"node_id"`
+	RemoteAddr   string              `json:"remote_addr"`
+	ConnectedAt  time.Time           `json:"connected_at"`
+	LastPing     time.Time           `json:"last_ping"`
+	Hostname     string              `json:"hostname"`
+	Labels       map[string]string   `json:"labels,omitempty"`
+	Capabilities []string            `json:"capabilities,omitempty"`
+	Resources    fleet.NodeResources `json:"resources"`
+	Version      string              `json:"version,omitempty"`
+
+	// Pending lists the IDs of commands sent to the agent that have not
+	// returned a result yet, sorted.
+	Pending []string `json:"pending,omitempty"`
 }
 
 // WSMessage is the wire format for relay messages.
 type WSMessage struct {
-	Type      string          `json:"type"` // "register", "command", "result", "ping", "pong", "error"
+	Type      string          `json:"type"` // "register", "command", "cancel", "result", "result_chunk", "ping", "pong", "error"
 	RequestID string          `json:"request_id,omitempty"`
 	NodeID    string          `json:"node_id,omitempty"`
 	Payload   json.RawMessage `json:"payload,omitempty"`
@@ -58,6 +99,13 @@ type WSMessage struct {
 	Timestamp time.Time       `json:"ts"`
 }
 
+// ResultChunk is the payload of a "result_chunk" message: one line of a
+// command's output, sent by the agent while the command is still running.
+// The final "result" message still carries the complete output.
+type ResultChunk struct {
+	Line string `json:"line"`
+}
+
 // NewWSServer creates a WebSocket relay server.
 func NewWSServer(config ServerConfig, store fleet.Store, logger *slog.Logger) *WSServer {
 	if config.MaxNodes <= 0 {
@@ -66,11 +114,18 @@ func NewWSServer(config ServerConfig, store fleet.Store, logger *slog.Logger) *W
 	if config.PingInterval <= 0 {
 		config.PingInterval = 15 * time.Second
 	}
+	if config.MaxMessageBytes <= 0 {
+		config.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = 30 * time.Second
+	}
 	return &WSServer{
 		config:  config,
 		logger:  logger,
 		store:   store,
 		tunnels: make(map[fleet.NodeID]*WSTunnel),
+		events:  NewEventLog(config.EventLogSize),
 	}
 }
 
@@ -79,6 +134,11 @@ func (s *WSServer) buildMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/relay/agent", s.handleAgentConnect)
 	mux.HandleFunc("/relay/health", s.handleHealth)
+	mux.HandleFunc("/relay/events", s.handleEvents)
+	mux.HandleFunc("/relay/tunnels", s.handleTunnels)
+	if s.config.ExecAPI {
+		mux.HandleFunc("/relay/exec", s.handleExec)
+	}
 	return mux
 }
 
@@ -89,8 +149,11 @@ func (s *WSServer) Start(ctx context.Context) error {
 	s.httpSrv = &http.Server{
 		Addr:    s.config.ListenAddr,
 		Handler: mux,
+		// Requests keep ctx's values but not its cancellation: when ctx is
+		// a signal context, cancelling it must not cut the agent tunnels
+		// that Shutdown is about to drain.
 		BaseContext: func(_ net.Listener) context.Context {
-			return ctx
+			return context.WithoutCancel(ctx)
 		},
 	}
 
@@ -140,19 +203,84 @@ func (s *WSServer) Start(ctx context.Context) error {
 	return err
 }
 
-// Stop gracefully shuts down the relay server.
+// Stop gracefully shuts down the relay server. It is Shutdown, kept for
+// existing callers.
 func (s *WSServer) Stop(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
+
+// Shutdown drains the relay, then stops it. New agent registrations are
+// refused at once, while commands already dispatched get until
+// ServerConfig.DrainTimeout, or ctx's deadline if sooner, to return their
+// results. Then every tunnel is closed and the HTTP server shut down. If
+// the drain runs out of time, the remaining commands are abandoned and
+// the returned error says how many.
+func (s *WSServer) Shutdown(ctx context.Context) error {
 	s.mu.Lock()
-	for _, t := range s.tunnels {
-		t.Conn.Close(websocket.StatusGoingAway, "server shutting down")
+	s.draining = true
+	s.mu.Unlock()
+
+	drainCtx, cancel := context.WithTimeout(ctx, s.config.DrainTimeout)
+	defer cancel()
+	var drainErr error
+	if n := s.waitForPending(drainCtx); n > 0 {
+		s.logger.Warn("relay drain timed out, abandoning in-flight commands", "pending", n)
+		drainErr = fmt.Errorf("drain: %d command(s) still in flight: %w", n, drainCtx.Err())
 	}
+
+	s.mu.Lock()
+	tunnels := s.tunnels
 	s.tunnels = make(map[fleet.NodeID]*WSTunnel)
 	s.mu.Unlock()
 
+	// Each close waits for the agent's close frame, so close them together
+	// and outside the lock.
+	var wg sync.WaitGroup
+	for _, t := range tunnels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.Conn.Close(websocket.StatusGoingAway, "server shutting down")
+		}()
+	}
+	wg.Wait()
+
 	if s.httpSrv != nil {
-		return s.httpSrv.Shutdown(ctx)
+		return errors.Join(drainErr, s.httpSrv.Shutdown(ctx))
+	}
+	return drainErr
+}
+
+// waitForPending polls until no tunnel has a command awaiting its result
+// or ctx is done, and returns how many are still pending.
+func (s *WSServer) waitForPending(ctx context.Context) int {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := s.pendingCommands()
+		if n == 0 {
+			return 0
+		}
+		s.logger.Debug("draining relay", "pending", n)
+		select {
+		case <-ctx.Done():
+			return s.pendingCommands()
+		case <-ticker.C:
+		}
 	}
-	return nil
+}
+
+// pendingCommands counts dispatched commands still awaiting a result.
+func (s *WSServer) pendingCommands() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, t := range s.tunnels {
+		t.mu.Lock()
+		n += len(t.pending)
+		t.mu.Unlock()
+	}
+	return n
 }
 
 // handleAgentConnect handles WebSocket upgrade for node agents.
@@ -161,6 +289,7 @@ func (s *WSServer) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 	// Prefer mTLS: if the connection has a verified client certificate, extract
 	// the node identity from the cert's CN. This eliminates shared secrets.
 	var mtlsIdentity *ClientIdentity
+	var acl *AgentACL
 	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
 		id, err := VerifyClientCert(r.TLS)
 		if err != nil {
@@ -169,12 +298,14 @@ func (s *WSServer) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		mtlsIdentity = id
+		acl = s.certACL(id.NodeID)
 		s.logger.Info("mTLS authenticated", "node_id", id.NodeID, "fingerprint", id.Fingerprint)
-	} else if s.config.AuthToken != "" {
-		// Fallback: bearer token auth (for migration or non-mTLS setups)
-		token := r.Header.Get("Authorization")
-		expected := "Bearer " + s.config.AuthToken
-		if len(token) != len(expected) || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+	} else if s.config.AuthToken != "" || s.hasTokenACLs() {
+		// Fallback: bearer token auth (for migration or non-mTLS setups).
+		// An ACL token is checked first so that an ACL can also restrict
+		// the shared token.
+		acl = s.tokenACL(r)
+		if acl == nil && (s.config.AuthToken == "" || !validBearer(r, s.config.AuthToken)) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -186,11 +317,13 @@ func (s *WSServer) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: false,
+		CompressionMode:    compressionMode(s.config.Compression),
 	})
 	if err != nil {
 		s.logger.Error("websocket accept failed", "error", err)
 		return
 	}
+	conn.SetReadLimit(s.config.MaxMessageBytes)
 
 	// Read registration message
 	ctx := r.Context()
@@ -227,35 +360,96 @@ func (s *WSServer) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check capacity
+	if !acl.allowsNode(nodeID) {
+		s.logger.Warn("node_id outside its credential's allowed prefixes",
+			"node_id", nodeID,
+			"allowed_prefixes", acl.NodePrefixes,
+			"remote_addr", r.RemoteAddr,
+		)
+		conn.Close(websocket.StatusPolicyViolation, "node_id not allowed for this credential")
+		return
+	}
+
+	var regNode fleet.Node
+	if regMsg.Payload != nil {
+		json.Unmarshal(regMsg.Payload, &regNode)
+	}
+	regNode.ID = nodeID
+	if regNode.Hostname == "" {
+		regNode.Hostname = string(nodeID)
+	}
+	if regNode.Address == "" {
+		regNode.Address = r.RemoteAddr // capture the agent's IP from the connection
+	}
+	regNode.Status = fleet.NodeStatusOnline
+	regNode.LastSeen = time.Now()
+	regNode.RegisteredAt = time.Now()
+	regNode.TunnelID = string(nodeID)
+
+	// Check capacity; a reconnecting node reuses its existing slot.
+	s.statusMu.Lock()
 	s.mu.Lock()
-	if len(s.tunnels) >= s.config.MaxNodes {
+	if s.draining {
 		s.mu.Unlock()
-		conn.Close(websocket.StatusTryAgainLater, "max nodes reached")
+		s.statusMu.Unlock()
+		conn.Close(websocket.StatusTryAgainLater, "relay shutting down")
 		return
 	}
-
-	// Close existing tunnel if reconnecting
-	if existing, ok := s.tunnels[nodeID]; ok {
-		existing.Conn.Close(websocket.StatusGoingAway, "reconnecting")
-		s.logger.Info("replacing stale tunnel", "node_id", nodeID)
+	existing, reconnecting := s.tunnels[nodeID]
+	if !reconnecting && len(s.tunnels) >= s.config.MaxNodes {
+		s.mu.Unlock()
+		s.statusMu.Unlock()
+		conn.Close(websocket.StatusTryAgainLater, "max nodes reached")
+		return
 	}
 
 	tunnel := &WSTunnel{
-		NodeID:      nodeID,
-		Conn:        conn,
-		ConnectedAt: time.Now(),
-		LastPing:    time.Now(),
-		RemoteAddr:  r.RemoteAddr,
-		pending:     make(map[string]chan *ResultEnvelope),
+		NodeID:       nodeID,
+		Conn:         conn,
+		ConnectedAt:  time.Now(),
+		LastPing:     time.Now(),
+		RemoteAddr:   r.RemoteAddr,
+		Registration: regNode,
+		acl:          acl,
+		pending:      make(map[string]chan *ResultEnvelope),
+		chunkSinks:   make(map[string]*chunkStream),
 	}
+
 	s.tunnels[nodeID] = tunnel
 	s.mu.Unlock()
 
-	s.logger.Info("agent connected",
-		"node_id", nodeID,
-		"remote_addr", r.RemoteAddr,
-	)
+	// Mark the node online while still holding s.statusMu. The replaced
+	// tunnel's cleanup takes the same lock before touching the store, so it
+	// can never overwrite this update with a stale offline status.
+	if s.store != nil {
+		if err := s.store.RegisterNode(ctx, &regNode); err != nil {
+			s.logger.Warn("failed to register node in store", "node_id", nodeID, "error", err)
+		}
+	}
+	s.statusMu.Unlock()
+
+	connectEvent := ConnEvent{NodeID: nodeID, Type: ConnEventConnect, RemoteAddr: r.RemoteAddr}
+	if reconnecting {
+		connectEvent.Reason = "reconnect, replaced tunnel from " + existing.RemoteAddr
+	}
+	s.events.Record(connectEvent)
+
+	if reconnecting {
+		// Close the stale tunnel outside the lock: the close handshake waits
+		// on a peer that is most likely gone.
+		go existing.Conn.Close(websocket.StatusGoingAway, "reconnecting")
+		s.logger.Info("agent reconnected, replaced stale tunnel",
+			"node_id", nodeID,
+			"remote_addr", r.RemoteAddr,
+			"previous_remote_addr", existing.RemoteAddr,
+			"previous_connected_at", existing.ConnectedAt,
+		)
+	} else {
+		s.logger.Info("agent connected",
+			"node_id", nodeID,
+			"remote_addr", r.RemoteAddr,
+		)
+	}
 
 	// Send ack
 	wsjson.Write(ctx, conn, WSMessage{
@@ -264,55 +458,81 @@ func (s *WSServer) handleAgentConnect(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	})
 
-	// Register node in store if applicable
-	if s.store != nil {
-		var regNode fleet.Node
-		if regMsg.Payload != nil {
-			json.Unmarshal(regMsg.Payload, &regNode)
-		}
-		regNode.ID = nodeID
-		if regNode.Hostname == "" {
-			regNode.Hostname = string(nodeID)
-		}
-		if regNode.Address == "" {
-			regNode.Address = r.RemoteAddr // capture the agent's IP from the connection
-		}
-		regNode.Status = fleet.NodeStatusOnline
-		regNode.LastSeen = time.Now()
-		regNode.RegisteredAt = time.Now()
-		regNode.TunnelID = string(nodeID)
-		s.store.RegisterNode(ctx, &regNode)
-	}
-
 	// Enter message processing loop
-	s.processAgentMessages(ctx, tunnel)
+	readErr := s.processAgentMessages(ctx, tunnel)
 
-	// Cleanup on disconnect
+	// Cleanup on disconnect. Only the current tunnel may mark the node
+	// offline; a tunnel replaced by a reconnect leaves the store alone.
+	s.statusMu.Lock()
 	s.mu.Lock()
-	if current, ok := s.tunnels[nodeID]; ok && current == tunnel {
+	current, ok := s.tunnels[nodeID]
+	replaced := !ok || current != tunnel
+	if !replaced {
 		delete(s.tunnels, nodeID)
 	}
 	s.mu.Unlock()
-
-	if s.store != nil {
+	if !replaced && s.store != nil {
 		s.store.UpdateNodeStatus(context.Background(), nodeID, fleet.NodeStatusOffline)
 	}
+	s.statusMu.Unlock()
+
+	reason := disconnectReason(readErr)
+	if replaced {
+		reason = "replaced by a newer connection"
+	}
+	s.events.Record(ConnEvent{NodeID: nodeID, Type: ConnEventDisconnect, RemoteAddr: r.RemoteAddr, Reason: reason})
+
+	if replaced {
+		s.logger.Debug("stale tunnel closed", "node_id", nodeID)
+		return
+	}
+	s.logger.Info("agent disconnected", "node_id", nodeID, "reason", reason)
+}
 
-	s.logger.Info("agent disconnected", "node_id", nodeID)
+// compressionMode maps the Compression config flag onto the WebSocket
+// permessage-deflate mode.
+func compressionMode(enabled bool) websocket.CompressionMode {
+	if enabled {
+		return websocket.CompressionContextTakeover
+	}
+	return websocket.CompressionDisabled
 }
 
-// processAgentMessages reads results from the node agent.
-func (s *WSServer) processAgentMessages(ctx context.Context, tunnel *WSTunnel) {
+// disconnectReason describes why an agent's read loop ended.
+func disconnectReason(err error) string {
+	var closeErr websocket.CloseError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &closeErr):
+		if closeErr.Reason != "" {
+			return fmt.Sprintf("closed by agent: %s (%d)", closeErr.Reason, closeErr.Code)
+		}
+		return fmt.Sprintf("closed by agent (%d)", closeErr.Code)
+	default:
+		return err.Error()
+	}
+}
+
+// processAgentMessages reads results from the node agent until the
+// connection ends, returning the read error that ended it.
+func (s *WSServer) processAgentMessages(ctx context.Context, tunnel *WSTunnel) error {
 	for {
 		var msg WSMessage
 		err := wsjson.Read(ctx, tunnel.Conn, &msg)
 		if err != nil {
-			if websocket.CloseStatus(err) != -1 {
+			if errors.Is(err, websocket.ErrMessageTooBig) {
+				// The read already sent a 1009 close frame; make sure the
+				// tunnel is torn down even if the agent never answers it.
+				s.logger.Warn("agent message exceeds size limit, closing tunnel",
+					"node_id", tunnel.NodeID, "max_message_bytes", s.config.MaxMessageBytes)
+				tunnel.Conn.CloseNow()
+			} else if websocket.CloseStatus(err) != -1 {
 				s.logger.Debug("agent connection closed", "node_id", tunnel.NodeID)
 			} else {
 				s.logger.Error("error reading from agent", "node_id", tunnel.NodeID, "error", err)
 			}
-			return
+			return err
 		}
 
 		switch msg.Type {
@@ -326,12 +546,28 @@ func (s *WSServer) processAgentMessages(ctx context.Context, tunnel *WSTunnel) {
 				ch <- &ResultEnvelope{RequestID: msg.RequestID, Result: result}
 				delete(tunnel.pending, msg.RequestID)
 			}
+			delete(tunnel.chunkSinks, msg.RequestID)
 			tunnel.mu.Unlock()
 
+		case "result_chunk":
+			var chunk ResultChunk
+			if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+				continue
+			}
+			tunnel.mu.Lock()
+			sink := tunnel.chunkSinks[msg.RequestID]
+			tunnel.mu.Unlock()
+			if sink != nil {
+				sink.push(chunk.Line)
+			}
+
 		case "pong":
+			tunnel.mu.Lock()
 			tunnel.LastPing = time.Now()
+			tunnel.mu.Unlock()
+			resources := tunnel.updateResources(msg.Payload)
 			if s.store != nil {
-				s.store.UpdateNodeHeartbeat(ctx, tunnel.NodeID, fleet.NodeResources{})
+				s.store.UpdateNodeHeartbeat(ctx, tunnel.NodeID, resources)
 			}
 
 		default:
@@ -341,18 +577,53 @@ func (s *WSServer) processAgentMessages(ctx context.Context, tunnel *WSTunnel) {
 }
 
 // SendCommandWS sends a command to a node through its WebSocket tunnel.
+// When ServerConfig.AuditCommands is set, the dispatch and its outcome are
+// recorded in the fleet store.
 func (s *WSServer) SendCommandWS(ctx context.Context, nodeID fleet.NodeID, env *CommandEnvelope) (*ResultEnvelope, error) {
+	return s.SendCommandStreamWS(ctx, nodeID, env, nil)
+}
+
+// SendCommandStreamWS is SendCommandWS that also passes each "result_chunk"
+// line the agent sends to onLine as the command runs. Agents that do not
+// stream only produce the final result.
+func (s *WSServer) SendCommandStreamWS(ctx context.Context, nodeID fleet.NodeID, env *CommandEnvelope, onLine func(line string)) (*ResultEnvelope, error) {
+	start := time.Now()
+	result, err := s.sendCommandWS(ctx, nodeID, env, onLine)
+	if s.config.AuditCommands && s.store != nil {
+		s.recordCommand(nodeID, env, result, err, start)
+	}
+	return result, err
+}
+
+func (s *WSServer) sendCommandWS(ctx context.Context, nodeID fleet.NodeID, env *CommandEnvelope, onLine func(string)) (*ResultEnvelope, error) {
 	s.mu.RLock()
 	tunnel, ok := s.tunnels[nodeID]
 	s.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("no active tunnel for node %s", nodeID)
+		return nil, fmt.Errorf("%w for node %s", fleet.ErrNoTunnel, nodeID)
+	}
+	if !tunnel.acl.allowsCommand(env.Command.Type) {
+		s.logger.Warn("command type not allowed for node", "node_id", nodeID, "type", env.Command.Type, "request_id", env.RequestID)
+		return &ResultEnvelope{
+			RequestID: env.RequestID,
+			Result: fleet.NodeResult{
+				NodeID:   nodeID,
+				Status:   "denied",
+				ExitCode: -1,
+				Error:    fmt.Sprintf("command type %q not allowed for node %s by relay ACL", env.Command.Type, nodeID),
+			},
+		}, nil
 	}
 
 	// Create result channel
 	resultCh := make(chan *ResultEnvelope, 1)
+	var sink *chunkStream
 	tunnel.mu.Lock()
 	tunnel.pending[env.RequestID] = resultCh
+	if onLine != nil {
+		sink = newChunkStream(onLine)
+		tunnel.chunkSinks[env.RequestID] = sink
+	}
 	tunnel.mu.Unlock()
 
 	// Send command
@@ -368,22 +639,131 @@ func (s *WSServer) SendCommandWS(ctx context.Context, nodeID fleet.NodeID, env *
 	if err := wsjson.Write(ctx, tunnel.Conn, msg); err != nil {
 		tunnel.mu.Lock()
 		delete(tunnel.pending, env.RequestID)
+		delete(tunnel.chunkSinks, env.RequestID)
 		tunnel.mu.Unlock()
-		return nil, fmt.Errorf("send command to %s: %w", nodeID, err)
+		sink.close(true)
+		return nil, &commandWriteError{err: fmt.Errorf("send command to %s: %w", nodeID, err)}
 	}
 
 	// Wait for result
 	select {
 	case result := <-resultCh:
+		// Chunks precede the result on the wire, so every line is queued
+		// by now; hand them all to onLine before returning.
+		sink.close(false)
 		return result, nil
 	case <-ctx.Done():
 		tunnel.mu.Lock()
 		delete(tunnel.pending, env.RequestID)
+		delete(tunnel.chunkSinks, env.RequestID)
 		tunnel.mu.Unlock()
+		sink.close(true)
+		s.sendCancel(tunnel, env.RequestID)
 		return nil, ctx.Err()
 	}
 }
 
+// chunkStream delivers a command's streamed output lines to its consumer
+// on a goroutine of its own, so a slow consumer never stalls the tunnel's
+// read loop (and with it pongs and other commands' results).
+type chunkStream struct {
+	onLine func(line string)
+
+	mu      sync.Mutex
+	lines   []string
+	closed  bool
+	discard bool
+	wake    chan struct{} // signalled when lines or closed change
+	done    chan struct{} // closed once the delivery goroutine exits
+}
+
+func newChunkStream(onLine func(line string)) *chunkStream {
+	c := &chunkStream{
+		onLine: onLine,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// push queues line for delivery. It never blocks.
+func (c *chunkStream) push(line string) {
+	c.mu.Lock()
+	if !c.closed {
+		c.lines = append(c.lines, line)
+	}
+	c.mu.Unlock()
+	c.signal()
+}
+
+// close stops the stream and waits for the delivery goroutine to exit,
+// after delivering the queued lines, or dropping them if discard is set.
+// Calling it on a nil stream is a no-op.
+func (c *chunkStream) close(discard bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.closed = true
+	c.discard = c.discard || discard
+	c.mu.Unlock()
+	c.signal()
+	<-c.done
+}
+
+func (c *chunkStream) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *chunkStream) run() {
+	defer close(c.done)
+	for range c.wake {
+		for {
+			c.mu.Lock()
+			if c.discard {
+				c.lines = nil
+			}
+			lines, closed := c.lines, c.closed
+			c.lines = nil
+			c.mu.Unlock()
+			if len(lines) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			for _, line := range lines {
+				c.onLine(line)
+			}
+		}
+	}
+}
+
+// cancelWriteTimeout bounds writing a "cancel" message to an agent.
+const cancelWriteTimeout = 5 * time.Second
+
+// sendCancel tells the agent behind tunnel to kill the command for
+// requestID, whose result is no longer awaited. It uses its own context,
+// since the caller's is already done and a write under a done context
+// closes the connection.
+func (s *WSServer) sendCancel(tunnel *WSTunnel, requestID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelWriteTimeout)
+	defer cancel()
+	msg := WSMessage{
+		Type:      "cancel",
+		RequestID: requestID,
+		NodeID:    string(tunnel.NodeID),
+		Timestamp: time.Now(),
+	}
+	if err := wsjson.Write(ctx, tunnel.Conn, msg); err != nil {
+		s.logger.Warn("failed to send cancel to node", "node", tunnel.NodeID, "request_id", requestID, "error", err)
+	}
+}
+
 // ConnectedNodeIDs returns the list of currently connected node IDs.
 func (s *WSServer) ConnectedNodeIDs() []fleet.NodeID {
 	s.mu.RLock()
@@ -395,6 +775,87 @@ func (s *WSServer) ConnectedNodeIDs() []fleet.NodeID {
 	return ids
 }
 
+// Tunnels describes the connected agents, ordered by node ID.
+func (s *WSServer) Tunnels() []TunnelInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos := make([]TunnelInfo, 0, len(s.tunnels))
+	for _, t := range s.tunnels {
+		infos = append(infos, t.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].NodeID < infos[j].NodeID })
+	return infos
+}
+
+// Tunnel describes the agent connected as nodeID, if any.
+func (s *WSServer) Tunnel(nodeID fleet.NodeID) (TunnelInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tunnels[nodeID]
+	if !ok {
+		return TunnelInfo{}, false
+	}
+	return t.info(), true
+}
+
+// updateResources records the resources carried by a heartbeat and
+// returns the node's latest resources. A heartbeat without them (an
+// answer to a relay ping, or an older agent) keeps the last report.
+func (t *WSTunnel) updateResources(payload json.RawMessage) fleet.NodeResources {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(payload) > 0 {
+		var res fleet.NodeResources
+		if err := json.Unmarshal(payload, &res); err == nil {
+			t.Registration.Resources = res
+		}
+	}
+	return t.Registration.Resources
+}
+
+// info snapshots the tunnel's metadata. The labels and capabilities are
+// copied so callers never share state with the live tunnel, and the
+// connection itself is left out.
+func (t *WSTunnel) info() TunnelInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reg := t.Registration
+	pending := slices.Sorted(maps.Keys(t.pending))
+	return TunnelInfo{
+		NodeID:       t.NodeID,
+		RemoteAddr:   t.RemoteAddr,
+		ConnectedAt:  t.ConnectedAt,
+		LastPing:     t.LastPing,
+		Hostname:     reg.Hostname,
+		Labels:       maps.Clone(reg.Labels),
+		Capabilities: slices.Clone(reg.Capabilities),
+		Resources:    reg.Resources,
+		Version:      reg.Version,
+		Pending:      pending,
+	}
+}
+
+// handleTunnels serves the connected agents. With ?node=<id> it returns
+// that node's TunnelInfo, or 404 when the node has no tunnel.
+func (s *WSServer) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	if status := s.authorizeRead(r); status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if node := r.URL.Query().Get("node"); node != "" {
+		info, ok := s.Tunnel(fleet.NodeID(node))
+		if !ok {
+			http.Error(w, fmt.Sprintf("node %s has no active tunnel", node), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+		return
+	}
+	json.NewEncoder(w).Encode(s.Tunnels())
+}
+
 // handleHealth responds to health check requests.
 func (s *WSServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
@@ -410,6 +871,86 @@ func (s *WSServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Events returns recorded connect/disconnect events matching q, oldest first.
+func (s *WSServer) Events(q EventQuery) []ConnEvent {
+	return s.events.Query(q)
+}
+
+// handleEvents serves the connection event log. Query parameters: node,
+// type ("connect" or "disconnect"), since (RFC 3339 time or a duration
+// such as "1h"), and limit. Requires the auth token when one is set.
+func (s *WSServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if status := s.authorizeRead(r); status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	q, err := parseEventQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.events.Query(q))
+}
+
+// parseEventQuery builds an EventQuery from /relay/events parameters.
+func parseEventQuery(v url.Values, now time.Time) (EventQuery, error) {
+	q := EventQuery{
+		NodeID: fleet.NodeID(v.Get("node")),
+		Type:   ConnEventType(v.Get("type")),
+	}
+	switch q.Type {
+	case "", ConnEventConnect, ConnEventDisconnect:
+	default:
+		return q, fmt.Errorf("invalid type %q: want connect or disconnect", q.Type)
+	}
+	if since := v.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.Since = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else {
+			return q, fmt.Errorf("invalid since %q: want a duration like 1h or an RFC 3339 time", since)
+		}
+	}
+	if limit := v.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", limit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// authorizeRead authenticates a caller of the relay's read-only endpoints.
+// It accepts the agent AuthToken as a bearer token, or any credential
+// authorizeExec accepts, so an mTLS-only relay needs a client certificate
+// listed in ExecClients. A relay with no token and no mTLS configured
+// serves everyone. It returns http.StatusOK or the status to reject with.
+func (s *WSServer) authorizeRead(r *http.Request) int {
+	if s.config.AuthToken != "" && validBearer(r, s.config.AuthToken) {
+		return http.StatusOK
+	}
+	_, status := s.authorizeExec(r)
+	open := s.config.AuthToken == "" && s.config.ExecToken == "" &&
+		(s.config.MTLS == nil || s.config.MTLS.CACertFile == "")
+	if status == http.StatusUnauthorized && open {
+		return http.StatusOK
+	}
+	return status
+}
+
+// validBearer reports whether r carries "Authorization: Bearer <token>",
+// compared in constant time.
+func validBearer(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	expected := "Bearer " + token
+	return len(got) == len(expected) && subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
 // pingLoop sends periodic pings to all connected agents.
 func (s *WSServer) pingLoop(ctx context.Context) {
 	ticker := time.NewTicker(s.config.PingInterval)
@@ -440,28 +981,106 @@ func (s *WSServer) pingLoop(ctx context.Context) {
 type WSRelayClient struct {
 	server *WSServer
 	logger *slog.Logger
+	retry  resilience.RetryConfig
+}
+
+// WSRelayClientOption configures a WSRelayClient.
+type WSRelayClientOption func(*WSRelayClient)
+
+// WithDeliveryRetry sets the backoff for re-sending a command whose node
+// had no tunnel or whose write to the tunnel failed, as happens while an
+// agent reconnects. cfg.RetryableErr is ignored: only delivery errors are
+// retried, never a result the node sent back. MaxAttempts 1 disables
+// retries.
+func WithDeliveryRetry(cfg resilience.RetryConfig) WSRelayClientOption {
+	return func(c *WSRelayClient) { c.retry = cfg }
+}
+
+// DefaultDeliveryRetry is the WSRelayClient delivery backoff: 3 attempts
+// spread over about two seconds, long enough for an agent to reconnect.
+func DefaultDeliveryRetry() resilience.RetryConfig {
+	return resilience.RetryConfig{
+		MaxAttempts:  3,
+		InitialDelay: 700 * time.Millisecond,
+		MaxDelay:     2 * time.Second,
+		Multiplier:   2.0,
+		JitterFrac:   0.1,
+	}
 }
 
 // NewWSRelayClient creates a relay client backed by the WS server.
-func NewWSRelayClient(server *WSServer, logger *slog.Logger) *WSRelayClient {
-	return &WSRelayClient{server: server, logger: logger}
+func NewWSRelayClient(server *WSServer, logger *slog.Logger, opts ...WSRelayClientOption) *WSRelayClient {
+	c := &WSRelayClient{server: server, logger: logger, retry: DefaultDeliveryRetry()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Execute sends a command to a node through the relay tunnel.
 func (c *WSRelayClient) Execute(ctx context.Context, node *fleet.Node, cmd fleet.TypedCommand) (*fleet.NodeResult, error) {
+	return c.ExecuteStream(ctx, node, cmd, nil)
+}
+
+// ExecuteStream sends a command like Execute, passing each output line the
+// agent streams back to onLine before the final result arrives.
+func (c *WSRelayClient) ExecuteStream(ctx context.Context, node *fleet.Node, cmd fleet.TypedCommand, onLine func(line string)) (*fleet.NodeResult, error) {
 	env := &CommandEnvelope{
 		RequestID: fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
 		Command:   cmd,
 		Deadline:  time.Now().Add(30 * time.Second),
 	}
 
-	result, err := c.server.SendCommandWS(ctx, node.ID, env)
+	var result *ResultEnvelope
+	err := c.deliver(ctx, node.ID, func() (err error) {
+		result, err = c.server.SendCommandStreamWS(ctx, node.ID, env, onLine)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &result.Result, nil
 }
 
+// deliver runs send under the delivery retry policy. The last delivery
+// error is returned unwrapped, so callers still see fleet.ErrNoTunnel.
+func (c *WSRelayClient) deliver(ctx context.Context, nodeID fleet.NodeID, send func() error) error {
+	cfg := c.retry
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultDeliveryRetry().MaxAttempts
+	}
+	cfg.RetryableErr = func(err error) bool {
+		return ctx.Err() == nil && isDeliveryError(err)
+	}
+
+	var lastErr error
+	err := resilience.Retry(ctx, cfg, func(attempt int) error {
+		lastErr = send()
+		if lastErr != nil && cfg.RetryableErr(lastErr) && attempt < cfg.MaxAttempts-1 {
+			c.logger.Warn("command delivery failed, retrying", "node_id", nodeID, "attempt", attempt+1, "error", lastErr)
+		}
+		return lastErr
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// commandWriteError marks a failure to write a command to a tunnel, as
+// opposed to a failure the node reported.
+type commandWriteError struct{ err error }
+
+func (e *commandWriteError) Error() string { return e.err.Error() }
+func (e *commandWriteError) Unwrap() error { return e.err }
+
+// isDeliveryError reports whether err means the command never reached the
+// node, so sending it again is safe.
+func isDeliveryError(err error) bool {
+	var writeErr *commandWriteError
+	return errors.Is(err, fleet.ErrNoTunnel) || errors.As(err, &writeErr)
+}
+
 // Ping checks if a node is connected to the relay.
 func (c *WSRelayClient) Ping(ctx context.Context, node *fleet.Node) error {
 	s := c.server
@@ -469,7 +1088,7 @@ func (c *WSRelayClient) Ping(ctx context.Context, node *fleet.Node) error {
 	_, ok := s.tunnels[node.ID]
 	s.mu.RUnlock()
 	if !ok {
-		return fmt.Errorf("no active tunnel for node %s", node.ID)
+		return fmt.Errorf("%w for node %s", fleet.ErrNoTunnel, node.ID)
 	}
 	return nil
 }
@@ -487,6 +1106,15 @@ type WSAgent struct {
 	mu        sync.RWMutex
 	connected bool
 	stopCh    chan struct{}
+
+	runMu   sync.Mutex
+	running map[string]context.CancelFunc // requestID → cancels the running command
+
+	tlsMu     sync.Mutex
+	clientTLS *tls.Config         // mTLS client config, built on first connect
+	certs     *ClientCertReloader // serves clientTLS's client certificate
+
+	backoff *reconnectBackoff // used only by Run's goroutine
 }
 
 // NewWSAgent creates a WebSocket-based node agent.
@@ -497,15 +1125,37 @@ func NewWSAgent(config AgentConfig, executor LocalExecutor, logger *slog.Logger)
 	if config.HeartbeatInterval <= 0 {
 		config.HeartbeatInterval = 30 * time.Second
 	}
+	if config.MaxMessageBytes <= 0 {
+		config.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if config.MaxReconnectInterval <= 0 {
+		config.MaxReconnectInterval = 60 * time.Second
+	}
+	if config.MaxReconnectInterval < config.ReconnectInterval {
+		config.MaxReconnectInterval = config.ReconnectInterval
+	}
+	switch {
+	case config.ReconnectJitter == 0:
+		config.ReconnectJitter = DefaultReconnectJitter
+	case config.ReconnectJitter < 0:
+		config.ReconnectJitter = 0
+	case config.ReconnectJitter > 1:
+		config.ReconnectJitter = 1
+	}
 	return &WSAgent{
 		config:   config,
 		logger:   logger,
 		executor: executor,
 		stopCh:   make(chan struct{}),
+		running:  make(map[string]context.CancelFunc),
+		backoff:  newReconnectBackoff(config.ReconnectInterval, config.MaxReconnectInterval, config.ReconnectJitter),
 	}
 }
 
-// Run connects to the relay and processes commands with automatic reconnection.
+// Run connects to the relay and processes commands with automatic
+// reconnection. The first attempt is immediate; after that the delay
+// backs off exponentially with jitter up to MaxReconnectInterval, and
+// starts over once the agent registers successfully.
 func (a *WSAgent) Run(ctx context.Context) error {
 	for {
 		select {
@@ -517,10 +1167,11 @@ func (a *WSAgent) Run(ctx context.Context) error {
 		}
 
 		err := a.connectAndServeWS(ctx)
+		delay := a.backoff.next()
 		if err != nil {
 			a.logger.Error("relay connection lost, reconnecting",
 				"error", err,
-				"retry_in", a.config.ReconnectInterval,
+				"retry_in", delay,
 			)
 		}
 
@@ -529,7 +1180,7 @@ func (a *WSAgent) Run(ctx context.Context) error {
 			return ctx.Err()
 		case <-a.stopCh:
 			return nil
-		case <-time.After(a.config.ReconnectInterval):
+		case <-time.After(delay):
 		}
 	}
 }
@@ -559,11 +1210,11 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 	}
 
 	// Connect
-	dialOpts := &websocket.DialOptions{}
+	dialOpts := &websocket.DialOptions{CompressionMode: compressionMode(a.config.Compression)}
 
 	// Prefer mTLS client config if available
 	if a.config.MTLS != nil && a.config.MTLS.ClientCertFile != "" {
-		tlsCfg, tlsErr := ClientTLSConfig(*a.config.MTLS)
+		tlsCfg, tlsErr := a.mtlsConfig()
 		if tlsErr != nil {
 			return fmt.Errorf("mTLS client setup: %w", tlsErr)
 		}
@@ -589,6 +1240,7 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 		return fmt.Errorf("dial relay: %w", err)
 	}
 	defer conn.Close(websocket.StatusNormalClosure, "agent stopping")
+	conn.SetReadLimit(a.config.MaxMessageBytes)
 
 	// Send registration — include hostname and local address for fleet visibility
 	hostname, _ := os.Hostname()
@@ -597,7 +1249,8 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 	}
 	regPayload, _ := json.Marshal(map[string]any{
 		"hostname":     hostname,
-		"capabilities": []string{"shell", "file"},
+		"capabilities": []string{"shell", "script", "file"},
+		"resources":    collectResources(a.config.WorkDir),
 	})
 	regMsg := WSMessage{
 		Type:      "register",
@@ -621,6 +1274,7 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 	a.mu.Lock()
 	a.connected = true
 	a.mu.Unlock()
+	a.backoff.reset()
 	defer func() {
 		a.mu.Lock()
 		a.connected = false
@@ -648,7 +1302,7 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 		case err := <-errCh:
 			return err
 		case <-heartbeat.C:
-			pong := WSMessage{Type: "pong", NodeID: string(a.config.NodeID), Timestamp: time.Now()}
+			pong := a.heartbeatMessage()
 			if err := wsjson.Write(ctx, conn, pong); err != nil {
 				return fmt.Errorf("send heartbeat: %w", err)
 			}
@@ -656,6 +1310,53 @@ func (a *WSAgent) connectAndServeWS(ctx context.Context) error {
 	}
 }
 
+// heartbeatMessage builds the agent's periodic "pong", carrying the node's
+// current resources so the relay can show its utilization.
+func (a *WSAgent) heartbeatMessage() WSMessage {
+	payload, _ := json.Marshal(collectResources(a.config.WorkDir))
+	return WSMessage{
+		Type:      "pong",
+		NodeID:    string(a.config.NodeID),
+		Payload:   payload,
+		Timestamp: time.Now(),
+	}
+}
+
+// mtlsConfig returns the agent's mTLS client config, building it on the
+// first connect. Later calls reload the client cert first unless
+// DisableCertReload is set; a failed reload keeps the previous cert.
+func (a *WSAgent) mtlsConfig() (*tls.Config, error) {
+	a.tlsMu.Lock()
+	defer a.tlsMu.Unlock()
+	if a.clientTLS == nil {
+		tlsCfg, certs, err := clientTLSConfig(*a.config.MTLS)
+		if err != nil {
+			return nil, err
+		}
+		a.clientTLS, a.certs = tlsCfg, certs
+		return tlsCfg, nil
+	}
+	if !a.config.DisableCertReload {
+		if err := a.certs.Reload(); err != nil {
+			a.logger.Warn("mTLS client cert reload failed, keeping the previous cert", "error", err)
+		}
+	}
+	return a.clientTLS, nil
+}
+
+// ReloadClientCert re-reads the mTLS client cert/key from disk, e.g. on
+// SIGHUP. The new cert is presented on the next connection; the current
+// connection keeps its established TLS session. It is a no-op before the
+// first connect, which loads the files anyway.
+func (a *WSAgent) ReloadClientCert() error {
+	a.tlsMu.Lock()
+	defer a.tlsMu.Unlock()
+	if a.certs == nil {
+		return nil
+	}
+	return a.certs.Reload()
+}
+
 func (a *WSAgent) processRelayMessages(ctx context.Context, conn *websocket.Conn) error {
 	for {
 		var msg WSMessage
@@ -666,7 +1367,10 @@ func (a *WSAgent) processRelayMessages(ctx context.Context, conn *websocket.Conn
 
 		switch msg.Type {
 		case "command":
-			go a.handleCommand(ctx, conn, msg)
+			cmdCtx := a.startCommand(ctx, msg.RequestID)
+			go a.handleCommand(ctx, cmdCtx, conn, msg)
+		case "cancel":
+			a.cancelCommand(msg.RequestID)
 		case "ping":
 			pong := WSMessage{Type: "pong", NodeID: string(a.config.NodeID), Timestamp: time.Now()}
 			wsjson.Write(ctx, conn, pong)
@@ -676,7 +1380,50 @@ func (a *WSAgent) processRelayMessages(ctx context.Context, conn *websocket.Conn
 	}
 }
 
-func (a *WSAgent) handleCommand(ctx context.Context, conn *websocket.Conn, msg WSMessage) {
+// startCommand registers requestID as running and returns the context to
+// run it under, which a "cancel" for the request cancels. The command is
+// registered before handleCommand starts so that a cancel sent right
+// after the command is not missed.
+func (a *WSAgent) startCommand(ctx context.Context, requestID string) context.Context {
+	cmdCtx, cancel := context.WithCancel(ctx)
+	a.runMu.Lock()
+	a.running[requestID] = cancel
+	a.runMu.Unlock()
+	return cmdCtx
+}
+
+// finishCommand releases requestID's context once its result is sent.
+func (a *WSAgent) finishCommand(requestID string) {
+	a.runMu.Lock()
+	cancel, ok := a.running[requestID]
+	delete(a.running, requestID)
+	a.runMu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// cancelCommand kills the command running for requestID, if any. Its
+// process is killed through exec.CommandContext and its result is
+// reported as "cancelled".
+func (a *WSAgent) cancelCommand(requestID string) {
+	a.runMu.Lock()
+	cancel, ok := a.running[requestID]
+	a.runMu.Unlock()
+	if !ok {
+		a.logger.Debug("cancel for a command that is not running", "request_id", requestID)
+		return
+	}
+	a.logger.Info("cancelling command at the relay's request", "request_id", requestID)
+	cancel()
+}
+
+// handleCommand runs the command in msg under cmdCtx, from startCommand,
+// and writes its output and result to conn under ctx, the connection's
+// context: a write under a cancelled context would close the connection.
+func (a *WSAgent) handleCommand(ctx, cmdCtx context.Context, conn *websocket.Conn, msg WSMessage) {
+	defer a.finishCommand(msg.RequestID)
+
 	var cmd fleet.TypedCommand
 	if err := json.Unmarshal(msg.Payload, &cmd); err != nil {
 		errMsg := WSMessage{
@@ -690,7 +1437,26 @@ func (a *WSAgent) handleCommand(ctx context.Context, conn *websocket.Conn, msg W
 		return
 	}
 
-	result, err := a.executor.Execute(ctx, cmd)
+	var (
+		result *fleet.NodeResult
+		err    error
+	)
+	if se, ok := a.executor.(StreamingExecutor); ok {
+		// Forward output as it is produced so the control plane can show
+		// progress on long-running commands.
+		result, err = se.ExecuteStream(cmdCtx, cmd, func(line string) {
+			payload, _ := json.Marshal(ResultChunk{Line: line})
+			wsjson.Write(ctx, conn, WSMessage{
+				Type:      "result_chunk",
+				RequestID: msg.RequestID,
+				NodeID:    string(a.config.NodeID),
+				Payload:   payload,
+				Timestamp: time.Now(),
+			})
+		})
+	} else {
+		result, err = a.executor.Execute(cmdCtx, cmd)
+	}
 	if err != nil {
 		result = &fleet.NodeResult{
 			NodeID: a.config.NodeID,
@@ -698,6 +1464,11 @@ func (a *WSAgent) handleCommand(ctx context.Context, conn *websocket.Conn, msg W
 			Status: "failure",
 		}
 	}
+	if cmdCtx.Err() != nil && ctx.Err() == nil {
+		// Cancelled by the relay rather than by the connection dropping.
+		result.Status = "cancelled"
+		result.Error = "command cancelled by the control plane"
+	}
 
 	payload, _ := json.Marshal(result)
 	resultMsg := WSMessage{
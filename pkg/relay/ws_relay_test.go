@@ -3,16 +3,27 @@ package relay
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 	"github.com/freitascorp/devopsclaw/pkg/fleet"
+	"github.com/freitascorp/devopsclaw/pkg/resilience"
 )
 
 func wsTestLogger() *slog.Logger {
@@ -40,6 +51,9 @@ func TestWSServer_Defaults(t *testing.T) {
 	if srv.config.PingInterval != 15*time.Second {
 		t.Errorf("default PingInterval = %v, want 15s", srv.config.PingInterval)
 	}
+	if srv.config.MaxMessageBytes != DefaultMaxMessageBytes {
+		t.Errorf("default MaxMessageBytes = %d, want %d", srv.config.MaxMessageBytes, DefaultMaxMessageBytes)
+	}
 }
 
 func TestWSServer_ConnectedNodeIDs_Empty(t *testing.T) {
@@ -71,8 +85,8 @@ func TestWSRelayClient_PingNoTunnel(t *testing.T) {
 func TestWSServer_SendCommandNoTunnel(t *testing.T) {
 	srv := NewWSServer(ServerConfig{}, nil, wsTestLogger())
 	_, err := srv.SendCommandWS(context.Background(), "missing", &CommandEnvelope{})
-	if err == nil {
-		t.Error("expected error for missing tunnel")
+	if !errors.Is(err, fleet.ErrNoTunnel) {
+		t.Errorf("err = %v, want fleet.ErrNoTunnel", err)
 	}
 }
 
@@ -93,6 +107,126 @@ func TestWSAgent_New(t *testing.T) {
 	}
 }
 
+func TestWSAgent_ReconnectDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     AgentConfig
+		wantMax    time.Duration
+		wantJitter float64
+	}{
+		{"defaults", AgentConfig{}, 60 * time.Second, DefaultReconnectJitter},
+		{"max below base", AgentConfig{ReconnectInterval: 2 * time.Minute, MaxReconnectInterval: time.Minute}, 2 * time.Minute, DefaultReconnectJitter},
+		{"jitter disabled", AgentConfig{ReconnectJitter: -1}, 60 * time.Second, 0},
+		{"jitter clamped", AgentConfig{ReconnectJitter: 3}, 60 * time.Second, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewWSAgent(tt.config, nil, wsTestLogger())
+			if agent.config.MaxReconnectInterval != tt.wantMax {
+				t.Errorf("MaxReconnectInterval = %v, want %v", agent.config.MaxReconnectInterval, tt.wantMax)
+			}
+			if agent.config.ReconnectJitter != tt.wantJitter {
+				t.Errorf("ReconnectJitter = %v, want %v", agent.config.ReconnectJitter, tt.wantJitter)
+			}
+		})
+	}
+}
+
+func TestWSAgent_RunBacksOffAndResets(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+		accept   bool
+	)
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour}, fleet.NewMemoryStore(), wsTestLogger())
+	relayMux := srv.buildMux()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		ok := accept
+		mu.Unlock()
+		if !ok {
+			http.Error(w, "relay restarting", http.StatusServiceUnavailable)
+			return
+		}
+		relayMux.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	agent := NewWSAgent(AgentConfig{
+		NodeID:               "node-1",
+		RelayAddr:            "ws" + ts.URL[4:],
+		ReconnectInterval:    20 * time.Millisecond,
+		MaxReconnectInterval: 200 * time.Millisecond,
+		ReconnectJitter:      -1,
+		HeartbeatInterval:    time.Hour,
+	}, nil, wsTestLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() { done <- agent.Run(ctx) }()
+
+	waitAttempts := func(n int) []time.Time {
+		t.Helper()
+		for ctx.Err() == nil {
+			mu.Lock()
+			got := append([]time.Time(nil), attempts...)
+			mu.Unlock()
+			if len(got) >= n {
+				return got
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %d connect attempts", n)
+		return nil
+	}
+
+	// Six failed attempts: immediate, then 20, 40, 80, 160 and 200 (capped)
+	// ms apart.
+	got := waitAttempts(6)
+	if first := got[0].Sub(start); first > 500*time.Millisecond {
+		t.Errorf("first attempt after %v, want immediate", first)
+	}
+	for i, want := range []time.Duration{20, 40, 80, 160, 200} {
+		want *= time.Millisecond
+		if gap := got[i+1].Sub(got[i]); gap < want {
+			t.Errorf("gap %d = %v, want at least %v", i+1, gap, want)
+		}
+	}
+
+	mu.Lock()
+	accept = true
+	mu.Unlock()
+	deadline := time.Now().Add(2 * time.Second)
+	for !agent.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !agent.IsConnected() {
+		t.Fatal("agent did not connect once the relay accepted")
+	}
+
+	// A successful registration starts the backoff over at ReconnectInterval.
+	mu.Lock()
+	accept = false
+	n := len(attempts)
+	mu.Unlock()
+	srv.mu.RLock()
+	tunnel := srv.tunnels["node-1"]
+	srv.mu.RUnlock()
+	dropped := time.Now()
+	tunnel.Conn.CloseNow()
+
+	got = waitAttempts(n + 1)
+	if gap := got[n].Sub(dropped); gap > 150*time.Millisecond {
+		t.Errorf("reconnect after drop took %v, want about 20ms", gap)
+	}
+
+	cancel()
+	<-done
+}
+
 func TestWSAgent_StopBeforeRun(t *testing.T) {
 	agent := NewWSAgent(AgentConfig{
 		NodeID:    "test-node",
@@ -357,3 +491,1290 @@ func TestWSServer_HealthEndpoint(t *testing.T) {
 		t.Errorf("health status = %v, want ok", body["status"])
 	}
 }
+
+func TestWSServer_TunnelsEndpoint(t *testing.T) {
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: 1 * time.Hour, AuthToken: "tok"}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer tok"}},
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "test done")
+
+	payload, _ := json.Marshal(map[string]any{
+		"hostname":     "web-3.internal",
+		"capabilities": []string{"shell", "file"},
+		"resources":    fleet.NodeResources{OS: "linux", Arch: "arm64", CPUCores: 4},
+	})
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "web-3", Payload: payload, Timestamp: time.Now()})
+	var ack WSMessage
+	if err := wsjson.Read(ctx, conn, &ack); err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+
+	get := func(query string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/relay/tunnels"+query, nil)
+		req.Header.Set("Authorization", "Bearer tok")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("tunnels request: %v", err)
+		}
+		return resp
+	}
+
+	resp := get("?node=web-3")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var info TunnelInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	if info.NodeID != "web-3" || info.Hostname != "web-3.internal" || info.RemoteAddr == "" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Resources.OS != "linux" || info.Resources.Arch != "arm64" {
+		t.Errorf("resources = %+v, want linux/arm64", info.Resources)
+	}
+	if !reflect.DeepEqual(info.Capabilities, []string{"shell", "file"}) {
+		t.Errorf("capabilities = %v", info.Capabilities)
+	}
+
+	missing := get("?node=nope")
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown node status = %d, want 404", missing.StatusCode)
+	}
+
+	all := get("")
+	defer all.Body.Close()
+	var infos []TunnelInfo
+	json.NewDecoder(all.Body).Decode(&infos)
+	if len(infos) != 1 {
+		t.Errorf("expected 1 tunnel, got %d", len(infos))
+	}
+}
+
+func TestWSServer_TunnelsEndpoint_FakeTunnels(t *testing.T) {
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, AuthToken: "tok"}, nil, wsTestLogger())
+	connected := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	for _, id := range []fleet.NodeID{"web-2", "web-1"} {
+		srv.tunnels[id] = &WSTunnel{
+			NodeID:       id,
+			ConnectedAt:  connected,
+			LastPing:     connected.Add(time.Minute),
+			RemoteAddr:   "203.0.113.7:51544",
+			Registration: fleet.Node{Hostname: string(id) + ".internal", Labels: map[string]string{"role": "web"}},
+		}
+	}
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/relay/tunnels", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("tunnels request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("auth %q: status = %d, want 401", auth, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/relay/tunnels", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("tunnels request: %v", err)
+	}
+	defer resp.Body.Close()
+	var docs []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&docs); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(docs) != 2 || docs[0]["node_id"] != "web-1" || docs[1]["node_id"] != "web-2" {
+		t.Fatalf("tunnels = %v, want web-1 then web-2", docs)
+	}
+	for _, key := range []string{"node_id", "connected_at", "last_ping", "remote_addr", "hostname"} {
+		if _, ok := docs[0][key]; !ok {
+			t.Errorf("tunnel JSON missing %q: %v", key, docs[0])
+		}
+	}
+	if docs[0]["connected_at"] != "2026-05-01T09:00:00Z" || docs[0]["last_ping"] != "2026-05-01T09:01:00Z" {
+		t.Errorf("times = %v, %v", docs[0]["connected_at"], docs[0]["last_ping"])
+	}
+	if _, ok := docs[0]["conn"]; ok {
+		t.Error("tunnel JSON leaks the connection")
+	}
+
+	// Snapshots do not share the tunnel's label map.
+	srv.Tunnels()[0].Labels["role"] = "db"
+	if srv.tunnels["web-1"].Registration.Labels["role"] != "web" {
+		t.Error("Tunnels() shares the live label map")
+	}
+}
+
+// Test that an audited command round-trip produces an execution record
+func TestWSServer_CommandAudit(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: 1 * time.Hour, AuditCommands: true}, store, wsTestLogger())
+
+	mux := srv.buildMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	wsURL := "ws" + ts.URL[4:] + "/relay/agent"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "test done")
+
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "audit-node", Timestamp: time.Now()})
+	var ack WSMessage
+	wsjson.Read(ctx, conn, &ack)
+
+	// Agent side: answer the command after a known delay
+	const agentDelay = 50 * time.Millisecond
+	go func() {
+		var cmdMsg WSMessage
+		if err := wsjson.Read(ctx, conn, &cmdMsg); err != nil {
+			return
+		}
+		time.Sleep(agentDelay)
+		payload, _ := json.Marshal(fleet.NodeResult{NodeID: "audit-node", Output: "ok", ExitCode: 0})
+		wsjson.Write(ctx, conn, WSMessage{
+			Type:      "result",
+			RequestID: cmdMsg.RequestID,
+			NodeID:    "audit-node",
+			Payload:   payload,
+			Timestamp: time.Now(),
+		})
+	}()
+
+	env := &CommandEnvelope{
+		RequestID: "audit-req-1",
+		Command:   fleet.TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)},
+	}
+	before := time.Now()
+	if _, err := srv.SendCommandWS(ctx, "audit-node", env); err != nil {
+		t.Fatalf("SendCommandWS: %v", err)
+	}
+	elapsed := time.Since(before)
+
+	req, result, err := store.GetExecution(ctx, "audit-req-1")
+	if err != nil {
+		t.Fatalf("expected audit record: %v", err)
+	}
+	if req.Requester != "relay" {
+		t.Errorf("Requester = %q, want relay", req.Requester)
+	}
+	if req.Command.Type != "shell" {
+		t.Errorf("Command.Type = %q, want shell", req.Command.Type)
+	}
+	if len(req.Target.NodeIDs) != 1 || req.Target.NodeIDs[0] != "audit-node" {
+		t.Errorf("Target.NodeIDs = %v, want [audit-node]", req.Target.NodeIDs)
+	}
+	if req.CreatedAt.Before(before) {
+		t.Errorf("CreatedAt %v is before dispatch %v", req.CreatedAt, before)
+	}
+	if len(result.NodeResults) != 1 {
+		t.Fatalf("expected 1 node result, got %d", len(result.NodeResults))
+	}
+	nr := result.NodeResults[0]
+	if nr.NodeID != "audit-node" || nr.Status != "success" {
+		t.Errorf("node result = %+v", nr)
+	}
+	if result.Summary.Success != 1 {
+		t.Errorf("Summary.Success = %d, want 1", result.Summary.Success)
+	}
+	if result.Duration < agentDelay || result.Duration > elapsed {
+		t.Errorf("Duration = %v, want between %v and %v", result.Duration, agentDelay, elapsed)
+	}
+}
+
+// Test that commands are not recorded unless auditing is enabled
+func TestWSServer_CommandAuditDisabled(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{}, store, wsTestLogger())
+
+	srv.SendCommandWS(context.Background(), "missing", &CommandEnvelope{RequestID: "no-audit"})
+	if _, _, err := store.GetExecution(context.Background(), "no-audit"); err == nil {
+		t.Error("expected no audit record when AuditCommands is off")
+	}
+}
+
+// Test that a failed dispatch is still recorded
+func TestWSServer_CommandAuditFailure(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{AuditCommands: true}, store, wsTestLogger())
+
+	_, err := srv.SendCommandWS(context.Background(), "missing", &CommandEnvelope{
+		RequestID: "audit-fail",
+		Command:   fleet.TypedCommand{Type: "shell"},
+	})
+	if err == nil {
+		t.Fatal("expected error for missing tunnel")
+	}
+
+	_, result, err := store.GetExecution(context.Background(), "audit-fail")
+	if err != nil {
+		t.Fatalf("expected audit record: %v", err)
+	}
+	if result.NodeResults[0].Status != "failure" || result.Summary.Failed != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if result.NodeResults[0].Error == "" {
+		t.Error("expected error to be recorded")
+	}
+}
+
+// Test that a burst of reconnects leaves the node online in the store, even
+// though every replaced tunnel runs its disconnect cleanup afterwards.
+func TestWSServer_RapidReconnect(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{MaxNodes: 1, PingInterval: 1 * time.Hour}, store, wsTestLogger())
+
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	wsURL := "ws" + ts.URL[4:] + "/relay/agent"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	register := func() *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, wsURL, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		if err := wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "flappy", Timestamp: time.Now()}); err != nil {
+			t.Fatalf("send registration: %v", err)
+		}
+		var ack WSMessage
+		if err := wsjson.Read(ctx, conn, &ack); err != nil {
+			t.Fatalf("read ack: %v", err)
+		}
+		if ack.Type != "registered" {
+			t.Fatalf("ack.Type = %q, want registered", ack.Type)
+		}
+		return conn
+	}
+
+	var stale []*websocket.Conn
+	for i := 0; i < 5; i++ {
+		stale = append(stale, register())
+	}
+	current := stale[len(stale)-1]
+	stale = stale[:len(stale)-1]
+	defer current.Close(websocket.StatusNormalClosure, "test done")
+
+	// Wait until every replaced tunnel has been closed by the relay, then give
+	// their cleanup paths time to run.
+	for _, conn := range stale {
+		var msg WSMessage
+		if err := wsjson.Read(ctx, conn, &msg); err == nil {
+			t.Fatalf("expected stale tunnel to be closed, got %q", msg.Type)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ids := srv.ConnectedNodeIDs()
+	if len(ids) != 1 || ids[0] != "flappy" {
+		t.Fatalf("connected nodes = %v, want [flappy]", ids)
+	}
+	node, err := store.GetNode(ctx, "flappy")
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if node.Status != fleet.NodeStatusOnline {
+		t.Errorf("node status = %q, want online", node.Status)
+	}
+
+	// Closing the live tunnel still marks the node offline.
+	current.Close(websocket.StatusNormalClosure, "bye")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if node, _ := store.GetNode(ctx, "flappy"); node != nil && node.Status == fleet.NodeStatusOffline {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("node not marked offline after live tunnel closed")
+}
+
+func TestWSServer_ConnectionEvents(t *testing.T) {
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: 1 * time.Hour, AuthToken: "secret"}, fleet.NewMemoryStore(), wsTestLogger())
+
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	wsURL := "ws" + ts.URL[4:] + "/relay/agent"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connect := func(nodeID string) *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+			HTTPHeader: http.Header{"Authorization": {"Bearer secret"}},
+		})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: nodeID, Timestamp: time.Now()})
+		var ack WSMessage
+		if err := wsjson.Read(ctx, conn, &ack); err != nil {
+			t.Fatalf("read ack: %v", err)
+		}
+		return conn
+	}
+
+	// web-1 flaps three times; web-2 connects once and stays.
+	for i := 0; i < 3; i++ {
+		connect("web-1").Close(websocket.StatusNormalClosure, "agent restart")
+	}
+	stable := connect("web-2")
+	defer stable.Close(websocket.StatusNormalClosure, "test done")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.Events(EventQuery{NodeID: "web-1", Type: ConnEventDisconnect})) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	flaps := srv.Events(EventQuery{NodeID: "web-1"})
+	if len(flaps) != 6 {
+		t.Fatalf("web-1 events = %d, want 3 connects and 3 disconnects: %+v", len(flaps), flaps)
+	}
+	last := flaps[len(flaps)-1]
+	if last.Type != ConnEventDisconnect || last.RemoteAddr == "" {
+		t.Errorf("last event = %+v", last)
+	}
+	if !strings.Contains(last.Reason, "agent restart") {
+		t.Errorf("disconnect reason = %q, want the agent's close reason", last.Reason)
+	}
+
+	// The HTTP endpoint applies the same filters and requires the token.
+	get := func(query string, auth bool) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+"/relay/events?"+query, nil)
+		if auth {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("events request: %v", err)
+		}
+		return resp
+	}
+
+	resp := get("node=web-1&type=connect&since=1h", true)
+	defer resp.Body.Close()
+	var events []ConnEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Errorf("endpoint returned %d connect events for web-1, want 3", len(events))
+	}
+
+	if resp := get("", false); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want 401", resp.StatusCode)
+	}
+	if resp := get("since=bogus", true); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad query status = %d, want 400", resp.StatusCode)
+	}
+}
+
+// Integration test: a real agent streams output lines back while the command runs.
+func TestWSRelayClient_ExecuteStream(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: time.Hour}, store, wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	agent := NewWSAgent(AgentConfig{
+		NodeID:    "stream-node",
+		RelayAddr: "ws" + ts.URL[4:],
+	}, NewShellExecutor(""), wsTestLogger())
+	go agent.Run(ctx)
+	defer agent.Stop()
+
+	for len(srv.ConnectedNodeIDs()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("agent never connected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "echo one; echo two >&2; printf three"})
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	client := NewWSRelayClient(srv, wsTestLogger())
+	result, err := client.ExecuteStream(ctx, &fleet.Node{ID: "stream-node"}, fleet.TypedCommand{Type: "shell", Data: data}, func(line string) {
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("ExecuteStream() error: %v", err)
+	}
+	if result.Status != "success" || !strings.Contains(result.Output, "three") {
+		t.Errorf("final result should carry the full output: %+v", result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(lines) // stdout and stderr interleave nondeterministically
+	if want := []string{"one", "three", "two"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("streamed lines = %q, want %q", lines, want)
+	}
+}
+
+// Test that a stream consumer that blocks does not stall the tunnel: other
+// commands' results still arrive, and the blocked command later gets its
+// lines in order.
+func TestWSServer_SlowChunkSinkDoesNotBlockTunnel(t *testing.T) {
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialTestAgent(t, ctx, ts, "busy-node", nil)
+	defer conn.CloseNow()
+
+	release := make(chan struct{})
+	var lines []string
+	streamed := make(chan error, 1)
+	go func() {
+		_, err := srv.SendCommandStreamWS(ctx, "busy-node", &CommandEnvelope{RequestID: "req-slow", Command: fleet.TypedCommand{Type: "shell"}}, func(line string) {
+			<-release
+			lines = append(lines, line)
+		})
+		streamed <- err
+	}()
+	var cmdMsg WSMessage
+	if err := wsjson.Read(ctx, conn, &cmdMsg); err != nil || cmdMsg.RequestID != "req-slow" {
+		t.Fatalf("read command: %+v, %v", cmdMsg, err)
+	}
+	for _, line := range []string{"one", "two"} {
+		chunk, _ := json.Marshal(ResultChunk{Line: line})
+		wsjson.Write(ctx, conn, WSMessage{Type: "result_chunk", RequestID: "req-slow", Payload: chunk, Timestamp: time.Now()})
+	}
+
+	// The sink is stuck on "one"; a second command must still complete.
+	quick := make(chan error, 1)
+	go func() {
+		_, err := srv.SendCommandWS(ctx, "busy-node", &CommandEnvelope{RequestID: "req-quick", Command: fleet.TypedCommand{Type: "shell"}})
+		quick <- err
+	}()
+	if err := wsjson.Read(ctx, conn, &cmdMsg); err != nil || cmdMsg.RequestID != "req-quick" {
+		t.Fatalf("read second command: %+v, %v", cmdMsg, err)
+	}
+	result, _ := json.Marshal(fleet.NodeResult{NodeID: "busy-node", Status: "success"})
+	wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: "req-quick", Payload: result, Timestamp: time.Now()})
+	select {
+	case err := <-quick:
+		if err != nil {
+			t.Fatalf("second command: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("second command's result was held up by the blocked stream consumer")
+	}
+
+	wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: "req-slow", Payload: result, Timestamp: time.Now()})
+	close(release)
+	if err := <-streamed; err != nil {
+		t.Fatalf("streamed command: %v", err)
+	}
+	if want := []string{"one", "two"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("streamed lines = %q, want %q", lines, want)
+	}
+}
+
+// retryLogWriter signals on every "retrying" log line it receives.
+type retryLogWriter struct{ retried chan struct{} }
+
+func (w retryLogWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), "command delivery failed, retrying") {
+		select {
+		case w.retried <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func fastDeliveryRetry(attempts int) resilience.RetryConfig {
+	return resilience.RetryConfig{MaxAttempts: attempts, InitialDelay: 200 * time.Millisecond, MaxDelay: 200 * time.Millisecond}
+}
+
+// Test that a command sent while the node's tunnel is down is delivered
+// once the agent reconnects within the retry window.
+func TestWSRelayClient_ExecuteRetriesUntilTunnelReturns(t *testing.T) {
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: time.Hour}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	logs := retryLogWriter{retried: make(chan struct{}, 1)}
+	client := NewWSRelayClient(srv, slog.New(slog.NewTextHandler(logs, nil)), WithDeliveryRetry(fastDeliveryRetry(5)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type outcome struct {
+		result *fleet.NodeResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		r, err := client.Execute(ctx, &fleet.Node{ID: "flaky"}, fleet.TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"uptime"}`)})
+		done <- outcome{r, err}
+	}()
+
+	// The first send is refused: the node has no tunnel yet.
+	select {
+	case <-logs.retried:
+	case <-ctx.Done():
+		t.Fatal("expected a retried delivery")
+	}
+
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "test done")
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "flaky", Timestamp: time.Now()})
+	var ack WSMessage
+	wsjson.Read(ctx, conn, &ack)
+
+	var cmdMsg WSMessage
+	if err := wsjson.Read(ctx, conn, &cmdMsg); err != nil {
+		t.Fatalf("read command: %v", err)
+	}
+	payload, _ := json.Marshal(fleet.NodeResult{NodeID: "flaky", Output: "up 1 day", Status: "success"})
+	wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: cmdMsg.RequestID, NodeID: "flaky", Payload: payload, Timestamp: time.Now()})
+
+	got := <-done
+	if got.err != nil {
+		t.Fatalf("Execute: %v", got.err)
+	}
+	if got.result.Output != "up 1 day" {
+		t.Errorf("output = %q, want up 1 day", got.result.Output)
+	}
+}
+
+func TestWSRelayClient_ExecuteGivesUpWithNoTunnel(t *testing.T) {
+	srv := NewWSServer(ServerConfig{}, nil, wsTestLogger())
+	logs := retryLogWriter{retried: make(chan struct{}, 10)}
+	client := NewWSRelayClient(srv, slog.New(slog.NewTextHandler(logs, nil)),
+		WithDeliveryRetry(resilience.RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+
+	_, err := client.Execute(context.Background(), &fleet.Node{ID: "gone"}, fleet.TypedCommand{Type: "shell"})
+	if !errors.Is(err, fleet.ErrNoTunnel) {
+		t.Fatalf("err = %v, want fleet.ErrNoTunnel", err)
+	}
+	if err.Error() != "no active tunnel for node gone" {
+		t.Errorf("err = %q, want the delivery error unchanged", err)
+	}
+	if n := len(logs.retried); n != 2 {
+		t.Errorf("retries logged = %d, want 2", n)
+	}
+}
+
+func TestIsDeliveryError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w for node x", fleet.ErrNoTunnel), true},
+		{&commandWriteError{err: errors.New("send command to x: broken pipe")}, true},
+		{context.DeadlineExceeded, false},
+		{errors.New("exit status 1"), false},
+	}
+	for _, tt := range tests {
+		if got := isDeliveryError(tt.err); got != tt.want {
+			t.Errorf("isDeliveryError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// dialTestAgent connects to ts as nodeID and completes registration.
+func dialTestAgent(t *testing.T, ctx context.Context, ts *httptest.Server, nodeID string, opts *websocket.DialOptions) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", opts)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if opts != nil && opts.CompressionMode != websocket.CompressionDisabled {
+		if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+			t.Errorf("Sec-WebSocket-Extensions = %q, want permessage-deflate negotiated", ext)
+		}
+	}
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: nodeID, Timestamp: time.Now()})
+	var ack WSMessage
+	if err := wsjson.Read(ctx, conn, &ack); err != nil || ack.Type != "registered" {
+		t.Fatalf("registration ack: %+v, %v", ack, err)
+	}
+	return conn
+}
+
+func TestWSServer_OversizedMessageClosesTunnel(t *testing.T) {
+	store := fleet.NewMemoryStore()
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour, MaxMessageBytes: 1024}, store, wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialTestAgent(t, ctx, ts, "chatty-node", nil)
+	defer conn.CloseNow()
+
+	payload, _ := json.Marshal(fleet.NodeResult{NodeID: "chatty-node", Output: strings.Repeat("x", 4096)})
+	wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: "req-big", Payload: payload, Timestamp: time.Now()})
+
+	// The relay answers with a close frame, which surfaces on our next read.
+	_, _, err := conn.Read(ctx)
+	if got := websocket.CloseStatus(err); got != websocket.StatusMessageTooBig {
+		t.Errorf("close status = %v (err %v), want StatusMessageTooBig", got, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.ConnectedNodeIDs()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel still registered after oversized message")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	node, err := store.GetNode(ctx, "chatty-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Status != fleet.NodeStatusOffline {
+		t.Errorf("node status = %q, want offline", node.Status)
+	}
+}
+
+func TestWSServer_CompressedLargeResult(t *testing.T) {
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour, Compression: true}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialTestAgent(t, ctx, ts, "journal-node", &websocket.DialOptions{CompressionMode: websocket.CompressionContextTakeover})
+	defer conn.CloseNow()
+
+	// Larger than the WebSocket library's 32 KiB default read limit, well
+	// under DefaultMaxMessageBytes.
+	output := strings.Repeat("kernel: eth0 link up\n", 5000)
+	go func() {
+		var cmd WSMessage
+		if err := wsjson.Read(ctx, conn, &cmd); err != nil {
+			return
+		}
+		payload, _ := json.Marshal(fleet.NodeResult{NodeID: "journal-node", Status: "success", Output: output})
+		wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: cmd.RequestID, Payload: payload, Timestamp: time.Now()})
+	}()
+
+	result, err := srv.SendCommandWS(ctx, "journal-node", &CommandEnvelope{
+		RequestID: "req-journal",
+		Command:   fleet.TypedCommand{Type: "shell", Data: json.RawMessage(`{"command":"journalctl"}`)},
+	})
+	if err != nil {
+		t.Fatalf("SendCommandWS: %v", err)
+	}
+	if result.Result.Output != output {
+		t.Errorf("output length = %d, want %d", len(result.Result.Output), len(output))
+	}
+}
+
+func TestWSAgent_RotatedClientCert(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		reload func(a *WSAgent) error // run after the files are swapped
+		cfg    AgentConfig
+		keep   bool // expect the startup cert after reconnecting
+	}{
+		{name: "on reconnect"},
+		{name: "on demand", cfg: AgentConfig{DisableCertReload: true}, reload: (*WSAgent).ReloadClientCert},
+		{name: "disabled", cfg: AgentConfig{DisableCertReload: true}, keep: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			caCert, caKey, err := GenerateCA("test-org", 24*time.Hour)
+			if err != nil {
+				t.Fatalf("GenerateCA: %v", err)
+			}
+			caPath := filepath.Join(dir, "ca.pem")
+			os.WriteFile(caPath, caCert, 0o644)
+			serverCert, serverKey, err := GenerateServerCert(caCert, caKey, []string{"127.0.0.1"}, 24*time.Hour)
+			if err != nil {
+				t.Fatalf("GenerateServerCert: %v", err)
+			}
+			serverCertPath, serverKeyPath := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+			WriteCertFiles(serverCertPath, serverKeyPath, serverCert, serverKey)
+			certPath, keyPath := filepath.Join(dir, "node.pem"), filepath.Join(dir, "node-key.pem")
+			first := writeTestNodeCert(t, caCert, caKey, "rotating-node", certPath, keyPath)
+
+			mtls := MTLSConfig{
+				CACertFile:        caPath,
+				ServerCertFile:    serverCertPath,
+				ServerKeyFile:     serverKeyPath,
+				ClientCertFile:    certPath,
+				ClientKeyFile:     keyPath,
+				RequireClientCert: true,
+			}
+			srv := NewWSServer(ServerConfig{PingInterval: time.Hour, MTLS: &mtls}, fleet.NewMemoryStore(), wsTestLogger())
+			mux := srv.buildMux()
+			presented := make(chan *big.Int, 4)
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/relay/agent" && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+					presented <- r.TLS.PeerCertificates[0].SerialNumber
+				}
+				mux.ServeHTTP(w, r)
+			}))
+			if ts.TLS, err = ServerTLSConfig(mtls); err != nil {
+				t.Fatalf("ServerTLSConfig: %v", err)
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			cfg := tc.cfg
+			cfg.RelayAddr = "wss" + ts.URL[5:]
+			cfg.NodeID = "rotating-node"
+			cfg.MTLS = &mtls
+			cfg.ReconnectInterval = 10 * time.Millisecond
+			cfg.HeartbeatInterval = time.Hour
+			agent := NewWSAgent(cfg, &ShellExecutor{}, wsTestLogger())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			go agent.Run(ctx)
+			defer agent.Stop()
+
+			waitPresented := func() *big.Int {
+				select {
+				case serial := <-presented:
+					return serial
+				case <-ctx.Done():
+					t.Fatal("agent did not connect")
+					return nil
+				}
+			}
+			if got := waitPresented(); got.Cmp(first) != 0 {
+				t.Fatalf("first connect presented serial %v, want %v", got, first)
+			}
+			for !agent.IsConnected() {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			second := writeTestNodeCert(t, caCert, caKey, "rotating-node", certPath, keyPath)
+			if tc.reload != nil {
+				if err := tc.reload(agent); err != nil {
+					t.Fatalf("reload: %v", err)
+				}
+			}
+
+			// The established connection is untouched by the swap.
+			time.Sleep(50 * time.Millisecond)
+			if !agent.IsConnected() || len(presented) != 0 {
+				t.Fatalf("connection changed before reconnect (connected=%v, handshakes=%d)", agent.IsConnected(), len(presented))
+			}
+
+			// Drop the tunnel from the relay side; the agent reconnects.
+			srv.mu.RLock()
+			tunnel := srv.tunnels["rotating-node"]
+			srv.mu.RUnlock()
+			tunnel.Conn.CloseNow()
+
+			want := second
+			if tc.keep {
+				want = first
+			}
+			if got := waitPresented(); got.Cmp(want) != 0 {
+				t.Errorf("reconnect presented serial %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWSServer_ShutdownDrainsInFlightCommands(t *testing.T) {
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour, DrainTimeout: 5 * time.Second}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	wsURL := "ws" + ts.URL[4:] + "/relay/agent"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "deploy-node", Timestamp: time.Now()})
+	var ack WSMessage
+	wsjson.Read(ctx, conn, &ack)
+
+	// Start a command and let the agent receive it.
+	resultCh := make(chan *ResultEnvelope, 1)
+	go func() {
+		r, err := srv.SendCommandWS(ctx, "deploy-node", &CommandEnvelope{RequestID: "deploy-1", Command: fleet.TypedCommand{Type: "shell"}})
+		if err != nil {
+			t.Errorf("SendCommandWS: %v", err)
+		}
+		resultCh <- r
+	}()
+	var cmdMsg WSMessage
+	if err := wsjson.Read(ctx, conn, &cmdMsg); err != nil || cmdMsg.RequestID != "deploy-1" {
+		t.Fatalf("read command: %v (%+v)", err, cmdMsg)
+	}
+	closed := make(chan websocket.StatusCode, 1)
+	go func() {
+		var msg WSMessage
+		for {
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				closed <- websocket.CloseStatus(err)
+				return
+			}
+		}
+	}()
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- srv.Shutdown(ctx) }()
+
+	// While draining, new agents are turned away.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		srv.mu.RLock()
+		draining := srv.draining
+		srv.mu.RUnlock()
+		if draining || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	late, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial late agent: %v", err)
+	}
+	wsjson.Write(ctx, late, WSMessage{Type: "register", NodeID: "late-node", Timestamp: time.Now()})
+	if err := wsjson.Read(ctx, late, &ack); websocket.CloseStatus(err) != websocket.StatusTryAgainLater {
+		t.Errorf("late registration: err = %v, want close 1013", err)
+	}
+
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned (%v) while a command was in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The agent finishes the command; the result still reaches the caller.
+	payload, _ := json.Marshal(fleet.NodeResult{NodeID: "deploy-node", Status: "success", Output: "deployed"})
+	if err := wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: "deploy-1", NodeID: "deploy-node", Payload: payload, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("tunnel closed before the in-flight command completed: %v", err)
+	}
+	if r := <-resultCh; r == nil || r.Result.Output != "deployed" {
+		t.Fatalf("result = %+v, want the deployed output", r)
+	}
+
+	if err := <-shutdownDone; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if code := <-closed; code != websocket.StatusGoingAway {
+		t.Errorf("after drain: close status = %v, want %v", code, websocket.StatusGoingAway)
+	}
+}
+
+func TestWSServer_StartDrainsAfterSignal(t *testing.T) {
+	// Reserve a port for Start, which listens on ListenAddr itself.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	srv := NewWSServer(ServerConfig{ListenAddr: addr, PingInterval: time.Hour, DrainTimeout: 5 * time.Second}, fleet.NewMemoryStore(), wsTestLogger())
+	signalCtx, signal := context.WithCancel(context.Background())
+	defer signal()
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start(signalCtx) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var conn *websocket.Conn
+	for conn == nil {
+		conn, _, err = websocket.Dial(ctx, "ws://"+addr+"/relay/agent", nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "deploy-node", Timestamp: time.Now()})
+	var msg WSMessage
+	wsjson.Read(ctx, conn, &msg)
+
+	resultCh := make(chan *ResultEnvelope, 1)
+	go func() {
+		r, _ := srv.SendCommandWS(ctx, "deploy-node", &CommandEnvelope{RequestID: "deploy-1", Command: fleet.TypedCommand{Type: "shell"}})
+		resultCh <- r
+	}()
+	if err := wsjson.Read(ctx, conn, &msg); err != nil || msg.RequestID != "deploy-1" {
+		t.Fatalf("read command: %v (%+v)", err, msg)
+	}
+	if info, _ := srv.Tunnel("deploy-node"); !reflect.DeepEqual(info.Pending, []string{"deploy-1"}) {
+		t.Errorf("Pending = %v, want [deploy-1]", info.Pending)
+	}
+
+	// Ctrl+C cancels Start's context, then relay start calls Shutdown. The
+	// tunnel must survive the signal so the command can finish.
+	signal()
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- srv.Shutdown(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+
+	payload, _ := json.Marshal(fleet.NodeResult{NodeID: "deploy-node", Status: "success", Output: "deployed"})
+	if err := wsjson.Write(ctx, conn, WSMessage{Type: "result", RequestID: "deploy-1", NodeID: "deploy-node", Payload: payload, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("tunnel closed by the signal before draining: %v", err)
+	}
+	if r := <-resultCh; r == nil || r.Result.Output != "deployed" {
+		t.Fatalf("result = %+v, want the deployed output", r)
+	}
+	go func() {
+		// Answer the relay's close frame.
+		for wsjson.Read(ctx, conn, &msg) == nil {
+		}
+	}()
+	if err := <-shutdownDone; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if err := <-startErr; err != nil {
+		t.Errorf("Start: %v", err)
+	}
+}
+
+func TestWSServer_ShutdownDrainTimeout(t *testing.T) {
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour, DrainTimeout: 100 * time.Millisecond}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "stuck-node", Timestamp: time.Now()})
+	var ack WSMessage
+	wsjson.Read(ctx, conn, &ack)
+
+	cmdCtx, cmdCancel := context.WithCancel(ctx)
+	defer cmdCancel()
+	go srv.SendCommandWS(cmdCtx, "stuck-node", &CommandEnvelope{RequestID: "stuck-1", Command: fleet.TypedCommand{Type: "shell"}})
+	var cmdMsg WSMessage
+	wsjson.Read(ctx, conn, &cmdMsg)
+	go func() {
+		// Keep reading, so the agent answers the relay's close frame.
+		for wsjson.Read(ctx, conn, &cmdMsg) == nil {
+		}
+	}()
+
+	start := time.Now()
+	err = srv.Shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "drain: 1 command(s) still in flight") {
+		t.Errorf("Shutdown err = %v, want the abandoned command reported", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown took %v, want about the 100ms drain timeout", elapsed)
+	}
+	if ids := srv.ConnectedNodeIDs(); len(ids) != 0 {
+		t.Errorf("tunnels after shutdown = %v, want none", ids)
+	}
+}
+
+// heartbeatStore records the resources the relay passes on each heartbeat.
+type heartbeatStore struct {
+	*fleet.MemoryStore
+	heartbeats chan fleet.NodeResources
+}
+
+func (s *heartbeatStore) UpdateNodeHeartbeat(ctx context.Context, id fleet.NodeID, resources fleet.NodeResources) error {
+	s.heartbeats <- resources
+	return s.MemoryStore.UpdateNodeHeartbeat(ctx, id, resources)
+}
+
+// Test that the resources an agent samples on a heartbeat reach the store,
+// and that a heartbeat without them keeps the last report.
+func TestWSServer_HeartbeatResources(t *testing.T) {
+	store := &heartbeatStore{MemoryStore: fleet.NewMemoryStore(), heartbeats: make(chan fleet.NodeResources, 4)}
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: 1 * time.Hour}, store, wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "test done")
+
+	regPayload, _ := json.Marshal(map[string]any{"resources": fleet.NodeResources{CPUCores: 2, OS: "linux"}})
+	if err := wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "hb-node", Payload: regPayload, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("send registration: %v", err)
+	}
+	var ack WSMessage
+	if err := wsjson.Read(ctx, conn, &ack); err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+
+	agent := NewWSAgent(AgentConfig{NodeID: "hb-node", WorkDir: t.TempDir()}, nil, wsTestLogger())
+	pong := agent.heartbeatMessage()
+	var want fleet.NodeResources
+	if err := json.Unmarshal(pong.Payload, &want); err != nil {
+		t.Fatalf("heartbeat payload: %v", err)
+	}
+	if want.CPUCores == 0 || want.OS == "" {
+		t.Errorf("heartbeat payload lacks the static profile: %+v", want)
+	}
+
+	nextHeartbeat := func() fleet.NodeResources {
+		t.Helper()
+		select {
+		case res := <-store.heartbeats:
+			return res
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the heartbeat to reach the store")
+			return fleet.NodeResources{}
+		}
+	}
+
+	if err := wsjson.Write(ctx, conn, pong); err != nil {
+		t.Fatalf("send heartbeat: %v", err)
+	}
+	if got := nextHeartbeat(); got != want {
+		t.Errorf("store resources = %+v, want %+v", got, want)
+	}
+
+	// A bare pong, as sent in answer to a relay ping.
+	if err := wsjson.Write(ctx, conn, WSMessage{Type: "pong", NodeID: "hb-node", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("send pong: %v", err)
+	}
+	if got := nextHeartbeat(); got != want {
+		t.Errorf("bare pong changed resources to %+v, want %+v", got, want)
+	}
+	if info, _ := srv.Tunnel("hb-node"); info.Resources != want {
+		t.Errorf("tunnel resources = %+v, want %+v", info.Resources, want)
+	}
+}
+
+// Test that abandoning a command, as a cancelled fleet exec does, sends
+// the agent a "cancel" for its request ID.
+func TestWSServer_CancelDispatch(t *testing.T) {
+	srv := NewWSServer(ServerConfig{PingInterval: time.Hour}, fleet.NewMemoryStore(), wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "cancel-node", Timestamp: time.Now()})
+	var ack WSMessage
+	wsjson.Read(ctx, conn, &ack)
+
+	execCtx, cancelExec := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := srv.SendCommandWS(execCtx, "cancel-node", &CommandEnvelope{RequestID: "cmd-1", Command: fleet.TypedCommand{Type: "shell"}})
+		errCh <- err
+	}()
+	var msg WSMessage
+	if err := wsjson.Read(ctx, conn, &msg); err != nil || msg.Type != "command" {
+		t.Fatalf("read command: %v (%+v)", err, msg)
+	}
+
+	cancelExec()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("SendCommandWS error = %v, want context.Canceled", err)
+	}
+	if err := wsjson.Read(ctx, conn, &msg); err != nil {
+		t.Fatalf("read cancel: %v", err)
+	}
+	if msg.Type != "cancel" || msg.RequestID != "cmd-1" {
+		t.Errorf("got %+v, want a cancel for cmd-1", msg)
+	}
+	if n := srv.pendingCommands(); n != 0 {
+		t.Errorf("pending commands = %d after cancel, want 0", n)
+	}
+}
+
+// Test that a "cancel" from the relay kills the agent's running command
+// and that the agent reports it as cancelled.
+func TestWSAgent_CancelKillsCommand(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("checks for the child process in /proc")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The shell runs a child that records its PID and then becomes sleep;
+	// cancelling must kill that child too, not just the shell.
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	resultCh := make(chan WSMessage, 1)
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		var msg WSMessage
+		wsjson.Read(ctx, conn, &msg)
+		wsjson.Write(ctx, conn, WSMessage{Type: "registered", Timestamp: time.Now()})
+
+		data, _ := json.Marshal(fleet.ShellCommand{Command: "sh -c 'echo $$ > " + pidFile + "; exec sleep 60'; echo done"})
+		payload, _ := json.Marshal(fleet.TypedCommand{Type: "shell", Data: data})
+		wsjson.Write(ctx, conn, WSMessage{Type: "command", RequestID: "cmd-1", Payload: payload, Timestamp: time.Now()})
+		time.Sleep(200 * time.Millisecond) // let the command start
+		wsjson.Write(ctx, conn, WSMessage{Type: "cancel", RequestID: "cmd-1", Timestamp: time.Now()})
+
+		for {
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				return
+			}
+			if msg.Type == "result" {
+				resultCh <- msg
+				return
+			}
+		}
+	}))
+	defer relay.Close()
+
+	agent := NewWSAgent(AgentConfig{NodeID: "cancel-node", RelayAddr: "ws" + relay.URL[4:]}, NewShellExecutor(""), wsTestLogger())
+	go agent.Run(ctx)
+	defer agent.Stop()
+
+	start := time.Now()
+	var msg WSMessage
+	select {
+	case msg = <-resultCh:
+	case <-ctx.Done():
+		t.Fatal("no result after cancel")
+	}
+	// Killing only the shell would leave the child holding its output
+	// open until killWaitDelay.
+	if elapsed := time.Since(start); elapsed > killWaitDelay {
+		t.Errorf("result took %v; the command's children were not killed", elapsed)
+	}
+	var result fleet.NodeResult
+	if err := json.Unmarshal(msg.Payload, &result); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if result.Status != "cancelled" || result.ExitCode == 0 {
+		t.Errorf("result = %+v, want a cancelled, non-zero exit", result)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("child never started: %v", err)
+	}
+	pid := strings.TrimSpace(string(data))
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("child %s still running after cancel", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether pid is alive and not a zombie waiting to
+// be reaped.
+func processRunning(pid string) bool {
+	stat, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// slowRegisterStore blocks RegisterNode until release is closed.
+type slowRegisterStore struct {
+	*fleet.MemoryStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowRegisterStore) RegisterNode(ctx context.Context, node *fleet.Node) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.MemoryStore.RegisterNode(ctx, node)
+}
+
+// Test that a slow store write during registration does not hold the
+// tunnel map: lookups and commands to other nodes carry on meanwhile.
+func TestWSServer_SlowStoreDoesNotBlockRelay(t *testing.T) {
+	store := &slowRegisterStore{MemoryStore: fleet.NewMemoryStore(), entered: make(chan struct{}, 1), release: make(chan struct{})}
+	srv := NewWSServer(ServerConfig{MaxNodes: 10, PingInterval: time.Hour}, store, wsTestLogger())
+	ts := httptest.NewServer(srv.buildMux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:]+"/relay/agent", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+	wsjson.Write(ctx, conn, WSMessage{Type: "register", NodeID: "slow-node", Timestamp: time.Now()})
+
+	select {
+	case <-store.entered:
+	case <-ctx.Done():
+		t.Fatal("registration never reached the store")
+	}
+	listed := make(chan []fleet.NodeID, 1)
+	go func() { listed <- srv.ConnectedNodeIDs() }()
+	select {
+	case ids := <-listed:
+		if len(ids) != 1 || ids[0] != "slow-node" {
+			t.Errorf("connected nodes = %v, want [slow-node]", ids)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ConnectedNodeIDs blocked behind the store write")
+	}
+
+	close(store.release)
+	var ack WSMessage
+	if err := wsjson.Read(ctx, conn, &ack); err != nil || ack.Type != "registered" {
+		t.Fatalf("registration ack: %+v, %v", ack, err)
+	}
+}
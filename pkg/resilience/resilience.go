@@ -8,6 +8,7 @@ package resilience
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
@@ -15,6 +16,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 )
 
 // ------------------------------------------------------------------
@@ -148,6 +151,58 @@ func (cb *CircuitBreaker) transition(to CircuitState) {
 	}
 }
 
+// NewCircuitBreakerWithMetrics creates a circuit breaker that reports to
+// metrics: every transition to open increments CircuitBreakerTrips, and
+// the gauge from metrics.CircuitBreakerState(config.Name) tracks the
+// current state. An OnStateChange already set in config is still called.
+func NewCircuitBreakerWithMetrics(config CircuitBreakerConfig, metrics *observability.DevOpsClawMetrics) *CircuitBreaker {
+	var cb *CircuitBreaker
+	gauge := metrics.CircuitBreakerState(config.Name)
+	var gaugeMu sync.Mutex
+	next := config.OnStateChange
+
+	config.OnStateChange = func(name string, from, to CircuitState) {
+		// Each transition fires exactly one callback, so counting here is
+		// exact however many calls race to trip the breaker.
+		if to == CircuitOpen {
+			metrics.CircuitBreakerTrips.Inc()
+		}
+		// Callbacks run on their own goroutines and may land out of
+		// order; reading the live state under gaugeMu means the last one
+		// to run always leaves the gauge current.
+		gaugeMu.Lock()
+		gauge.Set(circuitStateGaugeValue(cb.currentState()))
+		gaugeMu.Unlock()
+		if next != nil {
+			next(name, from, to)
+		}
+	}
+
+	cb = NewCircuitBreaker(config)
+	gauge.Set(circuitStateGaugeValue(CircuitClosed))
+	return cb
+}
+
+// circuitStateGaugeValue orders states by severity for the state gauge.
+func circuitStateGaugeValue(s CircuitState) int64 {
+	switch s {
+	case CircuitHalfOpen:
+		return 1
+	case CircuitOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// currentState returns the state without State's open→half-open check,
+// so reading it never triggers a transition.
+func (cb *CircuitBreaker) currentState() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
 // ------------------------------------------------------------------
 // Retry with exponential backoff
 // ------------------------------------------------------------------
@@ -334,42 +389,107 @@ type Bulkhead struct {
 	sem      chan struct{}
 	active   atomic.Int64
 	rejected atomic.Int64
+
+	waiters     atomic.Int64
+	peakWaiters atomic.Int64
+	maxWaiters  int
+	onWait      func(name string, wait time.Duration, waiters int)
+}
+
+// BulkheadOption configures a Bulkhead.
+type BulkheadOption func(*Bulkhead)
+
+// WithMaxWaiters caps how many callers Execute lets queue for a slot.
+// Once n callers are waiting, further calls fail fast with
+// ErrBulkheadQueueFull instead of blocking. 0 means unbounded.
+func WithMaxWaiters(n int) BulkheadOption {
+	return func(b *Bulkhead) { b.maxWaiters = n }
 }
 
+// WithWaitObserver registers fn to be called each time an Execute caller
+// stops waiting — because it got a slot or its context ended — with how
+// long it waited and how many callers are still queued. Callers admitted
+// immediately report a zero wait. fn runs on the caller's goroutine and
+// must be fast; observability.DevOpsClawMetrics.ObserveBulkheadWait fits.
+func WithWaitObserver(fn func(name string, wait time.Duration, waiters int)) BulkheadOption {
+	return func(b *Bulkhead) { b.onWait = fn }
+}
+
+// ErrBulkheadQueueFull is returned by Execute when MaxWaiters callers are
+// already queued.
+var ErrBulkheadQueueFull = errors.New("bulkhead queue full")
+
 // NewBulkhead creates a bulkhead with the given concurrency limit.
-func NewBulkhead(name string, maxConcurrent int) *Bulkhead {
-	return &Bulkhead{
+func NewBulkhead(name string, maxConcurrent int, opts ...BulkheadOption) *Bulkhead {
+	b := &Bulkhead{
 		name: name,
 		sem:  make(chan struct{}, maxConcurrent),
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
-// Execute runs the function within the bulkhead's concurrency limit.
+// Execute runs the function within the bulkhead's concurrency limit,
+// waiting for a slot until ctx ends or, with WithMaxWaiters, failing fast
+// when the queue is already full.
 func (b *Bulkhead) Execute(ctx context.Context, fn func() error) error {
 	select {
 	case b.sem <- struct{}{}:
-		b.active.Add(1)
-		defer func() {
-			<-b.sem
-			b.active.Add(-1)
-		}()
-		return fn()
+		b.observeWait(0)
+		return b.run(fn)
+	default:
+	}
+
+	waiters := b.waiters.Add(1)
+	if b.maxWaiters > 0 && waiters > int64(b.maxWaiters) {
+		b.waiters.Add(-1)
+		b.rejected.Add(1)
+		return fmt.Errorf("bulkhead %s: %w (%d waiting)", b.name, ErrBulkheadQueueFull, b.maxWaiters)
+	}
+	for {
+		peak := b.peakWaiters.Load()
+		if waiters <= peak || b.peakWaiters.CompareAndSwap(peak, waiters) {
+			break
+		}
+	}
+
+	start := time.Now()
+	select {
+	case b.sem <- struct{}{}:
+		b.waiters.Add(-1)
+		b.observeWait(time.Since(start))
+		return b.run(fn)
 	case <-ctx.Done():
+		b.waiters.Add(-1)
 		b.rejected.Add(1)
+		b.observeWait(time.Since(start))
 		return fmt.Errorf("bulkhead %s: context cancelled while waiting", b.name)
 	}
 }
 
+// run executes fn in an already acquired slot.
+func (b *Bulkhead) run(fn func() error) error {
+	b.active.Add(1)
+	defer func() {
+		<-b.sem
+		b.active.Add(-1)
+	}()
+	return fn()
+}
+
+func (b *Bulkhead) observeWait(wait time.Duration) {
+	if b.onWait != nil {
+		b.onWait(b.name, wait, int(b.waiters.Load()))
+	}
+}
+
 // TryExecute runs the function if capacity is available, otherwise returns error immediately.
 func (b *Bulkhead) TryExecute(fn func() error) error {
 	select {
 	case b.sem <- struct{}{}:
-		b.active.Add(1)
-		defer func() {
-			<-b.sem
-			b.active.Add(-1)
-		}()
-		return fn()
+		return b.run(fn)
 	default:
 		b.rejected.Add(1)
 		return fmt.Errorf("bulkhead %s: no capacity available (%d active)", b.name, b.active.Load())
@@ -383,6 +503,10 @@ func (b *Bulkhead) Stats() BulkheadStats {
 		Active:   int(b.active.Load()),
 		Capacity: cap(b.sem),
 		Rejected: int(b.rejected.Load()),
+
+		Waiters:     int(b.waiters.Load()),
+		PeakWaiters: int(b.peakWaiters.Load()),
+		MaxWaiters:  b.maxWaiters,
 	}
 }
 
@@ -392,6 +516,10 @@ type BulkheadStats struct {
 	Active   int    `json:"active"`
 	Capacity int    `json:"capacity"`
 	Rejected int    `json:"rejected"`
+
+	Waiters     int `json:"waiters"`               // callers currently queued in Execute
+	PeakWaiters int `json:"peak_waiters"`          // deepest the queue has been
+	MaxWaiters  int `json:"max_waiters,omitempty"` // queue cap (0 = unbounded)
 }
 
 // ------------------------------------------------------------------
@@ -450,6 +578,19 @@ func (ic *IdempotencyController) Execute(key string, fn func() (any, error)) (an
 	return result, err
 }
 
+// Forget drops any cached result for key, so the next Execute with it runs
+// fn again. Use it when fn turned out not to have had any effect.
+func (ic *IdempotencyController) Forget(key string) {
+	ic.mu.Lock()
+	delete(ic.seen, key)
+	ic.mu.Unlock()
+}
+
+// TTL returns how long results are cached.
+func (ic *IdempotencyController) TTL() time.Duration {
+	return ic.ttl
+}
+
 // Cleanup removes expired entries. Should be called periodically.
 func (ic *IdempotencyController) Cleanup() {
 	ic.mu.Lock()
@@ -605,5 +746,42 @@ func (p *Pipeline) executeInner(ctx context.Context, fn func(ctx context.Context
 	return exec()
 }
 
+// ExecuteWithResult runs fn through p like Pipeline.Execute, returning the
+// value produced by the successful attempt. On failure it returns the zero
+// value of T with the pipeline's error. (Go methods cannot take type
+// parameters, hence a function rather than a Pipeline method.)
+//
+// Attempts abandoned by the pipeline timeout may still finish in the
+// background; their values are discarded once ExecuteWithResult returns.
+func ExecuteWithResult[T any](ctx context.Context, p *Pipeline, fn func(ctx context.Context) (T, error)) (T, error) {
+	var (
+		mu       sync.Mutex
+		result   T
+		returned bool
+	)
+
+	err := p.Execute(ctx, func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		if !returned {
+			result = v
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	returned = true
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
 // Unused but keeping for potential future use
 var _ = math.MaxFloat64
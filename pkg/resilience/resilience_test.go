@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/observability"
 )
 
 func TestCircuitBreaker_ClosedToOpen(t *testing.T) {
@@ -75,6 +78,54 @@ func TestCircuitBreaker_HalfOpenToClosed(t *testing.T) {
 	}
 }
 
+func TestCircuitBreakerWithMetrics_CountsEachTrip(t *testing.T) {
+	m := observability.NewDevOpsClawMetrics()
+	var hookCalls atomic.Int32
+	cb := NewCircuitBreakerWithMetrics(CircuitBreakerConfig{
+		Name:         "fleet-api",
+		MaxFailures:  3,
+		ResetTimeout: 50 * time.Millisecond,
+		OnStateChange: func(string, CircuitState, CircuitState) {
+			hookCalls.Add(1)
+		},
+	}, m)
+	state := m.CircuitBreakerState("fleet-api")
+
+	// Many callers failing at once must still count as a single trip.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cb.Execute(func() error { return fmt.Errorf("fail") })
+		}()
+	}
+	wg.Wait()
+	waitFor(t, func() bool { return state.Value() == 2 })
+	time.Sleep(10 * time.Millisecond) // let any stray callbacks land
+	if got := m.CircuitBreakerTrips.Value(); got != 1 {
+		t.Fatalf("expected 1 trip, got %d", got)
+	}
+
+	// A failed probe in half-open re-opens the breaker: a second trip.
+	time.Sleep(60 * time.Millisecond)
+	cb.Execute(func() error { return fmt.Errorf("still failing") })
+	waitFor(t, func() bool { return m.CircuitBreakerTrips.Value() == 2 })
+	waitFor(t, func() bool { return state.Value() == 2 })
+
+	// A successful probe closes it without counting a trip.
+	time.Sleep(60 * time.Millisecond)
+	if err := cb.Execute(func() error { return nil }); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	waitFor(t, func() bool { return state.Value() == 0 })
+	if got := m.CircuitBreakerTrips.Value(); got != 2 {
+		t.Errorf("expected 2 trips after recovery, got %d", got)
+	}
+	// closed→open, open→half-open, half-open→open, open→half-open, half-open→closed
+	waitFor(t, func() bool { return hookCalls.Load() == 5 })
+}
+
 func TestRetry_Success(t *testing.T) {
 	var attempts int
 	err := Retry(context.Background(), RetryConfig{
@@ -201,6 +252,103 @@ func TestBulkhead_TryExecute_Reject(t *testing.T) {
 	close(release)
 }
 
+func TestBulkhead_WaitersAndWaitTime(t *testing.T) {
+	type observation struct {
+		wait    time.Duration
+		waiters int
+	}
+	observed := make(chan observation, 10)
+	bh := NewBulkhead("test", 1, WithWaitObserver(func(name string, wait time.Duration, waiters int) {
+		if name != "test" {
+			t.Errorf("observer got name %q", name)
+		}
+		observed <- observation{wait, waiters}
+	}))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go bh.Execute(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	if o := <-observed; o.wait != 0 {
+		t.Errorf("immediate admission reported wait %s", o.wait)
+	}
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- bh.Execute(context.Background(), func() error { return nil }) }()
+	}
+	waitFor(t, func() bool { return bh.Stats().Waiters == 2 })
+	if s := bh.Stats(); s.PeakWaiters != 2 {
+		t.Errorf("expected peak waiters 2, got %d", s.PeakWaiters)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("queued Execute failed: %v", err)
+		}
+	}
+
+	first, second := <-observed, <-observed
+	if first.wait < 20*time.Millisecond {
+		t.Errorf("expected first queued wait >= 20ms, got %s", first.wait)
+	}
+	if first.waiters != 1 || second.waiters != 0 {
+		t.Errorf("expected remaining waiters 1 then 0, got %d then %d", first.waiters, second.waiters)
+	}
+	if s := bh.Stats(); s.Waiters != 0 {
+		t.Errorf("expected no waiters after drain, got %d", s.Waiters)
+	}
+}
+
+func TestBulkhead_MaxWaitersRejects(t *testing.T) {
+	bh := NewBulkhead("test", 1, WithMaxWaiters(1))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go bh.Execute(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	go bh.Execute(context.Background(), func() error { return nil })
+	waitFor(t, func() bool { return bh.Stats().Waiters == 1 })
+
+	start := time.Now()
+	err := bh.Execute(context.Background(), func() error {
+		t.Error("fn ran despite full queue")
+		return nil
+	})
+	if !errors.Is(err, ErrBulkheadQueueFull) {
+		t.Fatalf("expected ErrBulkheadQueueFull, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("rejection should not block")
+	}
+	if s := bh.Stats(); s.Rejected != 1 || s.Waiters != 1 || s.MaxWaiters != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestIdempotencyController(t *testing.T) {
 	ic := NewIdempotencyController(time.Second, slog.Default())
 	callCount := 0
@@ -265,3 +413,70 @@ func TestPipeline_Composed(t *testing.T) {
 		t.Errorf("pipeline should succeed: %v", err)
 	}
 }
+
+func TestExecuteWithResult_Success(t *testing.T) {
+	pipeline := NewPipeline(slog.Default(),
+		WithCircuitBreaker(NewCircuitBreaker(CircuitBreakerConfig{Name: "test", MaxFailures: 5})),
+		WithBulkhead(NewBulkhead("test", 2)),
+		WithRetry(RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}),
+		WithPipelineTimeout(time.Second),
+	)
+
+	var calls int32
+	got, err := ExecuteWithResult(context.Background(), pipeline, func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&calls, 1) < 2 {
+			return "partial", errors.New("transient")
+		}
+		return "ok", nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "ok" {
+		t.Errorf("got %q, want %q from the successful attempt", got, "ok")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestExecuteWithResult_Exhausted(t *testing.T) {
+	pipeline := NewPipeline(slog.Default(),
+		WithRetry(RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}),
+	)
+
+	var calls int32
+	got, err := ExecuteWithResult(context.Background(), pipeline, func(ctx context.Context) (*int, error) {
+		atomic.AddInt32(&calls, 1)
+		n := 42
+		return &n, errors.New("provider down")
+	})
+
+	if err == nil {
+		t.Fatal("expected error after retries are exhausted")
+	}
+	if got != nil {
+		t.Errorf("expected zero value on failure, got %v", *got)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestExecuteWithResult_TimeoutDiscardsLateValue(t *testing.T) {
+	pipeline := NewPipeline(slog.Default(), WithPipelineTimeout(20*time.Millisecond))
+
+	got, err := ExecuteWithResult(context.Background(), pipeline, func(ctx context.Context) (int, error) {
+		time.Sleep(60 * time.Millisecond)
+		return 7, nil
+	})
+
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if got != 0 {
+		t.Errorf("expected zero value on timeout, got %d", got)
+	}
+	time.Sleep(60 * time.Millisecond) // let the abandoned attempt finish
+}
@@ -0,0 +1,136 @@
+package runbook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// FleetStep runs a shell command across fleet nodes instead of locally.
+type FleetStep struct {
+	Command        string     `yaml:"command"                   json:"command"`
+	Target         StepTarget `yaml:"target,omitempty"          json:"target"`
+	MaxConcurrency int        `yaml:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+}
+
+// FleetExecutor dispatches a request across fleet nodes. *fleet.Executor
+// satisfies it.
+type FleetExecutor interface {
+	Execute(ctx context.Context, req *fleet.ExecRequest) (*fleet.ExecResult, error)
+}
+
+// SetExecutor wires the executor that fleet steps dispatch through.
+// Without one, runbooks with only local steps run as before and fleet
+// steps fail.
+func (e *Engine) SetExecutor(executor FleetExecutor) {
+	e.executor = executor
+}
+
+// HasFleetSteps reports whether any step of rb runs on the fleet.
+func (rb *Runbook) HasFleetSteps() bool {
+	for _, step := range rb.Steps {
+		if step.Fleet != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Selector turns the target into a fleet selector, the same way the
+// --node, --tag and --env flags of `fleet exec` do: node is a
+// comma-separated list of IDs, tag takes label expressions, and env
+// matches the env label. An empty target selects every node.
+func (t StepTarget) Selector() (fleet.TargetSelector, error) {
+	return fleet.ParseTargetSelector(t.Node, t.Tag, t.Env, "")
+}
+
+// String describes the target, e.g. "node=web-1 env=prod" or "all nodes".
+func (t StepTarget) String() string {
+	var parts []string
+	if t.Node != "" {
+		parts = append(parts, "node="+t.Node)
+	}
+	if t.Tag != "" {
+		parts = append(parts, "tag="+t.Tag)
+	}
+	if t.Env != "" {
+		parts = append(parts, "env="+t.Env)
+	}
+	if len(parts) == 0 {
+		return "all nodes"
+	}
+	return strings.Join(parts, " ")
+}
+
+// executeFleetStep dispatches step.Fleet through the engine's executor.
+// The step succeeds only if every targeted node succeeds; its output
+// joins each node's output under a "[node]" header so it can be captured.
+func (e *Engine) executeFleetStep(ctx context.Context, step Step, start time.Time) StepResult {
+	sr := StepResult{StepName: step.Name, ExitCode: -1}
+	fail := func(err error) StepResult {
+		sr.Status = "failure"
+		sr.Error = err.Error()
+		sr.Duration = time.Since(start)
+		return sr
+	}
+
+	if e.executor == nil {
+		return fail(errors.New("fleet step requires a fleet executor; none is configured"))
+	}
+	target, err := step.Fleet.Target.Selector()
+	if err != nil {
+		return fail(fmt.Errorf("fleet target: %w", err))
+	}
+	target.MaxConcurrency = step.Fleet.MaxConcurrency
+
+	timeout := 60 * time.Second
+	if step.TimeoutSec > 0 {
+		timeout = time.Duration(step.TimeoutSec) * time.Second
+	}
+	data, _ := json.Marshal(fleet.ShellCommand{Command: step.Fleet.Command, Env: step.Env})
+	req := &fleet.ExecRequest{
+		ID:        fmt.Sprintf("runbook_%d", time.Now().UnixNano()),
+		Target:    target,
+		Command:   fleet.TypedCommand{Type: "shell", Data: data},
+		Timeout:   timeout,
+		Requester: "runbook",
+		CreatedAt: time.Now(),
+	}
+
+	result, err := e.executor.Execute(ctx, req)
+	if err != nil {
+		return fail(err)
+	}
+	sr.Fleet = result
+	sr.Duration = time.Since(start)
+
+	var out strings.Builder
+	for _, nr := range result.NodeResults {
+		fmt.Fprintf(&out, "[%s]\n%s", nr.NodeID, nr.Output)
+		if nr.Output != "" && !strings.HasSuffix(nr.Output, "\n") {
+			out.WriteByte('\n')
+		}
+		if nr.Status != "success" && sr.ExitCode <= 0 {
+			sr.ExitCode = nr.ExitCode
+		}
+	}
+	sr.Output = out.String()
+
+	s := result.Summary
+	if bad := s.Failed + s.Timeout + s.Unreachable; bad > 0 {
+		sr.Status = "failure"
+		sr.Error = fmt.Sprintf("%d of %d node(s) failed", bad, s.Total)
+		if sr.ExitCode <= 0 {
+			sr.ExitCode = 1
+		}
+		return sr
+	}
+	sr.Status = "success"
+	sr.ExitCode = 0
+	return sr
+}
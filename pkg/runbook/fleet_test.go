@@ -0,0 +1,208 @@
+package runbook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// recordingExecutor records each request and answers with its result.
+type recordingExecutor struct {
+	reqs   []*fleet.ExecRequest
+	result *fleet.ExecResult
+}
+
+func (r *recordingExecutor) Execute(ctx context.Context, req *fleet.ExecRequest) (*fleet.ExecResult, error) {
+	r.reqs = append(r.reqs, req)
+	return r.result, nil
+}
+
+func TestEngine_FleetStepTargetsNodes(t *testing.T) {
+	rb, err := ParseRunbook([]byte(`
+name: restart-web
+params:
+  - name: node
+    default: web-1
+steps:
+  - name: Restart nginx
+    fleet:
+      command: systemctl restart nginx
+      target:
+        node: "{{ node }}, web-2"
+      max_concurrency: 1
+    timeout_sec: 5
+    capture: restart_out
+`))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+
+	exec := &recordingExecutor{result: &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-1", Output: "restarted", Status: "success"},
+			{NodeID: "web-2", Output: "restarted\n", Status: "success"},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Success: 2},
+	}}
+	engine := NewEngine(t.TempDir())
+	engine.SetExecutor(exec)
+
+	result, err := engine.Run(context.Background(), rb, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("Status = %q, want success (%+v)", result.Status, result.Steps)
+	}
+	if len(exec.reqs) != 1 {
+		t.Fatalf("executor called %d times, want 1", len(exec.reqs))
+	}
+
+	req := exec.reqs[0]
+	want := fleet.TargetSelector{NodeIDs: []fleet.NodeID{"web-1", "web-2"}, MaxConcurrency: 1}
+	if !reflect.DeepEqual(req.Target, want) {
+		t.Errorf("Target = %+v, want %+v", req.Target, want)
+	}
+	if req.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", req.Timeout)
+	}
+	var cmd fleet.ShellCommand
+	if err := json.Unmarshal(req.Command.Data, &cmd); err != nil || req.Command.Type != "shell" {
+		t.Fatalf("Command = %+v (%v), want a shell command", req.Command, err)
+	}
+	if cmd.Command != "systemctl restart nginx" {
+		t.Errorf("Command = %q", cmd.Command)
+	}
+
+	step := result.Steps[0]
+	if step.Fleet != exec.result {
+		t.Error("step result should carry the aggregate ExecResult")
+	}
+	if step.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want 0", step.ExitCode)
+	}
+	if want := "[web-1]\nrestarted\n[web-2]\nrestarted\n"; step.Output != want {
+		t.Errorf("Output = %q, want %q", step.Output, want)
+	}
+}
+
+func TestEngine_FleetStepLabelSelector(t *testing.T) {
+	rb, err := ParseRunbook([]byte(`
+name: check
+steps:
+  - name: Uptime
+    fleet:
+      command: uptime
+      target:
+        tag: role=web,zone!=us-east-1a
+        env: prod
+`))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+
+	exec := &recordingExecutor{result: &fleet.ExecResult{}}
+	engine := NewEngine(t.TempDir())
+	engine.SetExecutor(exec)
+	if _, err := engine.Run(context.Background(), rb, false); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got := exec.reqs[0].Target
+	if want := map[string]string{"role": "web", "env": "prod"}; !reflect.DeepEqual(got.Labels, want) {
+		t.Errorf("Labels = %v, want %v", got.Labels, want)
+	}
+	if len(got.LabelMatchers) != 1 || got.LabelMatchers[0].Key != "zone" || got.LabelMatchers[0].Op != fleet.LabelOpNe {
+		t.Errorf("LabelMatchers = %+v, want zone != us-east-1a", got.LabelMatchers)
+	}
+	if got.All || len(got.NodeIDs) != 0 {
+		t.Errorf("selector should only match labels: %+v", got)
+	}
+}
+
+func TestEngine_FleetStepNodeFailure(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(`
+name: fail
+steps:
+  - name: Check
+    fleet:
+      command: "false"
+  - name: After
+    run: echo after
+`))
+
+	exec := &recordingExecutor{result: &fleet.ExecResult{
+		NodeResults: []fleet.NodeResult{
+			{NodeID: "web-1", Status: "success"},
+			{NodeID: "web-2", ExitCode: 3, Status: "failure"},
+		},
+		Summary: fleet.ExecSummary{Total: 2, Success: 1, Failed: 1},
+	}}
+	engine := NewEngine(t.TempDir())
+	engine.SetExecutor(exec)
+
+	result, _ := engine.Run(context.Background(), rb, false)
+	if !exec.reqs[0].Target.All {
+		t.Errorf("empty target should select all nodes: %+v", exec.reqs[0].Target)
+	}
+	if len(result.Steps) != 1 {
+		t.Fatalf("expected the run to stop after the failed fleet step, got %d steps", len(result.Steps))
+	}
+	step := result.Steps[0]
+	if step.Status != "failure" || step.ExitCode != 3 {
+		t.Errorf("step = %s/%d, want failure/3", step.Status, step.ExitCode)
+	}
+	if step.Error != "1 of 2 node(s) failed" {
+		t.Errorf("Error = %q", step.Error)
+	}
+}
+
+func TestEngine_FleetStepWithoutExecutor(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(`
+name: no-fleet
+steps:
+  - name: Local
+    run: echo local
+  - name: Remote
+    fleet:
+      command: uptime
+      target:
+        node: web-1
+`))
+	engine := NewEngine(t.TempDir())
+
+	result, err := engine.Run(context.Background(), rb, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Steps[0].Status != "success" {
+		t.Errorf("local step = %q, want success", result.Steps[0].Status)
+	}
+	if s := result.Steps[1]; s.Status != "failure" || !strings.Contains(s.Error, "fleet executor") {
+		t.Errorf("fleet step = %s (%q), want failure naming the missing executor", s.Status, s.Error)
+	}
+
+	dry, _ := engine.Run(context.Background(), rb, true)
+	if want := "[dry-run] would run on node=web-1: uptime"; dry.Steps[1].Output != want {
+		t.Errorf("dry-run output = %q, want %q", dry.Steps[1].Output, want)
+	}
+}
+
+func TestParseRunbook_FleetStepNeedsCommand(t *testing.T) {
+	_, err := ParseRunbook([]byte(`
+name: bad
+steps:
+  - name: Remote
+    fleet:
+      target:
+        node: web-1
+`))
+	if err == nil || !strings.Contains(err.Error(), "fleet step must have a command") {
+		t.Errorf("err = %v, want missing command error", err)
+	}
+}
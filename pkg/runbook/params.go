@@ -0,0 +1,148 @@
+package runbook
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Param templates
+//
+// Besides the {{ name }} placeholders shared with captured variables, steps
+// can refer to params with Go text/template actions such as
+// {{ .params.host }} or {{ printf "%03d" .params.shard }}. Params have the
+// Go type of their declared type, so int and float params compare and
+// format as numbers. Each action that mentions .params is expanded on its
+// own before the step runs; other actions, like the {{.Names}} of a docker
+// --format string, are left for the command.
+
+// Param types. A param without a type is a string.
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamFloat  = "float"
+	ParamBool   = "bool"
+)
+
+// paramAction matches a template action that refers to .params.
+var paramAction = regexp.MustCompile(`\{\{[^{}]*\.params\b[^{}]*\}\}`)
+
+// validate checks p's type and that its default, if any, has that type.
+func (p Param) validate() error {
+	switch p.Type {
+	case "", ParamString, ParamInt, ParamFloat, ParamBool:
+	default:
+		return fmt.Errorf("param %s: unknown type %q (want string, int, float, or bool)", p.Name, p.Type)
+	}
+	if p.Default == "" {
+		return nil
+	}
+	_, err := paramValue(p, p.Default)
+	return err
+}
+
+// paramValue converts v to p's declared type, which validate has checked.
+// An empty value, as an optional param without a default has, is the zero
+// value of the type.
+func paramValue(p Param, v string) (any, error) {
+	empty := strings.TrimSpace(v) == ""
+	switch p.Type {
+	case "", ParamString:
+		return v, nil
+	case ParamInt:
+		if empty {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %q is not an int", p.Name, v)
+		}
+		return n, nil
+	case ParamFloat:
+		if empty {
+			return 0.0, nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %q is not a float", p.Name, v)
+		}
+		return f, nil
+	case ParamBool:
+		if empty {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %q is not a bool", p.Name, v)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("param %s: unknown type %q", p.Name, p.Type)
+	}
+}
+
+// typedParams converts resolved param values to their declared types.
+func (rb *Runbook) typedParams(values map[string]string) (map[string]any, error) {
+	typed := make(map[string]any, len(values))
+	for _, p := range rb.Params {
+		v, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+		tv, err := paramValue(p, v)
+		if err != nil {
+			return nil, err
+		}
+		typed[p.Name] = tv
+	}
+	return typed, nil
+}
+
+// checkParamTemplates expands every param template in the steps, so that a
+// bad action or a reference to an undeclared param fails the run before
+// any step does.
+func (rb *Runbook) checkParamTemplates(params map[string]any) error {
+	for _, step := range rb.Steps {
+		var firstErr error
+		mapStepStrings(step, func(s string) string {
+			out, err := expandParams(s, params)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return out
+		})
+		if firstErr != nil {
+			return fmt.Errorf("step %q: %w", step.Name, firstErr)
+		}
+	}
+	return nil
+}
+
+// expandParams expands each action in s that refers to .params. On error
+// it returns s with the failing action and those after it unexpanded.
+func expandParams(s string, params map[string]any) (string, error) {
+	if !strings.Contains(s, ".params") {
+		return s, nil
+	}
+	data := map[string]any{"params": params}
+	var firstErr error
+	out := paramAction.ReplaceAllStringFunc(s, func(action string) string {
+		if firstErr != nil {
+			return action
+		}
+		tmpl, err := template.New("param").Option("missingkey=error").Parse(action)
+		if err != nil {
+			firstErr = fmt.Errorf("parse %s: %w", action, err)
+			return action
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			firstErr = fmt.Errorf("expand %s: %w", action, err)
+			return action
+		}
+		return b.String()
+	})
+	return out, firstErr
+}
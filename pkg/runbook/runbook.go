@@ -9,14 +9,18 @@ package runbook
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
 )
 
 // Runbook is a YAML-defined workflow.
@@ -24,14 +28,27 @@ type Runbook struct {
 	Name        string   `yaml:"name"        json:"name"`
 	Description string   `yaml:"description" json:"description"`
 	Tags        []string `yaml:"tags"        json:"tags"`
+	Params      []Param  `yaml:"params,omitempty" json:"params,omitempty"`
 	Steps       []Step   `yaml:"steps"       json:"steps"`
 }
 
+// Param declares an input the runbook accepts. Values are interpolated into
+// steps as {{ name }}, the same way captured variables are, or as
+// {{ .params.name }} in a Go template action; see expandParams.
+type Param struct {
+	Name        string `yaml:"name"                  json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Type        string `yaml:"type,omitempty"        json:"type,omitempty"` // string (default), int, float, or bool
+	Required    bool   `yaml:"required,omitempty"    json:"required,omitempty"`
+	Default     string `yaml:"default,omitempty"     json:"default,omitempty"`
+}
+
 // Step is a single action in a runbook.
 type Step struct {
 	Name             string            `yaml:"name"              json:"name"`
 	Run              string            `yaml:"run,omitempty"     json:"run,omitempty"`
 	Browse           *BrowseStep       `yaml:"browse,omitempty"  json:"browse,omitempty"`
+	Fleet            *FleetStep        `yaml:"fleet,omitempty"   json:"fleet,omitempty"`
 	Notify           string            `yaml:"notify,omitempty"  json:"notify,omitempty"`
 	Message          string            `yaml:"message,omitempty" json:"message,omitempty"`
 	Target           *StepTarget       `yaml:"target,omitempty"  json:"target,omitempty"`
@@ -40,6 +57,7 @@ type Step struct {
 	ContinueOnError  bool              `yaml:"continue_on_error,omitempty" json:"continue_on_error,omitempty"`
 	TimeoutSec       int               `yaml:"timeout_sec,omitempty" json:"timeout_sec,omitempty"`
 	Env              map[string]string `yaml:"env,omitempty"     json:"env,omitempty"`
+	When             string            `yaml:"when,omitempty"    json:"when,omitempty"` // condition on earlier steps; see StepRef
 }
 
 // BrowseStep defines a browser automation step within a runbook.
@@ -64,6 +82,9 @@ type StepResult struct {
 	Error     string        `json:"error,omitempty"`
 	Duration  time.Duration `json:"duration"`
 	Captured  string        `json:"captured,omitempty"` // value captured for variable interpolation
+	ExitCode  int           `json:"exit_code"`          // shell exit status; -1 if the command never ran
+
+	Fleet *fleet.ExecResult `json:"fleet,omitempty"` // aggregate result of a fleet step
 }
 
 // RunResult is the outcome of an entire runbook execution.
@@ -75,6 +96,8 @@ type RunResult struct {
 	Status      string        `json:"status"` // "success", "failure", "partial"
 	Steps       []StepResult  `json:"steps"`
 	DryRun      bool          `json:"dry_run"`
+
+	Params map[string]string `json:"params,omitempty"`
 }
 
 // LoadRunbook loads a runbook from a YAML file.
@@ -98,13 +121,92 @@ func ParseRunbook(data []byte) (*Runbook, error) {
 	if len(rb.Steps) == 0 {
 		return nil, fmt.Errorf("runbook must have at least one step")
 	}
+	seen := make(map[string]bool, len(rb.Params))
+	for _, p := range rb.Params {
+		if p.Name == "" {
+			return nil, fmt.Errorf("runbook param must have a name")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate runbook param %q", p.Name)
+		}
+		seen[p.Name] = true
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("runbook %s: %w", rb.Name, err)
+		}
+	}
+
+	all := make(map[string]bool, len(rb.Steps))
+	for _, step := range rb.Steps {
+		all[StepRef(step.Name)] = true
+	}
+	earlier := make(map[string]bool, len(rb.Steps))
+	for _, step := range rb.Steps {
+		if step.Fleet != nil && strings.TrimSpace(step.Fleet.Command) == "" {
+			return nil, fmt.Errorf("step %q: fleet step must have a command", step.Name)
+		}
+		// Conditions built from params can only be checked once interpolated.
+		if step.When != "" && !strings.Contains(step.When, "{{") {
+			if err := validateWhen(step.When, earlier, all); err != nil {
+				return nil, fmt.Errorf("step %q: %w", step.Name, err)
+			}
+		}
+		earlier[StepRef(step.Name)] = true
+	}
 	return &rb, nil
 }
 
+// ResolveParams checks given against the runbook's declared params and
+// returns the full set of values, with defaults filled in. Undeclared
+// params, missing required params, values not of their param's type, and
+// {{ .params.x }} actions that fail to expand are errors.
+func (rb *Runbook) ResolveParams(given map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(rb.Params))
+	values := make(map[string]string, len(rb.Params))
+	var missing []string
+	for _, p := range rb.Params {
+		declared[p.Name] = true
+		if v, ok := given[p.Name]; ok {
+			values[p.Name] = v
+			continue
+		}
+		if p.Required {
+			missing = append(missing, p.Name)
+			continue
+		}
+		values[p.Name] = p.Default
+	}
+
+	var unknown []string
+	for name := range given {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("runbook %s: unknown param(s): %s", rb.Name, strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("runbook %s: missing required param(s): %s", rb.Name, strings.Join(missing, ", "))
+	}
+	typed, err := rb.typedParams(values)
+	if err != nil {
+		return nil, fmt.Errorf("runbook %s: %w", rb.Name, err)
+	}
+	if err := rb.checkParamTemplates(typed); err != nil {
+		return nil, fmt.Errorf("runbook %s: %w", rb.Name, err)
+	}
+	return values, nil
+}
+
 // Engine executes runbooks.
 type Engine struct {
 	runbookDir string
-	variables  map[string]string // captured variables from steps
+	params     map[string]any        // typed param values for {{ .params.x }}
+	variables  map[string]string     // captured variables from steps
+	steps      map[string]StepResult // completed steps by StepRef, for `when`
+	executor   FleetExecutor         // dispatches fleet steps; nil for local-only runs
 }
 
 // NewEngine creates a runbook engine that loads runbooks from the given directory.
@@ -158,15 +260,38 @@ func (e *Engine) Get(name string) (*Runbook, error) {
 
 // Run executes a runbook, returning the full result.
 func (e *Engine) Run(ctx context.Context, rb *Runbook, dryRun bool) (*RunResult, error) {
+	return e.RunWithParams(ctx, rb, nil, dryRun)
+}
+
+// RunWithParams executes a runbook with the given param values. Params are
+// validated with ResolveParams before any step runs.
+func (e *Engine) RunWithParams(ctx context.Context, rb *Runbook, params map[string]string, dryRun bool) (*RunResult, error) {
+	values, err := rb.ResolveParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if e.params, err = rb.typedParams(values); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	result := &RunResult{
 		RunbookName: rb.Name,
 		StartedAt:   start,
 		DryRun:      dryRun,
+		Params:      values,
 	}
 
-	// Reset variables
-	e.variables = make(map[string]string)
+	// Reset variables; params seed them and captures may add more.
+	e.variables = make(map[string]string, len(values))
+	for k, v := range values {
+		e.variables[k] = v
+	}
+	e.steps = make(map[string]StepResult, len(rb.Steps))
+	known := make(map[string]bool, len(rb.Steps))
+	for _, step := range rb.Steps {
+		known[StepRef(step.Name)] = true
+	}
 
 	allSuccess := true
 	for _, step := range rb.Steps {
@@ -179,8 +304,17 @@ func (e *Engine) Run(ctx context.Context, rb *Runbook, dryRun bool) (*RunResult,
 		default:
 		}
 
-		sr := e.executeStep(ctx, step, dryRun)
+		step = e.interpolateStep(step)
+		var sr StepResult
+		if run, err := e.shouldRun(step, known, dryRun); err != nil {
+			sr = StepResult{StepName: step.Name, Status: "failure", Error: err.Error(), ExitCode: -1}
+		} else if !run {
+			sr = StepResult{StepName: step.Name, Status: "skipped", Output: "condition not met: " + step.When, ExitCode: -1}
+		} else {
+			sr = e.executeStep(ctx, step, dryRun)
+		}
 		result.Steps = append(result.Steps, sr)
+		e.steps[StepRef(step.Name)] = sr
 
 		// Capture variable if specified
 		if step.Capture != "" && sr.Output != "" {
@@ -224,6 +358,15 @@ func (e *Engine) Run(ctx context.Context, rb *Runbook, dryRun bool) (*RunResult,
 	return result, nil
 }
 
+// shouldRun evaluates step's `when` condition against the steps completed
+// so far. Dry runs execute nothing, so every step is previewed.
+func (e *Engine) shouldRun(step Step, known map[string]bool, dryRun bool) (bool, error) {
+	if step.When == "" || dryRun {
+		return true, nil
+	}
+	return evalWhen(step.When, whenScope{done: e.steps, known: known})
+}
+
 func (e *Engine) executeStep(ctx context.Context, step Step, dryRun bool) StepResult {
 	start := time.Now()
 	sr := StepResult{StepName: step.Name}
@@ -231,19 +374,26 @@ func (e *Engine) executeStep(ctx context.Context, step Step, dryRun bool) StepRe
 	if step.RequiresApproval && !dryRun {
 		sr.Status = "pending_approval"
 		sr.Output = "Step requires human approval before execution"
+		sr.ExitCode = -1
 		sr.Duration = time.Since(start)
 		return sr
 	}
 
 	if dryRun {
 		sr.Status = "skipped"
+		sr.ExitCode = -1
 		sr.Output = "[dry-run] "
+		if step.When != "" {
+			sr.Output += fmt.Sprintf("when %s, ", step.When)
+		}
 		if step.Run != "" {
 			sr.Output += fmt.Sprintf("would run: %s", step.Run)
+		} else if step.Fleet != nil {
+			sr.Output += fmt.Sprintf("would run on %s: %s", step.Fleet.Target, step.Fleet.Command)
 		} else if step.Browse != nil {
 			sr.Output += fmt.Sprintf("would browse: %s", step.Browse.Task)
 		} else if step.Notify != "" {
-			sr.Output += fmt.Sprintf("would notify: %s — %s", step.Notify, e.interpolate(step.Message))
+			sr.Output += fmt.Sprintf("would notify: %s — %s", step.Notify, step.Message)
 		}
 		sr.Duration = time.Since(start)
 		return sr
@@ -254,6 +404,11 @@ func (e *Engine) executeStep(ctx context.Context, step Step, dryRun bool) StepRe
 		return e.executeShellStep(ctx, step, start)
 	}
 
+	// Fleet execution step
+	if step.Fleet != nil {
+		return e.executeFleetStep(ctx, step, start)
+	}
+
 	// Browse step (placeholder — will be wired when browser is integrated)
 	if step.Browse != nil {
 		sr.Status = "success"
@@ -265,13 +420,14 @@ func (e *Engine) executeStep(ctx context.Context, step Step, dryRun bool) StepRe
 	// Notify step (placeholder — will be wired to channels)
 	if step.Notify != "" {
 		sr.Status = "success"
-		sr.Output = fmt.Sprintf("[notify:%s] %s", step.Notify, e.interpolate(step.Message))
+		sr.Output = fmt.Sprintf("[notify:%s] %s", step.Notify, step.Message)
 		sr.Duration = time.Since(start)
 		return sr
 	}
 
 	sr.Status = "failure"
-	sr.Error = "step has no executable action (run, browse, or notify)"
+	sr.Error = "step has no executable action (run, fleet, browse, or notify)"
+	sr.ExitCode = -1
 	sr.Duration = time.Since(start)
 	return sr
 }
@@ -287,14 +443,13 @@ func (e *Engine) executeShellStep(ctx context.Context, step Step, start time.Tim
 	shellCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmdStr := e.interpolate(step.Run)
-	cmd := exec.CommandContext(shellCtx, "sh", "-c", cmdStr)
+	cmd := exec.CommandContext(shellCtx, "sh", "-c", step.Run)
 
 	// Set environment variables
 	if len(step.Env) > 0 {
 		cmd.Env = os.Environ()
 		for k, v := range step.Env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, e.interpolate(v)))
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 		}
 	}
 
@@ -305,6 +460,11 @@ func (e *Engine) executeShellStep(ctx context.Context, step Step, start time.Tim
 	if err != nil {
 		sr.Status = "failure"
 		sr.Error = err.Error()
+		sr.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			sr.ExitCode = exitErr.ExitCode()
+		}
 	} else {
 		sr.Status = "success"
 	}
@@ -312,9 +472,58 @@ func (e *Engine) executeShellStep(ctx context.Context, step Step, start time.Tim
 	return sr
 }
 
-// interpolate replaces {{ variable }} placeholders with captured values.
+// interpolateStep returns a copy of step with params and captured
+// variables substituted into its command, message, browse task, fleet
+// command and target, env values, and when condition.
+func (e *Engine) interpolateStep(step Step) Step {
+	return mapStepStrings(step, e.interpolate)
+}
+
+// mapStepStrings returns a copy of step with f applied to each field that
+// is interpolated.
+func mapStepStrings(step Step, f func(string) string) Step {
+	step.When = f(step.When)
+	step.Run = f(step.Run)
+	step.Message = f(step.Message)
+	if step.Browse != nil {
+		b := *step.Browse
+		b.URL = f(b.URL)
+		b.Task = f(b.Task)
+		step.Browse = &b
+	}
+	if step.Fleet != nil {
+		fs := *step.Fleet
+		fs.Command = f(fs.Command)
+		fs.Target = mapTargetStrings(fs.Target, f)
+		step.Fleet = &fs
+	}
+	if step.Target != nil {
+		t := mapTargetStrings(*step.Target, f)
+		step.Target = &t
+	}
+	if len(step.Env) > 0 {
+		env := make(map[string]string, len(step.Env))
+		for k, v := range step.Env {
+			env[k] = f(v)
+		}
+		step.Env = env
+	}
+	return step
+}
+
+// mapTargetStrings applies f to each selector field of t.
+func mapTargetStrings(t StepTarget, f func(string) string) StepTarget {
+	t.Tag = f(t.Tag)
+	t.Env = f(t.Env)
+	t.Node = f(t.Node)
+	return t
+}
+
+// interpolate expands {{ .params.x }} actions, which ResolveParams has
+// checked, then replaces {{ variable }} placeholders with params and
+// captured values.
 func (e *Engine) interpolate(s string) string {
-	result := s
+	result, _ := expandParams(s, e.params)
 	for k, v := range e.variables {
 		result = strings.ReplaceAll(result, "{{ "+k+" }}", v)
 		result = strings.ReplaceAll(result, "{{"+k+"}}", v)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -477,3 +478,192 @@ func TestEngine_YmlExtension(t *testing.T) {
 		t.Errorf("Name = %q, want yml-test", rb.Name)
 	}
 }
+
+const paramRunbook = `
+name: restart
+params:
+  - name: service
+    required: true
+  - name: env
+    default: staging
+steps:
+  - name: Restart
+    run: echo "restart {{ service }} in {{env}}"
+`
+
+func TestParseRunbook_Params(t *testing.T) {
+	rb, err := ParseRunbook([]byte(paramRunbook))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+	if len(rb.Params) != 2 || !rb.Params[0].Required || rb.Params[1].Default != "staging" {
+		t.Errorf("Params = %+v", rb.Params)
+	}
+
+	dup := `
+name: dup
+params:
+  - name: service
+  - name: service
+steps:
+  - name: s
+    run: echo
+`
+	if _, err := ParseRunbook([]byte(dup)); err == nil {
+		t.Error("expected error for duplicate param")
+	}
+}
+
+func TestEngine_RunWithParams_MissingRequired(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(paramRunbook))
+	engine := NewEngine(t.TempDir())
+
+	_, err := engine.RunWithParams(context.Background(), rb, map[string]string{"env": "prod"}, false)
+	if err == nil || !strings.Contains(err.Error(), "missing required param(s): service") {
+		t.Fatalf("err = %v, want missing service", err)
+	}
+
+	_, err = engine.RunWithParams(context.Background(), rb, map[string]string{"service": "nginx", "region": "eu"}, false)
+	if err == nil || !strings.Contains(err.Error(), "unknown param(s): region") {
+		t.Fatalf("err = %v, want unknown region", err)
+	}
+}
+
+func TestEngine_RunWithParams_Defaults(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(paramRunbook))
+	engine := NewEngine(t.TempDir())
+
+	result, err := engine.RunWithParams(context.Background(), rb, map[string]string{"service": "nginx"}, false)
+	if err != nil {
+		t.Fatalf("RunWithParams: %v", err)
+	}
+	if result.Params["env"] != "staging" {
+		t.Errorf("Params[env] = %q, want staging", result.Params["env"])
+	}
+	if result.Steps[0].Output != "restart nginx in staging\n" {
+		t.Errorf("Output = %q", result.Steps[0].Output)
+	}
+}
+
+func TestEngine_RunWithParams_InterpolatesStep(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(paramRunbook))
+	engine := NewEngine(t.TempDir())
+	params := map[string]string{"service": "nginx", "env": "prod"}
+
+	result, err := engine.RunWithParams(context.Background(), rb, params, false)
+	if err != nil {
+		t.Fatalf("RunWithParams: %v", err)
+	}
+	if result.Steps[0].Output != "restart nginx in prod\n" {
+		t.Errorf("Output = %q, want 'restart nginx in prod\\n'", result.Steps[0].Output)
+	}
+
+	dry, err := engine.RunWithParams(context.Background(), rb, params, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !strings.Contains(dry.Steps[0].Output, `would run: echo "restart nginx in prod"`) {
+		t.Errorf("dry-run Output = %q", dry.Steps[0].Output)
+	}
+}
+
+const templateRunbook = `
+name: incident-db
+params:
+  - name: host
+    required: true
+  - name: threshold
+    type: int
+    default: "80"
+steps:
+  - name: Check
+    run: |
+      echo "{{ .params.host }} over {{ printf "%d%%" .params.threshold }}" '{{.Names}}'
+`
+
+func TestEngine_RunWithParams_Template(t *testing.T) {
+	rb, err := ParseRunbook([]byte(templateRunbook))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+	engine := NewEngine(t.TempDir())
+
+	result, err := engine.RunWithParams(context.Background(), rb, map[string]string{"host": "db-3", "threshold": "90"}, false)
+	if err != nil {
+		t.Fatalf("RunWithParams: %v", err)
+	}
+	// Actions that do not refer to .params, like docker's, are left alone.
+	if got, want := result.Steps[0].Output, "db-3 over 90% {{.Names}}\n"; got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+
+	result, err = engine.RunWithParams(context.Background(), rb, map[string]string{"host": "db-3"}, false)
+	if err != nil {
+		t.Fatalf("RunWithParams with default: %v", err)
+	}
+	if got, want := result.Steps[0].Output, "db-3 over 80% {{.Names}}\n"; got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+}
+
+func TestEngine_RunWithParams_TemplateErrors(t *testing.T) {
+	rb, _ := ParseRunbook([]byte(templateRunbook))
+	engine := NewEngine(t.TempDir())
+
+	_, err := engine.RunWithParams(context.Background(), rb, map[string]string{"threshold": "90"}, false)
+	if err == nil || !strings.Contains(err.Error(), "missing required param(s): host") {
+		t.Errorf("err = %v, want missing host", err)
+	}
+	_, err = engine.RunWithParams(context.Background(), rb, map[string]string{"host": "db-3", "threshold": "high"}, false)
+	if err == nil || !strings.Contains(err.Error(), `param threshold: "high" is not an int`) {
+		t.Errorf("err = %v, want a type error", err)
+	}
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	typo, err := ParseRunbook([]byte(`
+name: typo
+params:
+  - name: host
+steps:
+  - name: Touch
+    run: touch ` + marker + `
+  - name: Check
+    run: echo {{ .params.hots }}
+`))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+	_, err = engine.RunWithParams(context.Background(), typo, map[string]string{"host": "db-3"}, false)
+	if err == nil || !strings.Contains(err.Error(), `step "Check"`) || !strings.Contains(err.Error(), "hots") {
+		t.Errorf("err = %v, want an expansion error for hots", err)
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Error("a step ran before the template error was reported")
+	}
+}
+
+func TestParseRunbook_ParamTypes(t *testing.T) {
+	for _, tt := range []struct{ params, want string }{
+		{"  - name: n\n    type: duration\n", `unknown type "duration"`},
+		{"  - name: n\n    type: int\n    default: ten\n", `param n: "ten" is not an int`},
+		{"  - name: n\n    type: bool\n    default: maybe\n", `param n: "maybe" is not a bool`},
+	} {
+		_, err := ParseRunbook([]byte("name: typed\nparams:\n" + tt.params + "steps:\n  - name: s\n    run: echo\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("err = %v, want %q", err, tt.want)
+		}
+	}
+
+	rb, err := ParseRunbook([]byte("name: typed\nparams:\n  - name: ratio\n    type: float\n    default: \"0.5\"\n  - name: force\n    type: bool\nsteps:\n  - name: s\n    run: echo\n"))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+	values, err := rb.ResolveParams(nil)
+	if err != nil {
+		t.Fatalf("ResolveParams: %v", err)
+	}
+	typed, err := rb.typedParams(values)
+	if err != nil || typed["ratio"] != 0.5 || typed["force"] != false {
+		t.Errorf("typedParams = %v, %v", typed, err)
+	}
+}
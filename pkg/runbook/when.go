@@ -0,0 +1,410 @@
+package runbook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Step conditions
+//
+// A step's `when` expression decides whether it runs. Expressions see the
+// results of earlier steps as steps.<ref>.<field>, where <ref> is the step
+// name lowercased with runs of other characters replaced by "_" ("Check
+// disk" → check_disk). Fields:
+//
+//	stdout     trimmed output (string)
+//	exit_code  shell exit status; -1 if the command never ran (number)
+//	success    the step succeeded (bool)
+//	status     success, failure, skipped, pending_approval (string)
+//	error      error message, if any (string)
+//
+// Operators, loosest first: ||, &&, !, then ==, !=, <, <=, >, >= and
+// contains. Operands are step fields, "double" or 'single' quoted strings,
+// numbers, true and false; parentheses group.
+
+// StepRef returns the identifier `when` expressions use for a step name.
+func StepRef(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// whenScope is what a condition is evaluated against.
+type whenScope struct {
+	done  map[string]StepResult // completed steps by ref
+	known map[string]bool       // every step ref in the runbook
+}
+
+// evalWhen evaluates a condition against the steps completed so far.
+func evalWhen(expr string, scope whenScope) (bool, error) {
+	node, _, err := parseWhen(expr)
+	if err != nil {
+		return false, err
+	}
+	v, err := node.eval(scope)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q is a %s, not a boolean", expr, typeName(v))
+	}
+	return b, nil
+}
+
+// validateWhen checks a step's condition when the runbook is parsed: it
+// must be well formed and may only reference earlier steps.
+func validateWhen(expr string, earlier, all map[string]bool) error {
+	_, refs, err := parseWhen(expr)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if !all[ref.step] {
+			return fmt.Errorf("unknown step %q", ref.step)
+		}
+		if !earlier[ref.step] {
+			return fmt.Errorf("step %q has not run yet at this point", ref.step)
+		}
+		if !validStepField(ref.field) {
+			return fmt.Errorf("unknown step field %q", ref.field)
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------
+// AST
+// ------------------------------------------------------------------
+
+type whenNode interface {
+	eval(s whenScope) (any, error)
+}
+
+type litNode struct{ v any }
+
+func (n litNode) eval(whenScope) (any, error) { return n.v, nil }
+
+type refNode struct{ step, field string }
+
+func (n refNode) eval(s whenScope) (any, error) {
+	sr, ok := s.done[n.step]
+	if !ok {
+		if s.known[n.step] {
+			return nil, fmt.Errorf("step %q has not run yet", n.step)
+		}
+		return nil, fmt.Errorf("unknown step %q", n.step)
+	}
+	switch n.field {
+	case "stdout":
+		return strings.TrimSpace(sr.Output), nil
+	case "exit_code":
+		return float64(sr.ExitCode), nil
+	case "success":
+		return sr.Status == "success", nil
+	case "status":
+		return sr.Status, nil
+	case "error":
+		return sr.Error, nil
+	}
+	return nil, fmt.Errorf("unknown step field %q", n.field)
+}
+
+func validStepField(f string) bool {
+	switch f {
+	case "stdout", "exit_code", "success", "status", "error":
+		return true
+	}
+	return false
+}
+
+type notNode struct{ x whenNode }
+
+func (n notNode) eval(s whenScope) (any, error) {
+	v, err := n.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a boolean, got %s", typeName(v))
+	}
+	return !b, nil
+}
+
+type binNode struct {
+	op   string
+	l, r whenNode
+}
+
+func (n binNode) eval(s whenScope) (any, error) {
+	l, err := n.l.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %s", n.op, typeName(l))
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := n.r.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %s", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.r.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "contains":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("contains needs strings, got %s and %s", typeName(l), typeName(r))
+		}
+		return strings.Contains(ls, rs), nil
+	case "==", "!=":
+		if typeName(l) != typeName(r) {
+			return nil, fmt.Errorf("cannot compare %s %s %s", typeName(l), n.op, typeName(r))
+		}
+		return (l == r) == (n.op == "=="), nil
+	default: // <, <=, >, >=
+		lf, lok := l.(float64)
+		rf, rok := r.(float64)
+		if !lok || !rok {
+			return nil, fmt.Errorf("%s needs numbers, got %s and %s", n.op, typeName(l), typeName(r))
+		}
+		switch n.op {
+		case "<":
+			return lf < rf, nil
+		case "<=":
+			return lf <= rf, nil
+		case ">":
+			return lf > rf, nil
+		default:
+			return lf >= rf, nil
+		}
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// ------------------------------------------------------------------
+// Parser
+// ------------------------------------------------------------------
+
+type whenParser struct {
+	toks []string
+	pos  int
+	refs []refNode
+}
+
+// parseWhen parses expr and returns its AST and every step reference in it.
+func parseWhen(expr string) (whenNode, []refNode, error) {
+	toks, err := lexWhen(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("when %q: %w", expr, err)
+	}
+	if len(toks) == 0 {
+		return nil, nil, fmt.Errorf("when: empty condition")
+	}
+	p := &whenParser{toks: toks}
+	node, err := p.parseOr()
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("when %q: %w", expr, err)
+	}
+	return node, p.refs, nil
+}
+
+func (p *whenParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *whenParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *whenParser) parseOr() (whenNode, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var r whenNode
+		if r, err = p.parseAnd(); err == nil {
+			l = binNode{op: "||", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *whenParser) parseAnd() (whenNode, error) {
+	l, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var r whenNode
+		if r, err = p.parseUnary(); err == nil {
+			l = binNode{op: "&&", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *whenParser) parseUnary() (whenNode, error) {
+	if p.peek() == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *whenParser) parseComparison() (whenNode, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=", "contains":
+		p.next()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return binNode{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *whenParser) parseOperand() (whenNode, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case tok == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return x, nil
+	case tok == "true" || tok == "false":
+		return litNode{v: tok == "true"}, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		return litNode{v: tok[1 : len(tok)-1]}, nil
+	case tok[0] == '-' || (tok[0] >= '0' && tok[0] <= '9'):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return litNode{v: f}, nil
+	case strings.HasPrefix(tok, "steps."):
+		parts := strings.Split(tok, ".")
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid step reference %q: expected steps.<name>.<field>", tok)
+		}
+		ref := refNode{step: parts[1], field: parts[2]}
+		p.refs = append(p.refs, ref)
+		return ref, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// lexWhen splits expr into tokens. String tokens keep their quotes (with
+// escapes resolved) so the parser can tell them from identifiers.
+func lexWhen(expr string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, string(c))
+			i++
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"),
+			strings.HasPrefix(expr[i:], "=="), strings.HasPrefix(expr[i:], "!="),
+			strings.HasPrefix(expr[i:], "<="), strings.HasPrefix(expr[i:], ">="):
+			toks = append(toks, expr[i:i+2])
+			i += 2
+		case c == '!' || c == '<' || c == '>':
+			toks = append(toks, string(c))
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				b.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, string(c)+b.String()+string(c))
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && isWhenIdentByte(expr[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, expr[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+func isWhenIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,197 @@
+package runbook
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStepRef(t *testing.T) {
+	tests := map[string]string{
+		"Check disk":          "check_disk",
+		"check_disk":          "check_disk",
+		"  Restart nginx (1)": "restart_nginx_1",
+		"TLS/cert -- expiry":  "tls_cert_expiry",
+	}
+	for in, want := range tests {
+		if got := StepRef(in); got != want {
+			t.Errorf("StepRef(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEvalWhen(t *testing.T) {
+	scope := whenScope{
+		done: map[string]StepResult{
+			"check_disk": {Status: "failure", ExitCode: 2, Output: "disk 97% full\n", Error: "exit status 2"},
+			"ping":       {Status: "success", Output: "pong\n"},
+		},
+		known: map[string]bool{"check_disk": true, "ping": true},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"steps.check_disk.exit_code != 0", true},
+		{"steps.check_disk.exit_code >= 2 && steps.check_disk.exit_code < 3", true},
+		{"steps.check_disk.success", false},
+		{"!steps.check_disk.success", true},
+		{`steps.check_disk.stdout contains "97%"`, true},
+		{`steps.ping.stdout == 'pong'`, true},
+		{`steps.ping.status == "success" || steps.nope.success`, true},
+		{`(steps.ping.success && steps.check_disk.success) || steps.check_disk.exit_code == -1`, false},
+		{"true", true},
+	}
+	for _, tt := range tests {
+		got, err := evalWhen(tt.expr, scope)
+		if err != nil {
+			t.Errorf("evalWhen(%q): %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evalWhen(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	errs := []struct {
+		expr, want string
+	}{
+		{"steps.check_disk.exit_code == \"2\"", "cannot compare number == string"},
+		{"steps.check_disk.stdout", "not a boolean"},
+		{"steps.check_disk.bogus == 1", `unknown step field "bogus"`},
+		{"steps.later.success", `unknown step "later"`},
+		{"steps.check_disk.exit_code !=", "unexpected end of condition"},
+		{`steps.ping.stdout contains "x`, "unterminated string"},
+		{"rm -rf", `unexpected "rm"`},
+	}
+	for _, tt := range errs {
+		_, err := evalWhen(tt.expr, scope)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("evalWhen(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestEngine_WhenRunsRemediationOnFailure(t *testing.T) {
+	rb, err := ParseRunbook([]byte(`
+name: disk
+steps:
+  - name: Check disk
+    run: echo "disk 97% full"; exit 3
+    continue_on_error: true
+  - name: Clean logs
+    when: steps.check_disk.exit_code != 0 && steps.check_disk.stdout contains "97%"
+    run: echo cleaned
+  - name: All good
+    when: steps.check_disk.success
+    run: echo fine
+`))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+
+	result, err := NewEngine(t.TempDir()).Run(context.Background(), rb, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s := result.Steps[0]; s.Status != "failure" || s.ExitCode != 3 {
+		t.Errorf("check step = %s exit %d, want failure exit 3", s.Status, s.ExitCode)
+	}
+	if s := result.Steps[1]; s.Status != "success" || s.Output != "cleaned\n" {
+		t.Errorf("remediation step = %s %q, want success", s.Status, s.Output)
+	}
+	if s := result.Steps[2]; s.Status != "skipped" {
+		t.Errorf("all-good step = %s, want skipped", s.Status)
+	}
+}
+
+func TestEngine_WhenSkippedStepPropagates(t *testing.T) {
+	rb, err := ParseRunbook([]byte(`
+name: propagate
+steps:
+  - name: Probe
+    run: "true"
+  - name: Fix
+    when: "!steps.probe.success"
+    run: echo fixing
+  - name: Verify fix
+    when: steps.fix.success
+    run: echo verifying
+  - name: Report
+    when: steps.fix.status == "skipped" && steps.verify_fix.status == "skipped"
+    run: echo nothing to do
+`))
+	if err != nil {
+		t.Fatalf("ParseRunbook: %v", err)
+	}
+
+	result, err := NewEngine(t.TempDir()).Run(context.Background(), rb, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var statuses []string
+	for _, s := range result.Steps {
+		statuses = append(statuses, s.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "success,skipped,skipped,success" {
+		t.Errorf("statuses = %s, want success,skipped,skipped,success", got)
+	}
+	if result.Status != "success" {
+		t.Errorf("run status = %s, want success", result.Status)
+	}
+	if result.Steps[3].Output != "nothing to do\n" {
+		t.Errorf("report output = %q", result.Steps[3].Output)
+	}
+}
+
+func TestParseRunbook_WhenReferencesLaterStep(t *testing.T) {
+	_, err := ParseRunbook([]byte(`
+name: order
+steps:
+  - name: Fix
+    when: steps.check.exit_code != 0
+    run: echo fixing
+  - name: Check
+    run: "true"
+`))
+	if err == nil || !strings.Contains(err.Error(), `step "check" has not run yet`) {
+		t.Fatalf("err = %v, want has-not-run-yet error", err)
+	}
+
+	_, err = ParseRunbook([]byte(`
+name: typo
+steps:
+  - name: Check
+    run: "true"
+  - name: Fix
+    when: steps.chekc.success
+    run: echo fixing
+`))
+	if err == nil || !strings.Contains(err.Error(), `unknown step "chekc"`) {
+		t.Fatalf("err = %v, want unknown step error", err)
+	}
+}
+
+func TestEngine_WhenReferencesStepNotYetRun(t *testing.T) {
+	// Built directly, so ParseRunbook's check is bypassed and the engine
+	// has to catch the bad reference itself.
+	rb := &Runbook{
+		Name: "direct",
+		Steps: []Step{
+			{Name: "Fix", When: "steps.check.exit_code != 0", Run: "echo fixing"},
+			{Name: "Check", Run: "true"},
+		},
+	}
+
+	result, err := NewEngine(t.TempDir()).Run(context.Background(), rb, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Steps) != 1 {
+		t.Fatalf("expected the run to stop at the failing condition, got %d steps", len(result.Steps))
+	}
+	if s := result.Steps[0]; s.Status != "failure" || !strings.Contains(s.Error, `step "check" has not run yet`) {
+		t.Errorf("step = %s %q, want failure naming the step", s.Status, s.Error)
+	}
+}
@@ -17,6 +17,10 @@ type Session struct {
 	Summary  string              `json:"summary,omitempty"`
 	Created  time.Time           `json:"created"`
 	Updated  time.Time           `json:"updated"`
+
+	// MaxToolIterations overrides the agent's tool-call iteration cap for
+	// this session. Zero means use the agent default.
+	MaxToolIterations int `json:"max_tool_iterations,omitempty"`
 }
 
 type SessionManager struct {
@@ -122,6 +126,30 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	}
 }
 
+// GetMaxToolIterations returns the session's tool-call iteration cap
+// override, or 0 if it has none.
+func (sm *SessionManager) GetMaxToolIterations(key string) int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return 0
+	}
+	return session.MaxToolIterations
+}
+
+// SetMaxToolIterations sets the session's tool-call iteration cap override.
+// Zero clears it.
+func (sm *SessionManager) SetMaxToolIterations(key string, n int) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.MaxToolIterations = n
+	session.Updated = time.Now()
+}
+
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -178,10 +206,11 @@ func (sm *SessionManager) Save(key string) error {
 	}
 
 	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
+		Key:               stored.Key,
+		Summary:           stored.Summary,
+		Created:           stored.Created,
+		Updated:           stored.Updated,
+		MaxToolIterations: stored.MaxToolIterations,
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
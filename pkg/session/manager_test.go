@@ -72,3 +72,22 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxToolIterations_PersistsAcrossReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "telegram:42"
+	if got := sm.GetMaxToolIterations(key); got != 0 {
+		t.Fatalf("unset override = %d, want 0", got)
+	}
+	sm.SetMaxToolIterations(key, 7)
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	sm2 := NewSessionManager(tmpDir)
+	if got := sm2.GetMaxToolIterations(key); got != 7 {
+		t.Errorf("override after reload = %d, want 7", got)
+	}
+}
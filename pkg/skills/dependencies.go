@@ -0,0 +1,179 @@
+package skills
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Dependency is one entry of a skill's `dependencies:` front matter, such
+// as "kubectl" or "helm >=1.2.0". Source is what to install when the skill
+// is missing: a GitHub path like "freitascorp/devopsclaw-skills/helm", or
+// a bare name, which is resolved next to the skill that depends on it.
+type Dependency struct {
+	Source  string `json:"source"`
+	Op      string `json:"op,omitempty"`      // ">=", ">", "<=", "<" or "="
+	Version string `json:"version,omitempty"` // required when Op is set
+}
+
+// Name is the installed directory name of the dependency.
+func (d Dependency) Name() string {
+	return path.Base(d.Source)
+}
+
+func (d Dependency) String() string {
+	if d.Op == "" {
+		return d.Source
+	}
+	return d.Source + " " + d.Op + d.Version
+}
+
+// constraintOps is ordered so two-character operators match first.
+var constraintOps = []string{">=", "<=", "==", ">", "<", "="}
+
+// ParseDependency parses "name", "name >=1.2.0" or "name>=1.2.0".
+func ParseDependency(spec string) (Dependency, error) {
+	spec = strings.TrimSpace(spec)
+	var d Dependency
+	d.Source = spec
+	if i := strings.IndexAny(spec, "<>="); i >= 0 {
+		d.Source = strings.TrimSpace(spec[:i])
+		rest := spec[i:]
+		for _, op := range constraintOps {
+			if strings.HasPrefix(rest, op) {
+				d.Op = op
+				d.Version = strings.TrimSpace(rest[len(op):])
+				break
+			}
+		}
+		if d.Op == "==" {
+			d.Op = "="
+		}
+		if _, err := parseVersion(d.Version); err != nil {
+			return Dependency{}, fmt.Errorf("dependency %q: %w", spec, err)
+		}
+	}
+	if d.Source == "" || strings.ContainsAny(d.Source, " \t") {
+		return Dependency{}, fmt.Errorf("dependency %q: want a skill name, optionally followed by a constraint like >=1.2.0", spec)
+	}
+	return d, nil
+}
+
+// SatisfiedBy reports whether version meets the dependency's constraint.
+// A dependency without a constraint accepts any version, even none.
+func (d Dependency) SatisfiedBy(version string) error {
+	if d.Op == "" {
+		return nil
+	}
+	if version == "" {
+		return fmt.Errorf("%s requires %s%s but declares no version", d.Name(), d.Op, d.Version)
+	}
+	have, err := parseVersion(version)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Name(), err)
+	}
+	want, _ := parseVersion(d.Version)
+	c := compareVersions(have, want)
+	ok := false
+	switch d.Op {
+	case ">=":
+		ok = c >= 0
+	case ">":
+		ok = c > 0
+	case "<=":
+		ok = c <= 0
+	case "<":
+		ok = c < 0
+	case "=":
+		ok = c == 0
+	}
+	if !ok {
+		return fmt.Errorf("%s requires %s%s, have %s", d.Name(), d.Op, d.Version, version)
+	}
+	return nil
+}
+
+// parseVersion splits "v1.2.3" into numeric parts. A pre-release or build
+// suffix ("-rc1", "+abc") is ignored.
+func parseVersion(v string) ([]int, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("invalid version %q", v)
+	}
+	var parts []int
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions compares parsed versions, treating missing parts as 0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseDependencyList reads a `dependencies:` value from simple YAML front
+// matter, written inline ("[a, b >=1.0]" or "a, b") or as a block list of
+// "- a" lines under the key.
+func parseDependencyList(frontmatter string) []string {
+	normalized := strings.ReplaceAll(frontmatter, "\r\n", "\n")
+	normalized = strings.ReplaceAll(normalized, "\r", "\n")
+
+	var out []string
+	inBlock := false
+	for _, line := range strings.Split(normalized, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inBlock {
+			if item, ok := strings.CutPrefix(trimmed, "-"); ok {
+				if item = strings.Trim(strings.TrimSpace(item), "\"'"); item != "" {
+					out = append(out, item)
+				}
+				continue
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			break
+		}
+		value, ok := strings.CutPrefix(trimmed, "dependencies:")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			inBlock = true
+			continue
+		}
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.Trim(strings.TrimSpace(item), "\"'"); item != "" {
+				out = append(out, item)
+			}
+		}
+		break
+	}
+	return out
+}
@@ -0,0 +1,242 @@
+package skills
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultIndexURL is the skill catalog that `skills search` and
+// `skills install <name>` use when none is configured.
+const DefaultIndexURL = "https://raw.githubusercontent.com/freitascorp/devopsclaw-skills/main/skills.json"
+
+// DefaultIndexTTL is how long a downloaded index is used before it is
+// fetched again.
+const DefaultIndexTTL = 24 * time.Hour
+
+// SkillIndex fetches a remote skill catalog, a JSON array of
+// AvailableSkill, and keeps a copy on disk. The copy is used while it is
+// fresh, and at any age when the catalog cannot be reached, so search and
+// install by name keep working offline.
+type SkillIndex struct {
+	url       string
+	cachePath string // "" disables the on-disk copy
+	ttl       time.Duration
+	client    *http.Client
+}
+
+// NewSkillIndex creates an index client for url, caching it at cachePath
+// for ttl. An empty url or non-positive ttl uses the default.
+func NewSkillIndex(url, cachePath string, ttl time.Duration) *SkillIndex {
+	if url == "" {
+		url = DefaultIndexURL
+	}
+	if ttl <= 0 {
+		ttl = DefaultIndexTTL
+	}
+	return &SkillIndex{
+		url:       url,
+		cachePath: cachePath,
+		ttl:       ttl,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// URL returns the catalog's address.
+func (ix *SkillIndex) URL() string {
+	return ix.url
+}
+
+// Load returns the catalog. A cached copy younger than the TTL is used as
+// is; otherwise the catalog is downloaded and cached. If the download
+// fails and a cached copy exists, that copy is returned with its age and
+// stale set.
+func (ix *SkillIndex) Load(ctx context.Context) (skills []AvailableSkill, age time.Duration, stale bool, err error) {
+	cached, cachedAt, cacheErr := ix.readCache()
+	if cacheErr == nil && time.Since(cachedAt) < ix.ttl {
+		return cached, time.Since(cachedAt), false, nil
+	}
+
+	body, err := ix.fetch(ctx)
+	if err == nil {
+		if skills, err = parseIndex(body); err == nil {
+			ix.writeCache(body)
+			return skills, 0, false, nil
+		}
+	}
+	if cacheErr == nil {
+		return cached, time.Since(cachedAt), true, nil
+	}
+	return nil, 0, false, err
+}
+
+// Resolve returns the install source of the skill named name: its Source,
+// or else its Repository.
+func (ix *SkillIndex) Resolve(ctx context.Context, name string) (string, error) {
+	skills, _, _, err := ix.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range skills {
+		if !strings.EqualFold(s.Name, name) {
+			continue
+		}
+		if s.Source != "" {
+			return s.Source, nil
+		}
+		if s.Repository != "" {
+			return s.Repository, nil
+		}
+		return "", fmt.Errorf("skill '%s' has no source in the index", name)
+	}
+	return "", fmt.Errorf("skill '%s' not found in the index at %s", name, ix.url)
+}
+
+// SearchIndex returns the skills matching every word of query in their
+// name, description, tags or author, best first: name matches rank above
+// tag matches, which rank above description and author matches. An empty
+// query matches every skill, sorted by name.
+func SearchIndex(skills []AvailableSkill, query string) []AvailableSkill {
+	terms := strings.Fields(strings.ToLower(query))
+	type scored struct {
+		skill AvailableSkill
+		score int
+	}
+	var matches []scored
+	for _, s := range skills {
+		total := 0
+		for _, term := range terms {
+			score := termScore(s, term)
+			if score == 0 {
+				total = 0
+				break
+			}
+			total += score
+		}
+		if total > 0 || len(terms) == 0 {
+			matches = append(matches, scored{s, total})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].skill.Name < matches[j].skill.Name
+	})
+	out := make([]AvailableSkill, len(matches))
+	for i, m := range matches {
+		out[i] = m.skill
+	}
+	return out
+}
+
+// termScore rates how well s matches one lowercase search term.
+func termScore(s AvailableSkill, term string) int {
+	name := strings.ToLower(s.Name)
+	switch {
+	case name == term:
+		return 4
+	case strings.Contains(name, term):
+		return 3
+	}
+	for _, tag := range s.Tags {
+		if strings.Contains(strings.ToLower(tag), term) {
+			return 2
+		}
+	}
+	if strings.Contains(strings.ToLower(s.Description), term) || strings.Contains(strings.ToLower(s.Author), term) {
+		return 1
+	}
+	return 0
+}
+
+func (ix *SkillIndex) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", ix.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := ix.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch skills index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to fetch skills index: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, nil
+}
+
+func parseIndex(body []byte) ([]AvailableSkill, error) {
+	var skills []AvailableSkill
+	if err := json.Unmarshal(body, &skills); err != nil {
+		return nil, fmt.Errorf("failed to parse skills index: %w", err)
+	}
+	return skills, nil
+}
+
+// indexCache is the on-disk copy of a catalog. URL records which catalog
+// it is, so that changing the configured index does not keep serving the
+// old one.
+type indexCache struct {
+	URL   string          `json:"url"`
+	Index json.RawMessage `json:"index"`
+}
+
+// readCache returns the cached catalog and when it was downloaded. A copy
+// of another catalog, or in the older unkeyed format, counts as missing.
+func (ix *SkillIndex) readCache() ([]AvailableSkill, time.Time, error) {
+	if ix.cachePath == "" {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	info, err := os.Stat(ix.cachePath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(ix.cachePath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var cache indexCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.URL != ix.url {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	skills, err := parseIndex(cache.Index)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return skills, info.ModTime(), nil
+}
+
+// writeCache saves a downloaded catalog. Failing to cache only costs a
+// download next time, so errors are ignored.
+func (ix *SkillIndex) writeCache(body []byte) {
+	if ix.cachePath == "" {
+		return
+	}
+	data, err := json.Marshal(indexCache{URL: ix.url, Index: body})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.cachePath), 0o755); err != nil {
+		return
+	}
+	tmp := ix.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	os.Rename(tmp, ix.cachePath)
+}
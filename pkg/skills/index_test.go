@@ -0,0 +1,173 @@
+package skills
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndex = `[
+  {"name": "vault", "description": "Manage HashiCorp Vault secrets", "version": "1.2.0",
+   "source": "acme/skills/vault", "tags": ["secrets"]},
+  {"name": "terraform", "description": "Plan and apply infrastructure", "version": "2.0.0",
+   "repository": "acme/skills/terraform", "tags": ["iac"]},
+  {"name": "sops", "description": "Encrypt secrets in git", "source": "https://skills.example.com/sops"}
+]`
+
+// newIndexServer serves testIndex and counts the requests it receives.
+// Setting down makes it answer 503.
+func newIndexServer(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+	var hits atomic.Int32
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(testIndex))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, &down
+}
+
+func TestSkillIndex_Search(t *testing.T) {
+	srv, _, _ := newIndexServer(t)
+	skills, _, stale, err := NewSkillIndex(srv.URL, "", 0).Load(context.Background())
+	require.NoError(t, err)
+	assert.False(t, stale)
+
+	names := func(matches []AvailableSkill) []string {
+		var out []string
+		for _, s := range matches {
+			out = append(out, s.Name)
+		}
+		return out
+	}
+
+	// The name match ranks above the description match.
+	assert.Equal(t, []string{"vault", "sops"}, names(SearchIndex(skills, "secrets")))
+	assert.Equal(t, []string{"vault"}, names(SearchIndex(skills, "VAULT secrets")))
+	assert.Equal(t, []string{"terraform"}, names(SearchIndex(skills, "iac")))
+	assert.Empty(t, SearchIndex(skills, "vault iac"))
+	assert.Equal(t, []string{"sops", "terraform", "vault"}, names(SearchIndex(skills, "")))
+}
+
+func TestSkillIndex_Resolve(t *testing.T) {
+	srv, _, _ := newIndexServer(t)
+	ix := NewSkillIndex(srv.URL, "", 0)
+	ctx := context.Background()
+
+	for name, want := range map[string]string{
+		"vault":     "acme/skills/vault",
+		"terraform": "acme/skills/terraform", // no source: falls back to repository
+		"sops":      "https://skills.example.com/sops",
+	} {
+		got, err := ix.Resolve(ctx, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	_, err := ix.Resolve(ctx, "ansible")
+	assert.ErrorContains(t, err, "not found in the index")
+}
+
+func TestSkillIndex_CacheAndOffline(t *testing.T) {
+	srv, hits, down := newIndexServer(t)
+	cachePath := filepath.Join(t.TempDir(), "skills-index.json")
+	ix := NewSkillIndex(srv.URL, cachePath, time.Hour)
+	ctx := context.Background()
+
+	_, _, _, err := ix.Load(ctx)
+	require.NoError(t, err)
+	_, _, stale, err := ix.Load(ctx)
+	require.NoError(t, err)
+	assert.False(t, stale)
+	assert.EqualValues(t, 1, hits.Load(), "a fresh cached index should not be fetched again")
+
+	// Once the cache expires and the index is unreachable, the old copy is
+	// still used.
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+	down.Store(true)
+	skills, age, stale, err := ix.Load(ctx)
+	require.NoError(t, err)
+	assert.True(t, stale)
+	assert.Greater(t, age, time.Hour)
+	assert.Len(t, skills, 3)
+	assert.EqualValues(t, 2, hits.Load())
+
+	source, err := ix.Resolve(ctx, "vault")
+	require.NoError(t, err)
+	assert.Equal(t, "acme/skills/vault", source)
+
+	// With no cache to fall back on, the fetch error is returned.
+	_, _, _, err = NewSkillIndex(srv.URL, filepath.Join(t.TempDir(), "none.json"), time.Hour).Load(ctx)
+	assert.ErrorContains(t, err, "HTTP 503")
+}
+
+func TestSkillIndex_CacheIsKeyedByURL(t *testing.T) {
+	oldSrv, oldHits, _ := newIndexServer(t)
+	newSrv, newHits, newDown := newIndexServer(t)
+	cachePath := filepath.Join(t.TempDir(), "skills-index.json")
+	ctx := context.Background()
+
+	_, _, _, err := NewSkillIndex(oldSrv.URL, cachePath, time.Hour).Load(ctx)
+	require.NoError(t, err)
+
+	// A fresh copy of the old catalog is not served for the new URL.
+	_, _, _, err = NewSkillIndex(newSrv.URL, cachePath, time.Hour).Load(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, newHits.Load())
+
+	// Nor is it the offline fallback for a different catalog.
+	_, _, _, err = NewSkillIndex(oldSrv.URL, cachePath, time.Hour).Load(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, oldHits.Load())
+	newDown.Store(true)
+	_, _, _, err = NewSkillIndex(newSrv.URL, cachePath, time.Hour).Load(ctx)
+	assert.ErrorContains(t, err, "HTTP 503")
+}
+
+func TestSkillInstaller_InstallFromURLSource(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/skills/sops/SKILL.md":
+			w.Write([]byte(skillFile("sops", "1.0.0", "age")))
+		case "/skills/age/SKILL.md":
+			w.Write([]byte(skillFile("age", "1.1.0")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	si := NewSkillInstaller(t.TempDir())
+	si.client = srv.Client()
+	installed, err := si.Install(context.Background(), srv.URL+"/skills/sops")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"age", "sops"}, installed)
+}
+
+func TestSkillInstaller_RefusesPlainHTTPSource(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(skillFile("sops", "1.0.0")))
+	}))
+	defer srv.Close()
+
+	si := NewSkillInstaller(t.TempDir())
+	_, err := si.Install(context.Background(), srv.URL+"/skills/sops")
+	assert.ErrorContains(t, err, "must use https")
+	assert.Zero(t, hits.Load())
+}
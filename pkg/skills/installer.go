@@ -2,17 +2,23 @@ package skills
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/freitascorp/devopsclaw/pkg/utils"
 )
 
 type SkillInstaller struct {
-	workspace string
+	workspace  string
+	rawBaseURL string // where SKILL.md files are fetched from; GitHub raw content by default
+	client     *http.Client
 }
 
 type AvailableSkill struct {
@@ -21,98 +27,205 @@ type AvailableSkill struct {
 	Description string   `json:"description"`
 	Author      string   `json:"author"`
 	Tags        []string `json:"tags"`
+	Version     string   `json:"version,omitempty"`
+
+	// Source is what `skills install <name>` installs from: an
+	// owner/repo/skill path on GitHub, or the URL of a directory holding
+	// SKILL.md. Repository is used when it is empty.
+	Source string `json:"source,omitempty"`
 }
 
 func NewSkillInstaller(workspace string) *SkillInstaller {
 	return &SkillInstaller{
-		workspace: workspace,
+		workspace:  workspace,
+		rawBaseURL: "https://raw.githubusercontent.com",
+		client:     &http.Client{Timeout: 15 * time.Second},
 	}
 }
 
+// InstallFromGitHub installs the skill at repo along with its dependencies.
+// See Install.
 func (si *SkillInstaller) InstallFromGitHub(ctx context.Context, repo string) error {
-	skillDir := filepath.Join(si.workspace, "skills", filepath.Base(repo))
-
-	if _, err := os.Stat(skillDir); err == nil {
-		return fmt.Errorf("skill '%s' already exists", filepath.Base(repo))
-	}
+	_, err := si.Install(ctx, repo)
+	return err
+}
 
-	url := fmt.Sprintf("https://raw.githubusercontent.com/%s/main/SKILL.md", repo)
+// pendingSkill is a fetched skill waiting to be written to the workspace.
+type pendingSkill struct {
+	name    string
+	content []byte
+}
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// Install installs the skill at repo (e.g. "freitascorp/devopsclaw-skills/
+// weather") and, first, every skill it transitively depends on that is not
+// already in the workspace. Each dependency's version constraint is checked
+// against the installed or fetched skill's declared version. Everything is
+// fetched and checked before anything is written, so a cycle or an
+// unsatisfied constraint installs nothing. It returns the names of the
+// skills installed, dependencies first and repo's skill last.
+func (si *SkillInstaller) Install(ctx context.Context, repo string) ([]string, error) {
+	name := filepath.Base(repo)
+	if err := utils.ValidateSkillIdentifier(name); err != nil {
+		return nil, fmt.Errorf("skill %q: %w", repo, err)
 	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch skill: %w", err)
+	if _, err := os.Stat(filepath.Join(si.workspace, "skills", name)); err == nil {
+		return nil, fmt.Errorf("skill '%s' already exists", name)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to fetch skill: HTTP %d", resp.StatusCode)
+	var plan []pendingSkill
+	if err := si.resolve(ctx, repo, nil, map[string]string{}, &plan); err != nil {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	var installed []string
+	for _, p := range plan {
+		skillDir := filepath.Join(si.workspace, "skills", p.name)
+		if err := os.MkdirAll(skillDir, 0o755); err != nil {
+			return installed, fmt.Errorf("failed to create skill directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(skillDir, "SKILL.md"), p.content, 0o644); err != nil {
+			return installed, fmt.Errorf("failed to write skill file: %w", err)
+		}
+		installed = append(installed, p.name)
 	}
+	return installed, nil
+}
 
-	if err := os.MkdirAll(skillDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create skill directory: %w", err)
-	}
+// resolve fetches repo and, depth first, its dependencies, appending each
+// to plan after its dependencies. stack holds the chain being resolved, to
+// report cycles; planned maps each planned skill to its fetched version.
+func (si *SkillInstaller) resolve(ctx context.Context, repo string, stack []string, planned map[string]string, plan *[]pendingSkill) error {
+	name := filepath.Base(repo)
+	stack = append(stack, name)
 
-	skillPath := filepath.Join(skillDir, "SKILL.md")
-	if err := os.WriteFile(skillPath, body, 0o644); err != nil {
-		return fmt.Errorf("failed to write skill file: %w", err)
+	content, err := si.fetchSkill(ctx, repo)
+	if err != nil {
+		if len(stack) > 1 {
+			return fmt.Errorf("dependency %s: %w", strings.Join(stack, " -> "), err)
+		}
+		return err
+	}
+	meta := (&SkillsLoader{}).parseSkillMetadata(string(content), name)
+
+	for _, spec := range meta.Dependencies {
+		dep, err := ParseDependency(spec)
+		if err != nil {
+			return fmt.Errorf("skill '%s': %w", name, err)
+		}
+		depName := dep.Name()
+		if err := utils.ValidateSkillIdentifier(depName); err != nil {
+			return fmt.Errorf("skill '%s': dependency %q: %w", name, dep.Source, err)
+		}
+		if slices.Contains(stack, depName) {
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(stack, " -> "), depName)
+		}
+
+		if version, ok := planned[depName]; ok {
+			if err := dep.SatisfiedBy(version); err != nil {
+				return fmt.Errorf("skill '%s': %w", name, err)
+			}
+			continue
+		}
+		if version, ok := si.installedVersion(depName); ok {
+			if err := dep.SatisfiedBy(version); err != nil {
+				return fmt.Errorf("skill '%s': installed %w", name, err)
+			}
+			continue
+		}
+
+		source := dep.Source
+		if !strings.Contains(source, "/") {
+			// A bare name lives next to the skill that depends on it.
+			source = siblingSource(repo, source)
+		}
+		if err := si.resolve(ctx, source, stack, planned, plan); err != nil {
+			return err
+		}
+		if err := dep.SatisfiedBy(planned[depName]); err != nil {
+			return fmt.Errorf("skill '%s': %w", name, err)
+		}
 	}
 
+	planned[name] = meta.Version
+	*plan = append(*plan, pendingSkill{name: name, content: content})
 	return nil
 }
 
-func (si *SkillInstaller) Uninstall(skillName string) error {
-	skillDir := filepath.Join(si.workspace, "skills", skillName)
-
-	if _, err := os.Stat(skillDir); os.IsNotExist(err) {
-		return fmt.Errorf("skill '%s' not found", skillName)
+// installedVersion reports whether the workspace has the named skill and
+// the version its SKILL.md declares.
+func (si *SkillInstaller) installedVersion(name string) (string, bool) {
+	content, err := os.ReadFile(filepath.Join(si.workspace, "skills", name, "SKILL.md"))
+	if err != nil {
+		return "", false
 	}
+	return (&SkillsLoader{}).parseSkillMetadata(string(content), name).Version, true
+}
 
-	if err := os.RemoveAll(skillDir); err != nil {
-		return fmt.Errorf("failed to remove skill: %w", err)
-	}
+// isURLSource reports whether repo is an https URL rather than an
+// owner/repo/skill path. Plain http sources are refused by fetchSkill.
+func isURLSource(repo string) bool {
+	return strings.HasPrefix(repo, "https://")
+}
 
-	return nil
+// siblingSource returns the source of the skill named name that sits next
+// to repo, for either form of source.
+func siblingSource(repo, name string) string {
+	if isURLSource(repo) {
+		base := strings.TrimSuffix(repo, "/")
+		return base[:strings.LastIndex(base, "/")+1] + name
+	}
+	return path.Join(path.Dir(repo), name)
 }
 
-func (si *SkillInstaller) ListAvailableSkills(ctx context.Context) ([]AvailableSkill, error) {
-	url := "https://raw.githubusercontent.com/freitascorp/devopsclaw-skills/main/skills.json"
+// fetchSkill downloads repo's SKILL.md.
+func (si *SkillInstaller) fetchSkill(ctx context.Context, repo string) ([]byte, error) {
+	if strings.HasPrefix(repo, "http://") {
+		return nil, fmt.Errorf("skill source %s must use https", repo)
+	}
+	url := fmt.Sprintf("%s/%s/main/SKILL.md", si.rawBaseURL, repo)
+	if isURLSource(repo) {
+		url = strings.TrimSuffix(repo, "/") + "/SKILL.md"
+	}
 
-	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := si.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch skills list: %w", err)
+		return nil, fmt.Errorf("failed to fetch skill: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to fetch skills list: HTTP %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to fetch skill: HTTP %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	return body, nil
+}
+
+func (si *SkillInstaller) Uninstall(skillName string) error {
+	skillDir := filepath.Join(si.workspace, "skills", skillName)
+
+	if _, err := os.Stat(skillDir); os.IsNotExist(err) {
+		return fmt.Errorf("skill '%s' not found", skillName)
+	}
 
-	var skills []AvailableSkill
-	if err := json.Unmarshal(body, &skills); err != nil {
-		return nil, fmt.Errorf("failed to parse skills list: %w", err)
+	if err := os.RemoveAll(skillDir); err != nil {
+		return fmt.Errorf("failed to remove skill: %w", err)
 	}
 
-	return skills, nil
+	return nil
+}
+
+// ListAvailableSkills downloads the default skill index, without caching.
+// See SkillIndex for a cached, configurable catalog.
+func (si *SkillInstaller) ListAvailableSkills(ctx context.Context) ([]AvailableSkill, error) {
+	skills, _, _, err := NewSkillIndex(DefaultIndexURL, "", 0).Load(ctx)
+	return skills, err
 }
@@ -0,0 +1,183 @@
+package skills
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestInstaller serves each SKILL.md in files, keyed by repo path, the
+// way GitHub raw content does.
+func newTestInstaller(t *testing.T, files map[string]string) *SkillInstaller {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/main/SKILL.md")
+		content, ok := files[repo]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	si := NewSkillInstaller(t.TempDir())
+	si.rawBaseURL = srv.URL
+	return si
+}
+
+func skillFile(name, version string, deps ...string) string {
+	var b strings.Builder
+	b.WriteString("---\nname: " + name + "\ndescription: The " + name + " skill\n")
+	if version != "" {
+		b.WriteString("version: " + version + "\n")
+	}
+	if len(deps) > 0 {
+		b.WriteString("dependencies:\n")
+		for _, d := range deps {
+			b.WriteString("  - " + d + "\n")
+		}
+	}
+	b.WriteString("---\n\n# " + name + "\n")
+	return b.String()
+}
+
+func TestSkillInstaller_InstallsDependencyChain(t *testing.T) {
+	si := newTestInstaller(t, map[string]string{
+		"acme/skills/deploy":  skillFile("deploy", "2.0.0", "helm >=1.2.0"),
+		"acme/skills/helm":    skillFile("helm", "1.3.0", "kubectl"),
+		"acme/skills/kubectl": skillFile("kubectl", "1.0.0"),
+	})
+
+	installed, err := si.Install(context.Background(), "acme/skills/deploy")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubectl", "helm", "deploy"}, installed)
+
+	for _, name := range installed {
+		assert.FileExists(t, filepath.Join(si.workspace, "skills", name, "SKILL.md"))
+	}
+
+	loader := NewSkillsLoader(si.workspace, "", "")
+	meta := loader.getSkillMetadata(filepath.Join(si.workspace, "skills", "deploy", "SKILL.md"))
+	assert.Equal(t, "2.0.0", meta.Version)
+	assert.Equal(t, []string{"helm >=1.2.0"}, meta.Dependencies)
+}
+
+func TestSkillInstaller_ReportsCycle(t *testing.T) {
+	si := newTestInstaller(t, map[string]string{
+		"acme/skills/a": skillFile("a", "", "b"),
+		"acme/skills/b": skillFile("b", "", "c"),
+		"acme/skills/c": skillFile("c", "", "a"),
+	})
+
+	installed, err := si.Install(context.Background(), "acme/skills/a")
+	require.Error(t, err)
+	assert.Equal(t, "dependency cycle: a -> b -> c -> a", err.Error())
+	assert.Empty(t, installed)
+
+	entries, _ := os.ReadDir(filepath.Join(si.workspace, "skills"))
+	assert.Empty(t, entries, "nothing should be installed when resolution fails")
+}
+
+func TestSkillInstaller_VersionConstraints(t *testing.T) {
+	files := map[string]string{
+		"acme/skills/deploy": skillFile("deploy", "", "helm >=1.2.0"),
+		"acme/skills/helm":   skillFile("helm", "1.1.9"),
+	}
+
+	si := newTestInstaller(t, files)
+	_, err := si.Install(context.Background(), "acme/skills/deploy")
+	assert.EqualError(t, err, "skill 'deploy': helm requires >=1.2.0, have 1.1.9")
+
+	// An installed dependency is checked, not reinstalled.
+	si = newTestInstaller(t, files)
+	helmDir := filepath.Join(si.workspace, "skills", "helm")
+	require.NoError(t, os.MkdirAll(helmDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(helmDir, "SKILL.md"), []byte(skillFile("helm", "v1.4")), 0o644))
+	installed, err := si.Install(context.Background(), "acme/skills/deploy")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deploy"}, installed)
+}
+
+func TestSkillInstaller_MissingDependency(t *testing.T) {
+	si := newTestInstaller(t, map[string]string{
+		"acme/skills/deploy": skillFile("deploy", "", "other/repo/helm"),
+	})
+	_, err := si.Install(context.Background(), "acme/skills/deploy")
+	assert.EqualError(t, err, "dependency deploy -> helm: failed to fetch skill: HTTP 404")
+}
+
+func TestSkillInstaller_RejectsTraversingDependency(t *testing.T) {
+	for _, dep := range []string{"..", "acme/..", "."} {
+		si := newTestInstaller(t, map[string]string{
+			"acme/skills/deploy": skillFile("deploy", "", dep),
+		})
+		_, err := si.Install(context.Background(), "acme/skills/deploy")
+		require.Error(t, err, dep)
+		assert.Contains(t, err.Error(), "directory traversal")
+
+		entries, _ := os.ReadDir(si.workspace)
+		assert.Empty(t, entries, "nothing should be written for %q", dep)
+	}
+}
+
+func TestParseDependency(t *testing.T) {
+	testcases := []struct {
+		spec string
+		want Dependency
+	}{
+		{"kubectl", Dependency{Source: "kubectl"}},
+		{"helm >=1.2.0", Dependency{Source: "helm", Op: ">=", Version: "1.2.0"}},
+		{"helm>1", Dependency{Source: "helm", Op: ">", Version: "1"}},
+		{"acme/skills/helm == v2.0", Dependency{Source: "acme/skills/helm", Op: "=", Version: "v2.0"}},
+	}
+	for _, tc := range testcases {
+		got, err := ParseDependency(tc.spec)
+		require.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.want, got, tc.spec)
+	}
+
+	for _, spec := range []string{"", ">=1.0", "helm >=one", "helm 1.0"} {
+		_, err := ParseDependency(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestDependency_SatisfiedBy(t *testing.T) {
+	testcases := []struct {
+		spec    string
+		version string
+		ok      bool
+	}{
+		{"helm", "", true},
+		{"helm >=1.2.0", "1.2.0", true},
+		{"helm >=1.2.0", "v1.10", true},
+		{"helm >=1.2.0", "1.1.9", false},
+		{"helm >=1.2.0", "1.2.0-rc1", true},
+		{"helm >=1.2.0", "", false},
+		{"helm <2", "1.9.9", true},
+		{"helm <2", "2.0.0", false},
+		{"helm =1.2", "1.2.0", true},
+	}
+	for _, tc := range testcases {
+		dep, err := ParseDependency(tc.spec)
+		require.NoError(t, err)
+		err = dep.SatisfiedBy(tc.version)
+		assert.Equal(t, tc.ok, err == nil, "%s with %q: %v", tc.spec, tc.version, err)
+	}
+}
+
+func TestParseDependencyList(t *testing.T) {
+	assert.Equal(t, []string{"kubectl", "helm >=1.2.0"},
+		parseDependencyList("name: x\ndependencies: [kubectl, \"helm >=1.2.0\"]\nversion: 1"))
+	assert.Equal(t, []string{"kubectl", "helm"},
+		parseDependencyList("dependencies:\r\n  - kubectl\r\n  - helm\r\nversion: 1"))
+	assert.Nil(t, parseDependencyList("name: x"))
+}
@@ -23,6 +23,11 @@ const (
 type SkillMetadata struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Version     string `json:"version,omitempty"`
+
+	// Dependencies are the skills this one needs, e.g. "kubectl" or
+	// "helm >=1.2.0"; see ParseDependency.
+	Dependencies []string `json:"dependencies,omitempty"`
 }
 
 type SkillInfo struct {
@@ -56,6 +61,7 @@ func (info SkillInfo) validate() error {
 type SkillsLoader struct {
 	workspace       string
 	workspaceSkills string // workspace skills (项目级别)
+	projectSkills   string // project skills (<repo>/.devopsclaw/skills)
 	globalSkills    string // 全局 skills (~/.devopsclaw/skills)
 	builtinSkills   string // 内置 skills
 }
@@ -69,112 +75,75 @@ func NewSkillsLoader(workspace string, globalSkills string, builtinSkills string
 	}
 }
 
+// SetProjectSkills adds a project-scoped skills directory, discovered from a
+// .devopsclaw/ folder above the working directory. Project skills override
+// global and builtin skills but are overridden by workspace skills.
+func (sl *SkillsLoader) SetProjectSkills(dir string) {
+	sl.projectSkills = dir
+}
+
+// skillSource is a skills directory and the label reported for its skills.
+type skillSource struct {
+	dir    string
+	source string
+}
+
+// sources returns the skill directories in precedence order (highest first).
+func (sl *SkillsLoader) sources() []skillSource {
+	return []skillSource{
+		{sl.workspaceSkills, "workspace"},
+		{sl.projectSkills, "project"},
+		{sl.globalSkills, "global"},
+		{sl.builtinSkills, "builtin"},
+	}
+}
+
 func (sl *SkillsLoader) ListSkills() []SkillInfo {
 	skills := make([]SkillInfo, 0)
 
-	if sl.workspaceSkills != "" {
-		if dirs, err := os.ReadDir(sl.workspaceSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.workspaceSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "workspace",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from workspace", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
-				}
-			}
+	for _, src := range sl.sources() {
+		if src.dir == "" {
+			continue
 		}
-	}
-
-	// 全局 skills (~/.devopsclaw/skills) - 被 workspace skills 覆盖
-	if sl.globalSkills != "" {
-		if dirs, err := os.ReadDir(sl.globalSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.globalSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						// 检查是否已被 workspace skills 覆盖
-						exists := false
-						for _, s := range skills {
-							if s.Name == dir.Name() && s.Source == "workspace" {
-								exists = true
-								break
-							}
-						}
-						if exists {
-							continue
-						}
-
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "global",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from global", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
+		dirs, err := os.ReadDir(src.dir)
+		if err != nil {
+			continue
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			skillFile := filepath.Join(src.dir, dir.Name(), "SKILL.md")
+			if _, err := os.Stat(skillFile); err != nil {
+				continue
+			}
+			// 检查是否已被更高优先级的 skills 覆盖
+			exists := false
+			for _, s := range skills {
+				if s.Name == dir.Name() {
+					exists = true
+					break
 				}
 			}
-		}
-	}
+			if exists {
+				continue
+			}
 
-	if sl.builtinSkills != "" {
-		if dirs, err := os.ReadDir(sl.builtinSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.builtinSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						// 检查是否已被 workspace 或 global skills 覆盖
-						exists := false
-						for _, s := range skills {
-							if s.Name == dir.Name() && (s.Source == "workspace" || s.Source == "global") {
-								exists = true
-								break
-							}
-						}
-						if exists {
-							continue
-						}
-
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "builtin",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from builtin", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
-				}
+			info := SkillInfo{
+				Name:   dir.Name(),
+				Path:   skillFile,
+				Source: src.source,
+			}
+			metadata := sl.getSkillMetadata(skillFile)
+			if metadata != nil {
+				info.Description = metadata.Description
+				info.Name = metadata.Name
 			}
+			if err := info.validate(); err != nil {
+				slog.Warn("invalid skill from "+src.source, "name", info.Name, "error", err)
+				continue
+			}
+			skills = append(skills, info)
 		}
 	}
 
@@ -182,25 +151,12 @@ func (sl *SkillsLoader) ListSkills() []SkillInfo {
 }
 
 func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
-	// 1. 优先从 workspace skills 加载（项目级别）
-	if sl.workspaceSkills != "" {
-		skillFile := filepath.Join(sl.workspaceSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
-		}
-	}
-
-	// 2. 其次从全局 skills 加载 (~/.devopsclaw/skills)
-	if sl.globalSkills != "" {
-		skillFile := filepath.Join(sl.globalSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+	// workspace → project → global (~/.devopsclaw/skills) → builtin
+	for _, src := range sl.sources() {
+		if src.dir == "" {
+			continue
 		}
-	}
-
-	// 3. 最后从内置 skills 加载
-	if sl.builtinSkills != "" {
-		skillFile := filepath.Join(sl.builtinSkills, name, "SKILL.md")
+		skillFile := filepath.Join(src.dir, name, "SKILL.md")
 		if content, err := os.ReadFile(skillFile); err == nil {
 			return sl.stripFrontmatter(string(content)), true
 		}
@@ -261,30 +217,32 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 		return nil
 	}
 
-	frontmatter := sl.extractFrontmatter(string(content))
+	return sl.parseSkillMetadata(string(content), filepath.Base(filepath.Dir(skillPath)))
+}
+
+// parseSkillMetadata reads the front matter of a SKILL.md. Without front
+// matter the skill is named fallbackName.
+func (sl *SkillsLoader) parseSkillMetadata(content, fallbackName string) *SkillMetadata {
+	frontmatter := sl.extractFrontmatter(content)
 	if frontmatter == "" {
 		return &SkillMetadata{
-			Name: filepath.Base(filepath.Dir(skillPath)),
+			Name: fallbackName,
 		}
 	}
 
 	// Try JSON first (for backward compatibility)
-	var jsonMeta struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-	}
+	var jsonMeta SkillMetadata
 	if err := json.Unmarshal([]byte(frontmatter), &jsonMeta); err == nil {
-		return &SkillMetadata{
-			Name:        jsonMeta.Name,
-			Description: jsonMeta.Description,
-		}
+		return &jsonMeta
 	}
 
 	// Fall back to simple YAML parsing
 	yamlMeta := sl.parseSimpleYAML(frontmatter)
 	return &SkillMetadata{
-		Name:        yamlMeta["name"],
-		Description: yamlMeta["description"],
+		Name:         yamlMeta["name"],
+		Description:  yamlMeta["description"],
+		Version:      yamlMeta["version"],
+		Dependencies: parseDependencyList(frontmatter),
 	}
 }
 
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
+)
+
+// ContractTool exposes a tool from a typed contracts.Registry to the agent.
+// Arguments are validated against the contract's request type, and the
+// typed response is returned to the LLM as JSON.
+type ContractTool struct {
+	registry *contracts.Registry
+	meta     contracts.ToolMeta
+}
+
+// NewContractTool wraps the tool called name in registry. It returns nil
+// if registry has no such tool.
+func NewContractTool(registry *contracts.Registry, name string) *ContractTool {
+	meta, ok := registry.GetTool(name)
+	if !ok {
+		return nil
+	}
+	return &ContractTool{registry: registry, meta: meta}
+}
+
+func (t *ContractTool) Name() string {
+	return t.meta.Name
+}
+
+func (t *ContractTool) Description() string {
+	return t.meta.Description
+}
+
+func (t *ContractTool) Parameters() map[string]any {
+	return t.meta.Parameters
+}
+
+func (t *ContractTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("encode %s arguments: %v", t.meta.Name, err)).WithError(err)
+	}
+	output, err := t.registry.ExecuteContext(ctx, t.meta.Name, input)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult(string(output))
+}
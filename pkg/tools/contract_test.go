@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/freitascorp/devopsclaw/pkg/contracts"
+)
+
+type echoRequest struct {
+	Text string `json:"text" validate:"required"`
+}
+
+type echoResponse struct {
+	Echo string `json:"echo"`
+}
+
+func newEchoRegistry() *contracts.Registry {
+	r := contracts.NewRegistry()
+	contracts.Register(r, contracts.ToolContract[echoRequest, echoResponse]{
+		ToolName: "echo",
+		Execute: func(req *echoRequest) (*echoResponse, error) {
+			return &echoResponse{Echo: req.Text}, nil
+		},
+	}, contracts.ToolMeta{Name: "echo", Description: "Echo text"})
+	return r
+}
+
+func TestContractTool(t *testing.T) {
+	tool := NewContractTool(newEchoRegistry(), "echo")
+	if tool == nil {
+		t.Fatal("NewContractTool returned nil for a registered tool")
+	}
+	if tool.Name() != "echo" || tool.Description() != "Echo text" {
+		t.Errorf("name/description = %q/%q", tool.Name(), tool.Description())
+	}
+	if req, _ := tool.Parameters()["required"].([]string); len(req) != 1 || req[0] != "text" {
+		t.Errorf("parameters = %v", tool.Parameters())
+	}
+
+	result := tool.Execute(context.Background(), map[string]any{"text": "hi"})
+	if result.IsError || result.ForLLM != `{"echo":"hi"}` {
+		t.Errorf("result = %+v", result)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{})
+	if !result.IsError || !strings.Contains(result.ForLLM, "validation failed") {
+		t.Errorf("missing argument result = %+v", result)
+	}
+}
+
+func TestNewContractTool_Unknown(t *testing.T) {
+	if tool := NewContractTool(newEchoRegistry(), "missing"); tool != nil {
+		t.Errorf("got %v, want nil", tool)
+	}
+}
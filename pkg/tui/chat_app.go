@@ -19,7 +19,9 @@
 package tui
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +30,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
 )
 
 // ─── Message types ─────────────────────────────────────────────────────
@@ -57,6 +60,15 @@ type UsageMsg struct{ Prompt, Completion, Total int }
 // ResponseDoneMsg signals the agent finished responding.
 type ResponseDoneMsg struct{}
 
+// AppendChatDeltaMsg adds streamed text to the assistant reply in
+// progress, starting a new reply if other messages came in between.
+type AppendChatDeltaMsg struct{ Delta string }
+
+// StreamDoneMsg ends a streamed reply and renders it in full. A non-empty
+// Content replaces the streamed text with the final response, or is added
+// as a new reply when nothing was streamed.
+type StreamDoneMsg struct{ Content string }
+
 // ConfirmRequestMsg asks the user for tool confirmation.
 type ConfirmRequestMsg struct {
 	ToolName string
@@ -73,12 +85,26 @@ const (
 	ConfirmAlwaysSession
 )
 
+// FleetStatusMsg updates the fleet connectivity indicator in the footer.
+// A non-nil Err renders as "fleet: disconnected".
+type FleetStatusMsg struct {
+	Summary *fleet.FleetSummary
+	Err     error
+}
+
 // SendPromptMsg is emitted when the user presses Enter.
 type SendPromptMsg struct{ Text string }
 
 // tickMsg drives the spinner animation.
 type spinTickMsg time.Time
 
+// streamRenderMsg re-renders a reply that is still streaming.
+type streamRenderMsg struct{}
+
+// streamRenderInterval spaces out markdown renders while a reply streams;
+// rendering every token would stall the UI on long replies.
+const streamRenderInterval = 120 * time.Millisecond
+
 // ─── Main model ────────────────────────────────────────────────────────
 
 // ChatApp is the Bubble Tea model for the agent chat interface.
@@ -95,6 +121,9 @@ type ChatApp struct {
 	input    textarea.Model
 	focused  bool
 
+	// Slash-command palette: selected entry while the input is a command prefix
+	paletteIdx int
+
 	// State
 	thinking      bool
 	spinnerFrame  int
@@ -110,9 +139,23 @@ type ChatApp struct {
 	confirmPreview string
 	confirmCb      func(ConfirmChoice)
 
+	// Streaming reply: index in messages of the assistant block receiving
+	// deltas (-1 = none), and whether a re-render is already scheduled
+	streamIdx     int
+	renderPending bool
+
 	// Tool detail view: false = collapsed (default), true = expanded
 	toolsExpanded bool
 
+	// Tool result display (expanded view)
+	maxOutputLines int  // lines shown per tool result; 0 = unlimited
+	stripANSI      bool // drop escape codes embedded in tool output
+
+	// Fleet connectivity (footer); nil fleetStatus hides the indicator
+	fleetPoll     FleetStatusFunc
+	fleetInterval time.Duration
+	fleetStatus   *FleetStatusMsg
+
 	// Rendering
 	md *glamour.TermRenderer
 
@@ -123,8 +166,44 @@ type ChatApp struct {
 	OnSend func(text string) // called when user submits input
 }
 
+// DefaultMaxOutputLines is how many lines of a tool result the expanded
+// view shows before truncating.
+const DefaultMaxOutputLines = 15
+
+// DefaultFleetStatusInterval is how often the footer refreshes fleet status.
+const DefaultFleetStatusInterval = 10 * time.Second
+
+// FleetStatusFunc fetches a fleet summary, e.g. NodeManager.Summary.
+type FleetStatusFunc func(ctx context.Context) (*fleet.FleetSummary, error)
+
+// ChatOption customizes a ChatApp.
+type ChatOption func(*ChatApp)
+
+// WithMaxOutputLines caps the lines shown per expanded tool result.
+// Zero or less shows the full output.
+func WithMaxOutputLines(n int) ChatOption {
+	return func(m *ChatApp) { m.maxOutputLines = n }
+}
+
+// WithStripANSI removes escape codes from tool output before rendering.
+func WithStripANSI(strip bool) ChatOption {
+	return func(m *ChatApp) { m.stripANSI = strip }
+}
+
+// WithFleetStatus shows fleet connectivity in the footer, polling poll every
+// interval (DefaultFleetStatusInterval if zero or less).
+func WithFleetStatus(poll FleetStatusFunc, interval time.Duration) ChatOption {
+	return func(m *ChatApp) {
+		if interval <= 0 {
+			interval = DefaultFleetStatusInterval
+		}
+		m.fleetPoll = poll
+		m.fleetInterval = interval
+	}
+}
+
 // NewChatApp creates a fully initialized chat TUI model.
-func NewChatApp(modelName string) ChatApp {
+func NewChatApp(modelName string, opts ...ChatOption) ChatApp {
 	// Textarea input — bottom-docked, like claudechic #input
 	ti := textarea.New()
 	ti.Placeholder = "Type a message · /help · ctrl-c to quit"
@@ -149,23 +228,42 @@ func NewChatApp(modelName string) ChatApp {
 		glamour.WithWordWrap(cw),
 	)
 
-	return ChatApp{
-		width:    80,
-		height:   24,
-		input:    ti,
-		focused:  true,
-		chatView: vp,
-		model:    modelName,
-		permMode: "default",
-		md:       md,
+	app := ChatApp{
+		width:          80,
+		height:         24,
+		input:          ti,
+		focused:        true,
+		chatView:       vp,
+		model:          modelName,
+		permMode:       "default",
+		md:             md,
+		maxOutputLines: DefaultMaxOutputLines,
+		streamIdx:      -1,
+	}
+	for _, opt := range opts {
+		opt(&app)
 	}
+	return app
 }
 
 func (m ChatApp) Init() tea.Cmd {
-	return tea.Batch(
+	cmds := []tea.Cmd{
 		textarea.Blink,
 		tickSpinner(),
-	)
+	}
+	if m.fleetPoll != nil {
+		cmds = append(cmds, m.fetchFleetStatus)
+	}
+	return tea.Batch(cmds...)
+}
+
+// fetchFleetStatus polls the fleet once. The timeout keeps a hung store
+// from stalling the indicator forever.
+func (m ChatApp) fetchFleetStatus() tea.Msg {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	summary, err := m.fleetPoll(ctx)
+	return FleetStatusMsg{Summary: summary, Err: err}
 }
 
 func tickSpinner() tea.Cmd {
@@ -212,6 +310,15 @@ func (m ChatApp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.contextPct = msg.Pct
 		return m, nil
 
+	case FleetStatusMsg:
+		m.fleetStatus = &msg
+		if m.fleetPoll == nil {
+			return m, nil
+		}
+		return m, tea.Tick(m.fleetInterval, func(time.Time) tea.Msg {
+			return m.fetchFleetStatus()
+		})
+
 	case UsageMsg:
 		usage := ChatMsg{
 			Role:    "system",
@@ -226,6 +333,41 @@ func (m ChatApp) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.thinking = false
 		return m, nil
 
+	case AppendChatDeltaMsg:
+		if m.streamIdx < 0 || m.streamIdx != len(m.messages)-1 {
+			m.messages = append(m.messages, ChatMsg{Role: "assistant", Time: time.Now()})
+			m.streamIdx = len(m.messages) - 1
+		}
+		m.messages[m.streamIdx].Content += msg.Delta
+		if m.renderPending {
+			return m, nil
+		}
+		m.renderPending = true
+		return m, tea.Tick(streamRenderInterval, func(time.Time) tea.Msg {
+			return streamRenderMsg{}
+		})
+
+	case streamRenderMsg:
+		m.renderPending = false
+		m = m.rebuildChatContent()
+		return m, nil
+
+	case StreamDoneMsg:
+		m.thinking = false
+		switch {
+		case m.streamIdx >= 0 && msg.Content != "":
+			m.messages[m.streamIdx].Content = msg.Content
+		case m.streamIdx < 0 && msg.Content != "":
+			m.messages = append(m.messages, ChatMsg{
+				Role:    "assistant",
+				Content: msg.Content,
+				Time:    time.Now(),
+			})
+		}
+		m.streamIdx = -1
+		m = m.rebuildChatContent()
+		return m, nil
+
 	case ConfirmRequestMsg:
 		m.confirmActive = true
 		m.confirmIdx = ConfirmOptYes // start on "Yes"
@@ -301,8 +443,17 @@ func (m ChatApp) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if text == "" {
 			return m, nil
 		}
+		// A partly typed command completes to the palette selection first
+		if matches := m.paletteMatches(); len(matches) > 0 && !isSlashCommand(text) {
+			return m.completePalette(matches), nil
+		}
 		m.input.Reset()
 		m.input.SetHeight(1)
+		m.paletteIdx = 0
+		// TUI commands are handled here; the agent's go through as typed
+		if next, cmd, ok := m.handleSlashCommand(text); ok {
+			return next, cmd
+		}
 		// Add user message
 		m.messages = append(m.messages, ChatMsg{
 			Role:    "user",
@@ -310,13 +461,23 @@ func (m ChatApp) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			Time:    time.Now(),
 		})
 		m = m.rebuildChatContent()
-		// Send to prompt channel (for agent loop consumer)
-		if m.promptCh != nil {
-			m.promptCh <- text
+		if _, _, isCmd := parseSlashCommand(text); m.permMode == "plan" && !isCmd {
+			text = planPreamble + text
+		}
+		m.send(text)
+		return m, nil
+
+	case "up", "down":
+		matches := m.paletteMatches()
+		if len(matches) == 0 {
+			var cmd tea.Cmd
+			m.input, cmd = m.input.Update(msg)
+			return m, cmd
 		}
-		// Notify callback (if set)
-		if m.OnSend != nil {
-			go m.OnSend(text)
+		if key == "up" {
+			m.paletteIdx = (m.paletteIdx + len(matches) - 1) % len(matches)
+		} else {
+			m.paletteIdx = (m.paletteIdx + 1) % len(matches)
 		}
 		return m, nil
 
@@ -329,6 +490,9 @@ func (m ChatApp) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case "tab":
+		if matches := m.paletteMatches(); len(matches) > 0 {
+			return m.completePalette(matches), nil
+		}
 		// Toggle tool/step detail blocks expanded/collapsed
 		m.toolsExpanded = !m.toolsExpanded
 		m = m.rebuildChatContent()
@@ -340,6 +504,7 @@ func (m ChatApp) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		// Grow textarea up to 10 lines
 		var cmd tea.Cmd
 		m.input, cmd = m.input.Update(msg)
+		m.paletteIdx = 0
 		lines := strings.Count(m.input.Value(), "\n") + 1
 		if lines > 10 {
 			lines = 10
@@ -352,6 +517,67 @@ func (m ChatApp) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// handleDisplayCommand applies TUI-local slash commands:
+//
+//	/strip-ansi [on|off]     toggle stripping escape codes from tool output
+//	/max-output-lines <n>    lines per expanded tool result (0 = unlimited)
+//
+// It reports false for anything else so the text goes to the agent.
+func (m ChatApp) handleDisplayCommand(text string) (ChatApp, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return m, false
+	}
+
+	var notice string
+	switch fields[0] {
+	case "/strip-ansi":
+		switch {
+		case len(fields) == 1:
+			m.stripANSI = !m.stripANSI
+		case fields[1] == "on":
+			m.stripANSI = true
+		case fields[1] == "off":
+			m.stripANSI = false
+		default:
+			notice = "usage: /strip-ansi [on|off]"
+		}
+		if notice == "" {
+			notice = "ANSI stripping off for tool output"
+			if m.stripANSI {
+				notice = "ANSI stripping on for tool output"
+			}
+		}
+
+	case "/max-output-lines":
+		n := -1
+		if len(fields) == 2 {
+			if v, err := strconv.Atoi(fields[1]); err == nil {
+				n = v
+			}
+		}
+		if n < 0 {
+			notice = "usage: /max-output-lines <n>  (0 = unlimited)"
+			break
+		}
+		m.maxOutputLines = n
+		notice = fmt.Sprintf("Tool output capped at %d lines", n)
+		if n == 0 {
+			notice = "Tool output shown in full"
+		}
+
+	default:
+		return m, false
+	}
+
+	m.messages = append(m.messages, ChatMsg{
+		Role:    "system-warn",
+		Content: notice,
+		Time:    time.Now(),
+	})
+	return m.rebuildChatContent(), true
+}
+
 // ─── View ──────────────────────────────────────────────────────────────
 
 func (m ChatApp) View() string {
@@ -364,8 +590,12 @@ func (m ChatApp) View() string {
 	// Build sections top-to-bottom
 	var sections []string
 
-	// 1. Chat viewport
-	sections = append(sections, m.chatView.View())
+	// 1. Chat viewport, with the slash-command palette over its bottom
+	chat := m.chatView.View()
+	if palette := m.renderPalette(contentW); palette != "" {
+		chat = overlayBottom(chat, palette)
+	}
+	sections = append(sections, chat)
 
 	// 2. Thinking indicator (1 line, above input)
 	thinkLine := m.renderThinking(contentW)
@@ -529,8 +759,12 @@ func (m ChatApp) renderToolMessage(msg ChatMsg, w int) string {
 			return ToolBlockStyle.Width(w + 2).Render(
 				icon + " " + MutedText.Render(resultTag))
 		}
-		// Expanded: full output (same as before)
-		text := TruncateOutput(msg.Content, 15)
+		// Expanded: full output, capped at maxOutputLines
+		text := msg.Content
+		if m.stripANSI {
+			text = StripANSI(text)
+		}
+		text = TruncateOutput(text, m.maxOutputLines)
 		var inner strings.Builder
 		inner.WriteString(PanelText.Render("───") + "\n")
 		inner.WriteString(NormalText.Width(w).Render(Linkify(text)))
@@ -613,6 +847,9 @@ func (m ChatApp) renderFooter() string {
 	contextBar := RenderCtxBar(m.contextPct)
 
 	left := fmt.Sprintf(" %s %s %s %s %s %s %s", brand, sep, modelLabel, sep, permRendered, sep, detailRendered)
+	if fleetLabel := m.renderFleetStatus(); fleetLabel != "" {
+		left += fmt.Sprintf(" %s %s", sep, fleetLabel)
+	}
 	right := fmt.Sprintf("%s ", contextBar)
 
 	gap := w - lipgloss.Width(left) - lipgloss.Width(right)
@@ -625,6 +862,23 @@ func (m ChatApp) renderFooter() string {
 	)
 }
 
+// renderFleetStatus returns the footer's fleet indicator, or "" when no
+// status has been received.
+func (m ChatApp) renderFleetStatus() string {
+	st := m.fleetStatus
+	if st == nil {
+		return ""
+	}
+	if st.Err != nil || st.Summary == nil {
+		return lipgloss.NewStyle().Foreground(ColorError).Render("fleet: disconnected")
+	}
+	style := lipgloss.NewStyle().Foreground(ColorSecondary)
+	if st.Summary.Online < st.Summary.TotalNodes {
+		style = lipgloss.NewStyle().Foreground(ColorWarn)
+	}
+	return style.Render(fmt.Sprintf("fleet: %d online", st.Summary.Online))
+}
+
 // ─── Context bar ───────────────────────────────────────────────────────
 // Mirrors claudechic ContextBar indicator
 
@@ -640,9 +894,9 @@ func (m ChatApp) renderFooter() string {
 // RunChatApp starts the full-screen Bubble Tea chat TUI.
 // Returns the tea.Program for sending messages, and a channel
 // that emits user-submitted prompts.
-func RunChatApp(modelName string) (*tea.Program, <-chan string) {
+func RunChatApp(modelName string, opts ...ChatOption) (*tea.Program, <-chan string) {
 	promptCh := make(chan string, 10)
-	app := NewChatApp(modelName)
+	app := NewChatApp(modelName, opts...)
 	app.promptCh = promptCh
 	// Mouse tracking is disabled — SGR escape sequences leak into the textarea
 	// as garbled text on fast scrolling. Use PgUp/PgDn for chat viewport scroll.
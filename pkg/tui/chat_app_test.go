@@ -0,0 +1,246 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+func numberedLines(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestTruncateOutput_Limits(t *testing.T) {
+	output := numberedLines(20)
+
+	tests := []struct {
+		maxLines  int
+		wantLast  string
+		wantMore  string
+		truncated bool
+	}{
+		{maxLines: 5, wantLast: "line 5", wantMore: "… 15 more lines", truncated: true},
+		{maxLines: 15, wantLast: "line 15", wantMore: "… 5 more lines", truncated: true},
+		{maxLines: 20, wantLast: "line 20"},
+		{maxLines: 50, wantLast: "line 20"},
+		{maxLines: 0, wantLast: "line 20"}, // unlimited
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxLines), func(t *testing.T) {
+			got := TruncateOutput(output, tt.maxLines)
+			if !tt.truncated {
+				if got != output {
+					t.Errorf("output should be unchanged, got:\n%s", got)
+				}
+				return
+			}
+			lines := strings.Split(got, "\n")
+			if len(lines) != tt.maxLines+1 {
+				t.Fatalf("got %d lines, want %d plus a marker", len(lines), tt.maxLines)
+			}
+			if lines[tt.maxLines-1] != tt.wantLast {
+				t.Errorf("last kept line = %q, want %q", lines[tt.maxLines-1], tt.wantLast)
+			}
+			if !strings.Contains(lines[tt.maxLines], tt.wantMore) {
+				t.Errorf("marker = %q, want %q", lines[tt.maxLines], tt.wantMore)
+			}
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"sgr colors", "\x1b[1;31merror\x1b[0m: disk \x1b[38;2;204;119;0mfull\x1b[m", "error: disk full"},
+		{"cursor movement", "50%\x1b[2K\x1b[1G100%", "50%100%"},
+		{"osc hyperlink", "\x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\", "docs"},
+		{"osc title with bel", "\x1b]0;build\x07done", "done"},
+		{"private mode", "\x1b[?25lhidden cursor\x1b[?25h", "hidden cursor"},
+		{"plain text", "no escapes here", "no escapes here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripANSI(tt.in); got != tt.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatApp_DisplayCommands(t *testing.T) {
+	m := NewChatApp("test-model")
+	if m.maxOutputLines != DefaultMaxOutputLines || m.stripANSI {
+		t.Fatalf("defaults = %d lines, strip %v", m.maxOutputLines, m.stripANSI)
+	}
+
+	m, ok := m.handleDisplayCommand("/strip-ansi")
+	if !ok || !m.stripANSI {
+		t.Errorf("/strip-ansi should toggle on, got handled=%v strip=%v", ok, m.stripANSI)
+	}
+	m, _ = m.handleDisplayCommand("/strip-ansi off")
+	if m.stripANSI {
+		t.Error("/strip-ansi off should disable stripping")
+	}
+
+	m, ok = m.handleDisplayCommand("/max-output-lines 40")
+	if !ok || m.maxOutputLines != 40 {
+		t.Errorf("/max-output-lines 40 = handled %v, %d lines", ok, m.maxOutputLines)
+	}
+	m, _ = m.handleDisplayCommand("/max-output-lines lots")
+	if m.maxOutputLines != 40 {
+		t.Errorf("invalid value should leave the limit unchanged, got %d", m.maxOutputLines)
+	}
+
+	if _, ok := m.handleDisplayCommand("/show model"); ok {
+		t.Error("agent commands should not be handled by the TUI")
+	}
+}
+
+func TestChatApp_RenderToolMessage_Options(t *testing.T) {
+	colored := "\x1b[32mok\x1b[0m step 1\n" + numberedLines(9)
+	msg := ChatMsg{Role: "tool", Content: colored}
+
+	m := NewChatApp("test-model", WithMaxOutputLines(3), WithStripANSI(true))
+	m.toolsExpanded = true
+
+	out := m.renderToolMessage(msg, 80)
+	if strings.Contains(out, "\x1b[32m") {
+		t.Errorf("tool output colors should be stripped:\n%q", out)
+	}
+	if !strings.Contains(out, "… 7 more lines") {
+		t.Errorf("output should be capped at 3 lines:\n%s", out)
+	}
+
+	// Re-render after the user lifts the cap.
+	m, _ = m.handleDisplayCommand("/max-output-lines 0")
+	out = m.renderToolMessage(msg, 80)
+	if strings.Contains(out, "more lines") || !strings.Contains(out, "line 9") {
+		t.Errorf("output should be shown in full:\n%s", out)
+	}
+}
+
+func TestChatApp_FooterFleetStatus(t *testing.T) {
+	m := NewChatApp("test-model")
+	m.width = 160
+	if footer := m.renderFooter(); strings.Contains(footer, "fleet:") {
+		t.Errorf("footer should omit fleet status when none is configured:\n%s", footer)
+	}
+
+	next, _ := m.Update(FleetStatusMsg{Summary: &fleet.FleetSummary{TotalNodes: 14, Online: 12}})
+	m = next.(ChatApp)
+	if footer := m.renderFooter(); !strings.Contains(footer, "fleet: 12 online") {
+		t.Errorf("footer should show online count:\n%s", footer)
+	}
+
+	next, _ = m.Update(FleetStatusMsg{Err: errors.New("relay unreachable")})
+	m = next.(ChatApp)
+	if footer := m.renderFooter(); !strings.Contains(footer, "fleet: disconnected") {
+		t.Errorf("footer should show disconnected on error:\n%s", footer)
+	}
+}
+
+func TestChatApp_FleetStatusPolling(t *testing.T) {
+	polls := 0
+	poll := func(context.Context) (*fleet.FleetSummary, error) {
+		polls++
+		return &fleet.FleetSummary{TotalNodes: 3, Online: 3}, nil
+	}
+	m := NewChatApp("test-model", WithFleetStatus(poll, time.Millisecond))
+
+	msg := m.fetchFleetStatus()
+	if polls != 1 {
+		t.Fatalf("polls = %d, want 1", polls)
+	}
+	next, cmd := m.Update(msg)
+	if cmd == nil {
+		t.Fatal("a fleet status update should schedule the next poll")
+	}
+	if _, ok := cmd().(FleetStatusMsg); !ok || polls != 2 {
+		t.Errorf("scheduled command should poll again, polls = %d", polls)
+	}
+	if !strings.Contains(next.(ChatApp).renderFooter(), "fleet: 3 online") {
+		t.Errorf("footer missing fleet status:\n%s", next.(ChatApp).renderFooter())
+	}
+}
+
+func TestChatApp_StreamDeltas(t *testing.T) {
+	m := NewChatApp("test-model")
+	m.thinking = true
+
+	var scheduled int
+	for _, delta := range []string{"Disk ", "usage ", "is **42%**"} {
+		next, cmd := m.Update(AppendChatDeltaMsg{Delta: delta})
+		m = next.(ChatApp)
+		if cmd != nil {
+			scheduled++
+		}
+	}
+	if scheduled != 1 {
+		t.Errorf("scheduled %d re-renders for one burst of deltas, want 1", scheduled)
+	}
+	if len(m.messages) != 1 || m.messages[0].Role != "assistant" {
+		t.Fatalf("messages = %+v, want one assistant reply", m.messages)
+	}
+	if got := m.messages[0].Content; got != "Disk usage is **42%**" {
+		t.Errorf("streamed content = %q", got)
+	}
+
+	next, _ := m.Update(streamRenderMsg{})
+	m = next.(ChatApp)
+	if m.renderPending {
+		t.Error("the scheduled render should clear renderPending")
+	}
+
+	next, _ = m.Update(StreamDoneMsg{Content: "Disk usage is **42%**"})
+	m = next.(ChatApp)
+	if len(m.messages) != 1 || m.thinking || m.streamIdx != -1 {
+		t.Errorf("after done: %d messages, thinking %v, streamIdx %d", len(m.messages), m.thinking, m.streamIdx)
+	}
+	if !strings.Contains(m.chatView.View(), "42%") {
+		t.Errorf("final render missing the reply:\n%s", m.chatView.View())
+	}
+}
+
+func TestChatApp_StreamAfterToolCall(t *testing.T) {
+	m := NewChatApp("test-model")
+	for _, msg := range []tea.Msg{
+		AppendChatDeltaMsg{Delta: "Checking disk."},
+		AppendChatMsg{Msg: ChatMsg{Role: "tool", ToolName: "exec"}},
+		AppendChatDeltaMsg{Delta: "Disk "},
+		AppendChatDeltaMsg{Delta: "is fine."},
+		UsageMsg{Prompt: 10, Completion: 5, Total: 15},
+		StreamDoneMsg{Content: "Disk is fine."},
+	} {
+		next, _ := m.Update(msg)
+		m = next.(ChatApp)
+	}
+
+	var replies []string
+	for _, msg := range m.messages {
+		if msg.Role == "assistant" {
+			replies = append(replies, msg.Content)
+		}
+	}
+	if strings.Join(replies, "|") != "Checking disk.|Disk is fine." {
+		t.Errorf("assistant replies = %q", replies)
+	}
+
+	// Without streaming, the final response is added as a reply.
+	next, _ := m.Update(StreamDoneMsg{Content: "Nothing streamed."})
+	m = next.(ChatApp)
+	if last := m.messages[len(m.messages)-1]; last.Role != "assistant" || last.Content != "Nothing streamed." {
+		t.Errorf("last message = %+v", last)
+	}
+}
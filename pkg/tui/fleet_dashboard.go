@@ -7,7 +7,9 @@ package tui
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -82,6 +84,14 @@ var (
 type tickMsg time.Time
 type nodesMsg []*fleet.Node
 type summaryMsg *fleet.FleetSummary
+type nodeEventMsg fleet.NodeEvent
+
+// historyMsg carries a node's recent executions for the detail view.
+type historyMsg struct {
+	node  fleet.NodeID
+	execs []fleet.NodeExecution
+	err   error
+}
 
 // ------------------------------------------------------------------
 // Model
@@ -93,10 +103,16 @@ type FleetDashboard struct {
 	nodeMgr *fleet.NodeManager
 	nodes   []*fleet.Node
 	summary *fleet.FleetSummary
+	events  <-chan fleet.NodeEvent // from Store.Watch; nil to only poll
 	err     error
 	width   int
 	height  int
 	quitting bool
+
+	selected int          // index into nodes of the highlighted row
+	detail   fleet.NodeID // node shown in the detail view; "" shows the list
+	history  []fleet.NodeExecution
+	histErr  error
 }
 
 // NewFleetDashboard creates a new fleet dashboard TUI model.
@@ -114,6 +130,7 @@ func (m FleetDashboard) Init() tea.Cmd {
 		m.fetchNodes,
 		m.fetchSummary,
 		tickCmd(),
+		m.waitForNodeEvent,
 	)
 }
 
@@ -121,12 +138,37 @@ func (m FleetDashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "q", "ctrl+c", "esc":
+		case "q", "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		case "esc":
+			if m.detail != "" {
+				m.detail = ""
+				m.history, m.histErr = nil, nil
+				return m, nil
+			}
 			m.quitting = true
 			return m, tea.Quit
+		case "up", "k":
+			if m.detail == "" && m.selected > 0 {
+				m.selected--
+			}
+			return m, nil
+		case "down", "j":
+			if m.detail == "" && m.selected < len(m.nodes)-1 {
+				m.selected++
+			}
+			return m, nil
+		case "enter":
+			if m.detail == "" && m.selected < len(m.nodes) {
+				m.detail = m.nodes[m.selected].ID
+				m.history, m.histErr = nil, nil
+				return m, m.fetchHistory
+			}
+			return m, nil
 		case "r":
 			// Manual refresh
-			return m, tea.Batch(m.fetchNodes, m.fetchSummary)
+			return m, tea.Batch(m.fetchNodes, m.fetchSummary, m.refreshHistory())
 		}
 
 	case tea.WindowSizeMsg:
@@ -135,10 +177,36 @@ func (m FleetDashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tickMsg:
-		return m, tea.Batch(m.fetchNodes, m.fetchSummary, tickCmd())
+		return m, tea.Batch(m.fetchNodes, m.fetchSummary, m.refreshHistory(), tickCmd())
+
+	case nodeEventMsg:
+		// Refresh right away instead of waiting for the next tick.
+		return m, tea.Batch(m.fetchNodes, m.fetchSummary, m.refreshHistory(), m.waitForNodeEvent)
 
 	case nodesMsg:
+		// Keep the selection on the same node across refreshes; the store
+		// lists nodes in no particular order.
+		var selectedID fleet.NodeID
+		if m.selected < len(m.nodes) {
+			selectedID = m.nodes[m.selected].ID
+		}
 		m.nodes = []*fleet.Node(msg)
+		sort.Slice(m.nodes, func(i, j int) bool { return m.nodes[i].ID < m.nodes[j].ID })
+		for i, n := range m.nodes {
+			if n.ID == selectedID {
+				m.selected = i
+			}
+		}
+		if m.selected >= len(m.nodes) {
+			m.selected = max(len(m.nodes)-1, 0)
+		}
+		return m, nil
+
+	case historyMsg:
+		// Drop answers for a node the user has already left.
+		if msg.node == m.detail {
+			m.history, m.histErr = msg.execs, msg.err
+		}
 		return m, nil
 
 	case summaryMsg:
@@ -160,6 +228,14 @@ func (m FleetDashboard) View() string {
 	b.WriteString(dTitleStyle.Render(BrandFull + " Fleet Dashboard"))
 	b.WriteString("\n")
 
+	if m.detail != "" {
+		b.WriteString(m.renderDetail())
+		b.WriteString("\n")
+		b.WriteString(dFooterStyle.Render(fmt.Sprintf("  [esc] back  [r] refresh  [q] quit  │  Updated: %s",
+			time.Now().Format("15:04:05"))))
+		return b.String()
+	}
+
 	// Summary bar – left-border block (claudechic style)
 	if m.summary != nil {
 		summaryLine := fmt.Sprintf(
@@ -181,27 +257,34 @@ func (m FleetDashboard) View() string {
 		b.WriteString("\n")
 	} else {
 		// Header
-		header := fmt.Sprintf("%-20s %-14s %-30s %s",
+		header := fmt.Sprintf("  %-20s %-14s %-30s %-34s %s",
 			dHeaderStyle.Render("NODE"),
 			dHeaderStyle.Render("STATUS"),
 			dHeaderStyle.Render("LABELS"),
+			dHeaderStyle.Render("USAGE"),
 			dHeaderStyle.Render("LAST SEEN"),
 		)
 		b.WriteString(header)
 		b.WriteString("\n")
-		b.WriteString(PanelText.Render(strings.Repeat("─", clampInt(m.width, 85))))
+		b.WriteString(PanelText.Render(strings.Repeat("─", clampInt(m.width, 120))))
 		b.WriteString("\n")
 
 		// Rows
-		for _, n := range m.nodes {
+		for i, n := range m.nodes {
+			cursor := "  "
+			if i == m.selected {
+				cursor = PrimaryText.Render("❯ ")
+			}
 			statusStr := renderStatus(n.Status)
 			labels := formatLabelsShort(n.Labels, 28)
 			lastSeen := renderLastSeen(n.LastSeen)
 
-			row := fmt.Sprintf("%-20s %-14s %-30s %s",
+			row := fmt.Sprintf("%s%-20s %-14s %-30s %-34s %s",
+				cursor,
 				dCellStyle.Render(string(n.ID)),
 				statusStr,
 				dCellStyle.Render(labels),
+				dCellStyle.Render(n.Resources.UtilizationSummary()),
 				dCellStyle.Render(lastSeen),
 			)
 			b.WriteString(row)
@@ -211,16 +294,135 @@ func (m FleetDashboard) View() string {
 
 	// Footer
 	b.WriteString("\n")
-	b.WriteString(dFooterStyle.Render(fmt.Sprintf("  [r] refresh  [q] quit  │  Updated: %s",
+	b.WriteString(dFooterStyle.Render(fmt.Sprintf("  [↑/↓] select  [enter] details  [r] refresh  [q] quit  │  Updated: %s",
 		time.Now().Format("15:04:05"))))
 
 	return b.String()
 }
 
+// renderDetail shows the node open in the detail view: its labels,
+// capabilities, resource gauges and recent executions.
+func (m FleetDashboard) renderDetail() string {
+	var n *fleet.Node
+	for _, candidate := range m.nodes {
+		if candidate.ID == m.detail {
+			n = candidate
+		}
+	}
+	if n == nil {
+		return dFooterStyle.Render(fmt.Sprintf("  Node %s is no longer registered.", m.detail)) + "\n"
+	}
+
+	var b strings.Builder
+	b.WriteString(PrimaryText.Render(string(n.ID)) + "  " + renderStatus(n.Status) + "\n\n")
+
+	groups := make([]string, len(n.Groups))
+	for i, g := range n.Groups {
+		groups[i] = string(g)
+	}
+	info := []string{
+		fmt.Sprintf("Hostname:     %s", orDash(n.Hostname)),
+		fmt.Sprintf("Address:      %s", orDash(n.Address)),
+		fmt.Sprintf("Labels:       %s", formatLabelsShort(n.Labels, 200)),
+		fmt.Sprintf("Groups:       %s", orDash(strings.Join(groups, ", "))),
+		fmt.Sprintf("Capabilities: %s", orDash(strings.Join(n.Capabilities, ", "))),
+		fmt.Sprintf("Version:      %s", orDash(n.Version)),
+		fmt.Sprintf("Last seen:    %s", renderLastSeen(n.LastSeen)),
+	}
+	b.WriteString(dBoxStyle.Render(strings.Join(info, "\n")))
+	b.WriteString("\n\n")
+
+	b.WriteString(dHeaderStyle.Render("RESOURCES"))
+	b.WriteString("\n")
+	b.WriteString(dBoxStyle.Render(renderGauges(n.Resources)))
+	b.WriteString("\n\n")
+
+	b.WriteString(dHeaderStyle.Render(fmt.Sprintf("RECENT EXECUTIONS (last %d)", fleet.DefaultNodeHistory)))
+	b.WriteString("\n")
+	switch {
+	case m.histErr != nil:
+		b.WriteString(dOfflineStyle.Render("  Could not load history: " + m.histErr.Error()))
+		b.WriteString("\n")
+	case len(m.history) == 0:
+		b.WriteString(dFooterStyle.Render("  No executions recorded for this node."))
+		b.WriteString("\n")
+	default:
+		for _, ne := range m.history {
+			b.WriteString(renderNodeExecution(ne))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// renderGauges draws load, memory and disk bars for r, or notes that the
+// node has not reported usage.
+func renderGauges(r fleet.NodeResources) string {
+	lines := []string{fmt.Sprintf("%d cores · %d MB memory · %d MB disk · %s/%s",
+		r.CPUCores, r.MemoryMB, r.DiskMB, orDash(r.OS), orDash(r.Arch))}
+	if !r.HasUtilization() {
+		return strings.Join(append(lines, MutedText.Render("no usage reported")), "\n")
+	}
+	if r.CPUCores > 0 {
+		lines = append(lines, fmt.Sprintf("load %s %.2f", RenderCtxBar(r.Load1/float64(r.CPUCores)), r.Load1))
+	}
+	if r.MemoryMB > 0 {
+		lines = append(lines, fmt.Sprintf("mem  %s %d/%d MB",
+			RenderCtxBar(float64(r.MemoryUsedMB)/float64(r.MemoryMB)), r.MemoryUsedMB, r.MemoryMB))
+	}
+	if r.DiskMB > 0 {
+		used := r.DiskMB - r.DiskFreeMB
+		lines = append(lines, fmt.Sprintf("disk %s %d/%d MB",
+			RenderCtxBar(float64(used)/float64(r.DiskMB)), used, r.DiskMB))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderNodeExecution formats one row of a node's execution history.
+func renderNodeExecution(ne fleet.NodeExecution) string {
+	res := ne.Result
+	when := res.StartedAt
+	if when.IsZero() && ne.Request != nil {
+		when = ne.Request.CreatedAt
+	}
+	var id, command string
+	if ne.Request != nil {
+		id = ne.Request.ID
+		command = ne.Request.Command.Type
+		var sc fleet.ShellCommand
+		if command == "shell" && json.Unmarshal(ne.Request.Command.Data, &sc) == nil {
+			command = sc.Command
+		}
+	}
+	status := dOnlineStyle.Render("✓ " + res.Status)
+	if res.Status != "success" {
+		status = dOfflineStyle.Render("✗ " + res.Status)
+	}
+	line := fmt.Sprintf("  %s  %-12s %-16s exit %-3d %-8s %s",
+		when.Local().Format("01-02 15:04:05"),
+		TruncStr(id, 12),
+		status,
+		res.ExitCode,
+		res.Duration.Round(time.Millisecond),
+		TruncStr(strings.SplitN(command, "\n", 2)[0], 40),
+	)
+	if res.Error != "" {
+		line += "\n" + dOfflineStyle.Render("      "+TruncStr(res.Error, 80))
+	}
+	return line
+}
+
 // ------------------------------------------------------------------
 // Helpers
 // ------------------------------------------------------------------
 
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func renderStatus(status fleet.NodeStatus) string {
 	switch status {
 	case fleet.NodeStatusOnline:
@@ -266,6 +468,7 @@ func formatLabelsShort(labels map[string]string, maxLen int) string {
 	for k, v := range labels {
 		parts = append(parts, k+"="+v)
 	}
+	sort.Strings(parts) // stable across refreshes
 	s := strings.Join(parts, ",")
 	if len(s) > maxLen {
 		return s[:maxLen-1] + "…"
@@ -279,6 +482,19 @@ func tickCmd() tea.Cmd {
 	})
 }
 
+// waitForNodeEvent blocks for the next node event. It returns nil, ending
+// the wait, when the dashboard is not watching or the stream has closed.
+func (m FleetDashboard) waitForNodeEvent() tea.Msg {
+	if m.events == nil {
+		return nil
+	}
+	ev, ok := <-m.events
+	if !ok {
+		return nil
+	}
+	return nodeEventMsg(ev)
+}
+
 func (m FleetDashboard) fetchNodes() tea.Msg {
 	nodes, err := m.store.ListNodes(context.Background())
 	if err != nil {
@@ -287,6 +503,21 @@ func (m FleetDashboard) fetchNodes() tea.Msg {
 	return nodesMsg(nodes)
 }
 
+// fetchHistory loads the recent executions of the node in the detail view.
+func (m FleetDashboard) fetchHistory() tea.Msg {
+	execs, err := m.store.ListExecutionsByNode(context.Background(), m.detail, fleet.DefaultNodeHistory)
+	return historyMsg{node: m.detail, execs: execs, err: err}
+}
+
+// refreshHistory reloads the detail view's history, or returns nil when
+// the list is showing.
+func (m FleetDashboard) refreshHistory() tea.Cmd {
+	if m.detail == "" {
+		return nil
+	}
+	return m.fetchHistory
+}
+
 func (m FleetDashboard) fetchSummary() tea.Msg {
 	summary, err := m.nodeMgr.Summary(context.Background())
 	if err != nil {
@@ -305,6 +536,15 @@ func clampInt(a, b int) int {
 // RunFleetDashboard starts the Bubble Tea fleet dashboard.
 func RunFleetDashboard(store fleet.Store, nodeMgr *fleet.NodeManager) error {
 	model := NewFleetDashboard(store, nodeMgr)
+
+	// Node changes refresh the view as they happen; polling still picks up
+	// heartbeats, and is all there is if the store cannot be watched.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if events, err := store.Watch(ctx); err == nil {
+		model.events = events
+	}
+
 	p := tea.NewProgram(model, tea.WithAltScreen())
 	_, err := p.Run()
 	return err
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/freitascorp/devopsclaw/pkg/fleet"
+)
+
+// dashboardWithNodes returns a dashboard over a store holding web-1, db-1
+// and cache-1, where db-1 ran "df -h", with the node list loaded.
+func dashboardWithNodes(t *testing.T) FleetDashboard {
+	t.Helper()
+	ctx := context.Background()
+	store := fleet.NewMemoryStore()
+	for _, id := range []fleet.NodeID{"web-1", "db-1", "cache-1"} {
+		store.RegisterNode(ctx, &fleet.Node{
+			ID:           id,
+			Status:       fleet.NodeStatusOnline,
+			Labels:       map[string]string{"role": strings.TrimSuffix(string(id), "-1")},
+			Capabilities: []string{"shell", "docker"},
+			LastSeen:     time.Now(),
+			Resources:    fleet.NodeResources{CPUCores: 4, MemoryMB: 8192, MemoryUsedMB: 2048, Load1: 1.5},
+		})
+	}
+	data, _ := json.Marshal(fleet.ShellCommand{Command: "df -h"})
+	store.RecordExecution(ctx,
+		&fleet.ExecRequest{ID: "exec-42", Command: fleet.TypedCommand{Type: "shell", Data: data}, CreatedAt: time.Now()},
+		&fleet.ExecResult{NodeResults: []fleet.NodeResult{{NodeID: "db-1", Status: "failure", ExitCode: 2, Error: "disk full"}}})
+
+	m := NewFleetDashboard(store, nil)
+	next, _ := m.Update(m.fetchNodes())
+	return next.(FleetDashboard)
+}
+
+func press(t *testing.T, m FleetDashboard, key tea.KeyMsg) (FleetDashboard, tea.Cmd) {
+	t.Helper()
+	next, cmd := m.Update(key)
+	return next.(FleetDashboard), cmd
+}
+
+func TestFleetDashboard_SelectAndOpenDetail(t *testing.T) {
+	m := dashboardWithNodes(t)
+
+	// Nodes are sorted by ID, so down moves from cache-1 to db-1; up stops
+	// at the first row.
+	m, _ = press(t, m, tea.KeyMsg{Type: tea.KeyUp})
+	m, _ = press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	if got := m.nodes[m.selected].ID; got != "db-1" {
+		t.Fatalf("selected %s, want db-1", got)
+	}
+
+	m, cmd := press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.detail != "db-1" || cmd == nil {
+		t.Fatalf("detail = %q, want db-1 with a history fetch", m.detail)
+	}
+	next, _ := m.Update(cmd())
+	m = next.(FleetDashboard)
+
+	view := m.View()
+	for _, want := range []string{"db-1", "role=db", "shell, docker", "exec-42", "df -h", "disk full", "[esc] back"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("detail view missing %q:\n%s", want, view)
+		}
+	}
+
+	// Esc returns to the list with the selection kept, instead of quitting.
+	m, cmd = press(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.detail != "" || m.quitting || cmd != nil {
+		t.Fatalf("esc in detail view: detail=%q quitting=%v", m.detail, m.quitting)
+	}
+	if got := m.nodes[m.selected].ID; got != "db-1" {
+		t.Errorf("selected %s after esc, want db-1", got)
+	}
+	if view := m.View(); !strings.Contains(view, "[enter] details") {
+		t.Errorf("list view footer missing:\n%s", view)
+	}
+}
+
+func TestFleetDashboard_RefreshKeepsSelection(t *testing.T) {
+	m := dashboardWithNodes(t)
+	m, _ = press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	m, _ = press(t, m, tea.KeyMsg{Type: tea.KeyDown})
+
+	// A refresh that drops a node above the selection keeps web-1 selected.
+	m.store.DeregisterNode(context.Background(), "cache-1")
+	next, _ := m.Update(m.fetchNodes())
+	m = next.(FleetDashboard)
+	if got := m.nodes[m.selected].ID; got != "web-1" {
+		t.Errorf("selected %s after refresh, want web-1", got)
+	}
+
+	// History answers for a node no longer open are ignored.
+	m, _ = press(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	next, _ = m.Update(historyMsg{node: "db-1", execs: []fleet.NodeExecution{{Request: &fleet.ExecRequest{ID: "stale"}}}})
+	m = next.(FleetDashboard)
+	if len(m.history) != 0 {
+		t.Errorf("history = %+v, want the db-1 answer dropped", m.history)
+	}
+}
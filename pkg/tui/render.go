@@ -33,6 +33,17 @@ func Linkify(s string) string {
 // ansiSeqRe matches ANSI CSI sequences (e.g. \x1b[38;2;204;119;0m).
 var ansiSeqRe = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
+// escapeSeqRe matches any terminal escape sequence: CSI (colors, cursor
+// movement), OSC (titles, hyperlinks), and two-byte escapes.
+var escapeSeqRe = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-_])`)
+
+// StripANSI removes terminal escape sequences from s, leaving plain text.
+// Used on tool output that carries its own colors, which can clash with
+// the theme.
+func StripANSI(s string) string {
+	return escapeSeqRe.ReplaceAllString(s, "")
+}
+
 // PropagateANSI ensures every line in a multi-line string is
 // ANSI-self-contained. The viewport splits content by \n and displays
 // an arbitrary window of lines. Without propagation, lines that depend
@@ -354,9 +365,10 @@ func FmtResultSummary(content string, isError bool) string {
 }
 
 // TruncateOutput truncates multi-line output to maxLines.
+// A maxLines of zero or less leaves the output untouched.
 func TruncateOutput(output string, maxLines int) string {
 	lines := strings.Split(output, "\n")
-	if len(lines) <= maxLines {
+	if maxLines <= 0 || len(lines) <= maxLines {
 		return output
 	}
 	total := len(lines)
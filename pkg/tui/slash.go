@@ -0,0 +1,257 @@
+// Package tui – slash.go
+// Slash commands typed into the chat input, and the palette that
+// autocompletes them.
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// slashCommand describes a command for /help and the palette.
+type slashCommand struct {
+	Name string // with the leading slash
+	Args string // argument synopsis, e.g. "<name>"
+	Desc string
+}
+
+// slashCommands lists the commands the palette offers: the TUI's own,
+// then the agent loop's, which are sent to the agent as typed.
+var slashCommands = []slashCommand{
+	{Name: "/help", Desc: "List slash commands"},
+	{Name: "/clear", Desc: "Clear the conversation and the agent's history"},
+	{Name: "/model", Args: "<name>", Desc: "Switch the agent's model"},
+	{Name: "/plan", Args: "[on|off]", Desc: "Toggle plan mode: the agent describes its steps instead of running tools"},
+	{Name: "/save", Args: "[file]", Desc: "Save the conversation as Markdown"},
+	{Name: "/strip-ansi", Args: "[on|off]", Desc: "Toggle stripping escape codes from tool output"},
+	{Name: "/max-output-lines", Args: "<n>", Desc: "Lines per expanded tool result (0 = unlimited)"},
+	{Name: "/show", Args: "model|channel|agents", Desc: "Show the current model, channel or agents"},
+	{Name: "/list", Args: "models|channels|agents", Desc: "List models, channels or agents"},
+	{Name: "/set", Args: "max-iterations <n>", Desc: "Set this session's tool-call limit"},
+}
+
+// planPreamble is prepended to prompts sent in plan mode.
+const planPreamble = "Plan mode: do not call any tools. Describe the steps you would take " +
+	"and the commands you would run, then wait for my go-ahead.\n\n"
+
+// parseSlashCommand splits text into a command name and its arguments.
+// ok is false for a normal prompt, including one that starts with a path
+// such as "/etc/hosts is missing an entry".
+func parseSlashCommand(text string) (name string, args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	name = fields[0]
+	if len(name) < 2 || name[0] != '/' || strings.Contains(name[1:], "/") {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+// isSlashCommand reports whether text starts with a command the palette
+// lists.
+func isSlashCommand(text string) bool {
+	name, _, ok := parseSlashCommand(text)
+	if !ok {
+		return false
+	}
+	for _, c := range slashCommands {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSlashCommand runs the slash commands the TUI owns. It reports
+// false for anything else, including the agent's own commands, so the
+// text is sent to the agent as typed.
+func (m ChatApp) handleSlashCommand(text string) (ChatApp, tea.Cmd, bool) {
+	if next, ok := m.handleDisplayCommand(text); ok {
+		return next, tea.ClearScreen, true
+	}
+	name, args, ok := parseSlashCommand(text)
+	if !ok {
+		return m, nil, false
+	}
+
+	switch name {
+	case "/help":
+		return m.notice(slashHelp()), nil, true
+
+	case "/clear":
+		m.messages = nil
+		m.streamIdx = -1
+		m.send("/clear")
+		return m.rebuildChatContent(), tea.ClearScreen, true
+
+	case "/model":
+		if len(args) != 1 {
+			return m.notice(fmt.Sprintf("Current model: %s · usage: /model <name>", m.model)), nil, true
+		}
+		m.model = args[0]
+		m.send("/switch model to " + args[0])
+		return m, nil, true
+
+	case "/plan":
+		on := m.permMode != "plan"
+		switch {
+		case len(args) == 0:
+		case args[0] == "on":
+			on = true
+		case args[0] == "off":
+			on = false
+		default:
+			return m.notice("usage: /plan [on|off]"), nil, true
+		}
+		if !on {
+			m.permMode = "default"
+			return m.notice("Plan mode off"), nil, true
+		}
+		m.permMode = "plan"
+		return m.notice("Plan mode on: the agent describes its steps without running tools"), nil, true
+
+	case "/save":
+		path := fmt.Sprintf("devopsclaw-chat-%s.md", time.Now().Format("20060102-150405"))
+		if len(args) > 0 {
+			path = args[0]
+		}
+		return m, saveTranscript(path, append([]ChatMsg(nil), m.messages...)), true
+	}
+	return m, nil, false
+}
+
+// send hands text to the agent through the prompt channel and OnSend.
+func (m ChatApp) send(text string) {
+	if m.promptCh != nil {
+		m.promptCh <- text
+	}
+	if m.OnSend != nil {
+		go m.OnSend(text)
+	}
+}
+
+// notice adds a one-line system notice to the chat.
+func (m ChatApp) notice(text string) ChatApp {
+	m.messages = append(m.messages, ChatMsg{
+		Role:    "system-warn",
+		Content: text,
+		Time:    time.Now(),
+	})
+	return m.rebuildChatContent()
+}
+
+// slashHelp lists the slash commands for /help.
+func slashHelp() string {
+	var b strings.Builder
+	b.WriteString("Slash commands:")
+	for _, c := range slashCommands {
+		usage := strings.TrimSpace(c.Name + " " + c.Args)
+		fmt.Fprintf(&b, "\n  %-34s %s", usage, c.Desc)
+	}
+	return b.String()
+}
+
+// saveTranscript writes msgs to path as Markdown, off the UI goroutine,
+// and reports the outcome in the chat.
+func saveTranscript(path string, msgs []ChatMsg) tea.Cmd {
+	return func() tea.Msg {
+		if err := os.WriteFile(path, []byte(Transcript(msgs)), 0o600); err != nil {
+			return AppendChatMsg{Msg: ChatMsg{Role: "error", Content: fmt.Sprintf("save: %v", err), Time: time.Now()}}
+		}
+		return AppendChatMsg{Msg: ChatMsg{
+			Role:    "system-warn",
+			Content: fmt.Sprintf("Saved %d messages to %s", len(msgs), path),
+			Time:    time.Now(),
+		}}
+	}
+}
+
+// Transcript renders the conversation in msgs as Markdown: prompts,
+// replies, tool calls with their output, and errors. Step markers and
+// usage lines are left out.
+func Transcript(msgs []ChatMsg) string {
+	var blocks []string
+	for _, msg := range msgs {
+		ts := msg.Time.Format("15:04")
+		switch msg.Role {
+		case "user":
+			blocks = append(blocks, fmt.Sprintf("**You** (%s)\n\n%s", ts, msg.Content))
+		case "assistant", "summary":
+			blocks = append(blocks, msg.Content)
+		case "tool":
+			if msg.Content == "" {
+				blocks = append(blocks, "`"+FormatToolHdr(msg.ToolName, msg.ToolArgs)+"`")
+				continue
+			}
+			blocks = append(blocks, "```\n"+StripANSI(strings.TrimRight(msg.Content, "\n"))+"\n```")
+		case "error":
+			blocks = append(blocks, "> Error: "+msg.Content)
+		}
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// paletteMatches returns the commands the input could complete to, while
+// the input is a bare command prefix such as "/mo".
+func (m ChatApp) paletteMatches() []slashCommand {
+	v := m.input.Value()
+	if !strings.HasPrefix(v, "/") || strings.ContainsAny(v, " \n") {
+		return nil
+	}
+	var matches []slashCommand
+	for _, c := range slashCommands {
+		if strings.HasPrefix(c.Name, v) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// completePalette replaces the input with the selected palette command.
+func (m ChatApp) completePalette(matches []slashCommand) ChatApp {
+	c := matches[m.paletteIdx%len(matches)]
+	value := c.Name
+	if c.Args != "" {
+		value += " "
+	}
+	m.input.SetValue(value)
+	m.paletteIdx = 0
+	return m
+}
+
+// renderPalette renders the autocomplete popup, or "" when the input is
+// not a command prefix.
+func (m ChatApp) renderPalette(w int) string {
+	matches := m.paletteMatches()
+	if len(matches) == 0 {
+		return ""
+	}
+	var lines []string
+	for i, c := range matches {
+		line := fmt.Sprintf("%-20s %s", strings.TrimSpace(c.Name+" "+c.Args), c.Desc)
+		line = TruncStr(line, w-4)
+		if i == m.paletteIdx%len(matches) {
+			lines = append(lines, PrimaryText.Render("❯ "+line))
+			continue
+		}
+		lines = append(lines, MutedText.Render("  "+line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// overlayBottom draws popup over the last lines of view, keeping its
+// height.
+func overlayBottom(view, popup string) string {
+	lines := strings.Split(view, "\n")
+	pop := strings.Split(popup, "\n")
+	if len(pop) >= len(lines) {
+		return popup
+	}
+	return strings.Join(append(lines[:len(lines)-len(pop)], pop...), "\n")
+}
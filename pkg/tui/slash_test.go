@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// submit types text into the input and presses Enter.
+func submit(t *testing.T, m ChatApp, text string) (ChatApp, tea.Cmd) {
+	t.Helper()
+	m.input.SetValue(text)
+	next, cmd := m.handleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	return next.(ChatApp), cmd
+}
+
+// chatWithPrompts returns a chat app whose prompts land in the returned
+// channel.
+func chatWithPrompts() (ChatApp, chan string) {
+	prompts := make(chan string, 10)
+	m := NewChatApp("test-model")
+	m.promptCh = prompts
+	return m, prompts
+}
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		args []string
+		ok   bool
+	}{
+		{"/model gpt-4o", "/model", []string{"gpt-4o"}, true},
+		{"  /clear  ", "/clear", []string{}, true},
+		{"/show model", "/show", []string{"model"}, true},
+		{"why is the disk full?", "", nil, false},
+		{"/etc/hosts is missing an entry", "", nil, false},
+		{"/", "", nil, false},
+		{"", "", nil, false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseSlashCommand(tt.text)
+		if name != tt.name || ok != tt.ok || (ok && !reflect.DeepEqual(args, tt.args)) {
+			t.Errorf("parseSlashCommand(%q) = %q, %q, %v; want %q, %q, %v", tt.text, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestChatApp_PromptVsSlashCommand(t *testing.T) {
+	m, prompts := chatWithPrompts()
+
+	m, _ = submit(t, m, "/etc/hosts is missing an entry")
+	if got := <-prompts; got != "/etc/hosts is missing an entry" {
+		t.Errorf("prompt sent as %q", got)
+	}
+	if len(m.messages) != 1 || m.messages[0].Role != "user" {
+		t.Errorf("messages = %+v, want the prompt shown as a user message", m.messages)
+	}
+
+	// The agent's own commands are sent as typed.
+	m, _ = submit(t, m, "/show model")
+	if got := <-prompts; got != "/show model" {
+		t.Errorf("agent command sent as %q", got)
+	}
+
+	m, _ = submit(t, m, "/help")
+	if len(prompts) != 0 {
+		t.Errorf("/help should not reach the agent, got %q", <-prompts)
+	}
+	if last := m.messages[len(m.messages)-1]; last.Role != "system-warn" || !strings.Contains(last.Content, "/model <name>") {
+		t.Errorf("/help notice = %+v", last)
+	}
+}
+
+func TestChatApp_ClearCommand(t *testing.T) {
+	m, prompts := chatWithPrompts()
+	for _, msg := range []tea.Msg{
+		AppendChatMsg{Msg: ChatMsg{Role: "user", Content: "check disk", Time: time.Now()}},
+		AppendChatMsg{Msg: ChatMsg{Role: "assistant", Content: "Disk is fine.", Time: time.Now()}},
+	} {
+		next, _ := m.Update(msg)
+		m = next.(ChatApp)
+	}
+
+	m, _ = submit(t, m, "/clear")
+	if len(m.messages) != 0 {
+		t.Errorf("messages after /clear = %+v, want none", m.messages)
+	}
+	if strings.Contains(m.chatView.View(), "Disk is fine.") {
+		t.Error("cleared messages are still rendered")
+	}
+	if got := <-prompts; got != "/clear" {
+		t.Errorf("agent told %q, want /clear", got)
+	}
+}
+
+func TestChatApp_ModelCommand(t *testing.T) {
+	m, prompts := chatWithPrompts()
+	m.width = 160
+
+	m, _ = submit(t, m, "/model gpt-4o")
+	if m.model != "gpt-4o" || !strings.Contains(m.renderFooter(), "gpt-4o") {
+		t.Errorf("model = %q, footer:\n%s", m.model, m.renderFooter())
+	}
+	if got := <-prompts; got != "/switch model to gpt-4o" {
+		t.Errorf("agent told %q", got)
+	}
+
+	m, _ = submit(t, m, "/model")
+	if last := m.messages[len(m.messages)-1]; !strings.Contains(last.Content, "Current model: gpt-4o") {
+		t.Errorf("/model without a name = %+v", last)
+	}
+}
+
+func TestChatApp_PlanMode(t *testing.T) {
+	m, prompts := chatWithPrompts()
+
+	m, _ = submit(t, m, "/plan")
+	if m.permMode != "plan" {
+		t.Fatalf("permMode = %q, want plan", m.permMode)
+	}
+	m, _ = submit(t, m, "restart nginx on web-1")
+	if got := <-prompts; got != planPreamble+"restart nginx on web-1" {
+		t.Errorf("plan-mode prompt = %q", got)
+	}
+	if last := m.messages[len(m.messages)-1]; last.Content != "restart nginx on web-1" {
+		t.Errorf("shown prompt = %q, want it without the preamble", last.Content)
+	}
+
+	m, _ = submit(t, m, "/plan off")
+	if m.permMode != "default" {
+		t.Errorf("permMode = %q after /plan off", m.permMode)
+	}
+}
+
+func TestChatApp_SaveCommand(t *testing.T) {
+	m := NewChatApp("test-model")
+	m.messages = []ChatMsg{
+		{Role: "user", Content: "check disk", Time: time.Now()},
+		{Role: "tool", ToolName: "exec", ToolArgs: map[string]any{"command": "df -h"}},
+		{Role: "tool", Content: "\x1b[32m/dev/sda1 42%\x1b[0m"},
+		{Role: "system", Content: "── step 2/20 ──"},
+		{Role: "assistant", Content: "Disk is at **42%**."},
+	}
+	path := filepath.Join(t.TempDir(), "chat.md")
+
+	m, cmd := submit(t, m, "/save "+path)
+	if cmd == nil {
+		t.Fatal("/save should return a command that writes the file")
+	}
+	if msg, ok := cmd().(AppendChatMsg); !ok || !strings.Contains(msg.Msg.Content, "Saved 5 messages") {
+		t.Errorf("save result = %+v", msg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{"check disk", "```\n/dev/sda1 42%\n```", "Disk is at **42%**."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("transcript missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "step 2/20") {
+		t.Errorf("transcript should leave out step markers:\n%s", got)
+	}
+}
+
+func TestChatApp_Palette(t *testing.T) {
+	m := NewChatApp("test-model")
+	m.input.SetValue("/m")
+
+	var names []string
+	for _, c := range m.paletteMatches() {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "/model,/max-output-lines" {
+		t.Errorf("matches for /m = %v", names)
+	}
+	if view := m.View(); !strings.Contains(view, "Switch the agent's model") {
+		t.Errorf("palette not shown:\n%s", view)
+	}
+
+	next, _ := m.handleKey(tea.KeyMsg{Type: tea.KeyDown})
+	next, _ = next.(ChatApp).handleKey(tea.KeyMsg{Type: tea.KeyTab})
+	m = next.(ChatApp)
+	if got := m.input.Value(); got != "/max-output-lines " {
+		t.Errorf("completed input = %q", got)
+	}
+	if m.toolsExpanded {
+		t.Error("tab completing a command should not toggle details")
+	}
+	if m.paletteMatches() != nil {
+		t.Error("palette should close once arguments are being typed")
+	}
+
+	// Enter on a partial command completes it instead of sending it.
+	m.input.SetValue("/cl")
+	next, _ = m.handleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := next.(ChatApp).input.Value(); got != "/clear" {
+		t.Errorf("enter on /cl left %q", got)
+	}
+}